@@ -2,6 +2,7 @@ package admin
 
 import (
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +16,9 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/config"
 	"github.com/botlabs-gg/yagpdb/v2/common/internalapi"
+	"github.com/botlabs-gg/yagpdb/v2/common/pluginhealth"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/lib/dshardorchestrator/orchestrator/rest"
 	"github.com/botlabs-gg/yagpdb/v2/web"
 	"goji.io"
@@ -27,15 +31,20 @@ var PageHTMLPanel string
 //go:embed assets/bot_admin_config.html
 var PageHTMLConfig string
 
+//go:embed assets/bot_admin_health.html
+var PageHTMLHealth string
+
 // InitWeb implements web.Plugin
 func (p *Plugin) InitWeb() {
 	web.AddHTMLTemplate("admin/assets/bot_admin_panel.html", PageHTMLPanel)
 	web.AddHTMLTemplate("admin/assets/bot_admin_config.html", PageHTMLConfig)
+	web.AddHTMLTemplate("admin/assets/bot_admin_health.html", PageHTMLHealth)
 
 	mux := goji.SubMux()
 	web.RootMux.Handle(pat.New("/admin/*"), mux)
 	web.RootMux.Handle(pat.New("/admin"), mux)
 
+	mux.Use(web.IPAllowlistMiddleware)
 	mux.Use(web.RequireSessionMiddleware)
 	mux.Use(web.RequireBotOwnerMW)
 
@@ -68,6 +77,14 @@ func (p *Plugin) InitWeb() {
 	getConfigHandler := web.ControllerHandler(p.handleGetConfig, "bot_admin_config")
 	mux.Handle(pat.Get("/config"), getConfigHandler)
 	mux.Handle(pat.Post("/config/edit/:key"), web.ControllerPostHandler(p.handleEditConfig, getConfigHandler, nil))
+
+	mux.Handle(pat.Get("/health"), web.ControllerHandler(p.handleGetHealth, "bot_admin_health"))
+
+	mux.Handle(pat.Post("/maintenance"), web.ControllerPostHandler(p.handleSetMaintenance, panelHandler, nil))
+	mux.Handle(pat.Post("/purge_page_cache"), web.ControllerPostHandler(p.handlePurgePageCache, panelHandler, nil))
+
+	mux.Handle(pat.Get("/log_settings"), web.APIHandler(p.handleGetLogSettings))
+	mux.Handle(pat.Post("/log_settings"), web.APIHandler(p.handleUpdateLogSettings))
 }
 
 type Host struct {
@@ -115,6 +132,7 @@ func (p *Plugin) handleGetPanel(w http.ResponseWriter, r *http.Request) (web.Tem
 	}
 
 	tmpl["Hosts"] = hosts
+	tmpl["MaintenanceState"] = web.CurrentMaintenance()
 
 	return tmpl, nil
 }
@@ -264,6 +282,19 @@ func (p *Plugin) handleGetConfig(w http.ResponseWriter, r *http.Request) (web.Te
 	return tmpl, nil
 }
 
+func (p *Plugin) handleGetHealth(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, tmpl := web.GetBaseCPContextData(r.Context())
+
+	statuses, err := pluginhealth.GetStatuses()
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["PluginHealth"] = statuses
+
+	return tmpl, nil
+}
+
 func (p *Plugin) handleEditConfig(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	_, tmpl := web.GetBaseCPContextData(r.Context())
 
@@ -312,6 +343,88 @@ func (p *Plugin) handleEditConfig(w http.ResponseWriter, r *http.Request) (web.T
 	return tmpl, nil
 }
 
+// handleSetMaintenance turns maintenance mode on or off for every webserver, without restarting them
+func (p *Plugin) handleSetMaintenance(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	_, tmpl := web.GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/admin")
+
+	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	m := &web.Maintenance{
+		Enabled:   r.FormValue("enabled") == "1",
+		Message:   strings.TrimSpace(r.FormValue("message")),
+		Since:     time.Now(),
+		EnabledBy: user.ID,
+	}
+
+	if err := web.SetMaintenance(m); err != nil {
+		return tmpl, err
+	}
+
+	web.EmitSecurityEvent(r, &web.SecurityEvent{
+		Type:    web.SecurityEventOwnerAction,
+		Details: map[string]string{"action": "set_maintenance", "enabled": strconv.FormatBool(m.Enabled)},
+	})
+
+	if m.Enabled {
+		tmpl.AddAlerts(web.SucessAlert("Maintenance mode enabled"))
+		tmpl["Maintenance"] = m
+	} else {
+		tmpl.AddAlerts(web.SucessAlert("Maintenance mode disabled"))
+		delete(tmpl, "Maintenance")
+	}
+
+	tmpl["MaintenanceState"] = m
+	return tmpl, nil
+}
+
+// handlePurgePageCache removes the pages cached for logged out users, e.g after changing something shown on them
+// through the config
+func (p *Plugin) handlePurgePageCache(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, tmpl := web.GetBaseCPContextData(r.Context())
+	tmpl.SetVisibleURL("/admin")
+
+	if err := web.PurgeAllPageCaches(); err != nil {
+		return tmpl, err
+	}
+
+	web.EmitSecurityEvent(r, &web.SecurityEvent{
+		Type:    web.SecurityEventOwnerAction,
+		Details: map[string]string{"action": "purge_page_cache"},
+	})
+
+	tmpl.AddAlerts(web.SucessAlert("Purged the page cache"))
+	return tmpl, nil
+}
+
+func (p *Plugin) handleGetLogSettings(w http.ResponseWriter, r *http.Request) interface{} {
+	return common.CurrentLogSettings()
+}
+
+// handleUpdateLogSettings changes the log level, debug guilds and sampling rules of all nodes
+func (p *Plugin) handleUpdateLogSettings(w http.ResponseWriter, r *http.Request) interface{} {
+	var settings common.LogSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return web.NewPublicError("Invalid log settings: ", err)
+	}
+
+	// applied locally first to validate them before they're sent to the other nodes
+	if err := common.SetLogSettings(&settings); err != nil {
+		return web.NewPublicError("Invalid log settings: ", err)
+	}
+
+	if err := pubsub.Publish("update_log_settings", -1, &settings); err != nil {
+		return err
+	}
+
+	web.EmitSecurityEvent(r, &web.SecurityEvent{
+		Type:    web.SecurityEventOwnerAction,
+		Details: map[string]string{"action": "update_log_settings", "level": settings.Level},
+	})
+
+	return common.CurrentLogSettings()
+}
+
 func (p *Plugin) handleGetShardSessions(w http.ResponseWriter, r *http.Request) {
 	client, err := createOrhcestatorRESTClient(r)
 	if err != nil {
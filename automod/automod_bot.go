@@ -14,6 +14,7 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/bot/eventsystem"
 	"github.com/botlabs-gg/yagpdb/v2/commands"
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/ignorelist"
 	"github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2"
 	schEventsModels "github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2/models"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
@@ -30,6 +31,9 @@ func (p *Plugin) BotInit() {
 	eventsystem.AddHandlerAsyncLastLegacy(p, p.handleGuildMemberUpdate, eventsystem.EventGuildMemberUpdate)
 	eventsystem.AddHandlerAsyncLastLegacy(p, p.handleMsgUpdate, eventsystem.EventMessageUpdate)
 	eventsystem.AddHandlerAsyncLastLegacy(p, p.handleGuildMemberJoin, eventsystem.EventGuildMemberAdd)
+	eventsystem.AddHandlerAsyncLastLegacy(p, handleMessageRate, eventsystem.EventMessageCreate)
+
+	go messageRates.run()
 
 	scheduledevents2.RegisterHandler("amod2_reset_channel_ratelimit", ResetChannelRatelimitData{}, handleResetChannelRatelimit)
 }
@@ -38,6 +42,16 @@ type ResetChannelRatelimitData struct {
 	ChannelID int64
 }
 
+// counts the message towards the message rate of the channel, which is used to suggest thresholds on the control panel
+func handleMessageRate(evt *eventsystem.EventData) {
+	msg := evt.MessageCreate().Message
+	if msg.GuildID == 0 || !bot.IsNormalUserMessage(msg) {
+		return
+	}
+
+	messageRates.inc(msg.GuildID, msg.ChannelID)
+}
+
 func (p *Plugin) handleMsgUpdate(evt *eventsystem.EventData) {
 	p.checkMessage(evt, evt.MessageUpdate().Message)
 }
@@ -52,6 +66,10 @@ func (p *Plugin) checkMessage(evt *eventsystem.EventData, msg *discordgo.Message
 		return true
 	}
 
+	if msg.Author.Bot && ignorelist.IsIgnored(msg.GuildID, msg.Author.ID, ignorelist.FeatureAutomod) {
+		return true
+	}
+
 	cs := evt.GS.GetChannelOrThread(msg.ChannelID)
 	if cs == nil {
 		return true
@@ -76,6 +76,7 @@ func (p *Plugin) InitWeb() {
 	muxer.Handle(pat.Get("/"), getIndexHandler)
 	muxer.Handle(pat.Get(""), getIndexHandler)
 	muxer.Handle(pat.Get("/logs"), web.ControllerHandler(p.handleGetLogs, "automod_index"))
+	muxer.Handle(pat.Get("/message_rates.json"), web.APIHandler(p.handleGetMessageRatesJSON))
 
 	muxer.Handle(pat.Post("/new_ruleset"), web.ControllerPostHandler(p.handlePostAutomodCreateRuleset, getIndexHandler, CreateRulesetData{}))
 
@@ -121,9 +122,83 @@ func (p *Plugin) handleGetAutomodIndex(w http.ResponseWriter, r *http.Request) (
 	tmpl["PartMap"] = RulePartMap
 	tmpl["PartList"] = RulePartList
 
+	rates, err := guildMessageRates(g)
+	if err != nil {
+		web.CtxLogger(r.Context()).WithError(err).Error("failed retrieving channel message rates")
+	} else {
+		if len(rates) > 10 {
+			rates = rates[:10]
+		}
+		tmpl["MessageRates"] = rates
+		tmpl["MessageRateWindow"] = MessageRateWindow
+	}
+
 	return tmpl, nil
 }
 
+// guildMessageRates returns the message rates of the channels in the guild, with the channel names filled in
+func guildMessageRates(g *dstate.GuildSet) ([]*ChannelMessageRate, error) {
+	rates, err := GetChannelMessageRates(g.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := rates[:0]
+	for _, v := range rates {
+		cs := g.GetChannelOrThread(v.ChannelID)
+		if cs == nil {
+			// deleted since
+			continue
+		}
+
+		v.ChannelName = cs.Name
+		filtered = append(filtered, v)
+	}
+
+	return filtered, nil
+}
+
+// MessageRatesResponse is the response of the message rates api
+type MessageRatesResponse struct {
+	WindowMinutes int                        `json:"window_minutes"`
+	Interval      int                        `json:"interval"`
+	Channels      []*ChannelMessageRateEntry `json:"channels"`
+}
+
+// ChannelMessageRateEntry is the rate of a channel along with the threshold suggested for the requested interval
+type ChannelMessageRateEntry struct {
+	*ChannelMessageRate
+	SuggestedThreshold int `json:"suggested_threshold"`
+}
+
+// handleGetMessageRatesJSON handles GET /manage/:server/automod/message_rates.json, the interval query parameter (seconds, default 5)
+// is the "within" of the channel messages trigger the thresholds are suggested for
+func (p *Plugin) handleGetMessageRatesJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	g, _ := web.GetBaseCPContextData(r.Context())
+
+	interval, _ := strconv.Atoi(r.URL.Query().Get("interval"))
+	if interval < 1 || interval > 3600 {
+		interval = 5
+	}
+
+	rates, err := guildMessageRates(g)
+	if err != nil {
+		return err
+	}
+
+	resp := &MessageRatesResponse{
+		WindowMinutes: MessageRateWindow,
+		Interval:      interval,
+		Channels:      make([]*ChannelMessageRateEntry, 0, len(rates)),
+	}
+
+	for _, v := range rates {
+		resp.Channels = append(resp.Channels, &ChannelMessageRateEntry{ChannelMessageRate: v, SuggestedThreshold: v.SuggestedThreshold(interval)})
+	}
+
+	return resp
+}
+
 func (p *Plugin) handleGetLogs(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	g, tmpl := web.GetBaseCPContextData(r.Context())
 
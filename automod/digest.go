@@ -0,0 +1,53 @@
+package automod
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithDigest = (*Plugin)(nil)
+
+// Digest implements web.PluginWithDigest, summarizing the rules that triggered the most
+func (p *Plugin) Digest(ctx context.Context, guildID int64, from, to time.Time) ([]*web.DigestSection, error) {
+	const q = `SELECT rule_name, ruleset_name, count(*) FROM automod_triggered_rules
+WHERE guild_id=$1 AND created_at >= $2 AND created_at < $3
+GROUP BY rule_name, ruleset_name ORDER BY count(*) DESC`
+
+	rows, err := common.PQ.QueryContext(ctx, q, guildID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	section := &web.DigestSection{Title: "Automoderator", Link: "/automod"}
+
+	total := 0
+	var lines []string
+	for rows.Next() {
+		var rule, ruleset string
+		var count int
+		if err := rows.Scan(&rule, &ruleset, &count); err != nil {
+			return nil, err
+		}
+
+		total += count
+		if len(lines) < 5 {
+			lines = append(lines, fmt.Sprintf("%s (%s): triggered %d times", rule, ruleset, count))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if total > 0 {
+		// only the latest 200 triggers are kept per server, so on busy servers this is less than what happened
+		section.Lines = append([]string{fmt.Sprintf("Rules triggered %d times", total)}, lines...)
+	}
+
+	return []*web.DigestSection{section}, nil
+}
@@ -0,0 +1,175 @@
+package automod
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+)
+
+// MessageRateWindow is how many minutes back the channel message rates are tracked
+const MessageRateWindow = 60
+
+// the suggested thresholds allow this many times the busiest minute of the channel, so normal bursts don't trigger
+const suggestionBurstFactor = 3
+
+func keyMessageRates(guildID int64, minute int64) string {
+	return "automod_msg_rates:" + strconv.FormatInt(guildID, 10) + ":" + strconv.FormatInt(minute, 10)
+}
+
+// messageRateCounter counts the messages sent in every channel, flushing the counts to a per minute bucket in redis
+type messageRateCounter struct {
+	mu       sync.Mutex
+	channels map[int64]*messageRateEntry
+}
+
+type messageRateEntry struct {
+	GuildID int64
+	Count   int64
+}
+
+var messageRates = &messageRateCounter{
+	channels: make(map[int64]*messageRateEntry),
+}
+
+func (c *messageRateCounter) inc(guildID, channelID int64) {
+	c.mu.Lock()
+	if e, ok := c.channels[channelID]; ok {
+		e.Count++
+	} else {
+		c.channels[channelID] = &messageRateEntry{GuildID: guildID, Count: 1}
+	}
+	c.mu.Unlock()
+}
+
+func (c *messageRateCounter) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for t := range ticker.C {
+		err := c.flush(t)
+		if err != nil {
+			logger.WithError(err).Error("failed flushing channel message rates")
+		}
+	}
+}
+
+func (c *messageRateCounter) flush(t time.Time) error {
+	c.mu.Lock()
+	channels := c.channels
+	c.channels = make(map[int64]*messageRateEntry)
+	c.mu.Unlock()
+
+	if len(channels) < 1 {
+		return nil
+	}
+
+	// the counts are of the minute before this flush
+	minute := t.Unix()/60 - 1
+	expire := strconv.Itoa((MessageRateWindow + 5) * 60)
+
+	actions := make([]radix.CmdAction, 0, len(channels)*2)
+	for channelID, e := range channels {
+		key := keyMessageRates(e.GuildID, minute)
+		actions = append(actions,
+			radix.FlatCmd(nil, "HINCRBY", key, channelID, e.Count),
+			radix.Cmd(nil, "EXPIRE", key, expire))
+	}
+
+	return common.RedisPool.Do(radix.Pipeline(actions...))
+}
+
+// ChannelMessageRate is the message rate of a channel over the last MessageRateWindow minutes
+type ChannelMessageRate struct {
+	ChannelID   int64  `json:"channel_id,string"`
+	ChannelName string `json:"channel_name"`
+
+	// AveragePerMinute counts the minutes without messages too
+	AveragePerMinute float64 `json:"average_per_minute"`
+	PeakPerMinute    int64   `json:"peak_per_minute"`
+	ActiveMinutes    int     `json:"active_minutes"`
+}
+
+// SuggestedThreshold returns a "x channel messages in y seconds" threshold for the interval that normal activity in the channel stays below
+func (r *ChannelMessageRate) SuggestedThreshold(intervalSeconds int) int {
+	return suggestThreshold(r.PeakPerMinute, intervalSeconds)
+}
+
+func suggestThreshold(peakPerMinute int64, intervalSeconds int) int {
+	if intervalSeconds < 1 {
+		intervalSeconds = 1
+	}
+
+	expected := float64(peakPerMinute) * float64(intervalSeconds) / 60
+	suggested := int(math.Ceil(expected * suggestionBurstFactor))
+	if suggested < 3 {
+		// anything lower triggers on a couple of people replying to each other
+		return 3
+	}
+
+	return suggested
+}
+
+// GetChannelMessageRates returns the message rates of the channels in the guild that had messages recently, busiest first
+func GetChannelMessageRates(guildID int64) ([]*ChannelMessageRate, error) {
+	now := time.Now().Unix() / 60
+
+	buckets := make([]map[string]int64, MessageRateWindow)
+	actions := make([]radix.CmdAction, 0, MessageRateWindow)
+	for i := range buckets {
+		actions = append(actions, radix.Cmd(&buckets[i], "HGETALL", keyMessageRates(guildID, now-int64(i)-1)))
+	}
+
+	err := common.RedisPool.Do(radix.Pipeline(actions...))
+	if err != nil {
+		return nil, err
+	}
+
+	return summarizeMessageRates(buckets), nil
+}
+
+func summarizeMessageRates(buckets []map[string]int64) []*ChannelMessageRate {
+	rates := make(map[int64]*ChannelMessageRate)
+	totals := make(map[int64]int64)
+
+	for _, bucket := range buckets {
+		for k, count := range bucket {
+			channelID, err := strconv.ParseInt(k, 10, 64)
+			if err != nil {
+				continue
+			}
+
+			r, ok := rates[channelID]
+			if !ok {
+				r = &ChannelMessageRate{ChannelID: channelID}
+				rates[channelID] = r
+			}
+
+			totals[channelID] += count
+			r.ActiveMinutes++
+			if count > r.PeakPerMinute {
+				r.PeakPerMinute = count
+			}
+		}
+	}
+
+	result := make([]*ChannelMessageRate, 0, len(rates))
+	for channelID, r := range rates {
+		r.AveragePerMinute = math.Round(float64(totals[channelID])/float64(len(buckets))*10) / 10
+		result = append(result, r)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AveragePerMinute == result[j].AveragePerMinute {
+			return result[i].ChannelID < result[j].ChannelID
+		}
+
+		return result[i].AveragePerMinute > result[j].AveragePerMinute
+	})
+
+	return result
+}
@@ -0,0 +1,43 @@
+package automod
+
+import "testing"
+
+func TestSummarizeMessageRates(t *testing.T) {
+	buckets := make([]map[string]int64, 10)
+	buckets[0] = map[string]int64{"1": 20, "2": 1}
+	buckets[3] = map[string]int64{"1": 40}
+	buckets[5] = map[string]int64{"2": 4, "bad": 100}
+
+	rates := summarizeMessageRates(buckets)
+	if len(rates) != 2 {
+		t.Fatalf("expected 2 channels, got %d", len(rates))
+	}
+
+	if rates[0].ChannelID != 1 || rates[0].AveragePerMinute != 6 || rates[0].PeakPerMinute != 40 || rates[0].ActiveMinutes != 2 {
+		t.Errorf("unexpected rate for channel 1: %#v", rates[0])
+	}
+
+	if rates[1].ChannelID != 2 || rates[1].AveragePerMinute != 0.5 || rates[1].PeakPerMinute != 4 {
+		t.Errorf("unexpected rate for channel 2: %#v", rates[1])
+	}
+}
+
+func TestSuggestThreshold(t *testing.T) {
+	cases := []struct {
+		peak     int64
+		interval int
+		expected int
+	}{
+		{peak: 0, interval: 5, expected: 3},
+		{peak: 60, interval: 5, expected: 15},
+		{peak: 12, interval: 60, expected: 36},
+		{peak: 13, interval: 10, expected: 7},
+		{peak: 100, interval: 0, expected: 5},
+	}
+
+	for _, c := range cases {
+		if got := suggestThreshold(c.peak, c.interval); got != c.expected {
+			t.Errorf("suggestThreshold(%d, %d) = %d, expected %d", c.peak, c.interval, got, c.expected)
+		}
+	}
+}
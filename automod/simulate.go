@@ -0,0 +1,114 @@
+package automod
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithEventSimulation = (*Plugin)(nil)
+
+// triggers that depend on the previous messages of the member, which a simulated event doesn't have
+func isHistoryTrigger(part RulePart) bool {
+	switch part.(type) {
+	case *SlowmodeTrigger, *MultiMsgMentionTrigger, *SpamTrigger:
+		return true
+	}
+
+	return false
+}
+
+// SimulateEvent implements web.PluginWithEventSimulation, listing the effects of the rules the event would trigger
+func (p *Plugin) SimulateEvent(ctx context.Context, evt *web.SimulatedEvent) ([]*web.SimulatedAction, error) {
+	rulesets, err := p.FetchGuildRulesets(evt.GS.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped := ""
+	if evt.Message != nil {
+		stripped = PrepareMessageForWordCheck(evt.Message.Content)
+	}
+
+	var actions []*web.SimulatedAction
+	for _, rs := range rulesets {
+		if !rs.RSModel.Enabled {
+			continue
+		}
+
+		ctxData := &TriggeredRuleData{
+			MS:      evt.Member,
+			CS:      evt.Channel,
+			GS:      evt.GS,
+			Plugin:  p,
+			Ruleset: rs,
+
+			Message: evt.Message,
+		}
+
+		if !p.CheckConditions(ctxData, rs.ParsedConditions) {
+			continue
+		}
+
+		for _, rule := range rs.Rules {
+			ctxData.CurrentRule = rule
+			if !p.CheckConditions(ctxData, rule.Conditions) {
+				continue
+			}
+
+			for _, trig := range rule.Triggers {
+				if evt.Type == web.SimulatedEventMessage && isHistoryTrigger(trig.Part) {
+					actions = append(actions, &web.SimulatedAction{
+						Plugin:      "Automoderator",
+						Description: fmt.Sprintf("%s / %s: the %q trigger depends on previous messages and was not checked", rs.RSModel.Name, rule.Model.Name, trig.Part.Name()),
+						Skipped:     true,
+						Link:        "/automod",
+					})
+					continue
+				}
+
+				activated, err := simulateTrigger(evt, trig, stripped)
+				if err != nil {
+					return nil, err
+				}
+
+				if !activated {
+					continue
+				}
+
+				for _, effect := range rule.Effects {
+					actions = append(actions, &web.SimulatedAction{
+						Plugin:      "Automoderator",
+						Description: fmt.Sprintf("%s / %s: %s (triggered by %q)", rs.RSModel.Name, rule.Model.Name, effect.Part.Name(), trig.Part.Name()),
+						Link:        "/automod",
+					})
+				}
+				break
+			}
+		}
+	}
+
+	return actions, nil
+}
+
+func simulateTrigger(evt *web.SimulatedEvent, trig *ParsedPart, stripped string) (bool, error) {
+	triggerCtx := &TriggerContext{GS: evt.GS, MS: evt.Member, Data: trig.ParsedSettings}
+
+	switch evt.Type {
+	case web.SimulatedEventMessage:
+		if cast, ok := trig.Part.(MessageTrigger); ok {
+			return cast.CheckMessage(triggerCtx, evt.Channel, evt.Message, stripped)
+		}
+	case web.SimulatedEventJoin:
+		if cast, ok := trig.Part.(JoinListener); ok {
+			return cast.CheckJoin(triggerCtx)
+		}
+
+		if cast, ok := trig.Part.(UsernameListener); ok {
+			return cast.CheckUsername(triggerCtx)
+		}
+	}
+
+	return false, nil
+}
@@ -58,7 +58,7 @@ func HandleAutomod(w http.ResponseWriter, r *http.Request) interface{} {
 	web.CheckErr(templateData, err, "Failed retrieving rules", web.CtxLogger(r.Context()).Error)
 
 	templateData["AutomodConfig"] = config
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(g.ID) + "/automod_legacy/"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/automod_legacy/")
 
 	return templateData
 }
@@ -0,0 +1,47 @@
+package autorole
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithEventSimulation = (*Plugin)(nil)
+
+// SimulateEvent implements web.PluginWithEventSimulation, listing the role a joining member would get
+func (p *Plugin) SimulateEvent(ctx context.Context, evt *web.SimulatedEvent) ([]*web.SimulatedAction, error) {
+	if evt.Type != web.SimulatedEventJoin {
+		return nil, nil
+	}
+
+	config, err := GetGeneralConfig(evt.GS.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	role := evt.GS.GetRole(config.Role)
+	if config.Role == 0 || role == nil {
+		return nil, nil
+	}
+
+	// the time requirement is described below rather than checked
+	if !config.CanAssignTo(evt.Member.Member.Roles, time.Time{}) {
+		return nil, nil
+	}
+
+	desc := fmt.Sprintf("Give the %s role", role.Name)
+	if config.RequiredDuration > 0 && !config.OnlyOnJoin {
+		desc += fmt.Sprintf(" after %d minutes", config.RequiredDuration)
+	}
+	if config.AssignRoleAfterScreening {
+		desc += ", once membership screening is completed"
+	}
+
+	return []*web.SimulatedAction{{
+		Plugin:      p.PluginInfo().Name,
+		Description: desc,
+		Link:        "/autorole",
+	}}, nil
+}
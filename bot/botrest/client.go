@@ -1,6 +1,7 @@
 package botrest
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -16,12 +17,17 @@ import (
 var clientLogger = common.GetFixedPrefixLogger("botrest_client")
 
 func GetGuild(guildID int64) (g *dstate.GuildSet, err error) {
-	err = internalapi.GetWithGuild(guildID, discordgo.StrID(guildID)+"/guild", &g)
+	return GetGuildContext(context.Background(), guildID)
+}
+
+// GetGuildContext is like GetGuild but forwards the request id in ctx to the bot
+func GetGuildContext(ctx context.Context, guildID int64) (g *dstate.GuildSet, err error) {
+	err = guildRequests.get(ctx, guildID, discordgo.StrID(guildID)+"/guild", &g)
 	return
 }
 
 func GetBotMember(guildID int64) (m *discordgo.Member, err error) {
-	err = internalapi.GetWithGuild(guildID, discordgo.StrID(guildID)+"/botmember", &m)
+	err = guildRequests.get(context.Background(), guildID, discordgo.StrID(guildID)+"/botmember", &m)
 	return
 }
 
@@ -31,6 +37,11 @@ func GetOnlineCount(guildID int64) (c int64, err error) {
 }
 
 func GetMembers(guildID int64, members ...int64) (m []*discordgo.Member, err error) {
+	return GetMembersContext(context.Background(), guildID, members...)
+}
+
+// GetMembersContext is like GetMembers but forwards the request id in ctx to the bot
+func GetMembersContext(ctx context.Context, guildID int64, members ...int64) (m []*discordgo.Member, err error) {
 	stringed := make([]string, 0, len(members))
 	for _, v := range members {
 		stringed = append(stringed, strconv.FormatInt(v, 10))
@@ -39,7 +50,7 @@ func GetMembers(guildID int64, members ...int64) (m []*discordgo.Member, err err
 	query := url.Values{"users": stringed}
 	encoded := query.Encode()
 
-	err = internalapi.GetWithGuild(guildID, discordgo.StrID(guildID)+"/members?"+encoded, &m)
+	err = internalapi.GetWithGuildContext(ctx, guildID, discordgo.StrID(guildID)+"/members?"+encoded, &m)
 	return
 }
 
@@ -73,7 +84,18 @@ func GetMemberMultiGuild(userID int64, guilds ...int64) (members []*discordgo.Me
 }
 
 func GetChannelPermissions(guildID, channelID int64) (perms int64, err error) {
-	err = internalapi.GetWithGuild(guildID, discordgo.StrID(guildID)+"/channelperms/"+discordgo.StrID(channelID), &perms)
+	return GetChannelPermissionsContext(context.Background(), guildID, channelID)
+}
+
+// GetChannelPermissionsContext is like GetChannelPermissions but forwards the request id in ctx to the bot
+func GetChannelPermissionsContext(ctx context.Context, guildID, channelID int64) (perms int64, err error) {
+	err = guildRequests.get(ctx, guildID, discordgo.StrID(guildID)+"/channelperms/"+discordgo.StrID(channelID), &perms)
+	return
+}
+
+// GetIntegrations returns the bots and webhooks known to be in the guild
+func GetIntegrations(ctx context.Context, guildID int64) (st []*Integration, err error) {
+	err = internalapi.GetWithGuildContext(ctx, guildID, discordgo.StrID(guildID)+"/integrations", &st)
 	return
 }
 
@@ -0,0 +1,104 @@
+package botrest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/internalapi"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confCoalesceCacheTTL = config.RegisterOption("yagpdb.botrest.client_cache_ms", "Milliseconds guild, bot member and channel permission responses from botrest are reused for, identical requests in flight are always merged. 0 to disable the cache", 2000)
+
+	metricsCoalescedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_botrest_client_requests_total",
+		Help: "Coalesced botrest GET requests, result is either hit (served from the cache), shared (waited on a identical request) or fetched",
+	}, []string{"result"})
+)
+
+type coalescedCall struct {
+	wg    sync.WaitGroup
+	value json.RawMessage
+	err   error
+}
+
+// coalescer merges identical GET requests in flight and keeps the responses around for a short while,
+// a lot of admins browsing the control panel of a big server would otherwise hit the bot with the same requests constantly
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+	cache *cache.Cache
+
+	ttl   func() time.Duration
+	fetch func(ctx context.Context, guildID int64, path string) (json.RawMessage, error)
+}
+
+func newCoalescer(ttl func() time.Duration, fetch func(ctx context.Context, guildID int64, path string) (json.RawMessage, error)) *coalescer {
+	return &coalescer{
+		calls: make(map[string]*coalescedCall),
+		cache: cache.New(time.Second*5, time.Minute),
+		ttl:   ttl,
+		fetch: fetch,
+	}
+}
+
+var guildRequests = newCoalescer(func() time.Duration {
+	return time.Millisecond * time.Duration(confCoalesceCacheTTL.GetInt())
+}, func(ctx context.Context, guildID int64, path string) (raw json.RawMessage, err error) {
+	err = internalapi.GetWithGuildContext(ctx, guildID, path, &raw)
+	return
+})
+
+// get decodes the response to path into dest, responses are decoded for every caller so they can't
+// modify each other's results. Merged requests only forward the request id of the first caller.
+func (c *coalescer) get(ctx context.Context, guildID int64, path string, dest interface{}) error {
+	raw, err := c.getRaw(ctx, guildID, path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, dest)
+}
+
+func (c *coalescer) getRaw(ctx context.Context, guildID int64, path string) (json.RawMessage, error) {
+	if v, ok := c.cache.Get(path); ok {
+		metricsCoalescedRequests.WithLabelValues("hit").Inc()
+		return v.(json.RawMessage), nil
+	}
+
+	c.mu.Lock()
+	if call, ok := c.calls[path]; ok {
+		c.mu.Unlock()
+		metricsCoalescedRequests.WithLabelValues("shared").Inc()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+
+	call := &coalescedCall{}
+	call.wg.Add(1)
+	c.calls[path] = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, path)
+		c.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	metricsCoalescedRequests.WithLabelValues("fetched").Inc()
+	call.value, call.err = c.fetch(ctx, guildID, path)
+
+	// errors are not cached, the next request tries again
+	if ttl := c.ttl(); call.err == nil && ttl > 0 {
+		c.cache.Set(path, call.value, ttl)
+	}
+
+	return call.value, call.err
+}
@@ -0,0 +1,94 @@
+package botrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescerMergesRequests(t *testing.T) {
+	var fetches int32
+	release := make(chan bool)
+	c := newCoalescer(func() time.Duration { return 0 }, func(ctx context.Context, guildID int64, path string) (json.RawMessage, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return json.RawMessage(`{"id":1}`), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var dest struct{ ID int }
+			if err := c.get(context.Background(), 1, "1/guild", &dest); err != nil || dest.ID != 1 {
+				t.Errorf("unexpected result %#v, %v", dest, err)
+			}
+		}()
+	}
+
+	// wait for the requests to pile up behind the first one
+	for i := 0; i < 100; i++ {
+		c.mu.Lock()
+		n := len(c.calls)
+		c.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+
+	close(release)
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("expected 1 fetch, got %d", fetches)
+	}
+
+	// with the cache disabled the next request goes through
+	var dest struct{ ID int }
+	c.get(context.Background(), 1, "1/guild", &dest)
+	if fetches != 2 {
+		t.Errorf("expected 2 fetches, got %d", fetches)
+	}
+}
+
+func TestCoalescerCache(t *testing.T) {
+	var fetches int
+	fail := true
+	c := newCoalescer(func() time.Duration { return time.Minute }, func(ctx context.Context, guildID int64, path string) (json.RawMessage, error) {
+		fetches++
+		if fail {
+			return nil, errors.New("botrest unavailable")
+		}
+		return json.RawMessage(`{"id":1}`), nil
+	})
+
+	var dest map[string]interface{}
+	if err := c.get(context.Background(), 1, "1/botmember", &dest); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// errors aren't cached
+	fail = false
+	if err := c.get(context.Background(), 1, "1/botmember", &dest); err != nil {
+		t.Fatal(err)
+	}
+
+	// callers get their own copy
+	dest["id"] = 2
+	var second map[string]interface{}
+	if err := c.get(context.Background(), 1, "1/botmember", &second); err != nil || second["id"] != float64(1) {
+		t.Errorf("unexpected cached result %#v, %v", second, err)
+	}
+
+	if fetches != 2 {
+		t.Errorf("expected 2 fetches, got %d", fetches)
+	}
+}
@@ -56,6 +56,7 @@ func (p *Plugin) InitInternalAPIRoutes(muxer *goji.Mux) {
 	muxer.HandleFunc(pat.Get("/:guild/membercolors"), HandleGetMemberColors)
 	muxer.HandleFunc(pat.Get("/:guild/onlinecount"), HandleGetOnlineCount)
 	muxer.HandleFunc(pat.Get("/:guild/channelperms/:channel"), HandleChannelPermissions)
+	muxer.HandleFunc(pat.Get("/:guild/integrations"), HandleGetIntegrations)
 	muxer.HandleFunc(pat.Get("/node_status"), HandleNodeStatus)
 	muxer.HandleFunc(pat.Get("/shard_sessions"), HandleGetShardSessions)
 	muxer.HandleFunc(pat.Post("/shard/:shard/reconnect"), HandleReconnectShard)
@@ -208,6 +209,47 @@ func HandleChannelPermissions(w http.ResponseWriter, r *http.Request) {
 	internalapi.ServeJson(w, r, perms)
 }
 
+// The kinds of integrations returned by /:guild/integrations
+const (
+	IntegrationTypeBot     = "bot"
+	IntegrationTypeWebhook = "webhook"
+)
+
+// Integration is a bot or webhook known to be in a guild
+type Integration struct {
+	ID   int64  `json:"id,string"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// HandleGetIntegrations lists the bots in the member cache and the webhooks of the guild, the webhooks are left out
+// if the bot isn't allowed to see them
+func HandleGetIntegrations(w http.ResponseWriter, r *http.Request) {
+	gId, _ := strconv.ParseInt(pat.Param(r, "guild"), 10, 64)
+
+	result := make([]*Integration, 0)
+	bot.State.IterateMembers(gId, func(chunk []*dstate.MemberState) bool {
+		for _, ms := range chunk {
+			if ms.User.Bot && ms.User.ID != common.BotUser.ID {
+				result = append(result, &Integration{ID: ms.User.ID, Type: IntegrationTypeBot, Name: ms.User.Username})
+			}
+		}
+		return true
+	})
+
+	webhooks, err := common.BotSession.GuildWebhooks(gId)
+	if err != nil && !common.IsDiscordErr(err, discordgo.ErrCodeMissingPermissions, discordgo.ErrCodeMissingAccess) {
+		internalapi.ServerError(w, r, errors.WithMessage(err, "Failed retrieving webhooks"))
+		return
+	}
+
+	for _, wh := range webhooks {
+		result = append(result, &Integration{ID: wh.ID, Type: IntegrationTypeWebhook, Name: wh.Name})
+	}
+
+	internalapi.ServeJson(w, r, result)
+}
+
 func HandlePing(w http.ResponseWriter, r *http.Request) {
 	internalapi.ServeJson(w, r, "pong")
 }
@@ -147,6 +147,10 @@ func HandleGuildCreate(evt *eventsystem.EventData) (retry bool, err error) {
 
 		metricsJoinedGuilds.Inc()
 		commonEventsTotal.With(prometheus.Labels{"type": "Guild Create"}).Inc()
+
+		if !isBanned {
+			go publishGuildMembershipChanged(g.ID, g.OwnerID, true)
+		}
 	}
 
 	// check if the server is banned from using the bot
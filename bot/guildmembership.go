@@ -0,0 +1,28 @@
+package bot
+
+import (
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+)
+
+// EvtGuildMembershipChanged is the pubsub event published when the bot joins or leaves a guild,
+// the web server uses it to refresh its caches so the change shows up on the dashboard right away
+const EvtGuildMembershipChanged = "guild_membership_changed"
+
+// GuildMembershipChangedData is the data of EvtGuildMembershipChanged
+type GuildMembershipChangedData struct {
+	GuildID int64 `json:"guild_id"`
+	OwnerID int64 `json:"owner_id"`
+	Joined  bool  `json:"joined"`
+}
+
+func publishGuildMembershipChanged(guildID, ownerID int64, joined bool) {
+	err := pubsub.Publish(EvtGuildMembershipChanged, guildID, GuildMembershipChangedData{
+		GuildID: guildID,
+		OwnerID: ownerID,
+		Joined:  joined,
+	})
+
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed publishing guild membership change")
+	}
+}
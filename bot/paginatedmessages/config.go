@@ -0,0 +1,54 @@
+package paginatedmessages
+
+import (
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+var configCache = common.CacheSet.RegisterSlot("paginatedmessages_config", func(key interface{}) (interface{}, error) {
+	return GetConfig(key.(int64))
+}, int64(0))
+
+func KeyConfig(guildID int64) string {
+	return "paginatedmessages:" + discordgo.StrID(guildID) + ":config"
+}
+
+// Config is how long command outputs are paginated on a server
+type Config struct {
+	// LinesPerPage is the max number of lines shown on a single page
+	LinesPerPage int `valid:"1,50"`
+
+	// MaxPages is the max number of pages, longer outputs are sent as a file if AttachmentFallback is enabled or cut otherwise
+	MaxPages           int `valid:"1,50"`
+	AttachmentFallback bool
+
+	// HideInSpoilers wraps the output in spoilers, so it doesn't take over the channel
+	HideInSpoilers bool
+}
+
+// GetConfig returns the pagination settings of the guild, or the default ones if they haven't been changed
+func GetConfig(guildID int64) (*Config, error) {
+	conf := &Config{
+		LinesPerPage:       15,
+		MaxPages:           10,
+		AttachmentFallback: true,
+	}
+
+	err := common.GetRedisJson(KeyConfig(guildID), conf)
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed retrieving pagination config")
+	}
+
+	return conf, err
+}
+
+// cachedConfig returns the config of the guild, falling back to the defaults if it couldn't be retrieved
+func cachedConfig(guildID int64) *Config {
+	v, err := configCache.Get(guildID)
+	if err != nil {
+		conf, _ := GetConfig(0)
+		return conf
+	}
+
+	return v.(*Config)
+}
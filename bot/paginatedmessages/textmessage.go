@@ -0,0 +1,87 @@
+package paginatedmessages
+
+import (
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+// max characters of a single page, well below the embed description limit to keep pages readable
+const maxPageChars = 2000
+
+// SendText sends a long text output of a command, split into pages navigated with buttons according to the
+// pagination settings of the guild. If it doesn't fit on the max number of pages it's sent as a file instead,
+// or cut if the guild disabled that.
+func SendText(guildID, channelID int64, title, text string) error {
+	conf := cachedConfig(guildID)
+
+	pages := splitTextPages(text, conf.LinesPerPage, maxPageChars)
+	if len(pages) < 1 {
+		pages = []string{""}
+	}
+
+	if len(pages) > conf.MaxPages {
+		if conf.AttachmentFallback {
+			return sendTextAttachment(channelID, title, text, conf.HideInSpoilers)
+		}
+
+		pages = pages[:conf.MaxPages]
+		pages[len(pages)-1] += "\n\n*Output cut, it was too long*"
+	}
+
+	if conf.HideInSpoilers {
+		for i, v := range pages {
+			pages[i] = spoilerPage(v)
+		}
+	}
+
+	if len(pages) == 1 {
+		_, err := common.BotSession.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{
+			Title:       title,
+			Description: pages[0],
+		})
+		return err
+	}
+
+	_, err := CreatePaginatedMessage(guildID, channelID, 1, len(pages), func(p *PaginatedMessage, page int) (*discordgo.MessageEmbed, error) {
+		if page > len(pages) {
+			return nil, ErrNoResults
+		}
+
+		return &discordgo.MessageEmbed{
+			Title:       title,
+			Description: pages[page-1],
+		}, nil
+	})
+	return err
+}
+
+// spoilerPage wraps the page in spoilers, code blocks are left alone as spoilers don't work across them
+func spoilerPage(page string) string {
+	if strings.Contains(page, "```") {
+		return page
+	}
+
+	// the spoilers already in the page would otherwise close ours
+	return "||" + strings.ReplaceAll(page, "||", "") + "||"
+}
+
+func sendTextAttachment(channelID int64, title, text string, spoiler bool) error {
+	name := "output.txt"
+	if spoiler {
+		// discord hides attachments starting with SPOILER_
+		name = "SPOILER_" + name
+	}
+
+	_, err := common.BotSession.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         "**" + title + "**: the output was too long, so it's attached as a file",
+		AllowedMentions: discordgo.AllowedMentions{},
+		Files: []*discordgo.File{{
+			Name:        name,
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(text),
+		}},
+	})
+	return err
+}
@@ -0,0 +1,100 @@
+package paginatedmessages
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// splitTextPages splits the text into pages of at most linesPerPage lines and maxChars characters,
+// spoilers and code blocks spanning several pages are closed at the end of a page and reopened on the next
+func splitTextPages(text string, linesPerPage, maxChars int) []string {
+	if linesPerPage < 1 {
+		linesPerPage = 1
+	}
+
+	var pages []string
+	var current []string
+	currentLen := 0
+
+	// markup that's open at the start of the current page, carried over from the previous one
+	var openCodeBlock, openSpoiler bool
+	var reopen string
+
+	flush := func() {
+		if len(current) < 1 {
+			return
+		}
+
+		page := reopen + strings.Join(current, "\n")
+
+		closing := ""
+		if openSpoiler {
+			closing += "||"
+		}
+		if openCodeBlock {
+			closing += "\n```"
+		}
+
+		pages = append(pages, page+closing)
+
+		reopen = ""
+		if openCodeBlock {
+			reopen += "```\n"
+		}
+		if openSpoiler {
+			reopen += "||"
+		}
+
+		current = nil
+		currentLen = utf8.RuneCountInString(reopen)
+	}
+
+	// room kept for the markup closing a page
+	const closingRoom = 6
+
+	for _, line := range strings.Split(text, "\n") {
+		for _, part := range splitLongLine(line, maxChars-closingRoom-len(reopen)-1) {
+			partLen := utf8.RuneCountInString(part) + 1
+			if len(current) >= linesPerPage || (len(current) > 0 && currentLen+partLen+closingRoom > maxChars) {
+				flush()
+			}
+
+			current = append(current, part)
+			currentLen += partLen
+
+			if strings.Count(part, "```")%2 == 1 {
+				openCodeBlock = !openCodeBlock
+			}
+
+			if !openCodeBlock && strings.Count(strings.ReplaceAll(part, "```", ""), "||")%2 == 1 {
+				openSpoiler = !openSpoiler
+			}
+		}
+	}
+
+	openSpoiler, openCodeBlock = false, false
+	flush()
+
+	return pages
+}
+
+// splitLongLine splits a line that doesn't fit on a page by itself, preferring to split at spaces
+func splitLongLine(line string, max int) []string {
+	if max < 10 {
+		max = 10
+	}
+
+	var parts []string
+	for utf8.RuneCountInString(line) > max {
+		runes := []rune(line)
+		split := max
+		if i := strings.LastIndex(string(runes[:max]), " "); i > 0 {
+			split = utf8.RuneCountInString(string(runes[:max])[:i])
+		}
+
+		parts = append(parts, string(runes[:split]))
+		line = strings.TrimLeft(string(runes[split:]), " ")
+	}
+
+	return append(parts, line)
+}
@@ -0,0 +1,41 @@
+package paginatedmessages
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitTextPagesLines(t *testing.T) {
+	pages := splitTextPages("1\n2\n3\n4\n5", 2, 2000)
+	expected := []string{"1\n2", "3\n4", "5"}
+	if strings.Join(pages, "|") != strings.Join(expected, "|") {
+		t.Errorf("got %q, expected %q", pages, expected)
+	}
+}
+
+func TestSplitTextPagesMaxChars(t *testing.T) {
+	text := strings.Repeat("word ", 500)
+	for _, page := range splitTextPages(text, 100, 200) {
+		if n := utf8.RuneCountInString(page); n > 200 {
+			t.Errorf("page is %d characters long", n)
+		}
+	}
+}
+
+func TestSplitTextPagesMarkup(t *testing.T) {
+	pages := splitTextPages("||a\nb||\n```\nc\nd\n```", 1, 2000)
+	for i, page := range pages {
+		if strings.Count(page, "```")%2 != 0 {
+			t.Errorf("page %d has a unclosed code block: %q", i, page)
+		}
+
+		if strings.Count(strings.ReplaceAll(page, "```", ""), "||")%2 != 0 {
+			t.Errorf("page %d has a unclosed spoiler: %q", i, page)
+		}
+	}
+
+	if pages[0] != "||a||" || pages[1] != "||b||" {
+		t.Errorf("spoiler not carried over: %q", pages)
+	}
+}
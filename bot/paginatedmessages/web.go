@@ -0,0 +1,73 @@
+package paginatedmessages
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"goji.io"
+	"goji.io/pat"
+)
+
+//go:embed assets/paginatedmessages.html
+var PageHTML string
+
+var panelLogKeyUpdatedSettings = cplogs.RegisterActionFormat(&cplogs.ActionFormat{Key: "pagination_settings_updated", FormatString: "Updated pagination settings"})
+
+type Form struct {
+	Config `valid:"traverse"`
+}
+
+var _ web.SimpleConfigSaver = (*Form)(nil)
+
+func (f Form) Save(guildID int64) error {
+	err := common.SetRedisJson(KeyConfig(guildID), f.Config)
+	if err != nil {
+		return err
+	}
+
+	pubsub.EvictCacheSet(configCache, guildID)
+	return nil
+}
+
+func (f Form) Name() string {
+	return "Pagination"
+}
+
+var _ web.Plugin = (*Plugin)(nil)
+
+func (p *Plugin) InitWeb() {
+	web.AddHTMLTemplate("paginatedmessages/assets/paginatedmessages.html", PageHTML)
+
+	web.AddSidebarItem(web.SidebarCategoryCore, &web.SidebarItem{
+		Name: "Pagination",
+		URL:  "pagination",
+		Icon: "fas fa-book-open",
+	})
+
+	muxer := goji.SubMux()
+
+	web.CPMux.Handle(pat.New("/pagination"), muxer)
+	web.CPMux.Handle(pat.New("/pagination/*"), muxer)
+
+	getHandler := web.RenderHandler(handleGetSettings, "cp_pagination")
+
+	muxer.Handle(pat.Get(""), getHandler)
+	muxer.Handle(pat.Get("/"), getHandler)
+
+	muxer.Handle(pat.Post(""), web.SimpleConfigSaverHandler(Form{}, getHandler, panelLogKeyUpdatedSettings))
+	muxer.Handle(pat.Post("/"), web.SimpleConfigSaverHandler(Form{}, getHandler, panelLogKeyUpdatedSettings))
+}
+
+func handleGetSettings(w http.ResponseWriter, r *http.Request) interface{} {
+	activeGuild, tmpl := web.GetBaseCPContextData(r.Context())
+
+	conf, err := GetConfig(activeGuild.ID)
+	web.CheckErr(tmpl, err, "Failed retrieving the pagination settings", web.CtxLogger(r.Context()).Error)
+	tmpl["PaginationConfig"] = conf
+
+	return tmpl
+}
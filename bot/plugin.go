@@ -75,6 +75,12 @@ func guildRemoved(guildID int64) {
 
 	featureflags.EvictCacheForGuild(guildID)
 
+	var ownerID int64
+	if jg, err := models.FindJoinedGuild(context.Background(), common.PQ, guildID, "id", "owner_id"); err == nil {
+		ownerID = jg.OwnerID
+	}
+	publishGuildMembershipChanged(guildID, ownerID, false)
+
 	for _, v := range common.Plugins {
 		if remover, ok := v.(RemoveGuildHandler); ok {
 			err := remover.RemoveGuild(guildID)
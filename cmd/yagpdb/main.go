@@ -4,6 +4,7 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/analytics"
 	"github.com/botlabs-gg/yagpdb/v2/antiphishing"
 	"github.com/botlabs-gg/yagpdb/v2/common/featureflags"
+	"github.com/botlabs-gg/yagpdb/v2/common/ignorelist"
 	"github.com/botlabs-gg/yagpdb/v2/common/prom"
 	"github.com/botlabs-gg/yagpdb/v2/common/run"
 	"github.com/botlabs-gg/yagpdb/v2/web/discorddata"
@@ -14,6 +15,7 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/bot/paginatedmessages"
 	"github.com/botlabs-gg/yagpdb/v2/common/internalapi"
 	"github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2"
+	"github.com/botlabs-gg/yagpdb/v2/common/secrets"
 
 	// Plugin imports
 	"github.com/botlabs-gg/yagpdb/v2/automod"
@@ -24,11 +26,14 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/commands"
 	"github.com/botlabs-gg/yagpdb/v2/customcommands"
 	"github.com/botlabs-gg/yagpdb/v2/discordlogger"
+	"github.com/botlabs-gg/yagpdb/v2/linkedaccounts"
 	"github.com/botlabs-gg/yagpdb/v2/logs"
+	"github.com/botlabs-gg/yagpdb/v2/mobileapp"
 	"github.com/botlabs-gg/yagpdb/v2/moderation"
 	"github.com/botlabs-gg/yagpdb/v2/notifications"
 	"github.com/botlabs-gg/yagpdb/v2/premium"
 	"github.com/botlabs-gg/yagpdb/v2/premium/patreonpremiumsource"
+	"github.com/botlabs-gg/yagpdb/v2/publicapi"
 	"github.com/botlabs-gg/yagpdb/v2/reddit"
 	"github.com/botlabs-gg/yagpdb/v2/reminders"
 	"github.com/botlabs-gg/yagpdb/v2/reputation"
@@ -86,11 +91,16 @@ func main() {
 	scheduledevents2.RegisterPlugin()
 	twitter.RegisterPlugin()
 	rsvp.RegisterPlugin()
+	linkedaccounts.RegisterPlugin()
 	timezonecompanion.RegisterPlugin()
 	admin.RegisterPlugin()
 	internalapi.RegisterPlugin()
 	prom.RegisterPlugin()
 	featureflags.RegisterPlugin()
+	secrets.RegisterPlugin()
+	ignorelist.RegisterPlugin()
+	mobileapp.RegisterPlugin()
+	publicapi.RegisterPlugin()
 
 	run.Run()
 }
@@ -180,7 +180,7 @@ func HandleCommands(w http.ResponseWriter, r *http.Request) (web.TemplateData, e
 
 	templateData["CommandPrefix"] = prefix
 
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(activeGuild.ID) + "/commands/settings"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(activeGuild.ID) + "/commands/settings")
 
 	return templateData, nil
 }
@@ -0,0 +1,96 @@
+// Package apiusage keeps hourly counters of a guild's api requests and webhook deliveries,
+// so admins can see what's eating their ratelimits.
+package apiusage
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const (
+	KindAPI     = "api"
+	KindWebhook = "webhook"
+)
+
+const (
+	OutcomeOK          = "ok"
+	OutcomeError       = "error"
+	OutcomeRatelimited = "ratelimited"
+)
+
+// Retention is how long the hourly buckets are kept for
+const Retention = time.Hour * 24 * 7
+
+func keyBucket(guildID int64, t time.Time) string {
+	return "api_usage:" + strconv.FormatInt(guildID, 10) + ":" + strconv.FormatInt(t.Truncate(time.Hour).Unix(), 10)
+}
+
+// Record increments the counter for the kind and outcome in the current hour
+func Record(guildID int64, kind, outcome string) error {
+	key := keyBucket(guildID, time.Now())
+	return common.RedisPool.Do(radix.Pipeline(
+		radix.Cmd(nil, "HINCRBY", key, kind+":"+outcome, "1"),
+		radix.Cmd(nil, "EXPIRE", key, strconv.Itoa(int(Retention.Seconds()))),
+	))
+}
+
+// OutcomeFromStatus maps a http status code to a outcome
+func OutcomeFromStatus(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return OutcomeRatelimited
+	case status >= 400:
+		return OutcomeError
+	default:
+		return OutcomeOK
+	}
+}
+
+// Bucket is the usage within a single hour
+type Bucket struct {
+	Start  time.Time
+	Counts map[string]int64
+}
+
+// Count returns the number of requests of kind that had the outcome
+func (b *Bucket) Count(kind, outcome string) int64 {
+	return b.Counts[kind+":"+outcome]
+}
+
+// Total returns the number of requests of kind regardless of outcome
+func (b *Bucket) Total(kind string) int64 {
+	return b.Count(kind, OutcomeOK) + b.Count(kind, OutcomeError) + b.Count(kind, OutcomeRatelimited)
+}
+
+// GetUsage returns the hourly usage buckets for the last n hours, oldest first
+func GetUsage(guildID int64, hours int) ([]*Bucket, error) {
+	now := time.Now().Truncate(time.Hour)
+
+	buckets := make([]*Bucket, hours)
+	raw := make([]map[string]string, hours)
+	cmds := make([]radix.CmdAction, hours)
+
+	for i := 0; i < hours; i++ {
+		start := now.Add(-time.Hour * time.Duration(hours-1-i))
+		buckets[i] = &Bucket{Start: start, Counts: make(map[string]int64)}
+		cmds[i] = radix.Cmd(&raw[i], "HGETALL", keyBucket(guildID, start))
+	}
+
+	err := common.RedisPool.Do(radix.Pipeline(cmds...))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, fields := range raw {
+		for k, v := range fields {
+			parsed, _ := strconv.ParseInt(v, 10, 64)
+			buckets[i].Counts[k] = parsed
+		}
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,73 @@
+package apiusage
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestOutcomeFromStatus(t *testing.T) {
+	cases := map[int]string{
+		http.StatusOK:                  OutcomeOK,
+		http.StatusNoContent:           OutcomeOK,
+		http.StatusFound:               OutcomeOK,
+		http.StatusBadRequest:          OutcomeError,
+		http.StatusInternalServerError: OutcomeError,
+		http.StatusTooManyRequests:     OutcomeRatelimited,
+	}
+
+	for status, expected := range cases {
+		if got := OutcomeFromStatus(status); got != expected {
+			t.Errorf("%d: got %s, expected %s", status, got, expected)
+		}
+	}
+}
+
+func TestBucketTotals(t *testing.T) {
+	b := &Bucket{Counts: map[string]int64{
+		"api:ok":              3,
+		"api:error":           1,
+		"api:ratelimited":     2,
+		"webhook:ratelimited": 5,
+	}}
+
+	if b.Total(KindAPI) != 6 || b.Total(KindWebhook) != 5 || b.Count(KindWebhook, OutcomeOK) != 0 {
+		t.Errorf("unexpected totals %d, %d", b.Total(KindAPI), b.Total(KindWebhook))
+	}
+}
+
+func TestKeyBucket(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC)
+	if keyBucket(1, start) != keyBucket(1, start.Add(time.Minute*59)) || keyBucket(1, start) == keyBucket(1, start.Add(time.Hour)) {
+		t.Error("expected one bucket per hour")
+	}
+
+	if keyBucket(1, start) == keyBucket(2, start) {
+		t.Error("expected the guilds to have separate buckets")
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	const guildID = 1007
+	common.RedisPool.Do(radix.Cmd(nil, "DEL", keyBucket(guildID, time.Now())))
+
+	Record(guildID, KindAPI, OutcomeOK)
+	Record(guildID, KindAPI, OutcomeOK)
+	Record(guildID, KindWebhook, OutcomeRatelimited)
+
+	buckets, err := GetUsage(guildID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buckets) != 2 || buckets[1].Count(KindAPI, OutcomeOK) != 2 || buckets[1].Total(KindWebhook) != 1 {
+		t.Errorf("unexpected usage %v %v", buckets[0], buckets[1])
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/lifecycle"
 	"goji.io"
 )
 
@@ -22,6 +23,8 @@ type BackgroundWorkerPlugin interface {
 	StopBackgroundWorker(wg *sync.WaitGroup)
 }
 
+// RunWorkers registers the background workers of the plugins and the http server with the lifecycle manager, which
+// starts them in that order and stops them in the reverse order on shutdown
 func RunWorkers() {
 	common.ServiceTracker.RegisterService(common.ServiceTypeBGWorker, "Background worker", "", nil)
 
@@ -29,39 +32,50 @@ func RunWorkers() {
 
 	for _, p := range common.Plugins {
 		if bwc, ok := p.(BackgroundWorkerPlugin); ok {
-			logger.Info("Running background worker: ", p.PluginInfo().Name)
-			go bwc.RunBackgroundWorker()
+			lifecycle.Register(workerHook(p, bwc))
 		}
 	}
 
-	go runWebserver()
+	lifecycle.Register(&lifecycle.Hook{
+		Name: "bgworker.http_server",
+		Start: func(context.Context) error {
+			restServer = &http.Server{
+				Handler: RESTServerMuxer,
+				Addr:    HTTPAddr.GetString(),
+			}
+			go runWebserver()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			logger.Info("Shutting down http server...")
+			return restServer.Shutdown(ctx)
+		},
+	})
 }
 
-func StopWorkers(wg *sync.WaitGroup) {
-	logger.Info("Shutting down http server...")
-	if restServer != nil {
-		restServer.Shutdown(context.Background())
-	}
-
-	for _, p := range common.Plugins {
-		if bwc, ok := p.(BackgroundWorkerPlugin); ok {
+func workerHook(p common.Plugin, bwc BackgroundWorkerPlugin) *lifecycle.Hook {
+	return &lifecycle.Hook{
+		Name: "bgworker." + p.PluginInfo().SysName,
+		Start: func(context.Context) error {
+			logger.Info("Running background worker: ", p.PluginInfo().Name)
+			go bwc.RunBackgroundWorker()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
 			logger.Info("Stopping background worker: ", p.PluginInfo().Name)
+			wg := new(sync.WaitGroup)
 			wg.Add(1)
 			go bwc.StopBackgroundWorker(wg)
-		}
+			return lifecycle.Wait(ctx, wg)
+		},
 	}
 }
 
 func runWebserver() {
 	logger.Info("Starting bgworker http server on ", HTTPAddr)
 
-	restServer := &http.Server{
-		Handler: RESTServerMuxer,
-		Addr:    HTTPAddr.GetString(),
-	}
-
 	err := restServer.ListenAndServe()
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		logger.WithError(err).Error("Failed starting http server")
 	}
 }
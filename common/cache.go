@@ -4,10 +4,12 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"strconv"
 
+	"github.com/botlabs-gg/yagpdb/v2/common/tracing"
 	"github.com/karlseguin/ccache"
 	"github.com/mediocregopher/radix/v3"
 )
@@ -21,16 +23,43 @@ var (
 
 // Items in the cache expire after 1 min
 func GetCacheData(key string) (data []byte, err error) {
+	return GetCacheDataContext(context.Background(), key)
+}
+
+// GetCacheDataContext is like GetCacheData but records a span for the lookup in the trace in ctx
+func GetCacheDataContext(ctx context.Context, key string) (data []byte, err error) {
+	_, span := startCacheSpan(ctx, "GET", key)
+	defer span.End()
+
 	err = RedisPool.Do(radix.Cmd(&data, "GET", CacheKeyPrefix+key))
+	span.SetError(err)
+	span.SetAttribute("cache.hit", len(data) > 0)
 	return
 }
 
 // Stores an entry in the cache and sets it to expire after expire
 func SetCacheData(key string, expire int, data []byte) error {
+	return SetCacheDataContext(context.Background(), key, expire, data)
+}
+
+// SetCacheDataContext is like SetCacheData but records a span for the write in the trace in ctx
+func SetCacheDataContext(ctx context.Context, key string, expire int, data []byte) error {
+	_, span := startCacheSpan(ctx, "SET", key)
+	defer span.End()
+
 	err := RedisPool.Do(radix.Cmd(nil, "SET", CacheKeyPrefix+key, string(data), "EX", strconv.Itoa(expire)))
+	span.SetError(err)
 	return err
 }
 
+func startCacheSpan(ctx context.Context, cmd, key string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartSpan(ctx, "redis "+cmd, tracing.KindClient)
+	span.SetAttribute("db.system", "redis")
+	span.SetAttribute("db.operation", cmd)
+	span.SetAttribute("cache.key", CacheKeyPrefix+key)
+	return ctx, span
+}
+
 // Stores an entry in the cache and sets it to expire after a minute
 func SetCacheDataSimple(key string, data []byte) error {
 	return SetCacheData(key, 60, data)
@@ -38,12 +67,16 @@ func SetCacheDataSimple(key string, data []byte) error {
 
 // Helper methods
 func SetCacheDataJson(key string, expire int, data interface{}) error {
+	return SetCacheDataJsonContext(context.Background(), key, expire, data)
+}
+
+func SetCacheDataJsonContext(ctx context.Context, key string, expire int, data interface{}) error {
 	encoded, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	return SetCacheData(key, expire, encoded)
+	return SetCacheDataContext(ctx, key, expire, encoded)
 }
 
 func SetCacheDataJsonSimple(key string, data interface{}) error {
@@ -51,7 +84,11 @@ func SetCacheDataJsonSimple(key string, data interface{}) error {
 }
 
 func GetCacheDataJson(key string, dest interface{}) error {
-	data, err := GetCacheData(key)
+	return GetCacheDataJsonContext(context.Background(), key, dest)
+}
+
+func GetCacheDataJsonContext(ctx context.Context, key string, dest interface{}) error {
+	data, err := GetCacheDataContext(ctx, key)
 	if err != nil {
 		return err
 	}
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/botlabs-gg/yagpdb/v2/common/cacheset"
+	"github.com/botlabs-gg/yagpdb/v2/common/storage"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
@@ -38,6 +39,9 @@ var (
 	RedisPool *radix.Pool
 	CacheSet  = cacheset.NewManager(time.Hour)
 
+	// Storage is the storage driver, backed by RedisPool unless YAGPDB_STORAGE is set to "memory"
+	Storage storage.Driver
+
 	BotSession     *discordgo.Session
 	BotUser        *discordgo.User
 	BotApplication *discordgo.Application
@@ -65,7 +69,7 @@ func CoreInit(loadConfig bool) error {
 	stdlog.SetFlags(0)
 
 	if Testing {
-		logrus.SetLevel(logrus.DebugLevel)
+		SetLoggingLevel(logrus.DebugLevel)
 	}
 
 	err := connectRedis(false)
@@ -250,9 +254,24 @@ func connectRedis(unitTests bool) (err error) {
 	}
 
 	RedisPool, err = radix.NewPool("tcp", RedisAddr, maxConns, opts...)
+	if err != nil {
+		return
+	}
+
+	Storage = newStorageDriver()
 	return
 }
 
+func newStorageDriver() storage.Driver {
+	switch os.Getenv("YAGPDB_STORAGE") {
+	case "memory":
+		logger.Info("Using in-memory storage driver, nothing will be persisted")
+		return storage.NewMemory()
+	default:
+		return storage.NewRedis(RedisPool)
+	}
+}
+
 // InitTestRedis sets common.RedisPool to a redis pool for unit testing
 func InitTestRedis() error {
 	if RedisPool != nil {
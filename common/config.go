@@ -17,6 +17,7 @@ var (
 	ConfBotToken     = config.RegisterOption("yagpdb.bottoken", "Token of the bot user", nil)
 	ConfHost         = config.RegisterOption("yagpdb.host", "Host without the protocol, example: example.com, used by the webserver", nil)
 	ConfEmail        = config.RegisterOption("yagpdb.email", "Email used when fetching lets encrypt certificate", "")
+	ConfSessionTTL   = config.RegisterOption("yagpdb.web.session_ttl", "How many hours a control panel session lasts without activity, activity extends it", 24*30)
 
 	ConfPQHost     = config.RegisterOption("yagpdb.pqhost", "Postgres host", "localhost")
 	ConfPQUsername = config.RegisterOption("yagpdb.pqusername", "Postgres user", "postgres")
@@ -22,4 +22,19 @@ const (
 	ContextKeyMemberPermissions
 	ContextKeyIsAdmin
 	ContextKeyIsReadOnly
+	ContextKeyAPIKey
+	ContextKeyIsSuperadmin
+	ContextKeyApplication
+	ContextKeyCSPNonce
+	ContextKeyCaptchaResult
+	ContextKeyCPLogRequest
+	ContextKeyIsSupportView
+	ContextKeyShareLink
+	ContextKeyGuildToken
+	ContextKeyRequestID
+	ContextKeyClientIP
+	ContextKeyAccessLogEntry
+	ContextKeyApprovedChange
+	ContextKeyRequestClass
+	ContextKeyLanguage
 )
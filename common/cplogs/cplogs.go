@@ -4,9 +4,21 @@ import (
 	"time"
 
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
 	"github.com/sirupsen/logrus"
 )
 
+// EvtEntryAdded is the pubsub event published when a entry was added, so the open control panels of the guild can
+// tell their users someone else changed something
+const EvtEntryAdded = "cplogs_entry_added"
+
+// EntryAddedData is the data of EvtEntryAdded
+type EntryAddedData struct {
+	AuthorID       int64  `json:"author_id"`
+	AuthorUsername string `json:"author_username"`
+	Action         string `json:"action"`
+}
+
 type ActionFormat struct {
 	Key          string
 	FormatString string
@@ -35,11 +47,20 @@ func AddEntry(entry *LogEntry) error {
 	rawEntry.LocalID = localID
 
 	const insertStatement = `INSERT INTO panel_logs
-	(guild_id, local_id, author_id, author_username, action, param1_type, param1_int, param1_string, param2_type, param2_int, param2_string, created_at)
-	VALUES (:guild_id, :local_id, :author_id, :author_username, :action, :param1_type, :param1_int, :param1_string, :param2_type, :param2_int, :param2_string, :created_at);`
+	(guild_id, local_id, author_id, author_username, action, param1_type, param1_int, param1_string, param2_type, param2_int, param2_string, created_at, ip, user_agent, route)
+	VALUES (:guild_id, :local_id, :author_id, :author_username, :action, :param1_type, :param1_int, :param1_string, :param2_type, :param2_int, :param2_string, :created_at, :ip, :user_agent, :route);`
 
 	_, err = common.SQLX.NamedExec(insertStatement, rawEntry)
-	return err
+	if err != nil {
+		return err
+	}
+
+	pubsub.PublishLogErr(EvtEntryAdded, entry.GuildID, &EntryAddedData{
+		AuthorID:       entry.AuthorID,
+		AuthorUsername: entry.AuthorUsername,
+		Action:         rawEntry.toLogEntry().Action.String(),
+	})
+	return nil
 }
 
 // RetryAddEntry will etry AddEntry until it suceeds or 60 seconds has elapsed
@@ -82,3 +103,41 @@ func GetEntries(guildID int64, limit int, before int64) ([]*LogEntry, error) {
 
 	return parsedResult, nil
 }
+
+// GetEntriesPage returns the entries of a page of the logs, newest first
+func GetEntriesPage(guildID int64, limit, offset int) ([]*LogEntry, error) {
+	result := []rawLogEntry{}
+	err := common.SQLX.Select(&result, "SELECT * FROM panel_logs WHERE guild_id=$1 ORDER BY local_id DESC LIMIT $2 OFFSET $3", guildID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedResult := make([]*LogEntry, 0, len(result))
+	for _, v := range result {
+		parsedResult = append(parsedResult, v.toLogEntry())
+	}
+
+	return parsedResult, nil
+}
+
+// CountEntries returns the amount of entries of the guild
+func CountEntries(guildID int64) (int, error) {
+	var count int
+	err := common.SQLX.Get(&count, "SELECT count(*) FROM panel_logs WHERE guild_id=$1", guildID)
+	return count, err
+}
+
+// AuthorCount is the amount of entries made by a single author
+type AuthorCount struct {
+	AuthorID       int64  `db:"author_id"`
+	AuthorUsername string `db:"author_username"`
+	Count          int    `db:"count"`
+}
+
+// CountEntriesByAuthor returns how many entries each author made within the range, most active first
+func CountEntriesByAuthor(guildID int64, from, to time.Time) ([]*AuthorCount, error) {
+	result := []*AuthorCount{}
+	err := common.SQLX.Select(&result, `SELECT author_id, max(author_username) AS author_username, count(*) AS count FROM panel_logs
+WHERE guild_id=$1 AND created_at >= $2 AND created_at < $3 GROUP BY author_id ORDER BY count DESC`, guildID, from, to)
+	return result, err
+}
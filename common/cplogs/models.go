@@ -31,8 +31,17 @@ CREATE TABLE IF NOT EXISTS panel_logs (
 )
 `
 
+// DBSchemaRequestInfo adds where the changes were made from, to tell apart a compromised account from the real user
+var DBSchemaRequestInfo = []string{`
+ALTER TABLE panel_logs ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+`, `
+ALTER TABLE panel_logs ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+`, `
+ALTER TABLE panel_logs ADD COLUMN IF NOT EXISTS route TEXT NOT NULL DEFAULT '';
+`}
+
 func init() {
-	common.RegisterDBSchemas("cplogs", DBSchema)
+	common.RegisterDBSchemas("cplogs", append([]string{DBSchema}, DBSchemaRequestInfo...)...)
 }
 
 type rawLogEntry struct {
@@ -53,6 +62,10 @@ type rawLogEntry struct {
 	Param2String string `db:"param2_string"`
 
 	CreatedAt time.Time `db:"created_at"`
+
+	IP        string `db:"ip"`
+	UserAgent string `db:"user_agent"`
+	Route     string `db:"route"`
 }
 
 func (r *rawLogEntry) toLogEntry() *LogEntry {
@@ -78,6 +91,12 @@ func (r *rawLogEntry) toLogEntry() *LogEntry {
 		},
 
 		CreatedAt: r.CreatedAt,
+
+		Request: RequestInfo{
+			IP:        r.IP,
+			UserAgent: r.UserAgent,
+			Route:     r.Route,
+		},
 	}
 
 	if format.Found {
@@ -118,6 +137,18 @@ type LogEntry struct {
 	Action *LogAction
 
 	CreatedAt time.Time
+
+	// Request is empty for entries created before it was tracked
+	Request RequestInfo
+}
+
+// RequestInfo is where a change was made from
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+
+	// Route is the method and path of the request, e.g "POST /manage/1/core"
+	Route string
 }
 
 func (l *LogEntry) toRawLogEntry() *rawLogEntry {
@@ -130,6 +161,10 @@ func (l *LogEntry) toRawLogEntry() *rawLogEntry {
 
 		Action:    l.Action.Key,
 		CreatedAt: l.CreatedAt,
+
+		IP:        l.Request.IP,
+		UserAgent: l.Request.UserAgent,
+		Route:     l.Request.Route,
 	}
 
 	if len(l.Action.Params) > 0 {
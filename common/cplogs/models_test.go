@@ -0,0 +1,18 @@
+package cplogs
+
+import "testing"
+
+func TestLogEntryRequestInfo(t *testing.T) {
+	entry := NewEntry(1, 2, "user", "unknown_action")
+	entry.Request = RequestInfo{IP: "192.0.2.1", UserAgent: "agent", Route: "POST /manage/1/core"}
+
+	// stored and read back from the database
+	if got := entry.toRawLogEntry().toLogEntry(); got.Request != entry.Request {
+		t.Errorf("expected the request info to be kept, got %#v", got.Request)
+	}
+
+	// entries from before the request info was stored
+	if got := NewEntry(1, 2, "user", "unknown_action").toRawLogEntry().toLogEntry(); got.Request != (RequestInfo{}) {
+		t.Errorf("expected empty request info, got %#v", got.Request)
+	}
+}
@@ -0,0 +1,124 @@
+// Package geoip looks up the country and network (ASN) of ips in MaxMind databases, e.g the free GeoLite2 ones,
+// using github.com/oschwald/maxminddb-golang.
+//
+// It's optional, lookups return nil unless yagpdb.geoip.country_db or yagpdb.geoip.asn_db point to a database.
+package geoip
+
+import (
+	"net"
+	"sync"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	confCountryDB = config.RegisterOption("yagpdb.geoip.country_db", "Path to a MaxMind country or city database (e.g GeoLite2-Country.mmdb) to annotate requests with the country, empty to disable", "")
+	confASNDB     = config.RegisterOption("yagpdb.geoip.asn_db", "Path to a MaxMind ASN database (e.g GeoLite2-ASN.mmdb) to annotate requests with the network, empty to disable", "")
+)
+
+var logger = logrus.WithField("p", "geoip")
+
+// Location is what's known about where a ip is from
+type Location struct {
+	// ISO 3166-1 country code, e.g "US"
+	Country string `json:"country,omitempty"`
+
+	// Autonomous system number and the name of the organization behind it, e.g 15169 "GOOGLE"
+	ASN   uint   `json:"asn,omitempty"`
+	ASOrg string `json:"as_org,omitempty"`
+}
+
+var (
+	loadOnce      sync.Once
+	countryReader *maxminddb.Reader
+	asnReader     *maxminddb.Reader
+)
+
+func load() {
+	countryReader = openDB(confCountryDB.GetString())
+	asnReader = openDB(confASNDB.GetString())
+}
+
+func openDB(path string) *maxminddb.Reader {
+	if path == "" {
+		return nil
+	}
+
+	r, err := maxminddb.Open(path)
+	if err != nil {
+		logger.WithError(err).WithField("path", path).Error("failed loading geoip database")
+		return nil
+	}
+
+	logger.Infof("Loaded geoip database %s (%s)", path, r.Metadata.DatabaseType)
+	return r
+}
+
+// Enabled returns true if atleast one of the databases is loaded
+func Enabled() bool {
+	loadOnce.Do(load)
+	return countryReader != nil || asnReader != nil
+}
+
+// Lookup returns the location of the ip, nil if it's invalid, not in the databases or geoip is disabled
+func Lookup(ip string) *Location {
+	if !Enabled() {
+		return nil
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+
+	return lookup(countryReader, asnReader, parsed)
+}
+
+// the fields of the country, city and asn database records that are used
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+
+	// used for ips that aren't geolocated themselves, e.g anycast
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+type asnRecord struct {
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+func lookup(country, asn *maxminddb.Reader, ip net.IP) *Location {
+	loc := &Location{}
+	if country != nil {
+		var record countryRecord
+		if err := country.Lookup(ip, &record); err != nil {
+			logger.WithError(err).Error("failed looking up country")
+		}
+
+		loc.Country = record.Country.ISOCode
+		if loc.Country == "" {
+			loc.Country = record.RegisteredCountry.ISOCode
+		}
+	}
+
+	if asn != nil {
+		var record asnRecord
+		if err := asn.Lookup(ip, &record); err != nil {
+			logger.WithError(err).Error("failed looking up asn")
+		}
+
+		loc.ASN, loc.ASOrg = record.ASN, record.ASOrg
+	}
+
+	if *loc == (Location{}) {
+		return nil
+	}
+
+	return loc
+}
@@ -0,0 +1,182 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// The parts of the MaxMind DB format needed to build the test databases, see https://maxmind.github.io/MaxMind-DB/
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	mmdbTypePointer = 1
+	mmdbTypeString  = 2
+	mmdbTypeUint16  = 5
+	mmdbTypeUint32  = 6
+	mmdbTypeMap     = 7
+
+	// the size of the zeroed separator between the search tree and the data section
+	mmdbDataSectionSeparator = 16
+)
+
+// small encoder for the data section types used in the test databases
+func mmdbCtrl(typ, size int) []byte {
+	return []byte{byte(typ<<5 | size)}
+}
+
+func mmdbString(s string) []byte {
+	if len(s) >= 29 {
+		return append([]byte{byte(mmdbTypeString<<5 | 29), byte(len(s) - 29)}, s...)
+	}
+	return append(mmdbCtrl(mmdbTypeString, len(s)), s...)
+}
+
+func mmdbUint(typ int, v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	if typ == mmdbTypeUint16 {
+		b = b[2:]
+	}
+	return append(mmdbCtrl(typ, len(b)), b...)
+}
+
+func mmdbMap(kv ...[]byte) []byte {
+	out := mmdbCtrl(mmdbTypeMap, len(kv)/2)
+	for _, v := range kv {
+		out = append(out, v...)
+	}
+	return out
+}
+
+func mmdbPointer(p int) []byte {
+	return []byte{byte(mmdbTypePointer<<5 | (p>>8)&0x7), byte(p)}
+}
+
+func putRecord(node []byte, recordSize int, bit int, v uint) {
+	switch recordSize {
+	case 24:
+		b := node[bit*3:]
+		b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+	case 28:
+		if bit == 0 {
+			node[0], node[1], node[2] = byte(v>>16), byte(v>>8), byte(v)
+			node[3] = node[3]&0x0F | byte(v>>20)&0xF0
+		} else {
+			node[4], node[5], node[6] = byte(v>>16), byte(v>>8), byte(v)
+			node[3] = node[3]&0xF0 | byte(v>>24)&0x0F
+		}
+	default:
+		binary.BigEndian.PutUint32(node[bit*4:], uint32(v))
+	}
+}
+
+// buildTestDB creates a database where only the prefix has a record
+func buildTestDB(recordSize, ipVersion int, prefix net.IP, prefixLen int, data []byte, dataOffset int) []byte {
+	if ip4 := prefix.To4(); ip4 != nil {
+		prefix = ip4
+		if ipVersion == 6 {
+			prefix = append(make(net.IP, 12), ip4...)
+			prefixLen += 96
+		}
+	}
+
+	nodeCount := prefixLen
+	nodeSize := recordSize * 2 / 8
+	tree := make([]byte, nodeCount*nodeSize)
+	for i := 0; i < prefixLen; i++ {
+		bit := int(prefix[i/8]>>(7-i%8)) & 1
+		node := tree[i*nodeSize : (i+1)*nodeSize]
+
+		next := uint(i + 1)
+		if i == prefixLen-1 {
+			next = uint(nodeCount + mmdbDataSectionSeparator + dataOffset)
+		}
+
+		putRecord(node, recordSize, bit, next)
+		putRecord(node, recordSize, 1-bit, uint(nodeCount))
+	}
+
+	out := append(tree, make([]byte, mmdbDataSectionSeparator)...)
+	out = append(out, data...)
+	out = append(out, metadataStartMarker...)
+	out = append(out, mmdbMap(
+		mmdbString("node_count"), mmdbUint(mmdbTypeUint32, uint32(nodeCount)),
+		mmdbString("record_size"), mmdbUint(mmdbTypeUint16, uint32(recordSize)),
+		mmdbString("ip_version"), mmdbUint(mmdbTypeUint16, uint32(ipVersion)),
+		mmdbString("database_type"), mmdbString("Test-Country"),
+	)...)
+
+	return out
+}
+
+func TestLookup(t *testing.T) {
+	// the iso code is stored once and pointed to, like the real databases deduplicate values
+	data := mmdbString("SE")
+	recordOffset := len(data)
+	data = append(data, mmdbMap(
+		mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbPointer(0)),
+	)...)
+
+	asnData := mmdbMap(
+		mmdbString("autonomous_system_number"), mmdbUint(mmdbTypeUint32, 15169),
+		mmdbString("autonomous_system_organization"), mmdbString("GOOGLE"),
+	)
+	asn, err := maxminddb.FromBytes(buildTestDB(24, 6, net.ParseIP("81.0.0.0"), 8, asnData, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, ipVersion := range []int{4, 6} {
+			country, err := maxminddb.FromBytes(buildTestDB(recordSize, ipVersion, net.ParseIP("81.0.0.0"), 8, data, recordOffset))
+			if err != nil {
+				t.Fatalf("size %d, v%d: failed loading: %v", recordSize, ipVersion, err)
+			}
+
+			loc := lookup(country, asn, net.ParseIP("81.2.3.4"))
+			if loc == nil || *loc != (Location{Country: "SE", ASN: 15169, ASOrg: "GOOGLE"}) {
+				t.Errorf("size %d, v%d: unexpected location %#v", recordSize, ipVersion, loc)
+			}
+
+			if loc := lookup(country, nil, net.ParseIP("81.2.3.4")); loc == nil || *loc != (Location{Country: "SE"}) {
+				t.Errorf("size %d, v%d: unexpected location without the asn database %#v", recordSize, ipVersion, loc)
+			}
+
+			for _, ip := range []string{"82.2.3.4", "10.0.0.1", "2001:db8::1"} {
+				if loc := lookup(country, asn, net.ParseIP(ip)); loc != nil {
+					t.Errorf("size %d, v%d: expected no location for %s, got %#v", recordSize, ipVersion, ip, loc)
+				}
+			}
+		}
+	}
+}
+
+func TestLookupRegisteredCountry(t *testing.T) {
+	data := mmdbMap(mmdbString("registered_country"), mmdbMap(mmdbString("iso_code"), mmdbString("US")))
+	country, err := maxminddb.FromBytes(buildTestDB(24, 4, net.ParseIP("8.8.8.0"), 24, data, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loc := lookup(country, nil, net.ParseIP("8.8.8.8")); loc == nil || loc.Country != "US" {
+		t.Errorf("expected the registered country, got %#v", loc)
+	}
+}
+
+func TestOpenDBInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.mmdb")
+	if err := ioutil.WriteFile(path, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"", path, filepath.Join(t.TempDir(), "missing.mmdb")} {
+		if r := openDB(p); r != nil {
+			t.Errorf("expected no reader for %q", p)
+		}
+	}
+}
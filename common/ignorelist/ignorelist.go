@@ -0,0 +1,135 @@
+// Package ignorelist holds the bots and webhooks a guild wants ignored, shared by the plugins reacting to messages
+// so they're configured in a single place
+package ignorelist
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+)
+
+// The kinds of sources that can be ignored, messages from webhooks have the id of the webhook as author
+const (
+	SourceBot     = "bot"
+	SourceWebhook = "webhook"
+)
+
+// The features an entry can be ignored by
+const (
+	FeatureLogs       = "logs"
+	FeatureReputation = "reputation"
+	FeatureAutomod    = "automod"
+)
+
+// MaxEntries is the max amount of bots and webhooks a guild can ignore
+const MaxEntries = 50
+
+// Entry is a ignored bot or webhook
+type Entry struct {
+	SourceID   int64  `json:"source_id,string"`
+	SourceType string `json:"source_type"`
+
+	// Name is what it was called when added, shown in the control panel
+	Name string `json:"name"`
+
+	Logs       bool `json:"logs"`
+	Reputation bool `json:"reputation"`
+	Automod    bool `json:"automod"`
+}
+
+// IgnoredBy returns true if the feature ignores this entry
+func (e *Entry) IgnoredBy(feature string) bool {
+	switch feature {
+	case FeatureLogs:
+		return e.Logs
+	case FeatureReputation:
+		return e.Reputation
+	case FeatureAutomod:
+		return e.Automod
+	}
+
+	return false
+}
+
+var entriesCache = common.CacheSet.RegisterSlot("ignore_list_entries", func(key interface{}) (interface{}, error) {
+	return GetEntries(context.Background(), key.(int64))
+}, int64(0))
+
+// GetEntries returns the ignored bots and webhooks of the guild
+func GetEntries(ctx context.Context, guildID int64) ([]*Entry, error) {
+	const query = `SELECT source_id, source_type, name, ignore_logs, ignore_reputation, ignore_automod FROM ignore_list_entries
+WHERE guild_id = $1 ORDER BY name;`
+
+	rows, err := common.PQ.QueryContext(ctx, query, guildID)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+	defer rows.Close()
+
+	var result []*Entry
+	for rows.Next() {
+		e := &Entry{}
+		err = rows.Scan(&e.SourceID, &e.SourceType, &e.Name, &e.Logs, &e.Reputation, &e.Automod)
+		if err != nil {
+			return nil, errors.WithStackIf(err)
+		}
+
+		result = append(result, e)
+	}
+
+	return result, errors.WithStackIf(rows.Err())
+}
+
+// SetEntries replaces the ignored bots and webhooks of the guild
+func SetEntries(ctx context.Context, guildID int64, entries []*Entry) error {
+	tx, err := common.PQ.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM ignore_list_entries WHERE guild_id = $1;", guildID)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	const insert = `INSERT INTO ignore_list_entries (guild_id, source_id, source_type, name, ignore_logs, ignore_reputation, ignore_automod)
+VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (guild_id, source_id) DO NOTHING;`
+	for _, e := range entries {
+		_, err = tx.ExecContext(ctx, insert, guildID, e.SourceID, e.SourceType, e.Name, e.Logs, e.Reputation, e.Automod)
+		if err != nil {
+			return errors.WithStackIf(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	pubsub.EvictCacheSet(entriesCache, guildID)
+	return nil
+}
+
+// IsIgnored returns true if the feature should ignore messages by the author in the guild, authorID is the webhook
+// id for webhook messages. Failing to retrieve the list is logged and treated as not ignored.
+func IsIgnored(guildID, authorID int64, feature string) bool {
+	v, err := entriesCache.Get(guildID)
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed retrieving ignore list")
+		return false
+	}
+
+	return isIgnored(v.([]*Entry), authorID, feature)
+}
+
+func isIgnored(entries []*Entry, authorID int64, feature string) bool {
+	for _, e := range entries {
+		if e.SourceID == authorID {
+			return e.IgnoredBy(feature)
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,30 @@
+package ignorelist
+
+import "testing"
+
+func TestIsIgnored(t *testing.T) {
+	entries := []*Entry{
+		{SourceID: 1, SourceType: SourceBot, Logs: true, Automod: true},
+		{SourceID: 2, SourceType: SourceWebhook, Reputation: true},
+	}
+
+	cases := []struct {
+		author  int64
+		feature string
+		ignored bool
+	}{
+		{1, FeatureLogs, true},
+		{1, FeatureAutomod, true},
+		{1, FeatureReputation, false},
+		{2, FeatureReputation, true},
+		{2, FeatureLogs, false},
+		{3, FeatureLogs, false},
+		{1, "unknown", false},
+	}
+
+	for _, c := range cases {
+		if got := isIgnored(entries, c.author, c.feature); got != c.ignored {
+			t.Errorf("isIgnored(%d, %s) = %v, want %v", c.author, c.feature, got, c.ignored)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package ignorelist
+
+import (
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+var logger = common.GetPluginLogger(&Plugin{})
+
+// Plugin represents the shared ignore list
+type Plugin struct{}
+
+// PluginInfo implements common.Plugin
+func (p *Plugin) PluginInfo() *common.PluginInfo {
+	return &common.PluginInfo{
+		Name:     "Ignore list",
+		SysName:  "ignorelist",
+		Category: common.PluginCategoryCore,
+	}
+}
+
+// RegisterPlugin registers the ignore list and creates its tables
+func RegisterPlugin() {
+	common.InitSchemas("ignorelist", DBSchemas...)
+	common.RegisterPlugin(&Plugin{})
+}
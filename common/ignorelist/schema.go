@@ -0,0 +1,17 @@
+package ignorelist
+
+var DBSchemas = []string{`
+CREATE TABLE IF NOT EXISTS ignore_list_entries (
+	guild_id BIGINT NOT NULL,
+	source_id BIGINT NOT NULL,
+
+	source_type TEXT NOT NULL,
+	name TEXT NOT NULL,
+
+	ignore_logs BOOLEAN NOT NULL,
+	ignore_reputation BOOLEAN NOT NULL,
+	ignore_automod BOOLEAN NOT NULL,
+
+	PRIMARY KEY(guild_id, source_id)
+);
+`}
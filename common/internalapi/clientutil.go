@@ -2,11 +2,14 @@ package internalapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 
 	"emperror.dev/errors"
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/tracing"
 )
 
 var (
@@ -25,12 +28,17 @@ func GetServerAddrForShard(shard int) string {
 }
 
 func GetWithGuild(guildID int64, url string, dest interface{}) error {
+	return GetWithGuildContext(context.Background(), guildID, url, dest)
+}
+
+// GetWithGuildContext is like GetWithGuild but forwards the request id in ctx, if any
+func GetWithGuildContext(ctx context.Context, guildID int64, url string, dest interface{}) error {
 	serverAddr := GetServerAddrForGuild(guildID)
 	if serverAddr == "" {
 		return ErrCantFindAddress
 	}
 
-	return GetWithAddress(serverAddr, url, dest)
+	return GetWithAddressContext(ctx, serverAddr, url, dest)
 }
 
 func GetWithShard(shard int, url string, dest interface{}) error {
@@ -43,7 +51,25 @@ func GetWithShard(shard int, url string, dest interface{}) error {
 }
 
 func GetWithAddress(addr string, url string, dest interface{}) error {
-	resp, err := http.Get("http://" + addr + "/" + url)
+	return GetWithAddressContext(context.Background(), addr, url, dest)
+}
+
+// GetWithAddressContext is like GetWithAddress but forwards the request id in ctx, if any
+func GetWithAddressContext(ctx context.Context, addr string, url string, dest interface{}) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "botrest GET", tracing.KindClient)
+	span.SetAttribute("http.target", "/"+url)
+	span.SetAttribute("net.peer.name", addr)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	req, err := newRequest(ctx, "GET", "http://"+addr+"/"+url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -89,7 +115,13 @@ func PostWithAddress(serverAddr string, url string, bodyData interface{}, dest i
 			return err
 		}
 	}
-	resp, err := http.Post("http://"+serverAddr+"/"+url, "application/json", &bodyBuf)
+	req, err := newRequest(context.Background(), "POST", "http://"+serverAddr+"/"+url, &bodyBuf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -111,3 +143,19 @@ func PostWithAddress(serverAddr string, url string, bodyData interface{}, dest i
 
 	return errors.WithMessage(json.NewDecoder(resp.Body).Decode(dest), "json.Decode")
 }
+
+// newRequest creates a request to the internal api, with the request id and trace in ctx attached
+func newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	tracing.Inject(ctx, req.Header)
+
+	if id := RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,64 @@
+package internalapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the id of the web request that caused a internal api request,
+// so a single user action can be traced across the web and bot processes
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDFromContext returns the request id stored in the context, empty if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(common.ContextKeyRequestID).(string)
+	return id
+}
+
+// requestIDMiddleware stores the request id forwarded by the client in the request context
+func requestIDMiddleware(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), common.ContextKeyRequestID, id)))
+	}
+
+	return http.HandlerFunc(mw)
+}
+
+// tracingMiddleware continues the trace of the caller, if any, with a span covering the handling of the request
+func tracingMiddleware(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header)
+		if tracing.SpanFromContext(ctx) == nil {
+			// only traced when the caller is, the bot is polled way too often for every request to be worth it
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, span := tracing.StartSpan(ctx, "botrest "+r.Method, tracing.KindServer)
+		span.SetAttribute("http.target", r.URL.Path)
+		defer span.End()
+
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(mw)
+}
+
+// RequestLogger returns the internal api logger with the request id of the request attached
+func RequestLogger(r *http.Request) *logrus.Entry {
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return serverLogger.WithField("req", id)
+	}
+
+	return serverLogger
+}
@@ -51,6 +51,8 @@ func (p *Plugin) PluginInfo() *common.PluginInfo {
 func (p *Plugin) CommonRun() {
 
 	muxer := goji.NewMux()
+	muxer.Use(requestIDMiddleware)
+	muxer.Use(tracingMiddleware)
 
 	// muxer.HandleFunc(pat.Get("/:guild/guild"), HandleGuild)
 	// muxer.HandleFunc(pat.Get("/:guild/botmember"), HandleBotMember)
@@ -147,7 +149,7 @@ func (p *Plugin) createListener(addr string) (net.Listener, int, error) {
 func ServeJson(w http.ResponseWriter, r *http.Request, data interface{}) {
 	err := json.NewEncoder(w).Encode(data)
 	if err != nil {
-		serverLogger.WithError(err).Error("Failed sending json")
+		RequestLogger(r).WithError(err).Error("Failed sending json")
 	}
 }
 
@@ -157,6 +159,8 @@ func ServerError(w http.ResponseWriter, r *http.Request, err error) bool {
 		return false
 	}
 
+	RequestLogger(r).WithError(err).WithField("path", r.URL.Path).Info("Internal API request failed")
+
 	encodedErr, _ := json.Marshal(err.Error())
 
 	w.WriteHeader(http.StatusInternalServerError)
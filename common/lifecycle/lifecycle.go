@@ -0,0 +1,249 @@
+// Package lifecycle coordinates the long running parts of a process: pollers, job workers, schedulers and servers
+// register start and stop hooks here, they're started in the order they were registered and stopped in the reverse
+// order on shutdown, each within a timeout so one stuck subsystem can't hold up the rest.
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+var confStopTimeout = config.RegisterOption("yagpdb.lifecycle.stop_timeout", "Default seconds a subsystem gets to stop on shutdown before it's given up on", 10)
+
+var logger = common.GetFixedPrefixLogger("lifecycle")
+
+// ErrStopped is returned when registering hooks after the manager has been stopped
+var ErrStopped = errors.New("lifecycle manager has been stopped")
+
+// Hook is a subsystem managed by a Manager
+type Hook struct {
+	// Name is used in the logs, e.g "web.bulk_operations"
+	Name string
+
+	// Start is called when the manager starts, or right away if it already has. It can't register other hooks.
+	// Optional.
+	Start func(ctx context.Context) error
+
+	// Stop is called on shutdown if the hook was started, the context is cancelled when the timeout is up. Optional.
+	Stop func(ctx context.Context) error
+
+	// StopTimeout is how long Stop gets, defaults to yagpdb.lifecycle.stop_timeout
+	StopTimeout time.Duration
+}
+
+// Manager starts and stops hooks in order
+type Manager struct {
+	mu      sync.Mutex
+	pending []*Hook
+	started []*Hook
+	running bool
+	stopped bool
+
+	// defaultStopTimeout overrides yagpdb.lifecycle.stop_timeout, for tests
+	defaultStopTimeout time.Duration
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Default is the manager of the process, stopped by the shutdown in common/run
+var Default = NewManager()
+
+// Register adds the hook, it's started right away if the manager is already running
+func (m *Manager) Register(h *Hook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return ErrStopped
+	}
+
+	if !m.running {
+		m.pending = append(m.pending, h)
+		return nil
+	}
+
+	return m.startLocked(h)
+}
+
+// Go registers a background loop, it runs in its own goroutine until the context is cancelled on shutdown and the
+// manager waits for it to return
+func (m *Manager) Go(name string, loop func(ctx context.Context)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	return m.Register(&Hook{
+		Name: name,
+		Start: func(context.Context) error {
+			go func() {
+				defer close(done)
+				loop(ctx)
+			}()
+			return nil
+		},
+		Stop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+}
+
+// Start starts the hooks registered so far in order, the ones registered later are started as they come in.
+// Hooks failing to start are logged and not stopped later.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running || m.stopped {
+		return
+	}
+
+	m.running = true
+	for _, h := range m.pending {
+		m.startLocked(h)
+	}
+	m.pending = nil
+}
+
+func (m *Manager) startLocked(h *Hook) error {
+	if h.Start != nil {
+		started := time.Now()
+		if err := h.Start(context.Background()); err != nil {
+			logger.WithError(err).WithField("hook", h.Name).Error("Failed starting subsystem")
+			return err
+		}
+
+		logger.WithField("hook", h.Name).Debugf("Started subsystem in %s", time.Since(started))
+	}
+
+	m.started = append(m.started, h)
+	return nil
+}
+
+// Stop stops the started hooks in the reverse order they were started in, waiting for each of them up to its
+// timeout. Hooks registered after this are refused.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+
+	m.stopped = true
+	hooks := m.started
+	m.started = nil
+	m.pending = nil
+	m.mu.Unlock()
+
+	logger.Infof("Stopping %d subsystems", len(hooks))
+	for i := len(hooks) - 1; i >= 0; i-- {
+		m.stopHook(hooks[i])
+	}
+}
+
+func (m *Manager) stopTimeout(h *Hook) time.Duration {
+	if h.StopTimeout > 0 {
+		return h.StopTimeout
+	}
+
+	if m.defaultStopTimeout > 0 {
+		return m.defaultStopTimeout
+	}
+
+	return time.Duration(confStopTimeout.GetInt()) * time.Second
+}
+
+func (m *Manager) stopHook(h *Hook) {
+	if h.Stop == nil {
+		return
+	}
+
+	timeout := m.stopTimeout(h)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// ran separately so a hook ignoring the context doesn't block the ones after it
+	started := time.Now()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- h.Stop(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l := logger.WithField("hook", h.Name)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		l.Warnf("Gave up stopping subsystem after %s", timeout)
+	case err != nil:
+		l.WithError(err).Error("Failed stopping subsystem")
+	default:
+		l.Infof("Stopped subsystem in %s", time.Since(started))
+	}
+}
+
+// Register adds the hook to the default manager
+func Register(h *Hook) error {
+	return Default.Register(h)
+}
+
+// Go registers a background loop with the default manager
+func Go(name string, loop func(ctx context.Context)) error {
+	return Default.Go(name, loop)
+}
+
+// Start starts the default manager
+func Start() {
+	Default.Start()
+}
+
+// Stop stops the default manager
+func Stop() {
+	Default.Stop()
+}
+
+// Sleep waits for d, returning false if the context was cancelled first. For loops that can't use a ticker.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Wait waits for the wait group, returning the context's error if it's cancelled first. For Stop hooks of
+// subsystems that signal they're done through a wait group.
+func Wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
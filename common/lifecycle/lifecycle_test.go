@@ -0,0 +1,112 @@
+package lifecycle
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerOrder(t *testing.T) {
+	m := NewManager()
+	m.defaultStopTimeout = time.Second
+
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+
+	hook := func(name string) *Hook {
+		return &Hook{
+			Name:  name,
+			Start: func(context.Context) error { record("start " + name); return nil },
+			Stop:  func(context.Context) error { record("stop " + name); return nil },
+		}
+	}
+
+	m.Register(hook("a"))
+	m.Register(hook("b"))
+	m.Start()
+	// registered after starting, started right away
+	m.Register(hook("c"))
+	m.Stop()
+
+	want := []string{"start a", "start b", "start c", "stop c", "stop b", "stop a"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %v, want %v", events, want)
+	}
+
+	if err := m.Register(hook("d")); err != ErrStopped {
+		t.Errorf("expected registering after stopping to fail, got %v", err)
+	}
+}
+
+func TestManagerStopTimeout(t *testing.T) {
+	m := NewManager()
+	m.defaultStopTimeout = time.Millisecond * 10
+
+	stopped := false
+	m.Register(&Hook{Name: "stuck", Stop: func(context.Context) error {
+		select {}
+	}})
+	m.Register(&Hook{Name: "after", Stop: func(context.Context) error {
+		stopped = true
+		return nil
+	}})
+	m.Start()
+
+	done := make(chan struct{})
+	go func() {
+		m.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a stuck hook blocked the shutdown")
+	}
+
+	if !stopped {
+		t.Error("expected the hooks after the stuck one to be stopped")
+	}
+}
+
+func TestManagerGo(t *testing.T) {
+	m := NewManager()
+	m.defaultStopTimeout = time.Second
+
+	exited := false
+	m.Go("loop", func(ctx context.Context) {
+		<-ctx.Done()
+		exited = true
+	})
+	m.Start()
+	m.Stop()
+
+	if !exited {
+		t.Error("expected Stop to wait for the loop to return")
+	}
+}
+
+func TestFailedStartNotStopped(t *testing.T) {
+	m := NewManager()
+	m.defaultStopTimeout = time.Second
+
+	stopped := false
+	m.Register(&Hook{
+		Name:  "broken",
+		Start: func(context.Context) error { return context.Canceled },
+		Stop:  func(context.Context) error { stopped = true; return nil },
+	})
+	m.Start()
+	m.Stop()
+
+	if stopped {
+		t.Error("a hook that failed to start was stopped")
+	}
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogSampleRule keeps only 1 in Rate of the log entries of Module (the "p" field, empty for all) containing Message,
+// a rate of 0 drops them all. Entries at warning level and above are never sampled.
+type LogSampleRule struct {
+	Module  string `json:"module"`
+	Message string `json:"message"`
+	Rate    int    `json:"rate"`
+
+	counter uint64
+}
+
+func (r *LogSampleRule) matches(entry *logrus.Entry) bool {
+	if r.Module != "" {
+		if p, _ := entry.Data["p"].(string); p != r.Module {
+			return false
+		}
+	}
+
+	return strings.Contains(entry.Message, r.Message)
+}
+
+// ParseLogSampleRule parses a rule in the format of "module:message=rate", as used by the -logsample flag
+func ParseLogSampleRule(s string) (*LogSampleRule, error) {
+	eqIndex := strings.LastIndex(s, "=")
+	colonIndex := strings.Index(s, ":")
+	if eqIndex == -1 || colonIndex == -1 || colonIndex > eqIndex {
+		return nil, fmt.Errorf("invalid log sample rule %q, expected module:message=rate", s)
+	}
+
+	rate, err := strconv.Atoi(s[eqIndex+1:])
+	if err != nil || rate < 0 {
+		return nil, fmt.Errorf("invalid rate in log sample rule %q", s)
+	}
+
+	return &LogSampleRule{
+		Module:  s[:colonIndex],
+		Message: s[colonIndex+1 : eqIndex],
+		Rate:    rate,
+	}, nil
+}
+
+// LogSettings controls what gets logged, it can be changed at runtime through the admin api
+type LogSettings struct {
+	Level string `json:"level"`
+	// DebugGuilds have their debug logs included regardless of the level
+	DebugGuilds []int64          `json:"debug_guilds"`
+	Sampling    []*LogSampleRule `json:"sampling"`
+
+	level       logrus.Level
+	debugGuilds map[int64]bool
+}
+
+var (
+	logSettings   *LogSettings
+	logSettingsMU sync.RWMutex
+)
+
+// SetLogSettings applies the settings to this process
+func SetLogSettings(settings *LogSettings) error {
+	level, err := logrus.ParseLevel(settings.Level)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range settings.Sampling {
+		if v.Rate < 0 {
+			return fmt.Errorf("invalid sampling rate %d", v.Rate)
+		}
+	}
+
+	applied := &LogSettings{
+		Level:       level.String(),
+		DebugGuilds: settings.DebugGuilds,
+		level:       level,
+		debugGuilds: make(map[int64]bool),
+	}
+
+	for _, v := range settings.DebugGuilds {
+		applied.debugGuilds[v] = true
+	}
+
+	// copied as the counters are reset
+	for _, v := range settings.Sampling {
+		applied.Sampling = append(applied.Sampling, &LogSampleRule{Module: v.Module, Message: v.Message, Rate: v.Rate})
+	}
+
+	logSettingsMU.Lock()
+	logSettings = applied
+	logSettingsMU.Unlock()
+
+	// the debug entries of the debug guilds are filtered out of the rest by the formatter
+	if len(applied.debugGuilds) > 0 && level < logrus.DebugLevel {
+		level = logrus.DebugLevel
+	}
+	logrus.SetLevel(level)
+	return nil
+}
+
+// CurrentLogSettings returns the log settings of this process
+func CurrentLogSettings() *LogSettings {
+	logSettingsMU.RLock()
+	defer logSettingsMU.RUnlock()
+
+	if logSettings == nil {
+		return &LogSettings{Level: logrus.GetLevel().String()}
+	}
+
+	return logSettings
+}
+
+func logEntryGuild(entry *logrus.Entry) int64 {
+	for _, key := range []string{"guild", "g", "guild_id"} {
+		switch t := entry.Data[key].(type) {
+		case int64:
+			return t
+		case int:
+			return int64(t)
+		case string:
+			parsed, _ := strconv.ParseInt(t, 10, 64)
+			return parsed
+		}
+	}
+
+	return 0
+}
+
+// keepLogEntry returns false if the entry is filtered out by the log settings
+func keepLogEntry(entry *logrus.Entry) bool {
+	logSettingsMU.RLock()
+	settings := logSettings
+	logSettingsMU.RUnlock()
+
+	if settings == nil {
+		return true
+	}
+
+	if entry.Level > settings.level {
+		// only logged because of the debug guilds
+		return settings.debugGuilds[logEntryGuild(entry)]
+	}
+
+	if entry.Level <= logrus.WarnLevel {
+		return true
+	}
+
+	for _, v := range settings.Sampling {
+		if !v.matches(entry) {
+			continue
+		}
+
+		if v.Rate == 0 {
+			return false
+		}
+
+		n := atomic.AddUint64(&v.counter, 1)
+		return (n-1)%uint64(v.Rate) == 0
+	}
+
+	return true
+}
+
+// filteringFormatter drops the entries filtered out by the log settings, hooks still see every entry
+type filteringFormatter struct {
+	inner logrus.Formatter
+}
+
+func (f *filteringFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !keepLogEntry(entry) {
+		return nil, nil
+	}
+
+	return f.inner.Format(entry)
+}
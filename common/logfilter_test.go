@@ -0,0 +1,77 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseLogSampleRule(t *testing.T) {
+	rule, err := ParseLogSampleRule("bot:Checking if guild is available=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rule.Module != "bot" || rule.Message != "Checking if guild is available" || rule.Rate != 100 {
+		t.Errorf("parsed wrong rule: %#v", rule)
+	}
+
+	for _, v := range []string{"", "bot", "bot:msg", "msg=10", "bot:msg=-1", "bot:msg=abc", "a=b:c"} {
+		if _, err := ParseLogSampleRule(v); err == nil {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestKeepLogEntry(t *testing.T) {
+	defer SetLogSettings(&LogSettings{Level: "info"})
+
+	err := SetLogSettings(&LogSettings{
+		Level:       "info",
+		DebugGuilds: []int64{1},
+		Sampling: []*LogSampleRule{
+			{Module: "bot", Message: "available", Rate: 2},
+			{Message: "noisy", Rate: 0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := func(level logrus.Level, msg string, fields logrus.Fields) *logrus.Entry {
+		e := logrus.NewEntry(logrus.StandardLogger()).WithFields(fields)
+		e.Level = level
+		e.Message = msg
+		return e
+	}
+
+	if !keepLogEntry(entry(logrus.DebugLevel, "debug", logrus.Fields{"guild": int64(1)})) {
+		t.Error("expected debug entries of debug guilds to be kept")
+	}
+
+	if keepLogEntry(entry(logrus.DebugLevel, "debug", logrus.Fields{"guild": int64(2)})) {
+		t.Error("expected debug entries of other guilds to be dropped")
+	}
+
+	kept := 0
+	for i := 0; i < 10; i++ {
+		if keepLogEntry(entry(logrus.InfoLevel, "Checking if guild is available", logrus.Fields{"p": "bot"})) {
+			kept++
+		}
+	}
+	if kept != 5 {
+		t.Errorf("expected 5 sampled entries to be kept, got %d", kept)
+	}
+
+	if !keepLogEntry(entry(logrus.InfoLevel, "Checking if guild is available", logrus.Fields{"p": "web"})) {
+		t.Error("expected entries of other modules to be kept")
+	}
+
+	if keepLogEntry(entry(logrus.InfoLevel, "noisy", nil)) {
+		t.Error("expected entries with a rate of 0 to be dropped")
+	}
+
+	if !keepLogEntry(entry(logrus.ErrorLevel, "noisy", nil)) {
+		t.Error("expected errors to never be sampled")
+	}
+}
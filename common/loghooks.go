@@ -250,12 +250,15 @@ func AddLogHook(hook logrus.Hook) {
 	logrus.AddHook(hook)
 }
 
+// SetLoggingLevel changes the level, keeping the debug guilds and sampling rules of the current log settings
 func SetLoggingLevel(level logrus.Level) {
-	logrus.SetLevel(level)
+	current := CurrentLogSettings()
+	SetLogSettings(&LogSettings{Level: level.String(), DebugGuilds: current.DebugGuilds, Sampling: current.Sampling})
 }
 
+// SetLogFormatter sets the formatter, entries filtered out by the log settings are dropped before reaching it
 func SetLogFormatter(formatter logrus.Formatter) {
-	logrus.SetFormatter(formatter)
+	logrus.SetFormatter(&filteringFormatter{inner: formatter})
 }
 
 func GetPluginLogger(plugin Plugin) *logrus.Entry {
@@ -0,0 +1,96 @@
+package mqueue
+
+import (
+	"database/sql"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+// WebhookBranding is a custom name and avatar applied to all the webhooks mqueue manages in a guild
+type WebhookBranding struct {
+	GuildID int64
+
+	Username string
+	// Avatar is a data uri, as that's what discord takes when editing webhooks
+	Avatar string
+
+	UpdatedAt time.Time
+}
+
+var brandingCache = common.CacheSet.RegisterSlot("mqueue_webhook_branding", func(key interface{}) (interface{}, error) {
+	return GetWebhookBranding(key.(int64))
+}, int64(0))
+
+// GetWebhookBranding returns the branding for the guild, or a empty branding if none is set
+func GetWebhookBranding(guildID int64) (*WebhookBranding, error) {
+	const query = `SELECT username, avatar, updated_at FROM mqueue_webhook_brandings WHERE guild_id=$1;`
+
+	branding := &WebhookBranding{
+		GuildID: guildID,
+	}
+
+	err := common.PQ.QueryRow(query, guildID).Scan(&branding.Username, &branding.Avatar, &branding.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStackIf(err)
+	}
+
+	return branding, nil
+}
+
+// SaveWebhookBranding stores the branding, it will be applied to the webhooks as they're used next
+func SaveWebhookBranding(branding *WebhookBranding) error {
+	const query = `INSERT INTO mqueue_webhook_brandings (guild_id, username, avatar, updated_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (guild_id) DO UPDATE SET username = $2, avatar = $3, updated_at = $4;`
+
+	branding.UpdatedAt = time.Now()
+
+	_, err := common.PQ.Exec(query, branding.GuildID, branding.Username, branding.Avatar, branding.UpdatedAt)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	pubsub.EvictCacheSet(brandingCache, branding.GuildID)
+	return nil
+}
+
+// applyBranding updates the webhook's name and avatar if the branding changed since it was last applied
+func applyBranding(wh *webhook, branding *WebhookBranding, defaultAvatar string) error {
+	if !wh.BrandedAt.Before(branding.UpdatedAt) {
+		return nil
+	}
+
+	name := branding.Username
+	if name == "" {
+		name = wh.Plugin
+	}
+
+	avatar := branding.Avatar
+	if avatar == "" {
+		avatar = defaultAvatar
+	}
+
+	_, err := webhookSession.WebhookEditWithToken(wh.ID, wh.Token, name, avatar)
+	if err != nil {
+		return err
+	}
+
+	const query = `UPDATE mqueue_webhooks SET branded_at = $2 WHERE id = $1;`
+	_, err = common.PQ.Exec(query, wh.ID, branding.UpdatedAt)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	wh.BrandedAt = branding.UpdatedAt
+	return nil
+}
+
+func brandWebhookParams(params *discordgo.WebhookParams, branding *WebhookBranding) {
+	if branding.Username != "" {
+		params.Username = branding.Username
+	}
+}
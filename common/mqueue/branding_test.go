@@ -0,0 +1,35 @@
+package mqueue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestBrandWebhookParams(t *testing.T) {
+	params := &discordgo.WebhookParams{Username: "YAGPDB"}
+	brandWebhookParams(params, &WebhookBranding{})
+	if params.Username != "YAGPDB" {
+		t.Errorf("a empty branding changed the username to %q", params.Username)
+	}
+
+	brandWebhookParams(params, &WebhookBranding{Username: "Custom"})
+	if params.Username != "Custom" {
+		t.Errorf("expected the branded username, got %q", params.Username)
+	}
+}
+
+func TestApplyBrandingUpToDate(t *testing.T) {
+	updated := time.Now()
+	wh := &webhook{ID: 1, Plugin: "reddit", BrandedAt: updated}
+
+	// the webhook was branded after the last change, so discord isn't called (webhookSession is nil here)
+	if err := applyBranding(wh, &WebhookBranding{Username: "Custom", UpdatedAt: updated}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if !wh.BrandedAt.Equal(updated) {
+		t.Errorf("branded at changed to %v", wh.BrandedAt)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"emperror.dev/errors"
 	"github.com/botlabs-gg/yagpdb/v2/bot"
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/apiusage"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
@@ -31,6 +32,7 @@ func (d *DiscordProcessor) ProcessItem(resp chan *workResult, wi *workItem) {
 	var err error
 	if wi.Elem.UseWebhook {
 		err = trySendWebhook(queueLogger, wi.Elem)
+		recordWebhookUsage(queueLogger, wi.Elem, err)
 	} else {
 		err = trySendNormal(queueLogger, wi.Elem)
 	}
@@ -119,6 +121,21 @@ func trySendNormal(l *logrus.Entry, elem *QueuedElement) (err error) {
 
 var errGuildNotFound = errors.New("Guild not found")
 
+func recordWebhookUsage(l *logrus.Entry, elem *QueuedElement, sendErr error) {
+	outcome := apiusage.OutcomeOK
+	if sendErr != nil {
+		outcome = apiusage.OutcomeError
+		if e, ok := errors.Cause(sendErr).(*discordgo.RESTError); ok && e.Response != nil {
+			outcome = apiusage.OutcomeFromStatus(e.Response.StatusCode)
+		}
+	}
+
+	err := apiusage.Record(elem.GuildID, apiusage.KindWebhook, outcome)
+	if err != nil {
+		l.WithError(err).Error("failed recording webhook usage")
+	}
+}
+
 func trySendWebhook(l *logrus.Entry, elem *QueuedElement) (err error) {
 	if elem.MessageStr == "" && elem.MessageEmbed == nil {
 		l.Error("Both MessageEmbed and MessageStr empty")
@@ -161,6 +178,19 @@ func trySendWebhook(l *logrus.Entry, elem *QueuedElement) (err error) {
 		webhookParams.Embeds = []*discordgo.MessageEmbed{elem.MessageEmbed}
 	}
 
+	brandingI, err := brandingCache.Get(elem.GuildID)
+	if err != nil {
+		l.WithError(err).Error("failed retrieving webhook branding")
+	} else {
+		branding := brandingI.(*WebhookBranding)
+		brandWebhookParams(webhookParams, branding)
+
+		err = applyBranding(wh, branding, avatar)
+		if err != nil {
+			l.WithError(err).Error("failed applying webhook branding")
+		}
+	}
+
 	err = webhookSession.WebhookExecute(wh.ID, wh.Token, true, webhookParams)
 	if code, _ := common.DiscordError(err); code == discordgo.ErrCodeUnknownWebhook {
 		// if the webhook was deleted, then delete the bad boi from the databse and retry
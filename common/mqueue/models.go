@@ -46,18 +46,22 @@ type webhook struct {
 	ChannelID int64
 
 	Plugin string
+
+	// last time a guild's WebhookBranding was applied to this webhook
+	BrandedAt time.Time
 }
 
 func findCreateWebhook(guildID int64, channelID int64, plugin string, avatar string) (*webhook, error) {
 	const query = `
-SELECT id, guild_id, channel_id, token, plugin FROM mqueue_webhooks
+SELECT id, guild_id, channel_id, token, plugin, branded_at FROM mqueue_webhooks
 WHERE guild_id=$1 AND channel_id=$2 AND plugin=$3;
 `
 
 	row := common.PQ.QueryRow(query, guildID, channelID, plugin)
 
 	var hook webhook
-	err := row.Scan(&hook.ID, &hook.GuildID, &hook.ChannelID, &hook.Token, &hook.Plugin)
+	var brandedAt sql.NullTime
+	err := row.Scan(&hook.ID, &hook.GuildID, &hook.ChannelID, &hook.Token, &hook.Plugin, &brandedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return createWebhook(guildID, channelID, plugin, avatar)
@@ -66,6 +70,8 @@ WHERE guild_id=$1 AND channel_id=$2 AND plugin=$3;
 		return nil, err
 	}
 
+	hook.BrandedAt = brandedAt.Time
+
 	return &hook, nil
 }
 
@@ -12,4 +12,15 @@ CREATE TABLE IF NOT EXISTS mqueue_webhooks (
 );
 
 CREATE INDEX IF NOT EXISTS mqueue_webhooks_channel_id_idx ON mqueue_webhooks(channel_id);
+
+ALTER TABLE mqueue_webhooks ADD COLUMN IF NOT EXISTS branded_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS mqueue_webhook_brandings (
+	guild_id BIGINT PRIMARY KEY,
+
+	username TEXT NOT NULL,
+	avatar TEXT NOT NULL,
+
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
 `
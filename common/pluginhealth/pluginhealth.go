@@ -0,0 +1,208 @@
+// Package pluginhealth keeps track of the background jobs of plugins, they report their successful and failed runs here
+// and the status is shown to the bot owner on the admin panel and to server admins on the dashboard home.
+// The reports are stored in redis as the jobs usually run in a different process than the web server.
+package pluginhealth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+)
+
+var logger = common.GetFixedPrefixLogger("pluginhealth")
+
+// Check is a background job of a plugin
+type Check struct {
+	// Name has to be unique across all plugins, e.g "premium_monitor"
+	Name        string
+	Description string
+
+	// the job is considered stale when it has not succeeded for this long
+	MaxInterval time.Duration
+}
+
+// PluginWithHealthChecks is implemented by plugins with background jobs that report to this package
+type PluginWithHealthChecks interface {
+	common.Plugin
+
+	HealthChecks() []*Check
+}
+
+func keyCheck(name string) string {
+	return "plugin_health:" + name
+}
+
+// Success records a successful run of the check
+func Success(name string) {
+	err := common.RedisPool.Do(radix.Cmd(nil, "HSET", keyCheck(name),
+		"last_success", strconv.FormatInt(time.Now().Unix(), 10),
+		"consecutive_errors", "0"))
+	if err != nil {
+		logger.WithError(err).WithField("check", name).Error("failed recording success")
+	}
+}
+
+// Failure records a failed run of the check, the error message is shown to the bot owner
+func Failure(name string, runErr error) {
+	key := keyCheck(name)
+	err := common.MultipleCmds(
+		radix.Cmd(nil, "HSET", key, "last_error", strconv.FormatInt(time.Now().Unix(), 10), "last_error_msg", common.CutStringShort(runErr.Error(), 500)),
+		radix.Cmd(nil, "HINCRBY", key, "errors", "1"),
+		radix.Cmd(nil, "HINCRBY", key, "consecutive_errors", "1"),
+	)
+	if err != nil {
+		logger.WithError(err).WithField("check", name).Error("failed recording failure")
+	}
+}
+
+// Report records the result of a run, a nil error is a success
+func Report(name string, err error) {
+	if err != nil {
+		Failure(name, err)
+	} else {
+		Success(name)
+	}
+}
+
+// State is the overall state of a check or plugin
+type State string
+
+const (
+	// StateUnknown means the check has not reported anything, the job might not run in this deployment
+	StateUnknown State = "unknown"
+	StateOK      State = "ok"
+	// StateFailing means the last run failed
+	StateFailing State = "failing"
+	// StateStale means the job has not succeeded within its MaxInterval
+	StateStale State = "stale"
+)
+
+// severity is used to pick the worst state of a plugin
+func (s State) severity() int {
+	switch s {
+	case StateOK:
+		return 1
+	case StateFailing:
+		return 2
+	case StateStale:
+		return 3
+	}
+
+	return 0
+}
+
+// Healthy returns true unless the job is known to be broken
+func (s State) Healthy() bool {
+	return s == StateOK || s == StateUnknown
+}
+
+// CheckStatus is the last known status of a check
+type CheckStatus struct {
+	Check *Check
+
+	LastSuccess       time.Time
+	LastError         time.Time
+	LastErrorMsg      string
+	Errors            int64
+	ConsecutiveErrors int64
+
+	State State
+}
+
+func (c *CheckStatus) computeState(now time.Time) State {
+	if c.LastSuccess.IsZero() && c.LastError.IsZero() {
+		return StateUnknown
+	}
+
+	if c.Check.MaxInterval > 0 && now.Sub(c.LastSuccess) > c.Check.MaxInterval {
+		return StateStale
+	}
+
+	if c.ConsecutiveErrors > 0 {
+		return StateFailing
+	}
+
+	return StateOK
+}
+
+// PluginStatus is the status of all the checks of a plugin, State is the worst state of them
+type PluginStatus struct {
+	Plugin *common.PluginInfo
+	Checks []*CheckStatus
+	State  State
+}
+
+func parseUnix(s string) time.Time {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(n, 0)
+}
+
+// GetCheckStatus retrieves the status of a single check
+func GetCheckStatus(check *Check) (*CheckStatus, error) {
+	var fields map[string]string
+	err := common.RedisPool.Do(radix.Cmd(&fields, "HGETALL", keyCheck(check.Name)))
+	if err != nil {
+		return nil, err
+	}
+
+	errorCount, _ := strconv.ParseInt(fields["errors"], 10, 64)
+	consecutive, _ := strconv.ParseInt(fields["consecutive_errors"], 10, 64)
+
+	status := &CheckStatus{
+		Check:             check,
+		LastSuccess:       parseUnix(fields["last_success"]),
+		LastError:         parseUnix(fields["last_error"]),
+		LastErrorMsg:      fields["last_error_msg"],
+		Errors:            errorCount,
+		ConsecutiveErrors: consecutive,
+	}
+	status.State = status.computeState(time.Now())
+
+	return status, nil
+}
+
+// GetStatuses retrieves the status of all the plugins with health checks
+func GetStatuses() ([]*PluginStatus, error) {
+	var result []*PluginStatus
+	for _, v := range common.Plugins {
+		p, ok := v.(PluginWithHealthChecks)
+		if !ok {
+			continue
+		}
+
+		ps := &PluginStatus{Plugin: p.PluginInfo(), State: StateUnknown}
+		for _, check := range p.HealthChecks() {
+			status, err := GetCheckStatus(check)
+			if err != nil {
+				return nil, err
+			}
+
+			ps.Checks = append(ps.Checks, status)
+			if status.State.severity() > ps.State.severity() {
+				ps.State = status.State
+			}
+		}
+
+		result = append(result, ps)
+	}
+
+	return result, nil
+}
+
+// Unhealthy returns the plugins that have a check that's failing or stale
+func Unhealthy(statuses []*PluginStatus) []*PluginStatus {
+	var result []*PluginStatus
+	for _, v := range statuses {
+		if !v.State.Healthy() {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
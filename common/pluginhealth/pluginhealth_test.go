@@ -0,0 +1,44 @@
+package pluginhealth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeState(t *testing.T) {
+	now := time.Now()
+	check := &Check{Name: "test", MaxInterval: time.Minute * 10}
+
+	cases := []struct {
+		name   string
+		status *CheckStatus
+		state  State
+	}{
+		{"never reported", &CheckStatus{Check: check}, StateUnknown},
+		{"recent success", &CheckStatus{Check: check, LastSuccess: now.Add(-time.Minute)}, StateOK},
+		{"recovered", &CheckStatus{Check: check, LastSuccess: now.Add(-time.Minute), LastError: now.Add(-time.Minute * 2), Errors: 3}, StateOK},
+		{"last run failed", &CheckStatus{Check: check, LastSuccess: now.Add(-time.Minute * 2), LastError: now.Add(-time.Minute), Errors: 1, ConsecutiveErrors: 1}, StateFailing},
+		{"old success", &CheckStatus{Check: check, LastSuccess: now.Add(-time.Hour)}, StateStale},
+		{"only failures", &CheckStatus{Check: check, LastError: now, Errors: 1, ConsecutiveErrors: 1}, StateStale},
+		{"no max interval", &CheckStatus{Check: &Check{Name: "test"}, LastSuccess: now.Add(-time.Hour * 1000)}, StateOK},
+	}
+
+	for _, c := range cases {
+		if got := c.status.computeState(now); got != c.state {
+			t.Errorf("%s: got %s, expected %s", c.name, got, c.state)
+		}
+	}
+}
+
+func TestStateSeverity(t *testing.T) {
+	order := []State{StateUnknown, StateOK, StateFailing, StateStale}
+	for i := 1; i < len(order); i++ {
+		if order[i].severity() <= order[i-1].severity() {
+			t.Errorf("%s should be worse than %s", order[i], order[i-1])
+		}
+	}
+
+	if StateFailing.Healthy() || StateStale.Healthy() || !StateOK.Healthy() || !StateUnknown.Healthy() {
+		t.Error("unexpected Healthy result")
+	}
+}
@@ -38,6 +38,13 @@ func handleEvictCoreConfigCache(evt *Event) {
 	common.CoreServerConfigCache.Delete(int(evt.TargetGuildInt))
 }
 
+func handleUpdateLogSettings(evt *Event) {
+	err := common.SetLogSettings(evt.Data.(*common.LogSettings))
+	if err != nil {
+		logger.WithError(err).Error("failed applying log settings")
+	}
+}
+
 type evictCacheSetData struct {
 	Name string          `json:"name"`
 	Key  json.RawMessage `json:"key"`
@@ -91,6 +91,7 @@ func PollEvents() {
 	AddHandler("global_ratelimit", handleGlobalRatelimtPusub, globalRatelimitTriggeredEventData{})
 	AddHandler("evict_core_config_cache", handleEvictCoreConfigCache, nil)
 	AddHandler("evict_cache_set", handleEvictCacheSet, evictCacheSetData{})
+	AddHandler("update_log_settings", handleUpdateLogSettings, common.LogSettings{})
 
 	common.BotSession.AddHandler(func(s *discordgo.Session, r *discordgo.RateLimit) {
 		if r.Global {
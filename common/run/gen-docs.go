@@ -133,3 +133,40 @@ func GenConfigDocs() {
 
 	os.Stdout.Write(out.Bytes())
 }
+
+func GenTemplateDataDocs() {
+	documented := web.DocumentedTemplateData()
+
+	pages := make([]string, 0, len(documented))
+	for k := range documented {
+		pages = append(pages, k)
+	}
+
+	// the fields available on all pages go first
+	sort.Strings(pages)
+
+	var out bytes.Buffer
+
+	for _, page := range pages {
+		if page == web.TemplateDataAllPages {
+			out.WriteString("## All pages\n\n")
+		} else {
+			out.WriteString("## " + page + "\n\n")
+		}
+
+		for _, v := range documented[page] {
+			out.WriteString("**" + v.Name + "**")
+			if v.Type != nil {
+				out.WriteString(" (" + v.Type.String() + ")")
+			}
+			out.WriteString(": " + v.Description + "\n")
+
+			if v.Deprecated != "" {
+				out.WriteString("Deprecated, use " + v.Deprecated + " instead\n")
+			}
+			out.WriteString("\n")
+		}
+	}
+
+	os.Stdout.Write(out.Bytes())
+}
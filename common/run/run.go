@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -18,9 +19,11 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/common/backgroundworkers"
 	"github.com/botlabs-gg/yagpdb/v2/common/config"
 	"github.com/botlabs-gg/yagpdb/v2/common/configstore"
+	"github.com/botlabs-gg/yagpdb/v2/common/lifecycle"
 	"github.com/botlabs-gg/yagpdb/v2/common/mqueue"
 	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
 	"github.com/botlabs-gg/yagpdb/v2/common/sentryhook"
+	"github.com/botlabs-gg/yagpdb/v2/common/tracing"
 	"github.com/botlabs-gg/yagpdb/v2/feeds"
 	"github.com/botlabs-gg/yagpdb/v2/web"
 	"github.com/getsentry/sentry-go"
@@ -36,11 +39,15 @@ var (
 
 	flagDryRun bool
 
-	flagLogTimestamp bool
+	flagLogTimestamp   bool
+	flagLogLevel       string
+	flagLogDebugGuilds string
+	flagLogSample      logSampleFlag
 
 	flagSysLog        bool
 	flagGenCmdDocs    bool
 	flagGenConfigDocs bool
+	flagGenTmplDocs   bool
 
 	flagLogAppName string
 
@@ -62,8 +69,12 @@ func init() {
 	flag.BoolVar(&flagRunBWC, "backgroundworkers", false, "Run the various background workers, atleast one process needs this")
 	flag.BoolVar(&flagGenCmdDocs, "gencmddocs", false, "Generate command docs and exit")
 	flag.BoolVar(&flagGenConfigDocs, "genconfigdocs", false, "Generate config docs and exit")
+	flag.BoolVar(&flagGenTmplDocs, "gentemplatedocs", false, "Generate docs of the template data available to control panel pages and exit")
 
 	flag.BoolVar(&flagLogTimestamp, "ts", false, "Set to include timestamps in log")
+	flag.StringVar(&flagLogLevel, "loglevel", "info", "The log level (trace, debug, info, warning, error), can be changed at runtime through the admin api")
+	flag.StringVar(&flagLogDebugGuilds, "logdebugguilds", "", "Comma seperated list of guilds to include debug logs of regardless of the log level")
+	flag.Var(&flagLogSample, "logsample", "Only log 1 in rate of the entries of a module containing the message, in the format of module:message=rate (module can be empty to match all, rate 0 drops them). Can be specified multiple times")
 
 	flag.StringVar(&flagNodeID, "nodeid", "", "The id of this node, used when running with a sharding orchestrator")
 	flag.BoolVar(&flagVersion, "version", false, "Print the version and exit")
@@ -93,7 +104,11 @@ func Init() {
 		AddSyslogHooks()
 	}
 
-	if !flagRunBot && !flagRunWeb && flagRunFeeds == "" && !flagRunEverything && !flagDryRun && !flagRunBWC && !flagGenConfigDocs {
+	if err := common.SetLogSettings(logSettingsFromFlags()); err != nil {
+		log.WithError(err).Fatal("Invalid log flags")
+	}
+
+	if !flagRunBot && !flagRunWeb && flagRunFeeds == "" && !flagRunEverything && !flagDryRun && !flagRunBWC && !flagGenConfigDocs && !flagGenTmplDocs {
 		log.Error("Didnt specify what to run, see -h for more info")
 		os.Exit(1)
 	}
@@ -109,6 +124,8 @@ func Init() {
 		addSentryHook()
 	}
 
+	go tracing.Run(flagNodeID)
+
 	err = common.Init()
 	if err != nil {
 		log.WithError(err).Fatal("Failed intializing")
@@ -149,6 +166,11 @@ func Run() {
 		return
 	}
 
+	if flagGenTmplDocs {
+		GenTemplateDataDocs()
+		return
+	}
+
 	if flagRunWeb || flagRunEverything {
 		go web.Run()
 	}
@@ -178,6 +200,10 @@ func Run() {
 
 	common.RunCommonRunPlugins()
 
+	// the subsystems registered later, like the ones of the webserver which is started in the background, are
+	// started as they're registered
+	lifecycle.Start()
+
 	common.SetShutdownFunc(shutdown)
 	listenSignal()
 }
@@ -214,13 +240,9 @@ func shutdown() {
 	}
 
 	if flagRunWeb {
-		web.Stop()
-		// Slep for a extra second
-		time.Sleep(time.Second)
-	}
-
-	if flagRunBWC {
-		backgroundworkers.StopWorkers(wg)
+		wg.Add(1)
+		go web.Shutdown(wg)
+		shouldWait = true
 	}
 
 	if shouldWait {
@@ -228,9 +250,17 @@ func shutdown() {
 		wg.Wait()
 	}
 
+	// background loops and workers, stopped after the servers so they're not stopped under in flight requests
+	lifecycle.Stop()
+
 	log.Info("Sleeping for a second to allow work to finish")
 	time.Sleep(time.Second)
 
+	// nothing is using redis anymore, return the connections
+	if common.RedisPool != nil {
+		common.RedisPool.Close()
+	}
+
 	log.Info("Bye..")
 	os.Exit(0)
 }
@@ -295,3 +325,35 @@ func findStringIndex(slice []string, s string) int {
 
 	return -1
 }
+
+// logSampleFlag collects the -logsample flags
+type logSampleFlag []*common.LogSampleRule
+
+func (f *logSampleFlag) String() string {
+	return fmt.Sprint(len(*f), " rules")
+}
+
+func (f *logSampleFlag) Set(v string) error {
+	rule, err := common.ParseLogSampleRule(v)
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, rule)
+	return nil
+}
+
+func logSettingsFromFlags() *common.LogSettings {
+	settings := &common.LogSettings{
+		Level:    flagLogLevel,
+		Sampling: flagLogSample,
+	}
+
+	for _, v := range strings.Split(flagLogDebugGuilds, ",") {
+		if parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			settings.DebugGuilds = append(settings.DebugGuilds, parsed)
+		}
+	}
+
+	return settings
+}
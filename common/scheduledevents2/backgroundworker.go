@@ -10,6 +10,7 @@ import (
 	"emperror.dev/errors"
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/backgroundworkers"
+	"github.com/botlabs-gg/yagpdb/v2/common/pluginhealth"
 	"github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2/models"
 	"github.com/mediocregopher/radix/v3"
 	"github.com/volatiletech/sqlboiler/queries/qm"
@@ -17,6 +18,28 @@ import (
 
 const flushTresholdMinutes = 5
 
+const (
+	healthCheckFlush         = "scheduledevents_flush"
+	healthCheckCleanupRecent = "scheduledevents_cleanup_recent"
+)
+
+var _ pluginhealth.PluginWithHealthChecks = (*ScheduledEvents)(nil)
+
+func (p *ScheduledEvents) HealthChecks() []*pluginhealth.Check {
+	return []*pluginhealth.Check{
+		{
+			Name:        healthCheckFlush,
+			Description: "Moves the events triggering soon from postgres into redis",
+			MaxInterval: time.Minute * 10,
+		},
+		{
+			Name:        healthCheckCleanupRecent,
+			Description: "Deletes the recently processed events",
+			MaxInterval: time.Minute * 30,
+		},
+	}
+}
+
 var _ backgroundworkers.BackgroundWorkerPlugin = (*ScheduledEvents)(nil)
 
 func (p *ScheduledEvents) RunBackgroundWorker() {
@@ -36,6 +59,7 @@ func (p *ScheduledEvents) RunBackgroundWorker() {
 			if err != nil {
 				logger.WithError(err).Error("failed moving scheduled events into redis")
 			}
+			pluginhealth.Report(healthCheckFlush, err)
 			logger.Info("DONE flushing new events...")
 		}
 	}
@@ -60,6 +84,7 @@ func (p *ScheduledEvents) SecondaryCleaner() {
 			if err != nil {
 				logger.WithError(err).Error("failed cleaning up recent scheduled events")
 			}
+			pluginhealth.Report(healthCheckCleanupRecent, err)
 			logger.Info("DONE cleaning up recent events...")
 		}
 	}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+var logger = common.GetPluginLogger(&Plugin{})
+
+// Plugin represents the secrets vault
+type Plugin struct{}
+
+// PluginInfo implements common.Plugin
+func (p *Plugin) PluginInfo() *common.PluginInfo {
+	return &common.PluginInfo{
+		Name:     "Secrets",
+		SysName:  "secrets",
+		Category: common.PluginCategoryCore,
+	}
+}
+
+// RegisterPlugin registers the secrets vault and creates its tables
+func RegisterPlugin() {
+	common.InitSchemas("secrets", DBSchemas...)
+	common.RegisterPlugin(&Plugin{})
+}
+
+// Reference is an integration using a secret, shown when deleting the secret as it would break
+type Reference struct {
+	Secret string
+
+	// Plugin is the name of the plugin using it, Description what in the plugin uses it (e.g "Webhook feed #3")
+	Plugin      string
+	Description string
+}
+
+// PluginWithSecretReferences is implemented by plugins whose integrations can use secrets from the vault
+type PluginWithSecretReferences interface {
+	common.Plugin
+
+	SecretReferences(ctx context.Context, guildID int64) ([]*Reference, error)
+}
+
+// GetReferences returns the integrations in the guild using secrets, if name is not empty only those using that secret
+func GetReferences(ctx context.Context, guildID int64, name string) ([]*Reference, error) {
+	var result []*Reference
+	for _, v := range common.Plugins {
+		p, ok := v.(PluginWithSecretReferences)
+		if !ok {
+			continue
+		}
+
+		refs, err := p.SecretReferences(ctx, guildID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range refs {
+			if name == "" || ref.Secret == name {
+				if ref.Plugin == "" {
+					ref.Plugin = p.PluginInfo().Name
+				}
+				result = append(result, ref)
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,18 @@
+package secrets
+
+var DBSchemas = []string{`
+CREATE TABLE IF NOT EXISTS guild_secrets (
+	guild_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+
+	ciphertext BYTEA NOT NULL,
+	key_id TEXT NOT NULL,
+	version INT NOT NULL,
+
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	rotated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	last_used_at TIMESTAMP WITH TIME ZONE,
+
+	PRIMARY KEY(guild_id, name)
+);
+`}
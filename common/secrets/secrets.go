@@ -0,0 +1,268 @@
+// Package secrets is a per guild vault for the credentials integrations need (webhook tokens, api keys of external services).
+// Values are encrypted with AES-GCM using the key in yagpdb.secrets.key, and can only be written from the control panel, never read back.
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+var (
+	confKey         = config.RegisterOption("yagpdb.secrets.key", "Base64 encoded 32 byte key the guild secrets are encrypted with, the vault is disabled without it", "")
+	confPreviousKey = config.RegisterOption("yagpdb.secrets.previous_key", "The previous value of yagpdb.secrets.key when changing it, secrets encrypted with it are re-encrypted with the new key when they're used", "")
+)
+
+const (
+	MaxSecretsPerGuild = 25
+	MaxValueLength     = 4000
+)
+
+var (
+	ErrNotFound    = errors.New("secret not found")
+	ErrDisabled    = errors.New("secrets vault is not configured")
+	ErrInvalidName = errors.New("secret names can only contain lowercase letters, numbers and underscores, and be up to 32 characters long")
+	ErrTooMany     = errors.New("too many secrets, the max is " + strconv.Itoa(MaxSecretsPerGuild))
+)
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ValidName returns true if the name can be used for a secret
+func ValidName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+// Secret is the metadata of a secret, the value itself is never exposed through this
+type Secret struct {
+	GuildID int64
+	Name    string
+
+	// Version is bumped every time the value is rotated
+	Version    int
+	CreatedAt  time.Time
+	RotatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type encryptionKey struct {
+	id  string
+	gcm cipher.AEAD
+}
+
+func parseKey(encoded string) (*encryptionKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.WithMessage(err, "decoding key")
+	}
+
+	if len(raw) != 32 {
+		return nil, errors.New("key has to be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// the id tells which key a value was encrypted with, without revealing the key
+	h := sha256.Sum256(raw)
+	return &encryptionKey{id: hex.EncodeToString(h[:4]), gcm: gcm}, nil
+}
+
+func currentKey() (*encryptionKey, error) {
+	if confKey.GetString() == "" {
+		return nil, ErrDisabled
+	}
+
+	return parseKey(confKey.GetString())
+}
+
+func keyByID(id string) (*encryptionKey, error) {
+	for _, v := range []string{confKey.GetString(), confPreviousKey.GetString()} {
+		if v == "" {
+			continue
+		}
+
+		k, err := parseKey(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.id == id {
+			return k, nil
+		}
+	}
+
+	return nil, errors.New("secret was encrypted with a unknown key")
+}
+
+// Enabled returns true if the vault is configured
+func Enabled() bool {
+	_, err := currentKey()
+	return err == nil
+}
+
+// additionalData binds the ciphertext to the guild and name, so it can't be copied to another secret
+func additionalData(guildID int64, name string) []byte {
+	return []byte(strconv.FormatInt(guildID, 10) + ":" + name)
+}
+
+func (k *encryptionKey) encrypt(guildID int64, name, value string) ([]byte, error) {
+	nonce := make([]byte, k.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return k.gcm.Seal(nonce, nonce, []byte(value), additionalData(guildID, name)), nil
+}
+
+func (k *encryptionKey) decrypt(guildID int64, name string, ciphertext []byte) (string, error) {
+	if len(ciphertext) < k.gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	nonce := ciphertext[:k.gcm.NonceSize()]
+	plain, err := k.gcm.Open(nil, nonce, ciphertext[k.gcm.NonceSize():], additionalData(guildID, name))
+	if err != nil {
+		return "", errors.WithMessage(err, "decrypting secret")
+	}
+
+	return string(plain), nil
+}
+
+// Set stores the value of the secret, rotating it if it already exists. Returns true if it was rotated.
+func Set(ctx context.Context, guildID int64, name, value string) (rotated bool, err error) {
+	if !ValidName(name) {
+		return false, ErrInvalidName
+	}
+
+	k, err := currentKey()
+	if err != nil {
+		return false, err
+	}
+
+	ciphertext, err := k.encrypt(guildID, name, value)
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	err = common.PQ.QueryRowContext(ctx, "SELECT count(*) FROM guild_secrets WHERE guild_id = $1 AND name != $2", guildID, name).Scan(&count)
+	if err != nil {
+		return false, errors.WithStackIf(err)
+	}
+
+	if count >= MaxSecretsPerGuild {
+		return false, ErrTooMany
+	}
+
+	var version int
+	err = common.PQ.QueryRowContext(ctx, `INSERT INTO guild_secrets (guild_id, name, ciphertext, key_id, version, created_at, rotated_at)
+VALUES ($1, $2, $3, $4, 1, now(), now())
+ON CONFLICT (guild_id, name) DO UPDATE SET ciphertext = EXCLUDED.ciphertext, key_id = EXCLUDED.key_id, version = guild_secrets.version + 1, rotated_at = now()
+RETURNING version`, guildID, name, ciphertext, k.id).Scan(&version)
+	if err != nil {
+		return false, errors.WithStackIf(err)
+	}
+
+	return version > 1, nil
+}
+
+// Get returns the value of the secret, for use by integrations only
+func Get(ctx context.Context, guildID int64, name string) (string, error) {
+	var ciphertext []byte
+	var keyID string
+	err := common.PQ.QueryRowContext(ctx, "SELECT ciphertext, key_id FROM guild_secrets WHERE guild_id = $1 AND name = $2", guildID, name).Scan(&ciphertext, &keyID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", errors.WithStackIf(err)
+	}
+
+	k, err := keyByID(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := k.decrypt(guildID, name, ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = common.PQ.ExecContext(ctx, "UPDATE guild_secrets SET last_used_at = now() WHERE guild_id = $1 AND name = $2", guildID, name)
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed updating secret last used")
+	}
+
+	if current, err := currentKey(); err == nil && current.id != keyID {
+		// encrypted with the previous key, move it over to the current one
+		reencryptSecret(ctx, current, guildID, name, keyID, value)
+	}
+
+	return value, nil
+}
+
+func reencryptSecret(ctx context.Context, k *encryptionKey, guildID int64, name, oldKeyID, value string) {
+	ciphertext, err := k.encrypt(guildID, name, value)
+	if err == nil {
+		_, err = common.PQ.ExecContext(ctx, "UPDATE guild_secrets SET ciphertext = $3, key_id = $4 WHERE guild_id = $1 AND name = $2 AND key_id = $5",
+			guildID, name, ciphertext, k.id, oldKeyID)
+	}
+
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed re-encrypting secret with the current key")
+	}
+}
+
+// List returns the secrets of the guild, without their values
+func List(ctx context.Context, guildID int64) ([]*Secret, error) {
+	rows, err := common.PQ.QueryContext(ctx, "SELECT name, version, created_at, rotated_at, last_used_at FROM guild_secrets WHERE guild_id = $1 ORDER BY name", guildID)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+	defer rows.Close()
+
+	var result []*Secret
+	for rows.Next() {
+		s := &Secret{GuildID: guildID}
+		err = rows.Scan(&s.Name, &s.Version, &s.CreatedAt, &s.RotatedAt, &s.LastUsedAt)
+		if err != nil {
+			return nil, errors.WithStackIf(err)
+		}
+
+		result = append(result, s)
+	}
+
+	return result, errors.WithStackIf(rows.Err())
+}
+
+// Delete removes the secret, returning ErrNotFound if it didn't exist
+func Delete(ctx context.Context, guildID int64, name string) error {
+	res, err := common.PQ.ExecContext(ctx, "DELETE FROM guild_secrets WHERE guild_id = $1 AND name = $2", guildID, name)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	if n, _ := res.RowsAffected(); n < 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
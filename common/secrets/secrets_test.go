@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func testKey(t *testing.T, b byte) *encryptionKey {
+	k, err := parseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := testKey(t, 1)
+
+	ciphertext, err := k.encrypt(1, "webhook", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(ciphertext, []byte("hunter2")) {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+
+	value, err := k.decrypt(1, "webhook", ciphertext)
+	if err != nil || value != "hunter2" {
+		t.Fatalf("decrypt returned %q, %v", value, err)
+	}
+
+	// bound to the guild and name
+	if _, err := k.decrypt(2, "webhook", ciphertext); err == nil {
+		t.Error("decrypted a secret of another guild")
+	}
+
+	if _, err := k.decrypt(1, "other", ciphertext); err == nil {
+		t.Error("decrypted a secret under another name")
+	}
+
+	if _, err := testKey(t, 2).decrypt(1, "webhook", ciphertext); err == nil {
+		t.Error("decrypted with the wrong key")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := parseKey(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("accepted a short key")
+	}
+
+	if _, err := parseKey("not base64!"); err == nil {
+		t.Error("accepted invalid base64")
+	}
+
+	if testKey(t, 1).id == testKey(t, 2).id {
+		t.Error("different keys have the same id")
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"twitch_api_key":                    true,
+		"a1":                                true,
+		"":                                  false,
+		"Upper":                             false,
+		"with space":                        false,
+		"waytoolongnamewaytoolongnamewayto": false,
+	} {
+		if ValidName(name) != expected {
+			t.Errorf("ValidName(%q) != %v", name, expected)
+		}
+	}
+}
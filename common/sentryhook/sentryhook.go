@@ -7,6 +7,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ReportedField marks log entries whose error was already sent to sentry with more context, e.g by the webserver
+const ReportedField = "sentry_reported"
+
 type Hook struct{}
 
 func (hook Hook) Levels() []logrus.Level {
@@ -18,6 +21,10 @@ func (hook Hook) Levels() []logrus.Level {
 }
 
 func (hook Hook) Fire(entry *logrus.Entry) error {
+	if _, ok := entry.Data[ReportedField]; ok {
+		return nil
+	}
+
 	hub := sentry.CurrentHub().Clone()
 	if hub == nil {
 		return nil
@@ -0,0 +1,55 @@
+package sentryhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+)
+
+type testTransport struct {
+	events []*sentry.Event
+}
+
+func (t *testTransport) Flush(timeout time.Duration) bool       { return true }
+func (t *testTransport) Configure(options sentry.ClientOptions) {}
+func (t *testTransport) SendEvent(event *sentry.Event)          { t.events = append(t.events, event) }
+
+func TestHookSkipsReported(t *testing.T) {
+	transport := &testTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Dsn: "https://key@sentry.example.com/1", Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := sentry.CurrentHub()
+	defer hub.BindClient(hub.Client())
+	hub.BindClient(client)
+
+	entry := logrus.WithError(errors.New("failed")).WithField("guild", 10)
+
+	cases := []struct {
+		entry  *logrus.Entry
+		events int
+	}{
+		{entry, 1},
+		{entry.WithField(ReportedField, true), 0},
+		// public errors are marked so they're not reported at all
+		{entry.WithField(ReportedField, false), 0},
+	}
+
+	for i, c := range cases {
+		transport.events = nil
+		if err := (Hook{}).Fire(c.entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(transport.events) != c.events {
+			t.Errorf("case %d: expected %d events, got %d", i, c.events, len(transport.events))
+		} else if c.events > 0 && transport.events[0].Extra["guild_id"] != "10" {
+			t.Errorf("case %d: expected the guild on the event, got %v", i, transport.events[0].Extra)
+		}
+	}
+}
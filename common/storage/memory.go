@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryValue struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+func (v *memoryValue) expired(now time.Time) bool {
+	return !v.expiresAt.IsZero() && !now.Before(v.expiresAt)
+}
+
+// Memory is a in-memory Driver, intended for unit tests and running without external services
+type Memory struct {
+	mu sync.Mutex
+
+	values  map[string]*memoryValue
+	zsets   map[string]map[string]float64
+	streams map[string][]StreamEntry
+
+	lastStreamMS  int64
+	lastStreamSeq int64
+
+	// Now can be overridden in tests
+	Now func() time.Time
+}
+
+var _ Driver = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		values:  make(map[string]*memoryValue),
+		zsets:   make(map[string]map[string]float64),
+		streams: make(map[string][]StreamEntry),
+		Now:     time.Now,
+	}
+}
+
+func (m *Memory) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return m.Now().Add(ttl)
+}
+
+// getLocked returns the value if it exists and is not expired, mu has to be held
+func (m *Memory) getLocked(key string) *memoryValue {
+	v, ok := m.values[key]
+	if !ok {
+		return nil
+	}
+
+	if v.expired(m.Now()) {
+		delete(m.values, key)
+		return nil
+	}
+
+	return v
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.getLocked(key)
+	if v == nil {
+		return nil, ErrNotFound
+	}
+
+	cop := make([]byte, len(v.data))
+	copy(cop, v.data)
+	return cop, nil
+}
+
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cop := make([]byte, len(value))
+	copy(cop, value)
+
+	m.values[key] = &memoryValue{data: cop, expiresAt: m.expiry(ttl)}
+	return nil
+}
+
+func (m *Memory) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.getLocked(key) != nil {
+		return false, nil
+	}
+
+	cop := make([]byte, len(value))
+	copy(cop, value)
+
+	m.values[key] = &memoryValue{data: cop, expiresAt: m.expiry(ttl)}
+	return true, nil
+}
+
+func (m *Memory) Del(keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range keys {
+		delete(m.values, k)
+		delete(m.zsets, k)
+		delete(m.streams, k)
+	}
+
+	return nil
+}
+
+func (m *Memory) Expire(key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.getLocked(key)
+	if v == nil {
+		return false, nil
+	}
+
+	v.expiresAt = m.expiry(ttl)
+	return true, nil
+}
+
+func (m *Memory) IncrBy(key string, by int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := int64(0)
+	var expiresAt time.Time
+	if v := m.getLocked(key); v != nil {
+		parsed, err := strconv.ParseInt(string(v.data), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		current = parsed
+		expiresAt = v.expiresAt
+	}
+
+	current += by
+	m.values[key] = &memoryValue{data: []byte(strconv.FormatInt(current, 10)), expiresAt: expiresAt}
+	return current, nil
+}
+
+func (m *Memory) ZAdd(key string, score float64, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set, ok := m.zsets[key]
+	if !ok {
+		set = make(map[string]float64)
+		m.zsets[key] = set
+	}
+
+	set[member] = score
+	return nil
+}
+
+func (m *Memory) ZRem(key string, members ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set, ok := m.zsets[key]
+	if !ok {
+		return nil
+	}
+
+	for _, v := range members {
+		delete(set, v)
+	}
+
+	if len(set) == 0 {
+		delete(m.zsets, key)
+	}
+
+	return nil
+}
+
+func (m *Memory) ZRangeByScore(key string, min, max float64) ([]ScoredMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]ScoredMember, 0)
+	for member, score := range m.zsets[key] {
+		if score >= min && score <= max {
+			result = append(result, ScoredMember{Member: member, Score: score})
+		}
+	}
+
+	// same ordering as redis, by score then lexicographically
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score == result[j].Score {
+			return result[i].Member < result[j].Member
+		}
+
+		return result[i].Score < result[j].Score
+	})
+
+	return result, nil
+}
+
+func (m *Memory) ZCard(key string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.zsets[key]), nil
+}
+
+func (m *Memory) XAdd(stream string, fields map[string]string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// ids follow the redis format of <unix ms>-<sequence>
+	ms := m.Now().UnixNano() / int64(time.Millisecond)
+	if ms <= m.lastStreamMS {
+		ms = m.lastStreamMS
+		m.lastStreamSeq++
+	} else {
+		m.lastStreamMS = ms
+		m.lastStreamSeq = 0
+	}
+
+	cop := make(map[string]string, len(fields))
+	for k, v := range fields {
+		cop[k] = v
+	}
+
+	id := strconv.FormatInt(ms, 10) + "-" + strconv.FormatInt(m.lastStreamSeq, 10)
+	m.streams[stream] = append(m.streams[stream], StreamEntry{ID: id, Fields: cop})
+	return id, nil
+}
+
+func (m *Memory) XRange(stream string, after string, count int) ([]StreamEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]StreamEntry, 0)
+	for _, v := range m.streams[stream] {
+		if after != "" && after != "0" && compareStreamIDs(v.ID, after) <= 0 {
+			continue
+		}
+
+		result = append(result, v)
+		if count > 0 && len(result) >= count {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (m *Memory) XDel(stream string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.streams[stream]
+	filtered := entries[:0]
+	for _, v := range entries {
+		keep := true
+		for _, id := range ids {
+			if v.ID == id {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			filtered = append(filtered, v)
+		}
+	}
+
+	m.streams[stream] = filtered
+	return nil
+}
+
+func (m *Memory) XTrim(stream string, maxLen int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.streams[stream]
+	if len(entries) > maxLen {
+		m.streams[stream] = append([]StreamEntry(nil), entries[len(entries)-maxLen:]...)
+	}
+
+	return nil
+}
+
+// compareStreamIDs compares 2 stream ids in the <ms>-<seq> format
+func compareStreamIDs(a, b string) int {
+	aMS, aSeq := splitStreamID(a)
+	bMS, bSeq := splitStreamID(b)
+
+	switch {
+	case aMS < bMS:
+		return -1
+	case aMS > bMS:
+		return 1
+	case aSeq < bSeq:
+		return -1
+	case aSeq > bSeq:
+		return 1
+	}
+
+	return 0
+}
+
+func splitStreamID(id string) (int64, int64) {
+	split := strings.SplitN(id, "-", 2)
+	ms, _ := strconv.ParseInt(split[0], 10, 64)
+	if len(split) < 2 {
+		return ms, 0
+	}
+
+	seq, _ := strconv.ParseInt(split[1], 10, 64)
+	return ms, seq
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryKV(t *testing.T) {
+	now := time.Now()
+	m := NewMemory()
+	m.Now = func() time.Time { return now }
+
+	if _, err := m.Get("a"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	m.Set("a", []byte("hello"), time.Minute)
+	if v, err := m.Get("a"); err != nil || string(v) != "hello" {
+		t.Fatalf("unexpected get result: %q, %v", v, err)
+	}
+
+	if set, _ := m.SetNX("a", []byte("other"), 0); set {
+		t.Fatal("SetNX overwrote existing key")
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := m.Get("a"); err != ErrNotFound {
+		t.Fatalf("expected key to be expired, got %v", err)
+	}
+
+	if set, _ := m.SetNX("a", []byte("other"), 0); !set {
+		t.Fatal("SetNX did not set expired key")
+	}
+
+	n, err := m.IncrBy("counter", 5)
+	if err != nil || n != 5 {
+		t.Fatalf("unexpected incr result: %d, %v", n, err)
+	}
+
+	n, _ = m.IncrBy("counter", -2)
+	if n != 3 {
+		t.Fatalf("expected 3, got %d", n)
+	}
+
+	if ok, _ := m.Expire("missing", time.Minute); ok {
+		t.Fatal("expire returned true for a missing key")
+	}
+}
+
+func TestMemorySortedSets(t *testing.T) {
+	m := NewMemory()
+	m.ZAdd("z", 3, "c")
+	m.ZAdd("z", 1, "a")
+	m.ZAdd("z", 2, "b")
+	m.ZAdd("z", 10, "d")
+
+	result, _ := m.ZRangeByScore("z", 0, 5)
+	if len(result) != 3 || result[0].Member != "a" || result[2].Member != "c" {
+		t.Fatalf("unexpected range result: %v", result)
+	}
+
+	m.ZRem("z", "a", "d")
+	if n, _ := m.ZCard("z"); n != 2 {
+		t.Fatalf("expected 2 members, got %d", n)
+	}
+}
+
+func TestMemoryStreams(t *testing.T) {
+	now := time.Now()
+	m := NewMemory()
+	m.Now = func() time.Time { return now }
+
+	first, _ := m.XAdd("s", map[string]string{"n": "1"})
+	second, _ := m.XAdd("s", map[string]string{"n": "2"})
+	if compareStreamIDs(first, second) >= 0 {
+		t.Fatalf("ids not increasing: %s, %s", first, second)
+	}
+
+	now = now.Add(time.Second)
+	m.XAdd("s", map[string]string{"n": "3"})
+
+	entries, _ := m.XRange("s", first, 0)
+	if len(entries) != 2 || entries[0].Fields["n"] != "2" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+
+	entries, _ = m.XRange("s", "", 1)
+	if len(entries) != 1 || entries[0].ID != first {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+
+	m.XTrim("s", 1)
+	entries, _ = m.XRange("s", "0", 0)
+	if len(entries) != 1 || entries[0].Fields["n"] != "3" {
+		t.Fatalf("unexpected entries after trim: %v", entries)
+	}
+}
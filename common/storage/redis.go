@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// Redis is a Driver backed by redis
+type Redis struct {
+	client radix.Client
+}
+
+var _ Driver = (*Redis)(nil)
+
+func NewRedis(client radix.Client) *Redis {
+	return &Redis{
+		client: client,
+	}
+}
+
+func ttlArgs(args []string, ttl time.Duration) []string {
+	if ttl <= 0 {
+		return args
+	}
+
+	return append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+}
+
+func (r *Redis) Get(key string) ([]byte, error) {
+	var data []byte
+	mn := radix.MaybeNil{Rcv: &data}
+	err := r.client.Do(radix.Cmd(&mn, "GET", key))
+	if err != nil {
+		return nil, err
+	}
+
+	if mn.Nil {
+		return nil, ErrNotFound
+	}
+
+	return data, nil
+}
+
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	return r.client.Do(radix.Cmd(nil, "SET", ttlArgs([]string{key, string(value)}, ttl)...))
+}
+
+func (r *Redis) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	var resp string
+	mn := radix.MaybeNil{Rcv: &resp}
+	err := r.client.Do(radix.Cmd(&mn, "SET", ttlArgs([]string{key, string(value), "NX"}, ttl)...))
+	if err != nil {
+		return false, err
+	}
+
+	return !mn.Nil, nil
+}
+
+func (r *Redis) Del(keys ...string) error {
+	if len(keys) < 1 {
+		return nil
+	}
+
+	return r.client.Do(radix.Cmd(nil, "DEL", keys...))
+}
+
+func (r *Redis) Expire(key string, ttl time.Duration) (bool, error) {
+	var set bool
+	var err error
+	if ttl <= 0 {
+		err = r.client.Do(radix.Cmd(&set, "PERSIST", key))
+		if err == nil && !set {
+			// PERSIST also returns 0 for keys without a ttl, so check if it exists
+			err = r.client.Do(radix.Cmd(&set, "EXISTS", key))
+		}
+	} else {
+		err = r.client.Do(radix.FlatCmd(&set, "PEXPIRE", key, int64(ttl/time.Millisecond)))
+	}
+
+	return set, err
+}
+
+func (r *Redis) IncrBy(key string, by int64) (int64, error) {
+	var result int64
+	err := r.client.Do(radix.FlatCmd(&result, "INCRBY", key, by))
+	return result, err
+}
+
+func (r *Redis) ZAdd(key string, score float64, member string) error {
+	return r.client.Do(radix.FlatCmd(nil, "ZADD", key, score, member))
+}
+
+func (r *Redis) ZRem(key string, members ...string) error {
+	if len(members) < 1 {
+		return nil
+	}
+
+	return r.client.Do(radix.Cmd(nil, "ZREM", append([]string{key}, members...)...))
+}
+
+func (r *Redis) ZRangeByScore(key string, min, max float64) ([]ScoredMember, error) {
+	var flat []string
+	err := r.client.Do(radix.FlatCmd(&flat, "ZRANGEBYSCORE", key, min, max, "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ScoredMember, 0, len(flat)/2)
+	for i := 0; i+1 < len(flat); i += 2 {
+		score, err := strconv.ParseFloat(flat[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, ScoredMember{Member: flat[i], Score: score})
+	}
+
+	return result, nil
+}
+
+func (r *Redis) ZCard(key string) (int, error) {
+	var n int
+	err := r.client.Do(radix.Cmd(&n, "ZCARD", key))
+	return n, err
+}
+
+func (r *Redis) XAdd(stream string, fields map[string]string) (string, error) {
+	var id string
+	err := r.client.Do(radix.FlatCmd(&id, "XADD", stream, "*", fields))
+	return id, err
+}
+
+func (r *Redis) XRange(stream string, after string, count int) ([]StreamEntry, error) {
+	start := "-"
+	if after != "" && after != "0" {
+		// XRANGE is inclusive, so start from the id right after
+		ms, seq := splitStreamID(after)
+		start = strconv.FormatInt(ms, 10) + "-" + strconv.FormatInt(seq+1, 10)
+	}
+
+	args := []string{stream, start, "+"}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(count))
+	}
+
+	var entries []radix.StreamEntry
+	err := r.client.Do(radix.Cmd(&entries, "XRANGE", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]StreamEntry, 0, len(entries))
+	for _, v := range entries {
+		result = append(result, StreamEntry{ID: v.ID.String(), Fields: v.Fields})
+	}
+
+	return result, nil
+}
+
+func (r *Redis) XDel(stream string, ids ...string) error {
+	if len(ids) < 1 {
+		return nil
+	}
+
+	return r.client.Do(radix.Cmd(nil, "XDEL", append([]string{stream}, ids...)...))
+}
+
+func (r *Redis) XTrim(stream string, maxLen int) error {
+	return r.client.Do(radix.FlatCmd(nil, "XTRIM", stream, "MAXLEN", maxLen))
+}
@@ -0,0 +1,75 @@
+// Package storage defines the storage primitives used across yagpdb (key values, sorted sets and streams)
+// behind interfaces, so that things can run against redis in production and in memory in unit tests and dev mode.
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by KV.Get when the key does not exist
+var ErrNotFound = errors.New("storage: key not found")
+
+// KV is a simple key value store with optional expiry
+type KV interface {
+	// Get returns ErrNotFound if the key does not exist
+	Get(key string) ([]byte, error)
+
+	// Set sets the value, a ttl of 0 means it never expires
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// SetNX only sets the value if the key does not exist, returning true if it was set
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+
+	Del(keys ...string) error
+
+	// Expire updates the ttl of the key, returning false if the key does not exist
+	Expire(key string, ttl time.Duration) (bool, error)
+
+	// IncrBy increments the integer stored at key, treating missing keys as 0
+	IncrBy(key string, by int64) (int64, error)
+}
+
+// ScoredMember is a member of a sorted set
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// SortedSets is a subset of the redis sorted set commands, used by the scheduler and queues
+type SortedSets interface {
+	ZAdd(key string, score float64, member string) error
+	ZRem(key string, members ...string) error
+
+	// ZRangeByScore returns the members with min <= score <= max, lowest score first
+	ZRangeByScore(key string, min, max float64) ([]ScoredMember, error)
+
+	ZCard(key string) (int, error)
+}
+
+// StreamEntry is a single entry in a stream
+type StreamEntry struct {
+	ID     string
+	Fields map[string]string
+}
+
+// Streams is a subset of the redis stream commands, used by job queues
+type Streams interface {
+	// XAdd appends a entry to the stream, returning the id of it
+	XAdd(stream string, fields map[string]string) (string, error)
+
+	// XRange returns up to count entries with a id greater than after, use "" or "0" to read from the start
+	XRange(stream string, after string, count int) ([]StreamEntry, error)
+
+	XDel(stream string, ids ...string) error
+
+	// XTrim drops the oldest entries until the stream has atmost maxLen entries
+	XTrim(stream string, maxLen int) error
+}
+
+// Driver provides all the storage primitives
+type Driver interface {
+	KV
+	SortedSets
+	Streams
+}
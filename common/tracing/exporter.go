@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	logger = logrus.WithField("p", "tracing")
+
+	metricsSpans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_tracing_spans_total",
+		Help: "Spans exported to the otlp endpoint, result is either sent, dropped (the queue was full) or failed",
+	}, []string{"result"})
+)
+
+const (
+	spanQueueSize  = 4096
+	spanMaxBatch   = 512
+	spanBatchDelay = time.Second * 5
+)
+
+var spanQueue = make(chan *Span, spanQueueSize)
+
+func queueSpan(s *Span) {
+	select {
+	case spanQueue <- s:
+	default:
+		metricsSpans.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run exports the recorded spans in batches until the process exits, does nothing if tracing is disabled
+func Run(nodeID string) {
+	endpoint := confOTLPEndpoint.GetString()
+	if endpoint == "" {
+		return
+	}
+
+	exp, err := newExporter(endpoint)
+	if err != nil {
+		logger.WithError(err).Error("Failed setting up the otlp exporter, not exporting traces")
+		return
+	}
+
+	res := newResource(confServiceName.GetString(), nodeID)
+	logger.Infof("Exporting traces to %s", endpoint)
+
+	ticker := time.NewTicker(spanBatchDelay)
+	var batch []*Span
+	for {
+		select {
+		case s := <-spanQueue:
+			batch = append(batch, s)
+			if len(batch) < spanMaxBatch {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) < 1 {
+				continue
+			}
+		}
+
+		err := exp.ExportSpans(context.Background(), readOnlySpans(res, batch))
+		if err != nil {
+			logger.WithError(err).Errorf("Failed exporting %d spans", len(batch))
+			metricsSpans.WithLabelValues("failed").Add(float64(len(batch)))
+		} else {
+			metricsSpans.WithLabelValues("sent").Add(float64(len(batch)))
+		}
+
+		batch = nil
+	}
+}
+
+// newExporter creates the OTLP/http exporter for the endpoint, the spans are sent to its /v1/traces path
+func newExporter(endpoint string) (*otlptrace.Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host in the otlp endpoint %q", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+		otlptracehttp.WithTimeout(time.Second * 10),
+		// a failed batch is dropped, retrying would hold up the spans queued behind it
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}),
+	}
+
+	if u.Scheme != "https" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
+func newResource(serviceName, nodeID string) *resource.Resource {
+	attrs := []attribute.KeyValue{attribute.String("service.name", serviceName)}
+	if hostname, err := os.Hostname(); err == nil {
+		attrs = append(attrs, attribute.String("host.name", hostname))
+	}
+
+	if nodeID != "" {
+		attrs = append(attrs, attribute.String("service.instance.id", nodeID))
+	}
+
+	return resource.NewSchemaless(attrs...)
+}
+
+func newAttribute(key string, value interface{}) attribute.KeyValue {
+	switch t := value.(type) {
+	case bool:
+		return attribute.Bool(key, t)
+	case int:
+		return attribute.Int(key, t)
+	case int64:
+		return attribute.Int64(key, t)
+	case string:
+		return attribute.String(key, t)
+	default:
+		return attribute.String(key, fmt.Sprint(t))
+	}
+}
+
+// readOnlySpans converts the spans to the read only spans the otel exporters take, the sdk only lets them be
+// created outside of its tracer through the span stubs of tracetest
+func readOnlySpans(res *resource.Resource, spans []*Span) []sdktrace.ReadOnlySpan {
+	stubs := make(tracetest.SpanStubs, 0, len(spans))
+	for _, s := range spans {
+		stub := tracetest.SpanStub{
+			Name:                   s.Name,
+			SpanContext:            spanContext(s.TraceID, s.ID),
+			SpanKind:               trace.SpanKind(s.Kind),
+			StartTime:              s.StartTime,
+			EndTime:                s.EndTime,
+			Resource:               res,
+			InstrumentationLibrary: instrumentation.Library{Name: "github.com/botlabs-gg/yagpdb/v2/common/tracing"},
+		}
+
+		if s.ParentID != (SpanID{}) {
+			stub.Parent = spanContext(s.TraceID, s.ParentID)
+		}
+
+		s.mu.Lock()
+		for k, v := range s.attributes {
+			stub.Attributes = append(stub.Attributes, newAttribute(k, v))
+		}
+
+		if s.err != "" {
+			stub.Status = sdktrace.Status{Code: codes.Error, Description: s.err}
+		}
+		s.mu.Unlock()
+
+		stubs = append(stubs, stub)
+	}
+
+	return stubs.Snapshots()
+}
+
+func spanContext(traceID TraceID, spanID SpanID) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID(traceID),
+		SpanID:     trace.SpanID(spanID),
+		TraceFlags: trace.FlagsSampled,
+	})
+}
@@ -0,0 +1,206 @@
+// Package tracing records spans of the work done while handling requests and exports them with the OpenTelemetry
+// OTLP/http exporter to a collector or Jaeger, so slow control panel loads can be broken down into time spent in
+// redis, botrest, the discord api and rendering.
+//
+// Spans are only recorded if yagpdb.tracing.otlp_endpoint is set, all the span methods are no-ops on a nil span.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+var (
+	confOTLPEndpoint = config.RegisterOption("yagpdb.tracing.otlp_endpoint", "OTLP/http endpoint spans are exported to, for example http://localhost:4318 for a collector or jaeger. Empty to disable tracing", "")
+	confServiceName  = config.RegisterOption("yagpdb.tracing.service_name", "Service name the spans of this process are reported under", "yagpdb")
+	confSamplePct    = config.RegisterOption("yagpdb.tracing.sample_percent", "Percentage of traces started in this process that are recorded, traces started elsewhere follow the decision of the caller", 100)
+)
+
+// Span kinds, matching the OTLP values
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+// Span is a single timed operation within a trace
+type Span struct {
+	TraceID   TraceID
+	ID        SpanID
+	ParentID  SpanID
+	Name      string
+	Kind      int
+	StartTime time.Time
+	EndTime   time.Time
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	err        string
+	ended      bool
+
+	parent *Span
+}
+
+type ctxKey int
+
+const ctxKeySpan ctxKey = iota
+
+// Enabled returns true if spans are being recorded in this process
+func Enabled() bool {
+	return confOTLPEndpoint.GetString() != ""
+}
+
+// SpanFromContext returns the current span in ctx, nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(ctxKeySpan).(*Span)
+	return s
+}
+
+// ContextWithSpan returns a copy of ctx with s as the current span
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, ctxKeySpan, s)
+}
+
+// StartSpan starts a span as a child of the current span in ctx, or a new trace if there is none.
+// The returned context has the new span as the current one, End has to be called on it when done.
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	parent := SpanFromContext(ctx)
+	s := &Span{
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+	}
+
+	if parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.ID
+		s.parent = parent
+	} else {
+		if mrand.Intn(100) >= confSamplePct.GetInt() {
+			return ctx, nil
+		}
+
+		rand.Read(s.TraceID[:])
+	}
+
+	rand.Read(s.ID[:])
+	return ContextWithSpan(ctx, s), s
+}
+
+// SetAttribute attaches a string, bool, int or int64 attribute to the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed, nil errors are ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// Parent returns the span this span is a child of within this process
+func (s *Span) Parent() *Span {
+	if s == nil {
+		return nil
+	}
+
+	return s.parent
+}
+
+// End ends the span and queues it for export, only the first call has any effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	queueSpan(s)
+}
+
+// TraceParentHeader is the W3C trace context header used to continue traces across processes
+const TraceParentHeader = "traceparent"
+
+// Inject sets the traceparent header for the current span in ctx, so the receiver can continue the trace
+func Inject(ctx context.Context, h http.Header) {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return
+	}
+
+	h.Set(TraceParentHeader, "00-"+hex.EncodeToString(s.TraceID[:])+"-"+hex.EncodeToString(s.ID[:])+"-01")
+}
+
+// Extract returns a copy of ctx with the remote span from the traceparent header as the current span,
+// spans started from it are part of the caller's trace
+func Extract(ctx context.Context, h http.Header) context.Context {
+	if !Enabled() {
+		return ctx
+	}
+
+	traceID, spanID, ok := parseTraceParent(h.Get(TraceParentHeader))
+	if !ok {
+		return ctx
+	}
+
+	return ContextWithSpan(ctx, &Span{TraceID: traceID, ID: spanID, ended: true})
+}
+
+// parseTraceParent parses a "version-traceid-spanid-flags" header, only sampled traces are continued
+func parseTraceParent(header string) (traceID TraceID, spanID SpanID, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || flags[0]&1 == 0 {
+		return
+	}
+
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == (TraceID{}) {
+		return
+	}
+
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || spanID == (SpanID{}) {
+		return
+	}
+
+	return traceID, spanID, true
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	traceID, spanID, ok := parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok {
+		t.Fatal("expected valid traceparent to be parsed")
+	}
+
+	if hex.EncodeToString(traceID[:]) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(spanID[:]) != "00f067aa0ba902b7" {
+		t.Errorf("parsed wrong ids: %x %x", traceID, spanID)
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+
+	for _, v := range invalid {
+		if _, _, ok := parseTraceParent(v); ok {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestNilSpan(t *testing.T) {
+	var s *Span
+	s.SetAttribute("a", 1)
+	s.SetError(errors.New("err"))
+	s.End()
+
+	if s.Parent() != nil {
+		t.Error("expected nil parent")
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	parent := &Span{Name: "parent"}
+	parent.TraceID[0] = 1
+	parent.ID[0] = 2
+
+	h := http.Header{}
+	Inject(ContextWithSpan(context.Background(), parent), h)
+
+	traceID, spanID, ok := parseTraceParent(h.Get(TraceParentHeader))
+	if !ok || traceID != parent.TraceID || spanID != parent.ID {
+		t.Errorf("injected header %q doesn't match the span", h.Get(TraceParentHeader))
+	}
+}
+
+func TestReadOnlySpans(t *testing.T) {
+	s := &Span{Name: "render index", Kind: KindInternal, StartTime: time.Unix(1, 0), EndTime: time.Unix(2, 0)}
+	s.TraceID[15] = 1
+	s.ID[7] = 2
+	s.ParentID[7] = 3
+	s.SetAttribute("http.status_code", 500)
+	s.SetError(errors.New("boom"))
+
+	o := readOnlySpans(newResource("yagpdb", "1"), []*Span{s})[0]
+
+	if o.SpanContext().TraceID().String() != "00000000000000000000000000000001" || o.SpanContext().SpanID().String() != "0000000000000002" || o.Parent().SpanID().String() != "0000000000000003" {
+		t.Errorf("wrong ids: %s %s %s", o.SpanContext().TraceID(), o.SpanContext().SpanID(), o.Parent().SpanID())
+	}
+
+	if o.SpanKind() != trace.SpanKindInternal || !o.StartTime().Equal(time.Unix(1, 0)) || !o.EndTime().Equal(time.Unix(2, 0)) {
+		t.Errorf("wrong kind or times: %s %s %s", o.SpanKind(), o.StartTime(), o.EndTime())
+	}
+
+	if attrs := o.Attributes(); len(attrs) != 1 || attrs[0].Value.AsInt64() != 500 {
+		t.Errorf("wrong attributes: %v", attrs)
+	}
+
+	if o.Status().Code != codes.Error || o.Status().Description != "boom" {
+		t.Errorf("expected error status, got %v", o.Status())
+	}
+}
+
+func TestExporter(t *testing.T) {
+	var path, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+
+	exp, err := newExporter(srv.URL + "/otlp/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Span{Name: "redis GET", Kind: KindClient, StartTime: time.Unix(1, 0), EndTime: time.Unix(2, 0)}
+	s.TraceID[15] = 1
+	s.ID[7] = 2
+
+	if err := exp.ExportSpans(context.Background(), readOnlySpans(newResource("yagpdb", ""), []*Span{s})); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/otlp/v1/traces" || contentType != "application/x-protobuf" {
+		t.Errorf("unexpected export to %q as %q", path, contentType)
+	}
+
+	if _, err := newExporter("localhost:4318"); err == nil {
+		t.Error("expected an endpoint without a scheme to be rejected")
+	}
+}
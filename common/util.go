@@ -315,6 +315,8 @@ var StringPerms = map[int64]string{
 	discordgo.PermissionManageServer:        "Manage Server",
 	discordgo.PermissionManageWebhooks:      "Manage Webhooks",
 	discordgo.PermissionModerateMembers:     "Moderate Members / Timeout Members",
+
+	discordgo.PermissionManageEmojisAndStickers: "Manage Emojis And Stickers",
 }
 
 func ErrWithCaller(err error) error {
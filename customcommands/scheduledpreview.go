@@ -0,0 +1,51 @@
+package customcommands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/customcommands/models"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"github.com/volatiletech/null"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+)
+
+// max amount of runs of a single interval command listed, so a 5 minute interval doesn't fill the whole preview
+const maxPreviewRunsPerCommand = 50
+
+var _ web.PluginWithScheduledActions = (*Plugin)(nil)
+
+// ScheduledActions implements web.PluginWithScheduledActions, expanding the interval commands into their runs within the range
+func (p *Plugin) ScheduledActions(ctx context.Context, guildID int64, from, to time.Time) ([]*web.ScheduledAction, error) {
+	commands, err := models.CustomCommands(
+		qm.Where("guild_id = ? AND trigger_type = ? AND disabled = false AND next_run IS NOT NULL AND next_run < ?", guildID, int(CommandTriggerInterval), to),
+		qm.OrderBy("local_id asc")).AllG(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*web.ScheduledAction
+	for _, cc := range commands {
+		// work on a copy as the run times are computed from LastRun
+		sim := *cc
+		next := cc.NextRun.Time
+
+		for i := 0; i < maxPreviewRunsPerCommand && !next.IsZero() && next.Before(to); i++ {
+			if !next.Before(from) {
+				result = append(result, &web.ScheduledAction{
+					At:          next,
+					Plugin:      "Custom commands",
+					Description: fmt.Sprintf("Run interval custom command #%d", cc.LocalID),
+					Recurring:   true,
+					Link:        fmt.Sprintf("/customcommands/commands/%d/", cc.LocalID),
+				})
+			}
+
+			sim.LastRun = null.TimeFrom(next)
+			next = CalcNextRunTime(&sim, next)
+		}
+	}
+
+	return result, nil
+}
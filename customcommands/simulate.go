@@ -0,0 +1,63 @@
+package customcommands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	prfx "github.com/botlabs-gg/yagpdb/v2/common/prefix"
+	"github.com/botlabs-gg/yagpdb/v2/premium"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithEventSimulation = (*Plugin)(nil)
+
+// SimulateEvent implements web.PluginWithEventSimulation, listing the commands a message would trigger
+func (p *Plugin) SimulateEvent(ctx context.Context, evt *web.SimulatedEvent) ([]*web.SimulatedAction, error) {
+	if evt.Type != web.SimulatedEventMessage {
+		return nil, nil
+	}
+
+	cmds, err := BotCachedGetCommandsWithMessageTriggers(evt.GS.ID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := prfx.GetPrefixIgnoreError(evt.GS.ID)
+
+	var matched []*TriggeredCC
+	for _, cmd := range cmds {
+		if !CmdRunsInChannel(cmd, common.ChannelOrThreadParentID(evt.Channel)) || !CmdRunsForUser(cmd, evt.Member) {
+			continue
+		}
+
+		if didMatch, _, _ := CheckMatch(prefix, cmd, evt.Message.Content); didMatch {
+			matched = append(matched, &TriggeredCC{CC: cmd})
+		}
+	}
+
+	sortTriggeredCCs(matched)
+
+	limit := CCMessageExecLimitNormal
+	if isPremium, _ := premium.IsGuildPremiumCached(evt.GS.ID); isPremium {
+		limit = CCMessageExecLimitPremium
+	}
+
+	var actions []*web.SimulatedAction
+	for i, v := range matched {
+		action := &web.SimulatedAction{
+			Plugin:      "Custom commands",
+			Description: fmt.Sprintf("Run custom command #%d", v.CC.LocalID),
+			Link:        fmt.Sprintf("/customcommands/commands/%d/", v.CC.LocalID),
+		}
+
+		if i >= limit {
+			action.Description = fmt.Sprintf("Custom command #%d matches but only %d can run per message", v.CC.LocalID, limit)
+			action.Skipped = true
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
@@ -7,3 +7,6 @@ var StaticFiles embed.FS
 
 //go:embed templates/*
 var CoreTemplates embed.FS
+
+//go:embed locales/*
+var Locales embed.FS
@@ -37,6 +37,9 @@ $(function () {
 
 	updateSelectedMenuItem(window.location.pathname);
 
+	if (typeof CURRENT_GUILDID !== "undefined" && window.WebSocket) {
+		yagConnectLiveUpdates(CURRENT_GUILDID, 5000);
+	}
 
 	// Update all dropdowns
 	// $(".btn-group .dropdown-menu").dropdownUpdate();
@@ -81,10 +84,11 @@ function navigate(url, method, data, updateHistory, maintainScroll, alertsOnly,
 	var req = new XMLHttpRequest();
 	req.addEventListener("load", function () {
 		currentlyLoading = false;
-		if (this.status !== 200 && this.status !== 400) {
+		// 400 and 413 (too large forms) come with alerts explaining what went wrong
+		if (this.status !== 200 && this.status !== 400 && this.status !== 413) {
 			window.location.href = '/';
 			return;
-		} else if (this.status === 400) {
+		} else if (this.status === 400 || this.status === 413) {
 			alertsOnly = true;
 		}
 
@@ -102,7 +106,7 @@ function navigate(url, method, data, updateHistory, maintainScroll, alertsOnly,
 			return
 		}
 
-		$("#main-content").html(this.responseText);
+		$("#main-content").html(withPageNonce(this));
 
 		initPlugins(true);
 		$(document.body).trigger('ready');
@@ -128,6 +132,7 @@ function navigate(url, method, data, updateHistory, maintainScroll, alertsOnly,
 
 	req.open(method, url);
 	req.setRequestHeader('Cache-Control', 'no-cache');
+	setCSRFHeader(req, method);
 
 	if (data) {
 		req.setRequestHeader("content-type", "application/x-www-form-urlencoded");
@@ -299,6 +304,30 @@ function addListeners() {
 		return false;
 	});
 
+	$(document).on("click", "#theme-toggle", function () {
+		toggleTheme();
+	});
+
+	$(document).on("click", "#unsaved-changes-save-button", function () {
+		saveUnsavedChanges();
+	});
+
+	// Forms on public pages can require a proof of work when there's a lot of bot traffic
+	$(document).on("submit", "form", function (e) {
+		var nonceInput = $(this).find('input[name="pow_nonce"]');
+		if (nonceInput.length < 1 || nonceInput.val() || !window.crypto || !window.crypto.subtle) {
+			return;
+		}
+
+		e.preventDefault();
+		var form = this;
+		var challenge = $(form).find('input[name="pow_challenge"]').val();
+		yagSolvePoW(challenge, parseInt(nonceInput.attr("data-pow-difficulty"), 10)).then(function (nonce) {
+			nonceInput.val(nonce);
+			form.submit();
+		});
+	});
+
 	$(document).on('click', '.modal-dismiss', function (e) {
 		e.preventDefault();
 		$.magnificPopup.close();
@@ -331,6 +360,9 @@ function initPlugins(partial) {
 	yagInitMultiSelect(selectorPrefix)
 	yagInitAutosize(selectorPrefix);
 	yagInitUnsavedForms(selectorPrefix)
+	yagInitEmbedPreviews(selectorPrefix);
+	yagInitMarkdownPreviews(selectorPrefix);
+	yagLoadMoreOptions(selectorPrefix);
 	// initializeMultiselect(selectorPrefix);
 
 	$(selectorPrefix + '.modal-basic').magnificPopup({
@@ -613,6 +645,62 @@ function yagInitUnsavedForms(selectorPrefix) {
 	});
 }
 
+// Forms with data-embed-preview="<selector>" show the preview of the embed being edited in the element it selects,
+// see HandleEmbedPreview for the fields of the form
+function yagInitEmbedPreviews(selectorPrefix) {
+	$(selectorPrefix + "form[data-embed-preview]").each(function (i, form) {
+		var target = $(form.getAttribute("data-embed-preview"));
+		var timeout = null;
+
+		var update = function () {
+			var oReq = new XMLHttpRequest();
+			oReq.addEventListener("load", function () {
+				target.html(this.responseText);
+			});
+			oReq.open("POST", "/manage/" + CURRENT_GUILDID + "/embed_preview");
+			setCSRFHeader(oReq, "POST");
+			oReq.setRequestHeader("content-type", "application/x-www-form-urlencoded");
+			oReq.send($(form).serialize());
+		};
+
+		$(form).on("input change", function () {
+			clearTimeout(timeout);
+			timeout = setTimeout(update, 500);
+		});
+		update();
+	});
+}
+
+// Textareas with data-markdown-preview="<selector>" show how discord shows their text in the element it selects
+function yagInitMarkdownPreviews(selectorPrefix) {
+	$(selectorPrefix + "textarea[data-markdown-preview]").each(function (i, textarea) {
+		var target = $(textarea.getAttribute("data-markdown-preview"));
+		var timeout = null;
+
+		var update = function () {
+			var oReq = new XMLHttpRequest();
+			oReq.addEventListener("load", function () {
+				var resp = JSON.parse(this.responseText);
+				if (resp.ok) {
+					target.html(resp.html);
+				} else if (resp.error) {
+					target.text(resp.error);
+				}
+			});
+			oReq.open("POST", "/manage/" + CURRENT_GUILDID + "/markdown_preview");
+			setCSRFHeader(oReq, "POST");
+			oReq.setRequestHeader("content-type", "application/x-www-form-urlencoded");
+			oReq.send("markdown=" + encodeURIComponent(textarea.value));
+		};
+
+		$(textarea).on("input", function () {
+			clearTimeout(timeout);
+			timeout = setTimeout(update, 500);
+		});
+		update();
+	});
+}
+
 function trackForm(form) {
 	let savedVersion = serializeForm($(form));
 
@@ -776,6 +864,26 @@ function navigateToAnchor(name) {
 	window.location.hash = "#" + name
 }
 
+// the server falls back to checking this token when the browser doesn't send a Origin or Referer header
+function setCSRFHeader(req, method) {
+	var meta = document.querySelector('meta[name="csrf-token"]');
+	if (meta && method.toUpperCase() !== "GET") {
+		req.setRequestHeader("X-CSRF-Token", meta.getAttribute("content"));
+	}
+}
+
+// Pages loaded in the background are rendered with their own csp nonce, but only scripts with the nonce of the
+// page they're loaded into are allowed to run
+function withPageNonce(req) {
+	var pageScript = document.querySelector("script[nonce]");
+	var match = /'nonce-([^']+)'/.exec(req.getResponseHeader("Content-Security-Policy") || req.getResponseHeader("Content-Security-Policy-Report-Only") || "");
+	if (!pageScript || !pageScript.nonce || !match) {
+		return req.responseText;
+	}
+
+	return req.responseText.split('nonce="' + match[1] + '"').join('nonce="' + pageScript.nonce + '"');
+}
+
 function createRequest(method, path, data, cb) {
 	var oReq = new XMLHttpRequest();
 	oReq.addEventListener("load", cb);
@@ -783,6 +891,7 @@ function createRequest(method, path, data, cb) {
 		window.location.href = '/';
 	});
 	oReq.open(method, path);
+	setCSRFHeader(oReq, method);
 
 	if (data) {
 		oReq.setRequestHeader("content-type", "application/json");
@@ -794,19 +903,154 @@ function createRequest(method, path, data, cb) {
 
 function toggleTheme() {
 	var elem = document.documentElement;
+	var theme;
 	if (elem.classList.contains("dark")) {
 		elem.classList.remove("dark");
 		elem.classList.add("sidebar-light")
 		document.cookie = "light_theme=true; max-age=3153600000; path=/"
+		theme = "light";
 	} else {
 		elem.classList.add("dark");
 		elem.classList.remove("sidebar-light")
 		document.cookie = "light_theme=false; max-age=3153600000; path=/"
+		theme = "dark";
 	}
+
+	// saved for the account too, so it follows the user to their other devices
+	var oReq = new XMLHttpRequest();
+	oReq.open("POST", "/theme");
+	setCSRFHeader(oReq, "POST");
+	oReq.setRequestHeader("content-type", "application/x-www-form-urlencoded");
+	oReq.send("theme=" + theme);
 }
 
 function loadWidget(destinationParentID, path) {
 	createRequest("GET", path + "?partial=1", null, function () {
-		$("#" + destinationParentID).html(this.responseText);
+		$("#" + destinationParentID).html(withPageNonce(this));
 	})
-}
\ No newline at end of file
+}
+
+// Large guilds only get a part of their roles rendered into dropdowns, this loads the rest
+function yagLoadMoreOptions(selectorPrefix) {
+	var match = window.location.pathname.match(/^\/manage\/(\d+)/);
+	if (!match) {
+		return;
+	}
+
+	$(selectorPrefix + 'option[data-load-more="roles"]').each(function (i, rawElem) {
+		var placeholder = $(rawElem);
+		var select = placeholder.parent();
+		var botLimited = placeholder.attr("data-bot-limited") === "1";
+
+		createRequest("GET", "/manage/" + match[1] + "/options/roles?offset=" + placeholder.attr("data-offset"), null, function () {
+			if (this.status !== 200) {
+				return;
+			}
+
+			var roles = JSON.parse(this.responseText);
+			for (var j = 0; j < roles.length; j++) {
+				var role = roles[j];
+				if ((botLimited && role.managed) || select.find('option[value="' + role.id + '"]').length > 0) {
+					continue;
+				}
+
+				var opt = $("<option></option>").attr("value", role.id).text(role.name);
+				if (role.color) {
+					opt.attr("data-color", role.color).css("color", role.color);
+				}
+				if (botLimited && role.above_bot) {
+					opt.prop("disabled", true).text(role.name + " (role is above bot)");
+				}
+
+				select.append(opt);
+			}
+
+			placeholder.remove();
+			if (select.is("[data-plugin-multiselect]") && $.isFunction($.fn.multiselect)) {
+				select.multiselect("rebuild");
+			}
+		});
+	});
+}
+
+async function yagSolvePoW(challenge, difficulty) {
+	var encoder = new TextEncoder();
+	for (var nonce = 0; ; nonce++) {
+		var digest = new Uint8Array(await window.crypto.subtle.digest("SHA-256", encoder.encode(challenge + ":" + nonce)));
+
+		var zeroBits = 0;
+		for (var i = 0; i < digest.length; i++) {
+			if (digest[i] === 0) {
+				zeroBits += 8;
+				continue;
+			}
+
+			zeroBits += Math.clz32(digest[i]) - 24;
+			break;
+		}
+
+		if (zeroBits >= difficulty) {
+			return nonce;
+		}
+	}
+}
+
+// yagConnectLiveUpdates listens for changes made to the server while the control panel is open, reconnecting with a
+// growing delay if the connection is lost
+function yagConnectLiveUpdates(guildID, retryDelay) {
+	var scheme = window.location.protocol === "https:" ? "wss://" : "ws://";
+	var ws = new WebSocket(scheme + window.location.host + "/manage/" + guildID + "/ws");
+	var opened = false;
+
+	ws.onopen = function () {
+		opened = true;
+	};
+
+	ws.onmessage = function (msg) {
+		var evt = JSON.parse(msg.data);
+		var data = evt.data || {};
+
+		switch (evt.type) {
+			case "config_changed":
+				yagShowLiveNotice(data.author_username + " changed the settings", data.action + ". Reload the page to see it.");
+				break;
+			case "modlog_entry":
+				yagShowLiveNotice(data.action + " " + data.target, "By " + data.author + ": " + data.reason);
+				break;
+			case "bot_left":
+				addAlert("danger", "The bot was removed from this server, the settings are kept but nothing will run until it's added back.", "bot-left-alert");
+				break;
+			case "bot_joined":
+				$("#bot-left-alert").remove();
+				yagShowLiveNotice("The bot was added to this server", "");
+				break;
+		}
+	};
+
+	ws.onclose = function () {
+		// a connection that worked starts over with a short delay, otherwise it's probably disabled or rejected
+		var delay = opened ? 5000 : Math.min(retryDelay * 2, 300000);
+		setTimeout(function () {
+			yagConnectLiveUpdates(guildID, delay);
+		}, delay);
+	};
+}
+
+function yagShowLiveNotice(title, text) {
+	var notice = new PNotify({
+		title: title,
+		text: text,
+		title_escape: true,
+		text_escape: true,
+		type: "info",
+		delay: 8000,
+		buttons: {
+			closer: true,
+			sticker: false
+		}
+	});
+
+	notice.get().click(function () {
+		notice.remove();
+	});
+}
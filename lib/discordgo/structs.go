@@ -346,6 +346,17 @@ const (
 	MfaLevelElevated
 )
 
+// PremiumTier type definition
+type PremiumTier int
+
+// Constants for PremiumTier levels from 0 to 3 inclusive
+const (
+	PremiumTierNone PremiumTier = iota
+	PremiumTier1
+	PremiumTier2
+	PremiumTier3
+)
+
 // A Guild holds all data related to a specific Discord Guild.  Guilds are also
 // sometimes referred to as Servers in the Discord client.
 type Guild struct {
@@ -442,6 +453,9 @@ type Guild struct {
 	// The list of enabled guild features
 	Features []string `json:"features"`
 
+	// The server boost level of the guild
+	PremiumTier PremiumTier `json:"premium_tier"`
+
 	// Required MFA level for the guild
 	MfaLevel MfaLevel `json:"mfa_level"`
 
@@ -1076,6 +1090,7 @@ const (
 	ErrCodeMaximumFriendsReached    = 30002
 	ErrCodeMaximumPinsReached       = 30003
 	ErrCodeMaximumGuildRolesReached = 30005
+	ErrCodeMaximumEmojisReached     = 30008
 	ErrCodeTooManyReactions         = 30010
 
 	ErrCodeUnauthorized = 40001
@@ -0,0 +1,217 @@
+package linkedaccounts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/backgroundworkers"
+	"github.com/botlabs-gg/yagpdb/v2/common/pluginhealth"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+// how often all the role rules are evaluated
+const syncInterval = time.Minute * 30
+
+const healthCheckSync = "linked_accounts_sync"
+
+var _ backgroundworkers.BackgroundWorkerPlugin = (*Plugin)(nil)
+
+// RunBackgroundWorker implements backgroundworkers.BackgroundWorkerPlugin
+func (p *Plugin) RunBackgroundWorker() {
+	t := time.NewTicker(syncInterval)
+	defer t.Stop()
+
+	for {
+		err := syncAllGuilds()
+		if err != nil {
+			logger.WithError(err).Error("failed syncing linked account roles")
+		}
+		pluginhealth.Report(healthCheckSync, err)
+
+		select {
+		case <-t.C:
+		case wg := <-p.stopWorker:
+			wg.Done()
+			return
+		}
+	}
+}
+
+// StopBackgroundWorker implements backgroundworkers.BackgroundWorkerPlugin
+func (p *Plugin) StopBackgroundWorker(wg *sync.WaitGroup) {
+	wg.Add(1)
+	p.stopWorker <- wg
+}
+
+var _ pluginhealth.PluginWithHealthChecks = (*Plugin)(nil)
+
+func (p *Plugin) HealthChecks() []*pluginhealth.Check {
+	return []*pluginhealth.Check{{
+		Name:        healthCheckSync,
+		Description: "Gives and removes the roles from linked account rules",
+		MaxInterval: syncInterval * 3,
+	}}
+}
+
+func syncAllGuilds() error {
+	var guilds []int64
+	err := common.GORM.Model(&RoleRule{}).Pluck("DISTINCT guild_id", &guilds).Error
+	if err != nil {
+		return errors.WithMessage(err, "guilds")
+	}
+
+	// also include guilds whose last rule was removed, so the roles given from it are taken away
+	var grantGuilds []int64
+	err = common.GORM.Model(&RoleGrant{}).Pluck("DISTINCT guild_id", &grantGuilds).Error
+	if err != nil {
+		return errors.WithMessage(err, "grant guilds")
+	}
+
+	for _, v := range grantGuilds {
+		if !common.ContainsInt64Slice(guilds, v) {
+			guilds = append(guilds, v)
+		}
+	}
+
+	for _, g := range guilds {
+		err := syncGuild(g, 0)
+		if err != nil {
+			logger.WithError(err).WithField("guild", g).Error("failed syncing linked account roles of guild")
+		}
+	}
+
+	return nil
+}
+
+type grantKey struct {
+	userID int64
+	ruleID uint
+}
+
+// syncGuild evaluates the role rules of the guild, for a single member if userID is not 0
+func syncGuild(guildID int64, userID int64) error {
+	rules, err := GetGuildRules(guildID)
+	if err != nil {
+		return errors.WithMessage(err, "rules")
+	}
+
+	q := common.GORM.Where("guild_id = ?", guildID)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+
+	var accounts []*LinkedAccount
+	err = q.Find(&accounts).Error
+	if err != nil {
+		return errors.WithMessage(err, "accounts")
+	}
+
+	var grants []*RoleGrant
+	err = q.Find(&grants).Error
+	if err != nil {
+		return errors.WithMessage(err, "grants")
+	}
+
+	existing := make(map[grantKey]bool)
+	for _, v := range grants {
+		existing[grantKey{v.UserID, v.RuleID}] = true
+	}
+
+	// grants which are still valid, or couldn't be checked and are left alone for now
+	keep := make(map[grantKey]bool)
+
+	for _, account := range accounts {
+		provider := GetProvider(account.Provider)
+		if provider == nil {
+			// the provider isn't configured anymore, leave the roles alone instead of removing them from everyone
+			for _, rule := range rules {
+				if rule.Provider == account.Provider {
+					keep[grantKey{account.UserID, rule.ID}] = true
+				}
+			}
+			continue
+		}
+
+		account.LastSyncError = ""
+		for _, rule := range rules {
+			if rule.Provider != account.Provider {
+				continue
+			}
+
+			key := grantKey{account.UserID, rule.ID}
+			matches, err := checkRule(provider, account, rule)
+			if err != nil {
+				logger.WithError(err).WithField("guild", guildID).WithField("account", account.ID).Warn("failed checking linked account rule")
+				account.LastSyncError = "Failed checking your " + provider.DisplayName() + " account, try linking it again if this keeps happening"
+				keep[key] = true
+				continue
+			}
+
+			if !matches {
+				continue
+			}
+
+			keep[key] = true
+			if existing[key] {
+				continue
+			}
+
+			err = common.BotSession.GuildMemberRoleAdd(guildID, account.UserID, rule.RoleID)
+			if err != nil {
+				if !common.IsDiscordErr(err, discordgo.ErrCodeUnknownMember, discordgo.ErrCodeUnknownRole, discordgo.ErrCodeMissingPermissions) {
+					return errors.WithMessage(err, "GuildMemberRoleAdd")
+				}
+				continue
+			}
+
+			err = common.GORM.Create(&RoleGrant{GuildID: guildID, UserID: account.UserID, RuleID: rule.ID, RoleID: rule.RoleID}).Error
+			if err != nil {
+				return errors.WithMessage(err, "create grant")
+			}
+		}
+
+		account.LastSyncedAt = time.Now()
+		err = common.GORM.Save(account).Error
+		if err != nil {
+			return errors.WithMessage(err, "save account")
+		}
+	}
+
+	for _, grant := range grants {
+		if keep[grantKey{grant.UserID, grant.RuleID}] {
+			continue
+		}
+
+		// the rule no longer matches, the rule was removed or the account was unlinked
+		err := removeGrant(grant)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkRule(provider Provider, account *LinkedAccount, rule *RoleRule) (bool, error) {
+	if rule.Condition == conditionLinked {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	return provider.Check(ctx, account, rule)
+}
+
+func removeGrant(grant *RoleGrant) error {
+	err := common.BotSession.GuildMemberRoleRemove(grant.GuildID, grant.UserID, grant.RoleID)
+	if err != nil && !common.IsDiscordErr(err, discordgo.ErrCodeUnknownMember, discordgo.ErrCodeUnknownRole, discordgo.ErrCodeMissingPermissions) {
+		return errors.WithMessage(err, "GuildMemberRoleRemove")
+	}
+
+	err = common.GORM.Where("guild_id = ? AND user_id = ? AND rule_id = ?", grant.GuildID, grant.UserID, grant.RuleID).Delete(&RoleGrant{}).Error
+	return errors.WithMessage(err, "delete grant")
+}
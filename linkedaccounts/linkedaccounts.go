@@ -0,0 +1,112 @@
+// Package linkedaccounts lets members link their Twitch, YouTube and Steam accounts within a server,
+// and gives them roles based on rules (e.g subscribed to a twitch channel) which are kept in sync by a background worker.
+package linkedaccounts
+
+import (
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+// max amount of role rules per server
+const maxRoleRules = 25
+
+type Plugin struct {
+	stopWorker chan *sync.WaitGroup
+}
+
+func (p *Plugin) PluginInfo() *common.PluginInfo {
+	return &common.PluginInfo{
+		Name:     "Linked accounts",
+		SysName:  "linked_accounts",
+		Category: common.PluginCategoryMisc,
+	}
+}
+
+var logger = common.GetPluginLogger(&Plugin{})
+
+func RegisterPlugin() {
+	err := common.GORM.AutoMigrate(&LinkedAccount{}, &RoleRule{}, &RoleGrant{}).Error
+	if err != nil {
+		logger.WithError(err).Error("failed migrating linked accounts tables, not enabling the plugin")
+		return
+	}
+
+	common.RegisterPlugin(&Plugin{
+		stopWorker: make(chan *sync.WaitGroup),
+	})
+}
+
+// LinkedAccount is a external account a member linked within a server
+type LinkedAccount struct {
+	common.SmallModel
+
+	GuildID  int64  `gorm:"unique_index:idx_linked_account"`
+	UserID   int64  `gorm:"unique_index:idx_linked_account"`
+	Provider string `gorm:"unique_index:idx_linked_account"`
+
+	ExternalID   string
+	ExternalName string
+
+	AccessToken  string
+	RefreshToken string
+	TokenExpiry  time.Time
+
+	LastSyncedAt time.Time
+	// LastSyncError is shown to the member if checking the rules for the account failed
+	LastSyncError string
+}
+
+func (a *LinkedAccount) TableName() string {
+	return "linked_accounts"
+}
+
+// RoleRule gives members a role as long as their linked account matches the condition
+type RoleRule struct {
+	common.SmallModel
+
+	GuildID   int64 `gorm:"index"`
+	Provider  string
+	Condition string
+
+	// Target is what the condition checks against, e.g the twitch channel id for subscriber rules
+	Target     string
+	TargetName string
+
+	RoleID int64
+}
+
+func (r *RoleRule) TableName() string {
+	return "linked_account_role_rules"
+}
+
+// RoleGrant records that a role was given because of a rule, so it's only removed from members who got it from us
+type RoleGrant struct {
+	GuildID int64 `gorm:"primary_key;auto_increment:false"`
+	UserID  int64 `gorm:"primary_key;auto_increment:false"`
+	RuleID  uint  `gorm:"primary_key;auto_increment:false"`
+
+	// RoleID is kept so the role can be removed after the rule is deleted
+	RoleID int64
+
+	CreatedAt time.Time
+}
+
+func (g *RoleGrant) TableName() string {
+	return "linked_account_role_grants"
+}
+
+// GetGuildRules returns the role rules of the guild
+func GetGuildRules(guildID int64) ([]*RoleRule, error) {
+	var rules []*RoleRule
+	err := common.GORM.Where("guild_id = ?", guildID).Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+// GetMemberAccounts returns the accounts the member linked in the guild
+func GetMemberAccounts(guildID, userID int64) ([]*LinkedAccount, error) {
+	var accounts []*LinkedAccount
+	err := common.GORM.Where("guild_id = ? AND user_id = ?", guildID, userID).Order("id asc").Find(&accounts).Error
+	return accounts, err
+}
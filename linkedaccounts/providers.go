@@ -0,0 +1,572 @@
+package linkedaccounts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+var (
+	confTwitchClientID     = config.RegisterOption("yagpdb.linkedaccounts.twitch_client_id", "Twitch application client id used for linking twitch accounts", "")
+	confTwitchClientSecret = config.RegisterOption("yagpdb.linkedaccounts.twitch_client_secret", "Twitch application client secret", "")
+
+	confGoogleClientID     = config.RegisterOption("yagpdb.linkedaccounts.google_client_id", "Google oauth client id used for linking youtube accounts", "")
+	confGoogleClientSecret = config.RegisterOption("yagpdb.linkedaccounts.google_client_secret", "Google oauth client secret", "")
+
+	confSteamAPIKey = config.RegisterOption("yagpdb.linkedaccounts.steam_api_key", "Steam web api key, needed for linking steam accounts", "")
+)
+
+var errUnknownCondition = fmt.Errorf("unknown condition")
+
+const conditionLinked = "linked"
+
+// Condition is something a role rule can require of a linked account
+type Condition struct {
+	Name        string
+	Description string
+
+	// TargetHint describes what the target of the rule is, conditions without a hint have no target
+	TargetHint string
+}
+
+// Provider is a service members can link their accounts from
+type Provider interface {
+	Name() string
+	DisplayName() string
+
+	// Enabled returns false if the provider is missing its configuration
+	Enabled() bool
+
+	// AuthURL returns where to send the member to link their account, redirectURL is where they're sent back to with the state
+	AuthURL(state, redirectURL string) string
+
+	// CompleteLink finishes linking from the request to redirectURL, filling in the external identity and tokens of the account
+	CompleteLink(ctx context.Context, r *http.Request, redirectURL string, account *LinkedAccount) error
+
+	// Conditions returns the conditions other than "linked" that role rules can use
+	Conditions() []*Condition
+
+	// ResolveTarget validates what the admin entered as the target of a rule, returning the id and display name to store
+	ResolveTarget(ctx context.Context, condition, input string) (id, name string, err error)
+
+	// Check returns true if the account matches the rule, the tokens of the account may be refreshed and need to be saved
+	Check(ctx context.Context, account *LinkedAccount, rule *RoleRule) (bool, error)
+}
+
+var providers = []Provider{
+	&twitchProvider{},
+	&youtubeProvider{},
+	&steamProvider{},
+}
+
+// GetProvider returns the provider with the name, or nil if it's unknown or not configured
+func GetProvider(name string) Provider {
+	for _, v := range providers {
+		if v.Name() == name && v.Enabled() {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// EnabledProviders returns the configured providers
+func EnabledProviders() []Provider {
+	var result []Provider
+	for _, v := range providers {
+		if v.Enabled() {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func findCondition(p Provider, name string) *Condition {
+	if name == conditionLinked {
+		return &Condition{Name: conditionLinked, Description: "Has linked a account"}
+	}
+
+	for _, v := range p.Conditions() {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+var providerHTTPClient = &http.Client{Timeout: time.Second * 15}
+
+// errorStatus is returned by getJSON for non 2xx responses
+type errorStatus struct {
+	Code int
+	Body string
+}
+
+func (e *errorStatus) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.Code, e.Body)
+}
+
+func isStatus(err error, code int) bool {
+	if e, ok := err.(*errorStatus); ok {
+		return e.Code == code
+	}
+
+	return false
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, header http.Header, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return &errorStatus{Code: resp.StatusCode, Body: string(body)}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// oauthClient returns a http client using the tokens of the account, refreshing them when needed
+func oauthClient(ctx context.Context, conf *oauth2.Config, account *LinkedAccount) (*http.Client, oauth2.TokenSource) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, providerHTTPClient)
+	ts := conf.TokenSource(ctx, &oauth2.Token{
+		AccessToken:  account.AccessToken,
+		RefreshToken: account.RefreshToken,
+		Expiry:       account.TokenExpiry,
+	})
+
+	return oauth2.NewClient(ctx, ts), ts
+}
+
+// storeToken copies the token of ts into the account, in case it was refreshed
+func storeToken(account *LinkedAccount, ts oauth2.TokenSource) {
+	token, err := ts.Token()
+	if err != nil {
+		return
+	}
+
+	account.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		account.RefreshToken = token.RefreshToken
+	}
+	account.TokenExpiry = token.Expiry
+}
+
+func exchangeCode(ctx context.Context, conf *oauth2.Config, r *http.Request, account *LinkedAccount) (*http.Client, error) {
+	if e := r.FormValue("error"); e != "" {
+		return nil, fmt.Errorf("authorization failed: %s", e)
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, providerHTTPClient)
+	token, err := conf.Exchange(ctx, r.FormValue("code"))
+	if err != nil {
+		return nil, err
+	}
+
+	account.AccessToken = token.AccessToken
+	account.RefreshToken = token.RefreshToken
+	account.TokenExpiry = token.Expiry
+
+	return conf.Client(ctx, token), nil
+}
+
+// Twitch
+
+type twitchProvider struct{}
+
+func (p *twitchProvider) Name() string        { return "twitch" }
+func (p *twitchProvider) DisplayName() string { return "Twitch" }
+
+func (p *twitchProvider) Enabled() bool {
+	return confTwitchClientID.GetString() != "" && confTwitchClientSecret.GetString() != ""
+}
+
+func (p *twitchProvider) oauthConf(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     confTwitchClientID.GetString(),
+		ClientSecret: confTwitchClientSecret.GetString(),
+		Scopes:       []string{"user:read:subscriptions", "user:read:follows"},
+		RedirectURL:  redirectURL,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://id.twitch.tv/oauth2/authorize",
+			TokenURL:  "https://id.twitch.tv/oauth2/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+func (p *twitchProvider) header() http.Header {
+	return http.Header{"Client-Id": {confTwitchClientID.GetString()}}
+}
+
+type twitchUsers struct {
+	Data []struct {
+		ID          string `json:"id"`
+		Login       string `json:"login"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+}
+
+func (p *twitchProvider) AuthURL(state, redirectURL string) string {
+	return p.oauthConf(redirectURL).AuthCodeURL(state)
+}
+
+func (p *twitchProvider) CompleteLink(ctx context.Context, r *http.Request, redirectURL string, account *LinkedAccount) error {
+	client, err := exchangeCode(ctx, p.oauthConf(redirectURL), r, account)
+	if err != nil {
+		return err
+	}
+
+	var users twitchUsers
+	err = getJSON(ctx, client, "https://api.twitch.tv/helix/users", p.header(), &users)
+	if err != nil {
+		return err
+	}
+
+	if len(users.Data) < 1 {
+		return fmt.Errorf("twitch returned no user")
+	}
+
+	account.ExternalID = users.Data[0].ID
+	account.ExternalName = users.Data[0].DisplayName
+	return nil
+}
+
+func (p *twitchProvider) Conditions() []*Condition {
+	return []*Condition{
+		{Name: "subscriber", Description: "Is subscribed to a channel", TargetHint: "Twitch channel name"},
+		{Name: "follower", Description: "Follows a channel", TargetHint: "Twitch channel name"},
+	}
+}
+
+func (p *twitchProvider) ResolveTarget(ctx context.Context, condition, input string) (id, name string, err error) {
+	if findCondition(p, condition) == nil {
+		return "", "", errUnknownCondition
+	}
+
+	if condition == conditionLinked {
+		return "", "", nil
+	}
+
+	// looking up users needs a app access token
+	appConf := &clientcredentials.Config{
+		ClientID:     confTwitchClientID.GetString(),
+		ClientSecret: confTwitchClientSecret.GetString(),
+		TokenURL:     "https://id.twitch.tv/oauth2/token",
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, providerHTTPClient)
+
+	var users twitchUsers
+	login := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(input), "@"))
+	err = getJSON(ctx, appConf.Client(ctx), "https://api.twitch.tv/helix/users?login="+url.QueryEscape(login), p.header(), &users)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(users.Data) < 1 {
+		return "", "", fmt.Errorf("no twitch channel named %q", login)
+	}
+
+	return users.Data[0].ID, users.Data[0].DisplayName, nil
+}
+
+func (p *twitchProvider) Check(ctx context.Context, account *LinkedAccount, rule *RoleRule) (bool, error) {
+	client, ts := oauthClient(ctx, p.oauthConf(""), account)
+	defer storeToken(account, ts)
+
+	var u string
+	switch rule.Condition {
+	case "subscriber":
+		u = fmt.Sprintf("https://api.twitch.tv/helix/subscriptions/user?broadcaster_id=%s&user_id=%s", url.QueryEscape(rule.Target), url.QueryEscape(account.ExternalID))
+	case "follower":
+		u = fmt.Sprintf("https://api.twitch.tv/helix/channels/followed?broadcaster_id=%s&user_id=%s", url.QueryEscape(rule.Target), url.QueryEscape(account.ExternalID))
+	default:
+		return false, errUnknownCondition
+	}
+
+	var dst struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	err := getJSON(ctx, client, u, p.header(), &dst)
+	if isStatus(err, http.StatusNotFound) {
+		// twitch responds with 404 when not subscribed
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(dst.Data) > 0, nil
+}
+
+// YouTube
+
+type youtubeProvider struct{}
+
+func (p *youtubeProvider) Name() string        { return "youtube" }
+func (p *youtubeProvider) DisplayName() string { return "YouTube" }
+
+func (p *youtubeProvider) Enabled() bool {
+	return confGoogleClientID.GetString() != "" && confGoogleClientSecret.GetString() != ""
+}
+
+func (p *youtubeProvider) oauthConf(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     confGoogleClientID.GetString(),
+		ClientSecret: confGoogleClientSecret.GetString(),
+		Scopes:       []string{"https://www.googleapis.com/auth/youtube.readonly"},
+		RedirectURL:  redirectURL,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+			TokenURL: "https://oauth2.googleapis.com/token",
+		},
+	}
+}
+
+func (p *youtubeProvider) AuthURL(state, redirectURL string) string {
+	// offline access to get a refresh token for the background checks
+	return p.oauthConf(redirectURL).AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
+}
+
+type youtubeChannels struct {
+	Items []struct {
+		ID      string `json:"id"`
+		Snippet struct {
+			Title string `json:"title"`
+		} `json:"snippet"`
+	} `json:"items"`
+}
+
+func (p *youtubeProvider) CompleteLink(ctx context.Context, r *http.Request, redirectURL string, account *LinkedAccount) error {
+	client, err := exchangeCode(ctx, p.oauthConf(redirectURL), r, account)
+	if err != nil {
+		return err
+	}
+
+	var channels youtubeChannels
+	err = getJSON(ctx, client, "https://www.googleapis.com/youtube/v3/channels?part=snippet&mine=true", nil, &channels)
+	if err != nil {
+		return err
+	}
+
+	if len(channels.Items) < 1 {
+		return fmt.Errorf("this google account has no youtube channel")
+	}
+
+	account.ExternalID = channels.Items[0].ID
+	account.ExternalName = channels.Items[0].Snippet.Title
+	return nil
+}
+
+func (p *youtubeProvider) Conditions() []*Condition {
+	return []*Condition{
+		{Name: "subscriber", Description: "Is subscribed to a channel", TargetHint: "YouTube channel id (starts with UC)"},
+	}
+}
+
+func (p *youtubeProvider) ResolveTarget(ctx context.Context, condition, input string) (id, name string, err error) {
+	if findCondition(p, condition) == nil {
+		return "", "", errUnknownCondition
+	}
+
+	if condition == conditionLinked {
+		return "", "", nil
+	}
+
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "UC") || len(input) != 24 {
+		return "", "", fmt.Errorf("%q is not a youtube channel id", input)
+	}
+
+	return input, input, nil
+}
+
+func (p *youtubeProvider) Check(ctx context.Context, account *LinkedAccount, rule *RoleRule) (bool, error) {
+	if rule.Condition != "subscriber" {
+		return false, errUnknownCondition
+	}
+
+	client, ts := oauthClient(ctx, p.oauthConf(""), account)
+	defer storeToken(account, ts)
+
+	var dst struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	err := getJSON(ctx, client, "https://www.googleapis.com/youtube/v3/subscriptions?part=id&mine=true&forChannelId="+url.QueryEscape(rule.Target), nil, &dst)
+	if err != nil {
+		return false, err
+	}
+
+	return len(dst.Items) > 0, nil
+}
+
+// Steam, which uses openid 2.0 instead of oauth
+
+const steamOpenIDURL = "https://steamcommunity.com/openid/login"
+
+type steamProvider struct{}
+
+func (p *steamProvider) Name() string        { return "steam" }
+func (p *steamProvider) DisplayName() string { return "Steam" }
+
+func (p *steamProvider) Enabled() bool {
+	return confSteamAPIKey.GetString() != ""
+}
+
+func (p *steamProvider) returnTo(state, redirectURL string) string {
+	return redirectURL + "?state=" + url.QueryEscape(state)
+}
+
+func (p *steamProvider) AuthURL(state, redirectURL string) string {
+	realm, _ := url.Parse(redirectURL)
+
+	v := url.Values{
+		"openid.ns":         {"http://specs.openid.net/auth/2.0"},
+		"openid.mode":       {"checkid_setup"},
+		"openid.return_to":  {p.returnTo(state, redirectURL)},
+		"openid.realm":      {realm.Scheme + "://" + realm.Host},
+		"openid.identity":   {"http://specs.openid.net/auth/2.0/identifier_select"},
+		"openid.claimed_id": {"http://specs.openid.net/auth/2.0/identifier_select"},
+	}
+
+	return steamOpenIDURL + "?" + v.Encode()
+}
+
+func (p *steamProvider) CompleteLink(ctx context.Context, r *http.Request, redirectURL string, account *LinkedAccount) error {
+	query := r.URL.Query()
+	if query.Get("openid.mode") != "id_res" {
+		return fmt.Errorf("steam login was cancelled")
+	}
+
+	if query.Get("openid.return_to") != p.returnTo(query.Get("state"), redirectURL) {
+		return fmt.Errorf("mismatched openid.return_to")
+	}
+
+	claimed := query.Get("openid.claimed_id")
+	const claimedPrefix = "https://steamcommunity.com/openid/id/"
+	if !strings.HasPrefix(claimed, claimedPrefix) {
+		return fmt.Errorf("unexpected openid.claimed_id")
+	}
+
+	// ask steam to verify the signature of the response
+	verify := url.Values{}
+	for k, v := range query {
+		if strings.HasPrefix(k, "openid.") {
+			verify[k] = v
+		}
+	}
+	verify.Set("openid.mode", "check_authentication")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, steamOpenIDURL, strings.NewReader(verify.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := providerHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10000))
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(string(body), "is_valid:true") {
+		return fmt.Errorf("steam could not verify the login")
+	}
+
+	account.ExternalID = strings.TrimPrefix(claimed, claimedPrefix)
+	account.ExternalName = account.ExternalID
+
+	var summaries struct {
+		Response struct {
+			Players []struct {
+				PersonaName string `json:"personaname"`
+			} `json:"players"`
+		} `json:"response"`
+	}
+	u := fmt.Sprintf("https://api.steampowered.com/ISteamUser/GetPlayerSummaries/v2/?key=%s&steamids=%s", url.QueryEscape(confSteamAPIKey.GetString()), account.ExternalID)
+	if err := getJSON(ctx, providerHTTPClient, u, nil, &summaries); err == nil && len(summaries.Response.Players) > 0 {
+		account.ExternalName = summaries.Response.Players[0].PersonaName
+	}
+
+	return nil
+}
+
+func (p *steamProvider) Conditions() []*Condition {
+	return []*Condition{
+		{Name: "owns_app", Description: "Owns a game (needs a public game library)", TargetHint: "Steam app id"},
+	}
+}
+
+func (p *steamProvider) ResolveTarget(ctx context.Context, condition, input string) (id, name string, err error) {
+	if findCondition(p, condition) == nil {
+		return "", "", errUnknownCondition
+	}
+
+	if condition == conditionLinked {
+		return "", "", nil
+	}
+
+	input = strings.TrimSpace(input)
+	for _, r := range input {
+		if r < '0' || r > '9' {
+			return "", "", fmt.Errorf("%q is not a steam app id", input)
+		}
+	}
+
+	if input == "" {
+		return "", "", fmt.Errorf("no steam app id")
+	}
+
+	return input, input, nil
+}
+
+func (p *steamProvider) Check(ctx context.Context, account *LinkedAccount, rule *RoleRule) (bool, error) {
+	if rule.Condition != "owns_app" {
+		return false, errUnknownCondition
+	}
+
+	var dst struct {
+		Response struct {
+			GameCount int `json:"game_count"`
+		} `json:"response"`
+	}
+
+	u := fmt.Sprintf("https://api.steampowered.com/IPlayerService/GetOwnedGames/v1/?key=%s&steamid=%s&appids_filter%%5B0%%5D=%s",
+		url.QueryEscape(confSteamAPIKey.GetString()), url.QueryEscape(account.ExternalID), url.QueryEscape(rule.Target))
+	err := getJSON(ctx, providerHTTPClient, u, nil, &dst)
+	if err != nil {
+		return false, err
+	}
+
+	return dst.Response.GameCount > 0, nil
+}
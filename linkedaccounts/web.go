@@ -0,0 +1,387 @@
+package linkedaccounts
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"github.com/jinzhu/gorm"
+	"github.com/mediocregopher/radix/v3"
+	"goji.io"
+	"goji.io/pat"
+)
+
+//go:embed assets/linkedaccounts.html
+var PageHTML string
+
+//go:embed assets/linkedaccounts_member.html
+var MemberPageHTML string
+
+var (
+	panelLogKeyAddedRule   = cplogs.RegisterActionFormat(&cplogs.ActionFormat{Key: "linked_accounts_added_rule", FormatString: "Added linked account role rule for %s"})
+	panelLogKeyRemovedRule = cplogs.RegisterActionFormat(&cplogs.ActionFormat{Key: "linked_accounts_removed_rule", FormatString: "Removed linked account role rule #%d"})
+)
+
+// how long a member has to complete linking their account
+const linkStateExpiry = time.Minute * 10
+
+type RuleForm struct {
+	Provider  string
+	Condition string
+	Target    string `valid:",100"`
+	RoleID    int64  `valid:"role,false"`
+}
+
+// linkState is stored in redis while the member is linking their account
+type linkState struct {
+	GuildID  int64
+	UserID   int64
+	Provider string
+}
+
+func keyLinkState(state string) string {
+	return "linkedaccounts_state:" + state
+}
+
+func (p *Plugin) InitWeb() {
+	web.AddHTMLTemplate("linkedaccounts/assets/linkedaccounts.html", PageHTML)
+	web.AddHTMLTemplate("linkedaccounts/assets/linkedaccounts_member.html", MemberPageHTML)
+	web.AddSidebarItem(web.SidebarCategoryTools, &web.SidebarItem{
+		Name: "Linked accounts",
+		URL:  "linked_accounts",
+		Icon: "fas fa-link",
+	})
+
+	// admin pages for the role rules
+	cpMux := goji.SubMux()
+	web.CPMux.Handle(pat.New("/linked_accounts/*"), cpMux)
+	web.CPMux.Handle(pat.New("/linked_accounts"), cpMux)
+
+	cpMux.Use(web.RequireBotMemberMW)
+	cpMux.Use(web.RequirePermMW(discordgo.PermissionManageRoles))
+
+	mainGetHandler := web.ControllerHandler(HandleGetRules, "cp_linked_accounts")
+	cpMux.Handle(pat.Get("/"), mainGetHandler)
+	cpMux.Handle(pat.Get(""), mainGetHandler)
+	cpMux.Handle(pat.Post("/rules/new"), web.ControllerPostHandler(HandleNewRule, mainGetHandler, RuleForm{}))
+	cpMux.Handle(pat.Post("/rules/:rule/delete"), web.ControllerPostHandler(HandleDeleteRule, mainGetHandler, nil))
+
+	// members link their accounts through the public server pages
+	memberGetHandler := web.ControllerHandler(HandleGetMemberPage, "cp_linked_accounts_member")
+	web.ServerPublicMux.Handle(pat.Get("/linked_accounts"), web.RequireSessionMiddleware(memberGetHandler))
+	web.ServerPublicMux.Handle(pat.Post("/linked_accounts/link/:provider"), web.RequireSessionMiddleware(http.HandlerFunc(HandleStartLink)))
+	web.ServerPublicMux.Handle(pat.Post("/linked_accounts/unlink/:provider"), web.RequireSessionMiddleware(web.ControllerPostHandler(HandleUnlink, memberGetHandler, nil)))
+
+	web.RootMux.Handle(pat.Get("/linked_accounts/callback/:provider"), web.RequireSessionMiddleware(http.HandlerFunc(HandleLinkCallback)))
+}
+
+func callbackURL(provider string) string {
+	return web.BaseURL() + "/linked_accounts/callback/" + provider
+}
+
+func memberPageURL(guildID int64) string {
+	return "/public/" + discordgo.StrID(guildID) + "/linked_accounts"
+}
+
+func HandleGetRules(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	g, templateData := web.GetBaseCPContextData(ctx)
+
+	rules, err := GetGuildRules(g.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	var linkedCount int
+	err = common.GORM.Model(&LinkedAccount{}).Where("guild_id = ?", g.ID).Count(&linkedCount).Error
+	if err != nil {
+		return templateData, err
+	}
+
+	templateData["Rules"] = rules
+	templateData["Providers"] = EnabledProviders()
+	templateData["LinkedCount"] = linkedCount
+	templateData["MaxRules"] = maxRoleRules
+	templateData["MemberPageURL"] = memberPageURL(g.ID)
+	return templateData, nil
+}
+
+func HandleNewRule(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	g, templateData := web.GetBaseCPContextData(ctx)
+	form := ctx.Value(common.ContextKeyParsedForm).(*RuleForm)
+
+	provider := GetProvider(form.Provider)
+	if provider == nil {
+		return templateData.AddAlerts(web.ErrorAlert("Unknown or disabled provider")), nil
+	}
+
+	var count int
+	err := common.GORM.Model(&RoleRule{}).Where("guild_id = ?", g.ID).Count(&count).Error
+	if err != nil {
+		return templateData, err
+	}
+
+	if count >= maxRoleRules {
+		return templateData.AddAlerts(web.ErrorAlert(fmt.Sprintf("Max %d role rules allowed", maxRoleRules))), nil
+	}
+
+	condition := findCondition(provider, form.Condition)
+	if condition == nil {
+		return templateData.AddAlerts(web.ErrorAlert("Unknown condition")), nil
+	}
+
+	targetID, targetName, err := provider.ResolveTarget(ctx, condition.Name, form.Target)
+	if err != nil {
+		web.CtxLogger(ctx).WithError(err).Warn("failed resolving linked accounts rule target")
+		return templateData.AddAlerts(web.ErrorAlert("Invalid " + condition.TargetHint + ": " + err.Error())), nil
+	}
+
+	rule := &RoleRule{
+		GuildID:    g.ID,
+		Provider:   provider.Name(),
+		Condition:  condition.Name,
+		Target:     targetID,
+		TargetName: targetName,
+		RoleID:     form.RoleID,
+	}
+
+	err = common.GORM.Create(rule).Error
+	if err != nil {
+		return templateData, err
+	}
+
+	go cplogs.RetryAddEntry(web.NewLogEntryFromContext(ctx, panelLogKeyAddedRule, &cplogs.Param{Type: cplogs.ParamTypeString, Value: provider.DisplayName()}))
+	return templateData.AddAlerts(web.SucessAlert("Added the rule, members get the role the next time their accounts are checked")), nil
+}
+
+func HandleDeleteRule(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	g, templateData := web.GetBaseCPContextData(ctx)
+
+	ruleID, _ := strconv.ParseUint(pat.Param(r, "rule"), 10, 64)
+
+	// the roles given from the rule are removed by the next sync through the grants
+	res := common.GORM.Where("guild_id = ? AND id = ?", g.ID, ruleID).Delete(&RoleRule{})
+	if res.Error != nil {
+		return templateData, res.Error
+	}
+
+	if res.RowsAffected > 0 {
+		go cplogs.RetryAddEntry(web.NewLogEntryFromContext(ctx, panelLogKeyRemovedRule, &cplogs.Param{Type: cplogs.ParamTypeInt, Value: int64(ruleID)}))
+	}
+
+	return templateData, nil
+}
+
+// memberAccountView is a provider on the member page, along with the account if it's linked
+type memberAccountView struct {
+	Provider Provider
+	Account  *LinkedAccount
+	Rules    []*RoleRule
+}
+
+func HandleGetMemberPage(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	g, templateData := web.GetBaseCPContextData(ctx)
+
+	member := web.ContextMember(ctx)
+	if member == nil {
+		return templateData.AddAlerts(web.ErrorAlert("You need to be a member of this server to link accounts in it")), nil
+	}
+
+	accounts, err := GetMemberAccounts(g.ID, member.User.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	rules, err := GetGuildRules(g.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	var views []*memberAccountView
+	for _, p := range EnabledProviders() {
+		view := &memberAccountView{Provider: p}
+		for _, a := range accounts {
+			if a.Provider == p.Name() {
+				view.Account = a
+			}
+		}
+
+		for _, rule := range rules {
+			if rule.Provider == p.Name() {
+				view.Rules = append(view.Rules, rule)
+			}
+		}
+
+		views = append(views, view)
+	}
+
+	templateData["LinkedAccounts"] = views
+	return templateData, nil
+}
+
+// HandleStartLink handles POST /public/:server/linked_accounts/link/:provider, sending the member to the provider to authorize
+func HandleStartLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	g := web.ContextGuild(ctx)
+
+	provider := GetProvider(pat.Param(r, "provider"))
+	member := web.ContextMember(ctx)
+	if provider == nil || member == nil {
+		http.Redirect(w, r, memberPageURL(g.ID), http.StatusSeeOther)
+		return
+	}
+
+	serialized, err := json.Marshal(&linkState{GuildID: g.ID, UserID: member.User.ID, Provider: provider.Name()})
+	if err != nil {
+		web.CtxLogger(ctx).WithError(err).Error("failed serializing link state")
+		http.Redirect(w, r, memberPageURL(g.ID), http.StatusSeeOther)
+		return
+	}
+
+	state := web.RandBase64(32)
+	err = common.RedisPool.Do(radix.FlatCmd(nil, "SET", keyLinkState(state), serialized, "EX", int(linkStateExpiry.Seconds())))
+	if err != nil {
+		web.CtxLogger(ctx).WithError(err).Error("failed storing link state")
+		http.Redirect(w, r, memberPageURL(g.ID), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthURL(state, callbackURL(provider.Name())), http.StatusSeeOther)
+}
+
+// consumeLinkState returns the stored state, making sure it can only be used once
+func consumeLinkState(state string) (*linkState, error) {
+	var serialized []byte
+	err := common.RedisPool.Do(radix.Cmd(&serialized, "GET", keyLinkState(state)))
+	if err != nil || len(serialized) < 1 {
+		return nil, err
+	}
+
+	var deleted int
+	err = common.RedisPool.Do(radix.Cmd(&deleted, "DEL", keyLinkState(state)))
+	if err != nil || deleted < 1 {
+		// used by another request at the same time
+		return nil, err
+	}
+
+	var dst linkState
+	err = json.Unmarshal(serialized, &dst)
+	return &dst, err
+}
+
+// HandleLinkCallback handles GET /linked_accounts/callback/:provider, where the provider sends the member back to
+func HandleLinkCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := web.ContextUser(ctx)
+
+	state, err := consumeLinkState(r.FormValue("state"))
+	if err != nil {
+		web.CtxLogger(ctx).WithError(err).Error("failed retrieving link state")
+	}
+
+	provider := GetProvider(pat.Param(r, "provider"))
+	if state == nil || provider == nil || state.Provider != provider.Name() || state.UserID != user.ID {
+		http.Redirect(w, r, "/manage", http.StatusSeeOther)
+		return
+	}
+
+	account := &LinkedAccount{GuildID: state.GuildID, UserID: state.UserID, Provider: provider.Name()}
+	err = provider.CompleteLink(ctx, r, callbackURL(provider.Name()), account)
+	if err != nil {
+		web.CtxLogger(ctx).WithError(err).WithField("provider", provider.Name()).Warn("failed completing account link")
+		web.RedirectWithAlerts(w, r, memberPageURL(state.GuildID), web.ErrorAlert("Failed linking your account, try again"))
+		return
+	}
+
+	err = saveLinkedAccount(account)
+	if err == errAlreadyLinked {
+		web.RedirectWithAlerts(w, r, memberPageURL(state.GuildID), web.ErrorAlert("That account is already linked by another member of this server"))
+		return
+	} else if err != nil {
+		web.CtxLogger(ctx).WithError(err).Error("failed saving linked account")
+		web.RedirectWithAlerts(w, r, memberPageURL(state.GuildID), web.ErrorAlert("Failed linking your account, try again"))
+		return
+	}
+
+	// give the roles right away instead of waiting for the background sync
+	go func() {
+		err := syncGuild(state.GuildID, state.UserID)
+		if err != nil {
+			logger.WithError(err).WithField("guild", state.GuildID).Error("failed syncing roles of newly linked account")
+		}
+	}()
+
+	web.RedirectWithAlerts(w, r, memberPageURL(state.GuildID), web.SucessAlert("Linked your account, you'll get the roles it qualifies for shortly"))
+}
+
+var errAlreadyLinked = fmt.Errorf("external account already linked by another member")
+
+func saveLinkedAccount(account *LinkedAccount) error {
+	// one external account can only give roles to one member in a server
+	var otherCount int
+	err := common.GORM.Model(&LinkedAccount{}).Where("guild_id = ? AND provider = ? AND external_id = ? AND user_id != ?",
+		account.GuildID, account.Provider, account.ExternalID, account.UserID).Count(&otherCount).Error
+	if err != nil {
+		return err
+	}
+
+	if otherCount > 0 {
+		return errAlreadyLinked
+	}
+
+	var existing LinkedAccount
+	err = common.GORM.Where("guild_id = ? AND user_id = ? AND provider = ?", account.GuildID, account.UserID, account.Provider).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return common.GORM.Create(account).Error
+	} else if err != nil {
+		return err
+	}
+
+	account.ID = existing.ID
+	account.CreatedAt = existing.CreatedAt
+	return common.GORM.Save(account).Error
+}
+
+func HandleUnlink(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	g, templateData := web.GetBaseCPContextData(ctx)
+
+	member := web.ContextMember(ctx)
+	if member == nil {
+		return templateData, nil
+	}
+
+	err := common.GORM.Where("guild_id = ? AND user_id = ? AND provider = ?", g.ID, member.User.ID, pat.Param(r, "provider")).Delete(&LinkedAccount{}).Error
+	if err != nil {
+		return templateData, err
+	}
+
+	// take away the roles given from the account
+	go func() {
+		err := syncGuild(g.ID, member.User.ID)
+		if err != nil {
+			logger.WithError(err).WithField("guild", g.ID).Error("failed syncing roles of unlinked account")
+		}
+	}()
+
+	return templateData.AddAlerts(web.SucessAlert("Unlinked the account")), nil
+}
+
+// used by the templates to list the conditions of a provider
+func (v *memberAccountView) ConditionDescription(rule *RoleRule) string {
+	if c := findCondition(v.Provider, rule.Condition); c != nil {
+		return c.Description
+	}
+
+	return rule.Condition
+}
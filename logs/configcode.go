@@ -0,0 +1,65 @@
+package logs
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/logs/models"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+var _ web.PluginWithConfigCode = (*Plugin)(nil)
+
+func (p *Plugin) ConfigCodeName() string {
+	return "logs"
+}
+
+func (p *Plugin) ExportConfigCode(ctx context.Context, guildID int64) (interface{}, error) {
+	config, err := GetConfig(common.PQ, ctx, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	blacklistedChannels := make([]string, 0)
+	for _, v := range strings.Split(config.BlacklistedChannels.String, ",") {
+		if v != "" {
+			blacklistedChannels = append(blacklistedChannels, v)
+		}
+	}
+
+	return &ConfigFormData{
+		UsernameLoggingEnabled:       config.UsernameLoggingEnabled.Bool,
+		NicknameLoggingEnabled:       config.NicknameLoggingEnabled.Bool,
+		ManageMessagesCanViewDeleted: config.ManageMessagesCanViewDeleted.Bool,
+		EveryoneCanViewDeleted:       config.EveryoneCanViewDeleted.Bool,
+		AccessMode:                   int(config.AccessMode),
+		BlacklistedChannels:          blacklistedChannels,
+		MessageLogsAllowedRoles:      config.MessageLogsAllowedRoles,
+	}, nil
+}
+
+func (p *Plugin) ApplyConfigCode(ctx context.Context, tx *sql.Tx, guildID int64, form interface{}) error {
+	f := form.(*ConfigFormData)
+	config := &models.GuildLoggingConfig{
+		GuildID: guildID,
+
+		NicknameLoggingEnabled:       null.BoolFrom(f.NicknameLoggingEnabled),
+		UsernameLoggingEnabled:       null.BoolFrom(f.UsernameLoggingEnabled),
+		BlacklistedChannels:          null.StringFrom(strings.Join(f.BlacklistedChannels, ",")),
+		EveryoneCanViewDeleted:       null.BoolFrom(f.EveryoneCanViewDeleted),
+		ManageMessagesCanViewDeleted: null.BoolFrom(f.ManageMessagesCanViewDeleted),
+		MessageLogsAllowedRoles:      f.MessageLogsAllowedRoles,
+		AccessMode:                   int16(f.AccessMode),
+	}
+
+	return config.Upsert(ctx, tx, true, []string{"guild_id"}, boil.Infer(), boil.Infer())
+}
+
+func (p *Plugin) ConfigCodeApplied(guildID int64) {
+	pubsub.EvictCacheSet(configCache, guildID)
+}
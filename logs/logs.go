@@ -12,6 +12,7 @@ import (
 	"emperror.dev/errors"
 	"github.com/botlabs-gg/yagpdb/v2/bot"
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/ignorelist"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/logs/models"
 	"github.com/botlabs-gg/yagpdb/v2/web"
@@ -109,6 +110,10 @@ func CreateChannelLog(ctx context.Context, config *models.GuildLoggingConfig, gu
 	}
 
 	for _, v := range msgs {
+		if ignorelist.IsIgnored(guildID, v.Author.ID, ignorelist.FeatureLogs) {
+			continue
+		}
+
 		body := v.Content
 		for _, attachment := range v.Attachments {
 			body += fmt.Sprintf(" (Attachment: %s)", attachment.URL)
@@ -235,6 +240,11 @@ func GetChannelLogs(ctx context.Context, id, guildID int64, sm SearchMode) (*mod
 
 	}
 
+	messages, err := getLogMessages(ctx, logs)
+	return logs, messages, err
+}
+
+func getLogMessages(ctx context.Context, logs *models.MessageLogs2) ([]*models.Messages2, error) {
 	args := []interface{}{}
 	for _, v := range logs.Messages {
 		args = append(args, v)
@@ -242,10 +252,10 @@ func GetChannelLogs(ctx context.Context, id, guildID int64, sm SearchMode) (*mod
 
 	messages, err := models.Messages2s(qm.WhereIn("id in ?", args...), qm.OrderBy("id desc")).AllG(ctx)
 	if err != nil {
-		return nil, nil, errors.WrapIf(err, "messages2")
+		return nil, errors.WrapIf(err, "messages2")
 	}
 
-	return logs, messages, err
+	return messages, nil
 }
 
 func GetGuilLogs(ctx context.Context, guildID int64, before, after, limit int) ([]*models.MessageLogs2, error) {
@@ -266,6 +276,19 @@ func GetGuilLogs(ctx context.Context, guildID int64, before, after, limit int) (
 	return logs, err
 }
 
+// GetGuildLogsPage returns the logs on a page of the message logs of the guild, newest first
+func GetGuildLogsPage(ctx context.Context, guildID int64, limit, offset int) ([]*models.MessageLogs2, error) {
+	return models.MessageLogs2s(
+		models.MessageLogs2Where.GuildID.EQ(guildID),
+		qm.OrderBy("id desc"),
+		qm.Limit(limit),
+		qm.Offset(offset)).AllG(ctx)
+}
+
+func CountGuildLogs(ctx context.Context, guildID int64) (int64, error) {
+	return models.MessageLogs2s(models.MessageLogs2Where.GuildID.EQ(guildID)).CountG(ctx)
+}
+
 func GetUsernames(ctx context.Context, userID int64, limit, offset int) ([]*models.UsernameListing, error) {
 	result, err := models.UsernameListings(models.UsernameListingWhere.UserID.EQ(null.Int64From(userID)), qm.OrderBy("id desc"), qm.Limit(limit), qm.Offset(offset)).AllG(ctx)
 	return result, err
@@ -0,0 +1,74 @@
+package logs
+
+import (
+	"context"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithStorageUsage = (*Plugin)(nil)
+
+func (p *Plugin) StorageUsage(ctx context.Context, guildID int64) ([]*web.StorageCategory, error) {
+	logs := &web.StorageCategory{
+		Key:         "message_logs",
+		Name:        "Message logs",
+		Description: "Logs created with the logs command and by moderation actions, including the logged messages",
+		Retention:   "Until deleted",
+		Purgeable:   true,
+	}
+
+	const logsQuery = `SELECT count(*), COALESCE(sum(pg_column_size(message_logs2.*)), 0) FROM message_logs2 WHERE guild_id=$1`
+	err := common.PQ.QueryRowContext(ctx, logsQuery, guildID).Scan(&logs.Items, &logs.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if logs.Items < 1 {
+		return []*web.StorageCategory{logs}, nil
+	}
+
+	// messages2 has no guild index, so go through the messages referenced by the logs instead
+	const messagesQuery = `SELECT COALESCE(sum(pg_column_size(messages2.*)), 0) FROM messages2
+WHERE id IN (SELECT unnest(messages) FROM message_logs2 WHERE guild_id=$1)`
+
+	var messageBytes int64
+	err = common.PQ.QueryRowContext(ctx, messagesQuery, guildID).Scan(&messageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Bytes += messageBytes
+	return []*web.StorageCategory{logs}, nil
+}
+
+func (p *Plugin) PurgeStorage(ctx context.Context, guildID int64, category string) (int64, error) {
+	if category != "message_logs" {
+		return 0, web.NewPublicError("Unknown category")
+	}
+
+	tx, err := common.PQ.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM messages2 WHERE guild_id=$1 AND id IN (SELECT unnest(messages) FROM message_logs2 WHERE guild_id=$1)`, guildID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM message_logs2 WHERE guild_id=$1`, guildID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
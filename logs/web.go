@@ -48,9 +48,9 @@ type ConfigFormData struct {
 	NicknameLoggingEnabled       bool
 	ManageMessagesCanViewDeleted bool
 	EveryoneCanViewDeleted       bool
-	AccessMode                   int
-	BlacklistedChannels          []string
-	MessageLogsAllowedRoles      []int64
+	AccessMode                   int      `valid:"0,1"`
+	BlacklistedChannels          []string `valid:"channel,true"`
+	MessageLogsAllowedRoles      []int64  `valid:"role,true"`
 }
 
 var (
@@ -87,7 +87,7 @@ func (lp *Plugin) InitWeb() {
 	saveHandler := web.ControllerPostHandler(HandleLogsCPSaveGeneral, cpGetHandler, ConfigFormData{})
 	fullDeleteHandler := web.ControllerPostHandler(HandleLogsCPDelete, cpGetHandler, DeleteData{})
 	msgDeleteHandler := web.APIHandler(HandleDeleteMessageJson)
-	clearMessageLogs := web.ControllerPostHandler(HandleLogsCPDeleteAll, cpGetHandler, nil)
+	clearMessageLogs := web.RequireStepUp(web.ControllerPostHandler(HandleLogsCPDeleteAll, cpGetHandler, nil))
 
 	logCPMux.Handle(pat.Post("/"), saveHandler)
 	logCPMux.Handle(pat.Post(""), saveHandler)
@@ -95,43 +95,26 @@ func (lp *Plugin) InitWeb() {
 	logCPMux.Handle(pat.Post("/fulldelete2"), fullDeleteHandler)
 	logCPMux.Handle(pat.Post("/msgdelete2"), msgDeleteHandler)
 	logCPMux.Handle(pat.Post("/delete_all"), clearMessageLogs)
+	logCPMux.Handle(pat.Get("/export.json"), web.APIHandler(HandleExportLogsJson))
 }
 
 func HandleLogsCP(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	ctx := r.Context()
 	g, tmpl := web.GetBaseCPContextData(ctx)
 
-	beforeID := 0
-	beforeStr := r.URL.Query().Get("before")
-	if beforeStr != "" {
-		beforeId64, err := strconv.ParseInt(beforeStr, 10, 32)
-		if err != nil {
-			tmpl.AddAlerts(web.ErrorAlert("Failed parsing before id"))
-		}
-		beforeID = int(beforeId64)
-	} else {
-		tmpl["FirstPage"] = true
-	}
+	pagination := web.ParsePagination(r, 20)
+	total, err := CountGuildLogs(ctx, g.ID)
 
-	afterID := 0
-	afterStr := r.URL.Query().Get("after")
-	if afterStr != "" {
-		id64, err := strconv.ParseInt(afterStr, 10, 32)
-		if err != nil {
-			tmpl.AddAlerts(web.ErrorAlert("Failed parsing before id"))
-		}
-		afterID = int(id64)
-		tmpl["FirstPage"] = false
+	var serverLogs []*models.MessageLogs2
+	if err == nil {
+		pagination.SetTotal(int(total))
+		serverLogs, err = GetGuildLogsPage(ctx, g.ID, pagination.Limit(), pagination.Offset())
 	}
 
-	serverLogs, err := GetGuilLogs(ctx, g.ID, beforeID, afterID, 20)
-	web.CheckErr(tmpl, err, "Failed retrieving logs", web.CtxLogger(ctx).Error)
-	if err == nil {
+	if !web.CheckErr(tmpl, err, "Failed retrieving logs", web.CtxLogger(ctx).Error) {
 		tmpl["Logs"] = serverLogs
-		if len(serverLogs) > 0 {
-			tmpl["Oldest"] = serverLogs[len(serverLogs)-1].ID
-			tmpl["Newest"] = serverLogs[0].ID
-		}
+		tmpl.SetPagination(pagination)
+		tmpl.SetExport(messageLogsExport(g.ID, serverLogs))
 	}
 
 	general, err := GetConfig(common.PQ, ctx, g.ID)
@@ -155,6 +138,20 @@ func HandleLogsCP(w http.ResponseWriter, r *http.Request) (web.TemplateData, err
 	return tmpl, nil
 }
 
+func messageLogsExport(guildID int64, logs []*models.MessageLogs2) *web.ExportTable {
+	table := &web.ExportTable{
+		Name:    "message-logs-" + discordgo.StrID(guildID),
+		Columns: []string{"id", "created_at", "author_id", "author_username", "channel_id", "channel_name", "messages", "url"},
+	}
+
+	for _, v := range logs {
+		url := web.BaseURL() + "/public/" + discordgo.StrID(guildID) + "/log/" + strconv.Itoa(v.ID)
+		table.AddRow(v.ID, v.CreatedAt, discordgo.StrID(v.AuthorID), v.AuthorUsername, discordgo.StrID(v.ChannelID), v.ChannelName, len(v.Messages), url)
+	}
+
+	return table
+}
+
 func HandleLogsCPSaveGeneral(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	ctx := r.Context()
 	g, tmpl := web.GetBaseCPContextData(ctx)
@@ -350,6 +347,52 @@ func HandleLogsHTML(w http.ResponseWriter, r *http.Request) interface{} {
 	return tmpl
 }
 
+type ExportedLog struct {
+	*models.MessageLogs2
+	LoggedMessages []*models.Messages2 `json:"logged_messages"`
+}
+
+// HandleExportLogsJson streams all the message logs of the server along with their messages
+func HandleExportLogsJson(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	g, _ := web.GetBaseCPContextData(ctx)
+
+	if web.GetIsReadOnly(ctx) {
+		return web.NewPublicError("Exporting message logs requires write access")
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="message_logs_%d.json"`, g.ID))
+
+	const batchSize = 100
+	return web.JSONStream(func(emit func(v interface{}) error) error {
+		before := 0
+		for {
+			msgLogs, err := GetGuilLogs(ctx, g.ID, before, 0, batchSize)
+			if err != nil {
+				return err
+			}
+
+			for _, l := range msgLogs {
+				messages, err := getLogMessages(ctx, l)
+				if err != nil {
+					return err
+				}
+
+				err = emit(&ExportedLog{MessageLogs2: l, LoggedMessages: messages})
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(msgLogs) < batchSize {
+				return nil
+			}
+
+			before = msgLogs[len(msgLogs)-1].ID
+		}
+	})
+}
+
 func SetMessageLogsColors(guildID int64, views []*MessageView) {
 	users := make([]int64, 0, 50)
 
@@ -0,0 +1,109 @@
+package mobileapp
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/bot"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2"
+	seventsmodels "github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2/models"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+const eventModerationAlert = "mobileapp_moderation_alert"
+
+// ModerationAlert is pushed to the admins of the guild that opted in when a moderation action is taken
+type ModerationAlert struct {
+	GuildID int64
+
+	// Action describes what was done, e.g "🔨Banned"
+	Action     string
+	TargetID   int64
+	TargetName string
+	AuthorID   int64
+	AuthorName string
+	Reason     string
+}
+
+// Notification returns the push notification for the alert
+func (a *ModerationAlert) Notification(guildName string) *Notification {
+	body := a.Action + " " + a.TargetName + " by " + a.AuthorName
+	if a.Reason != "" {
+		body += ": " + a.Reason
+	}
+
+	return &Notification{
+		Title: guildName,
+		Body:  common.CutStringShort(body, 200),
+		Data: map[string]string{
+			"type":      "moderation_alert",
+			"guild_id":  strconv.FormatInt(a.GuildID, 10),
+			"target_id": strconv.FormatInt(a.TargetID, 10),
+		},
+	}
+}
+
+// QueueModerationAlert queues the alert for the admins that opted in, it's delivered by the bot through
+// scheduledevents2 so slow push services don't hold up moderation
+func QueueModerationAlert(alert *ModerationAlert) {
+	ctx := context.Background()
+
+	subscribers, err := getAlertSubscribers(ctx, alert.GuildID)
+	if err != nil {
+		logger.WithError(err).WithField("guild", alert.GuildID).Error("failed retrieving moderation alert subscribers")
+		return
+	}
+
+	if len(subscribers) < 1 {
+		return
+	}
+
+	err = scheduledevents2.ScheduleEvent(eventModerationAlert, alert.GuildID, time.Now(), alert)
+	if err != nil {
+		logger.WithError(err).WithField("guild", alert.GuildID).Error("failed queueing moderation alert")
+	}
+}
+
+func handleModerationAlert(evt *seventsmodels.ScheduledEvent, data interface{}) (retry bool, err error) {
+	alert := data.(*ModerationAlert)
+	ctx := context.Background()
+
+	gs := bot.State.GetGuild(evt.GuildID)
+	if gs == nil {
+		// left the guild in the meantime
+		return false, nil
+	}
+
+	subscribers, err := getAlertSubscribers(ctx, evt.GuildID)
+	if err != nil {
+		return true, err
+	}
+
+	n := alert.Notification(gs.Name)
+	for userID := range subscribers {
+		// no point in telling them about their own actions
+		if userID == alert.AuthorID || !canReceiveAlerts(gs, userID) {
+			continue
+		}
+
+		if err := PushToUser(ctx, userID, n); err != nil {
+			logger.WithError(err).WithField("user", userID).Error("failed pushing moderation alert")
+		}
+	}
+
+	return false, nil
+}
+
+// canReceiveAlerts returns true if the user still manages the guild, subscribers lose access when they lose the perms
+func canReceiveAlerts(gs *dstate.GuildSet, userID int64) bool {
+	ms, err := bot.GetMember(gs.ID, userID)
+	if err != nil || ms.Member == nil {
+		return false
+	}
+
+	perms := dstate.CalculateBasePermissions(gs.ID, gs.OwnerID, gs.Roles, userID, ms.Member.Roles)
+	return perms&discordgo.PermissionManageServer == discordgo.PermissionManageServer
+}
@@ -0,0 +1,150 @@
+// Package mobileapp is the api used by the companion mobile app: compact guild summaries, push notification tokens
+// and moderation alerts pushed to the admins who opted in, delivered through scheduledevents2
+package mobileapp
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+
+	// max amount of devices a user can receive notifications on, the least recently registered ones are removed
+	maxPushTokensPerUser = 10
+)
+
+type Plugin struct{}
+
+func (p *Plugin) PluginInfo() *common.PluginInfo {
+	return &common.PluginInfo{
+		Name:     "Mobile app",
+		SysName:  "mobile_app",
+		Category: common.PluginCategoryMisc,
+	}
+}
+
+var logger = common.GetPluginLogger(&Plugin{})
+
+func RegisterPlugin() {
+	common.InitSchemas("mobileapp", DBSchemas...)
+	common.RegisterPlugin(&Plugin{})
+}
+
+// PushToken is a device registered for push notifications
+type PushToken struct {
+	Token      string    `json:"token"`
+	UserID     int64     `json:"user_id,string"`
+	Platform   string    `json:"platform"`
+	DeviceName string    `json:"device_name"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// RegisterPushToken stores the device token for the user, a token registered by another user moves to this one
+// as it means the device changed accounts
+func RegisterPushToken(ctx context.Context, userID int64, platform, token, deviceName string) error {
+	const upsert = `INSERT INTO mobile_push_tokens (token, user_id, platform, device_name, created_at, updated_at)
+VALUES ($1, $2, $3, $4, now(), now())
+ON CONFLICT (token) DO UPDATE SET user_id = $2, platform = $3, device_name = $4, updated_at = now();`
+
+	_, err := common.PQ.ExecContext(ctx, upsert, token, userID, platform, deviceName)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	const prune = `DELETE FROM mobile_push_tokens WHERE user_id = $1 AND token NOT IN (
+	SELECT token FROM mobile_push_tokens WHERE user_id = $1 ORDER BY updated_at DESC LIMIT $2
+);`
+	_, err = common.PQ.ExecContext(ctx, prune, userID, maxPushTokensPerUser)
+	return errors.WithStackIf(err)
+}
+
+// DeletePushToken removes a device of the user, returns false if it wasn't registered
+func DeletePushToken(ctx context.Context, userID int64, token string) (bool, error) {
+	res, err := common.PQ.ExecContext(ctx, "DELETE FROM mobile_push_tokens WHERE user_id = $1 AND token = $2;", userID, token)
+	if err != nil {
+		return false, errors.WithStackIf(err)
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, errors.WithStackIf(err)
+}
+
+// deleteInvalidPushToken removes a token the push service rejected, e.g because the app was uninstalled
+func deleteInvalidPushToken(ctx context.Context, token string) error {
+	_, err := common.PQ.ExecContext(ctx, "DELETE FROM mobile_push_tokens WHERE token = $1;", token)
+	return errors.WithStackIf(err)
+}
+
+// GetUserPushTokens returns the devices the user registered
+func GetUserPushTokens(ctx context.Context, userID int64) ([]*PushToken, error) {
+	const query = `SELECT token, user_id, platform, device_name, created_at, updated_at FROM mobile_push_tokens
+WHERE user_id = $1 ORDER BY updated_at DESC;`
+
+	rows, err := common.PQ.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+	defer rows.Close()
+
+	var result []*PushToken
+	for rows.Next() {
+		t := &PushToken{}
+		err = rows.Scan(&t.Token, &t.UserID, &t.Platform, &t.DeviceName, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, errors.WithStackIf(err)
+		}
+
+		result = append(result, t)
+	}
+
+	return result, errors.WithStackIf(rows.Err())
+}
+
+// SetAlertSubscription turns moderation alerts for the guild on or off for the user
+func SetAlertSubscription(ctx context.Context, guildID, userID int64, enabled bool) error {
+	var err error
+	if enabled {
+		_, err = common.PQ.ExecContext(ctx, `INSERT INTO mobile_alert_subscriptions (guild_id, user_id, created_at) VALUES ($1, $2, now())
+ON CONFLICT (guild_id, user_id) DO NOTHING;`, guildID, userID)
+	} else {
+		_, err = common.PQ.ExecContext(ctx, "DELETE FROM mobile_alert_subscriptions WHERE guild_id = $1 AND user_id = $2;", guildID, userID)
+	}
+
+	return errors.WithStackIf(err)
+}
+
+// GetUserAlertGuilds returns the guilds the user gets moderation alerts for
+func GetUserAlertGuilds(ctx context.Context, userID int64) (map[int64]bool, error) {
+	return queryIDSet(ctx, "SELECT guild_id FROM mobile_alert_subscriptions WHERE user_id = $1;", userID)
+}
+
+// getAlertSubscribers returns the users that get moderation alerts for the guild
+func getAlertSubscribers(ctx context.Context, guildID int64) (map[int64]bool, error) {
+	return queryIDSet(ctx, "SELECT user_id FROM mobile_alert_subscriptions WHERE guild_id = $1;", guildID)
+}
+
+func queryIDSet(ctx context.Context, query string, args ...interface{}) (map[int64]bool, error) {
+	rows, err := common.PQ.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+	defer rows.Close()
+
+	result := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.WithStackIf(err)
+		}
+
+		result[id] = true
+	}
+
+	return result, errors.WithStackIf(rows.Err())
+}
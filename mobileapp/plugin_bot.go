@@ -0,0 +1,12 @@
+package mobileapp
+
+import (
+	"github.com/botlabs-gg/yagpdb/v2/bot"
+	"github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2"
+)
+
+var _ bot.BotInitHandler = (*Plugin)(nil)
+
+func (p *Plugin) BotInit() {
+	scheduledevents2.RegisterHandler(eventModerationAlert, ModerationAlert{}, handleModerationAlert)
+}
@@ -0,0 +1,339 @@
+package mobileapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var (
+	confFCMCredentials = config.RegisterOption("yagpdb.mobile.fcm_credentials", "Path to the firebase service account json used to send push notifications to android devices", "")
+
+	confAPNsKey     = config.RegisterOption("yagpdb.mobile.apns_key", "Path to the .p8 key used to send push notifications to ios devices", "")
+	confAPNsKeyID   = config.RegisterOption("yagpdb.mobile.apns_key_id", "ID of the apple push notification key", "")
+	confAPNsTeamID  = config.RegisterOption("yagpdb.mobile.apns_team_id", "Apple developer team id the push notification key belongs to", "")
+	confAPNsTopic   = config.RegisterOption("yagpdb.mobile.apns_topic", "Bundle id of the ios app", "")
+	confAPNsSandbox = config.RegisterOption("yagpdb.mobile.apns_sandbox", "Send ios push notifications through the sandbox, for development builds of the app", false)
+)
+
+const pushTimeout = time.Second * 10
+
+// errInvalidPushToken is returned by pushers when the device token is no longer valid, e.g the app was uninstalled
+var errInvalidPushToken = errors.New("push token is no longer valid")
+
+// Notification is a push notification
+type Notification struct {
+	Title string
+	Body  string
+
+	// Data is passed on to the app, e.g to open the right screen when tapped
+	Data map[string]string
+}
+
+type pusher interface {
+	Push(ctx context.Context, token string, n *Notification) error
+}
+
+var (
+	pushers     map[string]pusher
+	pushersOnce sync.Once
+)
+
+func getPusher(platform string) pusher {
+	pushersOnce.Do(initPushers)
+	return pushers[platform]
+}
+
+func initPushers() {
+	pushers = make(map[string]pusher)
+
+	if path := confFCMCredentials.GetString(); path != "" {
+		p, err := newFCMPusher(path)
+		if err != nil {
+			logger.WithError(err).Error("failed setting up firebase cloud messaging, android devices won't get push notifications")
+		} else {
+			pushers[PlatformFCM] = p
+		}
+	}
+
+	if path := confAPNsKey.GetString(); path != "" {
+		p, err := newAPNsPusher(path, confAPNsKeyID.GetString(), confAPNsTeamID.GetString(), confAPNsTopic.GetString(), confAPNsSandbox.GetBool())
+		if err != nil {
+			logger.WithError(err).Error("failed setting up apple push notifications, ios devices won't get push notifications")
+		} else {
+			pushers[PlatformAPNs] = p
+		}
+	}
+}
+
+// PlatformEnabled returns true if push notifications can be sent to devices of the platform
+func PlatformEnabled(platform string) bool {
+	return getPusher(platform) != nil
+}
+
+// PushToUser sends the notification to every device of the user, tokens the push services reject are removed
+func PushToUser(ctx context.Context, userID int64, n *Notification) error {
+	tokens, err := GetUserPushTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		p := getPusher(t.Platform)
+		if p == nil {
+			continue
+		}
+
+		err = p.Push(ctx, t.Token, n)
+		if err == errInvalidPushToken {
+			if err = deleteInvalidPushToken(ctx, t.Token); err != nil {
+				logger.WithError(err).Error("failed removing invalid push token")
+			}
+			continue
+		}
+
+		if err != nil {
+			logger.WithError(err).WithField("user", userID).WithField("platform", t.Platform).Error("failed sending push notification")
+		}
+	}
+
+	return nil
+}
+
+// fcmPusher sends notifications through the firebase cloud messaging http v1 api
+type fcmPusher struct {
+	client   *http.Client
+	endpoint string
+}
+
+func newFCMPusher(credentialsPath string) (*fcmPusher, error) {
+	serialized, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	creds, err := google.CredentialsFromJSON(context.Background(), serialized, "https://www.googleapis.com/auth/firebase.messaging")
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	if creds.ProjectID == "" {
+		return nil, errors.New("no project_id in the firebase credentials")
+	}
+
+	client := oauth2.NewClient(context.Background(), creds.TokenSource)
+	client.Timeout = pushTimeout
+
+	return &fcmPusher{
+		client:   client,
+		endpoint: "https://fcm.googleapis.com/v1/projects/" + creds.ProjectID + "/messages:send",
+	}, nil
+}
+
+func (p *fcmPusher) Push(ctx context.Context, token string, n *Notification) error {
+	serialized, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        token,
+			"notification": map[string]string{"title": n.Title, "body": n.Body},
+			"data":         n.Data,
+		},
+	})
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewReader(serialized))
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	// tokens of uninstalled apps are reported as a 404 with the UNREGISTERED error code
+	if resp.StatusCode == http.StatusNotFound || bytes.Contains(body, []byte("UNREGISTERED")) {
+		return errInvalidPushToken
+	}
+
+	return errors.Errorf("fcm responded with %d: %s", resp.StatusCode, body)
+}
+
+// apple rejects provider tokens older than an hour, and refreshing them more often than every 20 minutes
+const apnsTokenLifetime = time.Minute * 40
+
+// apnsPusher sends notifications through the apple push notification service using token based authentication
+type apnsPusher struct {
+	client *http.Client
+	host   string
+	topic  string
+
+	key    *ecdsa.PrivateKey
+	keyID  string
+	teamID string
+
+	mu            sync.Mutex
+	authToken     string
+	authTokenTime time.Time
+}
+
+func newAPNsPusher(keyPath, keyID, teamID, topic string, sandbox bool) (*apnsPusher, error) {
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, errors.New("yagpdb.mobile.apns_key_id, yagpdb.mobile.apns_team_id and yagpdb.mobile.apns_topic have to be set")
+	}
+
+	serialized, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	key, err := parseAPNsKey(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	host := "https://api.push.apple.com"
+	if sandbox {
+		host = "https://api.sandbox.push.apple.com"
+	}
+
+	return &apnsPusher{
+		// the default transport negotiates http/2, which apple requires
+		client: &http.Client{Timeout: pushTimeout},
+		host:   host,
+		topic:  topic,
+		key:    key,
+		keyID:  keyID,
+		teamID: teamID,
+	}, nil
+}
+
+func parseAPNsKey(serialized []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(serialized)
+	if block == nil {
+		return nil, errors.New("no pem block in the apns key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the apns key is not a ecdsa key")
+	}
+
+	return key, nil
+}
+
+// providerToken returns the ES256 signed jwt apple authenticates requests with, reused until apnsTokenLifetime passes
+func (p *apnsPusher) providerToken() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.authToken != "" && time.Since(p.authTokenTime) < apnsTokenLifetime {
+		return p.authToken, nil
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": p.keyID})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": p.teamID, "iat": now.Unix()})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, p.key, hash[:])
+	if err != nil {
+		return "", errors.WithStackIf(err)
+	}
+
+	// jws uses the fixed size r || s encoding instead of asn.1
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	p.authToken = unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)
+	p.authTokenTime = now
+	return p.authToken, nil
+}
+
+func (p *apnsPusher) Push(ctx context.Context, token string, n *Notification) error {
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": n.Title, "body": n.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+
+	serialized, err := json.Marshal(payload)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	auth, err := p.providerToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.host+"/3/device/"+token, bytes.NewReader(serialized))
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+	req.Header.Set("Authorization", "bearer "+auth)
+	req.Header.Set("apns-topic", p.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var parsed struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&parsed)
+
+	switch {
+	case resp.StatusCode == http.StatusGone || parsed.Reason == "BadDeviceToken" || parsed.Reason == "Unregistered":
+		return errInvalidPushToken
+	case parsed.Reason == "ExpiredProviderToken":
+		p.mu.Lock()
+		p.authToken = ""
+		p.mu.Unlock()
+	}
+
+	return errors.Errorf("apns responded with %d: %s", resp.StatusCode, parsed.Reason)
+}
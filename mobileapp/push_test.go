@@ -0,0 +1,145 @@
+package mobileapp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestAPNsPusher(t *testing.T) *apnsPusher {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := parseAPNsKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &apnsPusher{client: http.DefaultClient, topic: "xyz.yagpdb.app", key: parsed, keyID: "KEYID", teamID: "TEAMID"}
+}
+
+func TestAPNsProviderToken(t *testing.T) {
+	p := newTestAPNsPusher(t)
+
+	token, err := p.providerToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected a jwt with 3 parts, got %q", token)
+	}
+
+	var header map[string]string
+	decoded, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(decoded, &header); err != nil || header["alg"] != "ES256" || header["kid"] != "KEYID" {
+		t.Errorf("unexpected header: %s", decoded)
+	}
+
+	var claims map[string]interface{}
+	decoded, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(decoded, &claims); err != nil || claims["iss"] != "TEAMID" || claims["iat"] == nil {
+		t.Errorf("unexpected claims: %s", decoded)
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if len(sig) != 64 || !ecdsa.Verify(&p.key.PublicKey, hash[:], r, s) {
+		t.Error("invalid signature")
+	}
+
+	if again, _ := p.providerToken(); again != token {
+		t.Error("expected the token to be reused")
+	}
+}
+
+func TestAPNsPush(t *testing.T) {
+	p := newTestAPNsPusher(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apns-topic") != "xyz.yagpdb.app" || !strings.HasPrefix(r.Header.Get("Authorization"), "bearer ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/3/device/valid":
+		case "/3/device/uninstalled":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"reason":"InternalServerError"}`))
+		}
+	}))
+	defer srv.Close()
+	p.host = srv.URL
+
+	n := &Notification{Title: "Server", Body: "Banned someone"}
+	if err := p.Push(context.Background(), "valid", n); err != nil {
+		t.Errorf("expected the push to succeed, got %v", err)
+	}
+
+	if err := p.Push(context.Background(), "uninstalled", n); err != errInvalidPushToken {
+		t.Errorf("expected errInvalidPushToken, got %v", err)
+	}
+
+	if err := p.Push(context.Background(), "other", n); err == nil || err == errInvalidPushToken {
+		t.Errorf("expected a regular error, got %v", err)
+	}
+}
+
+func TestFCMPush(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Message struct {
+				Token string `json:"token"`
+			} `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch body.Message.Token {
+		case "valid":
+		case "uninstalled":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	p := &fcmPusher{client: srv.Client(), endpoint: srv.URL}
+	n := &Notification{Title: "Server", Body: "Banned someone"}
+
+	if err := p.Push(context.Background(), "valid", n); err != nil {
+		t.Errorf("expected the push to succeed, got %v", err)
+	}
+
+	if err := p.Push(context.Background(), "uninstalled", n); err != errInvalidPushToken {
+		t.Errorf("expected errInvalidPushToken, got %v", err)
+	}
+
+	if err := p.Push(context.Background(), "other", n); err == nil || err == errInvalidPushToken {
+		t.Errorf("expected a regular error, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package mobileapp
+
+var DBSchemas = []string{`
+CREATE TABLE IF NOT EXISTS mobile_push_tokens (
+	token TEXT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	platform TEXT NOT NULL,
+
+	-- shown in the app so users can tell their devices apart
+	device_name TEXT NOT NULL,
+
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+`, `
+CREATE INDEX IF NOT EXISTS mobile_push_tokens_user_id_idx ON mobile_push_tokens(user_id);
+`, `
+CREATE TABLE IF NOT EXISTS mobile_alert_subscriptions (
+	guild_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+	PRIMARY KEY(guild_id, user_id)
+);
+`}
@@ -0,0 +1,245 @@
+package mobileapp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"goji.io"
+	"goji.io/pat"
+)
+
+const (
+	maxPushTokenLength  = 4096
+	maxDeviceNameLength = 100
+)
+
+var _ web.Plugin = (*Plugin)(nil)
+
+func (p *Plugin) InitWeb() {
+	// the app authenticates with a session cookie, or a personal api key where no session is needed
+	mux := goji.SubMux()
+	web.RootMux.Handle(pat.New("/app/v1/*"), mux)
+	mux.Use(requireUserMW)
+
+	mux.Handle(pat.Get("/guilds"), web.APIHandler(handleGetGuilds))
+	mux.Handle(pat.Get("/push_tokens"), web.APIHandler(handleGetPushTokens))
+	mux.Handle(pat.Post("/push_tokens"), web.APIHandler(handleRegisterPushToken))
+	mux.Handle(pat.Post("/push_tokens/delete"), web.APIHandler(handleDeletePushToken))
+
+	web.CPMux.Handle(pat.Get("/app/summary.json"), web.APIHandler(handleGetGuildSummary))
+	web.CPMux.Handle(pat.Post("/app/alerts"), web.APIHandler(handleSetAlerts))
+
+	// personal preferences, not server settings
+	web.ExemptFromApprovals("/app/alerts")
+
+	// json routes, which api keys can be used on
+	web.RegisterRequestClass(web.RequestClassAPI, isAppAPIRequest)
+}
+
+func isAppAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/app/v1/") || (strings.HasPrefix(r.URL.Path, "/manage/") && strings.HasSuffix(r.URL.Path, "/app/alerts"))
+}
+
+func requireUserMW(inner http.Handler) http.Handler {
+	return web.NamedMiddleware("mobileapp_user", inner, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(common.ContextKeyUser).(*discordgo.User); !ok {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"ok":false,"error":"not logged in"}`, http.StatusUnauthorized)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// GuildSummary is the compact view of a guild shown in the app's server list
+type GuildSummary struct {
+	ID   int64  `json:"id,string"`
+	Name string `json:"name"`
+	Icon string `json:"icon,omitempty"`
+
+	// Connected is false if the bot isn't on the guild, the app then offers to invite it
+	Connected bool `json:"connected"`
+	Alerts    bool `json:"alerts"`
+}
+
+// handleGetGuilds handles GET /app/v1/guilds, returning the guilds the user owns or has manage server perms on
+func handleGetGuilds(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	if web.DiscordSessionFromContext(ctx) == nil {
+		return web.NewPublicError("Listing servers requires logging in through discord, api keys can't see your servers")
+	}
+
+	guilds, err := web.GetUserGuilds(ctx)
+	if err != nil {
+		return err
+	}
+
+	alertGuilds, err := GetUserAlertGuilds(ctx, web.ContextUser(ctx).ID)
+	if err != nil {
+		return err
+	}
+
+	result := make([]*GuildSummary, 0, len(guilds))
+	for _, g := range guilds {
+		if !g.Owner && g.Permissions&discordgo.PermissionManageServer != discordgo.PermissionManageServer {
+			continue
+		}
+
+		result = append(result, &GuildSummary{
+			ID:        g.ID,
+			Name:      g.Name,
+			Icon:      g.Icon,
+			Connected: g.Connected,
+			Alerts:    alertGuilds[g.ID],
+		})
+	}
+
+	return result
+}
+
+// GuildDetails is the summary shown when opening a guild in the app
+type GuildDetails struct {
+	GuildSummary
+
+	MemberCount int64 `json:"member_count"`
+	ReadOnly    bool  `json:"read_only"`
+
+	// CanReceiveAlerts is false for users with access through the control panel roles, alerts require manage server
+	CanReceiveAlerts bool `json:"can_receive_alerts"`
+}
+
+// handleGetGuildSummary handles GET /manage/:server/app/summary.json
+func handleGetGuildSummary(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	g := web.ContextGuild(ctx)
+	user := web.ContextUser(ctx)
+
+	alertGuilds, err := GetUserAlertGuilds(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return &GuildDetails{
+		GuildSummary: GuildSummary{
+			ID:        g.ID,
+			Name:      g.Name,
+			Icon:      g.Icon,
+			Connected: true,
+			Alerts:    alertGuilds[g.ID],
+		},
+		MemberCount:      g.MemberCount,
+		ReadOnly:         web.GetIsReadOnly(ctx),
+		CanReceiveAlerts: canManageServer(r),
+	}
+}
+
+func canManageServer(r *http.Request) bool {
+	ctx := r.Context()
+	return web.ContextGuild(ctx).OwnerID == web.ContextUser(ctx).ID ||
+		web.ContextMemberPerms(ctx)&discordgo.PermissionManageServer == discordgo.PermissionManageServer
+}
+
+type setAlertsRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// handleSetAlerts handles POST /manage/:server/app/alerts, turning moderation alerts for the server on or off
+func handleSetAlerts(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+
+	var req setAlertsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return web.NewPublicError("Invalid request: ", err)
+	}
+
+	if req.Enabled && !canManageServer(r) {
+		return web.NewPublicError("Moderation alerts require manage server permissions")
+	}
+
+	err := SetAlertSubscription(ctx, web.ContextGuild(ctx).ID, web.ContextUser(ctx).ID, req.Enabled)
+	if err != nil {
+		return err
+	}
+
+	return map[string]interface{}{"ok": true, "enabled": req.Enabled}
+}
+
+// handleGetPushTokens handles GET /app/v1/push_tokens
+func handleGetPushTokens(w http.ResponseWriter, r *http.Request) interface{} {
+	tokens, err := GetUserPushTokens(r.Context(), web.ContextUser(r.Context()).ID)
+	if err != nil {
+		return err
+	}
+
+	if tokens == nil {
+		tokens = []*PushToken{}
+	}
+
+	return tokens
+}
+
+type registerPushTokenRequest struct {
+	Platform   string `json:"platform"`
+	Token      string `json:"token"`
+	DeviceName string `json:"device_name"`
+}
+
+// handleRegisterPushToken handles POST /app/v1/push_tokens, called by the app on launch and when the token changes
+func handleRegisterPushToken(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+
+	var req registerPushTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return web.NewPublicError("Invalid request: ", err)
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" || len(req.Token) > maxPushTokenLength {
+		return web.NewPublicError("Invalid token")
+	}
+
+	if req.Platform != PlatformFCM && req.Platform != PlatformAPNs {
+		return web.NewPublicError("Unknown platform, has to be ", PlatformFCM, " or ", PlatformAPNs)
+	}
+
+	if !PlatformEnabled(req.Platform) {
+		return web.NewPublicError("Push notifications aren't available for ", req.Platform)
+	}
+
+	err := RegisterPushToken(ctx, web.ContextUser(ctx).ID, req.Platform, req.Token, common.CutStringShort(req.DeviceName, maxDeviceNameLength))
+	if err != nil {
+		return err
+	}
+
+	return map[string]interface{}{"ok": true}
+}
+
+type deletePushTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// handleDeletePushToken handles POST /app/v1/push_tokens/delete, called by the app when logging out
+func handleDeletePushToken(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+
+	var req deletePushTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return web.NewPublicError("Invalid request: ", err)
+	}
+
+	deleted, err := DeletePushToken(ctx, web.ContextUser(ctx).ID, req.Token)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return web.NewPublicError("Unknown token")
+	}
+
+	return map[string]interface{}{"ok": true}
+}
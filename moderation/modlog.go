@@ -7,6 +7,8 @@ import (
 
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/mobileapp"
+	"github.com/botlabs-gg/yagpdb/v2/web"
 )
 
 type ModlogAction struct {
@@ -40,8 +42,10 @@ var (
 )
 
 func CreateModlogEmbed(config *Config, author *discordgo.User, action ModlogAction, target *discordgo.User, reason, logLink string) error {
+	go queueMobileAlert(config.GetGuildID(), author, action, target, reason)
+	go publishLiveModlogEntry(config.GetGuildID(), author, action, target, reason)
+
 	channelID := config.IntActionChannel()
-	config.GetGuildID()
 	if channelID == 0 {
 		return nil
 	}
@@ -126,3 +130,50 @@ func updateEmbedReason(author *discordgo.User, reason string, embed *discordgo.M
 		}
 	}
 }
+
+// queueMobileAlert pushes the action to the admins that enabled moderation alerts in the mobile app
+func queueMobileAlert(guildID int64, author *discordgo.User, action ModlogAction, target *discordgo.User, reason string) {
+	alert := &mobileapp.ModerationAlert{
+		GuildID:    guildID,
+		Action:     action.String(),
+		TargetID:   target.ID,
+		TargetName: target.String(),
+		AuthorName: "Unknown",
+		Reason:     reason,
+	}
+
+	if author != nil {
+		alert.AuthorID = author.ID
+		alert.AuthorName = author.String()
+	}
+
+	mobileapp.QueueModerationAlert(alert)
+}
+
+// liveModlogEntry is the data of the modlog entries shown live in the control panel
+type liveModlogEntry struct {
+	Action   string `json:"action"`
+	TargetID int64  `json:"target_id,string"`
+	Target   string `json:"target"`
+	AuthorID int64  `json:"author_id,string"`
+	Author   string `json:"author"`
+	Reason   string `json:"reason"`
+}
+
+// publishLiveModlogEntry shows the action in the control panels open on the guild
+func publishLiveModlogEntry(guildID int64, author *discordgo.User, action ModlogAction, target *discordgo.User, reason string) {
+	entry := &liveModlogEntry{
+		Action:   action.String(),
+		TargetID: target.ID,
+		Target:   target.String(),
+		Author:   "Unknown",
+		Reason:   reason,
+	}
+
+	if author != nil {
+		entry.AuthorID = author.ID
+		entry.Author = author.String()
+	}
+
+	web.PublishLiveEvent(guildID, &web.LiveEvent{Type: web.LiveEventModlogEntry, Data: entry})
+}
@@ -0,0 +1,61 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithPermissionAudit = (*Plugin)(nil)
+
+const PermissionAuditMuteRole = "mute_role"
+
+// AuditPermissions implements web.PluginWithPermissionAudit, flagging the channels the mute role can still talk in
+func (p *Plugin) AuditPermissions(ctx context.Context, audit *web.PermissionAudit) ([]*web.PermissionAuditIssue, error) {
+	config, err := GetConfig(audit.GS.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	muteRole := config.IntMuteRole()
+	if !config.MuteEnabled || muteRole == 0 || audit.GS.GetRole(muteRole) == nil {
+		return nil, nil
+	}
+
+	denied := MuteDeniedChannelPerms
+	if config.MuteDisallowReactionAdd {
+		denied |= discordgo.PermissionAddReactions
+	}
+
+	var issues []*web.PermissionAuditIssue
+	for i := range audit.GS.Channels {
+		cs := &audit.GS.Channels[i]
+		if cs.Type == discordgo.ChannelTypeGuildCategory || common.ContainsInt64Slice(config.MuteIgnoreChannels, cs.ID) {
+			continue
+		}
+
+		var missing int64 = denied
+		if overwrite := audit.Overwrite(cs, muteRole); overwrite != nil {
+			missing = denied &^ overwrite.Deny
+		}
+
+		if missing == 0 {
+			continue
+		}
+
+		issue := web.NewPermissionAuditIssue(PermissionAuditMuteRole, web.PermissionAuditWarning, cs, muteRole,
+			"The mute role is not denied "+strings.Join(common.HumanizePermissions(missing), ", "))
+		issue.Fix = &web.PermissionFix{
+			ChannelID:  cs.ID,
+			TargetID:   muteRole,
+			TargetType: discordgo.PermissionOverwriteTypeRole,
+			Deny:       denied,
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
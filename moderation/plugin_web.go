@@ -71,7 +71,7 @@ func HandleModeration(w http.ResponseWriter, r *http.Request) (web.TemplateData,
 func HandlePostModeration(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	ctx := r.Context()
 	activeGuild, templateData := web.GetBaseCPContextData(ctx)
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(activeGuild.ID) + "/moderation/"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(activeGuild.ID) + "/moderation/")
 
 	newConfig := ctx.Value(common.ContextKeyParsedForm).(*Config)
 	newConfig.DefaultMuteDuration.Valid = true
@@ -94,7 +94,7 @@ func HandlePostModeration(w http.ResponseWriter, r *http.Request) (web.TemplateD
 func HandleClearServerWarnings(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	ctx := r.Context()
 	activeGuild, templateData := web.GetBaseCPContextData(ctx)
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(activeGuild.ID) + "/moderation/"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(activeGuild.ID) + "/moderation/")
 
 	rows := common.GORM.Where("guild_id = ?", activeGuild.ID).Delete(WarningModel{}).RowsAffected
 	templateData.AddAlerts(web.SucessAlert("Deleted ", rows, " warnings!"))
@@ -59,7 +59,7 @@ func HandleNotificationsGet(w http.ResponseWriter, r *http.Request) interface{}
 func HandleNotificationsPost(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	ctx := r.Context()
 	activeGuild, templateData := web.GetBaseCPContextData(ctx)
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(activeGuild.ID) + "/notifications/general/"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(activeGuild.ID) + "/notifications/general/")
 
 	newConfig := ctx.Value(common.ContextKeyParsedForm).(*Config)
 
@@ -0,0 +1,42 @@
+package notifications
+
+import (
+	"context"
+
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithEventSimulation = (*Plugin)(nil)
+
+// SimulateEvent implements web.PluginWithEventSimulation, listing the join messages that would be sent
+func (p *Plugin) SimulateEvent(ctx context.Context, evt *web.SimulatedEvent) ([]*web.SimulatedAction, error) {
+	if evt.Type != web.SimulatedEventJoin {
+		return nil, nil
+	}
+
+	config, err := GetConfig(evt.GS.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []*web.SimulatedAction
+	if config.JoinDMEnabled {
+		actions = append(actions, &web.SimulatedAction{
+			Plugin:      p.PluginInfo().Name,
+			Description: "Send the join message in DM",
+			Link:        "/notifications/general",
+		})
+	}
+
+	if config.JoinServerEnabled && len(config.JoinServerMsgs) > 0 {
+		if channel := evt.GS.GetChannel(config.JoinServerChannelInt()); channel != nil {
+			actions = append(actions, &web.SimulatedAction{
+				Plugin:      p.PluginInfo().Name,
+				Description: "Send a join message in #" + channel.Name,
+				Link:        "/notifications/general",
+			})
+		}
+	}
+
+	return actions, nil
+}
@@ -9,6 +9,7 @@ import (
 	"emperror.dev/errors"
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/backgroundworkers"
+	"github.com/botlabs-gg/yagpdb/v2/common/pluginhealth"
 	"github.com/botlabs-gg/yagpdb/v2/premium/models"
 	"github.com/mediocregopher/radix/v3"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
@@ -24,6 +25,18 @@ func (p *Plugin) StopBackgroundWorker(wg *sync.WaitGroup) {
 	wg.Done()
 }
 
+const healthCheckMonitor = "premium_monitor"
+
+var _ pluginhealth.PluginWithHealthChecks = (*Plugin)(nil)
+
+func (p *Plugin) HealthChecks() []*pluginhealth.Check {
+	return []*pluginhealth.Check{{
+		Name:        healthCheckMonitor,
+		Description: "Expires premium slots and updates the premium servers",
+		MaxInterval: time.Minute * 5,
+	}}
+}
+
 func runMonitor() {
 	ticker := time.NewTicker(time.Second * 30)
 	time.Sleep(time.Second * 3)
@@ -33,6 +46,7 @@ func runMonitor() {
 	if err != nil {
 		logger.WithError(err).Error("Failed checking for expired premium slots")
 	}
+	pluginhealth.Report(healthCheckMonitor, err)
 
 	checkedExpiredSlots := false
 	for {
@@ -43,12 +57,14 @@ func runMonitor() {
 			if err != nil {
 				logger.WithError(err).Error("Failed updating premium servers")
 			}
+			pluginhealth.Report(healthCheckMonitor, err)
 			checkedExpiredSlots = false
 		} else {
 			err := checkExpiredSlots(context.Background())
 			if err != nil {
 				logger.WithError(err).Error("Failed checking for expired premium slots")
 			}
+			pluginhealth.Report(healthCheckMonitor, err)
 			checkedExpiredSlots = true
 		}
 
@@ -36,6 +36,9 @@ var (
 var _ web.Plugin = (*Plugin)(nil)
 
 func (p *Plugin) InitWeb() {
+	web.RegisterTemplateFuncs(template.FuncMap{
+		"premiumSlotDurationLeft": SlotDurationLeft,
+	})
 	web.AddHTMLTemplate("premium/assets/premium.html", PageHTML)
 
 	web.CPMux.Use(PremiumGuildMW)
@@ -60,6 +63,8 @@ func (p *Plugin) InitWeb() {
 	submux.Handle(pat.Post("/updateslot/:slotID"), web.ControllerPostHandler(HandlePostUpdateSlot, mainHandler, UpdateData{}))
 
 	web.CPMux.Handle(pat.Post("/premium/detach"), web.ControllerPostHandler(HandlePostDetachGuildSlot, web.RenderHandler(nil, "cp_premium_detach"), nil))
+	// it's the slot of the user, not a setting of the server
+	web.ExemptFromApprovals("/premium/detach")
 }
 
 // PremiumGuildMW adds premium data to context and tmpl vars
@@ -105,7 +110,6 @@ func HandleGetPremiumMainPage(w http.ResponseWriter, r *http.Request) (tmpl web.
 	guilds, _ := web.GetUserGuilds(r.Context())
 
 	tmpl["UserGuilds"] = guilds
-	tmpl["PremiumSlotDurationRemaining"] = SlotDurationLeft
 	tmpl["PremiumSlots"] = slots
 	return tmpl, nil
 }
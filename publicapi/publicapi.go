@@ -0,0 +1,232 @@
+// Package publicapi is the read only api for community tool developers: guild stats, the reputation leaderboard and
+// the custom command list of guilds that opted in, authenticated with developer keys that have their own quotas
+// and get suspended automatically when abused. Separate from the personal api keys, which act as the user.
+package publicapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"github.com/mediocregopher/radix/v3"
+)
+
+// max amount of developer keys a user can have, one per tool is plenty
+const maxKeysPerUser = 3
+
+type Plugin struct{}
+
+func (p *Plugin) PluginInfo() *common.PluginInfo {
+	return &common.PluginInfo{
+		Name:     "Public API",
+		SysName:  "public_api",
+		Category: common.PluginCategoryMisc,
+	}
+}
+
+var logger = common.GetPluginLogger(&Plugin{})
+
+func RegisterPlugin() {
+	common.RegisterPlugin(&Plugin{})
+}
+
+// DeveloperKey is a key used by a tool to access the public api
+type DeveloperKey struct {
+	// ID is the first part of the hash, used to identify the key in the portal and in the usage counters
+	ID          string    `json:"id"`
+	UserID      int64     `json:"user_id,string"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	SuspendedUntil  time.Time `json:"suspended_until"`
+	SuspendedReason string    `json:"suspended_reason"`
+
+	hash string
+}
+
+// Suspended returns true if the key is suspended at t
+func (k *DeveloperKey) Suspended(t time.Time) bool {
+	return t.Before(k.SuspendedUntil)
+}
+
+func keyDeveloperKeys() string {
+	return "public_api_keys"
+}
+
+func keyUserDeveloperKeys(userID int64) string {
+	return "public_api_user_keys:" + strconv.FormatInt(userID, 10)
+}
+
+func keyGuilds() string {
+	return "public_api_guilds"
+}
+
+func hashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateKey generates a new developer key for the user, the returned plaintext key is not stored anywhere
+func CreateKey(userID int64, name, description string) (string, *DeveloperKey, error) {
+	var count int
+	err := common.RedisPool.Do(radix.Cmd(&count, "SCARD", keyUserDeveloperKeys(userID)))
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	if count >= maxKeysPerUser {
+		return "", nil, web.NewPublicError("You can only have ", maxKeysPerUser, " developer keys, delete one first")
+	}
+
+	plain := web.DeveloperKeyPrefix + web.RandBase64(32)
+	hash := hashKey(plain)
+
+	key := &DeveloperKey{
+		ID:          hash[:12],
+		UserID:      userID,
+		Name:        name,
+		Description: description,
+		CreatedAt:   time.Now(),
+		hash:        hash,
+	}
+
+	serialized, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	err = common.MultipleCmds(
+		radix.Cmd(nil, "HSET", keyDeveloperKeys(), hash, string(serialized)),
+		radix.Cmd(nil, "SADD", keyUserDeveloperKeys(userID), hash),
+	)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	return plain, key, nil
+}
+
+// GetUserKeys returns all the developer keys of the user, newest first
+func GetUserKeys(userID int64) ([]*DeveloperKey, error) {
+	var hashes []string
+	err := common.RedisPool.Do(radix.Cmd(&hashes, "SMEMBERS", keyUserDeveloperKeys(userID)))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	result := make([]*DeveloperKey, 0, len(hashes))
+	for _, hash := range hashes {
+		key, err := getKeyByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != nil {
+			result = append(result, key)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func getKeyByHash(hash string) (*DeveloperKey, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGET", keyDeveloperKeys(), hash))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var key *DeveloperKey
+	err = json.Unmarshal(raw, &key)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	key.hash = hash
+	return key, nil
+}
+
+// DeleteKey deletes the developer key with the id, provided it belongs to the user
+func DeleteKey(userID int64, id string) error {
+	var hashes []string
+	err := common.RedisPool.Do(radix.Cmd(&hashes, "SMEMBERS", keyUserDeveloperKeys(userID)))
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	for _, hash := range hashes {
+		if !strings.HasPrefix(hash, id) {
+			continue
+		}
+
+		return common.MultipleCmds(
+			radix.Cmd(nil, "HDEL", keyDeveloperKeys(), hash),
+			radix.Cmd(nil, "SREM", keyUserDeveloperKeys(userID), hash),
+		)
+	}
+
+	return web.NewPublicError("Unknown developer key")
+}
+
+// ValidateKey returns the key if it's valid, nil otherwise. Suspended keys are returned too.
+func ValidateKey(plain string) (*DeveloperKey, error) {
+	if !strings.HasPrefix(plain, web.DeveloperKeyPrefix) {
+		return nil, nil
+	}
+
+	return getKeyByHash(hashKey(plain))
+}
+
+// SuspendKey suspends the key until the time, the reason is shown to the developer in the portal
+func SuspendKey(key *DeveloperKey, until time.Time, reason string) error {
+	// reload it so a key deleted in the meantime doesn't come back
+	current, err := getKeyByHash(key.hash)
+	if err != nil || current == nil {
+		return err
+	}
+
+	current.SuspendedUntil = until
+	current.SuspendedReason = reason
+
+	serialized, err := json.Marshal(current)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	err = common.RedisPool.Do(radix.Cmd(nil, "HSET", keyDeveloperKeys(), key.hash, string(serialized)))
+	return errors.WithStackIf(err)
+}
+
+// GuildEnabled returns true if the guild opted in to being accessible through the public api
+func GuildEnabled(guildID int64) (bool, error) {
+	var enabled bool
+	err := common.RedisPool.Do(radix.Cmd(&enabled, "SISMEMBER", keyGuilds(), strconv.FormatInt(guildID, 10)))
+	return enabled, errors.WithStackIf(err)
+}
+
+// SetGuildEnabled opts the guild in or out of the public api
+func SetGuildEnabled(guildID int64, enabled bool) error {
+	cmd := "SREM"
+	if enabled {
+		cmd = "SADD"
+	}
+
+	err := common.RedisPool.Do(radix.Cmd(nil, cmd, keyGuilds(), strconv.FormatInt(guildID, 10)))
+	return errors.WithStackIf(err)
+}
@@ -0,0 +1,217 @@
+package publicapi
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/apiusage"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/mediocregopher/radix/v3"
+)
+
+var (
+	confRequestsPerMinute = config.RegisterOption("yagpdb.public_api.requests_per_minute", "Requests a developer key can make to the public api per minute, 0 for no limit", 60)
+	confRequestsPerDay    = config.RegisterOption("yagpdb.public_api.requests_per_day", "Requests a developer key can make to the public api per day (UTC), 0 for no limit", 10000)
+	confAbuseThreshold    = config.RegisterOption("yagpdb.public_api.abuse_threshold", "Rejected requests (over quota, or for servers that didn't opt in) a developer key can make within 10 minutes before it's suspended, 0 to never suspend keys", 300)
+	confSuspensionHours   = config.RegisterOption("yagpdb.public_api.suspension_hours", "Hours a developer key is suspended for after abusing the public api", 24)
+)
+
+const (
+	// abuse is counted over windows of this length
+	abuseWindow = time.Minute * 10
+
+	// usageRetention is how long the hourly usage buckets shown in the developer portal are kept for
+	usageRetention = time.Hour * 24 * 7
+)
+
+func keyMinuteCounter(keyID string, t time.Time) string {
+	return "public_api_rl:" + keyID + ":" + strconv.FormatInt(t.Truncate(time.Minute).Unix(), 10)
+}
+
+func keyDayCounter(keyID string, t time.Time) string {
+	return "public_api_daily:" + keyID + ":" + t.UTC().Format("2006-01-02")
+}
+
+func keyRejected(keyID string, t time.Time) string {
+	return "public_api_rejected:" + keyID + ":" + strconv.FormatInt(t.Truncate(abuseWindow).Unix(), 10)
+}
+
+func keyUsageBucket(keyID string, t time.Time) string {
+	return "public_api_usage:" + keyID + ":" + strconv.FormatInt(t.Truncate(time.Hour).Unix(), 10)
+}
+
+// quotaResult is the state of a key's quotas after a request
+type quotaResult struct {
+	Allowed bool
+	// Daily is true if the request was rejected because the daily quota ran out
+	Daily bool
+
+	MinuteLimit     int
+	MinuteRemaining int
+	DayLimit        int
+	DayRemaining    int
+
+	// Reset is when the quota that rejected the request resets, or the minute quota if it wasn't rejected
+	Reset time.Time
+}
+
+// checkQuota decides if a request is allowed given the request counts of the current minute and day, which include
+// the request itself. A limit of 0 means there is none.
+func checkQuota(minuteCount, dayCount, perMinute, perDay int, now time.Time) *quotaResult {
+	result := &quotaResult{
+		Allowed:     true,
+		MinuteLimit: perMinute,
+		DayLimit:    perDay,
+		Reset:       now.Truncate(time.Minute).Add(time.Minute),
+	}
+
+	if perMinute > 0 {
+		result.MinuteRemaining = remaining(perMinute, minuteCount)
+		if minuteCount > perMinute {
+			result.Allowed = false
+		}
+	}
+
+	if perDay > 0 {
+		result.DayRemaining = remaining(perDay, dayCount)
+		if dayCount > perDay {
+			result.Allowed = false
+			result.Daily = true
+			y, m, d := now.UTC().Date()
+			result.Reset = time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+		}
+	}
+
+	return result
+}
+
+func remaining(limit, count int) int {
+	if count >= limit {
+		return 0
+	}
+
+	return limit - count
+}
+
+// takeQuota counts a request made with the key and returns whether it's allowed, rejected requests are counted too
+func takeQuota(key *DeveloperKey, now time.Time) (*quotaResult, error) {
+	minuteKey := keyMinuteCounter(key.ID, now)
+	dayKey := keyDayCounter(key.ID, now)
+
+	var minuteCount, dayCount int
+	err := common.RedisPool.Do(radix.Pipeline(
+		radix.Cmd(&minuteCount, "INCR", minuteKey),
+		radix.Cmd(nil, "EXPIRE", minuteKey, "120"),
+		radix.Cmd(&dayCount, "INCR", dayKey),
+		radix.Cmd(nil, "EXPIRE", dayKey, strconv.Itoa(int((time.Hour*48).Seconds()))),
+	))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	return checkQuota(minuteCount, dayCount, confRequestsPerMinute.GetInt(), confRequestsPerDay.GetInt(), now), nil
+}
+
+// getDayCount returns how many requests the key made today
+func getDayCount(keyID string, now time.Time) (int, error) {
+	var count int
+	err := common.RedisPool.Do(radix.Cmd(&count, "GET", keyDayCounter(keyID, now)))
+	return count, errors.WithStackIf(err)
+}
+
+// recordRejection counts a rejected request made with the key, suspending the key once it has made too many within
+// the abuse window. Returns true if the key got suspended.
+func recordRejection(key *DeveloperKey, now time.Time) (bool, error) {
+	threshold := confAbuseThreshold.GetInt()
+	if threshold <= 0 {
+		return false, nil
+	}
+
+	counterKey := keyRejected(key.ID, now)
+
+	var count int
+	err := common.RedisPool.Do(radix.Pipeline(
+		radix.Cmd(&count, "INCR", counterKey),
+		radix.Cmd(nil, "EXPIRE", counterKey, strconv.Itoa(int(abuseWindow.Seconds()))),
+	))
+	if err != nil {
+		return false, errors.WithStackIf(err)
+	}
+
+	// only once, the requests after it are rejected as suspended and not counted
+	if count != threshold {
+		return false, nil
+	}
+
+	until := now.Add(time.Hour * time.Duration(confSuspensionHours.GetInt()))
+	reason := fmt.Sprintf("Made %d rejected requests within %d minutes, respect the quotas and only request servers that opted in", count, int(abuseWindow.Minutes()))
+	err = SuspendKey(key, until, reason)
+	if err != nil {
+		return false, err
+	}
+
+	logger.WithField("key", key.ID).WithField("user", key.UserID).Warnf("Suspended developer key until %s: %s", until.UTC().Format(time.RFC3339), reason)
+	return true, nil
+}
+
+// recordUsage increments the counter for the outcome in the current hour
+func recordUsage(keyID, outcome string, now time.Time) error {
+	key := keyUsageBucket(keyID, now)
+	err := common.RedisPool.Do(radix.Pipeline(
+		radix.Cmd(nil, "HINCRBY", key, outcome, "1"),
+		radix.Cmd(nil, "EXPIRE", key, strconv.Itoa(int(usageRetention.Seconds()))),
+	))
+	return errors.WithStackIf(err)
+}
+
+// UsageBucket is the usage of a key within a single hour
+type UsageBucket struct {
+	Start       time.Time `json:"start"`
+	OK          int64     `json:"ok"`
+	Errors      int64     `json:"errors"`
+	Ratelimited int64     `json:"ratelimited"`
+}
+
+// Total returns the number of requests regardless of outcome
+func (b *UsageBucket) Total() int64 {
+	return b.OK + b.Errors + b.Ratelimited
+}
+
+// GetKeyUsage returns the hourly usage buckets of the key for the last n hours, oldest first
+func GetKeyUsage(keyID string, hours int) ([]*UsageBucket, error) {
+	now := time.Now().Truncate(time.Hour)
+
+	buckets := make([]*UsageBucket, hours)
+	raw := make([]map[string]string, hours)
+	cmds := make([]radix.CmdAction, hours)
+
+	for i := 0; i < hours; i++ {
+		start := now.Add(-time.Hour * time.Duration(hours-1-i))
+		buckets[i] = &UsageBucket{Start: start}
+		cmds[i] = radix.Cmd(&raw[i], "HGETALL", keyUsageBucket(keyID, start))
+	}
+
+	err := common.RedisPool.Do(radix.Pipeline(cmds...))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	for i, fields := range raw {
+		for k, v := range fields {
+			parsed, _ := strconv.ParseInt(v, 10, 64)
+			switch k {
+			case apiusage.OutcomeOK:
+				buckets[i].OK = parsed
+			case apiusage.OutcomeError:
+				buckets[i].Errors = parsed
+			case apiusage.OutcomeRatelimited:
+				buckets[i].Ratelimited = parsed
+			}
+		}
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,60 @@
+package publicapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckQuota(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 30, 20, 0, time.UTC)
+	nextMinute := time.Date(2024, 3, 10, 15, 31, 0, 0, time.UTC)
+	nextDay := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		minute, day        int
+		perMinute, perDay  int
+		allowed, daily     bool
+		remaining, dayLeft int
+		reset              time.Time
+	}{
+		{1, 1, 60, 1000, true, false, 59, 999, nextMinute},
+		{60, 60, 60, 1000, true, false, 0, 940, nextMinute},
+		{61, 61, 60, 1000, false, false, 0, 939, nextMinute},
+		{5, 1001, 60, 1000, false, true, 55, 0, nextDay},
+		// no limits
+		{500, 50000, 0, 0, true, false, 0, 0, nextMinute},
+	}
+
+	for _, c := range cases {
+		q := checkQuota(c.minute, c.day, c.perMinute, c.perDay, now)
+		if q.Allowed != c.allowed || q.Daily != c.daily {
+			t.Errorf("%d/%d requests with limits %d/%d: got allowed %v daily %v, want %v %v", c.minute, c.day, c.perMinute, c.perDay, q.Allowed, q.Daily, c.allowed, c.daily)
+		}
+
+		if q.MinuteRemaining != c.remaining || q.DayRemaining != c.dayLeft {
+			t.Errorf("%d/%d requests with limits %d/%d: got %d/%d remaining, want %d/%d", c.minute, c.day, c.perMinute, c.perDay, q.MinuteRemaining, q.DayRemaining, c.remaining, c.dayLeft)
+		}
+
+		if !q.Reset.Equal(c.reset) {
+			t.Errorf("%d/%d requests with limits %d/%d: got reset %s, want %s", c.minute, c.day, c.perMinute, c.perDay, q.Reset, c.reset)
+		}
+	}
+}
+
+func TestDeveloperKeySuspended(t *testing.T) {
+	now := time.Now()
+
+	k := &DeveloperKey{}
+	if k.Suspended(now) {
+		t.Error("a key that was never suspended is suspended")
+	}
+
+	k.SuspendedUntil = now.Add(time.Hour)
+	if !k.Suspended(now) {
+		t.Error("expected the key to be suspended")
+	}
+
+	if k.Suspended(now.Add(time.Hour * 2)) {
+		t.Error("expected the suspension to be over")
+	}
+}
@@ -0,0 +1,498 @@
+package publicapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/apiusage"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/customcommands"
+	"github.com/botlabs-gg/yagpdb/v2/customcommands/models"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/botlabs-gg/yagpdb/v2/reputation"
+	"github.com/botlabs-gg/yagpdb/v2/serverstats"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"goji.io"
+	"goji.io/pat"
+)
+
+//go:embed assets/public_api.html
+var PageHTML string
+
+var (
+	panelLogKeyEnabled  = cplogs.RegisterActionFormat(&cplogs.ActionFormat{Key: "public_api_enabled", FormatString: "Allowed access to the server through the public api"})
+	panelLogKeyDisabled = cplogs.RegisterActionFormat(&cplogs.ActionFormat{Key: "public_api_disabled", FormatString: "Disallowed access to the server through the public api"})
+)
+
+// hours of usage shown for each key in the developer portal
+const usageDashboardHours = 24
+
+var _ web.Plugin = (*Plugin)(nil)
+
+func (p *Plugin) InitWeb() {
+	web.AddHTMLTemplate("publicapi/assets/public_api.html", PageHTML)
+
+	web.AddSidebarItem(web.SidebarCategoryCore, &web.SidebarItem{
+		Name: "Public API",
+		URL:  "public_api",
+		Icon: "fas fa-code",
+	})
+
+	// developer portal
+	portalHandler := web.ControllerHandler(handleGetPortal, "public_api_portal")
+	web.RootMux.Handle(pat.Get("/developers"), web.RequireSessionMiddleware(portalHandler))
+	web.RootMux.Handle(pat.Get("/developers/"), web.RequireSessionMiddleware(portalHandler))
+	web.RootMux.Handle(pat.Post("/developers/keys/new"), web.RequireSessionMiddleware(web.ControllerPostHandler(handleCreateKey, portalHandler, CreateKeyForm{})))
+	web.RootMux.Handle(pat.Post("/developers/keys/:key/delete"), web.RequireSessionMiddleware(web.ControllerPostHandler(handleDeleteKey, portalHandler, nil)))
+	web.RootMux.Handle(pat.Get("/developers/docs"), web.CachedPage("public_api_docs", 0, web.ControllerHandler(handleGetDocs, "public_api_docs")))
+	web.CacheLoggedOutPage("/developers/docs", "public_api_docs", handleGetDocs)
+
+	// the api itself, only usable with a developer key
+	mux := goji.SubMux()
+	web.RootMux.Handle(pat.New("/public-api/v1/*"), mux)
+	mux.Use(developerKeyMW)
+
+	guildMux := goji.SubMux()
+	mux.Handle(pat.New("/guilds/:server"), guildMux)
+	mux.Handle(pat.New("/guilds/:server/*"), guildMux)
+	guildMux.Use(web.ActiveServerMW)
+	guildMux.Use(requireGuildEnabledMW)
+
+	routes := web.NewAPIRoutes(guildMux, "/public-api/v1/guilds/:server", "Public API")
+	routes.Handle(pat.Get(""), handleGetGuild, &web.APIDoc{
+		Summary:  "The basic info of the server",
+		Response: &PublicGuild{},
+	})
+	routes.Handle(pat.Get("/stats"), handleGetStats, &web.APIDoc{
+		Summary:  "The stats of the last day, only for servers with public stats",
+		Response: &serverstats.DailyStats{},
+	})
+	routes.Handle(pat.Get("/leaderboard"), handleGetLeaderboard, &web.APIDoc{
+		Summary: "The reputation leaderboard",
+		Query: []web.APIParam{
+			{Name: "offset", Description: "The amount of users to skip"},
+			{Name: "limit", Description: "The amount of users to return, at most 100"},
+		},
+		Response: []*reputation.LeaderboardEntry{},
+	})
+	routes.Handle(pat.Get("/commands"), handleGetCommands, &web.APIDoc{
+		Summary:  "The enabled custom commands, only how they're triggered",
+		Response: []*PublicCommand{},
+	})
+
+	// opting in on the control panel
+	settingsHandler := web.ControllerHandler(handleGetSettings, "cp_public_api")
+	web.CPMux.Handle(pat.Get("/public_api"), settingsHandler)
+	web.CPMux.Handle(pat.Get("/public_api/"), settingsHandler)
+	web.CPMux.Handle(pat.Post("/public_api"), web.ControllerPostHandler(handlePostSettings, settingsHandler, SettingsForm{}))
+}
+
+// writeAPIError responds with a json error, handlers return nil after calling it
+func writeAPIError(w http.ResponseWriter, status int, msg string, extra map[string]interface{}) {
+	out := map[string]interface{}{"ok": false, "error": msg}
+	for k, v := range extra {
+		out[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	web.LogIgnoreErr(json.NewEncoder(w).Encode(out))
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(header[7:])
+}
+
+// isRejection returns true for responses that count towards suspending the key, requests over the quota or for
+// servers that didn't opt in
+func isRejection(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusNotFound || status == http.StatusForbidden
+}
+
+// developerKeyMW authenticates the request with the developer key in the Authorization header and applies its
+// quotas, counting the usage shown in the developer portal
+func developerKeyMW(inner http.Handler) http.Handler {
+	return web.NamedMiddleware("developer_key", inner, func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		plain := bearerToken(r)
+		if plain == "" {
+			writeAPIError(w, http.StatusUnauthorized, "missing developer key, send it in the Authorization: Bearer <key> header", nil)
+			return
+		}
+
+		key, err := ValidateKey(plain)
+		if err != nil {
+			web.CtxLogger(ctx).WithError(err).Error("failed validating developer key")
+			writeAPIError(w, http.StatusInternalServerError, "failed validating developer key", nil)
+			return
+		}
+
+		if key == nil {
+			writeAPIError(w, http.StatusUnauthorized, "invalid developer key", nil)
+			return
+		}
+
+		now := time.Now()
+		if key.Suspended(now) {
+			writeAPIError(w, http.StatusForbidden, "developer key suspended: "+key.SuspendedReason, map[string]interface{}{
+				"code":            "suspended",
+				"suspended_until": key.SuspendedUntil.UTC(),
+			})
+			return
+		}
+
+		entry := web.CtxLogger(ctx).WithField("developer_key", key.ID)
+		ctx = context.WithValue(ctx, common.ContextKeyLogger, entry)
+
+		recorder := web.NewStatusRecorder(w)
+		defer func() {
+			recordRequest(ctx, key, recorder.Status, now)
+		}()
+
+		quota, err := takeQuota(key, now)
+		if err != nil {
+			entry.WithError(err).Error("failed checking developer key quota")
+			writeAPIError(recorder, http.StatusInternalServerError, "failed checking quota", nil)
+			return
+		}
+
+		setQuotaHeaders(w.Header(), quota, now)
+		if !quota.Allowed {
+			msg := "ratelimited, slow down"
+			if quota.Daily {
+				msg = "daily quota used up"
+			}
+
+			writeAPIError(recorder, http.StatusTooManyRequests, msg, map[string]interface{}{"code": "ratelimited"})
+			return
+		}
+
+		inner.ServeHTTP(recorder, r.WithContext(ctx))
+	})
+}
+
+func setQuotaHeaders(h http.Header, quota *quotaResult, now time.Time) {
+	if quota.MinuteLimit > 0 {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(quota.MinuteLimit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(quota.MinuteRemaining))
+	}
+
+	if quota.DayLimit > 0 {
+		h.Set("X-RateLimit-Daily-Limit", strconv.Itoa(quota.DayLimit))
+		h.Set("X-RateLimit-Daily-Remaining", strconv.Itoa(quota.DayRemaining))
+	}
+
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(quota.Reset.Unix(), 10))
+	if !quota.Allowed {
+		retryAfter := int(quota.Reset.Sub(now).Seconds()) + 1
+		h.Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+}
+
+// recordRequest counts the request in the usage of the key, and towards suspending it if it was rejected
+func recordRequest(ctx context.Context, key *DeveloperKey, status int, now time.Time) {
+	err := recordUsage(key.ID, apiusage.OutcomeFromStatus(status), now)
+	if err != nil {
+		web.CtxLogger(ctx).WithError(err).Error("failed recording developer key usage")
+	}
+
+	if !isRejection(status) {
+		return
+	}
+
+	_, err = recordRejection(key, now)
+	if err != nil {
+		web.CtxLogger(ctx).WithError(err).Error("failed recording rejected developer key request")
+	}
+}
+
+// requireGuildEnabledMW only lets requests through for servers that opted in to the public api, the others look
+// the same as servers the bot isn't on
+func requireGuildEnabledMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g, ok := r.Context().Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet)
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "unknown server, or it doesn't allow access through the public api", nil)
+			return
+		}
+
+		enabled, err := GuildEnabled(g.ID)
+		if err != nil {
+			web.CtxLogger(r.Context()).WithError(err).Error("failed checking if the server allows public api access")
+			writeAPIError(w, http.StatusInternalServerError, "failed retrieving server", nil)
+			return
+		}
+
+		if !enabled {
+			writeAPIError(w, http.StatusNotFound, "unknown server, or it doesn't allow access through the public api", nil)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// PublicGuild is the basic info of a server returned by the public api
+type PublicGuild struct {
+	ID          int64  `json:"id,string"`
+	Name        string `json:"name"`
+	Icon        string `json:"icon,omitempty"`
+	MemberCount int64  `json:"member_count"`
+}
+
+// handleGetGuild handles GET /public-api/v1/guilds/:server
+func handleGetGuild(w http.ResponseWriter, r *http.Request) interface{} {
+	g := web.ContextGuild(r.Context())
+	return &PublicGuild{
+		ID:          g.ID,
+		Name:        g.Name,
+		Icon:        g.Icon,
+		MemberCount: g.MemberCount,
+	}
+}
+
+// handleGetStats handles GET /public-api/v1/guilds/:server/stats, only for servers with public stats
+func handleGetStats(w http.ResponseWriter, r *http.Request) interface{} {
+	g := web.ContextGuild(r.Context())
+
+	conf := serverstats.GetConfigWeb(g.ID)
+	if conf == nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed retrieving stats settings", nil)
+		return nil
+	}
+
+	if !conf.Public {
+		writeAPIError(w, http.StatusForbidden, "the server's stats aren't public", nil)
+		return nil
+	}
+
+	stats, err := serverstats.RetrieveDailyStats(time.Now(), g.ID)
+	if err != nil {
+		return err
+	}
+
+	return stats
+}
+
+// handleGetLeaderboard handles GET /public-api/v1/guilds/:server/leaderboard?offset=&limit=
+func handleGetLeaderboard(w http.ResponseWriter, r *http.Request) interface{} {
+	g := web.ContextGuild(r.Context())
+
+	conf, err := reputation.GetConfig(r.Context(), g.ID)
+	if err != nil {
+		return err
+	}
+
+	if !conf.Enabled {
+		writeAPIError(w, http.StatusNotFound, "reputation isn't enabled on the server", nil)
+		return nil
+	}
+
+	offset, limit := parsePagination(r, 10, 100)
+	top, err := reputation.TopUsers(g.ID, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	entries, err := reputation.DetailedLeaderboardEntries(g.ID, top)
+	if err != nil {
+		return err
+	}
+
+	return entries
+}
+
+// parsePagination returns the offset and limit query params, the limit is clamped to max
+func parsePagination(r *http.Request, defaultLimit, max int) (offset, limit int) {
+	query := r.URL.Query()
+
+	offset, _ = strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	limit, _ = strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = defaultLimit
+	} else if limit > max {
+		limit = max
+	}
+
+	return offset, limit
+}
+
+// PublicCommand is a custom command as returned by the public api, only how it's triggered and not what it does
+type PublicCommand struct {
+	ID            int64  `json:"id"`
+	TriggerType   string `json:"trigger_type"`
+	Trigger       string `json:"trigger,omitempty"`
+	CaseSensitive bool   `json:"case_sensitive"`
+}
+
+// handleGetCommands handles GET /public-api/v1/guilds/:server/commands, listing the enabled custom commands
+func handleGetCommands(w http.ResponseWriter, r *http.Request) interface{} {
+	g := web.ContextGuild(r.Context())
+
+	ccs, err := models.CustomCommands(qm.Where("guild_id = ? AND disabled = false", g.ID), qm.OrderBy("local_id")).AllG(r.Context())
+	if err != nil {
+		return err
+	}
+
+	result := make([]*PublicCommand, 0, len(ccs))
+	for _, cc := range ccs {
+		result = append(result, &PublicCommand{
+			ID:            cc.LocalID,
+			TriggerType:   customcommands.CommandTriggerType(cc.TriggerType).String(),
+			Trigger:       cc.TextTrigger,
+			CaseSensitive: cc.TextTriggerCaseSensitive,
+		})
+	}
+
+	return result
+}
+
+// keyOverview is a developer key with its usage, as shown in the portal
+type keyOverview struct {
+	*DeveloperKey
+	Usage      []*UsageBucket
+	UsageTotal int64
+	Today      int
+	// SuspendedNow is true if the key is suspended at the moment, the suspension info is kept after it ends
+	SuspendedNow bool
+}
+
+// handleGetPortal handles GET /developers
+func handleGetPortal(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx, tmpl := web.GetCreateTemplateData(r.Context())
+
+	keys, err := GetUserKeys(web.ContextUser(ctx).ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	now := time.Now()
+	overviews := make([]*keyOverview, 0, len(keys))
+	for _, k := range keys {
+		usage, err := GetKeyUsage(k.ID, usageDashboardHours)
+		if err != nil {
+			return tmpl, err
+		}
+
+		today, err := getDayCount(k.ID, now)
+		if err != nil {
+			return tmpl, err
+		}
+
+		overview := &keyOverview{DeveloperKey: k, Usage: usage, Today: today, SuspendedNow: k.Suspended(now)}
+		for _, b := range usage {
+			overview.UsageTotal += b.Total()
+		}
+		overviews = append(overviews, overview)
+	}
+
+	tmpl["DeveloperKeys"] = overviews
+	tmpl["MaxDeveloperKeys"] = maxKeysPerUser
+	tmpl["UsageHours"] = usageDashboardHours
+	addQuotaTemplateData(tmpl)
+	return tmpl, nil
+}
+
+func addQuotaTemplateData(tmpl web.TemplateData) {
+	tmpl["RequestsPerMinute"] = confRequestsPerMinute.GetInt()
+	tmpl["RequestsPerDay"] = confRequestsPerDay.GetInt()
+	tmpl["SuspensionHours"] = confSuspensionHours.GetInt()
+}
+
+type CreateKeyForm struct {
+	Name        string `valid:",1,100"`
+	Description string `valid:",1,500"`
+	AcceptTerms bool
+}
+
+// handleCreateKey handles POST /developers/keys/new, the signup for new developers is creating their first key
+func handleCreateKey(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx, tmpl := web.GetCreateTemplateData(r.Context())
+	tmpl.SetVisibleURL("/developers")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*CreateKeyForm)
+	if !form.AcceptTerms {
+		return tmpl, web.NewPublicError("You have to accept the api terms to get a developer key")
+	}
+
+	user := web.ContextUser(ctx)
+	plain, key, err := CreateKey(user.ID, form.Name, form.Description)
+	if err != nil {
+		return tmpl, err
+	}
+
+	logger.WithField("user", user.ID).WithField("key", key.ID).Infof("Created developer key %q", key.Name)
+	tmpl["NewDeveloperKey"] = plain
+	return tmpl, nil
+}
+
+// handleDeleteKey handles POST /developers/keys/:key/delete
+func handleDeleteKey(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx, tmpl := web.GetCreateTemplateData(r.Context())
+	tmpl.SetVisibleURL("/developers")
+
+	err := DeleteKey(web.ContextUser(ctx).ID, pat.Param(r, "key"))
+	return tmpl, err
+}
+
+// handleGetDocs handles GET /developers/docs
+func handleGetDocs(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, tmpl := web.GetCreateTemplateData(r.Context())
+	addQuotaTemplateData(tmpl)
+	tmpl["AbuseThreshold"] = confAbuseThreshold.GetInt()
+	return tmpl, nil
+}
+
+type SettingsForm struct {
+	Enabled bool
+}
+
+// handleGetSettings handles GET /manage/:server/public_api
+func handleGetSettings(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	g, tmpl := web.GetBaseCPContextData(r.Context())
+
+	enabled, err := GuildEnabled(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["PublicAPIEnabled"] = enabled
+	return tmpl, nil
+}
+
+// handlePostSettings handles POST /manage/:server/public_api
+func handlePostSettings(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := web.GetBaseCPContextData(ctx)
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*SettingsForm)
+	err := SetGuildEnabled(g.ID, form.Enabled)
+	if err != nil {
+		return tmpl, err
+	}
+
+	logKey := panelLogKeyDisabled
+	if form.Enabled {
+		logKey = panelLogKeyEnabled
+	}
+
+	go cplogs.RetryAddEntry(web.NewLogEntryFromContext(ctx, logKey))
+	return tmpl, nil
+}
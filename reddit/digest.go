@@ -0,0 +1,27 @@
+package reddit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/reddit/models"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithDigest = (*Plugin)(nil)
+
+// Digest implements web.PluginWithDigest, listing the feeds that were disabled as the bot couldn't post in their channel
+func (p *Plugin) Digest(ctx context.Context, guildID int64, from, to time.Time) ([]*web.DigestSection, error) {
+	feeds, err := models.RedditFeeds(models.RedditFeedWhere.GuildID.EQ(guildID), models.RedditFeedWhere.Disabled.EQ(true)).AllG(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	section := &web.DigestSection{Title: "Reddit feeds", Link: "/reddit", Warning: len(feeds) > 0}
+	for _, v := range feeds {
+		section.Lines = append(section.Lines, fmt.Sprintf("r/%s in channel %d is disabled, the bot couldn't post in it", v.Subreddit, v.ChannelID))
+	}
+
+	return []*web.DigestSection{section}, nil
+}
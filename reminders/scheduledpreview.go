@@ -0,0 +1,32 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithScheduledActions = (*Plugin)(nil)
+
+// ScheduledActions implements web.PluginWithScheduledActions
+func (p *Plugin) ScheduledActions(ctx context.Context, guildID int64, from, to time.Time) ([]*web.ScheduledAction, error) {
+	var reminders []*Reminder
+	err := common.GORM.Where(`guild_id = ? AND "when" >= ? AND "when" < ?`, guildID, from.Unix(), to.Unix()).Order(`"when" asc`).Find(&reminders).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*web.ScheduledAction, 0, len(reminders))
+	for _, v := range reminders {
+		result = append(result, &web.ScheduledAction{
+			At:          time.Unix(v.When, 0),
+			Plugin:      "Reminders",
+			Description: fmt.Sprintf("Remind user %s in channel %s: %s", v.UserID, v.ChannelID, common.CutStringShort(v.Message, 100)),
+		})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,29 @@
+package reputation
+
+import (
+	"context"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithRoleConnectionMetadata = (*Plugin)(nil)
+
+func (p *Plugin) RoleConnectionMetadata() []*web.RoleConnectionMetadata {
+	return []*web.RoleConnectionMetadata{{
+		Key:         "reputation",
+		Name:        "Reputation",
+		Description: "Reputation points, combined across all servers",
+		Type:        web.RoleConnectionIntegerGreaterOrEqual,
+	}}
+}
+
+func (p *Plugin) RoleConnectionValues(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	var points int64
+	err := common.PQ.QueryRowContext(ctx, "SELECT COALESCE(sum(points), 0) FROM reputation_users WHERE user_id = $1", userID).Scan(&points)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"reputation": points}, nil
+}
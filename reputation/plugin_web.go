@@ -1,6 +1,7 @@
 package reputation
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"html"
@@ -88,8 +89,17 @@ func (p *Plugin) InitWeb() {
 	subMux.Handle(pat.Post("/reset_users"), web.ControllerPostHandler(HandleResetReputation, mainGetHandler, nil))
 	subMux.Handle(pat.Get("/logs"), web.APIHandler(HandleLogsJson))
 
-	web.ServerPublicMux.Handle(pat.Get("/reputation/leaderboard"), web.RenderHandler(HandleGetReputation, "cp_reputation_leaderboard"))
-	web.ServerPublicAPIMux.Handle(pat.Get("/reputation/leaderboard"), web.APIHandler(HandleLeaderboardJson))
+	web.ServerPublicMux.Handle(pat.Get("/reputation/leaderboard"), web.RenderHandler(HandleGetLeaderboard, "cp_reputation_leaderboard"))
+	publicAPIRoutes := web.NewAPIRoutes(web.ServerPublicAPIMux, "/api/:server", "Reputation")
+	publicAPIRoutes.Handle(pat.Get("/reputation/leaderboard"), HandleLeaderboardJson, &web.APIDoc{
+		Summary: "The reputation leaderboard of the server",
+		Query: []web.APIParam{
+			{Name: "offset", Description: "The amount of users to skip"},
+			{Name: "limit", Description: "The amount of users to return, at most 100"},
+		},
+		Response: []*LeaderboardEntry{},
+		Public:   true,
+	})
 }
 
 func HandleGetReputation(w http.ResponseWriter, r *http.Request) interface{} {
@@ -105,9 +115,64 @@ func HandleGetReputation(w http.ResponseWriter, r *http.Request) interface{} {
 	return templateData
 }
 
+// HandleGetLeaderboard renders a page of the leaderboard, it used to load the entries through the json api instead
+func HandleGetLeaderboard(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	settings, err := GetConfig(ctx, activeGuild.ID)
+	if web.CheckErr(templateData, err, "Failed retrieving settings", web.CtxLogger(ctx).Error) {
+		return templateData
+	}
+	templateData["RepSettings"] = settings
+	if !settings.Enabled {
+		return templateData
+	}
+
+	pagination := web.ParsePagination(r, web.DefaultPageSize)
+	total, err := CountUsers(ctx, activeGuild.ID)
+	if web.CheckErr(templateData, err, "Failed retrieving the leaderboard", web.CtxLogger(ctx).Error) {
+		return templateData
+	}
+	pagination.SetTotal(int(total))
+
+	top, err := TopUsers(activeGuild.ID, pagination.Offset(), pagination.Limit())
+	if web.CheckErr(templateData, err, "Failed retrieving the leaderboard", web.CtxLogger(ctx).Error) {
+		return templateData
+	}
+
+	if web.ExportFormat(r) != "" {
+		// exports have the whole leaderboard, too many users to look up
+		templateData.SetExport(leaderboardExport(activeGuild.ID, top))
+		return templateData
+	}
+
+	entries, err := DetailedLeaderboardEntries(activeGuild.ID, top)
+	if web.CheckErr(templateData, err, "Failed retrieving the users on the leaderboard", web.CtxLogger(ctx).Error) {
+		return templateData
+	}
+
+	templateData["Leaderboard"] = entries
+	templateData.SetPagination(pagination)
+	return templateData
+}
+
+func leaderboardExport(guildID int64, ranks []*RankEntry) *web.ExportTable {
+	table := &web.ExportTable{
+		Name:    "reputation-leaderboard-" + discordgo.StrID(guildID),
+		Columns: []string{"rank", "user_id", "points"},
+	}
+
+	for _, v := range ranks {
+		table.AddRow(v.Rank, discordgo.StrID(v.UserID), v.Points)
+	}
+
+	return table
+}
+
 func HandlePostReputation(w http.ResponseWriter, r *http.Request) (templateData web.TemplateData, err error) {
 	activeGuild, templateData := web.GetBaseCPContextData(r.Context())
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(activeGuild.ID) + "/reputation"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(activeGuild.ID) + "/reputation")
 
 	form := r.Context().Value(common.ContextKeyParsedForm).(*PostConfigForm)
 	conf := form.RepConfig()
@@ -141,7 +206,7 @@ func HandlePostReputation(w http.ResponseWriter, r *http.Request) (templateData
 
 func HandleResetReputation(w http.ResponseWriter, r *http.Request) (templateData web.TemplateData, err error) {
 	activeGuild, templateData := web.GetBaseCPContextData(r.Context())
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(activeGuild.ID) + "/reputation"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(activeGuild.ID) + "/reputation")
 
 	_, err = models.ReputationUsers(qm.Where("guild_id = ?", activeGuild.ID)).DeleteAll(r.Context(), common.PQ)
 	if err == nil {
@@ -264,3 +329,30 @@ func (p *Plugin) LoadServerHomeWidget(w http.ResponseWriter, r *http.Request) (w
 
 	return templateData, nil
 }
+
+var _ web.PluginWithToggle = (*Plugin)(nil)
+
+func (p *Plugin) PluginEnabled(ctx context.Context, guildID int64) (bool, error) {
+	conf, err := GetConfig(ctx, guildID)
+	if err != nil {
+		return false, err
+	}
+
+	return conf.Enabled, nil
+}
+
+func (p *Plugin) SetPluginEnabled(ctx context.Context, guildID int64, enabled bool) error {
+	conf, err := GetConfig(ctx, guildID)
+	if err != nil {
+		return err
+	}
+
+	conf.Enabled = enabled
+	err = conf.UpsertG(ctx, true, []string{"guild_id"}, boil.Whitelist("enabled"), boil.Infer())
+	if err != nil {
+		return err
+	}
+
+	featureflags.MarkGuildDirty(guildID)
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/bot/botrest"
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/featureflags"
+	"github.com/botlabs-gg/yagpdb/v2/common/ignorelist"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
 	"github.com/botlabs-gg/yagpdb/v2/reputation/models"
@@ -127,6 +128,11 @@ LIMIT $2 OFFSET $3`
 	return result, nil
 }
 
+// CountUsers returns the amount of users on the leaderboard of the guild
+func CountUsers(ctx context.Context, guildID int64) (int64, error) {
+	return models.ReputationUsers(models.ReputationUserWhere.GuildID.EQ(guildID)).CountG(ctx)
+}
+
 type UserError string
 
 func (b UserError) Error() string {
@@ -139,6 +145,7 @@ var (
 
 	ErrBlacklistedGive    = UserError("Blacklisted from giving points")
 	ErrBlacklistedReceive = UserError("Blacklisted from receiving points")
+	ErrIgnoredReceiver    = UserError("This bot is ignored by the reputation system")
 	ErrCooldown           = UserError("You're still on cooldown")
 )
 
@@ -217,6 +224,10 @@ DO UPDATE SET points = reputation_users.points + $4;
 // Returns a user error if the sender can not modify the rep of receiver
 // Admins are always able to modify the rep of everyone
 func CanModifyRep(conf *models.ReputationConfig, sender, receiver *dstate.MemberState) error {
+	if receiver.User.Bot && ignorelist.IsIgnored(receiver.GuildID, receiver.User.ID, ignorelist.FeatureReputation) {
+		return ErrIgnoredReceiver
+	}
+
 	if common.ContainsInt64SliceOneOf(sender.Member.Roles, conf.AdminRoles) {
 		return nil
 	}
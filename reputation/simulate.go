@@ -0,0 +1,37 @@
+package reputation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithEventSimulation = (*Plugin)(nil)
+
+// SimulateEvent implements web.PluginWithEventSimulation, listing the rep thanks detection would give
+func (p *Plugin) SimulateEvent(ctx context.Context, evt *web.SimulatedEvent) ([]*web.SimulatedAction, error) {
+	if evt.Type != web.SimulatedEventMessage || len(evt.Message.Mentions) < 1 {
+		return nil, nil
+	}
+
+	conf, err := GetConfig(ctx, evt.GS.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !conf.Enabled || conf.DisableThanksDetection {
+		return nil, nil
+	}
+
+	if !thanksRegex.MatchString(evt.Message.Content) || !isThanksDetectionAllowedInChannel(conf, evt.Channel.ID) {
+		return nil, nil
+	}
+
+	// the roles of the receiver and the cooldown are only known when it actually happens
+	return []*web.SimulatedAction{{
+		Plugin:      p.PluginInfo().Name,
+		Description: fmt.Sprintf("Give +1 %s to <@%d>, unless they can't receive it or it's on cooldown", conf.PointsName, evt.Message.Mentions[0].ID),
+		Link:        "/reputation",
+	}}, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/backgroundworkers"
 	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/pluginhealth"
 	"github.com/botlabs-gg/yagpdb/v2/premium"
 	"github.com/botlabs-gg/yagpdb/v2/serverstats/messagestatscollector"
 	"github.com/mediocregopher/radix/v3"
@@ -25,6 +26,18 @@ var (
 
 var _ backgroundworkers.BackgroundWorkerPlugin = (*Plugin)(nil)
 
+const healthCheckCompressor = "serverstats_compressor"
+
+var _ pluginhealth.PluginWithHealthChecks = (*Plugin)(nil)
+
+func (p *Plugin) HealthChecks() []*pluginhealth.Check {
+	return []*pluginhealth.Check{{
+		Name:        healthCheckCompressor,
+		Description: "Compresses the stats of the previous days",
+		MaxInterval: time.Hour * 50,
+	}}
+}
+
 func (p *Plugin) RunBackgroundWorker() {
 	compressorLegacy := &Compressor{}
 	go compressorLegacy.runLoopLegacy(p)
@@ -53,12 +66,16 @@ func (c *Compressor) runLoop(p *Plugin) {
 
 	for {
 		// find the next time we should run a compression
-		_, wait, err := c.updateCompress(time.Now(), false)
+		ran, wait, err := c.updateCompress(time.Now(), false)
 		if err != nil {
 			wait = time.Second
 			logger.WithError(err).Errorf("failed compressing stats: %+v", err)
 		}
 
+		if ran || err != nil {
+			pluginhealth.Report(healthCheckCompressor, err)
+		}
+
 		logger.Info("wait is ", wait)
 		after := time.After(wait)
 
@@ -0,0 +1,50 @@
+package serverstats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithDigest = (*Plugin)(nil)
+
+// Digest implements web.PluginWithDigest, summarizing the joins, leaves and messages of the days within the range
+func (p *Plugin) Digest(ctx context.Context, guildID int64, from, to time.Time) ([]*web.DigestSection, error) {
+	days := int(to.Sub(from).Hours()/24) + 1
+	periods, err := RetrieveChartDataPeriods(ctx, guildID, to, days)
+	if err != nil {
+		return nil, err
+	}
+
+	var joins, leaves, messages, members int
+	for _, v := range periods {
+		if v.T.Before(from) {
+			continue
+		}
+
+		joins += v.Joins
+		leaves += v.Leaves
+		messages += v.Messages
+
+		// newest first
+		if members == 0 {
+			members = v.NumMembers
+		}
+	}
+
+	section := &web.DigestSection{Title: "Growth", Link: "/stats"}
+	if joins > 0 || leaves > 0 || messages > 0 {
+		section.Lines = []string{
+			fmt.Sprintf("%d members joined and %d left (%+d)", joins, leaves, joins-leaves),
+			fmt.Sprintf("%d messages sent", messages),
+		}
+
+		if members > 0 {
+			section.Lines = append(section.Lines, fmt.Sprintf("%d members in total", members))
+		}
+	}
+
+	return []*web.DigestSection{section}, nil
+}
@@ -25,6 +25,9 @@ import (
 //go:embed assets/soundboard.html
 var PageHTML string
 
+// max size of uploaded and downloaded sound files
+const maxSoundFileSize = 10000000
+
 type PostForm struct {
 	ID   int
 	Name string `valid:",100"`
@@ -68,7 +71,8 @@ func (p *Plugin) InitWeb() {
 
 	cpMux.Handle(pat.Get("/"), getHandler)
 	//cpMux.Handle(pat.Get(""), getHandler)
-	cpMux.Handle(pat.Post("/new"), web.ControllerPostHandler(HandleNew, getHandler, PostForm{}))
+	// with room for the rest of the form
+	cpMux.Handle(pat.Post("/new"), web.MaxBodyBytes(maxSoundFileSize+100000)(web.ControllerPostHandler(HandleNew, getHandler, PostForm{})))
 	cpMux.Handle(pat.Post("/update"), web.ControllerPostHandler(HandleUpdate, getHandler, PostForm{}))
 	cpMux.Handle(pat.Post("/delete"), web.ControllerPostHandler(HandleDelete, getHandler, PostForm{}))
 }
@@ -161,7 +165,7 @@ func HandleNew(w http.ResponseWriter, r *http.Request) (web.TemplateData, error)
 
 	tooBig := false
 	if file != nil {
-		tooBig, err = DownloadNewSoundFile(file, destFile, 10000000)
+		tooBig, err = DownloadNewSoundFile(file, destFile, maxSoundFileSize)
 	} else if r.FormValue("SoundURL") != "" {
 		var resp *http.Response
 		resp, err = http.Get(r.FormValue("SoundURL"))
@@ -170,7 +174,7 @@ func HandleNew(w http.ResponseWriter, r *http.Request) (web.TemplateData, error)
 			destFile.Close()
 		} else {
 			defer resp.Body.Close()
-			tooBig, err = DownloadNewSoundFile(resp.Body, destFile, 10000000)
+			tooBig, err = DownloadNewSoundFile(resp.Body, destFile, maxSoundFileSize)
 		}
 	} else {
 		err = errors.New("No sound!?")
@@ -3,6 +3,7 @@ package listroles
 import (
 	"fmt"
 
+	"github.com/botlabs-gg/yagpdb/v2/bot/paginatedmessages"
 	"github.com/botlabs-gg/yagpdb/v2/commands"
 	"github.com/botlabs-gg/yagpdb/v2/lib/dcmd"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
@@ -39,6 +40,12 @@ var Command = &commands.YAGCommand{
 		outFinal = fmt.Sprintf("Total role count: %d\n", counter)
 		outFinal += "(ME = mention everyone perms)\n"
 		outFinal += out
-		return outFinal, nil
+
+		if data.Context().Value(paginatedmessages.CtxKeyNoPagination) != nil {
+			return outFinal, nil
+		}
+
+		// servers with a lot of roles easily go over the message limit
+		return nil, paginatedmessages.SendText(data.GuildData.GS.ID, data.ChannelID, "Roles", outFinal)
 	},
 }
@@ -73,7 +73,7 @@ func baseData(inner http.Handler) http.Handler {
 func HandlePostStreaming(w http.ResponseWriter, r *http.Request) interface{} {
 	ctx := r.Context()
 	guild, tmpl := web.GetBaseCPContextData(ctx)
-	tmpl["VisibleURL"] = "/manage/" + discordgo.StrID(guild.ID) + "/streaming/"
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(guild.ID) + "/streaming/")
 
 	ok := ctx.Value(common.ContextKeyFormOk).(bool)
 	newConf := ctx.Value(common.ContextKeyParsedForm).(*Config)
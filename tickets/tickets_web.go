@@ -1,6 +1,7 @@
 package tickets
 
 import (
+	"context"
 	"database/sql"
 	_ "embed"
 	"fmt"
@@ -131,3 +132,29 @@ func (p *Plugin) LoadServerHomeWidget(w http.ResponseWriter, r *http.Request) (w
 
 	return templateData, nil
 }
+
+var _ web.PluginWithToggle = (*Plugin)(nil)
+
+func (p *Plugin) PluginEnabled(ctx context.Context, guildID int64) (bool, error) {
+	settings, err := models.FindTicketConfigG(ctx, guildID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return settings.Enabled, nil
+}
+
+func (p *Plugin) SetPluginEnabled(ctx context.Context, guildID int64, enabled bool) error {
+	model := &models.TicketConfig{GuildID: guildID, Enabled: enabled}
+	err := model.UpsertG(ctx, true, []string{"guild_id"}, boil.Whitelist("enabled"), boil.Infer())
+	if err != nil {
+		return err
+	}
+
+	commands.PubsubSendUpdateSlashCommandsPermissions(guildID)
+	return nil
+}
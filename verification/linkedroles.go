@@ -0,0 +1,40 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+)
+
+var _ web.PluginWithRoleConnectionMetadata = (*Plugin)(nil)
+
+func (p *Plugin) RoleConnectionMetadata() []*web.RoleConnectionMetadata {
+	return []*web.RoleConnectionMetadata{{
+		Key:         "verified",
+		Name:        "Verified",
+		Description: "Passed the verification of a server",
+		Type:        web.RoleConnectionBooleanEqual,
+	}, {
+		Key:         "verified_since",
+		Name:        "Days since verifying",
+		Description: "Days since first passing the verification of a server",
+		Type:        web.RoleConnectionDatetimeGreaterOrEqual,
+	}}
+}
+
+func (p *Plugin) RoleConnectionValues(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	var first sql.NullTime
+	err := common.PQ.QueryRowContext(ctx, "SELECT min(verified_at) FROM verified_users WHERE user_id = $1", userID).Scan(&first)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{"verified": first.Valid}
+	if first.Valid {
+		result["verified_since"] = first.Time
+	}
+
+	return result, nil
+}
@@ -5,10 +5,9 @@ package verification
 import (
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/web"
 )
 
-var confGoogleReCAPTCHASiteKey = config.RegisterOption("yagpdb.google.recaptcha_site_key", "Google reCAPTCHA site key", "")
-var confGoogleReCAPTCHASecret = config.RegisterOption("yagpdb.google.recaptcha_secret", "Google reCAPTCHA site secret", "")
 var confVerificationTrackIPs = config.RegisterOption("yagpdb.verification.track_ips", "Track verified users ip", true)
 
 type Plugin struct{}
@@ -25,8 +24,8 @@ var logger = common.GetPluginLogger(&Plugin{})
 
 func RegisterPlugin() {
 
-	if confGoogleReCAPTCHASecret.GetString() == "" || confGoogleReCAPTCHASiteKey.GetString() == "" {
-		logger.Warn("no YAGPDB_GOOGLE_RECAPTCHA_SECRET and/or YAGPDB_GOOGLE_RECAPTCHA_SITE_KEY provided, not enabling verification plugin")
+	if !web.CaptchaConfigured() {
+		logger.Warn("no captcha provider configured (YAGPDB_WEB_CAPTCHA_PROVIDER and its site key and secret), not enabling verification plugin")
 		return
 	}
 
@@ -3,12 +3,10 @@ package verification
 import (
 	"database/sql"
 	_ "embed"
-	"encoding/json"
 	"fmt"
 	"html"
 	"html/template"
 	"net/http"
-	"net/url"
 	"strconv"
 	"time"
 
@@ -18,9 +16,7 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2"
 	"github.com/botlabs-gg/yagpdb/v2/verification/models"
 	"github.com/botlabs-gg/yagpdb/v2/web"
-	"github.com/microcosm-cc/bluemonday"
 	"github.com/russross/blackfriday"
-	"github.com/sirupsen/logrus"
 	"github.com/volatiletech/null"
 	"github.com/volatiletech/sqlboiler/boil"
 	"goji.io/pat"
@@ -65,8 +61,8 @@ func (p *Plugin) InitWeb() {
 
 	getVerifyPageHandler := web.ControllerHandler(p.handleGetVerifyPage, "verification_verify_page")
 	postVerifyPageHandler := web.ControllerPostHandler(p.handlePostVerifyPage, getVerifyPageHandler, nil)
-	web.ServerPublicMux.Handle(pat.Get("/verify/:user_id/:token"), getVerifyPageHandler)
-	web.ServerPublicMux.Handle(pat.Post("/verify/:user_id/:token"), postVerifyPageHandler)
+	web.ServerPublicMux.Handle(pat.Get("/verify/:user_id/:token"), web.CaptchaMiddleware(getVerifyPageHandler))
+	web.ServerPublicMux.Handle(pat.Post("/verify/:user_id/:token"), web.CaptchaMiddleware(postVerifyPageHandler))
 }
 
 func (p *Plugin) handleGetSettings(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
@@ -169,17 +165,13 @@ func (p *Plugin) handleGetVerifyPage(w http.ResponseWriter, r *http.Request) (we
 		}
 	}
 
-	templateData["ExtraHead"] = template.HTML(`<script src="https://www.google.com/recaptcha/api.js" async defer></script>`)
-	templateData["GoogleReCaptchaSiteKey"] = confGoogleReCAPTCHASiteKey.GetString()
-
 	msg := settings.PageContent
 	if msg == "" {
 		msg = DefaultPageContent
 	}
 
 	unsafe := blackfriday.MarkdownCommon([]byte(msg))
-	html := bluemonday.UGCPolicy().SanitizeBytes(unsafe)
-	templateData["RenderedPageContent"] = template.HTML(html)
+	templateData["RenderedPageContent"] = web.SanitizeHTML(web.SanitizeUGC, string(unsafe))
 
 	return templateData, nil
 }
@@ -205,10 +197,7 @@ func (p *Plugin) handlePostVerifyPage(w http.ResponseWriter, r *http.Request) (w
 		return templateData, nil
 	}
 
-	valid, err := p.checkCAPTCHAResponse(r.FormValue("g-recaptcha-response"))
-	if err != nil {
-		logrus.WithError(err).Error("Failed recaptcha response")
-	}
+	valid := web.CaptchaPassed(ctx)
 
 	token := pat.Param(r, "token")
 	userID, _ := strconv.ParseInt(pat.Param(r, "user_id"), 10, 64)
@@ -254,7 +243,7 @@ func (p *Plugin) handlePostVerifyPage(w http.ResponseWriter, r *http.Request) (w
 		go analytics.RecordActiveUnit(g.ID, p, "completed")
 
 	} else {
-		templateData.AddAlerts(web.ErrorAlert("Invalid reCAPTCHA submission."))
+		templateData.AddAlerts(web.ErrorAlert("Invalid CAPTCHA submission."))
 	}
 
 	templateData["REValid"] = valid
@@ -262,53 +251,13 @@ func (p *Plugin) handlePostVerifyPage(w http.ResponseWriter, r *http.Request) (w
 	return templateData, err
 }
 
-type CheckCAPTCHAResponse struct {
-	Success     bool     `json:"success"`
-	ChallengeTS string   `json:"challenge_ts"`
-	Hostname    string   `json:"hostname"`
-	ErrorCodes  []string `json:"error-codes"`
-}
-
-type CheckCAPTCHARequest struct {
-	Secret   string `json:"secret"`
-	Response string `json:"response"`
-}
-
-func (p *Plugin) checkCAPTCHAResponse(response string) (valid bool, err error) {
-
-	v := url.Values{
-		"response": {response},
-		"secret":   {confGoogleReCAPTCHASecret.GetString()},
-	}
-
-	resp, err := http.PostForm("https://www.google.com/recaptcha/api/siteverify", v)
-	if err != nil {
-		return false, err
-	}
-
-	defer resp.Body.Close()
-
-	var dst CheckCAPTCHAResponse
-	decoder := json.NewDecoder(resp.Body)
-	err = decoder.Decode(&dst)
-	if err != nil {
-		return false, err
-	}
-
-	if !dst.Success {
-		logger.Warnf("reCAPTCHA failed: %#v", dst)
-	}
-
-	return dst.Success, nil
-}
-
 var _ web.PluginWithServerHomeWidget = (*Plugin)(nil)
 
 func (p *Plugin) LoadServerHomeWidget(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
 	ag, templateData := web.GetBaseCPContextData(r.Context())
 	ctx := r.Context()
 
-	templateData["WidgetTitle"] = "Google reCAPTCHA Verification"
+	templateData["WidgetTitle"] = "CAPTCHA Verification"
 	templateData["SettingsPath"] = "/verification"
 
 	settings, err := models.FindVerificationConfigG(ctx, ag.ID)
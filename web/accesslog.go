@@ -0,0 +1,317 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/natefinch/lumberjack"
+)
+
+var (
+	confAccessLogFormat = config.RegisterOption("yagpdb.web.access_log_format", "Format of the lines in the access log: goaccess, json or logfmt", "goaccess")
+
+	confAccessLogPath           = config.RegisterOption("yagpdb.web.access_log_path", "Path of the access log", "access.log")
+	confAccessLogMaxSize        = config.RegisterOption("yagpdb.web.access_log_max_size", "Size in megabytes at which the access log is rotated", 10)
+	confAccessLogRotateInterval = config.RegisterOption("yagpdb.web.access_log_rotate_hours", "Rotate the access log every this many hours regardless of its size, 0 to only rotate by size", 24)
+	confAccessLogMaxBackups     = config.RegisterOption("yagpdb.web.access_log_max_backups", "Max number of rotated access logs to keep, 0 to keep all of them", 14)
+	confAccessLogMaxAge         = config.RegisterOption("yagpdb.web.access_log_max_age", "Max age in days of rotated access logs to keep, 0 to keep them regardless of age", 30)
+	confAccessLogCompress       = config.RegisterOption("yagpdb.web.access_log_compress", "Gzip the rotated access logs", true)
+)
+
+// AccessLogEntry is a single request in the access log
+type AccessLogEntry struct {
+	Time      time.Time
+	ClientIP  string
+	Method    string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     uint64
+	Duration  time.Duration
+	UserAgent string
+	Referer   string
+	RequestID string
+
+	// filled in by the middlewares further down as they find out who's making the request
+	GuildID int64
+	UserID  int64
+
+	// only set if a geoip database is configured
+	Country string
+	ASN     uint
+}
+
+// AccessLogFormatter formats a access log entry into a single line, including the trailing newline
+type AccessLogFormatter func(e *AccessLogEntry) []byte
+
+var (
+	accessLogFormats   = make(map[string]AccessLogFormatter)
+	accessLogFormatsmu sync.RWMutex
+)
+
+// RegisterAccessLogFormat makes the format available through the yagpdb.web.access_log_format option
+func RegisterAccessLogFormat(name string, f AccessLogFormatter) {
+	accessLogFormatsmu.Lock()
+	accessLogFormats[name] = f
+	accessLogFormatsmu.Unlock()
+}
+
+func init() {
+	RegisterAccessLogFormat("goaccess", formatAccessLogGoAccess)
+	RegisterAccessLogFormat("json", formatAccessLogJSON)
+	RegisterAccessLogFormat("logfmt", formatAccessLogLogfmt)
+}
+
+// accessLogFormatter returns the configured format, falling back to goaccess for unknown ones
+func accessLogFormatter() AccessLogFormatter {
+	name := confAccessLogFormat.GetString()
+
+	accessLogFormatsmu.RLock()
+	f, ok := accessLogFormats[name]
+	accessLogFormatsmu.RUnlock()
+	if ok {
+		return f
+	}
+
+	logger.Errorf("Unknown access log format %q, using goaccess", name)
+	return formatAccessLogGoAccess
+}
+
+// accessLogID formats a guild or user id, with "-" in place of unknown ones
+func accessLogID(id int64) string {
+	if id == 0 {
+		return "-"
+	}
+
+	return discordgo.StrID(id)
+}
+
+// GoAccess Format:
+// log-format %h %T %^[%d:%t %^] "%r" %s %b "%u" "%R" %^
+// date-format %d/%b/%Y
+// time-format %H:%M:%S
+func formatAccessLogGoAccess(e *AccessLogEntry) []byte {
+	reqLine := fmt.Sprintf("%s %s %s", e.Method, e.URI, e.Proto)
+
+	requestID := e.RequestID
+	if requestID == "" {
+		requestID = "-"
+	}
+
+	country := e.Country
+	if country == "" {
+		country = "-"
+	}
+
+	asn := "-"
+	if e.ASN != 0 {
+		asn = "AS" + strconv.FormatUint(uint64(e.ASN), 10)
+	}
+
+	out := fmt.Sprintf("%s %f - [%s] %q %d %d %q %q %s %s %s %s %s\n",
+		e.ClientIP, e.Duration.Seconds(), e.Time.Format("02/Jan/2006:15:04:05 -0700"), reqLine, e.Status, e.Bytes,
+		e.UserAgent, e.Referer, requestID, accessLogID(e.GuildID), accessLogID(e.UserID), country, asn)
+
+	return []byte(out)
+}
+
+type accessLogJSONLine struct {
+	Time      string  `json:"time"`
+	ClientIP  string  `json:"client_ip"`
+	Method    string  `json:"method"`
+	URI       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     uint64  `json:"bytes"`
+	Duration  float64 `json:"duration"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	Referer   string  `json:"referer,omitempty"`
+	RequestID string  `json:"request_id,omitempty"`
+	GuildID   int64   `json:"guild_id,string,omitempty"`
+	UserID    int64   `json:"user_id,string,omitempty"`
+	Country   string  `json:"country,omitempty"`
+	ASN       uint    `json:"asn,omitempty"`
+}
+
+func formatAccessLogJSON(e *AccessLogEntry) []byte {
+	out, err := json.Marshal(&accessLogJSONLine{
+		Time:      e.Time.Format(time.RFC3339Nano),
+		ClientIP:  e.ClientIP,
+		Method:    e.Method,
+		URI:       e.URI,
+		Proto:     e.Proto,
+		Status:    e.Status,
+		Bytes:     e.Bytes,
+		Duration:  e.Duration.Seconds(),
+		UserAgent: e.UserAgent,
+		Referer:   e.Referer,
+		RequestID: e.RequestID,
+		GuildID:   e.GuildID,
+		UserID:    e.UserID,
+		Country:   e.Country,
+		ASN:       e.ASN,
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed encoding access log entry")
+		return nil
+	}
+
+	return append(out, '\n')
+}
+
+func formatAccessLogLogfmt(e *AccessLogEntry) []byte {
+	var b strings.Builder
+
+	writeField := func(k, v string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+
+		b.WriteString(k)
+		b.WriteByte('=')
+		if v == "" || strings.ContainsAny(v, " =\"\\") || strings.IndexFunc(v, func(r rune) bool { return r < ' ' }) != -1 {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+
+	writeField("time", e.Time.Format(time.RFC3339Nano))
+	writeField("client_ip", e.ClientIP)
+	writeField("method", e.Method)
+	writeField("uri", e.URI)
+	writeField("proto", e.Proto)
+	writeField("status", strconv.Itoa(e.Status))
+	writeField("bytes", strconv.FormatUint(e.Bytes, 10))
+	writeField("duration", strconv.FormatFloat(e.Duration.Seconds(), 'f', 6, 64))
+	writeField("user_agent", e.UserAgent)
+	writeField("referer", e.Referer)
+	if e.RequestID != "" {
+		writeField("request_id", e.RequestID)
+	}
+	if e.GuildID != 0 {
+		writeField("guild_id", discordgo.StrID(e.GuildID))
+	}
+	if e.UserID != 0 {
+		writeField("user_id", discordgo.StrID(e.UserID))
+	}
+	if e.Country != "" {
+		writeField("country", e.Country)
+	}
+	if e.ASN != 0 {
+		writeField("asn", strconv.FormatUint(uint64(e.ASN), 10))
+	}
+
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// accessLogResponseWriter keeps track of the status code of the response for the access log
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *accessLogResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *accessLogResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *accessLogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		// the connection is handed over, e.g to a websocket
+		w.status = http.StatusSwitchingProtocols
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// newAccessLogWriter creates the access log file writer, rotated by size here and by time in runAccessLogRotation
+func newAccessLogWriter() *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   confAccessLogPath.GetString(),
+		MaxSize:    confAccessLogMaxSize.GetInt(),
+		MaxBackups: confAccessLogMaxBackups.GetInt(),
+		MaxAge:     confAccessLogMaxAge.GetInt(),
+		Compress:   confAccessLogCompress.GetBool(),
+	}
+}
+
+// nextAccessLogRotation returns when the access log is rotated next, at multiples of the interval so
+// e.g daily rotation happens at midnight UTC
+func nextAccessLogRotation(now time.Time, interval time.Duration) time.Time {
+	return now.Truncate(interval).Add(interval)
+}
+
+// runAccessLogRotation rotates the access log every yagpdb.web.access_log_rotate_hours
+func runAccessLogRotation(l *lumberjack.Logger) {
+	interval := time.Duration(confAccessLogRotateInterval.GetInt()) * time.Hour
+	if interval <= 0 {
+		return
+	}
+
+	for {
+		now := time.Now()
+		time.Sleep(nextAccessLogRotation(now, interval).Sub(now))
+
+		// don't fill the backups with empty files on quiet instances
+		if stat, err := os.Stat(l.Filename); err != nil || stat.Size() == 0 {
+			continue
+		}
+
+		err := l.Rotate()
+		if err != nil {
+			logger.WithError(err).Error("failed rotating the access log")
+		}
+	}
+}
+
+func accessLogEntryFromContext(ctx context.Context) *AccessLogEntry {
+	if e, ok := ctx.Value(common.ContextKeyAccessLogEntry).(*AccessLogEntry); ok {
+		return e
+	}
+
+	return nil
+}
+
+// setAccessLogUser records the user making the request in the access log entry of the request
+func setAccessLogUser(ctx context.Context, userID int64) {
+	if e := accessLogEntryFromContext(ctx); e != nil {
+		e.UserID = userID
+	}
+}
+
+// setAccessLogGuild records the server the request is for in the access log entry of the request
+func setAccessLogGuild(ctx context.Context, guildID int64) {
+	if e := accessLogEntryFromContext(ctx); e != nil {
+		e.GuildID = guildID
+	}
+}
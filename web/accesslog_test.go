@@ -0,0 +1,90 @@
+package web
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAccessLogEntry() *AccessLogEntry {
+	return &AccessLogEntry{
+		Time:      time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		ClientIP:  "203.0.113.5",
+		Method:    "POST",
+		URI:       "/manage/1234/core",
+		Proto:     "HTTP/1.1",
+		Status:    403,
+		Bytes:     512,
+		Duration:  time.Millisecond * 1500,
+		UserAgent: "Mozilla/5.0 (X11)",
+		RequestID: "abc123",
+		GuildID:   1234,
+		UserID:    5678,
+		Country:   "SE",
+		ASN:       1299,
+	}
+}
+
+func TestFormatAccessLogGoAccess(t *testing.T) {
+	line := string(formatAccessLogGoAccess(testAccessLogEntry()))
+	expected := `203.0.113.5 1.500000 - [06/May/2024:07:08:09 +0000] "POST /manage/1234/core HTTP/1.1" 403 512 "Mozilla/5.0 (X11)" "" abc123 1234 5678 SE AS1299` + "\n"
+	if line != expected {
+		t.Errorf("got %q, expected %q", line, expected)
+	}
+
+	e := testAccessLogEntry()
+	e.RequestID = ""
+	e.GuildID = 0
+	e.UserID = 0
+	e.Country = ""
+	e.ASN = 0
+	if line := string(formatAccessLogGoAccess(e)); !strings.HasSuffix(line, ` "" - - - - -`+"\n") {
+		t.Errorf("missing placeholders for the unknown fields: %q", line)
+	}
+}
+
+func TestFormatAccessLogJSON(t *testing.T) {
+	line := formatAccessLogJSON(testAccessLogEntry())
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatalf("invalid json %q: %v", line, err)
+	}
+
+	if decoded["status"] != float64(403) || decoded["guild_id"] != "1234" || decoded["user_id"] != "5678" || decoded["request_id"] != "abc123" ||
+		decoded["country"] != "SE" || decoded["asn"] != float64(1299) {
+		t.Errorf("unexpected fields: %v", decoded)
+	}
+
+	if _, ok := decoded["referer"]; ok {
+		t.Errorf("empty referer should be left out: %v", decoded)
+	}
+}
+
+func TestFormatAccessLogLogfmt(t *testing.T) {
+	line := string(formatAccessLogLogfmt(testAccessLogEntry()))
+	expected := `time=2024-05-06T07:08:09Z client_ip=203.0.113.5 method=POST uri=/manage/1234/core proto=HTTP/1.1 status=403 bytes=512 duration=1.500000 user_agent="Mozilla/5.0 (X11)" referer="" request_id=abc123 guild_id=1234 user_id=5678 country=SE asn=1299` + "\n"
+	if line != expected {
+		t.Errorf("got %q, expected %q", line, expected)
+	}
+}
+
+func TestNextAccessLogRotation(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	cases := []struct {
+		interval time.Duration
+		expected time.Time
+	}{
+		{time.Hour, time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)},
+		{time.Hour * 6, time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)},
+		{time.Hour * 24, time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		if next := nextAccessLogRotation(now, c.interval); !next.Equal(c.expected) {
+			t.Errorf("interval %s: got %s, expected %s", c.interval, next, c.expected)
+		}
+	}
+}
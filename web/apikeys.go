@@ -0,0 +1,300 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+	"goji.io/pat"
+)
+
+const (
+	apiKeyPrefix      = "yag_"
+	maxAPIKeysPerUser = 10
+
+	// apiKeyIDLength is the length of the ids of keys and guild tokens, the start of their hash
+	apiKeyIDLength = 12
+
+	// DeveloperKeyPrefix is the prefix of the public api keys handed out to developers, they only work on the
+	// public api and are ignored here
+	DeveloperKeyPrefix = "yagpub_"
+)
+
+// APIKey is a long lived personal key that can be used instead of the session cookie
+type APIKey struct {
+	// ID is the first part of the hash, used to identify the key in the panel
+	ID        string    `json:"id"`
+	UserID    int64     `json:"user_id,string"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func keyAPIKeys() string {
+	return "api_keys"
+}
+
+func keyUserAPIKeys(userID int64) string {
+	return "user_api_keys:" + strconv.FormatInt(userID, 10)
+}
+
+func hashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// apiKeyID returns the id of the key or guild token with the hash
+func apiKeyID(hash string) string {
+	return hash[:apiKeyIDLength]
+}
+
+// CreateAPIKey generates a new key for the user, the returned plaintext key is not stored anywhere
+func CreateAPIKey(userID int64, name string) (string, *APIKey, error) {
+	var count int
+	err := common.RedisPool.Do(radix.Cmd(&count, "SCARD", keyUserAPIKeys(userID)))
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	if count >= maxAPIKeysPerUser {
+		return "", nil, NewPublicError("You can only have ", maxAPIKeysPerUser, " api keys, delete one first")
+	}
+
+	plain := apiKeyPrefix + RandBase64(32)
+	hash := hashAPIKey(plain)
+
+	key := &APIKey{
+		ID:        apiKeyID(hash),
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	serialized, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	err = common.MultipleCmds(
+		radix.Cmd(nil, "HSET", keyAPIKeys(), hash, string(serialized)),
+		radix.Cmd(nil, "SADD", keyUserAPIKeys(userID), hash),
+	)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	return plain, key, nil
+}
+
+// GetUserAPIKeys returns all the keys of the user, newest first
+func GetUserAPIKeys(userID int64) ([]*APIKey, error) {
+	var hashes []string
+	err := common.RedisPool.Do(radix.Cmd(&hashes, "SMEMBERS", keyUserAPIKeys(userID)))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	result := make([]*APIKey, 0, len(hashes))
+	for _, hash := range hashes {
+		key, err := getAPIKeyByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != nil {
+			result = append(result, key)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func getAPIKeyByHash(hash string) (*APIKey, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGET", keyAPIKeys(), hash))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var key *APIKey
+	err = json.Unmarshal(raw, &key)
+	return key, errors.WithStackIf(err)
+}
+
+// DeleteAPIKey deletes the key with the id, provided it belongs to the user
+func DeleteAPIKey(userID int64, id string) error {
+	var hashes []string
+	err := common.RedisPool.Do(radix.Cmd(&hashes, "SMEMBERS", keyUserAPIKeys(userID)))
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	for _, hash := range hashes {
+		if apiKeyID(hash) != id {
+			continue
+		}
+
+		return common.MultipleCmds(
+			radix.Cmd(nil, "HDEL", keyAPIKeys(), hash),
+			radix.Cmd(nil, "SREM", keyUserAPIKeys(userID), hash),
+		)
+	}
+
+	return NewPublicError("Unknown api key")
+}
+
+// ValidateAPIKey returns the key if it's valid, nil otherwise
+func ValidateAPIKey(plain string) (*APIKey, error) {
+	if !strings.HasPrefix(plain, apiKeyPrefix) {
+		return nil, nil
+	}
+
+	return getAPIKeyByHash(hashAPIKey(plain))
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(header[7:])
+}
+
+// APIKeyMiddleware authenticates requests using a personal api key in the Authorization header,
+// as a alternative to the session cookie for api routes. Keys only work on the json api (see RequestClassAPI),
+// the pages and forms of the control panel need a session.
+func APIKeyMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plain := bearerToken(r)
+		if plain == "" || strings.HasPrefix(plain, guildTokenPrefix) || strings.HasPrefix(plain, DeveloperKeyPrefix) || r.Context().Value(common.ContextKeyUser) != nil {
+			// guild api tokens are handled by GuildTokenMiddleware, developer keys by the public api
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if RequestClassOf(r) != RequestClassAPI {
+			EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventPermissionDenied, Details: map[string]string{"reason": "api_key_scope"}})
+			http.Error(w, `{"ok":false,"error":"api keys can only be used with the api"}`, http.StatusForbidden)
+			return
+		}
+
+		key, err := ValidateAPIKey(plain)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed validating api key")
+			http.Error(w, `{"ok":false,"error":"failed validating api key"}`, http.StatusInternalServerError)
+			return
+		}
+
+		if key == nil {
+			EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventAPIKeyInvalid})
+			http.Error(w, `{"ok":false,"error":"invalid api key"}`, http.StatusUnauthorized)
+			return
+		}
+
+		user, err := apiKeyUser(key.UserID)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed retrieving api key user")
+			http.Error(w, `{"ok":false,"error":"failed retrieving user"}`, http.StatusInternalServerError)
+			return
+		}
+
+		EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventAPIKeyUsed, UserID: user.ID, Details: map[string]string{"api_key": key.ID}})
+
+		entry := CtxLogger(r.Context()).WithField("u", user.ID).WithField("api_key", key.ID)
+		ctx := context.WithValue(r.Context(), common.ContextKeyLogger, entry)
+		ctx = context.WithValue(ctx, common.ContextKeyUser, user)
+		ctx = context.WithValue(ctx, common.ContextKeyAPIKey, key)
+		setAccessLogUser(ctx, user.ID)
+		ctx, tmpl := GetCreateTemplateData(ctx)
+		tmpl.SetUser(user).SetIsBotOwner(common.IsOwner(user.ID))
+
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func apiKeyUser(userID int64) (*discordgo.User, error) {
+	cacheKey := "api_key_user:" + discordgo.StrID(userID)
+
+	var user *discordgo.User
+	err := common.GetCacheDataJson(cacheKey, &user)
+	if err == nil && user != nil {
+		return user, nil
+	}
+
+	user, err = common.BotSession.User(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	LogIgnoreErr(common.SetCacheDataJson(cacheKey, 3600, user))
+	return user, nil
+}
+
+// ContextAPIKey returns the api key the request was authenticated with, if any
+func ContextAPIKey(ctx context.Context) *APIKey {
+	if v, ok := ctx.Value(common.ContextKeyAPIKey).(*APIKey); ok {
+		return v
+	}
+
+	return nil
+}
+
+type CreateAPIKeyForm struct {
+	Name string `valid:",1,100"`
+}
+
+// HandleGetAPIKeys handles GET /api_keys
+func HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	_, tmpl := GetCreateTemplateData(r.Context())
+
+	keys, err := GetUserAPIKeys(ContextUser(r.Context()).ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["APIKeys"] = keys
+	return tmpl, nil
+}
+
+// HandleCreateAPIKey handles POST /api_keys/new
+func HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx, tmpl := GetCreateTemplateData(r.Context())
+	tmpl.SetVisibleURL("/api_keys")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*CreateAPIKeyForm)
+
+	plain, _, err := CreateAPIKey(ContextUser(ctx).ID, form.Name)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["NewAPIKey"] = plain
+	return tmpl, nil
+}
+
+// HandleDeleteAPIKey handles POST /api_keys/:key/delete
+func HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx, tmpl := GetCreateTemplateData(r.Context())
+	tmpl.SetVisibleURL("/api_keys")
+
+	err := DeleteAPIKey(ContextUser(ctx).ID, pat.Param(r, "key"))
+	return tmpl, err
+}
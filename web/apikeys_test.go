@@ -0,0 +1,147 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+func TestHashAPIKey(t *testing.T) {
+	hash := hashAPIKey("yag_abc")
+	if len(hash) != 64 || hash != hashAPIKey("yag_abc") || hash == hashAPIKey("yag_abd") {
+		t.Errorf("unexpected hash %q", hash)
+	}
+
+	if id := apiKeyID(hash); len(id) != apiKeyIDLength || !strings.HasPrefix(hash, id) {
+		t.Errorf("unexpected id %q of hash %q", id, hash)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	cases := map[string]string{
+		"":                 "",
+		"Bearer yag_abc":   "yag_abc",
+		"bearer  yag_abc ": "yag_abc",
+		"Basic yag_abc":    "",
+		"Bearer":           "",
+	}
+
+	for header, expected := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", header)
+		if got := bearerToken(r); got != expected {
+			t.Errorf("%q: got %q, expected %q", header, got, expected)
+		}
+	}
+}
+
+func TestValidateAPIKeyPrefix(t *testing.T) {
+	// keys without the prefix aren't looked up at all
+	key, err := ValidateAPIKey("abc")
+	if key != nil || err != nil {
+		t.Errorf("expected no key, got %v, %v", key, err)
+	}
+}
+
+func TestAPIKeyMiddlewareScope(t *testing.T) {
+	called := false
+	handler := APIKeyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	cases := []struct {
+		path   string
+		header string
+		status int
+		called bool
+	}{
+		// the pages and forms of the control panel need a session, the key isn't even looked up
+		{"/manage/1/core", "Bearer yag_abc", http.StatusForbidden, false},
+		{"/manage/1/core/branding", "Bearer yag_abc", http.StatusForbidden, false},
+		{"/api_keys/new", "Bearer yag_abc", http.StatusForbidden, false},
+		// guild tokens, developer keys and requests without a key are left to the rest
+		{"/manage/1/core", "Bearer yagg_abc", http.StatusOK, true},
+		{"/public-api/v1/guilds", "Bearer yagpub_abc", http.StatusOK, true},
+		{"/manage/1/core", "", http.StatusOK, true},
+	}
+
+	for _, c := range cases {
+		called = false
+		r := httptest.NewRequest("POST", c.path, nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.status || called != c.called {
+			t.Errorf("%s %q: got status %d and called %t, expected %d and %t", c.path, c.header, w.Code, called, c.status, c.called)
+		}
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	const userID = 1008
+	existing, err := GetUserAPIKeys(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range existing {
+		DeleteAPIKey(userID, v.ID)
+	}
+
+	plain, key, err := CreateAPIKey(userID, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _, err := CreateAPIKey(userID, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validated, err := ValidateAPIKey(plain)
+	if err != nil || validated == nil || validated.ID != key.ID || validated.UserID != userID {
+		t.Fatalf("unexpected key %#v, %v", validated, err)
+	}
+
+	if validated, _ := ValidateAPIKey(plain + "x"); validated != nil {
+		t.Error("a wrong key was accepted")
+	}
+
+	// only the exact id deletes a key, not a prefix of it
+	for _, id := range []string{"", key.ID[:4], key.ID + "0"} {
+		if err := DeleteAPIKey(userID, id); err == nil {
+			t.Errorf("deleted a key with the id %q", id)
+		}
+	}
+
+	if err := DeleteAPIKey(userID+1, key.ID); err == nil {
+		t.Error("deleted the key of another user")
+	}
+
+	if err := DeleteAPIKey(userID, key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if validated, _ := ValidateAPIKey(plain); validated != nil {
+		t.Error("the deleted key still works")
+	}
+
+	if validated, _ := ValidateAPIKey(other); validated == nil {
+		t.Error("deleting a key deleted another one too")
+	}
+
+	keys, _ := GetUserAPIKeys(userID)
+	if len(keys) != 1 || keys[0].Name != "other" {
+		t.Errorf("expected only the other key to be left, got %v", keys)
+	}
+}
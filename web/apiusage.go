@@ -0,0 +1,56 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/apiusage"
+)
+
+// APIUsageMW records the outcome of requests to the guild's api in the api usage stats
+func APIUsageMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := NewStatusRecorder(w)
+		inner.ServeHTTP(recorder, r)
+
+		g, _ := GetBaseCPContextData(r.Context())
+		if g == nil {
+			return
+		}
+
+		err := apiusage.Record(g.ID, apiusage.KindAPI, apiusage.OutcomeFromStatus(recorder.Status))
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed recording api usage")
+		}
+	})
+}
+
+// HandleAPIUsage handles GET /manage/:server/api_usage
+func HandleAPIUsage(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, tmpl := GetBaseCPContextData(r.Context())
+
+	hours, _ := strconv.Atoi(r.URL.Query().Get("hours"))
+	if hours <= 0 || hours > int(apiusage.Retention.Hours()) {
+		hours = 24
+	}
+
+	buckets, err := apiusage.GetUsage(g.ID, hours)
+	if err != nil {
+		return tmpl, err
+	}
+
+	var totalAPI, totalWebhooks, totalRatelimited int64
+	for _, b := range buckets {
+		totalAPI += b.Total(apiusage.KindAPI)
+		totalWebhooks += b.Total(apiusage.KindWebhook)
+		totalRatelimited += b.Count(apiusage.KindAPI, apiusage.OutcomeRatelimited) + b.Count(apiusage.KindWebhook, apiusage.OutcomeRatelimited)
+	}
+
+	tmpl["UsageHours"] = hours
+	tmpl["UsageBuckets"] = buckets
+	tmpl["UsageTotalAPI"] = totalAPI
+	tmpl["UsageTotalWebhooks"] = totalWebhooks
+	tmpl["UsageTotalRatelimited"] = totalRatelimited
+
+	return tmpl, nil
+}
@@ -0,0 +1,224 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/web/configcode"
+	"goji.io"
+	"goji.io/pat"
+)
+
+// APIV1GuildMux serves /api/v1/guilds/:server, the versioned json api for managing the settings of a server without
+// the control panel. Requests are authenticated with a personal api key, a guild api token with the config scope or the
+// session, and need the same access as the control panel. Changes go through the approvals of the server.
+//
+// The settings are those of the plugins implementing PluginWithConfigCode, in the json form of their config code:
+//
+//	GET   /api/v1/guilds/:server/config          the settings of all plugins, by plugin
+//	GET   /api/v1/guilds/:server/config/:plugin  the settings of the plugin
+//	PATCH /api/v1/guilds/:server/config          changes the settings of several plugins at once: {"<plugin>": {...}}
+//	PATCH /api/v1/guilds/:server/config/:plugin  changes the settings of the plugin, only the settings in the body
+//
+// Ids are strings, as they don't fit the numbers of javascript. Changes are validated like they are in the control
+// panel and all of them are saved in a single transaction, ?dry_run=1 only validates them and returns the changes.
+// The endpoints are documented in /api/openapi.json.
+var APIV1GuildMux *goji.Mux
+
+func setupAPIV1Routes() {
+	v1Mux := goji.SubMux()
+	RootMux.Handle(pat.New("/api/v1/*"), v1Mux)
+	v1Mux.Use(requireAPIUserMW)
+	v1Mux.Use(NotFoundMiddleware)
+
+	APIV1GuildMux = goji.SubMux()
+	v1Mux.Handle(pat.New("/guilds/:server"), APIV1GuildMux)
+	v1Mux.Handle(pat.New("/guilds/:server/*"), APIV1GuildMux)
+	APIV1GuildMux.Use(ActiveServerMW)
+	APIV1GuildMux.Use(RequireActiveServer)
+	APIV1GuildMux.Use(LoadCoreConfigMiddleware)
+	APIV1GuildMux.Use(SetGuildMemberMiddleware)
+	APIV1GuildMux.Use(requireAPIAdminMW)
+	APIV1GuildMux.Use(APIUsageMW)
+	APIV1GuildMux.Use(NotFoundMiddleware)
+	APIV1GuildMux.Use(CPLogRequestMW)
+	APIV1GuildMux.Use(ConfigApprovalMW)
+
+	dryRun := []APIParam{{Name: "dry_run", Description: "1 to only validate the changes and return them"}}
+
+	v1Routes := NewAPIRoutes(APIV1GuildMux, "/api/v1/guilds/:server", "Settings")
+	v1Routes.Handle(pat.Get("/config"), HandleAPIGetConfig, &APIDoc{
+		Summary:  "The settings of all plugins",
+		Response: map[string]map[string]interface{}{},
+	})
+	v1Routes.Handle(pat.Get("/config/:plugin"), HandleAPIGetPluginConfig, &APIDoc{
+		Summary:  "The settings of a plugin",
+		Response: map[string]interface{}{},
+	})
+	v1Routes.Handle(pat.Patch("/config"), HandleAPIPatchConfig, &APIDoc{
+		Summary:     "Change the settings of several plugins",
+		Description: "The body has the settings to change by plugin, the settings left out stay the same.",
+		Query:       dryRun,
+		Request:     map[string]map[string]interface{}{},
+		Response:    &ConfigCodeApplyResult{},
+	})
+	v1Routes.Handle(pat.Patch("/config/:plugin"), HandleAPIPatchConfig, &APIDoc{
+		Summary:     "Change the settings of a plugin",
+		Description: "The body has the settings to change, the settings left out stay the same.",
+		Query:       dryRun,
+		Request:     map[string]interface{}{},
+		Response:    &ConfigCodeApplyResult{},
+	})
+}
+
+func requireAPIUserMW(inner http.Handler) http.Handler {
+	return NamedMiddleware("require_api_user", inner, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(common.ContextKeyUser).(*discordgo.User); !ok {
+			RenderErrorPage(w, r, http.StatusUnauthorized, Msg("Not logged in, send a api key or token in the Authorization: Bearer <token> header"))
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// requireAPIAdminMW is RequireServerAdminMiddleware for the api, without the redirects to log in
+func requireAPIAdminMW(inner http.Handler) http.Handler {
+	return NamedMiddleware("require_api_admin", inner, func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if !ContextIsAdmin(ctx) {
+			EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventPermissionDenied, Details: map[string]string{"reason": "not_admin"}})
+			RenderErrorPage(w, r, http.StatusForbidden, Msg("You don't have access to the settings of this server"))
+			return
+		}
+
+		if GetIsReadOnly(ctx) && !isReadOnlyMethod(r.Method) {
+			EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventPermissionDenied, Details: map[string]string{"reason": "read_only"}})
+			RenderErrorPage(w, r, http.StatusForbidden, Msg(readOnlyRejectedMsg))
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// exportPluginConfig returns the settings of the plugin in their json form
+func exportPluginConfig(r *http.Request, p PluginWithConfigCode) (map[string]interface{}, error) {
+	form, err := p.ExportConfigCode(r.Context(), ContextGuild(r.Context()).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := configcode.Encode(form)
+	if err != nil {
+		return nil, err
+	}
+
+	return configcode.ToJSON(attrs), nil
+}
+
+// HandleAPIGetConfig handles GET /api/v1/guilds/:server/config
+func HandleAPIGetConfig(w http.ResponseWriter, r *http.Request) interface{} {
+	result := make(map[string]interface{})
+	for _, p := range configCodePlugins() {
+		config, err := exportPluginConfig(r, p)
+		if err != nil {
+			return err
+		}
+
+		result[p.ConfigCodeName()] = config
+	}
+
+	return result
+}
+
+// HandleAPIGetPluginConfig handles GET /api/v1/guilds/:server/config/:plugin
+func HandleAPIGetPluginConfig(w http.ResponseWriter, r *http.Request) interface{} {
+	p := findConfigCodePlugin(pat.Param(r, "plugin"))
+	if p == nil {
+		RenderErrorPage(w, r, http.StatusNotFound, Msg("Unknown plugin, the plugins are listed in /config"))
+		return nil
+	}
+
+	config, err := exportPluginConfig(r, p)
+	if err != nil {
+		return err
+	}
+
+	return config
+}
+
+// HandleAPIPatchConfig handles PATCH /api/v1/guilds/:server/config and PATCH /api/v1/guilds/:server/config/:plugin,
+// responding with a ConfigCodeApplyResult, which is a 400 if the changes didn't validate
+func HandleAPIPatchConfig(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	g := ContextGuild(ctx)
+
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxConfigCodeSize))
+	decoder.UseNumber()
+
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		RenderErrorPage(w, r, http.StatusBadRequest, Msg("The body has to be a json object of the settings to change: %s", err))
+		return nil
+	}
+
+	blocks, err := apiConfigBlocks(pat.Param(r, "plugin"), body)
+	if err != nil {
+		RenderErrorPage(w, r, http.StatusBadRequest, Msg("%s", err))
+		return nil
+	}
+
+	pending, result, err := prepareConfigBlocks(ctx, g, blocks)
+	if err != nil {
+		return err
+	}
+
+	err = commitConfigCode(ctx, g.ID, pending, result, r.FormValue("dry_run") == "1")
+	if err != nil {
+		return err
+	}
+
+	if !result.OK {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	return result
+}
+
+// apiConfigBlocks converts the body of a settings change to config code blocks, the body has the settings of the plugin,
+// or the settings of several plugins by plugin if none is given
+func apiConfigBlocks(plugin string, body map[string]interface{}) ([]*configcode.Block, error) {
+	if plugin != "" {
+		body = map[string]interface{}{plugin: body}
+	}
+
+	names := make([]string, 0, len(body))
+	for k := range body {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	blocks := make([]*configcode.Block, 0, len(names))
+	for _, name := range names {
+		raw, ok := body[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("plugin %q: the settings have to be a json object", name)
+		}
+
+		attrs, err := configcode.FromJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q: %s", name, err)
+		}
+
+		blocks = append(blocks, &configcode.Block{Name: name, Attributes: attrs})
+	}
+
+	return blocks, nil
+}
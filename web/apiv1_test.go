@@ -0,0 +1,57 @@
+package web
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAPIConfigBlocks(t *testing.T) {
+	decode := func(body string) map[string]interface{} {
+		decoder := json.NewDecoder(strings.NewReader(body))
+		decoder.UseNumber()
+
+		var result map[string]interface{}
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	blocks, err := apiConfigBlocks("", decode(`{"logs": {"access_mode": 1, "blacklisted_channels": ["1", "2"]}, "core": {"allowed_read_only_roles": ["123456789012345678"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 2 || blocks[0].Name != "core" || blocks[1].Name != "logs" {
+		t.Fatalf("expected the blocks of core and logs, got %v", blocks)
+	}
+
+	if v, ok := blocks[1].Attributes["access_mode"].(int64); !ok || v != 1 {
+		t.Errorf("expected access_mode to be int64 1, got %#v", blocks[1].Attributes["access_mode"])
+	}
+
+	blocks, err = apiConfigBlocks("logs", decode(`{"username_logging_enabled": false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 1 || blocks[0].Name != "logs" || blocks[0].Attributes["username_logging_enabled"] != false {
+		t.Errorf("expected a single logs block, got %v", blocks)
+	}
+
+	errors := []struct {
+		plugin, body, expected string
+	}{
+		{"", `{"logs": true}`, `plugin "logs": the settings have to be a json object`},
+		{"", `{"logs": {"access_mode": 1.5}}`, `plugin "logs": `},
+		{"logs", `{"channels": [["1"]]}`, `plugin "logs": `},
+	}
+
+	for _, c := range errors {
+		_, err := apiConfigBlocks(c.plugin, decode(c.body))
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Errorf("%s: expected a error starting with %q, got %v", c.body, c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/internalapi"
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/oauth2"
+)
+
+var confExtraApplications = config.RegisterOption("yagpdb.web.extra_applications", `JSON array of additional bot applications served from this panel, e.g a beta bot: [{"name":"beta","client_id":"...","client_secret":"...","bot_id":123,"botrest_address":"127.0.0.1:5010"}]`, "")
+
+// DefaultApplicationName is the name of the application configured through yagpdb.clientid and yagpdb.clientsecret
+const DefaultApplicationName = "default"
+
+// Application is a discord bot application the control panel can be used with
+type Application struct {
+	Name         string `json:"name"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+
+	// BotID is the user id of the bot, defaults to the main bot
+	BotID int64 `json:"bot_id"`
+
+	// BotrestAddress is where the botrest server of the bot is listening, the main bot's servers are found through the service poller
+	BotrestAddress string `json:"botrest_address"`
+
+	OauthConf *oauth2.Config `json:"-"`
+}
+
+// Applications holds all the applications served, the first one is always the default one
+var Applications []*Application
+
+func newApplicationOauthConf(clientID, clientSecret string) *oauth2.Config {
+	conf := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"identify", "guilds"},
+		Endpoint: oauth2.Endpoint{
+			TokenURL: "https://discordapp.com/api/oauth2/token",
+			AuthURL:  "https://discordapp.com/api/oauth2/authorize",
+		},
+	}
+
+	if https || exthttps {
+		conf.RedirectURL = "https://" + common.ConfHost.GetString() + "/confirm_login"
+	} else {
+		conf.RedirectURL = "http://" + common.ConfHost.GetString() + "/confirm_login"
+	}
+
+	return conf
+}
+
+func loadApplications() {
+	Applications = []*Application{{
+		Name:         DefaultApplicationName,
+		ClientID:     OauthConf.ClientID,
+		ClientSecret: OauthConf.ClientSecret,
+		OauthConf:    OauthConf,
+	}}
+
+	raw := confExtraApplications.GetString()
+	if raw == "" {
+		return
+	}
+
+	var extra []*Application
+	err := json.Unmarshal([]byte(raw), &extra)
+	if err != nil {
+		logger.WithError(err).Error("Invalid yagpdb.web.extra_applications, only serving the default application")
+		return
+	}
+
+	for _, v := range extra {
+		if v.Name == "" || v.ClientID == "" || v.ClientSecret == "" || GetApplication(v.Name).Name == v.Name {
+			logger.Errorf("Skipping extra application %q, it needs a unique name, a client id and a client secret", v.Name)
+			continue
+		}
+
+		v.OauthConf = newApplicationOauthConf(v.ClientID, v.ClientSecret)
+		Applications = append(Applications, v)
+	}
+}
+
+// GetApplication returns the application with the name, or the default one if there's none
+func GetApplication(name string) *Application {
+	for _, v := range Applications {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return Applications[0]
+}
+
+// IsDefault returns true if this is the application configured through yagpdb.clientid
+func (a *Application) IsDefault() bool {
+	return a.Name == DefaultApplicationName
+}
+
+// BotUserID returns the user id of the application's bot
+func (a *Application) BotUserID() int64 {
+	if a.BotID == 0 {
+		return common.BotUser.ID
+	}
+
+	return a.BotID
+}
+
+// BotrestGet makes a GET request to the botrest server of the application responsible for the guild
+func (a *Application) BotrestGet(guildID int64, path string, dest interface{}) error {
+	if a.BotrestAddress == "" {
+		return internalapi.GetWithGuild(guildID, path, dest)
+	}
+
+	return internalapi.GetWithAddress(a.BotrestAddress, path, dest)
+}
+
+// ContextApplication returns the application selected in the session of the request, or the default one
+func ContextApplication(ctx context.Context) *Application {
+	if v, ok := ctx.Value(common.ContextKeyApplication).(*Application); ok {
+		return v
+	}
+
+	return Applications[0]
+}
+
+// the selected application is read on every request, so keep it locally for a bit
+var sessionApplicationCache = cache.New(time.Minute, time.Minute*5)
+
+func sessionApplication(yagToken string) *Application {
+	if v, ok := sessionApplicationCache.Get(yagToken); ok {
+		return v.(*Application)
+	}
+
+	meta, err := Sessions.GetMeta(SessionID(yagToken))
+	if err != nil {
+		logger.WithError(err).Error("failed retrieving session application")
+		return Applications[0]
+	}
+
+	var name string
+	if meta != nil {
+		name = meta.Application
+	}
+
+	app := GetApplication(name)
+	sessionApplicationCache.SetDefault(yagToken, app)
+	return app
+}
+
+func setSessionApplication(yagToken string, app *Application) error {
+	sessionApplicationCache.Delete(yagToken)
+
+	meta, err := Sessions.GetMeta(SessionID(yagToken))
+	if err != nil {
+		return err
+	}
+
+	if meta == nil {
+		// sessions created before metadata was tracked
+		meta = &SessionMeta{ID: SessionID(yagToken), CreatedAt: time.Now(), LastSeen: time.Now(), token: yagToken}
+	}
+
+	meta.Application = app.Name
+	return Sessions.SaveMeta(meta, SessionTTL())
+}
+
+// applicationContext adds the application selected in the session to the context and template data
+func applicationContext(ctx context.Context, yagToken string) context.Context {
+	app := sessionApplication(yagToken)
+
+	ctx = context.WithValue(ctx, common.ContextKeyApplication, app)
+	return SetContextTemplateData(ctx, map[string]interface{}{
+		"ClientID":           app.ClientID,
+		"CurrentApplication": app,
+		"Applications":       Applications,
+	})
+}
+
+// HandleSelectApplication handles POST /application, switching the application used in the session
+func HandleSelectApplication(w http.ResponseWriter, r *http.Request) {
+	yagToken, _ := r.Context().Value(common.ContextKeyYagToken).(string)
+
+	app := GetApplication(r.FormValue("application"))
+	err := setSessionApplication(yagToken, app)
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed setting session application")
+	}
+
+	http.Redirect(w, r, "/manage", http.StatusSeeOther)
+}
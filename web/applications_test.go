@@ -0,0 +1,116 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"golang.org/x/oauth2"
+)
+
+// withTestApplications loads the applications with the extra ones, returning a func restoring the previous ones
+func withTestApplications(extra string) func() {
+	oldApps, oldConf, oldExtra := Applications, OauthConf, confExtraApplications.LoadedValue
+
+	OauthConf = &oauth2.Config{ClientID: "main", ClientSecret: "secret"}
+	confExtraApplications.LoadedValue = extra
+	loadApplications()
+
+	return func() {
+		Applications, OauthConf, confExtraApplications.LoadedValue = oldApps, oldConf, oldExtra
+	}
+}
+
+func TestLoadApplications(t *testing.T) {
+	defer withTestApplications(`[
+		{"name":"beta","client_id":"beta-id","client_secret":"s","bot_id":5,"botrest_address":"127.0.0.1:5010"},
+		{"name":"beta","client_id":"other","client_secret":"s"},
+		{"name":"default","client_id":"other","client_secret":"s"},
+		{"name":"nosecret","client_id":"other"}
+	]`)()
+
+	if len(Applications) != 2 {
+		t.Fatalf("expected the default and beta applications, got %d", len(Applications))
+	}
+
+	if def := Applications[0]; !def.IsDefault() || def.ClientID != "main" || def.OauthConf != OauthConf {
+		t.Errorf("unexpected default application %#v", def)
+	}
+
+	beta := GetApplication("beta")
+	if beta.IsDefault() || beta.ClientID != "beta-id" || beta.OauthConf == nil || beta.OauthConf.ClientID != "beta-id" || beta.BotUserID() != 5 {
+		t.Errorf("unexpected beta application %#v", beta)
+	}
+
+	if app := GetApplication("nosecret"); !app.IsDefault() {
+		t.Errorf("expected unknown applications to fall back to the default one, got %q", app.Name)
+	}
+
+	if app := ContextApplication(context.Background()); !app.IsDefault() {
+		t.Errorf("expected the default application without one in the context, got %q", app.Name)
+	}
+}
+
+func TestLoadApplicationsInvalid(t *testing.T) {
+	defer withTestApplications(`{"name":"beta"}`)()
+	if len(Applications) != 1 || !Applications[0].IsDefault() {
+		t.Errorf("expected only the default application with invalid config, got %d", len(Applications))
+	}
+}
+
+func TestApplicationBotUserID(t *testing.T) {
+	defer func(old *discordgo.User) { common.BotUser = old }(common.BotUser)
+	common.BotUser = &discordgo.User{ID: 1}
+
+	if id := (&Application{}).BotUserID(); id != 1 {
+		t.Errorf("expected the main bot without a bot id, got %d", id)
+	}
+}
+
+func TestSelectApplication(t *testing.T) {
+	defer withTestApplications(`[{"name":"beta","client_id":"beta-id","client_secret":"s"}]`)()
+
+	defer func(old SessionStore) { Sessions = old }(Sessions)
+	Sessions = NewMemorySessionStore()
+
+	defer func(old interface{}) { common.ConfSessionTTL.LoadedValue = old }(common.ConfSessionTTL.LoadedValue)
+	common.ConfSessionTTL.LoadedValue = 1
+
+	const token = "select-application"
+	defer sessionApplicationCache.Delete(token)
+
+	if app := sessionApplication(token); !app.IsDefault() {
+		t.Fatalf("expected the default application for a new session, got %q", app.Name)
+	}
+
+	r := httptest.NewRequest("POST", "/application", strings.NewReader(url.Values{"application": {"beta"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = r.WithContext(context.WithValue(r.Context(), common.ContextKeyYagToken, token))
+
+	w := httptest.NewRecorder()
+	HandleSelectApplication(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected a redirect, got %d", w.Code)
+	}
+
+	// the selection replaces the cached one
+	if app := sessionApplication(token); app.Name != "beta" {
+		t.Errorf("expected the selected application, got %q", app.Name)
+	}
+
+	sessionApplicationCache.Delete(token)
+	if app := sessionApplication(token); app.Name != "beta" {
+		t.Errorf("expected the selection to be stored in the session, got %q", app.Name)
+	}
+
+	ctx := applicationContext(context.Background(), token)
+	_, tmpl := GetCreateTemplateData(ctx)
+	if ContextApplication(ctx).Name != "beta" || tmpl["ClientID"] != "beta-id" {
+		t.Errorf("expected the application in the context and template data, got %v", tmpl["ClientID"])
+	}
+}
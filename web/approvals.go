@@ -0,0 +1,761 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"goji.io/pat"
+)
+
+const (
+	// bodies larger than this can't be queued, e.g file uploads
+	maxQueuedChangeSize = 1000000
+
+	defaultApprovalExpiryHours = 72
+	approvalExpiryInterval     = time.Minute * 10
+
+	// how many of the decided changes are listed below the pending ones
+	approvalHistoryLength = 25
+)
+
+// The states of a change waiting for, or after, approval
+const (
+	ConfigChangePending  = "pending"
+	ConfigChangeApproved = "approved"
+	ConfigChangeRejected = "rejected"
+	ConfigChangeExpired  = "expired"
+)
+
+var configApprovalSchemas = []string{`
+CREATE TABLE IF NOT EXISTS web_config_changes (
+	id BIGSERIAL PRIMARY KEY,
+	guild_id BIGINT NOT NULL,
+
+	author_id BIGINT NOT NULL,
+	author_username TEXT NOT NULL,
+
+	method TEXT NOT NULL,
+	path TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	body BYTEA NOT NULL,
+
+	status TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+	decided_by BIGINT,
+	decided_by_username TEXT,
+	decided_at TIMESTAMP WITH TIME ZONE
+);
+`, `
+CREATE INDEX IF NOT EXISTS web_config_changes_guild_id_idx ON web_config_changes(guild_id, status);
+`}
+
+var (
+	panelLogKeyApprovalSettings = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "approval_settings_updated",
+		FormatString: "Updated the change approval settings",
+	})
+
+	panelLogKeyChangeQueued = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "config_change_queued",
+		FormatString: "Submitted change #%d for approval: %s",
+	})
+
+	panelLogKeyChangeApproved = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "config_change_approved",
+		FormatString: "Approved and applied change #%d by %s",
+	})
+
+	panelLogKeyChangeRejected = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "config_change_rejected",
+		FormatString: "Rejected change #%d by %s",
+	})
+)
+
+// The reasons a change can't be submitted for approval, by their code
+var approvalQueueErrors = map[string]error{
+	"upload":    NewPublicError("File uploads can't be submitted for approval, ask the server owner to make this change"),
+	"too_large": NewPublicError("The change is too large to be submitted for approval"),
+	"invalid":   NewPublicError("Invalid form"),
+	"failed":    NewPublicError("Failed submitting the change for approval"),
+}
+
+var discordWebhookURLRegex = regexp.MustCompile(`^https://(?:(?:canary|ptb)\.)?discord(?:app)?\.com/api(?:/v\d+)?/webhooks/(\d+)/([\w-]+)$`)
+
+func keyApprovalSettings(guildID int64) string {
+	return "web_approval_settings:" + discordgo.StrID(guildID)
+}
+
+// ApprovalSettings is the two-person rule of a guild: when enabled, changes made by admins other than the owner
+// are queued until another admin approves them
+type ApprovalSettings struct {
+	Enabled bool `json:"enabled"`
+
+	// Discord webhook new changes are posted to, so the other admins know there's something to review
+	WebhookURL string `json:"webhook_url"`
+
+	// Pending changes expire after this long
+	ExpiryHours int `json:"expiry_hours"`
+}
+
+// GetApprovalSettings returns the approval settings of the guild, approvals are disabled by default
+func GetApprovalSettings(guildID int64) (*ApprovalSettings, error) {
+	settings := &ApprovalSettings{ExpiryHours: defaultApprovalExpiryHours}
+	err := common.GetRedisJson(keyApprovalSettings(guildID), settings)
+	return settings, err
+}
+
+// ConfigChange is a change to the settings waiting for, or after, approval. It's the request that made the change,
+// which is replayed when it's approved.
+type ConfigChange struct {
+	ID      int64 `json:"id"`
+	GuildID int64 `json:"guild_id,string"`
+
+	AuthorID       int64  `json:"author_id,string"`
+	AuthorUsername string `json:"author_username"`
+
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"-"`
+
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	DecidedBy         int64      `json:"decided_by,string,omitempty"`
+	DecidedByUsername string     `json:"decided_by_username,omitempty"`
+	DecidedAt         *time.Time `json:"decided_at,omitempty"`
+}
+
+// ConfigChangeField is a submitted form field, shown to the approvers
+type ConfigChangeField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Fields returns what was submitted in a readable form, the fields of a form or the raw body for anything else
+func (c *ConfigChange) Fields() []*ConfigChangeField {
+	if strings.HasPrefix(c.ContentType, "application/x-www-form-urlencoded") || len(c.Body) == 0 {
+		values, _ := url.ParseQuery(string(c.Body))
+
+		var result []*ConfigChangeField
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			for _, v := range values[k] {
+				result = append(result, &ConfigChangeField{Name: k, Value: v})
+			}
+		}
+		return result
+	}
+
+	if !utf8.Valid(c.Body) {
+		return []*ConfigChangeField{{Name: c.ContentType, Value: fmt.Sprintf("%d bytes", len(c.Body))}}
+	}
+
+	return []*ConfigChangeField{{Name: c.ContentType, Value: common.CutStringShort(string(c.Body), 2000)}}
+}
+
+// MarshalJSON includes the fields, which is what api users want to see instead of the raw body
+func (c *ConfigChange) MarshalJSON() ([]byte, error) {
+	type plain ConfigChange
+	return json.Marshal(&struct {
+		*plain
+		Fields []*ConfigChangeField `json:"fields"`
+	}{(*plain)(c), c.Fields()})
+}
+
+// Summary is the route of the change relative to the control panel of the guild, e.g "POST /autorole"
+func (c *ConfigChange) Summary() string {
+	return c.Method + " " + strings.TrimPrefix(c.Path, "/manage/"+discordgo.StrID(c.GuildID))
+}
+
+const configChangeColumns = `id, guild_id, author_id, author_username, method, path, content_type, body, status, created_at, expires_at,
+decided_by, decided_by_username, decided_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanConfigChange(row rowScanner) (*ConfigChange, error) {
+	c := &ConfigChange{}
+	var decidedBy sql.NullInt64
+	var decidedByUsername sql.NullString
+	var decidedAt sql.NullTime
+
+	err := row.Scan(&c.ID, &c.GuildID, &c.AuthorID, &c.AuthorUsername, &c.Method, &c.Path, &c.ContentType, &c.Body, &c.Status,
+		&c.CreatedAt, &c.ExpiresAt, &decidedBy, &decidedByUsername, &decidedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.DecidedBy = decidedBy.Int64
+	c.DecidedByUsername = decidedByUsername.String
+	if decidedAt.Valid {
+		c.DecidedAt = &decidedAt.Time
+	}
+
+	return c, nil
+}
+
+// GetConfigChanges returns the pending changes of the guild followed by the most recently decided ones
+func GetConfigChanges(ctx context.Context, guildID int64) (pending []*ConfigChange, decided []*ConfigChange, err error) {
+	// so they're not listed as pending until the next run of the expiry loop
+	_, err = common.PQ.ExecContext(ctx, "UPDATE web_config_changes SET status = $2 WHERE guild_id = $1 AND status = $3 AND expires_at < now()",
+		guildID, ConfigChangeExpired, ConfigChangePending)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := common.PQ.QueryContext(ctx, `SELECT `+configChangeColumns+` FROM web_config_changes
+WHERE guild_id = $1 AND (status = $2 OR id IN (SELECT id FROM web_config_changes WHERE guild_id = $1 AND status != $2 ORDER BY id DESC LIMIT $3))
+ORDER BY id DESC`, guildID, ConfigChangePending, approvalHistoryLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanConfigChange(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if c.Status == ConfigChangePending {
+			pending = append(pending, c)
+		} else {
+			decided = append(decided, c)
+		}
+	}
+
+	return pending, decided, rows.Err()
+}
+
+// expireConfigChanges marks the pending changes past their expiry as expired
+func expireConfigChanges() error {
+	_, err := common.PQ.Exec("UPDATE web_config_changes SET status = $1 WHERE status = $2 AND expires_at < now()", ConfigChangeExpired, ConfigChangePending)
+	return err
+}
+
+func runConfigChangeExpiryLoop(ctx context.Context) {
+	ticker := time.NewTicker(approvalExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := expireConfigChanges(); err != nil {
+			logger.WithError(err).Error("failed expiring pending config changes")
+		}
+	}
+}
+
+var (
+	approvalExemptPaths   = make(map[string]bool)
+	approvalExemptPathsMu sync.RWMutex
+)
+
+// ExemptFromApprovals marks the routes (relative to the control panel of a guild, e.g "/simulate") as not changing anything,
+// so they're not queued for approval
+func ExemptFromApprovals(paths ...string) {
+	approvalExemptPathsMu.Lock()
+	for _, v := range paths {
+		approvalExemptPaths[v] = true
+	}
+	approvalExemptPathsMu.Unlock()
+}
+
+var approvalDecisionPathRegex = regexp.MustCompile(`^/approvals/\d+/(approve|reject)(\.json)?$`)
+
+// isApprovalExempt returns true if the route doesn't need approval, path is relative to the control panel of the guild
+func isApprovalExempt(path string) bool {
+	if approvalDecisionPathRegex.MatchString(path) {
+		return true
+	}
+
+	approvalExemptPathsMu.RLock()
+	defer approvalExemptPathsMu.RUnlock()
+	return approvalExemptPaths[path]
+}
+
+// ConfigApprovalMW queues the changes made by admins other than the owner if the guild requires approval for them,
+// the change is then made once another admin approves it
+func ConfigApprovalMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if isReadOnlyMethod(r.Method) || ctx.Value(common.ContextKeyApprovedChange) != nil || IsSuperadminRequest(ctx) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		g := ContextGuild(ctx)
+		user, _ := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+		if user == nil || user.ID == g.OwnerID || isApprovalExempt(strings.TrimPrefix(r.URL.Path, "/manage/"+discordgo.StrID(g.ID))) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		settings, err := GetApprovalSettings(g.ID)
+		if err != nil {
+			// failing closed, the two-person rule would be trivial to get around otherwise
+			CtxLogger(ctx).WithError(err).Error("failed retrieving approval settings")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if !settings.Enabled {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		change, errCode, err := queueConfigChange(r, g, user, settings)
+		if err != nil {
+			CtxLogger(ctx).WithError(err).Error("failed queueing config change")
+		}
+
+		dst := "/manage/" + discordgo.StrID(g.ID) + "/approvals"
+		if errCode != "" {
+			if wantsJSONError(r) {
+				writeApprovalJSON(w, http.StatusBadRequest, map[string]interface{}{"ok": false, "error": approvalQueueErrors[errCode].Error()})
+			} else {
+				RedirectWithAlerts(w, r, dst, ErrorAlert(approvalQueueErrors[errCode].Error()))
+			}
+			return
+		}
+
+		if wantsJSONError(r) {
+			writeApprovalJSON(w, http.StatusAccepted, map[string]interface{}{
+				"ok":               false,
+				"pending_approval": true,
+				"change":           change,
+				"error":            "This server requires changes to be approved by another admin, the change has been submitted for approval",
+			})
+		} else {
+			RedirectWithAlerts(w, r, dst, WarningAlert("This server requires changes to be approved by another admin, your change has been submitted for approval."))
+		}
+	})
+}
+
+func writeApprovalJSON(w http.ResponseWriter, code int, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	LogIgnoreErr(json.NewEncoder(w).Encode(data))
+}
+
+// readChangeBody returns the body of the request to store, forms have usually been parsed already by the time it gets here.
+// If it can't be stored the code of the error in approvalQueueErrors is returned.
+func readChangeBody(r *http.Request) ([]byte, string, error) {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		return nil, "upload", nil
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if err := r.ParseForm(); err != nil {
+			return nil, "invalid", nil
+		}
+
+		form := make(url.Values, len(r.PostForm))
+		for k, v := range r.PostForm {
+			if k != "csrf_token" {
+				form[k] = v
+			}
+		}
+		return []byte(form.Encode()), "", nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxQueuedChangeSize+1))
+	if err != nil {
+		return nil, "invalid", nil
+	}
+
+	if len(body) > maxQueuedChangeSize {
+		return nil, "too_large", nil
+	}
+
+	return body, "", nil
+}
+
+// queueConfigChange stores the change until it's approved, if it couldn't be stored the code of the error in
+// approvalQueueErrors is returned, along with the internal error if any
+func queueConfigChange(r *http.Request, g *dstate.GuildSet, user *discordgo.User, settings *ApprovalSettings) (*ConfigChange, string, error) {
+	ctx := r.Context()
+
+	body, errCode, err := readChangeBody(r)
+	if errCode != "" {
+		return nil, errCode, err
+	}
+
+	expiry := settings.ExpiryHours
+	if expiry < 1 {
+		expiry = defaultApprovalExpiryHours
+	}
+
+	now := time.Now()
+	change := &ConfigChange{
+		GuildID:        g.ID,
+		AuthorID:       user.ID,
+		AuthorUsername: user.Username,
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		ContentType:    r.Header.Get("Content-Type"),
+		Body:           body,
+		Status:         ConfigChangePending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(time.Duration(expiry) * time.Hour),
+	}
+
+	err = common.PQ.QueryRowContext(ctx, `INSERT INTO web_config_changes (guild_id, author_id, author_username, method, path, content_type, body, status, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		change.GuildID, change.AuthorID, change.AuthorUsername, change.Method, change.Path, change.ContentType, change.Body,
+		change.Status, change.CreatedAt, change.ExpiresAt).Scan(&change.ID)
+	if err != nil {
+		return nil, "failed", err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyChangeQueued,
+		&cplogs.Param{Type: cplogs.ParamTypeInt, Value: change.ID},
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: change.Summary()}))
+
+	if settings.WebhookURL != "" {
+		go notifyApprovalWebhook(settings.WebhookURL, fmt.Sprintf("**%s** submitted a change for approval: `%s`\nReview it at <%s/manage/%d/approvals>",
+			user.Username, change.Summary(), BaseURL(), g.ID))
+	}
+
+	return change, "", nil
+}
+
+func notifyApprovalWebhook(webhookURL string, content string) {
+	m := discordWebhookURLRegex.FindStringSubmatch(webhookURL)
+	if m == nil {
+		return
+	}
+
+	id, _ := strconv.ParseInt(m[1], 10, 64)
+	err := common.BotSession.WebhookExecute(id, m[2], false, &discordgo.WebhookParams{
+		Content:         content,
+		AllowedMentions: &discordgo.AllowedMentions{},
+	})
+	if err != nil {
+		logger.WithError(err).Warn("failed posting to the approval webhook")
+	}
+}
+
+// discardResponseWriter records the status of a replayed change, the response itself isn't needed
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (d *discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (d *discardResponseWriter) WriteHeader(code int) {
+	d.status = code
+}
+
+// replayConfigChange makes the change by replaying the request as the approving admin, it returns the error shown to
+// the admin if it failed, e.g if the settings are no longer valid
+func replayConfigChange(r *http.Request, change *ConfigChange) (string, error) {
+	ctx := context.WithValue(context.Background(), common.ContextKeyApprovedChange, change.ID)
+	ctx, tmpl := GetCreateTemplateData(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, change.Method, change.Path, strings.NewReader(string(change.Body)))
+	if err != nil {
+		return "", err
+	}
+
+	// the headers carry the session (or api key) of the approving admin
+	req.Header = r.Header.Clone()
+	req.Header.Set("Content-Type", change.ContentType)
+	if yagToken, _ := r.Context().Value(common.ContextKeyYagToken).(string); yagToken != "" {
+		// the approval itself passed the csrf check, the stored body has no token
+		req.Header.Set("X-CSRF-Token", CSRFTokenForSession(yagToken))
+	}
+	req.Host = r.Host
+	req.RemoteAddr = r.RemoteAddr
+	req.RequestURI = change.Path
+
+	rec := &discardResponseWriter{header: make(http.Header), status: http.StatusOK}
+	RootMux.ServeHTTP(rec, req)
+
+	for _, v := range tmpl.Alerts() {
+		if v.Style == AlertDanger {
+			return v.Message, nil
+		}
+	}
+
+	if rec.status >= 400 {
+		return fmt.Sprintf("The change failed with status %d", rec.status), nil
+	}
+
+	return "", nil
+}
+
+// ApproveConfigChange applies the change and marks it approved, both happen or neither does. The change stays pending if
+// it fails to apply, so it can be fixed up and approved again or rejected.
+func ApproveConfigChange(r *http.Request, g *dstate.GuildSet, id int64) (*ConfigChange, error) {
+	ctx := r.Context()
+	user := ContextUser(ctx)
+	if GetIsReadOnly(ctx) {
+		return nil, NewPublicError(readOnlyRejectedMsg)
+	}
+
+	tx, err := common.PQ.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// locked until the transaction is done, so it can't be approved or rejected twice
+	change, err := scanConfigChange(tx.QueryRowContext(ctx, "SELECT "+configChangeColumns+" FROM web_config_changes WHERE guild_id = $1 AND id = $2 FOR UPDATE", g.ID, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewPublicError("Unknown change")
+		}
+		return nil, err
+	}
+
+	if err = checkDecidable(change, user); err != nil {
+		return nil, err
+	}
+
+	failure, err := replayConfigChange(r, change)
+	if err != nil {
+		return nil, err
+	}
+
+	if failure != "" {
+		return nil, NewPublicError("The change could not be applied and is still pending: ", failure)
+	}
+
+	err = decideConfigChange(ctx, tx, change, user, ConfigChangeApproved)
+	if err != nil {
+		return nil, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyChangeApproved,
+		&cplogs.Param{Type: cplogs.ParamTypeInt, Value: change.ID},
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: change.AuthorUsername}))
+
+	return change, nil
+}
+
+// RejectConfigChange marks the change as rejected, it's never applied
+func RejectConfigChange(ctx context.Context, g *dstate.GuildSet, id int64) (*ConfigChange, error) {
+	user := ContextUser(ctx)
+	if GetIsReadOnly(ctx) {
+		return nil, NewPublicError(readOnlyRejectedMsg)
+	}
+
+	tx, err := common.PQ.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	change, err := scanConfigChange(tx.QueryRowContext(ctx, "SELECT "+configChangeColumns+" FROM web_config_changes WHERE guild_id = $1 AND id = $2 FOR UPDATE", g.ID, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewPublicError("Unknown change")
+		}
+		return nil, err
+	}
+
+	// the author can withdraw their own change
+	if change.AuthorID != user.ID {
+		if err = checkDecidable(change, user); err != nil {
+			return nil, err
+		}
+	} else if change.Status != ConfigChangePending || time.Now().After(change.ExpiresAt) {
+		return nil, NewPublicError("This change is no longer pending")
+	}
+
+	err = decideConfigChange(ctx, tx, change, user, ConfigChangeRejected)
+	if err != nil {
+		return nil, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyChangeRejected,
+		&cplogs.Param{Type: cplogs.ParamTypeInt, Value: change.ID},
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: change.AuthorUsername}))
+
+	return change, nil
+}
+
+// checkDecidable returns a public error if the user can't approve or reject the change
+func checkDecidable(change *ConfigChange, user *discordgo.User) error {
+	if change.Status != ConfigChangePending || time.Now().After(change.ExpiresAt) {
+		return NewPublicError("This change is no longer pending")
+	}
+
+	if change.AuthorID == user.ID {
+		return NewPublicError("Changes have to be approved by another admin")
+	}
+
+	return nil
+}
+
+func decideConfigChange(ctx context.Context, tx *sql.Tx, change *ConfigChange, user *discordgo.User, status string) error {
+	now := time.Now()
+	_, err := tx.ExecContext(ctx, "UPDATE web_config_changes SET status = $2, decided_by = $3, decided_by_username = $4, decided_at = $5 WHERE id = $1",
+		change.ID, status, user.ID, user.Username, now)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	change.Status = status
+	change.DecidedBy = user.ID
+	change.DecidedByUsername = user.Username
+	change.DecidedAt = &now
+	return nil
+}
+
+type ApprovalSettingsForm struct {
+	Enabled     bool
+	WebhookURL  string `valid:",500"`
+	ExpiryHours int    `valid:"1,720"`
+}
+
+// HandleGetApprovals handles GET /manage/:server/approvals
+func HandleGetApprovals(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+
+	settings, err := GetApprovalSettings(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+	tmpl["ApprovalSettings"] = settings
+
+	pending, decided, err := GetConfigChanges(ctx, g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["PendingChanges"] = pending
+	tmpl["DecidedChanges"] = decided
+	tmpl["IsGuildOwner"] = ContextUser(ctx).ID == g.OwnerID
+	return tmpl, nil
+}
+
+// HandleGetApprovalsJSON handles GET /manage/:server/approvals.json
+func HandleGetApprovalsJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	pending, decided, err := GetConfigChanges(ctx, ContextGuild(ctx).ID)
+	if err != nil {
+		return err
+	}
+
+	if pending == nil {
+		pending = []*ConfigChange{}
+	}
+	if decided == nil {
+		decided = []*ConfigChange{}
+	}
+
+	return map[string]interface{}{"pending": pending, "decided": decided}
+}
+
+// HandlePostApprovalSettings handles POST /manage/:server/approvals/settings
+func HandlePostApprovalSettings(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/approvals")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*ApprovalSettingsForm)
+	if form.WebhookURL != "" && !discordWebhookURLRegex.MatchString(form.WebhookURL) {
+		return tmpl, NewPublicError("The webhook url has to be a discord webhook url")
+	}
+
+	err := common.SetRedisJson(keyApprovalSettings(g.ID), &ApprovalSettings{
+		Enabled:     form.Enabled,
+		WebhookURL:  form.WebhookURL,
+		ExpiryHours: form.ExpiryHours,
+	})
+	if err != nil {
+		return tmpl, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyApprovalSettings))
+	return tmpl, nil
+}
+
+// HandleApproveChange handles POST /manage/:server/approvals/:change/approve
+func HandleApproveChange(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/approvals")
+
+	id, _ := strconv.ParseInt(pat.Param(r, "change"), 10, 64)
+	_, err := ApproveConfigChange(r, g, id)
+	return tmpl, err
+}
+
+// HandleRejectChange handles POST /manage/:server/approvals/:change/reject
+func HandleRejectChange(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/approvals")
+
+	id, _ := strconv.ParseInt(pat.Param(r, "change"), 10, 64)
+	_, err := RejectConfigChange(ctx, g, id)
+	return tmpl, err
+}
+
+// HandleApproveChangeJSON handles POST /manage/:server/approvals/:change/approve.json
+func HandleApproveChangeJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	id, _ := strconv.ParseInt(pat.Param(r, "change"), 10, 64)
+	change, err := ApproveConfigChange(r, ContextGuild(r.Context()), id)
+	if err != nil {
+		return err
+	}
+
+	return change
+}
+
+// HandleRejectChangeJSON handles POST /manage/:server/approvals/:change/reject.json
+func HandleRejectChangeJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	id, _ := strconv.ParseInt(pat.Param(r, "change"), 10, 64)
+	change, err := RejectConfigChange(ctx, ContextGuild(ctx), id)
+	if err != nil {
+		return err
+	}
+
+	return change
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsApprovalExempt(t *testing.T) {
+	ExemptFromApprovals("/test-exempt")
+
+	cases := []struct {
+		path   string
+		exempt bool
+	}{
+		{"/test-exempt", true},
+		{"/approvals/123/approve", true},
+		{"/approvals/123/reject.json", true},
+		{"/approvals/settings", false},
+		{"/approvals/abc/approve", false},
+		{"/autorole", false},
+	}
+
+	for _, c := range cases {
+		if got := isApprovalExempt(c.path); got != c.exempt {
+			t.Errorf("isApprovalExempt(%q) = %v, want %v", c.path, got, c.exempt)
+		}
+	}
+}
+
+func TestConfigChangeFields(t *testing.T) {
+	form := &ConfigChange{ContentType: "application/x-www-form-urlencoded", Body: []byte("b=2&a=1&b=3")}
+	want := []*ConfigChangeField{{"a", "1"}, {"b", "2"}, {"b", "3"}}
+	if got := form.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("form fields = %v, want %v", got, want)
+	}
+
+	raw := &ConfigChange{ContentType: "application/json", Body: []byte(`{"a":1}`)}
+	want = []*ConfigChangeField{{"application/json", `{"a":1}`}}
+	if got := raw.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("json fields = %v, want %v", got, want)
+	}
+
+	binary := &ConfigChange{ContentType: "application/octet-stream", Body: []byte{0xff, 0xfe}}
+	want = []*ConfigChangeField{{"application/octet-stream", "2 bytes"}}
+	if got := binary.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("binary fields = %v, want %v", got, want)
+	}
+}
+
+func TestConfigChangeSummary(t *testing.T) {
+	c := &ConfigChange{GuildID: 1234, Method: "POST", Path: "/manage/1234/autorole"}
+	if got := c.Summary(); got != "POST /autorole" {
+		t.Errorf("Summary() = %q, want %q", got, "POST /autorole")
+	}
+}
+
+func TestDiscordWebhookURLRegex(t *testing.T) {
+	cases := map[string]bool{
+		"https://discord.com/api/webhooks/123/abc-DEF_1":        true,
+		"https://canary.discord.com/api/v10/webhooks/123/abc":   true,
+		"https://discordapp.com/api/webhooks/123/abc":           true,
+		"http://discord.com/api/webhooks/123/abc":               false,
+		"https://discord.com.evil.example/api/webhooks/123/abc": false,
+		"https://discord.com/api/webhooks/abc/abc":              false,
+	}
+
+	for u, valid := range cases {
+		if got := discordWebhookURLRegex.MatchString(u); got != valid {
+			t.Errorf("matching %q = %v, want %v", u, got, valid)
+		}
+	}
+}
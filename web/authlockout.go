@@ -0,0 +1,112 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confAuthLockoutThreshold = config.RegisterOption("yagpdb.web.auth_lockout_threshold", "Amount of failed authentication attempts (invalid session cookies or oauth states) from one ip before it's temporarily blocked, 0 to disable", 20)
+	confAuthLockoutWindow    = config.RegisterOption("yagpdb.web.auth_lockout_window", "Seconds the failed authentication attempts are counted over", 600)
+	confAuthLockoutDuration  = config.RegisterOption("yagpdb.web.auth_lockout_duration", "Seconds an ip is blocked from authenticating after too many failures", 900)
+
+	metricsAuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_web_auth_failures_total",
+		Help: "Failed authentication attempts",
+	}, []string{"kind"})
+
+	metricsAuthLockouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "yagpdb_web_auth_lockouts_total",
+		Help: "IPs temporarily blocked from authenticating because of too many failures",
+	})
+)
+
+func keyAuthFailures(ip string) string {
+	return "web_auth_failures:" + ip
+}
+
+func keyAuthLockout(ip string) string {
+	return "web_auth_lockout:" + ip
+}
+
+// the lockout state is checked on every request with a session cookie, so remember it locally for a bit to keep the redis load down
+var authLockoutCache = cache.New(time.Second*10, time.Minute)
+
+func authClientIP(r *http.Request) string {
+	return ClientIP(r)
+}
+
+// isAuthLockedOut returns true if the ip of the request is temporarily blocked from authenticating
+func isAuthLockedOut(r *http.Request) bool {
+	if confAuthLockoutThreshold.GetInt() <= 0 {
+		return false
+	}
+
+	ip := authClientIP(r)
+	if v, ok := authLockoutCache.Get(ip); ok {
+		return v.(bool)
+	}
+
+	var locked bool
+	err := common.RedisPool.Do(radix.Cmd(&locked, "EXISTS", keyAuthLockout(ip)))
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed checking auth lockout")
+		return false
+	}
+
+	authLockoutCache.SetDefault(ip, locked)
+	return locked
+}
+
+// recordAuthFailure counts a failed authentication attempt from the ip of the request, blocking it if there's been too many
+func recordAuthFailure(r *http.Request, kind string) {
+	EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventAuthFailure, Details: map[string]string{"kind": kind}})
+
+	threshold := confAuthLockoutThreshold.GetInt()
+	if threshold <= 0 {
+		return
+	}
+
+	metricsAuthFailures.With(prometheus.Labels{"kind": kind}).Inc()
+
+	ip := authClientIP(r)
+	key := keyAuthFailures(ip)
+
+	var failures int
+	err := common.RedisPool.Do(radix.Cmd(&failures, "INCR", key))
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed counting auth failure")
+		return
+	}
+
+	if failures == 1 {
+		common.RedisPool.Do(radix.Cmd(nil, "EXPIRE", key, strconv.Itoa(confAuthLockoutWindow.GetInt())))
+	}
+
+	if failures < threshold {
+		return
+	}
+
+	duration := confAuthLockoutDuration.GetInt()
+	err = common.MultipleCmds(
+		radix.Cmd(nil, "SET", keyAuthLockout(ip), "1", "EX", strconv.Itoa(duration)),
+		radix.Cmd(nil, "DEL", key),
+	)
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed setting auth lockout")
+		return
+	}
+
+	authLockoutCache.SetDefault(ip, true)
+	metricsAuthLockouts.Inc()
+	EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventAuthLockout, Details: map[string]string{"kind": kind}})
+	CtxLogger(r.Context()).WithField("ip", ip).Warnf("Blocked ip from authenticating for %d seconds after %d failed attempts (last one: %s)", duration, failures, kind)
+}
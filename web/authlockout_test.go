@@ -0,0 +1,91 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestAuthLockoutDisabled(t *testing.T) {
+	defer func(old interface{}) { confAuthLockoutThreshold.LoadedValue = old }(confAuthLockoutThreshold.LoadedValue)
+	confAuthLockoutThreshold.LoadedValue = 0
+
+	r := httptest.NewRequest("GET", "/confirm_login", nil)
+	authLockoutCache.SetDefault(authClientIP(r), true)
+	defer authLockoutCache.Delete(authClientIP(r))
+
+	// redis isn't touched at all when it's disabled
+	recordAuthFailure(r, "session")
+	if isAuthLockedOut(r) {
+		t.Error("locked out with the lockout disabled")
+	}
+}
+
+func TestAuthLockoutCached(t *testing.T) {
+	defer func(old interface{}) { confAuthLockoutThreshold.LoadedValue = old }(confAuthLockoutThreshold.LoadedValue)
+	confAuthLockoutThreshold.LoadedValue = 3
+
+	r := httptest.NewRequest("GET", "/confirm_login", nil)
+	r.RemoteAddr = "198.51.100.7:1234"
+
+	authLockoutCache.SetDefault(authClientIP(r), true)
+	defer authLockoutCache.Delete(authClientIP(r))
+
+	if !isAuthLockedOut(r) {
+		t.Error("expected the cached lockout to be used")
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	defer func(threshold, window, duration interface{}) {
+		confAuthLockoutThreshold.LoadedValue = threshold
+		confAuthLockoutWindow.LoadedValue = window
+		confAuthLockoutDuration.LoadedValue = duration
+	}(confAuthLockoutThreshold.LoadedValue, confAuthLockoutWindow.LoadedValue, confAuthLockoutDuration.LoadedValue)
+	confAuthLockoutThreshold.LoadedValue = 3
+	confAuthLockoutWindow.LoadedValue = 60
+	confAuthLockoutDuration.LoadedValue = 60
+
+	r := httptest.NewRequest("GET", "/confirm_login", nil)
+	r.RemoteAddr = "203.0.113.15:1234"
+	ip := authClientIP(r)
+
+	common.RedisPool.Do(radix.Cmd(nil, "DEL", keyAuthFailures(ip), keyAuthLockout(ip)))
+	authLockoutCache.Delete(ip)
+	defer common.RedisPool.Do(radix.Cmd(nil, "DEL", keyAuthFailures(ip), keyAuthLockout(ip)))
+	defer authLockoutCache.Delete(ip)
+
+	for i := 0; i < 2; i++ {
+		recordAuthFailure(r, "session")
+	}
+
+	if isAuthLockedOut(r) {
+		t.Fatal("locked out before reaching the threshold")
+	}
+
+	// the not locked out state is cached too
+	authLockoutCache.Delete(ip)
+
+	recordAuthFailure(r, "oauth_state")
+	if !isAuthLockedOut(r) {
+		t.Fatal("expected to be locked out after reaching the threshold")
+	}
+
+	// checked from redis on the other nodes
+	authLockoutCache.Delete(ip)
+	if !isAuthLockedOut(r) {
+		t.Error("expected the lockout to be stored in redis")
+	}
+
+	var failures int
+	common.RedisPool.Do(radix.Cmd(&failures, "GET", keyAuthFailures(ip)))
+	if failures != 0 {
+		t.Errorf("expected the failures to be reset with the lockout, got %d", failures)
+	}
+}
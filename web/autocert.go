@@ -0,0 +1,68 @@
+package web
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var (
+	confAutocert             = config.RegisterOption("yagpdb.web.autocert", "Obtain and renew the https certificates from Let's Encrypt when serving https, when disabled the certificate is loaded from yagpdb.web.tls_cert_file and yagpdb.web.tls_key_file", true)
+	confAutocertCacheDir     = config.RegisterOption("yagpdb.web.autocert_cache_dir", "Directory the certificates from Let's Encrypt are stored in, so they survive restarts", "cert")
+	confAutocertDirectoryURL = config.RegisterOption("yagpdb.web.autocert_directory_url", "ACME directory to get the certificates from, e.g https://acme-staging-v02.api.letsencrypt.org/directory while testing, empty for Let's Encrypt", "")
+	confTLSCertFile          = config.RegisterOption("yagpdb.web.tls_cert_file", "Path to the pem encoded certificate (chain) to serve https with when yagpdb.web.autocert is disabled", "")
+	confTLSKeyFile           = config.RegisterOption("yagpdb.web.tls_key_file", "Path to the pem encoded private key of yagpdb.web.tls_cert_file", "")
+)
+
+// setupTLS returns the tls config of the https server and the handler of the plain http listener next to it.
+//
+// With autocert the certificates of the main host and the verified custom domains are obtained on the first request
+// for them and renewed in the background. Challenges are answered over tls-alpn-01 on the https listener, with
+// http-01 on the http listener as the fallback for when the https port isn't the one Let's Encrypt connects to
+// (e.g behind a port forward). Everything else on the http listener is redirected to https.
+func setupTLS() (*tls.Config, http.Handler, error) {
+	redir := http.HandlerFunc(httpsRedirHandler)
+
+	if !confAutocert.GetBool() {
+		certFile, keyFile := confTLSCertFile.GetString(), confTLSKeyFile.GetString()
+		if certFile == "" || keyFile == "" {
+			return nil, nil, errors.New("yagpdb.web.autocert is disabled but yagpdb.web.tls_cert_file or yagpdb.web.tls_key_file isn't set")
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, errors.WrapIf(err, "failed loading tls certificate")
+		}
+
+		logger.Info("Serving https with the certificate from ", certFile)
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, redir, nil
+	}
+
+	if mainHostname() == "" {
+		logger.Warn("yagpdb.host isn't set, Let's Encrypt certificates can only be obtained for custom domains")
+	}
+
+	certManager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: CustomDomainHostPolicy,
+		Email:      common.ConfEmail.GetString(),
+		Cache:      autocert.DirCache(confAutocertCacheDir.GetString()),
+	}
+
+	dirURL := confAutocertDirectoryURL.GetString()
+	if dirURL != "" {
+		certManager.Client = &acme.Client{DirectoryURL: dirURL}
+	} else {
+		dirURL = acme.LetsEncryptURL
+	}
+
+	logger.Info("Serving https with certificates from ", dirURL, ", cached in ", confAutocertCacheDir.GetString())
+
+	// TLSConfig also advertises the acme-tls/1 protocol for the tls-alpn-01 challenges
+	return certManager.TLSConfig(), certManager.HTTPHandler(redir), nil
+}
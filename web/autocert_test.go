@@ -0,0 +1,115 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "yagpdb.test"},
+		DNSNames:     []string{"yagpdb.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestSetupTLSFromFiles(t *testing.T) {
+	confAutocert.LoadedValue = false
+	defer func() { confAutocert.LoadedValue = true }()
+
+	confTLSCertFile.LoadedValue = ""
+	confTLSKeyFile.LoadedValue = ""
+	if _, _, err := setupTLS(); err == nil {
+		t.Error("expected an error without certificate files")
+	}
+
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+	confTLSCertFile.LoadedValue = certFile
+	confTLSKeyFile.LoadedValue = keyFile
+	defer func() {
+		confTLSCertFile.LoadedValue = ""
+		confTLSKeyFile.LoadedValue = ""
+	}()
+
+	tlsConfig, httpHandler, err := setupTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tlsConfig.Certificates) != 1 {
+		t.Errorf("expected the certificate to be loaded, got %d", len(tlsConfig.Certificates))
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/manage?a=b", nil)
+	r.Host = "yagpdb.test"
+	httpHandler.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://yagpdb.test/manage?a=b" {
+		t.Errorf("expected a redirect to https, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestSetupTLSAutocert(t *testing.T) {
+	confAutocert.LoadedValue = true
+	confAutocertCacheDir.LoadedValue = t.TempDir()
+	defer func() { confAutocertCacheDir.LoadedValue = "cert" }()
+
+	tlsConfig, httpHandler, err := setupTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tlsConfig.GetCertificate == nil {
+		t.Error("expected the certificates to come from autocert")
+	}
+
+	alpn := false
+	for _, proto := range tlsConfig.NextProtos {
+		alpn = alpn || proto == acme.ALPNProto
+	}
+	if !alpn {
+		t.Errorf("expected tls-alpn-01 challenges to be enabled, got protocols %v", tlsConfig.NextProtos)
+	}
+
+	// anything but the http-01 challenges is still redirected
+	w := httptest.NewRecorder()
+	httpHandler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("expected a redirect to https, got %d", w.Code)
+	}
+}
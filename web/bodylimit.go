@@ -0,0 +1,146 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+var (
+	confMaxBodyBytes         = config.RegisterOption("yagpdb.web.max_body_bytes", "Max size in bytes of request bodies, routes accepting uploads allow more with MaxBodyBytes. 0 disables it", 1000000)
+	confMultipartMemoryBytes = config.RegisterOption("yagpdb.web.multipart_memory_bytes", "Bytes of multipart forms kept in memory while parsing them, the rest of the files are written to temporary files", 100000)
+)
+
+// ErrBodyTooLarge is returned when reading more of the request body than the route allows
+var ErrBodyTooLarge = NewPublicError("What you submitted is too large")
+
+// limitedBody fails reads past the limit, which is checked against the announced content length before reading
+// anything so oversized uploads are rejected right away
+type limitedBody struct {
+	io.ReadCloser
+	limit         int64
+	contentLength int64
+	read          int64
+}
+
+func (b *limitedBody) exceeded() bool {
+	return b.contentLength > b.limit || b.read > b.limit
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded() {
+		return 0, ErrBodyTooLarge
+	}
+
+	// reads one byte more than the limit to tell a body of exactly the limit apart from a larger one
+	if remaining := b.limit - b.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n - int(b.read-b.limit), ErrBodyTooLarge
+	}
+
+	return n, err
+}
+
+// MaxBodyBytesMiddleware limits the size of request bodies to yagpdb.web.max_body_bytes, the limit is enforced
+// when the body is read so the routes below can change it with MaxBodyBytes
+func MaxBodyBytesMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := int64(confMaxBodyBytes.GetInt())
+		if limit > 0 && r.Body != nil && r.Body != http.NoBody {
+			r.Body = &limitedBody{ReadCloser: r.Body, limit: limit, contentLength: r.ContentLength}
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// MaxBodyBytes returns a middleware changing the max body size of the routes it's used on, for the ones accepting
+// uploads. It has to run before anything reads the body.
+func MaxBodyBytes(limit int64) func(http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		return NamedMiddleware("max_body_bytes", inner, func(w http.ResponseWriter, r *http.Request) {
+			if b, ok := r.Body.(*limitedBody); ok {
+				b.limit = limit
+			}
+
+			inner.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isBodyTooLarge returns true if err is the result of reading more of the body than the route allows, parsing
+// multipart forms doesn't wrap the errors so the body is checked too
+func isBodyTooLarge(r *http.Request, err error) bool {
+	if err == ErrBodyTooLarge {
+		return true
+	}
+
+	b, ok := r.Body.(*limitedBody)
+	return ok && b.exceeded()
+}
+
+// bodyTooLargeError returns ErrBodyTooLarge with the limit of the route
+func bodyTooLargeError(r *http.Request) error {
+	if b, ok := r.Body.(*limitedBody); ok {
+		return NewPublicError(ErrBodyTooLarge, ", the max is ", formatBytes(b.limit))
+	}
+
+	return ErrBodyTooLarge
+}
+
+// statusWriter sends code instead of 200, so pages rendered as part of a error response have the right status
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+	if code == http.StatusOK {
+		code = w.code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// rejectBodyTooLarge responds with a 413 to a form that was too large, the page the form was on is rendered with
+// an alert, or only the alert for partial requests made by the control panel forms
+func rejectBodyTooLarge(w http.ResponseWriter, r *http.Request, inner http.Handler, dst interface{}) {
+	ctx, tmpl := GetCreateTemplateData(r.Context())
+	CtxLogger(ctx).WithField("content_length", r.ContentLength).Info("Rejected a too large form")
+
+	msg := bodyTooLargeError(r).Error()
+
+	if IsRequestPartial(ctx) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		LogIgnoreErr(json.NewEncoder(w).Encode([]*Alert{ErrorAlert(msg)}))
+		return
+	}
+
+	tmpl.AddAlerts(ErrorAlert(msg))
+	ctx = context.WithValue(ctx, common.ContextKeyParsedForm, dst)
+	ctx = context.WithValue(ctx, common.ContextKeyFormOk, false)
+	inner.ServeHTTP(&statusWriter{ResponseWriter: w, code: http.StatusRequestEntityTooLarge}, r.WithContext(ctx))
+}
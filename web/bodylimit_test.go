@@ -0,0 +1,75 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitedBody(t *testing.T) {
+	cases := []struct {
+		body          string
+		limit         int64
+		contentLength int64
+		tooLarge      bool
+	}{
+		{"hello", 5, 5, false},
+		{"hello", 5, -1, false},
+		{"hello!", 5, -1, true},
+		{"hello!", 5, 6, true},
+		// lying about the length doesn't help
+		{"hello!", 5, 1, true},
+	}
+
+	for _, c := range cases {
+		b := &limitedBody{ReadCloser: io.NopCloser(strings.NewReader(c.body)), limit: c.limit, contentLength: c.contentLength}
+		data, err := io.ReadAll(b)
+		if tooLarge := err == ErrBodyTooLarge; tooLarge != c.tooLarge {
+			t.Errorf("%q with limit %d and length %d: got error %v, want too large %v", c.body, c.limit, c.contentLength, err, c.tooLarge)
+		}
+
+		if int64(len(data)) > c.limit {
+			t.Errorf("%q with limit %d: read %d bytes past the limit", c.body, c.limit, len(data))
+		}
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	confMaxBodyBytes.LoadedValue = 10
+
+	var readErr error
+	read := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	})
+
+	serve := func(handler http.Handler, body string) {
+		readErr = nil
+		MaxBodyBytesMiddleware(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	}
+
+	serve(read, strings.Repeat("a", 10))
+	if readErr != nil {
+		t.Errorf("expected a body at the limit to be read, got %v", readErr)
+	}
+
+	serve(read, strings.Repeat("a", 11))
+	if readErr != ErrBodyTooLarge {
+		t.Errorf("expected a body over the limit to be rejected, got %v", readErr)
+	}
+
+	serve(MaxBodyBytes(20)(read), strings.Repeat("a", 20))
+	if readErr != nil {
+		t.Errorf("expected the route to allow a larger body, got %v", readErr)
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &statusWriter{ResponseWriter: rec, code: http.StatusRequestEntityTooLarge}
+	w.Write([]byte("page"))
+	if rec.Code != http.StatusRequestEntityTooLarge || rec.Body.String() != "page" {
+		t.Errorf("got %d: %s", rec.Code, rec.Body.String())
+	}
+}
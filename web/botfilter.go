@@ -0,0 +1,253 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Bot filter strictness levels
+const (
+	BotFilterOff = iota
+	// Reject form submissions with the honeypot field filled in
+	BotFilterHoneypot
+	// Also reject requests without a user agent, and require proof of work on form submissions while under load
+	BotFilterPoWUnderLoad
+	// Always require proof of work on form submissions
+	BotFilterPoWAlways
+)
+
+const (
+	botFilterHoneypotField = "contact_website"
+	botFilterChallengeTTL  = time.Minute * 10
+	botFilterKeyRedisKey   = "web_bot_filter_key"
+)
+
+var (
+	confBotFilterStrictness    = config.RegisterOption("yagpdb.web.bot_filter_strictness", "Bot filtering on public pages: 0 off, 1 honeypot fields, 2 also proof of work under load, 3 always proof of work", BotFilterHoneypot)
+	confBotFilterLoadThreshold = config.RegisterOption("yagpdb.web.bot_filter_load_threshold", "Requests per second to public pages above which proof of work is required (with strictness 2)", 50)
+	confBotFilterPoWDifficulty = config.RegisterOption("yagpdb.web.bot_filter_pow_difficulty", "Amount of leading zero bits required in proof of work solutions", 16)
+
+	metricsBotFilterBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_web_bot_filter_blocked_total",
+		Help: "Requests to public pages blocked by the bot filter",
+	}, []string{"reason"})
+)
+
+// publicLoadMeter keeps track of the amount of requests to public pages in the last second
+type publicLoadMeter struct {
+	mu       sync.Mutex
+	second   int64
+	current  int
+	previous int
+}
+
+func (l *publicLoadMeter) hit() (rate int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().Unix()
+	if now != l.second {
+		if now == l.second+1 {
+			l.previous = l.current
+		} else {
+			l.previous = 0
+		}
+		l.second = now
+		l.current = 0
+	}
+
+	l.current++
+	if l.current > l.previous {
+		return l.current
+	}
+
+	return l.previous
+}
+
+var publicLoad = &publicLoadMeter{}
+
+var (
+	botFilterKey   []byte
+	botFilterKeyMU sync.Mutex
+)
+
+// getBotFilterKey returns the key used to sign proof of work challenges, it's shared between all web nodes through redis
+func getBotFilterKey() ([]byte, error) {
+	botFilterKeyMU.Lock()
+	defer botFilterKeyMU.Unlock()
+
+	if botFilterKey != nil {
+		return botFilterKey, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	err := common.RedisPool.Do(radix.Cmd(nil, "SET", botFilterKeyRedisKey, hex.EncodeToString(b), "NX"))
+	if err != nil {
+		return nil, err
+	}
+
+	var stored string
+	err = common.RedisPool.Do(radix.Cmd(&stored, "GET", botFilterKeyRedisKey))
+	if err != nil {
+		return nil, err
+	}
+
+	botFilterKey, err = hex.DecodeString(stored)
+	return botFilterKey, err
+}
+
+func signChallenge(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newPoWChallenge creates a signed challenge in the format of "<unix>.<random>.<difficulty>.<signature>"
+func newPoWChallenge(difficulty int) (string, error) {
+	key, err := getBotFilterKey()
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	payload := strconv.FormatInt(time.Now().Unix(), 10) + "." + hex.EncodeToString(b) + "." + strconv.Itoa(difficulty)
+	return payload + "." + signChallenge(key, payload), nil
+}
+
+// verifyPoW checks that the challenge is valid and unused, and that nonce solves it
+func verifyPoW(challenge, nonce string) (bool, error) {
+	split := strings.Split(challenge, ".")
+	if len(split) != 4 || nonce == "" {
+		return false, nil
+	}
+
+	key, err := getBotFilterKey()
+	if err != nil {
+		return false, err
+	}
+
+	payload := strings.Join(split[:3], ".")
+	if !hmac.Equal([]byte(signChallenge(key, payload)), []byte(split[3])) {
+		return false, nil
+	}
+
+	issued, _ := strconv.ParseInt(split[0], 10, 64)
+	if time.Since(time.Unix(issued, 0)) > botFilterChallengeTTL {
+		return false, nil
+	}
+
+	difficulty, _ := strconv.Atoi(split[2])
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+nonce))) < difficulty {
+		return false, nil
+	}
+
+	// make sure every challenge is only used once
+	var set string
+	err = common.RedisPool.Do(radix.Cmd(&set, "SET", "web_bot_filter_used:"+split[1], "1", "EX", strconv.Itoa(int(botFilterChallengeTTL.Seconds())), "NX"))
+	if err != nil {
+		return false, err
+	}
+
+	return set == "OK", nil
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b == 0 {
+			n += 8
+			continue
+		}
+
+		n += bits.LeadingZeros8(b)
+		break
+	}
+
+	return n
+}
+
+func blockBotRequest(w http.ResponseWriter, r *http.Request, reason string, msg string) {
+	metricsBotFilterBlocked.With(prometheus.Labels{"reason": reason}).Inc()
+	CtxLogger(r.Context()).WithField("reason", reason).Debug("Bot filter blocked request")
+	http.Error(w, msg, http.StatusForbidden)
+}
+
+// BotFilterMW filters out bot traffic to public pages, forms on them should include the "bot_filter_fields" template
+func BotFilterMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		strictness := confBotFilterStrictness.GetInt()
+		if strictness <= BotFilterOff {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		rate := publicLoad.hit()
+
+		if strictness >= BotFilterPoWUnderLoad && r.UserAgent() == "" {
+			blockBotRequest(w, r, "user_agent", "Missing user agent")
+			return
+		}
+
+		ctx, tmpl := GetCreateTemplateData(r.Context())
+		r = r.WithContext(ctx)
+		tmpl["BotFilterHoneypot"] = botFilterHoneypotField
+
+		if strictness >= BotFilterPoWUnderLoad {
+			difficulty := confBotFilterPoWDifficulty.GetInt()
+			challenge, err := newPoWChallenge(difficulty)
+			if err != nil {
+				CtxLogger(ctx).WithError(err).Error("failed creating proof of work challenge")
+			} else {
+				tmpl["BotFilterChallenge"] = challenge
+				tmpl["BotFilterDifficulty"] = difficulty
+			}
+		}
+
+		if isReadOnlyMethod(r.Method) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if r.FormValue(botFilterHoneypotField) != "" {
+			blockBotRequest(w, r, "honeypot", "Request blocked")
+			return
+		}
+
+		requirePoW := strictness >= BotFilterPoWAlways || (strictness >= BotFilterPoWUnderLoad && rate > confBotFilterLoadThreshold.GetInt())
+		if requirePoW {
+			ok, err := verifyPoW(r.FormValue("pow_challenge"), r.FormValue("pow_nonce"))
+			if err != nil {
+				CtxLogger(ctx).WithError(err).Error("failed verifying proof of work")
+			}
+
+			if !ok {
+				blockBotRequest(w, r, "proof_of_work", "Request blocked, make sure javascript is enabled and try again")
+				return
+			}
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+func TestLeadingZeroBits(t *testing.T) {
+	cases := []struct {
+		prefix   []byte
+		expected int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x40}, 9},
+		{[]byte{0x00, 0x00, 0x0f}, 20},
+	}
+
+	for _, c := range cases {
+		var sum [sha256.Size]byte
+		copy(sum[:], c.prefix)
+		sum[len(sum)-1] = 1
+
+		if got := leadingZeroBits(sum); got != c.expected {
+			t.Errorf("%x: got %d, expected %d", c.prefix, got, c.expected)
+		}
+	}
+}
+
+func TestPublicLoadMeter(t *testing.T) {
+	meter := &publicLoadMeter{}
+	started := time.Now().Unix()
+
+	var rates []int
+	for i := 0; i < 5; i++ {
+		rates = append(rates, meter.hit())
+	}
+
+	// the previous second counts until the current one passes it
+	meter.second--
+	rates = append(rates, meter.hit())
+
+	// seconds further back don't
+	meter.second -= 2
+	rates = append(rates, meter.hit())
+
+	if time.Now().Unix() != started {
+		t.Skip("the second changed during the test")
+	}
+
+	expected := []int{1, 2, 3, 4, 5, 5, 1}
+	for i, v := range expected {
+		if rates[i] != v {
+			t.Errorf("got rates %v, expected %v", rates, expected)
+			break
+		}
+	}
+}
+
+func botFilterRequest(method string, form url.Values, userAgent string) *http.Request {
+	r := httptest.NewRequest(method, "/verify/1/abc", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("User-Agent", userAgent)
+	return r
+}
+
+func TestBotFilterMW(t *testing.T) {
+	defer func(old interface{}) { confBotFilterStrictness.LoadedValue = old }(confBotFilterStrictness.LoadedValue)
+
+	var honeypot interface{}
+	handler := BotFilterMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, tmpl := GetCreateTemplateData(r.Context())
+		honeypot = tmpl["BotFilterHoneypot"]
+	}))
+
+	cases := []struct {
+		name       string
+		strictness int
+		r          *http.Request
+		status     int
+	}{
+		{"off", BotFilterOff, botFilterRequest("POST", url.Values{botFilterHoneypotField: {"x"}}, ""), http.StatusOK},
+		{"get", BotFilterHoneypot, botFilterRequest("GET", nil, "browser"), http.StatusOK},
+		{"honeypot empty", BotFilterHoneypot, botFilterRequest("POST", url.Values{"a": {"b"}}, "browser"), http.StatusOK},
+		{"honeypot filled", BotFilterHoneypot, botFilterRequest("POST", url.Values{botFilterHoneypotField: {"x"}}, "browser"), http.StatusForbidden},
+		{"honeypot without user agent", BotFilterHoneypot, botFilterRequest("POST", nil, ""), http.StatusOK},
+		{"pow without user agent", BotFilterPoWUnderLoad, botFilterRequest("GET", nil, ""), http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		confBotFilterStrictness.LoadedValue = c.strictness
+		honeypot = nil
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, c.r)
+		if w.Code != c.status {
+			t.Errorf("%s: got status %d, expected %d", c.name, w.Code, c.status)
+		}
+
+		if c.status == http.StatusOK && c.strictness != BotFilterOff && honeypot != botFilterHoneypotField {
+			t.Errorf("%s: expected the honeypot field in the template data, got %v", c.name, honeypot)
+		}
+	}
+}
+
+// solvePoW brute forces a nonce for the challenge
+func solvePoW(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+nonce))) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+func TestVerifyPoWInvalid(t *testing.T) {
+	defer func(old []byte) { botFilterKey = old }(botFilterKey)
+	botFilterKey = []byte("key")
+
+	payload := strconv.FormatInt(time.Now().Unix(), 10) + ".abc.8"
+	valid := payload + "." + signChallenge(botFilterKey, payload)
+
+	expiredPayload := strconv.FormatInt(time.Now().Add(-botFilterChallengeTTL*2).Unix(), 10) + ".abc.8"
+	expired := expiredPayload + "." + signChallenge(botFilterKey, expiredPayload)
+
+	// the signature covers the difficulty, so it can't be lowered
+	lowered := strings.Replace(valid, ".abc.8.", ".abc.0.", 1)
+
+	cases := map[string][2]string{
+		"malformed":          {"abc", "1"},
+		"no nonce":           {valid, ""},
+		"bad signature":      {payload + ".abcdef", solvePoW(payload+".abcdef", 8)},
+		"lowered difficulty": {lowered, solvePoW(lowered, 0)},
+		"expired":            {expired, solvePoW(expired, 8)},
+	}
+
+	for name, c := range cases {
+		ok, err := verifyPoW(c[0], c[1])
+		if ok || err != nil {
+			t.Errorf("%s: expected it to be rejected, got %t, %v", name, ok, err)
+		}
+	}
+
+	// check the wrong nonce separately, it could solve the challenge by chance
+	if nonce := "x"; leadingZeroBits(sha256.Sum256([]byte(valid+":"+nonce))) < 8 {
+		if ok, _ := verifyPoW(valid, nonce); ok {
+			t.Error("accepted a wrong nonce")
+		}
+	}
+}
+
+func TestVerifyPoW(t *testing.T) {
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	challenge, err := newPoWChallenge(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := solvePoW(challenge, 8)
+	if ok, err := verifyPoW(challenge, nonce); !ok || err != nil {
+		t.Fatalf("expected the solved challenge to be accepted, got %t, %v", ok, err)
+	}
+
+	if ok, _ := verifyPoW(challenge, nonce); ok {
+		t.Error("accepted a challenge twice")
+	}
+}
@@ -0,0 +1,266 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const (
+	// max guilds a single bulk operation can change
+	maxBulkOperationGuilds = 25
+
+	bulkOperationPollInterval = time.Second * 2
+
+	// operations are kept around this long after they're created so their results can be viewed
+	bulkOperationRetention = time.Hour * 24 * 7
+
+	// how many of the last operations of a user are listed
+	maxUserBulkOperations = 10
+
+	keyBulkOperationQueue = "web_bulk_operation_queue"
+)
+
+// The states of the guilds in a bulk operation
+const (
+	BulkItemPending = "pending"
+	BulkItemDone    = "done"
+	BulkItemFailed  = "failed"
+)
+
+var panelLogKeyBulkOperation = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+	Key:          "bulk_operation_applied",
+	FormatString: "Applied as part of a change to several servers: %s",
+})
+
+func keyBulkOperation(id string) string {
+	return "web_bulk_operation:" + id
+}
+
+func keyUserBulkOperations(userID int64) string {
+	return "web_user_bulk_operations:" + strconv.FormatInt(userID, 10)
+}
+
+// BulkOperationFunc applies the operation to a single guild
+type BulkOperationFunc func(ctx context.Context, guildID int64, params map[string]string) error
+
+var (
+	bulkOperationKinds   = make(map[string]BulkOperationFunc)
+	bulkOperationKindsMu sync.RWMutex
+)
+
+// RegisterBulkOperationKind registers what's done to each guild of the operations of the kind
+func RegisterBulkOperationKind(kind string, f BulkOperationFunc) {
+	bulkOperationKindsMu.Lock()
+	bulkOperationKinds[kind] = f
+	bulkOperationKindsMu.Unlock()
+}
+
+func getBulkOperationKind(kind string) BulkOperationFunc {
+	bulkOperationKindsMu.RLock()
+	defer bulkOperationKindsMu.RUnlock()
+	return bulkOperationKinds[kind]
+}
+
+// BulkOperation is the same change applied to several guilds in the background, one guild at a time. The access of the
+// user to the guilds is checked when it's created.
+type BulkOperation struct {
+	ID     string            `json:"id"`
+	Kind   string            `json:"kind"`
+	Params map[string]string `json:"params"`
+
+	// Description is shown in the control panel logs of the guilds, e.g "Enabled Reputation"
+	Description string `json:"description"`
+
+	UserID   int64  `json:"user_id,string"`
+	Username string `json:"username"`
+
+	Items []*BulkOperationItem `json:"items"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// BulkOperationItem is the state of a single guild in a bulk operation
+type BulkOperationItem struct {
+	GuildID   int64  `json:"guild_id,string"`
+	GuildName string `json:"guild_name"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Processed returns how many of the guilds have been processed
+func (op *BulkOperation) Processed() int {
+	n := 0
+	for _, v := range op.Items {
+		if v.Status != BulkItemPending {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Failed returns how many of the guilds the operation failed in
+func (op *BulkOperation) Failed() int {
+	n := 0
+	for _, v := range op.Items {
+		if v.Status == BulkItemFailed {
+			n++
+		}
+	}
+
+	return n
+}
+
+func saveBulkOperation(op *BulkOperation) error {
+	serialized, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	return common.RedisPool.Do(radix.FlatCmd(nil, "SET", keyBulkOperation(op.ID), serialized, "EX", int(bulkOperationRetention.Seconds())))
+}
+
+// QueueBulkOperation stores the operation and queues it up to be processed by one of the webservers
+func QueueBulkOperation(op *BulkOperation) error {
+	if getBulkOperationKind(op.Kind) == nil {
+		return NewPublicError("Unknown operation")
+	}
+
+	if len(op.Items) < 1 {
+		return NewPublicError("No servers selected")
+	}
+
+	if len(op.Items) > maxBulkOperationGuilds {
+		return NewPublicError("At most ", maxBulkOperationGuilds, " servers can be changed at once")
+	}
+
+	op.ID = RandBase64(12)
+	op.CreatedAt = time.Now()
+	for _, v := range op.Items {
+		v.Status = BulkItemPending
+	}
+
+	if err := saveBulkOperation(op); err != nil {
+		return err
+	}
+
+	return common.MultipleCmds(
+		radix.Cmd(nil, "LPUSH", keyUserBulkOperations(op.UserID), op.ID),
+		radix.FlatCmd(nil, "LTRIM", keyUserBulkOperations(op.UserID), 0, maxUserBulkOperations-1),
+		radix.FlatCmd(nil, "EXPIRE", keyUserBulkOperations(op.UserID), int(bulkOperationRetention.Seconds())),
+		radix.Cmd(nil, "RPUSH", keyBulkOperationQueue, op.ID),
+	)
+}
+
+// GetBulkOperation returns the operation, or nil if it doesn't exist or expired
+func GetBulkOperation(id string) (*BulkOperation, error) {
+	var op *BulkOperation
+	err := common.GetRedisJson(keyBulkOperation(id), &op)
+	return op, err
+}
+
+// GetUserBulkOperations returns the last operations of the user, newest first
+func GetUserBulkOperations(userID int64) ([]*BulkOperation, error) {
+	var ids []string
+	err := common.RedisPool.Do(radix.Cmd(&ids, "LRANGE", keyUserBulkOperations(userID), "0", "-1"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*BulkOperation, 0, len(ids))
+	for _, id := range ids {
+		op, err := GetBulkOperation(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if op != nil {
+			result = append(result, op)
+		}
+	}
+
+	return result, nil
+}
+
+func runBulkOperationsLoop(ctx context.Context) {
+	ticker := time.NewTicker(bulkOperationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			// popping it claims it, so only one of the webservers processes it
+			var id string
+			err := common.RedisPool.Do(radix.Cmd(&id, "LPOP", keyBulkOperationQueue))
+			if err != nil {
+				if !RedisDegraded() {
+					logger.WithError(err).Error("failed retrieving queued bulk operation")
+				}
+				break
+			}
+
+			if id == "" {
+				break
+			}
+
+			processBulkOperation(id)
+		}
+	}
+}
+
+func processBulkOperation(id string) {
+	op, err := GetBulkOperation(id)
+	if err != nil || op == nil {
+		logger.WithError(err).WithField("bulk_operation", id).Error("failed retrieving bulk operation")
+		return
+	}
+
+	f := getBulkOperationKind(op.Kind)
+	ctx := context.Background()
+
+	for _, item := range op.Items {
+		if item.Status != BulkItemPending {
+			continue
+		}
+
+		if f == nil {
+			item.Status, item.Error = BulkItemFailed, "unknown operation"
+		} else if err := f(ctx, item.GuildID, op.Params); err != nil {
+			item.Status = BulkItemFailed
+			if public, ok := err.(*PublicError); ok {
+				item.Error = public.Error()
+			} else {
+				logger.WithError(err).WithField("guild", item.GuildID).WithField("bulk_operation", id).Error("failed applying bulk operation")
+				item.Error = "internal error"
+			}
+		} else {
+			item.Status = BulkItemDone
+			go cplogs.RetryAddEntry(cplogs.NewEntry(item.GuildID, op.UserID, op.Username, panelLogKeyBulkOperation,
+				&cplogs.Param{Type: cplogs.ParamTypeString, Value: op.Description}))
+		}
+
+		// saved after every guild so the progress can be followed
+		if err := saveBulkOperation(op); err != nil {
+			logger.WithError(err).WithField("bulk_operation", id).Error("failed saving bulk operation progress")
+		}
+	}
+
+	now := time.Now()
+	op.FinishedAt = &now
+	if err := saveBulkOperation(op); err != nil {
+		logger.WithError(err).WithField("bulk_operation", id).Error("failed saving bulk operation")
+	}
+}
@@ -0,0 +1,243 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confCaptchaProvider = config.RegisterOption("yagpdb.web.captcha_provider", "Captcha provider used by routes behind CaptchaMiddleware: recaptcha or hcaptcha", "recaptcha")
+
+	confGoogleReCAPTCHASiteKey = config.RegisterOption("yagpdb.google.recaptcha_site_key", "Google reCAPTCHA site key", "")
+	confGoogleReCAPTCHASecret  = config.RegisterOption("yagpdb.google.recaptcha_secret", "Google reCAPTCHA site secret", "")
+
+	confHCaptchaSiteKey = config.RegisterOption("yagpdb.hcaptcha.site_key", "hCaptcha site key", "")
+	confHCaptchaSecret  = config.RegisterOption("yagpdb.hcaptcha.secret", "hCaptcha secret", "")
+)
+
+var metricsCaptchaVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "yagpdb_web_captcha_verifications_total",
+	Help: "Captcha responses verified",
+}, []string{"provider", "result"})
+
+// CaptchaProvider is a captcha service, new ones can be added with RegisterCaptchaProvider
+type CaptchaProvider interface {
+	Name() string
+
+	// Configured returns false if the keys needed to use the provider are missing
+	Configured() bool
+
+	SiteKey() string
+	ScriptURL() string
+
+	// WidgetClass is the class of the element the provider's script renders the captcha into
+	WidgetClass() string
+
+	// ResponseField is the form field the provider's script puts the response in
+	ResponseField() string
+
+	Verify(ctx context.Context, response, remoteIP string) (*CaptchaResult, error)
+}
+
+// CaptchaResult is the result of verifying the captcha response of a request
+type CaptchaResult struct {
+	Provider   string
+	Success    bool
+	Hostname   string
+	ErrorCodes []string
+
+	// Err is set if the response could not be verified, e.g because the provider is down
+	Err error
+}
+
+var captchaProviders = map[string]CaptchaProvider{}
+
+// RegisterCaptchaProvider makes the provider selectable through yagpdb.web.captcha_provider, should only be done during startup
+func RegisterCaptchaProvider(p CaptchaProvider) {
+	captchaProviders[p.Name()] = p
+}
+
+func init() {
+	RegisterCaptchaProvider(&siteVerifyCaptcha{
+		name:          "recaptcha",
+		siteKey:       confGoogleReCAPTCHASiteKey,
+		secret:        confGoogleReCAPTCHASecret,
+		verifyURL:     "https://www.google.com/recaptcha/api/siteverify",
+		scriptURL:     "https://www.google.com/recaptcha/api.js",
+		widgetClass:   "g-recaptcha",
+		responseField: "g-recaptcha-response",
+	})
+
+	RegisterCaptchaProvider(&siteVerifyCaptcha{
+		name:          "hcaptcha",
+		siteKey:       confHCaptchaSiteKey,
+		secret:        confHCaptchaSecret,
+		verifyURL:     "https://hcaptcha.com/siteverify",
+		scriptURL:     "https://js.hcaptcha.com/1/api.js",
+		widgetClass:   "h-captcha",
+		responseField: "h-captcha-response",
+	})
+}
+
+// ActiveCaptchaProvider returns the configured captcha provider, or nil if it's unknown or missing its keys
+func ActiveCaptchaProvider() CaptchaProvider {
+	p, ok := captchaProviders[strings.ToLower(confCaptchaProvider.GetString())]
+	if !ok || !p.Configured() {
+		return nil
+	}
+
+	return p
+}
+
+// CaptchaConfigured returns true if a captcha provider is set up
+func CaptchaConfigured() bool {
+	return ActiveCaptchaProvider() != nil
+}
+
+// siteVerifyCaptcha is a provider with a reCAPTCHA compatible siteverify endpoint, which hCaptcha also has
+type siteVerifyCaptcha struct {
+	name          string
+	siteKey       *config.ConfigOption
+	secret        *config.ConfigOption
+	verifyURL     string
+	scriptURL     string
+	widgetClass   string
+	responseField string
+}
+
+func (p *siteVerifyCaptcha) Name() string          { return p.name }
+func (p *siteVerifyCaptcha) SiteKey() string       { return p.siteKey.GetString() }
+func (p *siteVerifyCaptcha) ScriptURL() string     { return p.scriptURL }
+func (p *siteVerifyCaptcha) WidgetClass() string   { return p.widgetClass }
+func (p *siteVerifyCaptcha) ResponseField() string { return p.responseField }
+
+func (p *siteVerifyCaptcha) Configured() bool {
+	return p.siteKey.GetString() != "" && p.secret.GetString() != ""
+}
+
+var captchaHTTPClient = &http.Client{Timeout: time.Second * 10}
+
+func (p *siteVerifyCaptcha) Verify(ctx context.Context, response, remoteIP string) (*CaptchaResult, error) {
+	v := url.Values{
+		"response": {response},
+		"secret":   {p.secret.GetString()},
+	}
+
+	if remoteIP != "" {
+		v.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.verifyURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := captchaHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s siteverify responded with %d", p.name, resp.StatusCode)
+	}
+
+	var dst struct {
+		Success    bool     `json:"success"`
+		Hostname   string   `json:"hostname"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&dst)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CaptchaResult{
+		Provider:   p.name,
+		Success:    dst.Success,
+		Hostname:   dst.Hostname,
+		ErrorCodes: dst.ErrorCodes,
+	}, nil
+}
+
+// CaptchaMiddleware adds the captcha widget to the template data (used through the "cp_captcha" template),
+// and verifies the captcha response of POST requests, placing the result in the context.
+// It never rejects requests itself, handlers decide what to do with a failed captcha through ContextCaptchaResult.
+func CaptchaMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		provider := ActiveCaptchaProvider()
+		if provider == nil {
+			ctx = context.WithValue(ctx, common.ContextKeyCaptchaResult, &CaptchaResult{Err: NewPublicError("Captcha is not configured")})
+			inner.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		script := fmt.Sprintf(`<script src="%s" nonce="%s" async defer></script>`, template.HTMLEscapeString(provider.ScriptURL()), ContextCSPNonce(ctx))
+		ctx = SetContextTemplateData(ctx, map[string]interface{}{
+			"ExtraHead": template.HTML(script),
+			"Captcha": map[string]string{
+				"Provider":    provider.Name(),
+				"SiteKey":     provider.SiteKey(),
+				"WidgetClass": provider.WidgetClass(),
+			},
+		})
+
+		if r.Method == http.MethodPost {
+			result := verifyCaptcha(ctx, provider, r)
+			ctx = context.WithValue(ctx, common.ContextKeyCaptchaResult, result)
+		}
+
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func verifyCaptcha(ctx context.Context, provider CaptchaProvider, r *http.Request) *CaptchaResult {
+	response := r.FormValue(provider.ResponseField())
+	if response == "" {
+		metricsCaptchaVerifications.With(prometheus.Labels{"provider": provider.Name(), "result": "missing"}).Inc()
+		return &CaptchaResult{Provider: provider.Name(), ErrorCodes: []string{"missing-input-response"}}
+	}
+
+	result, err := provider.Verify(ctx, response, GetRequestIP(r))
+	if err != nil {
+		CtxLogger(ctx).WithError(err).WithField("provider", provider.Name()).Error("failed verifying captcha response")
+		metricsCaptchaVerifications.With(prometheus.Labels{"provider": provider.Name(), "result": "error"}).Inc()
+		return &CaptchaResult{Provider: provider.Name(), Err: err}
+	}
+
+	if result.Success {
+		metricsCaptchaVerifications.With(prometheus.Labels{"provider": provider.Name(), "result": "success"}).Inc()
+	} else {
+		CtxLogger(ctx).WithField("provider", provider.Name()).Warnf("captcha failed: %v", result.ErrorCodes)
+		metricsCaptchaVerifications.With(prometheus.Labels{"provider": provider.Name(), "result": "failed"}).Inc()
+	}
+
+	return result
+}
+
+// ContextCaptchaResult returns the captcha result of a request behind CaptchaMiddleware,
+// nil if it's not a POST request or the route is not behind it
+func ContextCaptchaResult(ctx context.Context) *CaptchaResult {
+	result, _ := ctx.Value(common.ContextKeyCaptchaResult).(*CaptchaResult)
+	return result
+}
+
+// CaptchaPassed returns true if the request had a valid captcha response
+func CaptchaPassed(ctx context.Context) bool {
+	result := ContextCaptchaResult(ctx)
+	return result != nil && result.Success
+}
@@ -0,0 +1,205 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+type testCaptcha struct {
+	configured bool
+	err        error
+}
+
+func (p *testCaptcha) Name() string          { return "test" }
+func (p *testCaptcha) Configured() bool      { return p.configured }
+func (p *testCaptcha) SiteKey() string       { return "site-key" }
+func (p *testCaptcha) ScriptURL() string     { return "https://captcha.example.com/api.js?a=1&b=2" }
+func (p *testCaptcha) WidgetClass() string   { return "test-captcha" }
+func (p *testCaptcha) ResponseField() string { return "test-captcha-response" }
+
+func (p *testCaptcha) Verify(ctx context.Context, response, remoteIP string) (*CaptchaResult, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return &CaptchaResult{Provider: "test", Success: response == "good"}, nil
+}
+
+// withTestCaptcha makes the provider the active one, returning a func restoring the previous one
+func withTestCaptcha(p *testCaptcha) func() {
+	oldProvider := confCaptchaProvider.LoadedValue
+	RegisterCaptchaProvider(p)
+	confCaptchaProvider.LoadedValue = "TEST"
+
+	return func() {
+		delete(captchaProviders, p.Name())
+		confCaptchaProvider.LoadedValue = oldProvider
+	}
+}
+
+func TestActiveCaptchaProvider(t *testing.T) {
+	defer func(provider, siteKey, secret interface{}) {
+		confCaptchaProvider.LoadedValue = provider
+		confHCaptchaSiteKey.LoadedValue = siteKey
+		confHCaptchaSecret.LoadedValue = secret
+	}(confCaptchaProvider.LoadedValue, confHCaptchaSiteKey.LoadedValue, confHCaptchaSecret.LoadedValue)
+
+	confCaptchaProvider.LoadedValue = "hcaptcha"
+	confHCaptchaSiteKey.LoadedValue = "site"
+	confHCaptchaSecret.LoadedValue = ""
+	if CaptchaConfigured() {
+		t.Error("expected the provider to not be configured without a secret")
+	}
+
+	confHCaptchaSecret.LoadedValue = "secret"
+	if p := ActiveCaptchaProvider(); p == nil || p.Name() != "hcaptcha" || p.ResponseField() != "h-captcha-response" {
+		t.Errorf("expected hcaptcha, got %v", p)
+	}
+
+	confCaptchaProvider.LoadedValue = "unknown"
+	if CaptchaConfigured() {
+		t.Error("expected unknown providers to not be configured")
+	}
+}
+
+func TestSiteVerifyCaptcha(t *testing.T) {
+	var posted url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		posted = r.PostForm
+
+		switch r.PostForm.Get("response") {
+		case "good":
+			fmt.Fprint(w, `{"success":true,"hostname":"example.com"}`)
+		case "down":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, `{"success":false,"error-codes":["invalid-input-response"]}`)
+		}
+	}))
+	defer srv.Close()
+
+	p := &siteVerifyCaptcha{
+		name:    "siteverify",
+		siteKey: &config.ConfigOption{LoadedValue: "site"},
+		secret:  &config.ConfigOption{LoadedValue: "secret"},
+
+		verifyURL: srv.URL,
+	}
+
+	result, err := p.Verify(context.Background(), "good", "203.0.113.1")
+	if err != nil || !result.Success || result.Hostname != "example.com" || result.Provider != "siteverify" {
+		t.Errorf("expected a successful result, got %#v, %v", result, err)
+	}
+
+	if posted.Get("secret") != "secret" || posted.Get("remoteip") != "203.0.113.1" {
+		t.Errorf("unexpected siteverify request %v", posted)
+	}
+
+	result, err = p.Verify(context.Background(), "bad", "")
+	if err != nil || result.Success || len(result.ErrorCodes) != 1 || result.ErrorCodes[0] != "invalid-input-response" {
+		t.Errorf("expected a failed result, got %#v, %v", result, err)
+	}
+
+	if _, ok := posted["remoteip"]; ok {
+		t.Errorf("expected no remoteip without one, got %v", posted)
+	}
+
+	if _, err = p.Verify(context.Background(), "down", ""); err == nil {
+		t.Error("expected a error when siteverify is down")
+	}
+}
+
+func TestCaptchaMiddleware(t *testing.T) {
+	provider := &testCaptcha{configured: true}
+	defer withTestCaptcha(provider)()
+
+	var result *CaptchaResult
+	var tmpl TemplateData
+	handler := CaptchaMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result = ContextCaptchaResult(r.Context())
+		_, tmpl = GetCreateTemplateData(r.Context())
+	}))
+
+	serve := func(method, response string) {
+		r := httptest.NewRequest(method, "/verify", strings.NewReader(url.Values{"test-captcha-response": {response}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = r.WithContext(context.WithValue(r.Context(), common.ContextKeyCSPNonce, "abc"))
+
+		result, tmpl = nil, nil
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	serve("GET", "")
+	if result != nil {
+		t.Errorf("expected no result for a get request, got %#v", result)
+	}
+
+	if head, _ := tmpl["ExtraHead"].(template.HTML); head != `<script src="https://captcha.example.com/api.js?a=1&amp;b=2" nonce="abc" async defer></script>` {
+		t.Errorf("unexpected captcha script %q", head)
+	}
+
+	if captcha, _ := tmpl["Captcha"].(map[string]string); captcha["SiteKey"] != "site-key" || captcha["WidgetClass"] != "test-captcha" {
+		t.Errorf("unexpected captcha template data %v", tmpl["Captcha"])
+	}
+
+	serve("POST", "good")
+	if result == nil || !result.Success {
+		t.Errorf("expected a successful result, got %#v", result)
+	}
+
+	serve("POST", "bad")
+	if result == nil || result.Success {
+		t.Errorf("expected a failed result, got %#v", result)
+	}
+
+	serve("POST", "")
+	if result == nil || result.Success || len(result.ErrorCodes) != 1 || result.ErrorCodes[0] != "missing-input-response" {
+		t.Errorf("expected a missing response, got %#v", result)
+	}
+
+	provider.err = errors.New("provider down")
+	serve("POST", "good")
+	if result == nil || result.Success || result.Err != provider.err {
+		t.Errorf("expected the error of the provider, got %#v", result)
+	}
+
+	// handlers always get a result they can reject, even without a provider
+	provider.configured = false
+	serve("POST", "good")
+	if result == nil || result.Success || result.Err == nil {
+		t.Errorf("expected a error without a configured provider, got %#v", result)
+	}
+}
+
+func TestCaptchaPassed(t *testing.T) {
+	cases := []struct {
+		result   *CaptchaResult
+		expected bool
+	}{
+		{nil, false},
+		{&CaptchaResult{}, false},
+		{&CaptchaResult{Success: true}, true},
+	}
+
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.result != nil {
+			ctx = context.WithValue(ctx, common.ContextKeyCaptchaResult, c.result)
+		}
+
+		if got := CaptchaPassed(ctx); got != c.expected {
+			t.Errorf("%#v: got %t, expected %t", c.result, got, c.expected)
+		}
+	}
+}
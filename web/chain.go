@@ -0,0 +1,266 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"goji.io"
+)
+
+// RouteGroup matches the requests to a group of routes, middlewares of a chain can be skipped for them
+type RouteGroup struct {
+	Name  string
+	Match func(r *http.Request) bool
+}
+
+// StaticRoutes are the static files and the probes, which skip most of the root middlewares
+var StaticRoutes = RequestClassGroup(RequestClassStatic, RequestClassProbe)
+
+// RequestClassGroup returns a route group matching the requests of the classes, see RequestClassOf
+func RequestClassGroup(classes ...RequestClass) *RouteGroup {
+	names := make([]string, len(classes))
+	for i, v := range classes {
+		names[i] = string(v)
+	}
+
+	return &RouteGroup{
+		Name: strings.Join(names, "|"),
+		Match: func(r *http.Request) bool {
+			class := RequestClassOf(r)
+			for _, v := range classes {
+				if class == v {
+					return true
+				}
+			}
+
+			return false
+		},
+	}
+}
+
+// MiddlewareChain is an ordered set of named middlewares. Instead of the order being implied by the order of the
+// mux.Use calls, middlewares declare which ones they have to run after: the chain keeps the order they were added in
+// where that's possible and refuses to build when the dependencies are missing or circular.
+type MiddlewareChain struct {
+	name        string
+	middlewares []*chainMiddleware
+}
+
+type chainMiddleware struct {
+	name     string
+	mw       func(http.Handler) http.Handler
+	after    []string
+	requires []string
+	skip     []*RouteGroup
+	traced   bool
+}
+
+// MiddlewareOption configures a middleware added to a chain
+type MiddlewareOption func(m *chainMiddleware)
+
+// After makes the middleware run after the named ones, if they're in the chain
+func After(names ...string) MiddlewareOption {
+	return func(m *chainMiddleware) {
+		m.after = append(m.after, names...)
+	}
+}
+
+// Requires makes the middleware run after the named ones, the chain fails to build without them
+func Requires(names ...string) MiddlewareOption {
+	return func(m *chainMiddleware) {
+		m.requires = append(m.requires, names...)
+	}
+}
+
+// SkipFor skips the middleware for the requests to the route groups
+func SkipFor(groups ...*RouteGroup) MiddlewareOption {
+	return func(m *chainMiddleware) {
+		m.skip = append(m.skip, groups...)
+	}
+}
+
+// Traced adds a tracing span named after the middleware around it
+func Traced() MiddlewareOption {
+	return func(m *chainMiddleware) {
+		m.traced = true
+	}
+}
+
+// MiddlewareHandler is the handler a named middleware wraps the next handler in. Unlike a http.HandlerFunc it keeps
+// the next handler reachable, so the routes can be walked to see which middlewares they're behind, see
+// routes_policy_test.go.
+type MiddlewareHandler struct {
+	Name string
+
+	// Args describe how the middleware was set up, e.g the permissions checked by RequirePermMW
+	Args []string
+
+	Next http.Handler
+
+	// Skip returns true for the requests the middleware passes on untouched, see SkipFor
+	Skip func(r *http.Request) bool
+
+	serve http.HandlerFunc
+}
+
+// NamedMiddleware returns the handler of the middleware name, serving the requests with serve which passes them on to
+// next
+func NamedMiddleware(name string, next http.Handler, serve http.HandlerFunc, args ...string) *MiddlewareHandler {
+	return &MiddlewareHandler{Name: name, Args: args, Next: next, serve: serve}
+}
+
+func (h *MiddlewareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r)
+}
+
+func NewMiddlewareChain(name string) *MiddlewareChain {
+	return &MiddlewareChain{name: name}
+}
+
+// Add adds the middleware under the name, which has to be unique within the chain
+func (c *MiddlewareChain) Add(name string, mw func(http.Handler) http.Handler, opts ...MiddlewareOption) *MiddlewareChain {
+	for _, v := range c.middlewares {
+		if v.name == name {
+			panic(fmt.Sprintf("middleware %s added twice to the %s chain", name, c.name))
+		}
+	}
+
+	m := &chainMiddleware{name: name, mw: mw}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	c.middlewares = append(c.middlewares, m)
+	return c
+}
+
+// resolve returns the middlewares in the order they run in
+func (c *MiddlewareChain) resolve() ([]*chainMiddleware, error) {
+	index := make(map[string]int)
+	for i, m := range c.middlewares {
+		index[m.name] = i
+	}
+
+	// deps[i] are the middlewares i has to run after
+	deps := make([][]int, len(c.middlewares))
+	for i, m := range c.middlewares {
+		for _, name := range m.requires {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("middleware %s requires %s, which isn't in the %s chain", m.name, name, c.name)
+			}
+			deps[i] = append(deps[i], j)
+		}
+
+		for _, name := range m.after {
+			if j, ok := index[name]; ok {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	// repeatedly place the first middleware, in the order they were added, that has all its dependencies placed
+	placed := make([]bool, len(c.middlewares))
+	result := make([]*chainMiddleware, 0, len(c.middlewares))
+	for len(result) < len(c.middlewares) {
+		next := -1
+	OUTER:
+		for i := range c.middlewares {
+			if placed[i] {
+				continue
+			}
+
+			for _, d := range deps[i] {
+				if !placed[d] {
+					continue OUTER
+				}
+			}
+
+			next = i
+			break
+		}
+
+		if next == -1 {
+			var left []string
+			for i, m := range c.middlewares {
+				if !placed[i] {
+					left = append(left, m.name)
+				}
+			}
+
+			return nil, fmt.Errorf("circular middleware dependencies in the %s chain between %s", c.name, strings.Join(left, ", "))
+		}
+
+		placed[next] = true
+		result = append(result, c.middlewares[next])
+	}
+
+	return result, nil
+}
+
+// Apply adds the middlewares to the mux in order and logs the chain, panicking if it can't be built as that's a
+// mistake in the code
+func (c *MiddlewareChain) Apply(mux *goji.Mux) {
+	resolved, err := c.resolve()
+	if err != nil {
+		panic(err)
+	}
+
+	desc := make([]string, 0, len(resolved))
+	for _, m := range resolved {
+		mux.Use(m.handler())
+		desc = append(desc, m.String())
+	}
+
+	logger.Infof("Middleware chain %s: %s", c.name, strings.Join(desc, " -> "))
+}
+
+func (m *chainMiddleware) handler() func(http.Handler) http.Handler {
+	mw := m.mw
+	if m.traced {
+		mw = traceMW(m.name, mw)
+	}
+
+	return func(inner http.Handler) http.Handler {
+		wrapped := mw(inner)
+		if len(m.skip) == 0 {
+			return NamedMiddleware(m.name, wrapped, wrapped.ServeHTTP)
+		}
+
+		h := NamedMiddleware(m.name, wrapped, func(w http.ResponseWriter, r *http.Request) {
+			if m.skipped(r) {
+				inner.ServeHTTP(w, r)
+				return
+			}
+
+			wrapped.ServeHTTP(w, r)
+		})
+		h.Skip = m.skipped
+		return h
+	}
+}
+
+// skipped returns true if the request is in one of the route groups the middleware is skipped for
+func (m *chainMiddleware) skipped(r *http.Request) bool {
+	for _, group := range m.skip {
+		if group.Match(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *chainMiddleware) String() string {
+	if len(m.skip) == 0 {
+		return m.name
+	}
+
+	groups := make([]string, len(m.skip))
+	for i, v := range m.skip {
+		groups[i] = v.Name
+	}
+
+	return m.name + " (skipped for " + strings.Join(groups, ", ") + ")"
+}
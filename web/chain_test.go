@@ -0,0 +1,110 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"goji.io"
+	"goji.io/pat"
+)
+
+func noopMW(inner http.Handler) http.Handler {
+	return inner
+}
+
+func resolvedNames(t *testing.T, c *MiddlewareChain) []string {
+	resolved, err := c.resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(resolved))
+	for i, v := range resolved {
+		names[i] = v.name
+	}
+
+	return names
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	// without dependencies the order they were added in is kept
+	c := NewMiddlewareChain("test").
+		Add("a", noopMW).
+		Add("b", noopMW).
+		Add("c", noopMW)
+
+	if got, want := resolvedNames(t, c), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	c = NewMiddlewareChain("test").
+		Add("session", noopMW, Requires("redis")).
+		Add("csrf", noopMW, Requires("session"), After("api_key")).
+		Add("redis", noopMW).
+		Add("logger", noopMW)
+
+	if got, want := resolvedNames(t, c), []string{"redis", "session", "csrf", "logger"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMiddlewareChainInvalid(t *testing.T) {
+	c := NewMiddlewareChain("test").Add("session", noopMW, Requires("redis"))
+	if _, err := c.resolve(); err == nil || !strings.Contains(err.Error(), "redis") {
+		t.Errorf("expected an error about the missing redis middleware, got %v", err)
+	}
+
+	c = NewMiddlewareChain("test").
+		Add("a", noopMW, After("b")).
+		Add("b", noopMW, After("a")).
+		Add("c", noopMW)
+	if _, err := c.resolve(); err == nil || !strings.Contains(err.Error(), "a, b") {
+		t.Errorf("expected an error about the cycle between a and b, got %v", err)
+	}
+}
+
+func TestMiddlewareChainSkip(t *testing.T) {
+	var ran []string
+	record := func(name string) func(http.Handler) http.Handler {
+		return func(inner http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ran = append(ran, name)
+				inner.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := goji.NewMux()
+	NewMiddlewareChain("test").
+		Add("always", record("always")).
+		Add("session", record("session"), SkipFor(StaticRoutes)).
+		Apply(mux)
+	mux.HandleFunc(pat.Get("/*"), func(w http.ResponseWriter, r *http.Request) {})
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/static/css/app.css", nil))
+	if want := []string{"always"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("static request ran %v, want %v", ran, want)
+	}
+
+	ran = nil
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/manage", nil))
+	if want := []string{"always", "session"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("page request ran %v, want %v", ran, want)
+	}
+}
+
+func TestRootMiddlewareChain(t *testing.T) {
+	// the request logger would open the access log
+	confDisableRequestLogging.LoadedValue = true
+	defer func() { confDisableRequestLogging.LoadedValue = false }()
+
+	// the order the middlewares were in before they were declared with dependencies
+	want := []string{"in_flight", "classify", "request_id", "client_ip", "tracing", "recovery", "degraded_mode", "timeout",
+		"max_body_bytes", "gzip", "misc", "base_template_data", "session", "user_info", "api_key", "guild_token", "language", "theme", "flash", "maintenance", "csrf", "prom_count", "not_found"}
+	if got := resolvedNames(t, rootMiddlewareChain()); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
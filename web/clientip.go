@@ -0,0 +1,68 @@
+package web
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/geoip"
+)
+
+// ClientIPMiddleware resolves the ip of the client once per request, so the request log, sessions, audit logs
+// and rate limits all agree on it, see ClientIP
+func ClientIPMiddleware(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), common.ContextKeyClientIP, resolveClientIP(r))
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(mw)
+}
+
+// ClientIP returns the ip of the client, the proxy headers (X-Forwarded-For, X-Real-IP and the
+// yagpdb.web.reverse_proxy_client_ip_header one) are only used if the request came from one of the yagpdb.web.trusted_proxies
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(common.ContextKeyClientIP).(string); ok {
+		return ip
+	}
+
+	return resolveClientIP(r)
+}
+
+// ClientLocation returns the country and network of the client, nil if there's no geoip database configured
+func ClientLocation(r *http.Request) *geoip.Location {
+	return geoip.Lookup(ClientIP(r))
+}
+
+func resolveClientIP(r *http.Request) string {
+	proxies := trustedProxies.get(confTrustedProxies.GetString())
+	if len(proxies) < 1 {
+		return legacyRequestIP(r)
+	}
+
+	if ip := trustedClientIP(r, proxies); ip != nil {
+		return ip.String()
+	}
+
+	return remoteHost(r)
+}
+
+// legacyRequestIP takes the client ip header as is when there are no trusted proxies configured,
+// for the setups from before yagpdb.web.trusted_proxies
+func legacyRequestIP(r *http.Request) string {
+	if headerField := confReverseProxyClientIPHeader.GetString(); headerField != "" {
+		return r.Header.Get(headerField)
+	}
+
+	return remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,41 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPMiddleware(t *testing.T) {
+	orig := confTrustedProxies.LoadedValue
+	defer func() {
+		confTrustedProxies.LoadedValue = orig
+	}()
+
+	var resolved string
+	handler := ClientIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resolved = ClientIP(r)
+	}))
+
+	serve := func(remote string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-For", "5.6.7.8")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return resolved
+	}
+
+	confTrustedProxies.LoadedValue = "10.0.0.0/8"
+	if ip := serve("10.0.0.1:1000"); ip != "5.6.7.8" {
+		t.Errorf("expected the forwarded ip behind a trusted proxy, got %s", ip)
+	}
+
+	if ip := serve("[2001:db8::1]:1000"); ip != "2001:db8::1" {
+		t.Errorf("expected the remote ip from a untrusted address, got %s", ip)
+	}
+
+	confTrustedProxies.LoadedValue = ""
+	if ip := serve("10.0.0.1:1000"); ip != "10.0.0.1" {
+		t.Errorf("expected the headers to be ignored without trusted proxies, got %s", ip)
+	}
+}
@@ -0,0 +1,356 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/web/configcode"
+)
+
+// max guilds compared side by side
+const maxComparedGuilds = 10
+
+const bulkOperationPluginToggle = "plugin_toggle"
+
+func init() {
+	RegisterBulkOperationKind(bulkOperationPluginToggle, applyPluginToggle)
+}
+
+func togglePlugins() []PluginWithToggle {
+	var result []PluginWithToggle
+	for _, v := range common.Plugins {
+		if p, ok := v.(PluginWithToggle); ok {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+func findTogglePlugin(sysName string) PluginWithToggle {
+	for _, v := range togglePlugins() {
+		if v.PluginInfo().SysName == sysName {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func applyPluginToggle(ctx context.Context, guildID int64, params map[string]string) error {
+	p := findTogglePlugin(params["plugin"])
+	if p == nil {
+		return NewPublicError("Unknown plugin")
+	}
+
+	return p.SetPluginEnabled(ctx, guildID, params["enabled"] == "true")
+}
+
+// GuildComparison is the plugins, settings and stats of several guilds side by side, the values of each row are in
+// the same order as the guilds
+type GuildComparison struct {
+	Guilds   []*ComparedGuild `json:"guilds"`
+	Plugins  []*ComparisonRow `json:"plugins"`
+	Settings []*ComparisonRow `json:"settings"`
+}
+
+type ComparedGuild struct {
+	ID          int64  `json:"id,string"`
+	Name        string `json:"name"`
+	Icon        string `json:"icon"`
+	MemberCount int64  `json:"member_count"`
+	Channels    int    `json:"channels"`
+	Roles       int    `json:"roles"`
+}
+
+type ComparisonRow struct {
+	// Plugin is the system name for plugin rows, and the config code block for settings
+	Plugin string   `json:"plugin"`
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+
+	// Differs is true if not all the guilds have the same value
+	Differs bool `json:"differs"`
+}
+
+func newComparisonRow(plugin, name string, values []string) *ComparisonRow {
+	row := &ComparisonRow{Plugin: plugin, Name: name, Values: values}
+	for _, v := range values {
+		if v != values[0] {
+			row.Differs = true
+			break
+		}
+	}
+
+	return row
+}
+
+// settingsComparisonRows builds a row for every setting of the exported config code block, guilds missing a setting
+// get an empty value
+func settingsComparisonRows(block string, attrs []map[string]interface{}) []*ComparisonRow {
+	keys := make(map[string]bool)
+	for _, v := range attrs {
+		for k := range v {
+			keys[k] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	rows := make([]*ComparisonRow, 0, len(sorted))
+	for _, k := range sorted {
+		values := make([]string, len(attrs))
+		for i, v := range attrs {
+			if value, ok := v[k]; ok {
+				values[i] = configcode.FormatValue(value)
+			}
+		}
+
+		rows = append(rows, newComparisonRow(block, block+"."+k, values))
+	}
+
+	return rows
+}
+
+func compareGuilds(ctx context.Context, guildIDs []int64) (*GuildComparison, error) {
+	result := &GuildComparison{}
+	for _, id := range guildIDs {
+		gs, err := getGuild(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Guilds = append(result.Guilds, &ComparedGuild{
+			ID:          gs.ID,
+			Name:        gs.Name,
+			Icon:        gs.Icon,
+			MemberCount: gs.MemberCount,
+			Channels:    len(gs.Channels),
+			Roles:       len(gs.Roles),
+		})
+	}
+
+	for _, p := range togglePlugins() {
+		values := make([]string, len(guildIDs))
+		for i, id := range guildIDs {
+			enabled, err := p.PluginEnabled(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = "Disabled"
+			if enabled {
+				values[i] = "Enabled"
+			}
+		}
+
+		info := p.PluginInfo()
+		result.Plugins = append(result.Plugins, newComparisonRow(info.SysName, info.Name, values))
+	}
+
+	for _, p := range configCodePlugins() {
+		attrs := make([]map[string]interface{}, len(guildIDs))
+		for i, id := range guildIDs {
+			form, err := p.ExportConfigCode(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+
+			attrs[i], err = configcode.Encode(form)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		result.Settings = append(result.Settings, settingsComparisonRows(p.ConfigCodeName(), attrs)...)
+	}
+
+	return result, nil
+}
+
+// selectedComparisonGuilds returns the guilds in the "guilds" query parameter, checking the user can change their settings
+func selectedComparisonGuilds(r *http.Request, managed []*common.GuildWithConnected) ([]int64, error) {
+	raw := r.URL.Query()["guilds"]
+	if len(raw) > maxComparedGuilds {
+		return nil, NewPublicError("At most ", maxComparedGuilds, " servers can be compared at once")
+	}
+
+	result := make([]int64, 0, len(raw))
+	for _, v := range raw {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || findManagedGuild(managed, id) == nil {
+			return nil, NewPublicError("Unknown server, or you don't have access to its settings")
+		}
+
+		if !common.ContainsInt64Slice(result, id) {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+func findManagedGuild(managed []*common.GuildWithConnected, guildID int64) *common.GuildWithConnected {
+	for _, v := range managed {
+		if v.ID == guildID && v.Connected {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func comparisonURL(guildIDs []int64) string {
+	q := url.Values{}
+	for _, v := range guildIDs {
+		q.Add("guilds", strconv.FormatInt(v, 10))
+	}
+
+	return "/compare?" + q.Encode()
+}
+
+// HandleGetGuildComparison handles GET /compare
+func HandleGetGuildComparison(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	_, tmpl := GetCreateTemplateData(ctx)
+
+	managed, err := getManagedGuilds(ctx, true)
+	if err != nil {
+		return tmpl, err
+	}
+	tmpl["ComparableGuilds"] = managed
+	tmpl["MaxComparedGuilds"] = maxComparedGuilds
+	tmpl["TogglePlugins"] = togglePlugins()
+
+	ops, err := GetUserBulkOperations(ContextUser(ctx).ID)
+	if err != nil {
+		return tmpl, err
+	}
+	tmpl["BulkOperations"] = ops
+
+	selected, err := selectedComparisonGuilds(r, managed)
+	if err != nil || len(selected) < 1 {
+		return tmpl, err
+	}
+	tmpl["SelectedGuilds"] = selected
+
+	comparison, err := compareGuilds(ctx, selected)
+	if err != nil {
+		return tmpl, err
+	}
+	tmpl["Comparison"] = comparison
+
+	return tmpl, nil
+}
+
+// HandleGetGuildComparisonJSON handles GET /compare.json
+func HandleGetGuildComparisonJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	managed, err := getManagedGuilds(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	selected, err := selectedComparisonGuilds(r, managed)
+	if err != nil {
+		return err
+	}
+
+	if len(selected) < 1 {
+		return NewPublicError("No servers selected")
+	}
+
+	comparison, err := compareGuilds(ctx, selected)
+	if err != nil {
+		return err
+	}
+
+	return comparison
+}
+
+// HandleGetBulkOperationsJSON handles GET /compare/operations.json, the last bulk operations of the user and their progress
+func HandleGetBulkOperationsJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ops, err := GetUserBulkOperations(ContextUser(r.Context()).ID)
+	if err != nil {
+		return err
+	}
+
+	return ops
+}
+
+// BulkPluginToggleForm enables or disables a plugin in several guilds
+type BulkPluginToggleForm struct {
+	Guilds  []int64
+	Plugin  string `valid:",1,100"`
+	Enabled bool
+}
+
+// HandleBulkPluginToggle handles POST /compare/bulk, queueing a bulk operation changing the plugin in the guilds
+func HandleBulkPluginToggle(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	_, tmpl := GetCreateTemplateData(ctx)
+	user := ContextUser(ctx)
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*BulkPluginToggleForm)
+	tmpl.SetVisibleURL(comparisonURL(form.Guilds))
+
+	p := findTogglePlugin(form.Plugin)
+	if p == nil {
+		return tmpl, NewPublicError("Unknown plugin")
+	}
+
+	managed, err := getManagedGuilds(ctx, true)
+	if err != nil {
+		return tmpl, err
+	}
+
+	op := &BulkOperation{
+		Kind:     bulkOperationPluginToggle,
+		Params:   map[string]string{"plugin": form.Plugin, "enabled": strconv.FormatBool(form.Enabled)},
+		UserID:   user.ID,
+		Username: user.Username,
+	}
+
+	if form.Enabled {
+		op.Description = "Enabled " + p.PluginInfo().Name
+	} else {
+		op.Description = "Disabled " + p.PluginInfo().Name
+	}
+
+	for _, id := range form.Guilds {
+		gwc := findManagedGuild(managed, id)
+		if gwc == nil {
+			return tmpl, NewPublicError("Unknown server, or you don't have access to its settings")
+		}
+
+		if !gwc.Owner {
+			// changes to these have to go through the approval queue of the server instead
+			settings, err := GetApprovalSettings(id)
+			if err != nil {
+				return tmpl, err
+			}
+
+			if settings.Enabled {
+				return tmpl, NewPublicError(gwc.Name, " requires changes to be approved by another admin, change it from its control panel instead")
+			}
+		}
+
+		op.Items = append(op.Items, &BulkOperationItem{GuildID: id, GuildName: gwc.Name})
+	}
+
+	err = QueueBulkOperation(op)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl.AddAlerts(SucessAlert(op.Description, " in ", len(op.Items), " servers, the changes are applied in the background"))
+	return tmpl, nil
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSettingsComparisonRows(t *testing.T) {
+	attrs := []map[string]interface{}{
+		{"enabled": true, "prefix": "-"},
+		{"enabled": true, "prefix": "!"},
+		{"enabled": true},
+	}
+
+	rows := settingsComparisonRows("core", attrs)
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+
+	if rows[0].Name != "core.enabled" || rows[0].Differs {
+		t.Errorf("unexpected first row: %+v", rows[0])
+	}
+
+	if rows[1].Name != "core.prefix" || !rows[1].Differs {
+		t.Errorf("unexpected second row: %+v", rows[1])
+	}
+
+	if want := []string{`"-"`, `"!"`, ""}; !reflect.DeepEqual(rows[1].Values, want) {
+		t.Errorf("got values %q, want %q", rows[1].Values, want)
+	}
+}
+
+func TestBulkOperationProgress(t *testing.T) {
+	op := &BulkOperation{Items: []*BulkOperationItem{
+		{GuildID: 1, Status: BulkItemDone},
+		{GuildID: 2, Status: BulkItemFailed},
+		{GuildID: 3, Status: BulkItemPending},
+	}}
+
+	if op.Processed() != 2 || op.Failed() != 1 {
+		t.Errorf("got %d processed and %d failed, want 2 and 1", op.Processed(), op.Failed())
+	}
+}
@@ -0,0 +1,291 @@
+// Package configcode implements a small declarative text format for exporting and applying guild settings,
+// loosely modeled after HCL:
+//
+//	plugin "core" {
+//	  allowed_write_roles = [123, 456]
+//	  allow_all_members_read_only = false
+//	}
+//
+// Values are either strings, integers, booleans or lists of strings or integers.
+package configcode
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Block is a set of settings belonging to one plugin
+type Block struct {
+	Name       string
+	Attributes map[string]interface{}
+}
+
+// Document is a parsed config file
+type Document struct {
+	Blocks []*Block
+}
+
+// Block returns the block with the name, or nil if there's none
+func (d *Document) Block(name string) *Block {
+	for _, v := range d.Blocks {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// Format serializes the document, attributes are sorted so the output is stable and diffs nicely in version control
+func Format(doc *Document) string {
+	var b strings.Builder
+	for i, block := range doc.Blocks {
+		if i != 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "plugin %s {\n", strconv.Quote(block.Name))
+
+		keys := make([]string, 0, len(block.Attributes))
+		for k := range block.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(&b, "  %s = %s\n", k, FormatValue(block.Attributes[k]))
+		}
+
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+// FormatValue formats a single value the way it would appear in a document
+func FormatValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strconv.Quote(t)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case bool:
+		return strconv.FormatBool(t)
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for _, e := range t {
+			parts = append(parts, FormatValue(e))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// Change is a single setting that differs between two documents
+type Change struct {
+	Block string
+	Key   string
+	Old   interface{}
+	New   interface{}
+}
+
+func (c *Change) String() string {
+	return fmt.Sprintf("%s.%s: %s -> %s", c.Block, c.Key, FormatValue(c.Old), FormatValue(c.New))
+}
+
+// DiffBlock returns the settings changed in updated compared to current, settings not present in updated are left out
+func DiffBlock(name string, current, updated map[string]interface{}) []*Change {
+	keys := make([]string, 0, len(updated))
+	for k := range updated {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var changes []*Change
+	for _, k := range keys {
+		old := current[k]
+		if reflect.DeepEqual(old, updated[k]) {
+			continue
+		}
+
+		changes = append(changes, &Change{
+			Block: name,
+			Key:   k,
+			Old:   old,
+			New:   updated[k],
+		})
+	}
+
+	return changes
+}
+
+// AttributeName converts a go field name to the name used in documents, e.g "AllowedWriteRoles" to "allowed_write_roles"
+func AttributeName(field string) string {
+	runes := []rune(field)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// Encode converts the exported fields of a struct into attributes
+func Encode(src interface{}) (map[string]interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configcode: can't encode %s", v.Kind())
+	}
+
+	t := v.Type()
+	attrs := make(map[string]interface{})
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("configcode") == "-" {
+			continue
+		}
+
+		value, err := encodeValue(v.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("configcode: field %s: %w", field.Name, err)
+		}
+
+		attrs[AttributeName(field.Name)] = value
+	}
+
+	return attrs, nil
+}
+
+func encodeValue(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		result := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+
+			if _, isList := e.([]interface{}); isList {
+				return nil, fmt.Errorf("nested lists are not supported")
+			}
+
+			result = append(result, e)
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// Decode sets the fields of dst (a pointer to a struct) from the attributes, returning an error for unknown settings
+// or values of the wrong type. Fields without a matching attribute are left untouched.
+func Decode(attrs map[string]interface{}, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("configcode: can't decode into %T", dst)
+	}
+
+	v = v.Elem()
+	t := v.Type()
+
+	fields := make(map[string]int)
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("configcode") == "-" {
+			continue
+		}
+
+		fields[AttributeName(field.Name)] = i
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		i, ok := fields[k]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", k)
+		}
+
+		err := decodeValue(attrs[k], v.Field(i))
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+
+	return nil
+}
+
+func decodeValue(value interface{}, dst reflect.Value) error {
+	switch dst.Kind() {
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %s", FormatValue(value))
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := value.(int64)
+		if s, isString := value.(string); isString {
+			// ids in json are strings, see ToJSON
+			parsed, err := strconv.ParseInt(s, 10, 64)
+			i, ok = parsed, err == nil
+		}
+		if !ok {
+			return fmt.Errorf("expected a number, got %s", FormatValue(value))
+		}
+		if dst.OverflowInt(i) {
+			return fmt.Errorf("%d is out of range", i)
+		}
+		dst.SetInt(i)
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", FormatValue(value))
+		}
+		dst.SetString(s)
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list, got %s", FormatValue(value))
+		}
+
+		slice := reflect.MakeSlice(dst.Type(), len(list), len(list))
+		for i, e := range list {
+			if err := decodeValue(e, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", dst.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package configcode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testForm struct {
+	AllowedWriteRoles []int64
+	AccessMode        int16
+	Enabled           bool
+	Prefix            string
+	Channels          []string
+	unexported        int
+	Skipped           string `configcode:"-"`
+}
+
+func TestAttributeName(t *testing.T) {
+	cases := map[string]string{
+		"AllowedWriteRoles": "allowed_write_roles",
+		"AccessMode":        "access_mode",
+		"GuildID":           "guild_id",
+		"URLPrefix":         "url_prefix",
+		"X":                 "x",
+	}
+
+	for field, expected := range cases {
+		if got := AttributeName(field); got != expected {
+			t.Errorf("%s: got %s, expected %s", field, got, expected)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	form := &testForm{
+		AllowedWriteRoles: []int64{1, 2},
+		AccessMode:        1,
+		Enabled:           true,
+		Prefix:            "-\"quoted\"",
+		Channels:          []string{},
+		Skipped:           "secret",
+	}
+
+	attrs, err := Encode(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := attrs["skipped"]; ok {
+		t.Error("skipped field was encoded")
+	}
+
+	formatted := Format(&Document{Blocks: []*Block{{Name: "test", Attributes: attrs}}})
+	parsed, err := Parse(formatted)
+	if err != nil {
+		t.Fatalf("failed parsing formatted document: %v\n%s", err, formatted)
+	}
+
+	decoded := &testForm{}
+	err = Decode(parsed.Block("test").Attributes, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form.Skipped = ""
+	if !reflect.DeepEqual(form, decoded) {
+		t.Errorf("round trip mismatch: %#v != %#v", form, decoded)
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+# comment
+plugin "core" {
+  allowed_write_roles = [
+    123, // trailing comment
+    456,
+  ]
+  enabled = false
+}
+
+plugin "logs" {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(doc.Blocks))
+	}
+
+	expected := map[string]interface{}{
+		"allowed_write_roles": []interface{}{int64(123), int64(456)},
+		"enabled":             false,
+	}
+	if !reflect.DeepEqual(doc.Block("core").Attributes, expected) {
+		t.Errorf("unexpected attributes: %#v", doc.Block("core").Attributes)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		`plugin "a" { x = 1`:                     "line 1",
+		`plugin "a" {}` + "\n" + `plugin "a" {}`: "more than once",
+		`plugin "a" { x = 1 x = 2 }`:             "more than once",
+		`plugin "a" { x = [1, "a"] }`:            "same type",
+		`plugin "a" { x = "unterminated }`:       "unterminated",
+		`settings "a" {}`:                        "expected \"plugin\"",
+		`plugin "a" { x = nope }`:                "expected a value",
+	}
+
+	for src, expected := range cases {
+		_, err := Parse(src)
+		if err == nil {
+			t.Errorf("%q: expected an error", src)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: error %q does not contain %q", src, err, expected)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	err := Decode(map[string]interface{}{"nope": true}, &testForm{})
+	if err == nil || !strings.Contains(err.Error(), "unknown setting") {
+		t.Errorf("expected unknown setting error, got %v", err)
+	}
+
+	err = Decode(map[string]interface{}{"enabled": int64(1)}, &testForm{})
+	if err == nil || !strings.Contains(err.Error(), "expected a boolean") {
+		t.Errorf("expected type error, got %v", err)
+	}
+
+	err = Decode(map[string]interface{}{"access_mode": int64(1 << 20)}, &testForm{})
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("expected range error, got %v", err)
+	}
+}
+
+func TestDiffBlock(t *testing.T) {
+	current := map[string]interface{}{
+		"enabled": false,
+		"prefix":  "-",
+		"roles":   []interface{}{int64(1)},
+	}
+
+	updated := map[string]interface{}{
+		"enabled": true,
+		"prefix":  "-",
+		"roles":   []interface{}{int64(1), int64(2)},
+	}
+
+	changes := DiffBlock("core", current, updated)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+
+	if s := changes[0].String(); s != "core.enabled: false -> true" {
+		t.Errorf("unexpected change: %s", s)
+	}
+
+	if s := changes[1].String(); s != "core.roles: [1] -> [1, 2]" {
+		t.Errorf("unexpected change: %s", s)
+	}
+}
@@ -0,0 +1,87 @@
+package configcode
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// the largest integer javascript numbers hold exactly
+const maxJSONSafeInteger = 1<<53 - 1
+
+// ToJSON converts the attributes to values for json, integers javascript can't represent exactly, like ids, become
+// strings. Decode accepts them back as strings.
+func ToJSON(attrs map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		result[k] = toJSONValue(v)
+	}
+
+	return result
+}
+
+func toJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case int64:
+		if t > maxJSONSafeInteger || t < -maxJSONSafeInteger {
+			return fmt.Sprint(t)
+		}
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, e := range t {
+			result[i] = toJSONValue(e)
+		}
+		return result
+	}
+
+	return v
+}
+
+// FromJSON converts attributes decoded from json with json.Decoder.UseNumber to the values Decode takes, numbers have
+// to be integers. Attributes decoded from yaml are converted too, yaml has ints and floats instead of json.Number.
+func FromJSON(raw map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		converted, err := fromJSONValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+
+		result[k] = converted
+	}
+
+	return result, nil
+}
+
+func fromJSONValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case json.Number:
+		i, err := t.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("expected a integer, got %s", t)
+		}
+		return i, nil
+	case int:
+		return int64(t), nil
+	case float64:
+		return nil, fmt.Errorf("expected a integer, got %v", t)
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, e := range t {
+			converted, err := fromJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, isList := converted.([]interface{}); isList {
+				return nil, fmt.Errorf("nested lists are not supported")
+			}
+
+			result[i] = converted
+		}
+		return result, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("objects are not supported")
+	}
+
+	return v, nil
+}
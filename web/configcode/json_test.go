@@ -0,0 +1,89 @@
+package configcode
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	form := &testForm{
+		AllowedWriteRoles: []int64{598900258579283976, 5},
+		AccessMode:        1,
+		Enabled:           true,
+		Channels:          []string{"general"},
+	}
+
+	attrs, err := Encode(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := json.Marshal(ToJSON(attrs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(encoded), `"allowed_write_roles":["598900258579283976",5]`) {
+		t.Errorf("expected ids to be strings, got %s", encoded)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.UseNumber()
+
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := FromJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &testForm{}
+	if err := Decode(converted, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(form, decoded) {
+		t.Errorf("got %+v, expected %+v", decoded, form)
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	cases := map[string]interface{}{
+		"expected a integer": json.Number("1.5"),
+		"nested lists":       []interface{}{[]interface{}{json.Number("1")}},
+		"objects are not":    map[string]interface{}{},
+		"got 2.5":            2.5,
+	}
+
+	for expected, v := range cases {
+		_, err := FromJSON(map[string]interface{}{"x": v})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected a error containing %q, got %v", expected, err)
+		}
+	}
+
+	if err := Decode(map[string]interface{}{"access_mode": "abc"}, &testForm{}); err == nil || !strings.Contains(err.Error(), "expected a number") {
+		t.Errorf("expected a type error for a string that isn't a number, got %v", err)
+	}
+}
+
+func TestFromYAMLValues(t *testing.T) {
+	converted, err := FromJSON(map[string]interface{}{"access_mode": 1, "allowed_write_roles": []interface{}{"598900258579283976", 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &testForm{}
+	if err := Decode(converted, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.AccessMode != 1 || !reflect.DeepEqual(decoded.AllowedWriteRoles, []int64{598900258579283976, 5}) {
+		t.Errorf("unexpected form %+v", decoded)
+	}
+}
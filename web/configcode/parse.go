@@ -0,0 +1,266 @@
+package configcode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+}
+
+// SyntaxError is returned when a document could not be parsed
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || (r == '/' && i+1 < len(runes) && runes[i+1] == '/'):
+			// comment, skip to the end of the line
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '"':
+			start := i
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				} else if runes[i] == '\n' {
+					break
+				}
+			}
+
+			if i >= len(runes) || runes[i] != '"' {
+				return nil, &SyntaxError{Line: line, Msg: "unterminated string"}
+			}
+			i++
+
+			s, err := strconv.Unquote(string(runes[start:i]))
+			if err != nil {
+				return nil, &SyntaxError{Line: line, Msg: "invalid string " + string(runes[start:i])}
+			}
+			tokens = append(tokens, token{kind: tokenString, value: s, line: line})
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: string(runes[start:i]), line: line})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: string(runes[start:i]), line: line})
+		case strings.ContainsRune("{}[]=,", r):
+			tokens = append(tokens, token{kind: tokenPunct, value: string(r), line: line})
+			i++
+		default:
+			return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, line: line})
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expectPunct(punct string) error {
+	t := p.next()
+	if t.kind != tokenPunct || t.value != punct {
+		return &SyntaxError{Line: t.line, Msg: fmt.Sprintf("expected %q, got %s", punct, describeToken(t))}
+	}
+
+	return nil
+}
+
+func describeToken(t token) string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return strconv.Quote(t.value)
+	}
+
+	return "\"" + t.value + "\""
+}
+
+// Parse parses a document, blocks and attributes may only be declared once
+func Parse(src string) (*Document, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	doc := &Document{}
+
+	for p.peek().kind != tokenEOF {
+		t := p.next()
+		if t.kind != tokenIdent || t.value != "plugin" {
+			return nil, &SyntaxError{Line: t.line, Msg: "expected \"plugin\", got " + describeToken(t)}
+		}
+
+		name := p.next()
+		if name.kind != tokenString {
+			return nil, &SyntaxError{Line: name.line, Msg: "expected the plugin name as a string, got " + describeToken(name)}
+		}
+
+		if doc.Block(name.value) != nil {
+			return nil, &SyntaxError{Line: name.line, Msg: fmt.Sprintf("plugin %q declared more than once", name.value)}
+		}
+
+		block, err := p.parseBlock(name.value)
+		if err != nil {
+			return nil, err
+		}
+
+		doc.Blocks = append(doc.Blocks, block)
+	}
+
+	return doc, nil
+}
+
+func (p *parser) parseBlock(name string) (*Block, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+
+	block := &Block{Name: name, Attributes: make(map[string]interface{})}
+	for {
+		t := p.next()
+		if t.kind == tokenPunct && t.value == "}" {
+			return block, nil
+		}
+
+		if t.kind != tokenIdent {
+			return nil, &SyntaxError{Line: t.line, Msg: "expected a setting name or \"}\", got " + describeToken(t)}
+		}
+
+		if _, ok := block.Attributes[t.value]; ok {
+			return nil, &SyntaxError{Line: t.line, Msg: fmt.Sprintf("setting %q declared more than once", t.value)}
+		}
+
+		if err := p.expectPunct("="); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		block.Attributes[t.value] = value
+	}
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return t.value, nil
+	case tokenNumber:
+		i, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, &SyntaxError{Line: t.line, Msg: "invalid number " + t.value}
+		}
+		return i, nil
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	case tokenPunct:
+		if t.value == "[" {
+			return p.parseList()
+		}
+	}
+
+	return nil, &SyntaxError{Line: t.line, Msg: "expected a value, got " + describeToken(t)}
+}
+
+func (p *parser) parseList() (interface{}, error) {
+	list := make([]interface{}, 0)
+	for {
+		if t := p.peek(); t.kind == tokenPunct && t.value == "]" {
+			p.next()
+			return list, nil
+		}
+
+		start := p.peek()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, nested := value.([]interface{}); nested {
+			return nil, &SyntaxError{Line: start.line, Msg: "nested lists are not supported"}
+		}
+
+		if len(list) > 0 && fmt.Sprintf("%T", list[0]) != fmt.Sprintf("%T", value) {
+			return nil, &SyntaxError{Line: start.line, Msg: "all the values in a list must be of the same type"}
+		}
+
+		list = append(list, value)
+
+		t := p.next()
+		if t.kind == tokenPunct && t.value == "]" {
+			return list, nil
+		}
+
+		if t.kind != tokenPunct || t.value != "," {
+			return nil, &SyntaxError{Line: t.line, Msg: "expected \",\" or \"]\", got " + describeToken(t)}
+		}
+	}
+}
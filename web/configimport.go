@@ -0,0 +1,247 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/botlabs-gg/yagpdb/v2/web/configcode"
+	"gopkg.in/yaml.v3"
+)
+
+// configDocumentVersion is the version of the format of ConfigDocument, bumped if it changes in a incompatible way
+const configDocumentVersion = 1
+
+// ConfigDocument is a export of the settings of all plugins of a guild, as json or yaml. The settings of the plugins
+// are the same as in the settings api, ids are strings.
+type ConfigDocument struct {
+	Version    int                               `json:"version" yaml:"version"`
+	GuildID    int64                             `json:"guild_id,string" yaml:"guild_id"`
+	GuildName  string                            `json:"guild_name" yaml:"guild_name"`
+	ExportedAt time.Time                         `json:"exported_at" yaml:"exported_at"`
+	Plugins    map[string]map[string]interface{} `json:"plugins" yaml:"plugins"`
+}
+
+func exportConfigDocument(ctx context.Context, g *dstate.GuildSet) (*ConfigDocument, error) {
+	doc := &ConfigDocument{
+		Version:    configDocumentVersion,
+		GuildID:    g.ID,
+		GuildName:  g.Name,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Plugins:    make(map[string]map[string]interface{}),
+	}
+
+	for _, p := range configCodePlugins() {
+		form, err := p.ExportConfigCode(ctx, g.ID)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", p.ConfigCodeName(), err)
+		}
+
+		attrs, err := configcode.Encode(form)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", p.ConfigCodeName(), err)
+		}
+
+		doc.Plugins[p.ConfigCodeName()] = configcode.ToJSON(attrs)
+	}
+
+	return doc, nil
+}
+
+// encodeConfigDocument encodes the document in the format, json or yaml, returning the encoded document and its file
+// extension
+func encodeConfigDocument(doc *ConfigDocument, format string) ([]byte, string, error) {
+	switch format {
+	case "", "json":
+		encoded, err := json.MarshalIndent(doc, "", "  ")
+		return encoded, "json", err
+	case "yaml":
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, "", err
+		}
+
+		err := encoder.Close()
+		return buf.Bytes(), "yaml", err
+	}
+
+	return nil, "", NewPublicError("Unknown format, it has to be json or yaml")
+}
+
+// parseConfigDocument parses a document exported by config_export, json documents are told apart from yaml by being a
+// object
+func parseConfigDocument(src string) (*ConfigDocument, error) {
+	src = strings.TrimSpace(src)
+	doc := &ConfigDocument{}
+
+	if strings.HasPrefix(src, "{") {
+		decoder := json.NewDecoder(strings.NewReader(src))
+		decoder.UseNumber()
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(doc); err != nil {
+			return nil, fmt.Errorf("invalid json: %s", err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(strings.NewReader(src))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(doc); err != nil {
+			return nil, fmt.Errorf("invalid yaml: %s", err)
+		}
+	}
+
+	if doc.Version != configDocumentVersion {
+		return nil, fmt.Errorf("unsupported version %d, the document has to be exported with version %d", doc.Version, configDocumentVersion)
+	}
+
+	if len(doc.Plugins) < 1 {
+		return nil, fmt.Errorf("the document has no plugins")
+	}
+
+	return doc, nil
+}
+
+// prepareConfigDocument parses and validates the document against the current settings like prepareConfigCode does for
+// config code, the document can be from another guild as long as its channels and roles are changed to ones of this one
+func prepareConfigDocument(ctx context.Context, g *dstate.GuildSet, src string) ([]*pendingConfigCode, *ConfigCodeApplyResult, error) {
+	doc, err := parseConfigDocument(src)
+	if err != nil {
+		return nil, &ConfigCodeApplyResult{Changes: []string{}, Errors: []string{err.Error()}}, nil
+	}
+
+	body := make(map[string]interface{}, len(doc.Plugins))
+	for k, v := range doc.Plugins {
+		body[k] = v
+	}
+
+	blocks, err := apiConfigBlocks("", body)
+	if err != nil {
+		return nil, &ConfigCodeApplyResult{Changes: []string{}, Errors: []string{err.Error()}}, nil
+	}
+
+	return prepareConfigBlocks(ctx, g, blocks)
+}
+
+// HandleExportConfigDocument handles GET /manage/:server/config_export, exporting the settings of all plugins as a
+// json document, or yaml with format=yaml
+func HandleExportConfigDocument(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	g := ContextGuild(ctx)
+
+	doc, err := exportConfigDocument(ctx, g)
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("failed exporting settings")
+		http.Error(w, "Failed exporting settings", http.StatusInternalServerError)
+		return
+	}
+
+	encoded, ext, err := encodeConfigDocument(doc, r.FormValue("format"))
+	if err != nil {
+		if public, ok := err.(*PublicError); ok {
+			http.Error(w, public.Error(), http.StatusBadRequest)
+			return
+		}
+
+		CtxLogger(ctx).WithError(err).Error("failed encoding settings")
+		http.Error(w, "Failed exporting settings", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "application/json"
+	if ext == "yaml" {
+		contentType = "application/yaml"
+	}
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"yagpdb-%d.%s\"", g.ID, ext))
+	w.Write(encoded)
+}
+
+// HandleImportConfigDocument handles POST /manage/:server/config_import, the body is a json or yaml document from
+// config_export or a form with it in the "config" field. Like with config_code/apply only the plugins and settings
+// present are changed, everything at once, and with dry_run=1 the changes are only computed and validated.
+func HandleImportConfigDocument(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	g := ContextGuild(ctx)
+
+	src, err := readConfigCodeBody(r)
+	if err != nil {
+		return err
+	}
+
+	pending, result, err := prepareConfigDocument(ctx, g, src)
+	if err != nil {
+		return err
+	}
+
+	err = commitConfigCode(ctx, g.ID, pending, result, r.FormValue("dry_run") == "1")
+	if err != nil {
+		return err
+	}
+
+	return result
+}
+
+type ImportConfigForm struct {
+	Config string `valid:",1,100000"`
+}
+
+// HandlePreviewConfigImport handles POST /manage/:server/core/config_import/preview, showing what importing the
+// document would change
+func HandlePreviewConfigImport(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/core")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*ImportConfigForm)
+
+	_, result, err := prepareConfigDocument(ctx, g, form.Config)
+	if err != nil {
+		return tmpl, err
+	}
+
+	result.OK = len(result.Errors) < 1
+	tmpl["ConfigImport"] = form.Config
+	tmpl["ConfigImportPreview"] = result
+	return tmpl, nil
+}
+
+// HandlePostConfigImport handles POST /manage/:server/core/config_import
+func HandlePostConfigImport(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/core")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*ImportConfigForm)
+
+	pending, result, err := prepareConfigDocument(ctx, g, form.Config)
+	if err != nil {
+		return tmpl, err
+	}
+
+	err = commitConfigCode(ctx, g.ID, pending, result, false)
+	if err != nil {
+		return tmpl, err
+	}
+
+	if !result.OK {
+		// shown like a preview so the document can be fixed
+		tmpl["ConfigImport"] = form.Config
+		tmpl["ConfigImportPreview"] = result
+		for _, v := range result.Errors {
+			tmpl.AddAlerts(ErrorAlert(v))
+		}
+	} else if !result.Applied {
+		tmpl.AddAlerts(WarningAlert("Nothing was changed, the settings already match the document"))
+	}
+
+	return tmpl, nil
+}
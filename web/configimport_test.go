@@ -0,0 +1,73 @@
+package web
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigDocumentRoundTrip(t *testing.T) {
+	doc := &ConfigDocument{
+		Version:    configDocumentVersion,
+		GuildID:    598900258579283976,
+		GuildName:  "test",
+		ExportedAt: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		Plugins: map[string]map[string]interface{}{
+			"automod": {"enabled": true, "allowed_roles": []interface{}{"598900258579283977"}},
+		},
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		encoded, ext, err := encodeConfigDocument(doc, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if ext != format {
+			t.Errorf("%s: unexpected extension %q", format, ext)
+		}
+
+		if !strings.Contains(string(encoded), "598900258579283976") {
+			t.Errorf("%s: expected the guild id in the document, got %s", format, encoded)
+		}
+
+		parsed, err := parseConfigDocument(string(encoded))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if parsed.GuildID != doc.GuildID || parsed.GuildName != doc.GuildName || !parsed.ExportedAt.Equal(doc.ExportedAt) {
+			t.Errorf("%s: got %+v, expected %+v", format, parsed, doc)
+		}
+
+		plugin := parsed.Plugins["automod"]
+		if plugin["enabled"] != true || !reflect.DeepEqual(plugin["allowed_roles"], []interface{}{"598900258579283977"}) {
+			t.Errorf("%s: unexpected plugin settings %v", format, plugin)
+		}
+	}
+
+	if _, _, err := encodeConfigDocument(doc, "xml"); err == nil {
+		t.Error("expected a error for a unknown format")
+	} else if _, ok := err.(*PublicError); !ok {
+		t.Errorf("expected a public error, got %v", err)
+	}
+}
+
+func TestParseConfigDocumentErrors(t *testing.T) {
+	cases := map[string]string{
+		`{"version": 2, "plugins": {"automod": {}}}`:         "unsupported version 2",
+		`{"version": 1, "plugins": {}}`:                      "has no plugins",
+		`{"version": 1, "plugin": {"automod": {}}}`:          "invalid json",
+		"version: 1\nplugins:\n  automod: {}\nextra: true\n": "invalid yaml",
+		"version: 1\n":       "has no plugins",
+		"- not a document\n": "invalid yaml",
+	}
+
+	for src, expected := range cases {
+		_, err := parseConfigDocument(src)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected a error containing %q, got %v", src, expected, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+var (
+	confCookieSecure   = config.RegisterOption("yagpdb.web.cookie_secure", "Set the Secure attribute on the session cookie: auto (when serving over https, including through a reverse proxy with -exthttps), true or false", "auto")
+	confCookieHTTPOnly = config.RegisterOption("yagpdb.web.cookie_http_only", "Set the HttpOnly attribute on the session cookie", true)
+	confCookieSameSite = config.RegisterOption("yagpdb.web.cookie_same_site", "SameSite attribute of the session cookie: lax, strict, none or default (leave it out). strict breaks logging in through discord", "lax")
+	confCookieDomain   = config.RegisterOption("yagpdb.web.cookie_domain", "Domain of the session cookie, set this to share the session with subdomains (e.g \".example.com\"), empty for the current host only", "")
+)
+
+func cookieSecure() bool {
+	switch strings.ToLower(confCookieSecure.GetString()) {
+	case "true", "1", "yes":
+		return true
+	case "false", "0", "no":
+		return false
+	}
+
+	return https || exthttps
+}
+
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(confCookieSameSite.GetString()) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "default", "":
+		return http.SameSiteDefaultMode
+	}
+
+	return http.SameSiteLaxMode
+}
+
+// applyCookieAttributes sets the configured Secure, HttpOnly, SameSite and Domain attributes on the cookie
+func applyCookieAttributes(cookie *http.Cookie) *http.Cookie {
+	cookie.Secure = cookieSecure()
+	cookie.HttpOnly = confCookieHTTPOnly.GetBool()
+	cookie.SameSite = cookieSameSite()
+	cookie.Domain = confCookieDomain.GetString()
+
+	if cookie.SameSite == http.SameSiteNoneMode {
+		// browsers reject SameSite=None cookies without Secure
+		cookie.Secure = true
+	}
+
+	return cookie
+}
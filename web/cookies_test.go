@@ -0,0 +1,53 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestApplyCookieAttributes(t *testing.T) {
+	defer func(secure, httpOnly, sameSite, domain interface{}) {
+		confCookieSecure.LoadedValue = secure
+		confCookieHTTPOnly.LoadedValue = httpOnly
+		confCookieSameSite.LoadedValue = sameSite
+		confCookieDomain.LoadedValue = domain
+	}(confCookieSecure.LoadedValue, confCookieHTTPOnly.LoadedValue, confCookieSameSite.LoadedValue, confCookieDomain.LoadedValue)
+
+	defer func(oldHTTPS, oldExtHTTPS bool) { https, exthttps = oldHTTPS, oldExtHTTPS }(https, exthttps)
+
+	cases := []struct {
+		secure     string
+		sameSite   string
+		https      bool
+		expectSec  bool
+		expectSite http.SameSite
+	}{
+		{"auto", "lax", false, false, http.SameSiteLaxMode},
+		{"auto", "lax", true, true, http.SameSiteLaxMode},
+		{"false", "strict", true, false, http.SameSiteStrictMode},
+		{"TRUE", "default", false, true, http.SameSiteDefaultMode},
+		{"auto", "bogus", false, false, http.SameSiteLaxMode},
+		// browsers reject SameSite=None without Secure
+		{"false", "none", false, true, http.SameSiteNoneMode},
+	}
+
+	for _, c := range cases {
+		confCookieSecure.LoadedValue = c.secure
+		confCookieSameSite.LoadedValue = c.sameSite
+		confCookieHTTPOnly.LoadedValue = true
+		confCookieDomain.LoadedValue = ".example.com"
+		https, exthttps = c.https, false
+
+		cookie := newSessionCookie("token", 0)
+		if cookie.Secure != c.expectSec || cookie.SameSite != c.expectSite || !cookie.HttpOnly || cookie.Domain != ".example.com" {
+			t.Errorf("secure %q, same site %q, https %t: unexpected cookie %#v", c.secure, c.sameSite, c.https, cookie)
+		}
+	}
+
+	// a reverse proxy terminating tls counts as https
+	confCookieSecure.LoadedValue = "auto"
+	https, exthttps = false, true
+	if !cookieSecure() {
+		t.Error("expected secure cookies behind a https reverse proxy")
+	}
+}
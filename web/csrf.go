@@ -0,0 +1,115 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var metricsCSRFRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "yagpdb_web_csrf_rejected_total",
+	Help: "State changing requests rejected by the CSRF protection",
+}, []string{"reason"})
+
+// isStateChangingMethod returns true for the methods that are not supposed to be safe to replay from other sites
+func isStateChangingMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+
+	return true
+}
+
+// isSameOrigin returns true if the url (from the Origin or Referer header) points to this site
+func isSameOrigin(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return false
+	}
+
+	hostSplit := strings.SplitN(common.ConfHost.GetString(), ":", 2)
+	return strings.EqualFold(parsed.Hostname(), hostSplit[0])
+}
+
+// CSRFTokenForSession returns the csrf token for the session, for clients that can't send a Origin or Referer header.
+// It's derived from the session token which other sites can't read, so there's nothing to store.
+func CSRFTokenForSession(yagToken string) string {
+	mac := hmac.New(sha256.New, []byte(yagToken))
+	mac.Write([]byte("csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func requestCSRFToken(r *http.Request) string {
+	if v := r.Header.Get("X-CSRF-Token"); v != "" {
+		return v
+	}
+
+	// only look at url encoded forms, the other bodies are read by the handlers themselves
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return r.PostFormValue("csrf_token")
+	}
+
+	return ""
+}
+
+// CSRFProtectionMW protects every state changing request (anything but GET, HEAD, OPTIONS and TRACE) against CSRF attacks.
+// The Origin header has to point to this site, if it's missing the Referer header is checked instead,
+// and if that's missing too the request needs the csrf token of the session in the X-CSRF-Token header or csrf_token form field.
+// Requests authenticated with a api key or guild api token and requests without a session can't be forged and are let through.
+func CSRFProtectionMW(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		yagToken, _ := ctx.Value(common.ContextKeyYagToken).(string)
+		if yagToken != "" {
+			var tmpl TemplateData
+			ctx, tmpl = GetCreateTemplateData(ctx)
+			tmpl.SetCSRFToken(CSRFTokenForSession(yagToken))
+			r = r.WithContext(ctx)
+		}
+
+		if !isStateChangingMethod(r.Method) || ctx.Value(common.ContextKeyAPIKey) != nil || ctx.Value(common.ContextKeyGuildToken) != nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		reason := ""
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !isSameOrigin(origin) {
+				reason = "origin"
+			}
+		} else if referer := r.Referer(); referer != "" {
+			if !isSameOrigin(referer) {
+				reason = "referer"
+			}
+		} else if yagToken != "" {
+			token := requestCSRFToken(r)
+			if !hmac.Equal([]byte(token), []byte(CSRFTokenForSession(yagToken))) {
+				reason = "token"
+			}
+		}
+
+		if reason != "" {
+			metricsCSRFRejected.With(prometheus.Labels{"reason": reason}).Inc()
+			CtxLogger(ctx).WithField("origin", r.Header.Get("Origin")).WithField("referer", r.Referer()).Warn("Rejected cross site request, bad ", reason)
+			WriteErrorResponse(w, r, "Bad origin", http.StatusUnauthorized)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(mw)
+}
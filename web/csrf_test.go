@@ -0,0 +1,115 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+func TestIsSameOrigin(t *testing.T) {
+	defer func(old interface{}) { common.ConfHost.LoadedValue = old }(common.ConfHost.LoadedValue)
+	common.ConfHost.LoadedValue = "example.com:5000"
+
+	cases := map[string]bool{
+		"https://example.com":          true,
+		"http://EXAMPLE.com:5000/x":    true,
+		"https://example.com.evil.com": false,
+		"https://evil.com/example.com": false,
+		"ftp://example.com":            false,
+		"example.com":                  false,
+		"null":                         false,
+		"":                             false,
+	}
+
+	for origin, expected := range cases {
+		if got := isSameOrigin(origin); got != expected {
+			t.Errorf("%q: got %t, expected %t", origin, got, expected)
+		}
+	}
+}
+
+func TestCSRFProtectionMW(t *testing.T) {
+	defer func(old interface{}) { common.ConfHost.LoadedValue = old }(common.ConfHost.LoadedValue)
+	common.ConfHost.LoadedValue = "example.com"
+
+	const yagToken = "session-token"
+	goodToken := CSRFTokenForSession(yagToken)
+
+	cases := []struct {
+		name        string
+		method      string
+		origin      string
+		referer     string
+		headerToken string
+		formToken   string
+		session     bool
+		contextKey  interface{}
+		allowed     bool
+	}{
+		{name: "same origin", method: "POST", origin: "https://example.com", session: true, allowed: true},
+		{name: "cross origin", method: "POST", origin: "https://evil.com", session: true},
+		{name: "cross origin with a good token", method: "POST", origin: "https://evil.com", headerToken: goodToken, session: true},
+		{name: "same origin referer", method: "POST", referer: "https://example.com/manage", session: true, allowed: true},
+		{name: "cross origin referer", method: "POST", referer: "https://evil.com/example.com", session: true},
+		{name: "origin over referer", method: "POST", origin: "https://evil.com", referer: "https://example.com/manage", session: true},
+		{name: "no headers good header token", method: "POST", headerToken: goodToken, session: true, allowed: true},
+		{name: "no headers good form token", method: "POST", formToken: goodToken, session: true, allowed: true},
+		{name: "no headers bad token", method: "POST", headerToken: CSRFTokenForSession("other-session"), session: true},
+		{name: "no headers no token", method: "POST", session: true},
+		{name: "no session", method: "POST", allowed: true},
+		{name: "no session cross origin", method: "POST", origin: "https://evil.com"},
+		{name: "safe method", method: "GET", origin: "https://evil.com", session: true, allowed: true},
+		{name: "delete", method: "DELETE", origin: "https://evil.com", session: true},
+		{name: "api key", method: "POST", origin: "https://evil.com", session: true, contextKey: common.ContextKeyAPIKey, allowed: true},
+		{name: "guild token", method: "POST", origin: "https://evil.com", contextKey: common.ContextKeyGuildToken, allowed: true},
+	}
+
+	for _, c := range cases {
+		called := false
+		handler := CSRFProtectionMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+
+			// the token is available to the templates for the forms
+			if _, tmpl := GetCreateTemplateData(r.Context()); c.session && tmpl.CSRFToken() != goodToken {
+				t.Errorf("%s: expected the csrf token in the template data, got %v", c.name, tmpl.CSRFToken())
+			}
+		}))
+
+		var r *http.Request
+		if c.formToken != "" {
+			r = httptest.NewRequest(c.method, "/manage/1/core", strings.NewReader(url.Values{"csrf_token": {c.formToken}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(c.method, "/manage/1/core", nil)
+		}
+
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if c.referer != "" {
+			r.Header.Set("Referer", c.referer)
+		}
+		if c.headerToken != "" {
+			r.Header.Set("X-CSRF-Token", c.headerToken)
+		}
+
+		ctx := r.Context()
+		if c.session {
+			ctx = context.WithValue(ctx, common.ContextKeyYagToken, yagToken)
+		}
+		if c.contextKey != nil {
+			ctx = context.WithValue(ctx, c.contextKey, true)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(ctx))
+		if called != c.allowed {
+			t.Errorf("%s: expected allowed %t, got %t (%d)", c.name, c.allowed, called, w.Code)
+		}
+	}
+}
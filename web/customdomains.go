@@ -0,0 +1,516 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	// hash of verified domain -> guild id, shared by all web nodes
+	customDomainsRedisKey = "web_custom_domains"
+	// the TXT record proving the domain belongs to the server is placed on this subdomain of it
+	customDomainChallengePrefix = "_yagpdb-challenge."
+)
+
+var (
+	panelLogKeyCustomDomainSet = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "custom_domain_set",
+		FormatString: "Set the custom domain to %s",
+	})
+	panelLogKeyCustomDomainVerified = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "custom_domain_verified",
+		FormatString: "Verified the custom domain %s",
+	})
+	panelLogKeyCustomDomainRemoved = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "custom_domain_removed",
+		FormatString: "Removed the custom domain %s",
+	})
+)
+
+// CustomDomainPage is a public page of the server that can be served on its custom domain
+type CustomDomainPage struct {
+	Path string
+	Name string
+}
+
+// CustomDomainPages are the public pages served on custom domains, the first is the default landing page
+var CustomDomainPages = []*CustomDomainPage{
+	{Path: "stats", Name: "Server stats"},
+	{Path: "reputation/leaderboard", Name: "Reputation leaderboard"},
+}
+
+// CustomDomain is a domain the public pages of a server are served on, once it's verified
+type CustomDomain struct {
+	Domain      string `json:"domain"`
+	GuildID     int64  `json:"guild_id,string"`
+	LandingPage string `json:"landing_page"`
+
+	// Token has to be in the TXT record at _yagpdb-challenge.<domain> to verify the domain
+	Token      string    `json:"token"`
+	Verified   bool      `json:"verified"`
+	AddedBy    int64     `json:"added_by,string"`
+	AddedAt    time.Time `json:"added_at"`
+	VerifiedAt time.Time `json:"verified_at,omitempty"`
+}
+
+func keyGuildCustomDomain(guildID int64) string {
+	return "web_guild_custom_domain:" + discordgo.StrID(guildID)
+}
+
+// mainHostname returns the hostname of the control panel, without the port
+func mainHostname() string {
+	return strings.ToLower(strings.SplitN(common.ConfHost.GetString(), ":", 2)[0])
+}
+
+// normalizeCustomDomain validates the domain entered by the user, accepting it with a scheme or trailing slash
+func normalizeCustomDomain(raw string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(raw))
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+	domain = strings.TrimSuffix(strings.TrimSuffix(domain, "/"), ".")
+
+	if domain == "" || len(domain) > 253 {
+		return "", NewPublicError("Invalid domain")
+	}
+
+	if net.ParseIP(domain) != nil {
+		return "", NewPublicError("The custom domain has to be a domain name, not an ip address")
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", NewPublicError("Invalid domain, it needs to be a full domain name like stats.example.com")
+	}
+
+	for _, label := range labels {
+		if len(label) < 1 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", NewPublicError("Invalid domain")
+		}
+
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return "", NewPublicError("Invalid domain, only letters, numbers and dashes are allowed")
+			}
+		}
+	}
+
+	if host := mainHostname(); domain == host || strings.HasSuffix(domain, "."+host) {
+		return "", NewPublicError("You can't use this domain")
+	}
+
+	return domain, nil
+}
+
+// GetGuildCustomDomain returns the custom domain of the server, nil if it has none
+func GetGuildCustomDomain(guildID int64) (*CustomDomain, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "GET", keyGuildCustomDomain(guildID)))
+	if err != nil || len(raw) == 0 {
+		return nil, errors.WithStackIf(err)
+	}
+
+	var domain *CustomDomain
+	err = json.Unmarshal(raw, &domain)
+	return domain, errors.WithStackIf(err)
+}
+
+func saveGuildCustomDomain(domain *CustomDomain) error {
+	serialized, err := json.Marshal(domain)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	return errors.WithStackIf(common.RedisPool.Do(radix.FlatCmd(nil, "SET", keyGuildCustomDomain(domain.GuildID), serialized)))
+}
+
+// SetGuildCustomDomain sets the custom domain of the server, it has to be verified again unless only the landing page changed
+func SetGuildCustomDomain(guildID, userID int64, rawDomain, landingPage string) (*CustomDomain, error) {
+	domain, err := normalizeCustomDomain(rawDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	if findCustomDomainPage(landingPage) == nil {
+		return nil, NewPublicError("Unknown landing page")
+	}
+
+	owner, err := lookupCustomDomainGuild(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if owner != 0 && owner != guildID {
+		return nil, NewPublicError("This domain is already in use by another server")
+	}
+
+	current, err := GetGuildCustomDomain(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil && current.Domain == domain {
+		current.LandingPage = landingPage
+		return current, saveGuildCustomDomain(current)
+	}
+
+	if current != nil && current.Verified {
+		err = releaseCustomDomain(current)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cd := &CustomDomain{
+		Domain:      domain,
+		GuildID:     guildID,
+		LandingPage: landingPage,
+		Token:       RandBase64(18),
+		AddedBy:     userID,
+		AddedAt:     time.Now(),
+	}
+
+	return cd, saveGuildCustomDomain(cd)
+}
+
+// RemoveGuildCustomDomain removes the custom domain of the server, returning nil if it had none
+func RemoveGuildCustomDomain(guildID int64) (*CustomDomain, error) {
+	current, err := GetGuildCustomDomain(guildID)
+	if err != nil || current == nil {
+		return nil, err
+	}
+
+	if current.Verified {
+		err = releaseCustomDomain(current)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return current, errors.WithStackIf(common.RedisPool.Do(radix.Cmd(nil, "DEL", keyGuildCustomDomain(guildID))))
+}
+
+// releaseCustomDomain stops routing the domain to the server, if it's still pointing to it
+func releaseCustomDomain(cd *CustomDomain) error {
+	owner, err := lookupCustomDomainGuild(cd.Domain)
+	if err != nil || owner != cd.GuildID {
+		return err
+	}
+
+	err = common.RedisPool.Do(radix.Cmd(nil, "HDEL", customDomainsRedisKey, cd.Domain))
+	customDomainCache.Delete(cd.Domain)
+	return errors.WithStackIf(err)
+}
+
+// resolver used for the verification, replaced in tests
+var (
+	lookupCNAME = net.DefaultResolver.LookupCNAME
+	lookupTXT   = net.DefaultResolver.LookupTXT
+	lookupHost  = net.DefaultResolver.LookupHost
+)
+
+// checkCustomDomainDNS checks that the domain points to us, either through a CNAME or by resolving to the same
+// addresses for apex domains that can't have one, and that the challenge TXT record contains the token
+func checkCustomDomainDNS(ctx context.Context, cd *CustomDomain, target string) error {
+	pointsToUs := false
+	if cname, err := lookupCNAME(ctx, cd.Domain); err == nil && strings.EqualFold(strings.TrimSuffix(cname, "."), target) {
+		pointsToUs = true
+	} else {
+		domainAddrs, _ := lookupHost(ctx, cd.Domain)
+		targetAddrs, _ := lookupHost(ctx, target)
+		for _, a := range domainAddrs {
+			for _, b := range targetAddrs {
+				if a == b {
+					pointsToUs = true
+				}
+			}
+		}
+	}
+
+	if !pointsToUs {
+		return NewPublicError(cd.Domain, " does not point to ", target, " yet, add a CNAME record for it pointing to ", target, ". DNS changes can take a while to show up.")
+	}
+
+	records, _ := lookupTXT(ctx, customDomainChallengePrefix+cd.Domain)
+	for _, v := range records {
+		if strings.TrimSpace(v) == cd.Token {
+			return nil
+		}
+	}
+
+	return NewPublicError("Could not find the TXT record at ", customDomainChallengePrefix+cd.Domain, " with the verification token")
+}
+
+// VerifyGuildCustomDomain checks the DNS records of the server's custom domain, and starts serving the public pages on it if they're correct
+func VerifyGuildCustomDomain(ctx context.Context, guildID int64) (*CustomDomain, error) {
+	cd, err := GetGuildCustomDomain(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cd == nil {
+		return nil, NewPublicError("No custom domain set")
+	}
+
+	if cd.Verified {
+		return cd, nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	err = checkCustomDomainDNS(lookupCtx, cd, mainHostname())
+	if err != nil {
+		return nil, err
+	}
+
+	var set bool
+	err = common.RedisPool.Do(radix.FlatCmd(&set, "HSETNX", customDomainsRedisKey, cd.Domain, guildID))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	if !set {
+		owner, err := lookupCustomDomainGuild(cd.Domain)
+		if err != nil {
+			return nil, err
+		}
+
+		if owner != guildID {
+			return nil, NewPublicError("This domain is already in use by another server")
+		}
+	}
+
+	customDomainCache.Delete(cd.Domain)
+
+	cd.Verified = true
+	cd.VerifiedAt = time.Now()
+	return cd, saveGuildCustomDomain(cd)
+}
+
+// lookupCustomDomainGuild returns the server the verified domain belongs to, 0 if none
+func lookupCustomDomainGuild(domain string) (int64, error) {
+	var guildID int64
+	err := common.RedisPool.Do(radix.Cmd(&guildID, "HGET", customDomainsRedisKey, domain))
+	return guildID, errors.WithStackIf(err)
+}
+
+// verified domains are cached locally, other nodes pick up changes within a minute
+var customDomainCache = cache.New(time.Minute, time.Minute*5)
+
+type cachedCustomDomain struct {
+	guildID     int64
+	landingPage string
+}
+
+func customDomainForHost(host string) (*cachedCustomDomain, error) {
+	if v, ok := customDomainCache.Get(host); ok {
+		return v.(*cachedCustomDomain), nil
+	}
+
+	guildID, err := lookupCustomDomainGuild(host)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &cachedCustomDomain{guildID: guildID}
+	if guildID != 0 {
+		cd, err := GetGuildCustomDomain(guildID)
+		if err != nil {
+			return nil, err
+		}
+
+		if cd == nil || cd.Domain != host || !cd.Verified {
+			// removed in the meantime
+			result.guildID = 0
+		} else {
+			result.landingPage = cd.LandingPage
+		}
+	}
+
+	customDomainCache.Set(host, result, cache.DefaultExpiration)
+	return result, nil
+}
+
+func findCustomDomainPage(path string) *CustomDomainPage {
+	for _, v := range CustomDomainPages {
+		if v.Path == path {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// customDomainPath maps the path requested on a custom domain to the public page of the server,
+// returning false if it's not a page served on custom domains
+func customDomainPath(guildID int64, landingPage, path string) (string, bool) {
+	publicPrefix := "/public/" + strconv.FormatInt(guildID, 10)
+	if path == "/" {
+		if findCustomDomainPage(landingPage) == nil {
+			landingPage = CustomDomainPages[0].Path
+		}
+		return publicPrefix + "/" + landingPage, true
+	}
+
+	// links and scripts on the pages themselves use the full public paths
+	path = strings.TrimPrefix(path, publicPrefix)
+	for _, v := range CustomDomainPages {
+		if path == "/"+v.Path || strings.HasPrefix(path, "/"+v.Path+"/") {
+			return publicPrefix + path, true
+		}
+	}
+
+	return "", false
+}
+
+// CustomDomainHostPolicy allows certificates to be issued for verified custom domains, in addition to the main host
+func CustomDomainHostPolicy(ctx context.Context, host string) error {
+	host = strings.ToLower(host)
+	if main := mainHostname(); host == main || host == "www."+main {
+		return nil
+	}
+
+	cd, err := customDomainForHost(host)
+	if err != nil {
+		return err
+	}
+
+	if cd.guildID == 0 {
+		return errors.New("unknown host " + host)
+	}
+
+	return nil
+}
+
+// customDomainHandler serves the public pages of servers on their verified custom domains,
+// everything else requested on them is redirected to the control panel. It runs before the routing as goji routes
+// requests before running the middlewares.
+func customDomainHandler(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+
+		if main := mainHostname(); host == "" || host == main || host == "www."+main || net.ParseIP(host) != nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		cd, err := customDomainForHost(host)
+		if err != nil {
+			logger.WithError(err).WithField("host", host).Error("failed looking up custom domain")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if cd.guildID == 0 || isStatic(r) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		path, ok := customDomainPath(cd.guildID, cd.landingPage, r.URL.Path)
+		if !ok {
+			http.Redirect(w, r, BaseURL()+r.URL.RequestURI(), http.StatusFound)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.URL.Path = path
+		r.URL.RawPath = ""
+		inner.ServeHTTP(w, r)
+	})
+}
+
+type CustomDomainForm struct {
+	Domain      string `valid:",1,253"`
+	LandingPage string `valid:",1,100"`
+}
+
+func customDomainTemplateData(tmpl TemplateData, cd *CustomDomain) {
+	tmpl["CustomDomain"] = cd
+	tmpl["CustomDomainTarget"] = mainHostname()
+	tmpl["CustomDomainPages"] = CustomDomainPages
+	if cd != nil {
+		tmpl["CustomDomainChallenge"] = customDomainChallengePrefix + cd.Domain
+	}
+}
+
+// HandleGetCustomDomain handles GET /manage/:server/custom_domain
+func HandleGetCustomDomain(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, tmpl := GetBaseCPContextData(r.Context())
+
+	cd, err := GetGuildCustomDomain(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	customDomainTemplateData(tmpl, cd)
+	return tmpl, nil
+}
+
+// HandlePostCustomDomain handles POST /manage/:server/custom_domain
+func HandlePostCustomDomain(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/custom_domain")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*CustomDomainForm)
+	cd, err := SetGuildCustomDomain(g.ID, ContextUser(ctx).ID, form.Domain, form.LandingPage)
+	if err != nil {
+		return tmpl, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyCustomDomainSet, &cplogs.Param{Type: cplogs.ParamTypeString, Value: cd.Domain}))
+	return tmpl, nil
+}
+
+// HandleVerifyCustomDomain handles POST /manage/:server/custom_domain/verify
+func HandleVerifyCustomDomain(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/custom_domain")
+
+	cd, err := VerifyGuildCustomDomain(ctx, g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyCustomDomainVerified, &cplogs.Param{Type: cplogs.ParamTypeString, Value: cd.Domain}))
+	return tmpl, nil
+}
+
+// HandleRemoveCustomDomain handles POST /manage/:server/custom_domain/remove
+func HandleRemoveCustomDomain(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/custom_domain")
+
+	cd, err := RemoveGuildCustomDomain(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	if cd == nil {
+		return tmpl, NewPublicError("No custom domain set")
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyCustomDomainRemoved, &cplogs.Param{Type: cplogs.ParamTypeString, Value: cd.Domain}))
+	return tmpl, nil
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeCustomDomain(t *testing.T) {
+	valid := map[string]string{
+		"stats.example.com":           "stats.example.com",
+		" https://Stats.Example.com/": "stats.example.com",
+		"example.com.":                "example.com",
+		"my-server.example.co.uk":     "my-server.example.co.uk",
+	}
+
+	for in, expected := range valid {
+		got, err := normalizeCustomDomain(in)
+		if err != nil || got != expected {
+			t.Errorf("normalizeCustomDomain(%q) = %q, %v, expected %q", in, got, err, expected)
+		}
+	}
+
+	invalid := []string{"", "localhost", "127.0.0.1", "-bad.example.com", "under_score.example.com", "a..b", "example.com:8080"}
+	for _, v := range invalid {
+		if got, err := normalizeCustomDomain(v); err == nil {
+			t.Errorf("expected %q to be rejected, got %q", v, got)
+		}
+	}
+}
+
+func TestCustomDomainPath(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+		ok       bool
+	}{
+		{"/", "/public/1/reputation/leaderboard", true},
+		{"/stats", "/public/1/stats", true},
+		{"/stats/daily_json", "/public/1/stats/daily_json", true},
+		{"/public/1/stats/charts", "/public/1/stats/charts", true},
+		{"/statsfoo", "", false},
+		{"/public/2/stats", "", false},
+		{"/manage/1/core", "", false},
+		{"/login", "", false},
+	}
+
+	for _, c := range cases {
+		got, ok := customDomainPath(1, "reputation/leaderboard", c.path)
+		if got != c.expected || ok != c.ok {
+			t.Errorf("customDomainPath(%q) = %q, %v, expected %q, %v", c.path, got, ok, c.expected, c.ok)
+		}
+	}
+
+	if got, _ := customDomainPath(1, "removed_page", "/"); got != "/public/1/"+CustomDomainPages[0].Path {
+		t.Errorf("expected unknown landing pages to fall back to the default, got %q", got)
+	}
+}
+
+func TestCheckCustomDomainDNS(t *testing.T) {
+	origCNAME, origTXT, origHost := lookupCNAME, lookupTXT, lookupHost
+	defer func() {
+		lookupCNAME, lookupTXT, lookupHost = origCNAME, origTXT, origHost
+	}()
+
+	records := map[string][]string{
+		"_yagpdb-challenge.stats.example.com": {"unrelated", "token"},
+	}
+	lookupTXT = func(ctx context.Context, name string) ([]string, error) { return records[name], nil }
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		switch host {
+		case "example.com", "yagpdb.xyz":
+			return []string{"1.2.3.4"}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	lookupCNAME = func(ctx context.Context, host string) (string, error) {
+		if host == "stats.example.com" {
+			return "YAGPDB.xyz.", nil
+		}
+		return host + ".", nil
+	}
+
+	cd := &CustomDomain{Domain: "stats.example.com", Token: "token"}
+	if err := checkCustomDomainDNS(context.Background(), cd, "yagpdb.xyz"); err != nil {
+		t.Errorf("expected the cname to be accepted: %v", err)
+	}
+
+	cd.Token = "other"
+	if err := checkCustomDomainDNS(context.Background(), cd, "yagpdb.xyz"); err == nil {
+		t.Error("expected a missing token to be rejected")
+	}
+
+	records["_yagpdb-challenge.example.com"] = []string{"apex"}
+	if err := checkCustomDomainDNS(context.Background(), &CustomDomain{Domain: "example.com", Token: "apex"}, "yagpdb.xyz"); err != nil {
+		t.Errorf("expected a apex domain resolving to the same address to be accepted: %v", err)
+	}
+
+	if err := checkCustomDomainDNS(context.Background(), &CustomDomain{Domain: "elsewhere.com", Token: "token"}, "yagpdb.xyz"); err == nil {
+		t.Error("expected a domain not pointing to us to be rejected")
+	}
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+var (
+	confMaxRenderedPageSize = config.RegisterOption("yagpdb.web.max_rendered_page_size", "Rendered pages larger than this (in bytes) are logged as offenders, 0 to disable", 2000000)
+	confTemplateOptionLimit = config.RegisterOption("yagpdb.web.template_option_limit", "Max amount of role options rendered into a dropdown, the rest is loaded afterwards through ajax, 0 to disable", 250)
+)
+
+// checkRenderedSize logs pages that rendered to more than the configured max size,
+// these are usually caused by huge guilds with tons of roles and channels
+func checkRenderedSize(r *http.Request, tmpl string, size int64) {
+	max := int64(confMaxRenderedPageSize.GetInt())
+	if max <= 0 || size <= max {
+		return
+	}
+
+	l := CtxLogger(r.Context()).WithField("template", tmpl).WithField("size", size).WithField("path", r.URL.Path)
+	if r.Context().Value(common.ContextKeyCurrentGuild) != nil {
+		guild := ContextGuild(r.Context())
+		l = l.WithField("roles", len(guild.Roles)).WithField("channels", len(guild.Channels))
+	}
+
+	l.Warn("Rendered page exceeded the max size")
+}
+
+func templateOptionLimit() int {
+	return confTemplateOptionLimit.GetInt()
+}
+
+// loadMoreRolesOption is placed at the end of truncated role dropdowns, the frontend then fetches the remaining roles
+// from the roles continuation endpoint starting at offset
+func loadMoreRolesOption(offset, remaining int, botLimited bool) string {
+	limited := "0"
+	if botLimited {
+		limited = "1"
+	}
+
+	return fmt.Sprintf(`<option disabled data-load-more="roles" data-offset="%d" data-bot-limited="%s">Loading %d more roles...</option>`+"\n", offset, limited, remaining)
+}
+
+// RoleOption is a single role returned by the roles continuation endpoint
+type RoleOption struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Color    string `json:"color,omitempty"`
+	Managed  bool   `json:"managed"`
+	AboveBot bool   `json:"above_bot"`
+}
+
+// HandleGetRoleOptions returns the roles of the guild starting at offset, used to load the remainder of truncated role dropdowns
+func HandleGetRoleOptions(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	guild := ContextGuild(ctx)
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	highestBotRole, _ := ctx.Value(common.ContextKeyHighestBotRole).(*discordgo.Role)
+
+	result := make([]*RoleOption, 0)
+	for k := offset; k < len(guild.Roles)-1; k++ { // skip the everyone role, which is the last one
+		role := guild.Roles[k]
+
+		opt := &RoleOption{
+			ID:      discordgo.StrID(role.ID),
+			Name:    role.Name,
+			Managed: role.Managed,
+		}
+
+		if role.Color != 0 {
+			opt.Color = fmt.Sprintf("#%06x", int64(role.Color))
+		}
+
+		if highestBotRole != nil && (common.IsRoleAbove(&role, highestBotRole) || role.ID == highestBotRole.ID) {
+			opt.AboveBot = true
+		}
+
+		result = append(result, opt)
+	}
+
+	return result
+}
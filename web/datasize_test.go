@@ -0,0 +1,88 @@
+package web
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+// testRoles returns n roles followed by the everyone role, highest position first like the guild state has them
+func testRoles(n int) []discordgo.Role {
+	roles := make([]discordgo.Role, 0, n+1)
+	for i := 0; i < n; i++ {
+		roles = append(roles, discordgo.Role{ID: int64(i + 1), Name: "role", Position: n - i})
+	}
+
+	return append(roles, discordgo.Role{ID: 100, Name: "@everyone"})
+}
+
+func TestRoleDropdownLimit(t *testing.T) {
+	defer func(old interface{}) { confTemplateOptionLimit.LoadedValue = old }(confTemplateOptionLimit.LoadedValue)
+	confTemplateOptionLimit.LoadedValue = 2
+
+	roles := testRoles(5)
+
+	single := string(tmplRoleDropdown(roles, nil, int64(5)))
+	multi := string(tmplRoleDropdownMutli(roles, nil, []int64{5}))
+
+	for name, output := range map[string]string{"single": single, "multi": multi} {
+		// the first 2 roles and the selected one past the limit
+		for _, v := range []string{`value="1"`, `value="2"`, `value="5" selected`} {
+			if !strings.Contains(output, v) {
+				t.Errorf("%s: expected %s to be rendered, got %s", name, v, output)
+			}
+		}
+
+		for _, v := range []string{`value="3"`, `value="4"`, `value="100"`} {
+			if strings.Contains(output, v) {
+				t.Errorf("%s: expected %s to be left to the continuation, got %s", name, v, output)
+			}
+		}
+
+		if !strings.Contains(output, `data-offset="2"`) || !strings.Contains(output, "Loading 2 more roles") {
+			t.Errorf("%s: expected a option loading the 2 remaining roles from offset 2, got %s", name, output)
+		}
+	}
+}
+
+func TestRoleDropdownNoLimit(t *testing.T) {
+	defer func(old interface{}) { confTemplateOptionLimit.LoadedValue = old }(confTemplateOptionLimit.LoadedValue)
+	confTemplateOptionLimit.LoadedValue = 0
+
+	output := string(tmplRoleDropdown(testRoles(300), nil))
+	if strings.Contains(output, "data-load-more") || strings.Count(output, "<option") != 300 {
+		t.Errorf("expected all the roles to be rendered without a limit")
+	}
+}
+
+func TestHandleGetRoleOptions(t *testing.T) {
+	roles := testRoles(5)
+	roles[0].Color = 0xff0000
+
+	ctx := context.WithValue(context.Background(), common.ContextKeyCurrentGuild, &dstate.GuildSet{Roles: roles})
+	ctx = context.WithValue(ctx, common.ContextKeyHighestBotRole, &roles[2])
+
+	r := httptest.NewRequest("GET", "/manage/1/options/roles?offset=1", nil).WithContext(ctx)
+	result, ok := HandleGetRoleOptions(nil, r).([]*RoleOption)
+	if !ok || len(result) != 4 {
+		t.Fatalf("expected the 4 roles after the offset without the everyone role, got %#v", result)
+	}
+
+	// roles at or above the bot's highest role can't be assigned
+	for i, v := range result {
+		if v.ID != discordgo.StrID(roles[i+1].ID) || v.AboveBot != (i < 2) {
+			t.Errorf("unexpected role option %d: %#v", i, v)
+		}
+	}
+
+	r = httptest.NewRequest("GET", "/manage/1/options/roles?offset=-5", nil).WithContext(ctx)
+	result, _ = HandleGetRoleOptions(nil, r).([]*RoleOption)
+	if len(result) != 5 || result[0].Color != "#ff0000" {
+		t.Errorf("expected a negative offset to start at the beginning, got %#v", result)
+	}
+}
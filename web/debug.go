@@ -0,0 +1,67 @@
+package web
+
+import (
+	"expvar"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"goji.io"
+	"goji.io/pat"
+)
+
+var (
+	processStarted       = time.Now()
+	publishDebugVarsOnce sync.Once
+)
+
+// setupDebugRoutes sets up net/http/pprof and expvar under /debug/ for bot owners, so a running webserver can be
+// profiled without redeploying it. Long cpu profiles and traces aren't cut off by the request timeout, see
+// yagpdb.web.debug_request_timeout.
+func setupDebugRoutes() {
+	publishDebugVarsOnce.Do(publishDebugVars)
+
+	debugMux := goji.SubMux()
+	RootMux.Handle(pat.New("/debug/*"), debugMux)
+
+	debugMux.Use(IPAllowlistMiddleware)
+	debugMux.Use(RequireSessionMiddleware)
+	debugMux.Use(RequireBotOwnerMW)
+
+	debugMux.Handle(pat.Get("/vars"), expvar.Handler())
+
+	// the pprof handlers look at the full path, which the submux leaves alone
+	debugMux.HandleFunc(pat.Get("/pprof/"), pprof.Index)
+	debugMux.HandleFunc(pat.Get("/pprof/cmdline"), pprof.Cmdline)
+	debugMux.HandleFunc(pat.Get("/pprof/profile"), pprof.Profile)
+	debugMux.HandleFunc(pat.Get("/pprof/symbol"), pprof.Symbol)
+	debugMux.HandleFunc(pat.Get("/pprof/trace"), pprof.Trace)
+	// goroutine, heap, allocs, block, mutex and threadcreate
+	debugMux.HandleFunc(pat.Get("/pprof/:profile"), pprof.Index)
+}
+
+// publishDebugVars adds the runtime and webserver stats to the ones expvar publishes by default (cmdline and
+// memstats)
+func publishDebugVars() {
+	expvar.Publish("runtime", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"version":        common.VERSION,
+			"go_version":     runtime.Version(),
+			"uptime_seconds": int64(time.Since(processStarted).Seconds()),
+			"goroutines":     runtime.NumGoroutine(),
+			"num_cpu":        runtime.NumCPU(),
+			"gomaxprocs":     runtime.GOMAXPROCS(0),
+			"cgo_calls":      runtime.NumCgoCall(),
+		}
+	}))
+
+	expvar.Publish("web", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"in_flight_requests": InFlightRequests(),
+			"accepting_requests": IsAcceptingRequests(),
+			"redis_degraded":     RedisDegraded(),
+		}
+	}))
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// how often redis is pinged, also what clients are told to retry after while it's down
+const redisHealthCheckInterval = time.Second * 5
+
+var (
+	// set to 1 while redis is unreachable
+	redisDown int32
+
+	metricsRedisDown = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "yagpdb_web_redis_down",
+		Help: "1 while redis is unreachable and the control panel is in read-only mode",
+	})
+)
+
+// RedisDegraded returns true while redis is unreachable, the control panel is then read-only: public pages still
+// render, but logging in, changing settings and the api are unavailable until redis is back
+func RedisDegraded() bool {
+	return atomic.LoadInt32(&redisDown) == 1
+}
+
+func setRedisDegraded(down bool) {
+	v := int32(0)
+	if down {
+		v = 1
+	}
+
+	if atomic.SwapInt32(&redisDown, v) == v {
+		return
+	}
+
+	metricsRedisDown.Set(float64(v))
+	if down {
+		logger.Error("Redis is unreachable, the control panel is read-only until it's back")
+	} else {
+		logger.Info("Redis is reachable again, leaving read-only mode")
+	}
+}
+
+// monitorRedis pings redis to enter and leave read-only mode
+func monitorRedis(ctx context.Context) {
+	ticker := time.NewTicker(redisHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := common.RedisPool.Do(radix.Cmd(nil, "PING"))
+		if err != nil && !RedisDegraded() {
+			logger.WithError(err).Error("Failed pinging redis")
+		}
+
+		setRedisDegraded(err != nil)
+	}
+}
+
+// DegradedModeMiddleware rejects the api and changes while redis is down and shows a banner on the pages that still work
+func DegradedModeMiddleware(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		if !RedisDegraded() {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if wantsJSONError(r) || !isReadOnlyMethod(r.Method) {
+			writeUnavailableResponse(w, r)
+			return
+		}
+
+		ctx := SetContextTemplateData(r.Context(), map[string]interface{}{"Degraded": true})
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(mw)
+}
+
+// writeUnavailableResponse responds with a 503, as json for api routes and otherwise with a page that has a retry button
+func writeUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	retryAfter := int(redisHealthCheckInterval.Seconds())
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	if wantsJSONError(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error":       "The control panel is temporarily read-only, try again in a bit",
+			"code":        "degraded",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	if Templates == nil || Templates.Lookup("error_503") == nil {
+		http.Error(w, "The control panel is temporarily read-only, try again in a bit", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	// changes are retried from the page the form was on
+	retryURL := r.URL.RequestURI()
+	if !isReadOnlyMethod(r.Method) {
+		retryURL = r.Referer()
+		if retryURL == "" {
+			retryURL = "/manage"
+		}
+	}
+
+	err := Templates.ExecuteTemplate(w, "error_503", map[string]interface{}{"RetryURL": retryURL, "RetryAfter": retryAfter})
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("Failed executing error page template")
+		fmt.Fprint(w, "The control panel is temporarily read-only, try again in a bit")
+	}
+}
@@ -0,0 +1,47 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDegradedModeMiddleware(t *testing.T) {
+	var served TemplateData
+	handler := DegradedModeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, served = GetCreateTemplateData(r.Context())
+	}))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		served = nil
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	serve("GET", "/manage")
+	if served == nil || served["Degraded"] != nil {
+		t.Fatal("expected requests to pass through untouched while redis is up")
+	}
+
+	orig := redisDown
+	defer func() {
+		redisDown = orig
+	}()
+	redisDown = 1
+
+	serve("GET", "/manage")
+	if served == nil || served["Degraded"] != true {
+		t.Error("expected pages to still render, with the banner")
+	}
+
+	if w := serve("POST", "/manage/1/core"); served != nil || w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected changes to be rejected, got %d", w.Code)
+	}
+
+	w := serve("GET", "/api/1/stats")
+	if served != nil || w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"code":"degraded"`) {
+		t.Errorf("expected a structured api error, got %d: %s", w.Code, w.Body.String())
+	}
+}
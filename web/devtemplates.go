@@ -0,0 +1,126 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// set with the -devtemplates flag to the root of a checkout of the repo
+var devTemplatesDir string
+
+// templateSource is a parsed template file, kept so the templates can be parsed again from disk in dev mode
+type templateSource struct {
+	name     string
+	contents string
+
+	// relative to the root of the repo, the embedded contents are used if it doesn't exist there
+	path string
+}
+
+var (
+	templateSources []*templateSource
+
+	// held for writing while the templates are swapped out, and for reading by every request in dev mode
+	devTemplatesMU          sync.RWMutex
+	devTemplatesFingerprint string
+)
+
+// DevTemplates returns true if the templates are parsed from disk again when they change, and minification is
+// disabled, so control panel pages can be worked on without restarting the webserver
+func DevTemplates() bool {
+	return devTemplatesDir != ""
+}
+
+func parseTemplate(name, path, contents string) {
+	templateSources = append(templateSources, &templateSource{name: name, path: path, contents: contents})
+
+	if minifyTemplates() {
+		contents = minifyTemplate(contents)
+	}
+
+	Templates = Templates.New(name)
+	Templates = template.Must(Templates.Parse(contents))
+}
+
+// devTemplatesChanged returns the fingerprint of the template files on disk, and whether it changed since they were
+// last parsed
+func devTemplatesChanged() (string, bool) {
+	var b strings.Builder
+	for _, src := range templateSources {
+		stat, err := os.Stat(filepath.Join(devTemplatesDir, src.path))
+		if err != nil {
+			b.WriteString("-;")
+			continue
+		}
+
+		b.WriteString(strconv.FormatInt(stat.ModTime().UnixNano(), 10) + ":" + strconv.FormatInt(stat.Size(), 10) + ";")
+	}
+
+	fingerprint := b.String()
+	return fingerprint, fingerprint != devTemplatesFingerprint
+}
+
+// parseDevTemplates parses every template again, from disk where they exist there
+func parseDevTemplates() (*template.Template, error) {
+	set := template.New("").Funcs(templateFuncs)
+	for _, src := range templateSources {
+		contents := src.contents
+		if raw, err := os.ReadFile(filepath.Join(devTemplatesDir, src.path)); err == nil {
+			contents = string(raw)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		var err error
+		set, err = set.New(src.name).Parse(contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return set, nil
+}
+
+// reloadDevTemplates parses the templates again if any of them changed on disk
+func reloadDevTemplates() error {
+	devTemplatesMU.Lock()
+	defer devTemplatesMU.Unlock()
+
+	fingerprint, changed := devTemplatesChanged()
+	if !changed {
+		return nil
+	}
+
+	set, err := parseDevTemplates()
+	if err != nil {
+		return err
+	}
+
+	Templates = set
+	devTemplatesFingerprint = fingerprint
+	logger.Info("Reloaded templates from ", devTemplatesDir)
+	return nil
+}
+
+// DevTemplatesMiddleware reloads the templates that changed on disk before the request, showing the error if they
+// fail to parse. Only used with -devtemplates.
+func DevTemplatesMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := reloadDevTemplates(); err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed reloading templates")
+			http.Error(w, "Failed reloading templates: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// the templates aren't swapped out in the middle of rendering the page
+		devTemplatesMU.RLock()
+		defer devTemplatesMU.RUnlock()
+
+		inner.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadDevTemplates(t *testing.T) {
+	defer func(tmpl *template.Template, sources []*templateSource, dir string) {
+		Templates, templateSources, devTemplatesDir, devTemplatesFingerprint = tmpl, sources, dir, ""
+	}(Templates, templateSources, devTemplatesDir)
+
+	devTemplatesDir = t.TempDir()
+	templateSources = []*templateSource{
+		{name: "page.html", path: "plugin/assets/page.html", contents: `{{define "page"}}embedded{{end}}`},
+		{name: "other.html", path: "plugin/assets/other.html", contents: `{{define "other"}}embedded{{end}}`},
+	}
+
+	render := func(name string) string {
+		var buf bytes.Buffer
+		if err := Templates.ExecuteTemplate(&buf, name, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	path := filepath.Join(devTemplatesDir, "plugin", "assets", "page.html")
+	write := func(contents string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// so the change is noticed even if the file system has a coarse mod time
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write(`{{define "page"}}from disk{{end}}`, time.Now().Add(-time.Hour))
+
+	if err := reloadDevTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if got := render("page"); got != "from disk" {
+		t.Errorf("got %q, expected the template on disk", got)
+	}
+	if got := render("other"); got != "embedded" {
+		t.Errorf("got %q, expected the embedded template when it's not on disk", got)
+	}
+
+	write(`{{define "page"}}changed{{end}}`, time.Now())
+	if err := reloadDevTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if got := render("page"); got != "changed" {
+		t.Errorf("got %q, expected the changed template", got)
+	}
+
+	write(`{{define "page"}}{{if}}{{end}}`, time.Now().Add(time.Hour))
+	if err := reloadDevTemplates(); err == nil {
+		t.Error("expected a broken template to fail to reload")
+	}
+	if got := render("page"); got != "changed" {
+		t.Errorf("got %q, expected the last working templates to be kept", got)
+	}
+}
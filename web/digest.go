@@ -0,0 +1,617 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/apiusage"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/botlabs-gg/yagpdb/v2/web/discorddata"
+	"github.com/mediocregopher/radix/v3"
+	"goji.io/pat"
+)
+
+const (
+	digestRetention    = time.Hour * 24 * 7 * 12
+	digestPollInterval = time.Hour
+
+	// the guilds with a digest channel or subscribers
+	keyDigestGuilds = "web_digest_guilds"
+)
+
+// The ways admins can subscribe to the weekly digest by DM
+const (
+	DigestModeAll = "all"
+
+	// DigestModeWarnings only sends the digests with something needing attention
+	DigestModeWarnings = "warnings"
+)
+
+var panelLogKeyDigestChannel = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+	Key:          "digest_channel_changed",
+	FormatString: "Changed the weekly digest channel to %s",
+})
+
+func keyDigestChannel(guildID int64) string {
+	return "web_digest_channel:" + discordgo.StrID(guildID)
+}
+
+// hash of user id -> digest mode
+func keyDigestSubscribers(guildID int64) string {
+	return "web_digest_subscribers:" + discordgo.StrID(guildID)
+}
+
+func keyDigest(guildID int64, id string) string {
+	return "web_digest:" + discordgo.StrID(guildID) + ":" + id
+}
+
+func keyGuildDigests(guildID int64) string {
+	return "web_guild_digests:" + discordgo.StrID(guildID)
+}
+
+func keyDigestSent(guildID int64, id string) string {
+	return "web_digest_sent:" + discordgo.StrID(guildID) + ":" + id
+}
+
+// Digest is the summary of a week of activity in a guild, delivered to the admins and kept around to be viewed on the web
+type Digest struct {
+	// ID is the date the week started on
+	ID        string           `json:"id"`
+	GuildID   int64            `json:"guild_id,string"`
+	GuildName string           `json:"guild_name"`
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Sections  []*DigestSection `json:"sections"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// HasWarnings returns true if any of the sections needs the attention of the admins
+func (d *Digest) HasWarnings() bool {
+	for _, v := range d.Sections {
+		if v.Warning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URL returns the link to the web version of the digest
+func (d *Digest) URL() string {
+	return BaseURL() + "/manage/" + discordgo.StrID(d.GuildID) + "/digests/" + d.ID
+}
+
+// digestPeriod returns the last full week before t, weeks start on monday 00:00 UTC
+func digestPeriod(t time.Time) (from, to time.Time) {
+	t = t.UTC()
+	sinceMonday := (int(t.Weekday()) + 6) % 7
+
+	to = time.Date(t.Year(), t.Month(), t.Day()-sinceMonday, 0, 0, 0, 0, time.UTC)
+	return to.AddDate(0, 0, -7), to
+}
+
+// BuildDigest summarizes the activity of the guild within the range, plugins failing to summarize are left out
+func BuildDigest(ctx context.Context, g *dstate.GuildSet, from, to time.Time) (*Digest, error) {
+	sections, err := coreDigestSections(g.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range common.Plugins {
+		p, ok := v.(PluginWithDigest)
+		if !ok {
+			continue
+		}
+
+		pluginSections, err := p.Digest(ctx, g.ID, from, to)
+		if err != nil {
+			logger.WithError(err).WithField("guild", g.ID).Errorf("failed building the %s digest section", v.PluginInfo().Name)
+			continue
+		}
+
+		sections = append(sections, pluginSections...)
+	}
+
+	d := &Digest{
+		ID:        from.UTC().Format("2006-01-02"),
+		GuildID:   g.ID,
+		GuildName: g.Name,
+		From:      from,
+		To:        to,
+		Sections:  []*DigestSection{},
+		CreatedAt: time.Now(),
+	}
+
+	for _, v := range sections {
+		if len(v.Lines) > 0 {
+			d.Sections = append(d.Sections, v)
+		}
+	}
+
+	return d, nil
+}
+
+// coreDigestSections summarizes the control panel changes and the api and webhook failures
+func coreDigestSections(guildID int64, from, to time.Time) ([]*DigestSection, error) {
+	authors, err := cplogs.CountEntriesByAuthor(guildID, from, to)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	changes := &DigestSection{Title: "Control panel changes", Link: "/cplogs"}
+	total := 0
+	for _, v := range authors {
+		total += v.Count
+	}
+
+	if total > 0 {
+		changes.Lines = append(changes.Lines, fmt.Sprintf("%d changes by %d people", total, len(authors)))
+		for i, v := range authors {
+			if i >= 5 {
+				changes.Lines = append(changes.Lines, fmt.Sprintf("and %d more", len(authors)-i))
+				break
+			}
+
+			changes.Lines = append(changes.Lines, fmt.Sprintf("%s: %d", v.AuthorUsername, v.Count))
+		}
+	}
+
+	// the usage is only kept for a week, so the start of the range might be missing
+	buckets, err := apiusage.GetUsage(guildID, int(apiusage.Retention.Hours()))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	var webhookErrors, webhookRatelimited, apiErrors int64
+	for _, b := range buckets {
+		if b.Start.Before(from) || !b.Start.Before(to) {
+			continue
+		}
+
+		webhookErrors += b.Count(apiusage.KindWebhook, apiusage.OutcomeError)
+		webhookRatelimited += b.Count(apiusage.KindWebhook, apiusage.OutcomeRatelimited)
+		apiErrors += b.Count(apiusage.KindAPI, apiusage.OutcomeError)
+	}
+
+	integrations := &DigestSection{Title: "Integrations", Link: "/api_usage"}
+	if webhookErrors > 0 {
+		integrations.Lines = append(integrations.Lines, fmt.Sprintf("%d webhook messages failed to send", webhookErrors))
+		integrations.Warning = true
+	}
+
+	if webhookRatelimited > 0 {
+		integrations.Lines = append(integrations.Lines, fmt.Sprintf("%d webhook messages were ratelimited", webhookRatelimited))
+		integrations.Warning = true
+	}
+
+	if apiErrors > 0 {
+		integrations.Lines = append(integrations.Lines, fmt.Sprintf("%d api requests failed", apiErrors))
+	}
+
+	return []*DigestSection{changes, integrations}, nil
+}
+
+// digestEmbed is the message version of the digest, linking to the web version
+func digestEmbed(d *Digest) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       "Weekly digest for " + d.GuildName,
+		URL:         d.URL(),
+		Description: fmt.Sprintf("%s to %s", d.From.Format("Jan 2"), d.To.AddDate(0, 0, -1).Format("Jan 2 2006")),
+		Timestamp:   d.CreatedAt.Format(time.RFC3339),
+		Color:       0x7289da,
+	}
+
+	if len(d.Sections) < 1 {
+		embed.Description += "\n\nNothing happened this week."
+	}
+
+	for i, v := range d.Sections {
+		if i >= 25 {
+			break
+		}
+
+		name := v.Title
+		if v.Warning {
+			name = "⚠️ " + name
+		}
+
+		value := ""
+		for _, line := range v.Lines {
+			value += line + "\n"
+		}
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  name,
+			Value: common.CutStringShort(value, 1000),
+		})
+	}
+
+	return embed
+}
+
+// GetDigestChannel returns the channel the digests are posted in, 0 if none
+func GetDigestChannel(guildID int64) (int64, error) {
+	var raw string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "GET", keyDigestChannel(guildID)))
+	if err != nil || raw == "" {
+		return 0, errors.WithStackIf(err)
+	}
+
+	return strconv.ParseInt(raw, 10, 64)
+}
+
+// SetDigestChannel sets the channel the digests are posted in, 0 to stop posting them
+func SetDigestChannel(guildID, channelID int64) error {
+	var err error
+	if channelID == 0 {
+		err = common.RedisPool.Do(radix.Cmd(nil, "DEL", keyDigestChannel(guildID)))
+	} else {
+		err = common.RedisPool.Do(radix.Cmd(nil, "SET", keyDigestChannel(guildID), discordgo.StrID(channelID)))
+	}
+
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	return updateDigestGuild(guildID)
+}
+
+// GetDigestSubscribers returns the digest mode by user id of the admins getting them in their DMs
+func GetDigestSubscribers(guildID int64) (map[int64]string, error) {
+	var raw map[string]string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGETALL", keyDigestSubscribers(guildID)))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	result := make(map[int64]string, len(raw))
+	for k, v := range raw {
+		userID, _ := strconv.ParseInt(k, 10, 64)
+		result[userID] = v
+	}
+
+	return result, nil
+}
+
+// SetDigestSubscription sets how the user gets the digests in their DMs, an empty mode unsubscribes them
+func SetDigestSubscription(guildID, userID int64, mode string) error {
+	var err error
+	if mode == "" {
+		err = common.RedisPool.Do(radix.Cmd(nil, "HDEL", keyDigestSubscribers(guildID), discordgo.StrID(userID)))
+	} else {
+		err = common.RedisPool.Do(radix.Cmd(nil, "HSET", keyDigestSubscribers(guildID), discordgo.StrID(userID), mode))
+	}
+
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	return updateDigestGuild(guildID)
+}
+
+// updateDigestGuild keeps track of the guilds the digests have to be built for
+func updateDigestGuild(guildID int64) error {
+	var channel string
+	var subscribers int
+	err := common.MultipleCmds(
+		radix.Cmd(&channel, "GET", keyDigestChannel(guildID)),
+		radix.Cmd(&subscribers, "HLEN", keyDigestSubscribers(guildID)),
+	)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	if channel == "" && subscribers < 1 {
+		err = common.RedisPool.Do(radix.Cmd(nil, "SREM", keyDigestGuilds, discordgo.StrID(guildID)))
+	} else {
+		err = common.RedisPool.Do(radix.Cmd(nil, "SADD", keyDigestGuilds, discordgo.StrID(guildID)))
+	}
+
+	return errors.WithStackIf(err)
+}
+
+func saveDigest(d *Digest) error {
+	serialized, err := json.Marshal(d)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	err = common.MultipleCmds(
+		radix.FlatCmd(nil, "SET", keyDigest(d.GuildID, d.ID), serialized, "EX", int(digestRetention.Seconds())),
+		radix.FlatCmd(nil, "ZADD", keyGuildDigests(d.GuildID), d.From.Unix(), d.ID),
+		radix.FlatCmd(nil, "ZREMRANGEBYSCORE", keyGuildDigests(d.GuildID), "-inf", time.Now().Add(-digestRetention).Unix()),
+	)
+	return errors.WithStackIf(err)
+}
+
+// GetDigest returns a previously delivered digest, nil if it doesn't exist or has expired
+func GetDigest(guildID int64, id string) (*Digest, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "GET", keyDigest(guildID, id)))
+	if err != nil || len(raw) == 0 {
+		return nil, errors.WithStackIf(err)
+	}
+
+	var d *Digest
+	err = json.Unmarshal(raw, &d)
+	return d, errors.WithStackIf(err)
+}
+
+// GetGuildDigests returns the digests delivered within the retention, newest first
+func GetGuildDigests(guildID int64) ([]*Digest, error) {
+	var ids []string
+	err := common.MultipleCmds(
+		radix.FlatCmd(nil, "ZREMRANGEBYSCORE", keyGuildDigests(guildID), "-inf", time.Now().Add(-digestRetention).Unix()),
+		radix.Cmd(&ids, "ZREVRANGE", keyGuildDigests(guildID), "0", "-1"),
+	)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	result := make([]*Digest, 0, len(ids))
+	for _, id := range ids {
+		d, err := GetDigest(guildID, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if d != nil {
+			result = append(result, d)
+		}
+	}
+
+	return result, nil
+}
+
+func runDigestLoop(ctx context.Context) {
+	ticker := time.NewTicker(digestPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sendDueDigests(time.Now())
+	}
+}
+
+// sendDueDigests delivers the digests of the last week that haven't been yet
+func sendDueDigests(now time.Time) {
+	from, to := digestPeriod(now)
+	id := from.Format("2006-01-02")
+
+	var guilds []int64
+	err := common.RedisPool.Do(radix.Cmd(&guilds, "SMEMBERS", keyDigestGuilds))
+	if err != nil {
+		logger.WithError(err).Error("failed retrieving digest guilds")
+		return
+	}
+
+	for _, guildID := range guilds {
+		// only one of the webservers delivers each digest
+		locked, err := common.TryLockRedisKey(keyDigestSent(guildID, id), int(time.Hour.Seconds()*24*8))
+		if err != nil {
+			logger.WithError(err).Error("failed locking digest")
+			continue
+		}
+
+		if !locked {
+			continue
+		}
+
+		err = sendDigest(context.Background(), guildID, from, to)
+		if err != nil {
+			logger.WithError(err).WithField("guild", guildID).Error("failed sending digest")
+		}
+	}
+}
+
+func sendDigest(ctx context.Context, guildID int64, from, to time.Time) error {
+	g, err := getGuild(ctx, guildID)
+	if err != nil {
+		return err
+	}
+
+	d, err := BuildDigest(ctx, g, from, to)
+	if err != nil {
+		return err
+	}
+
+	err = saveDigest(d)
+	if err != nil {
+		return err
+	}
+
+	embed := digestEmbed(d)
+
+	channelID, err := GetDigestChannel(guildID)
+	if err != nil {
+		return err
+	}
+
+	if channelID != 0 && g.GetChannel(channelID) != nil {
+		_, err = common.BotSession.ChannelMessageSendEmbed(channelID, embed)
+		if err != nil {
+			logger.WithError(err).WithField("guild", guildID).Warn("failed posting digest")
+		}
+	}
+
+	subscribers, err := GetDigestSubscribers(guildID)
+	if err != nil {
+		return err
+	}
+
+	for userID, mode := range subscribers {
+		if mode == DigestModeWarnings && !d.HasWarnings() {
+			continue
+		}
+
+		isAdmin, err := digestRecipientIsAdmin(ctx, g, userID)
+		if err != nil {
+			logger.WithError(err).WithField("guild", guildID).WithField("user", userID).Warn("failed checking digest recipient")
+			continue
+		}
+
+		if !isAdmin {
+			// they lost access since subscribing
+			if err = SetDigestSubscription(guildID, userID, ""); err != nil {
+				logger.WithError(err).WithField("guild", guildID).Error("failed unsubscribing from digest")
+			}
+			continue
+		}
+
+		channel, err := common.BotSession.UserChannelCreate(userID)
+		if err == nil {
+			_, err = common.BotSession.ChannelMessageSendEmbed(channel.ID, embed)
+		}
+
+		if err != nil {
+			logger.WithError(err).WithField("guild", guildID).WithField("user", userID).Warn("failed sending digest DM")
+		}
+	}
+
+	return nil
+}
+
+// digestRecipientIsAdmin returns true if the user still has write access to the control panel of the guild
+func digestRecipientIsAdmin(ctx context.Context, g *dstate.GuildSet, userID int64) (bool, error) {
+	m, err := discorddata.GetMember(ctx, g.ID, userID)
+	if err != nil {
+		if code, _ := common.DiscordError(err); code == discordgo.ErrCodeUnknownMember {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if m == nil {
+		return false, nil
+	}
+
+	gWithConnected := &common.GuildWithConnected{
+		UserGuild: &discordgo.UserGuild{
+			ID:          g.ID,
+			Owner:       userID == g.OwnerID,
+			Permissions: dstate.CalculatePermissions(&g.GuildState, g.Roles, nil, userID, m.Roles),
+		},
+		Connected: true,
+	}
+
+	_, write := GetUserAccessLevel(userID, gWithConnected, common.GetCoreServerConfCached(g.ID), StaticRoleProvider(m.Roles))
+	return write, nil
+}
+
+type DigestSubscriptionForm struct {
+	Mode string
+}
+
+type DigestChannelForm struct {
+	Channel int64 `valid:"channel,true"`
+}
+
+// HandleGetDigests handles GET /manage/:server/digests
+func HandleGetDigests(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+
+	digests, err := GetGuildDigests(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	channel, err := GetDigestChannel(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	subscribers, err := GetDigestSubscribers(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["DigestSubscription"] = ""
+	if user, ok := ctx.Value(common.ContextKeyUser).(*discordgo.User); ok {
+		tmpl["DigestSubscription"] = subscribers[user.ID]
+	}
+
+	tmpl["Digests"] = digests
+	tmpl["DigestChannel"] = channel
+	tmpl["DigestSubscriberCount"] = len(subscribers)
+	return tmpl, nil
+}
+
+// HandleGetDigest handles GET /manage/:server/digests/:digest, "preview" shows the last 7 days so far
+func HandleGetDigest(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	tmpl, err := HandleGetDigests(w, r)
+	if err != nil {
+		return tmpl, err
+	}
+
+	g := ContextGuild(ctx)
+
+	var d *Digest
+	if id := pat.Param(r, "digest"); id == "preview" {
+		d, err = BuildDigest(ctx, g, time.Now().AddDate(0, 0, -7), time.Now())
+	} else {
+		d, err = GetDigest(g.ID, id)
+	}
+
+	if err != nil {
+		return tmpl, err
+	}
+
+	if d == nil {
+		return tmpl, NewPublicError("Unknown digest, it might have expired")
+	}
+
+	tmpl["Digest"] = d
+	return tmpl, nil
+}
+
+// HandlePostDigestSubscription handles POST /manage/:server/digests/subscription
+func HandlePostDigestSubscription(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/digests")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*DigestSubscriptionForm)
+	if form.Mode != "" && form.Mode != DigestModeAll && form.Mode != DigestModeWarnings {
+		return tmpl, NewPublicError("Unknown digest mode")
+	}
+
+	err := SetDigestSubscription(g.ID, ContextUser(ctx).ID, form.Mode)
+	return tmpl, err
+}
+
+// HandlePostDigestChannel handles POST /manage/:server/digests/channel
+func HandlePostDigestChannel(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/digests")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*DigestChannelForm)
+	err := SetDigestChannel(g.ID, form.Channel)
+	if err != nil {
+		return tmpl, err
+	}
+
+	channelName := "none"
+	if c := g.GetChannel(form.Channel); c != nil {
+		channelName = "#" + c.Name
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyDigestChannel, &cplogs.Param{Type: cplogs.ParamTypeString, Value: channelName}))
+	return tmpl, nil
+}
@@ -0,0 +1,28 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestPeriod(t *testing.T) {
+	wantFrom := time.Date(2024, 5, 27, 0, 0, 0, 0, time.UTC)
+	wantTo := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+
+	cases := []time.Time{
+		// monday right as the week starts
+		time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 5, 13, 37, 0, 0, time.UTC),
+		// sunday night, the last day of the week
+		time.Date(2024, 6, 9, 23, 59, 59, 0, time.UTC),
+		// still sunday in UTC
+		time.Date(2024, 6, 10, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	}
+
+	for _, v := range cases {
+		from, to := digestPeriod(v)
+		if !from.Equal(wantFrom) || !to.Equal(wantTo) {
+			t.Errorf("%s: got %s - %s, expected %s - %s", v, from, to, wantFrom, wantTo)
+		}
+	}
+}
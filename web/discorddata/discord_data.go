@@ -1,6 +1,7 @@
 package discorddata
 
 import (
+	"context"
 	"sort"
 	"strconv"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"emperror.dev/errors"
 	"github.com/botlabs-gg/yagpdb/v2/bot/botrest"
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/tracing"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
 	"github.com/karlseguin/ccache"
@@ -66,13 +68,16 @@ func keyUserInfo(token string) string {
 }
 
 func GetUserInfo(token string, session *discordgo.Session) (*discordgo.User, error) {
-	result, err := applicationCache.Fetch(keyUserInfo(token), time.Minute*10, func() (interface{}, error) {
-		user, err := session.UserMe()
-		if err != nil {
-			return nil, errors.WithStackIf(err)
-		}
+	key := keyUserInfo(token)
+	result, err := applicationCache.Fetch(key, time.Minute*10, func() (interface{}, error) {
+		return flights.Do(key, func() (interface{}, error) {
+			user, err := session.UserMe()
+			if err != nil {
+				return nil, errors.WithStackIf(err)
+			}
 
-		return user, nil
+			return user, nil
+		})
 	})
 
 	if err != nil {
@@ -82,6 +87,18 @@ func GetUserInfo(token string, session *discordgo.Session) (*discordgo.User, err
 	return result.Value().(*discordgo.User), nil
 }
 
+// GetUserGuilds fetches the guilds of the user from discord, concurrent calls for the same token are collapsed into one
+func GetUserGuilds(token string, session *discordgo.Session) ([]*discordgo.UserGuild, error) {
+	result, err := flights.Do("user_guilds_token:"+token, func() (interface{}, error) {
+		return session.UserGuilds(0, 0, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]*discordgo.UserGuild), nil
+}
+
 func keyFullGuild(guildID int64) string {
 	return "full_guild:" + strconv.FormatInt(guildID, 10)
 }
@@ -91,50 +108,68 @@ func keyFullGuild(guildID int64) string {
 // 2. Botrest
 // 3. Discord api
 //
-// It will will also make sure channels are included in the event we fall back to the discord API
-func GetFullGuild(guildID int64) (*dstate.GuildSet, error) {
-	result, err := applicationCache.Fetch(keyFullGuild(guildID), time.Minute*10, func() (interface{}, error) {
-		gs, err := botrest.GetGuild(guildID)
-		if err != nil {
-			// fall back to discord API
-
-			guild, err := common.BotSession.Guild(guildID)
-			if err != nil {
-				return nil, err
-			}
+// It will will also make sure channels are included in the event we fall back to the discord API.
+// The request id in ctx is forwarded to botrest.
+func GetFullGuild(ctx context.Context, guildID int64) (*dstate.GuildSet, error) {
+	key := keyFullGuild(guildID)
+	result, err := applicationCache.Fetch(key, time.Minute*10, func() (interface{}, error) {
+		return flights.Do(key, func() (interface{}, error) {
+			return fetchFullGuild(ctx, guildID)
+		})
+	})
 
-			// we also need to include channels as they're not included in the guild response
-			channels, err := common.BotSession.GuildChannels(guildID)
-			if err != nil {
-				return nil, err
-			}
+	if err != nil {
+		return nil, err
+	}
 
-			// does the API guarantee the order? i actually have no idea lmao
-			sort.Sort(common.DiscordChannels(channels))
-			sort.Sort(common.DiscordRoles(guild.Roles))
-			guild.Channels = channels
+	return result.Value().(*dstate.GuildSet), nil
+}
 
-			gs = dstate.GuildSetFromGuild(guild)
-		}
+// EvictGuild removes the guild from the local cache of this process
+func EvictGuild(guildID int64) {
+	applicationCache.Delete(keyFullGuild(guildID))
+}
 
+func fetchFullGuild(ctx context.Context, guildID int64) (*dstate.GuildSet, error) {
+	gs, err := botrest.GetGuildContext(ctx, guildID)
+	if err == nil {
 		return gs, nil
-	})
+	}
+
+	// fall back to discord API
+	_, span := tracing.StartSpan(ctx, "discord GET /guilds/:guild", tracing.KindClient)
+	defer span.End()
 
+	guild, err := common.BotSession.Guild(guildID)
+	span.SetError(err)
 	if err != nil {
 		return nil, err
 	}
 
-	return result.Value().(*dstate.GuildSet), nil
+	// we also need to include channels as they're not included in the guild response
+	channels, err := common.BotSession.GuildChannels(guildID)
+	span.SetError(err)
+	if err != nil {
+		return nil, err
+	}
+
+	// does the API guarantee the order? i actually have no idea lmao
+	sort.Sort(common.DiscordChannels(channels))
+	sort.Sort(common.DiscordRoles(guild.Roles))
+	guild.Channels = channels
+
+	return dstate.GuildSetFromGuild(guild), nil
 }
 
 func keyGuildMember(guildID int64, userID int64) string {
 	return "guild_member:" + strconv.FormatInt(guildID, 10) + ":" + strconv.FormatInt(userID, 10)
 }
 
-func GetMember(guildID, userID int64) (*discordgo.Member, error) {
+// GetMember returns the member from the local cache, botrest or the discord api, the request id in ctx is forwarded to botrest
+func GetMember(ctx context.Context, guildID, userID int64) (*discordgo.Member, error) {
 	result, err := applicationCache.Fetch(keyGuildMember(guildID, userID), time.Minute*10, func() (interface{}, error) {
 
-		results, err := botrest.GetMembers(guildID, userID)
+		results, err := botrest.GetMembersContext(ctx, guildID, userID)
 
 		var m *discordgo.Member
 		if len(results) > 0 {
@@ -143,7 +178,10 @@ func GetMember(guildID, userID int64) (*discordgo.Member, error) {
 
 		if err != nil || m == nil {
 			// fallback to discord api
+			_, span := tracing.StartSpan(ctx, "discord GET /guilds/:guild/members/:user", tracing.KindClient)
 			m, err = common.BotSession.GuildMember(guildID, userID)
+			span.SetError(err)
+			span.End()
 			if err != nil {
 				return nil, err
 			}
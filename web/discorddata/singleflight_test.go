@@ -0,0 +1,54 @@
+package discorddata
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCollapsesCalls(t *testing.T) {
+	g := &flightGroup{}
+
+	var calls int32
+	release := make(chan bool)
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			})
+		}(i)
+	}
+
+	// give all the goroutines time to join the in flight call
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+
+	for i, v := range results {
+		if v != "value" {
+			t.Errorf("result %d: got %v", i, v)
+		}
+	}
+
+	// calls after the first one finished should not be collapsed into it
+	g.Do("key", func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	})
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
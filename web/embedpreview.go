@@ -0,0 +1,270 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+// the limits discord puts on embeds
+const (
+	embedTitleLimit       = 256
+	embedDescriptionLimit = 4096
+	embedFieldsLimit      = 25
+	embedFieldNameLimit   = 256
+	embedFieldValueLimit  = 1024
+	embedFooterLimit      = 2048
+	embedAuthorLimit      = 256
+	embedTotalLimit       = 6000
+
+	// discord puts up to this many inline fields next to each other
+	embedInlineFieldsPerRow = 3
+)
+
+// EmbedPreview is a embed laid out the way discord shows it, rendered by the cp_embed_preview template. Pages can
+// include it themselves with the embedPreview template func: {{template "cp_embed_preview" (embedPreview .Language .Embed)}}
+type EmbedPreview struct {
+	Embed *discordgo.MessageEmbed
+
+	// Guild resolves the mentions in the description and fields, it's nil for previews outside of a server
+	Guild *dstate.GuildSet
+
+	// Color is the css color of the bar on the left, empty for the default one
+	Color     string
+	Timestamp time.Time
+	FieldRows [][]*discordgo.MessageEmbedField
+
+	// Problems are the reasons discord would reject the embed, translated to the language of the preview
+	Problems []string
+}
+
+// NewEmbedPreview lays out the embed, checking it against the limits of discord
+func NewEmbedPreview(lang string, embed *discordgo.MessageEmbed) *EmbedPreview {
+	if embed == nil {
+		embed = &discordgo.MessageEmbed{}
+	}
+
+	preview := &EmbedPreview{Embed: embed}
+	if embed.Color > 0 {
+		preview.Color = fmt.Sprintf("#%06x", embed.Color&0xffffff)
+	}
+
+	if embed.Timestamp != "" {
+		if parsed, err := time.Parse(time.RFC3339, embed.Timestamp); err == nil {
+			preview.Timestamp = parsed
+		}
+	}
+
+	var row []*discordgo.MessageEmbedField
+	for _, v := range embed.Fields {
+		if v == nil {
+			continue
+		}
+
+		if !v.Inline || len(row) >= embedInlineFieldsPerRow {
+			if len(row) > 0 {
+				preview.FieldRows = append(preview.FieldRows, row)
+			}
+			row = nil
+		}
+
+		row = append(row, v)
+		if !v.Inline {
+			preview.FieldRows = append(preview.FieldRows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		preview.FieldRows = append(preview.FieldRows, row)
+	}
+
+	for _, v := range embedProblems(embed) {
+		preview.Problems = append(preview.Problems, v.Localize(lang))
+	}
+
+	return preview
+}
+
+// embedProblems returns the reasons discord would reject the embed
+func embedProblems(embed *discordgo.MessageEmbed) []*Message {
+	var problems []*Message
+	total := 0
+
+	checkLength := func(name, value string, limit int) {
+		length := utf8.RuneCountInString(value)
+		total += length
+		if length > limit {
+			problems = append(problems, Msg("%s is too long (%d/%d characters)", Msg(name), length, limit))
+		}
+	}
+
+	checkURL := func(name, value string) {
+		if value != "" && !isEmbedURL(value) {
+			problems = append(problems, Msg("%s has to be a http or https url", Msg(name)))
+		}
+	}
+
+	checkLength("Title", embed.Title, embedTitleLimit)
+	checkURL("Title url", embed.URL)
+	checkLength("Description", embed.Description, embedDescriptionLimit)
+
+	if embed.Author != nil {
+		checkLength("Author name", embed.Author.Name, embedAuthorLimit)
+		checkURL("Author url", embed.Author.URL)
+		checkURL("Author icon", embed.Author.IconURL)
+	}
+
+	if embed.Footer != nil {
+		checkLength("Footer", embed.Footer.Text, embedFooterLimit)
+		checkURL("Footer icon", embed.Footer.IconURL)
+	}
+
+	if embed.Image != nil {
+		checkURL("Image", embed.Image.URL)
+	}
+
+	if embed.Thumbnail != nil {
+		checkURL("Thumbnail", embed.Thumbnail.URL)
+	}
+
+	if embed.Timestamp != "" {
+		if _, err := time.Parse(time.RFC3339, embed.Timestamp); err != nil {
+			problems = append(problems, Msg("The timestamp has to be in the ISO 8601 format, e.g 2021-01-02T15:04:05Z"))
+		}
+	}
+
+	if len(embed.Fields) > embedFieldsLimit {
+		problems = append(problems, Msg("Too many fields (%d/%d)", len(embed.Fields), embedFieldsLimit))
+	}
+
+	for i, v := range embed.Fields {
+		if v == nil || strings.TrimSpace(v.Name) == "" || strings.TrimSpace(v.Value) == "" {
+			problems = append(problems, Msg("Field %d needs a name and a value", i+1))
+			continue
+		}
+
+		checkLength("Field name", v.Name, embedFieldNameLimit)
+		checkLength("Field value", v.Value, embedFieldValueLimit)
+	}
+
+	if total > embedTotalLimit {
+		problems = append(problems, Msg("The embed is too long, all the text in it together can be at most %d characters (%d)", embedTotalLimit, total))
+	}
+
+	if total == 0 && (embed.Image == nil || embed.Image.URL == "") && (embed.Thumbnail == nil || embed.Thumbnail.URL == "") {
+		problems = append(problems, Msg("The embed is empty"))
+	}
+
+	return problems
+}
+
+func isEmbedURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	// attachment:// refers to files sent along with the message
+	return (parsed.Scheme == "http" || parsed.Scheme == "https" || parsed.Scheme == "attachment") && parsed.Host != ""
+}
+
+// parseEmbedForm reads the embed from the embed form value, a embed in the json format of discord, or from the fields
+// of a embed form: title, url, description, color, timestamp, author_name, author_url, author_icon_url, footer_text,
+// footer_icon_url, image_url, thumbnail_url and fields, a json array of the fields.
+func parseEmbedForm(r *http.Request) (*discordgo.MessageEmbed, error) {
+	if raw := r.FormValue("embed"); raw != "" {
+		var embed *discordgo.MessageEmbed
+		if err := json.Unmarshal([]byte(raw), &embed); err != nil {
+			return nil, Msg("Invalid embed json: %s", err.Error())
+		}
+
+		return embed, nil
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       r.FormValue("title"),
+		URL:         r.FormValue("url"),
+		Description: r.FormValue("description"),
+		Timestamp:   r.FormValue("timestamp"),
+	}
+
+	if raw := strings.TrimPrefix(strings.TrimSpace(r.FormValue("color")), "#"); raw != "" {
+		color, err := strconv.ParseInt(raw, 16, 32)
+		if err != nil || color < 0 || color > 0xffffff {
+			return nil, Msg("Invalid color, should be a hex color like #7289da")
+		}
+		embed.Color = int(color)
+	}
+
+	if name, icon := r.FormValue("author_name"), r.FormValue("author_icon_url"); name != "" || icon != "" {
+		embed.Author = &discordgo.MessageEmbedAuthor{Name: name, URL: r.FormValue("author_url"), IconURL: icon}
+	}
+
+	if text, icon := r.FormValue("footer_text"), r.FormValue("footer_icon_url"); text != "" || icon != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: text, IconURL: icon}
+	}
+
+	if v := r.FormValue("image_url"); v != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: v}
+	}
+
+	if v := r.FormValue("thumbnail_url"); v != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: v}
+	}
+
+	if raw := r.FormValue("fields"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &embed.Fields); err != nil {
+			return nil, Msg("Invalid fields json: %s", err.Error())
+		}
+	}
+
+	return embed, nil
+}
+
+// HandleEmbedPreview handles POST /manage/:server/embed_preview, responding with the preview of the embed in the form
+// (see parseEmbedForm) for the editors of embeds to show, forms with data-embed-preview="<selector>" do so on their own.
+// Embeds discord would reject are previewed along with the reasons, the form not being a embed at all is a 400.
+func HandleEmbedPreview(w http.ResponseWriter, r *http.Request) {
+	lang := RequestLanguage(r)
+
+	status := http.StatusOK
+	var preview *EmbedPreview
+	if embed, err := parseEmbedForm(r); err != nil {
+		status = http.StatusBadRequest
+		preview = &EmbedPreview{Embed: &discordgo.MessageEmbed{}, Problems: []string{Translatef(lang, "%s", err)}}
+	} else {
+		preview = NewEmbedPreview(lang, embed)
+	}
+	preview.Guild, _ = r.Context().Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet)
+
+	var buf bytes.Buffer
+	if err := executeTemplateTraced(r, &buf, "cp_embed_preview", preview); err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed rendering embed preview")
+		http.Error(w, Translate(lang, "Failed rendering the preview"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// tmplEmbedPreview is the embedPreview template func, previews in pages without a language are in the default one
+func tmplEmbedPreview(lang interface{}, embed *discordgo.MessageEmbed) *EmbedPreview {
+	code, _ := lang.(string)
+	if code == "" {
+		code = defaultLanguage()
+	}
+
+	return NewEmbedPreview(code, embed)
+}
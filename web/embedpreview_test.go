@@ -0,0 +1,100 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/frontend"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestEmbedPreviewFieldRows(t *testing.T) {
+	field := func(inline bool) *discordgo.MessageEmbedField {
+		return &discordgo.MessageEmbedField{Name: "a", Value: "b", Inline: inline}
+	}
+
+	embed := &discordgo.MessageEmbed{Title: "t", Fields: []*discordgo.MessageEmbedField{
+		field(true), field(true), field(true), field(true), field(false), field(true), nil, field(true),
+	}}
+
+	preview := NewEmbedPreview(SourceLanguage, embed)
+
+	var sizes []int
+	for _, v := range preview.FieldRows {
+		sizes = append(sizes, len(v))
+	}
+
+	if len(sizes) != 4 || sizes[0] != 3 || sizes[1] != 1 || sizes[2] != 1 || sizes[3] != 2 {
+		t.Errorf("expected rows of 3, 1, 1 and 2 fields, got %v", sizes)
+	}
+}
+
+func TestEmbedProblems(t *testing.T) {
+	if problems := NewEmbedPreview(SourceLanguage, &discordgo.MessageEmbed{Description: "hi", Color: 0x7289da}).Problems; len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     strings.Repeat("a", embedTitleLimit+1),
+		URL:       "javascript:alert(1)",
+		Timestamp: "yesterday",
+		Fields:    []*discordgo.MessageEmbedField{{Name: "name"}},
+	}
+
+	expected := []string{
+		"Title is too long (257/256 characters)",
+		"Title url has to be a http or https url",
+		"The timestamp has to be in the ISO 8601 format, e.g 2021-01-02T15:04:05Z",
+		"Field 1 needs a name and a value",
+	}
+
+	problems := NewEmbedPreview(SourceLanguage, embed).Problems
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got problems %q, expected %q", problems, expected)
+	}
+
+	if problems := NewEmbedPreview(SourceLanguage, nil).Problems; len(problems) != 1 || problems[0] != "The embed is empty" {
+		t.Errorf("expected a empty embed to be a problem, got %q", problems)
+	}
+}
+
+func TestHandleEmbedPreview(t *testing.T) {
+	defer func(old *template.Template) { Templates = old }(Templates)
+	Templates = template.Must(template.New("").Funcs(templateFuncs).ParseFS(frontend.CoreTemplates, "templates/cp_embed_preview.html"))
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/manage/1/embed_preview", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		HandleEmbedPreview(w, r)
+		return w
+	}
+
+	w := post(url.Values{
+		"title":       {"<b>Welcome</b>"},
+		"description": {"**Read** the rules"},
+		"color":       {"#7289da"},
+		"footer_text": {"footer"},
+		"fields":      {`[{"name":"Rules","value":"Be nice","inline":true}]`},
+	})
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, body)
+	}
+
+	for _, v := range []string{"&lt;b&gt;Welcome&lt;/b&gt;", "<strong>Read</strong> the rules", "border-left-color: #7289da", "yag-embed-field-inline", "Be nice", "footer"} {
+		if !strings.Contains(body, v) {
+			t.Errorf("expected %q in the preview, got %s", v, body)
+		}
+	}
+
+	w = post(url.Values{"embed": {"{not json"}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid embed json") {
+		t.Errorf("expected invalid json to be a 400 with the reason, got %d: %s", w.Code, w.Body.String())
+	}
+}
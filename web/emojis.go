@@ -0,0 +1,465 @@
+package web
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+const (
+	// discord's limit on the size of an emoji image
+	maxEmojiSize = 256000
+
+	// discord rate limits emoji creation heavily, so uploads are done in batches
+	maxEmojisPerUpload = 25
+
+	maxEmojiZipSize = 25 << 20
+
+	// the zip file or the images, with room for the rest of the form
+	maxEmojiUploadSize = maxEmojiZipSize + 1<<20
+)
+
+var (
+	panelLogKeyEmojisUploaded = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "emojis_uploaded",
+		FormatString: "Uploaded %d emojis",
+	})
+	panelLogKeyEmojisRenamed = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "emojis_renamed",
+		FormatString: "Renamed %d emojis",
+	})
+	panelLogKeyEmojisDeleted = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "emojis_deleted",
+		FormatString: "Deleted %d emojis",
+	})
+)
+
+var emojiExportClient = &http.Client{Timeout: time.Second * 10}
+
+// EmojiSlots returns how many static and how many animated emojis a server with the boost level can have
+func EmojiSlots(tier discordgo.PremiumTier) int {
+	switch tier {
+	case discordgo.PremiumTier1:
+		return 100
+	case discordgo.PremiumTier2:
+		return 150
+	case discordgo.PremiumTier3:
+		return 250
+	}
+
+	return 50
+}
+
+// ValidEmojiName returns true if discord accepts the name for a custom emoji
+func ValidEmojiName(name string) bool {
+	if len(name) < 2 || len(name) > 32 {
+		return false
+	}
+
+	return strings.IndexFunc(name, func(r rune) bool { return !isEmojiNameRune(r) }) == -1
+}
+
+func isEmojiNameRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// emojiNameFromFilename turns the name of a uploaded file into a valid emoji name
+func emojiNameFromFilename(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	name = strings.Map(func(r rune) rune {
+		if isEmojiNameRune(r) {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	for len(name) < 2 {
+		name += "_"
+	}
+
+	return name
+}
+
+// EmojiUsage is how many of the emoji slots of a server are used
+type EmojiUsage struct {
+	Slots    int
+	Static   int
+	Animated int
+}
+
+func (u *EmojiUsage) StaticLeft() int {
+	return u.Slots - u.Static
+}
+
+func (u *EmojiUsage) AnimatedLeft() int {
+	return u.Slots - u.Animated
+}
+
+func emojiUsage(guild *discordgo.Guild) *EmojiUsage {
+	usage := &EmojiUsage{Slots: EmojiSlots(guild.PremiumTier)}
+	for _, e := range guild.Emojis {
+		if e.Animated {
+			usage.Animated++
+		} else {
+			usage.Static++
+		}
+	}
+
+	return usage
+}
+
+// fetchEmojiGuild retrieves the guild from discord, the state doesn't track the boost level and might lag behind
+// right after a bulk change
+func fetchEmojiGuild(guildID int64) (*discordgo.Guild, error) {
+	return common.BotSession.Guild(guildID)
+}
+
+func setEmojiTemplateData(tmpl TemplateData, guild *discordgo.Guild) {
+	tmpl["Emojis"] = guild.Emojis
+	tmpl["EmojiUsage"] = emojiUsage(guild)
+	tmpl["MaxEmojisPerUpload"] = maxEmojisPerUpload
+}
+
+// HandleGetEmojis handles GET /manage/:server/emojis
+func HandleGetEmojis(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, tmpl := GetBaseCPContextData(r.Context())
+
+	guild, err := fetchEmojiGuild(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	setEmojiTemplateData(tmpl, guild)
+	return tmpl, nil
+}
+
+type emojiUpload struct {
+	Name  string
+	Image *ImageUpload
+}
+
+// readEmojiUploads collects the emojis uploaded as images and inside zip files, skipping files that aren't valid emojis
+func readEmojiUploads(form *multipart.Form) (uploads []*emojiUpload, skipped []string, err error) {
+	for _, fh := range form.File["Emojis"] {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		image, err := DecodeImageUpload(f, maxEmojiSize)
+		f.Close()
+		if err != nil {
+			if _, ok := err.(*PublicError); ok {
+				skipped = append(skipped, fh.Filename+": "+err.Error())
+				continue
+			}
+			return nil, nil, err
+		}
+
+		uploads = append(uploads, &emojiUpload{Name: emojiNameFromFilename(fh.Filename), Image: image})
+	}
+
+	for _, fh := range form.File["Zip"] {
+		fromZip, skippedZip, err := readEmojiZip(fh)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		uploads = append(uploads, fromZip...)
+		skipped = append(skipped, skippedZip...)
+	}
+
+	return uploads, skipped, nil
+}
+
+func readEmojiZip(fh *multipart.FileHeader) (uploads []*emojiUpload, skipped []string, err error) {
+	if fh.Size > maxEmojiZipSize {
+		return nil, nil, NewPublicError(fh.Filename, " is too big, the max is 25MB")
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	zr, err := zip.NewReader(f, fh.Size)
+	if err != nil {
+		return nil, nil, NewPublicError(fh.Filename, " is not a valid zip file")
+	}
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX/") {
+			continue
+		}
+
+		switch strings.ToLower(path.Ext(zf.Name)) {
+		case ".png", ".jpg", ".jpeg", ".gif":
+		default:
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			skipped = append(skipped, zf.Name+": "+err.Error())
+			continue
+		}
+
+		image, err := DecodeImageUpload(rc, maxEmojiSize)
+		rc.Close()
+		if err != nil {
+			if _, ok := err.(*PublicError); ok {
+				skipped = append(skipped, zf.Name+": "+err.Error())
+				continue
+			}
+			return nil, nil, err
+		}
+
+		uploads = append(uploads, &emojiUpload{Name: emojiNameFromFilename(zf.Name), Image: image})
+	}
+
+	return uploads, skipped, nil
+}
+
+// HandlePostEmojiUpload handles POST /manage/:server/emojis/upload, creating emojis from the uploaded images and zip files
+func HandlePostEmojiUpload(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/emojis")
+
+	err := r.ParseMultipartForm(maxEmojiSize)
+	if err != nil {
+		if isBodyTooLarge(r, err) {
+			return tmpl, bodyTooLargeError(r)
+		}
+
+		return tmpl, NewPublicError("Failed reading the upload")
+	}
+
+	uploads, skipped, err := readEmojiUploads(r.MultipartForm)
+	if err != nil {
+		return tmpl, err
+	}
+
+	for _, v := range skipped {
+		tmpl.AddAlerts(WarningAlert("Skipped ", v))
+	}
+
+	if len(uploads) < 1 {
+		return tmpl, NewPublicError("No images found in the upload")
+	}
+
+	guild, err := fetchEmojiGuild(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+	usage := emojiUsage(guild)
+
+	created := 0
+	for i, upload := range uploads {
+		if created >= maxEmojisPerUpload {
+			tmpl.AddAlerts(WarningAlert(fmt.Sprintf("Only %d emojis can be uploaded at a time, %d were left out", maxEmojisPerUpload, len(uploads)-i)))
+			break
+		}
+
+		// discord treats every gif as animated
+		animated := upload.Image.Format == "gif"
+		if (animated && usage.AnimatedLeft() < 1) || (!animated && usage.StaticLeft() < 1) {
+			tmpl.AddAlerts(WarningAlert("Skipped ", upload.Name, ": no free emoji slots left"))
+			continue
+		}
+
+		_, err := common.BotSession.GuildEmojiCreate(g.ID, upload.Name, upload.Image.DataURI(), nil)
+		if err != nil {
+			if common.IsDiscordErr(err, discordgo.ErrCodeMaximumEmojisReached) {
+				tmpl.AddAlerts(WarningAlert("Skipped ", upload.Name, ": no free emoji slots left"))
+				continue
+			}
+
+			if code, msg := common.DiscordError(err); code != 0 {
+				tmpl.AddAlerts(ErrorAlert("Failed uploading ", upload.Name, ": ", msg))
+				continue
+			}
+
+			return tmpl, err
+		}
+
+		if animated {
+			usage.Animated++
+		} else {
+			usage.Static++
+		}
+		created++
+	}
+
+	if created > 0 {
+		tmpl.AddAlerts(SucessAlert(fmt.Sprintf("Uploaded %d emojis", created)))
+		go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyEmojisUploaded, &cplogs.Param{Type: cplogs.ParamTypeInt, Value: int64(created)}))
+	}
+
+	return tmpl, nil
+}
+
+// EmojiBulkEditForm holds the new names of the emojis and the ones to delete
+type EmojiBulkEditForm struct {
+	Emojis []*EmojiEditForm
+}
+
+type EmojiEditForm struct {
+	ID     int64
+	Name   string
+	Delete bool
+}
+
+// HandlePostEmojiBulkEdit handles POST /manage/:server/emojis/edit, renaming and deleting emojis
+func HandlePostEmojiBulkEdit(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/emojis")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*EmojiBulkEditForm)
+
+	guild, err := fetchEmojiGuild(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	current := make(map[int64]*discordgo.Emoji)
+	for _, e := range guild.Emojis {
+		current[e.ID] = e
+	}
+
+	renamed, deleted := 0, 0
+	for _, edit := range form.Emojis {
+		if edit == nil {
+			continue
+		}
+
+		emoji := current[edit.ID]
+		if emoji == nil || emoji.Managed {
+			// deleted in the meantime, or managed by an integration
+			continue
+		}
+
+		if edit.Delete {
+			err = common.BotSession.GuildEmojiDelete(g.ID, emoji.ID)
+			if err != nil {
+				break
+			}
+			deleted++
+			continue
+		}
+
+		if edit.Name == emoji.Name {
+			continue
+		}
+
+		if !ValidEmojiName(edit.Name) {
+			tmpl.AddAlerts(ErrorAlert("Invalid name for ", emoji.Name, ": emoji names are 2 to 32 letters, numbers and underscores"))
+			continue
+		}
+
+		_, err = common.BotSession.GuildEmojiEdit(g.ID, emoji.ID, edit.Name, emoji.Roles)
+		if err != nil {
+			break
+		}
+		renamed++
+	}
+
+	if renamed > 0 {
+		go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyEmojisRenamed, &cplogs.Param{Type: cplogs.ParamTypeInt, Value: int64(renamed)}))
+	}
+	if deleted > 0 {
+		go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyEmojisDeleted, &cplogs.Param{Type: cplogs.ParamTypeInt, Value: int64(deleted)}))
+	}
+
+	return tmpl, err
+}
+
+// emojiExportFilename returns a unique filename for the emoji in the export, importing the zip again keeps the names
+func emojiExportFilename(e *discordgo.Emoji, used map[string]bool) string {
+	ext := ".png"
+	if e.Animated {
+		ext = ".gif"
+	}
+
+	name := e.Name
+	for i := 2; used[name]; i++ {
+		name = e.Name + "_" + strconv.Itoa(i)
+	}
+	used[name] = true
+
+	return name + ext
+}
+
+// HandleExportEmojis handles GET /manage/:server/emojis/export, a zip of all the emojis of the server for backup
+func HandleExportEmojis(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	g := ContextGuild(ctx)
+
+	guild, err := fetchEmojiGuild(g.ID)
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("failed retrieving emojis for export")
+		http.Error(w, "Failed retrieving the emojis", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"emojis-%d.zip\"", g.ID))
+
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+	for _, e := range guild.Emojis {
+		err = writeEmojiExport(zw, e, emojiExportFilename(e, used))
+		if err != nil {
+			// the response is already underway, so the best we can do is leave it out
+			CtxLogger(ctx).WithError(err).WithField("emoji", e.ID).Error("failed exporting emoji")
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("failed finishing emoji export")
+	}
+}
+
+func writeEmojiExport(zw *zip.Writer, e *discordgo.Emoji, filename string) error {
+	ext := "png"
+	if e.Animated {
+		ext = "gif"
+	}
+
+	resp, err := emojiExportClient.Get(discordgo.EndpointCDN + "emojis/" + discordgo.StrID(e.ID) + "." + ext)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from the cdn: %d", resp.StatusCode)
+	}
+
+	f, err := zw.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, io.LimitReader(resp.Body, maxEmojiSize*2))
+	return err
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestEmojiNameFromFilename(t *testing.T) {
+	cases := map[string]string{
+		"pepe.png":                 "pepe",
+		"party parrot.gif":         "party_parrot",
+		"export/kek_2.png":         "kek_2",
+		"C:\\Users\\me\\wave.jpeg": "wave",
+		"a.png":                    "a_",
+		"ünicode.png":              "_nicode",
+		"this_name_is_way_too_long_for_discord.png": "this_name_is_way_too_long_for_di",
+	}
+
+	for filename, expected := range cases {
+		name := emojiNameFromFilename(filename)
+		if name != expected {
+			t.Errorf("emojiNameFromFilename(%q) = %q, expected %q", filename, name, expected)
+		}
+
+		if !ValidEmojiName(name) {
+			t.Errorf("emojiNameFromFilename(%q) returned the invalid name %q", filename, name)
+		}
+	}
+}
+
+func TestValidEmojiName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"ok":        true,
+		"pog_123":   true,
+		"x":         false,
+		"has space": false,
+		"dash-ed":   false,
+		"":          false,
+	} {
+		if ValidEmojiName(name) != valid {
+			t.Errorf("ValidEmojiName(%q) != %t", name, valid)
+		}
+	}
+}
+
+func TestEmojiExportFilename(t *testing.T) {
+	used := make(map[string]bool)
+
+	emojis := []*discordgo.Emoji{
+		{ID: 1, Name: "pepe"},
+		{ID: 2, Name: "pepe", Animated: true},
+		{ID: 3, Name: "pepe"},
+		{ID: 4, Name: "kek"},
+	}
+	expected := []string{"pepe.png", "pepe_2.gif", "pepe_3.png", "kek.png"}
+
+	for i, e := range emojis {
+		if filename := emojiExportFilename(e, used); filename != expected[i] {
+			t.Errorf("emoji %d: got %q, expected %q", e.ID, filename, expected[i])
+		}
+	}
+}
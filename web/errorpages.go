@@ -0,0 +1,119 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"goji.io/middleware"
+)
+
+var errTemplatesNotLoaded = errors.New("the error page templates aren't loaded")
+
+// the messages shown on error pages rendered without one
+var defaultErrorMessages = map[int]string{
+	http.StatusNotFound:            "The page you were looking for doesn't exist, or it was moved.",
+	http.StatusForbidden:           "You don't have access to this page.",
+	http.StatusInternalServerError: "An unexpected error occurred, it has been logged. Try again in a bit, and contact support if it keeps happening.",
+}
+
+func defaultErrorMessage(status int) *Message {
+	if msg, ok := defaultErrorMessages[status]; ok {
+		return Msg(msg)
+	}
+
+	return Msg(http.StatusText(status))
+}
+
+// RenderErrorPage responds with the error page for the status, or a json error for api routes. The page has the nav of
+// the control panel and the request id, so users can include it when contacting support. The default message of the
+// status is shown if msg is nil.
+func RenderErrorPage(w http.ResponseWriter, r *http.Request, status int, msg *Message) {
+	if msg == nil {
+		msg = defaultErrorMessage(status)
+	}
+
+	lang := RequestLanguage(r)
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	if wantsJSONError(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		LogIgnoreErr(json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": msg.Localize(lang), "request_id": RequestID(r)}))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := renderErrorPage(&buf, r, status, msg, lang); err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("Failed executing error page template")
+		http.Error(w, Translate(lang, http.StatusText(status)), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// renderErrorPage renders cp_error with the template data of the request, requests that panicked before it was set up
+// get the base template data. The standalone error_page, which needs nothing but the error, is used if that fails.
+func renderErrorPage(buf *bytes.Buffer, r *http.Request, status int, msg *Message, lang string) error {
+	if Templates == nil {
+		return errTemplatesNotLoaded
+	}
+
+	errorData := map[string]interface{}{
+		"ErrorStatus":  status,
+		"ErrorTitle":   Translate(lang, http.StatusText(status)),
+		"ErrorMessage": msg.Localize(lang),
+		"RequestID":    RequestID(r),
+	}
+
+	if Templates.Lookup("cp_error") != nil {
+		tmpl, ok := r.Context().Value(common.ContextKeyTemplateData).(TemplateData)
+		if !ok {
+			tmpl = baseTemplateData(r.RequestURI, cookieEnabled(r, "light_theme"), cookieEnabled(r, "sidebar_collapsed"))
+			tmpl.SetLanguage(lang)
+		}
+
+		for k, v := range errorData {
+			tmpl[k] = v
+		}
+
+		err := executeTemplateTraced(r, buf, "cp_error", tmpl)
+		if err == nil {
+			return nil
+		}
+
+		CtxLogger(r.Context()).WithError(err).Error("Failed executing cp_error template, falling back to the standalone error page")
+		buf.Reset()
+	}
+
+	if Templates.Lookup("error_page") == nil {
+		return errTemplatesNotLoaded
+	}
+
+	errorData["Language"] = lang
+	return Templates.ExecuteTemplate(buf, "error_page", errorData)
+}
+
+// NotFoundHandler renders the 404 page
+var NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	RenderErrorPage(w, r, http.StatusNotFound, nil)
+})
+
+// NotFoundMiddleware serves NotFoundHandler for the requests that didn't match any route of the mux it's used in,
+// instead of the plain text response of goji. Submuxes need it too, as requests matching the prefix of one don't get
+// back to the root mux.
+func NotFoundMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if middleware.Handler(r.Context()) == nil {
+			NotFoundHandler.ServeHTTP(w, r)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"goji.io"
+	"goji.io/pat"
+)
+
+func TestRenderErrorPage(t *testing.T) {
+	defer func(tmpl *template.Template) { Templates = tmpl }(Templates)
+
+	render := func(templates string, r *http.Request) *httptest.ResponseRecorder {
+		Templates = template.Must(template.New("").Funcs(templateFuncs).Parse(templates))
+		w := httptest.NewRecorder()
+		RenderErrorPage(w, r, http.StatusNotFound, nil)
+		return w
+	}
+
+	request := func() *http.Request {
+		r := httptest.NewRequest("GET", "/manage/1/nope", nil)
+		ctx := context.WithValue(r.Context(), common.ContextKeyRequestID, "abc")
+		ctx = SetContextTemplateData(ctx, map[string]interface{}{"Nav": "nav"})
+		return r.WithContext(ctx)
+	}
+
+	pages := `{{define "cp_error"}}{{.Nav}}|{{.ErrorStatus}}|{{.ErrorMessage}}|{{.RequestID}}{{end}}` +
+		`{{define "error_page"}}standalone|{{.ErrorStatus}}|{{.RequestID}}{{end}}`
+
+	w := render(pages, request())
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("expected a 404 html page, got %d with content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if want := "nav|404|" + template.HTMLEscapeString(defaultErrorMessages[http.StatusNotFound]) + "|abc"; w.Body.String() != want {
+		t.Errorf("got %q, want %q", w.Body.String(), want)
+	}
+
+	// calling a string fails halfway through the page
+	broken := `{{define "cp_error"}}{{.Nav}}{{call .Nav}}{{end}}` +
+		`{{define "error_page"}}standalone|{{.ErrorStatus}}|{{.RequestID}}{{end}}`
+
+	w = render(broken, request())
+	if w.Code != http.StatusNotFound || w.Body.String() != "standalone|404|abc" {
+		t.Errorf("expected the standalone page when cp_error fails, got %d: %q", w.Code, w.Body.String())
+	}
+
+	r := request()
+	r.Header.Set("Accept", "application/json")
+	w = render(pages, r)
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected a json error, got %q: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusNotFound || body["ok"] != false || body["request_id"] != "abc" {
+		t.Errorf("unexpected json error %d: %v", w.Code, body)
+	}
+}
+
+func TestNotFoundMiddleware(t *testing.T) {
+	mux := goji.NewMux()
+	mux.Use(NotFoundMiddleware)
+	mux.HandleFunc(pat.Get("/exists"), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("found"))
+	})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/exists", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "found" {
+		t.Errorf("expected the route to be served, got %d: %q", w.Code, w.Body.String())
+	}
+
+	r := httptest.NewRequest("GET", "/nope", nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"ok":false`) {
+		t.Errorf("expected the not found error, got %d: %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/sentryhook"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+)
+
+// requestSentryHub returns a hub with the request, guild and user attached to its scope,
+// or nil if sentry is not configured (yagpdb.sentry_dsn)
+func requestSentryHub(r *http.Request) *sentry.Hub {
+	hub := sentry.CurrentHub().Clone()
+	if hub == nil || hub.Client() == nil {
+		return nil
+	}
+
+	ctx := r.Context()
+	hub.ConfigureScope(func(s *sentry.Scope) {
+		// cookies and auth headers are only included with SendDefaultPII
+		s.SetRequest(r)
+		s.SetTag("service", "web")
+		if id := RequestID(r); id != "" {
+			s.SetTag("request_id", id)
+		}
+
+		if user, ok := ctx.Value(common.ContextKeyUser).(*discordgo.User); ok {
+			s.SetUser(sentry.User{ID: discordgo.StrID(user.ID)})
+		}
+
+		if guild, ok := ctx.Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet); ok {
+			s.SetTag("guild_id", strconv.FormatInt(guild.ID, 10))
+		}
+	})
+
+	return hub
+}
+
+// reportRequestError sends a error that occurred while handling the request to sentry, returning the logger to log it with
+// so the sentry log hook doesn't send it a second time. Public errors are caused by the user and not reported.
+func reportRequestError(r *http.Request, err error) *logrus.Entry {
+	l := CtxLogger(r.Context()).WithError(err)
+	if _, ok := err.(*PublicError); ok {
+		return l.WithField(sentryhook.ReportedField, false)
+	}
+
+	hub := requestSentryHub(r)
+	if hub == nil {
+		return l
+	}
+
+	hub.CaptureException(err)
+	return l.WithField(sentryhook.ReportedField, true)
+}
+
+// reportRequestPanic sends a panic recovered while handling the request to sentry
+func reportRequestPanic(r *http.Request, v interface{}) *logrus.Entry {
+	l := CtxLogger(r.Context())
+
+	hub := requestSentryHub(r)
+	if hub == nil {
+		return l
+	}
+
+	if err, ok := v.(error); ok {
+		hub.CaptureException(err)
+	} else {
+		hub.CaptureException(fmt.Errorf("panic: %v", v))
+	}
+
+	return l.WithField(sentryhook.ReportedField, true)
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/sentryhook"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/getsentry/sentry-go"
+)
+
+// testSentryTransport keeps the events instead of sending them
+type testSentryTransport struct {
+	events []*sentry.Event
+}
+
+func (t *testSentryTransport) Flush(timeout time.Duration) bool       { return true }
+func (t *testSentryTransport) Configure(options sentry.ClientOptions) {}
+func (t *testSentryTransport) SendEvent(event *sentry.Event)          { t.events = append(t.events, event) }
+
+// withTestSentry binds a client sending to the returned transport, returning a func restoring the previous client
+func withTestSentry(t *testing.T) (*testSentryTransport, func()) {
+	transport := &testSentryTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Dsn: "https://key@sentry.example.com/1", Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := sentry.CurrentHub()
+	old := hub.Client()
+	hub.BindClient(client)
+	return transport, func() { hub.BindClient(old) }
+}
+
+func errorReportingTestRequest() *http.Request {
+	r := httptest.NewRequest("POST", "/manage/10/core", nil)
+	ctx := context.WithValue(r.Context(), common.ContextKeyRequestID, "abc")
+	ctx = context.WithValue(ctx, common.ContextKeyUser, &discordgo.User{ID: 3})
+	return r.WithContext(ctx)
+}
+
+func TestReportRequestError(t *testing.T) {
+	r := errorReportingTestRequest()
+
+	// nothing to report to without sentry, the log hook handles it as before
+	if _, ok := reportRequestError(r, errors.New("no sentry")).Data[sentryhook.ReportedField]; ok {
+		t.Error("expected the entry to not be marked as reported without sentry")
+	}
+
+	transport, restore := withTestSentry(t)
+	defer restore()
+
+	l := reportRequestError(r, &PublicError{msg: "bad input"})
+	if reported, ok := l.Data[sentryhook.ReportedField]; !ok || reported != false || len(transport.events) != 0 {
+		t.Errorf("expected public errors to not be reported, got %v and %d events", l.Data, len(transport.events))
+	}
+
+	err := errors.New("db down")
+	l = reportRequestError(r, err)
+	if l.Data[sentryhook.ReportedField] != true || l.Data["error"] != err {
+		t.Errorf("expected the entry to be marked as reported, got %v", l.Data)
+	}
+
+	if len(transport.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(transport.events))
+	}
+
+	event := transport.events[0]
+	if len(event.Exception) == 0 || event.Exception[len(event.Exception)-1].Value != "db down" {
+		t.Errorf("unexpected exception %#v", event.Exception)
+	}
+
+	if event.Tags["service"] != "web" || event.Tags["request_id"] != "abc" || event.User.ID != "3" {
+		t.Errorf("expected the request context on the event, got tags %v and user %#v", event.Tags, event.User)
+	}
+
+	if event.Request == nil || event.Request.Method != "POST" || event.Request.URL != "http://example.com/manage/10/core" {
+		t.Errorf("unexpected request on the event %#v", event.Request)
+	}
+
+	// the scope of the request doesn't leak into other events
+	sentry.CaptureMessage("other")
+	if other := transport.events[len(transport.events)-1]; other.Tags["request_id"] != "" || other.User.ID != "" {
+		t.Errorf("expected the request context to only be on its event, got %v", other.Tags)
+	}
+}
+
+func TestRecoveryMiddlewareReportsPanic(t *testing.T) {
+	transport, restore := withTestSentry(t)
+	defer restore()
+
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, errorReportingTestRequest())
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+
+	if len(transport.events) != 1 {
+		t.Fatalf("expected the panic to be reported once, got %d events", len(transport.events))
+	}
+
+	event := transport.events[0]
+	if len(event.Exception) == 0 || event.Exception[len(event.Exception)-1].Value != "panic: boom" || event.Tags["request_id"] != "abc" {
+		t.Errorf("unexpected event %#v", event)
+	}
+}
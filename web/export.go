@@ -0,0 +1,164 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+
+	// MaxExportRows is the most rows a export has, paginated lists put this many items on the page when exported
+	MaxExportRows = 10000
+)
+
+var exportFileNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// ExportTable is the data of a list page as a table, pages set it with TemplateData.SetExport for RenderHandler to also
+// serve them as a CSV or JSON download when requested with ?format=csv or ?format=json. Exports of pages that don't set
+// one are rejected.
+//
+// Ids should be added as strings, as they don't fit the numbers of javascript.
+type ExportTable struct {
+	// Name is the start of the file name, the date and the extension are added to it
+	Name string
+
+	// Columns are the names of the columns, the keys of the objects in json
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// AddRow adds a row, with the values in the order of the columns
+func (e *ExportTable) AddRow(values ...interface{}) {
+	e.Rows = append(e.Rows, values)
+}
+
+// ExportFormat returns the format the page was requested as a download in, empty for the page itself
+func ExportFormat(r *http.Request) string {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return ""
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "html" {
+		return ""
+	}
+
+	return format
+}
+
+func isExportFormat(format string) bool {
+	return format == ExportFormatCSV || format == ExportFormatJSON
+}
+
+// writeExport responds with the export table of the template data in the format
+func writeExport(w http.ResponseWriter, r *http.Request, format string, out interface{}) {
+	data, _ := out.(TemplateData)
+	table := data.Export()
+	if table == nil {
+		// the page failing to load the data is a error rather than the page not having a export
+		for _, v := range data.Alerts() {
+			if v.Style == AlertDanger {
+				RenderErrorPage(w, r, http.StatusInternalServerError, Msg("%s", v.Message))
+				return
+			}
+		}
+
+		RenderErrorPage(w, r, http.StatusBadRequest, Msg("This page can't be downloaded as %s", strings.ToUpper(format)))
+		return
+	}
+
+	var buf bytes.Buffer
+	var err error
+	contentType := "text/csv; charset=utf-8"
+	if format == ExportFormatJSON {
+		contentType = "application/json"
+		err = encodeExportJSON(&buf, table)
+	} else {
+		err = encodeExportCSV(&buf, table)
+	}
+
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed encoding export")
+		RenderErrorPage(w, r, http.StatusInternalServerError, nil)
+		return
+	}
+
+	name := exportFileNameRegex.ReplaceAllString(table.Name, "-")
+	if name == "" {
+		name = "export"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().UTC().Format("2006-01-02"), format))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(buf.Bytes())
+}
+
+func encodeExportCSV(buf *bytes.Buffer, table *ExportTable) error {
+	writer := csv.NewWriter(buf)
+	if err := writer.Write(table.Columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(table.Columns))
+	for _, row := range table.Rows {
+		for i := range record {
+			record[i] = ""
+			if i < len(row) {
+				record[i] = csvCell(row[i])
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvCell formats the value for a csv file. Text that spreadsheets would run as a formula is prefixed with a quote, as
+// it's often from users.
+func csvCell(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	case string:
+		if t != "" && strings.ContainsRune("=+-@\t\r", rune(t[0])) {
+			return "'" + t
+		}
+		return t
+	}
+
+	return fmt.Sprint(v)
+}
+
+func encodeExportJSON(buf *bytes.Buffer, table *ExportTable) error {
+	rows := make([]map[string]interface{}, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		obj := make(map[string]interface{}, len(table.Columns))
+		for i, column := range table.Columns {
+			obj[column] = nil
+			if i < len(row) {
+				obj[column] = row[i]
+			}
+		}
+		rows = append(rows, obj)
+	}
+
+	return json.NewEncoder(buf).Encode(rows)
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteExport(t *testing.T) {
+	table := &ExportTable{Name: "cp logs/1", Columns: []string{"id", "created_at", "username", "points"}}
+	table.AddRow(1, time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC), "=HYPERLINK(\"x\")", -5)
+	table.AddRow(2, time.Time{}, "bob, the builder")
+
+	export := func(format string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/manage/1/cplogs?format="+format, nil)
+		w := httptest.NewRecorder()
+		writeExport(w, r, ExportFormat(r), TemplateData{}.SetExport(table))
+		return w
+	}
+
+	w := export("csv")
+	expected := "id,created_at,username,points\n1,2021-01-02T15:04:05Z,\"'=HYPERLINK(\"\"x\"\")\",-5\n2,,\"bob, the builder\",\n"
+	if w.Body.String() != expected {
+		t.Errorf("unexpected csv %q, expected %q", w.Body.String(), expected)
+	}
+
+	if disposition := w.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, `attachment; filename="cp-logs-1-`) || !strings.HasSuffix(disposition, `.csv"`) {
+		t.Errorf("unexpected content disposition %q", disposition)
+	}
+
+	w = export("JSON")
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("failed decoding json export %q: %v", w.Body.String(), err)
+	}
+
+	if len(decoded) != 2 || decoded[0]["username"] != "=HYPERLINK(\"x\")" || decoded[0]["created_at"] != "2021-01-02T15:04:05Z" || decoded[1]["points"] != nil {
+		t.Errorf("unexpected json export %v", decoded)
+	}
+}
+
+func TestWriteExportWithoutTable(t *testing.T) {
+	r := httptest.NewRequest("GET", "/manage/1/core?format=csv", nil)
+	w := httptest.NewRecorder()
+	writeExport(w, r, ExportFormat(r), TemplateData{})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected pages without a export table to be a 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	writeExport(w, r, ExportFormat(r), TemplateData{}.AddAlerts(ErrorAlert("Failed retrieving logs")))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected pages failing to load the data to be a 500, got %d", w.Code)
+	}
+}
+
+func TestExportPagination(t *testing.T) {
+	p := ParsePagination(httptest.NewRequest("GET", "/manage/1/cplogs?format=csv&page=3", nil), 20)
+	if p.Page != 1 || p.Limit() != MaxExportRows {
+		t.Errorf("expected exports to have everything on one page, got page %d of size %d", p.Page, p.Limit())
+	}
+
+	if format := ExportFormat(httptest.NewRequest("POST", "/manage/1/cplogs?format=csv", nil)); format != "" {
+		t.Errorf("expected posts to never be exports, got %q", format)
+	}
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+)
+
+// flashed alerts the user never loaded a page for are dropped after this
+const flashAlertsExpiry = time.Minute * 5
+
+func keyFlashAlerts(sessionID string) string {
+	return "flash_alerts:" + sessionID
+}
+
+// a flashed alert, the message is translated to the language of the request that added it as the localizer of the
+// alert can't be stored
+type flashAlert struct {
+	Style   string `json:"style"`
+	Message string `json:"message"`
+}
+
+// flashedMessage is the already translated message of a flashed alert
+type flashedMessage string
+
+func (m flashedMessage) Localize(lang string) string {
+	return string(m)
+}
+
+// FlashAlerts stores the alerts in the session so they're shown on the next page the user loads, for handlers that
+// redirect instead of rendering a page, where alerts added to the template data would be lost. They're dropped if the
+// user isn't logged in.
+func FlashAlerts(r *http.Request, alerts ...*Alert) {
+	yagToken, _ := r.Context().Value(common.ContextKeyYagToken).(string)
+	if yagToken == "" || len(alerts) < 1 {
+		return
+	}
+
+	encoded, err := encodeFlashAlerts(RequestLanguage(r), alerts)
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed encoding flash alerts")
+		return
+	}
+
+	key := keyFlashAlerts(SessionID(yagToken))
+	err = common.RedisPool.Do(radix.Pipeline(
+		radix.Cmd(nil, "RPUSH", append([]string{key}, encoded...)...),
+		radix.FlatCmd(nil, "EXPIRE", key, int(flashAlertsExpiry.Seconds())),
+	))
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed storing flash alerts")
+	}
+}
+
+// RedirectWithAlerts redirects to the url, showing the alerts on the page it lands on, see FlashAlerts
+func RedirectWithAlerts(w http.ResponseWriter, r *http.Request, url string, alerts ...*Alert) {
+	FlashAlerts(r, alerts...)
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// FlashMiddleware adds the alerts flashed in the session to the template data of the page, removing them from the
+// session so they're only shown once
+func FlashMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alerts := popFlashAlerts(r)
+		if len(alerts) < 1 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, tmpl := GetCreateTemplateData(r.Context())
+		tmpl.AddAlerts(alerts...)
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// popFlashAlerts returns and removes the alerts flashed in the session, only pages take them so they're not lost to
+// api calls and form posts made in the background
+func popFlashAlerts(r *http.Request) []*Alert {
+	yagToken, _ := r.Context().Value(common.ContextKeyYagToken).(string)
+	if yagToken == "" || r.Method != http.MethodGet || RedisDegraded() {
+		return nil
+	}
+
+	if class := RequestClassOf(r); class != RequestClassCP && class != RequestClassPublic {
+		return nil
+	}
+
+	var encoded []string
+	key := keyFlashAlerts(SessionID(yagToken))
+	err := common.RedisPool.Do(radix.Pipeline(
+		radix.Cmd(&encoded, "LRANGE", key, "0", "-1"),
+		radix.Cmd(nil, "DEL", key),
+	))
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed retrieving flash alerts")
+		return nil
+	}
+
+	return decodeFlashAlerts(encoded)
+}
+
+func encodeFlashAlerts(lang string, alerts []*Alert) ([]string, error) {
+	encoded := make([]string, 0, len(alerts))
+	for _, v := range alerts {
+		// translated on a copy, the alerts may be rendered by the current request too
+		localized := *v
+		localized.localize(lang)
+
+		serialized, err := json.Marshal(&flashAlert{Style: localized.Style, Message: localized.Message})
+		if err != nil {
+			return nil, err
+		}
+
+		encoded = append(encoded, string(serialized))
+	}
+
+	return encoded, nil
+}
+
+func decodeFlashAlerts(encoded []string) []*Alert {
+	alerts := make([]*Alert, 0, len(encoded))
+	for _, v := range encoded {
+		var decoded flashAlert
+		if err := json.Unmarshal([]byte(v), &decoded); err != nil {
+			logger.WithError(err).Error("failed decoding flash alert")
+			continue
+		}
+
+		alerts = append(alerts, &Alert{Style: decoded.Style, Message: decoded.Message, msg: flashedMessage(decoded.Message)})
+	}
+
+	return alerts
+}
@@ -0,0 +1,57 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlashAlertsRoundTrip(t *testing.T) {
+	defer func(old map[string]*messageCatalog) { messageCatalogs = old }(messageCatalogs)
+	messageCatalogs = map[string]*messageCatalog{SourceLanguage: {Name: "English", Messages: map[string]string{}}}
+	RegisterMessages("de", "Deutsch", map[string]string{
+		"too long (max %d)":   "zu lang (maximal %d)",
+		"Linked your account": "Konto verknüpft",
+		"Konto verknüpft":     "translated twice",
+	})
+
+	alerts := []*Alert{SucessAlert("Linked your account"), ErrorAlert(Msg("too long (max %d)", 5))}
+	encoded, err := encodeFlashAlerts("de", alerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alerts[0].Message != "Linked your account" {
+		t.Errorf("expected the alerts themselves to be left untranslated, got %q", alerts[0].Message)
+	}
+
+	decoded := decodeFlashAlerts(append(encoded, "not json"))
+	if len(decoded) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(decoded))
+	}
+
+	for _, v := range decoded {
+		// rendered pages translate their alerts again
+		v.localize("de")
+	}
+
+	if decoded[0].Style != AlertSuccess || decoded[0].Message != "Konto verknüpft" {
+		t.Errorf("unexpected first alert %+v", decoded[0])
+	}
+	if decoded[1].Style != AlertDanger || decoded[1].Message != "zu lang (maximal 5)" {
+		t.Errorf("unexpected second alert %+v", decoded[1])
+	}
+}
+
+func TestFlashMiddlewareLoggedOut(t *testing.T) {
+	var alerts []*Alert
+	handler := FlashMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, tmpl := GetCreateTemplateData(r.Context())
+		alerts = tmpl.Alerts()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/manage", nil))
+	if len(alerts) != 0 {
+		t.Errorf("expected no alerts for logged out requests, got %v", alerts)
+	}
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confFragmentCacheTTL = config.RegisterOption("yagpdb.web.fragment_cache_ttl", "Seconds rendered template fragments are cached for at most. They're invalidated when the server's config is saved, but not when its channels or roles change. 0 disables the cache", 300)
+
+	metricsFragmentCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_web_fragment_cache_total",
+		Help: "Renders of cached template fragments, by template and whether they were served from the cache",
+	}, []string{"template", "result"})
+)
+
+func keyGuildConfigVersion(guildID int64) string {
+	return "guild_config_version:" + discordgo.StrID(guildID)
+}
+
+func keyCachedFragment(guildID, version int64, name, variant string) string {
+	return "fragment_cache:" + discordgo.StrID(guildID) + ":" + strconv.FormatInt(version, 10) + ":" + common.VERSION + ":" + name + ":" + variant
+}
+
+// GuildConfigVersion returns the version of the server's config, it changes every time the config is saved
+func GuildConfigVersion(guildID int64) (int64, error) {
+	var version int64
+	err := common.RedisPool.Do(radix.Cmd(&version, "GET", keyGuildConfigVersion(guildID)))
+	return version, errors.WithStackIf(err)
+}
+
+// BumpGuildConfigVersion changes the version of the server's config, invalidating the template fragments cached for
+// it. ControllerPostHandler does this for every form posted in the control panel, handlers saving the config in other
+// ways (e.g json apis) have to call it themselves.
+func BumpGuildConfigVersion(guildID int64) error {
+	err := common.RedisPool.Do(radix.Cmd(nil, "INCR", keyGuildConfigVersion(guildID)))
+	return errors.WithStackIf(err)
+}
+
+// tmplCachedTemplate is mTemplate with the result cached in redis for the server's config version, for the large
+// fragments such as the role and channel selectors of pages with many of them:
+//
+//	{{cachedTemplate "commands_channel_override" (print "override-" .ID) $dot.ActiveGuild.ID "ActiveGuild" $dot.ActiveGuild "Override" .}}
+//
+// The variant tells apart the renders of the same template on a page. The fragment can only depend on the server's
+// config, channels and roles: not on the user, and it can't contain inline scripts as the nonce changes every request.
+func tmplCachedTemplate(name, variant string, guildID int64, values ...interface{}) (template.HTML, error) {
+	render := func() (template.HTML, error) {
+		return mTemplate(name, values...)
+	}
+
+	ttl := confFragmentCacheTTL.GetInt()
+	if ttl <= 0 || guildID == 0 || RedisDegraded() || DevTemplates() {
+		return render()
+	}
+
+	version, err := GuildConfigVersion(guildID)
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed retrieving config version for the fragment cache")
+		return render()
+	}
+
+	key := keyCachedFragment(guildID, version, name, variant)
+
+	var cached []byte
+	mn := radix.MaybeNil{Rcv: &cached}
+	err = common.RedisPool.Do(radix.Cmd(&mn, "GET", key))
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed retrieving cached fragment")
+		return render()
+	}
+
+	if !mn.Nil {
+		metricsFragmentCache.With(prometheus.Labels{"template": name, "result": "hit"}).Inc()
+		return template.HTML(cached), nil
+	}
+
+	metricsFragmentCache.With(prometheus.Labels{"template": name, "result": "miss"}).Inc()
+	rendered, err := render()
+	if err != nil {
+		return rendered, err
+	}
+
+	err = common.RedisPool.Do(radix.Cmd(nil, "SET", key, string(rendered), "EX", strconv.Itoa(ttl)))
+	if err != nil {
+		logger.WithError(err).WithField("guild", guildID).Error("failed storing cached fragment")
+	}
+
+	return rendered, nil
+}
+
+// bumpContextGuildConfigVersion bumps the config version of the server the request is for, if it's for one
+func bumpContextGuildConfigVersion(r *http.Request) {
+	g, ok := r.Context().Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet)
+	if !ok {
+		return
+	}
+
+	if err := BumpGuildConfigVersion(g.ID); err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed bumping config version")
+	}
+}
@@ -0,0 +1,19 @@
+package web
+
+import "testing"
+
+func TestCachedFragmentKey(t *testing.T) {
+	key := keyCachedFragment(1, 2, "commands_channel_override", "global")
+
+	if keyCachedFragment(1, 3, "commands_channel_override", "global") == key {
+		t.Error("expected the config version to be part of the key")
+	}
+
+	if keyCachedFragment(1, 2, "commands_channel_override", "new") == key {
+		t.Error("expected the variant to be part of the key")
+	}
+
+	if keyCachedFragment(4, 2, "commands_channel_override", "global") == key {
+		t.Error("expected the guild to be part of the key")
+	}
+}
@@ -0,0 +1,315 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/botlabs-gg/yagpdb/v2/web/configcode"
+	"github.com/botlabs-gg/yagpdb/v2/web/discorddata"
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+var confGraphQL = config.RegisterOption("yagpdb.web.graphql", "Serve the graphql api at /api/graphql, with the schema at /api/graphql/schema.graphql", false)
+
+const (
+	graphQLPath = "/api/graphql"
+
+	maxGraphQLBodySize = 100000
+
+	// maxGraphQLDepth is the deepest fields can be nested in a query
+	maxGraphQLDepth = 10
+)
+
+// graphQLSchemaSDL is the schema of /api/graphql. Guilds resolve for users with access to their control panel, and guild
+// api tokens only for their own guild, with the settings needing the config scope.
+const graphQLSchemaSDL = `schema {
+  query: Query
+}
+
+"Any json value"
+scalar JSON
+
+type Query {
+  "A server you have access to the control panel of"
+  guild(id: ID!): Guild
+}
+
+type Guild {
+  id: ID!
+  name: String!
+  icon: String!
+  ownerId: ID!
+  memberCount: Int!
+  "Whether you can only view the settings"
+  readOnly: Boolean!
+  channels: [Channel!]!
+  roles: [Role!]!
+  "The settings of the plugins, or only of the given plugin. Null if you aren't allowed to read them"
+  settings(plugin: String): [PluginSettings!]
+}
+
+type Channel {
+  id: ID!
+  name: String!
+  "The discord channel type"
+  type: Int!
+  position: Int!
+  topic: String!
+  nsfw: Boolean!
+  "The category the channel is in"
+  parentId: ID
+}
+
+type Role {
+  id: ID!
+  name: String!
+  color: Int!
+  position: Int!
+  managed: Boolean!
+  mentionable: Boolean!
+  hoist: Boolean!
+  "The permission bits, as a string as they don't fit the numbers of javascript"
+  permissions: String!
+}
+
+type PluginSettings {
+  plugin: String!
+  "The settings in the json form of the config code, the same as in /api/v1"
+  settings: JSON!
+}
+`
+
+var graphQLSchema = graphql.MustParseSchema(graphQLSchemaSDL, &graphQLResolver{}, graphql.UseStringDescriptions(), graphql.MaxDepth(maxGraphQLDepth))
+
+// graphQLResolver resolves the query type
+type graphQLResolver struct{}
+
+// graphQLGuild is the value of Guild objects, with the context of the request as if it was to the control panel of the
+// guild so the access checks and plugins work like they do there
+type graphQLGuild struct {
+	ctx   context.Context
+	guild *dstate.GuildSet
+	write bool
+}
+
+func (g *graphQLGuild) ID() graphql.ID      { return graphql.ID(discordgo.StrID(g.guild.ID)) }
+func (g *graphQLGuild) Name() string        { return g.guild.Name }
+func (g *graphQLGuild) Icon() string        { return g.guild.Icon }
+func (g *graphQLGuild) OwnerID() graphql.ID { return graphql.ID(discordgo.StrID(g.guild.OwnerID)) }
+func (g *graphQLGuild) MemberCount() int32  { return int32(g.guild.MemberCount) }
+func (g *graphQLGuild) ReadOnly() bool      { return !g.write }
+
+func (g *graphQLGuild) Channels() []*graphQLChannel {
+	result := make([]*graphQLChannel, len(g.guild.Channels))
+	for i := range g.guild.Channels {
+		result[i] = &graphQLChannel{c: &g.guild.Channels[i]}
+	}
+	return result
+}
+
+func (g *graphQLGuild) Roles() []*graphQLRole {
+	result := make([]*graphQLRole, len(g.guild.Roles))
+	for i := range g.guild.Roles {
+		result[i] = &graphQLRole{r: &g.guild.Roles[i]}
+	}
+	return result
+}
+
+type graphQLChannel struct {
+	c *dstate.ChannelState
+}
+
+func (c *graphQLChannel) ID() graphql.ID  { return graphql.ID(discordgo.StrID(c.c.ID)) }
+func (c *graphQLChannel) Name() string    { return c.c.Name }
+func (c *graphQLChannel) Type() int32     { return int32(c.c.Type) }
+func (c *graphQLChannel) Position() int32 { return int32(c.c.Position) }
+func (c *graphQLChannel) Topic() string   { return c.c.Topic }
+func (c *graphQLChannel) NSFW() bool      { return c.c.NSFW }
+
+func (c *graphQLChannel) ParentID() *graphql.ID {
+	if c.c.ParentID == 0 {
+		return nil
+	}
+
+	id := graphql.ID(discordgo.StrID(c.c.ParentID))
+	return &id
+}
+
+type graphQLRole struct {
+	r *discordgo.Role
+}
+
+func (r *graphQLRole) ID() graphql.ID      { return graphql.ID(discordgo.StrID(r.r.ID)) }
+func (r *graphQLRole) Name() string        { return r.r.Name }
+func (r *graphQLRole) Color() int32        { return int32(r.r.Color) }
+func (r *graphQLRole) Position() int32     { return int32(r.r.Position) }
+func (r *graphQLRole) Managed() bool       { return r.r.Managed }
+func (r *graphQLRole) Mentionable() bool   { return r.r.Mentionable }
+func (r *graphQLRole) Hoist() bool         { return r.r.Hoist }
+func (r *graphQLRole) Permissions() string { return strconv.FormatInt(r.r.Permissions, 10) }
+
+type graphQLPluginSettings struct {
+	plugin   string
+	settings graphQLJSON
+}
+
+func (s *graphQLPluginSettings) Plugin() string        { return s.plugin }
+func (s *graphQLPluginSettings) Settings() graphQLJSON { return s.settings }
+
+// graphQLJSON is the JSON scalar, it's only returned so it's written as is
+type graphQLJSON map[string]interface{}
+
+func (graphQLJSON) ImplementsGraphQLType(name string) bool {
+	return name == "JSON"
+}
+
+func (j *graphQLJSON) UnmarshalGraphQL(input interface{}) error {
+	m, ok := input.(map[string]interface{})
+	if !ok {
+		return errors.New("expected a json object")
+	}
+
+	*j = m
+	return nil
+}
+
+var errGraphQLNoAccess = errors.New("you don't have access to this server")
+
+func (*graphQLResolver) Guild(ctx context.Context, args struct{ ID graphql.ID }) (*graphQLGuild, error) {
+	guildID, err := strconv.ParseInt(string(args.ID), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid id")
+	}
+
+	if token := ContextGuildToken(ctx); token != nil && token.GuildID != guildID {
+		return nil, errors.New("the api token is for another server")
+	}
+
+	g, err := getGuild(ctx, guildID)
+	if err != nil || g == nil {
+		return nil, errors.New("unknown server, or the bot isn't on it")
+	}
+
+	ctx = graphQLGuildContext(ctx, g)
+	read, write := GetAccessLevel(ctx)
+	if !read {
+		return nil, errGraphQLNoAccess
+	}
+
+	return &graphQLGuild{ctx: ctx, guild: g, write: write}, nil
+}
+
+// graphQLGuildContext sets up the context like the control panel middlewares do for requests to the guild
+func graphQLGuildContext(ctx context.Context, g *dstate.GuildSet) context.Context {
+	ctx = context.WithValue(ctx, common.ContextKeyCurrentGuild, g)
+	ctx = context.WithValue(ctx, common.ContextKeyCoreConfig, common.GetCoreServerConfCached(g.ID))
+
+	user, ok := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	if !ok {
+		return ctx
+	}
+
+	m, err := discorddata.GetMember(ctx, g.ID, user.ID)
+	if err != nil || m == nil {
+		CtxLogger(ctx).WithError(err).Warn("failed retrieving member info from discord api")
+		return ctx
+	}
+
+	perms := dstate.CalculatePermissions(&g.GuildState, g.Roles, nil, m.User.ID, m.Roles)
+	ctx = context.WithValue(ctx, common.ContextKeyUserMember, m)
+	return context.WithValue(ctx, common.ContextKeyMemberPermissions, perms)
+}
+
+// graphQLSettingsAllowed lets guild api tokens read the settings only with the scope of the settings api
+func graphQLSettingsAllowed(ctx context.Context, g *graphQLGuild) error {
+	if token := ContextGuildToken(ctx); token != nil {
+		if !guildTokenAllows(token.Scopes, g.guild.ID, http.MethodGet, "/api/v1/guilds/"+discordgo.StrID(g.guild.ID)+"/"+guildTokenConfigArea) {
+			return errors.New("the api token needs the " + guildTokenConfigArea + " scope to read the settings")
+		}
+	}
+
+	return nil
+}
+
+func (g *graphQLGuild) Settings(ctx context.Context, args struct{ Plugin *string }) (*[]*graphQLPluginSettings, error) {
+	if err := graphQLSettingsAllowed(ctx, g); err != nil {
+		return nil, err
+	}
+
+	plugins := configCodePlugins()
+	if args.Plugin != nil {
+		p := findConfigCodePlugin(*args.Plugin)
+		if p == nil {
+			return nil, errors.New("unknown plugin " + *args.Plugin)
+		}
+		plugins = []PluginWithConfigCode{p}
+	}
+
+	result := make([]*graphQLPluginSettings, 0, len(plugins))
+	for _, p := range plugins {
+		form, err := p.ExportConfigCode(g.ctx, g.guild.ID)
+		if err != nil {
+			CtxLogger(ctx).WithError(err).WithField("plugin", p.ConfigCodeName()).Error("failed exporting settings for graphql")
+			return nil, errors.New("failed retrieving the settings")
+		}
+
+		attrs, err := configcode.Encode(form)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &graphQLPluginSettings{plugin: p.ConfigCodeName(), settings: configcode.ToJSON(attrs)})
+	}
+
+	return &result, nil
+}
+
+// graphQLRequest is a query request, as sent in the body of POST requests
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// HandleGraphQL handles GET and POST /api/graphql, queries are either in the query params or the json body
+func HandleGraphQL(w http.ResponseWriter, r *http.Request) interface{} {
+	req := &graphQLRequest{}
+
+	var err error
+	if r.Method == http.MethodGet {
+		req.Query = r.FormValue("query")
+		req.OperationName = r.FormValue("operationName")
+		if v := r.FormValue("variables"); v != "" {
+			err = json.Unmarshal([]byte(v), &req.Variables)
+		}
+	} else {
+		err = json.NewDecoder(io.LimitReader(r.Body, maxGraphQLBodySize)).Decode(req)
+	}
+
+	if err == nil && req.Query == "" {
+		err = errors.New("no query")
+	}
+
+	if err != nil {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		return &graphql.Response{Errors: []*gqlerrors.QueryError{gqlerrors.Errorf("invalid request: %s", err)}}
+	}
+
+	return graphQLSchema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+}
+
+// HandleGraphQLSchema serves the schema of the graphql api in the schema definition language
+func HandleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, graphQLSchemaSDL)
+}
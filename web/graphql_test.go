@@ -0,0 +1,69 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+func TestGraphQLSettingsAllowed(t *testing.T) {
+	g := &graphQLGuild{guild: &dstate.GuildSet{GuildState: dstate.GuildState{ID: 1}}}
+
+	if err := graphQLSettingsAllowed(context.Background(), g); err != nil {
+		t.Errorf("expected users to be allowed, got %v", err)
+	}
+
+	withToken := func(scopes ...string) context.Context {
+		return context.WithValue(context.Background(), common.ContextKeyGuildToken, &GuildToken{GuildID: 1, Scopes: scopes})
+	}
+
+	if err := graphQLSettingsAllowed(withToken("config:read"), g); err != nil {
+		t.Errorf("expected tokens with the config scope to be allowed, got %v", err)
+	}
+
+	if err := graphQLSettingsAllowed(withToken("logging:write"), g); err == nil {
+		t.Error("expected tokens without the config scope to be denied")
+	}
+}
+
+func TestGraphQLSchema(t *testing.T) {
+	// validated before anything is resolved
+	resp := graphQLSchema.Exec(context.Background(), `{ guild(id: "1") { channels { nope } } }`, "", nil)
+	encoded, _ := json.Marshal(resp)
+	if !strings.Contains(string(encoded), `Cannot query field \"nope\" on type \"Channel\".`) || resp.Data != nil {
+		t.Errorf("expected a validation error, got %s", encoded)
+	}
+
+	resp = graphQLSchema.Exec(context.Background(), `query($id: ID!) { guild(id: $id) { id } }`, "", map[string]interface{}{"id": "nope"})
+	encoded, _ = json.Marshal(resp)
+	if string(encoded) != `{"errors":[{"message":"invalid id","path":["guild"]}],"data":{"guild":null}}` {
+		t.Errorf("expected the guild to be null with a error, got %s", encoded)
+	}
+
+}
+
+func TestGraphQLResolvers(t *testing.T) {
+	g := &graphQLGuild{guild: &dstate.GuildSet{
+		GuildState: dstate.GuildState{ID: 1, OwnerID: 123456789012345678},
+		Channels:   []dstate.ChannelState{{ID: 2, Name: "general"}, {ID: 3, ParentID: 4}},
+		Roles:      []discordgo.Role{{ID: 5, Permissions: 1 << 40}},
+	}}
+
+	if g.OwnerID() != "123456789012345678" || !g.ReadOnly() {
+		t.Errorf("unexpected guild fields %q, %v", g.OwnerID(), g.ReadOnly())
+	}
+
+	channels := g.Channels()
+	if len(channels) != 2 || channels[0].Name() != "general" || channels[0].ParentID() != nil || *channels[1].ParentID() != "4" {
+		t.Errorf("unexpected channels %v", channels)
+	}
+
+	if roles := g.Roles(); len(roles) != 1 || roles[0].Permissions() != "1099511627776" {
+		t.Errorf("unexpected roles %v", roles)
+	}
+}
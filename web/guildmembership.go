@@ -0,0 +1,33 @@
+package web
+
+import (
+	"github.com/botlabs-gg/yagpdb/v2/bot"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/web/discorddata"
+	"github.com/mediocregopher/radix/v3"
+)
+
+func init() {
+	pubsub.AddHandler(bot.EvtGuildMembershipChanged, handleGuildMembershipChanged, bot.GuildMembershipChangedData{})
+}
+
+func keyUserGuildsCache(userID int64) string {
+	return discordgo.StrID(userID) + ":guilds"
+}
+
+// handleGuildMembershipChanged drops the cached data of a guild the bot just joined or left,
+// whether the bot is on a server is checked live when wrapping the guilds so only the guild lists need to go
+func handleGuildMembershipChanged(evt *pubsub.Event) {
+	data := evt.Data.(*bot.GuildMembershipChangedData)
+
+	discorddata.EvictGuild(data.GuildID)
+
+	if data.OwnerID != 0 {
+		err := common.RedisPool.Do(radix.Cmd(nil, "DEL", common.CacheKeyPrefix+keyUserGuildsCache(data.OwnerID)))
+		if err != nil {
+			logger.WithError(err).WithField("guild", data.GuildID).Error("failed clearing guilds cache of owner")
+		}
+	}
+}
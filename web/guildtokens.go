@@ -0,0 +1,409 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+	"goji.io/pat"
+)
+
+const (
+	guildTokenPrefix       = "yagg_"
+	maxGuildTokensPerGuild = 10
+)
+
+var (
+	panelLogKeyGuildTokenCreated = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "guild_token_created",
+		FormatString: "Created api token %s with the scopes %s",
+	})
+	panelLogKeyGuildTokenDeleted = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "guild_token_deleted",
+		FormatString: "Deleted api token %s",
+	})
+)
+
+// GuildToken is a api token limited to a single server and the scopes given to it, it acts on behalf of the admin
+// that created it, so it stops working if they lose access to the server
+type GuildToken struct {
+	// ID is the first part of the hash, used to identify the token in the panel
+	ID        string    `json:"id"`
+	GuildID   int64     `json:"guild_id,string"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedBy int64     `json:"created_by,string"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GuildTokenScope is a area of the control panel tokens can be given read or write access to
+type GuildTokenScope struct {
+	Name string
+	Area string
+}
+
+// areas tokens can never be given access to, as it would let them give themselves more access
+var guildTokenForbiddenAreas = []string{"guild_tokens", "share_links", "secrets", "approvals", "custom_domain"}
+
+// guildTokenConfigArea is the area of the settings api under /api/v1/guilds/:server/config, see apiv1.go
+const guildTokenConfigArea = "config"
+
+// GuildTokenScopes returns the scopes that can be given to tokens, a read and write scope for every page in the sidebar
+func GuildTokenScopes() []*GuildTokenScope {
+	var result []*GuildTokenScope
+	for _, items := range sideBarItems {
+	OUTER:
+		for _, item := range items {
+			if item.External || item.URL == "" || strings.ContainsAny(item.URL, "/?") {
+				continue
+			}
+
+			for _, v := range guildTokenForbiddenAreas {
+				if item.URL == v {
+					continue OUTER
+				}
+			}
+
+			result = append(result, &GuildTokenScope{Name: item.Name, Area: item.URL})
+		}
+	}
+
+	result = append(result, &GuildTokenScope{Name: "Settings API", Area: guildTokenConfigArea})
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Area < result[j].Area
+	})
+
+	return result
+}
+
+func validGuildTokenScope(scope string) bool {
+	area := strings.TrimSuffix(strings.TrimSuffix(scope, ":read"), ":write")
+	if area == scope {
+		return false
+	}
+
+	for _, v := range GuildTokenScopes() {
+		if v.Area == area {
+			return true
+		}
+	}
+
+	return false
+}
+
+// guildTokenAllows returns true if the scopes allow the request, which has to be to the control panel, the settings api
+// of the guild or the graphql api. Scopes are in the format of "<area>:read" or "<area>:write", write scopes also allow reading.
+func guildTokenAllows(scopes []string, guildID int64, method, path string) bool {
+	if path == graphQLPath {
+		// it only reads, the guild and scopes of the token are checked on the fields it resolves
+		return true
+	}
+
+	area := guildTokenArea(guildID, path)
+	if area == "" {
+		return false
+	}
+
+	for _, v := range guildTokenForbiddenAreas {
+		if area == v {
+			return false
+		}
+	}
+
+	for _, v := range scopes {
+		if v == area+":write" || (v == area+":read" && isReadOnlyMethod(method)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// guildTokenArea returns the area of the path, empty if it's not a path of the guild tokens can be used on
+func guildTokenArea(guildID int64, path string) string {
+	var split []string
+	switch {
+	case strings.HasPrefix(path, "/manage/"):
+		split = strings.SplitN(strings.TrimPrefix(path, "/manage/"), "/", 3)
+	case strings.HasPrefix(path, "/api/v1/guilds/"):
+		split = strings.SplitN(strings.TrimPrefix(path, "/api/v1/guilds/"), "/", 3)
+		if len(split) < 2 || split[1] != guildTokenConfigArea {
+			return ""
+		}
+	}
+
+	if len(split) < 2 || split[0] != strconv.FormatInt(guildID, 10) {
+		return ""
+	}
+
+	return strings.TrimSuffix(split[1], ".json")
+}
+
+func keyGuildTokens() string {
+	return "guild_api_tokens"
+}
+
+func keyGuildTokensOfGuild(guildID int64) string {
+	return "guild_api_tokens:" + strconv.FormatInt(guildID, 10)
+}
+
+// CreateGuildToken generates a new token for the guild, the returned plaintext token is not stored anywhere
+func CreateGuildToken(guildID, userID int64, name string, scopes []string) (string, *GuildToken, error) {
+	for _, v := range scopes {
+		if !validGuildTokenScope(v) {
+			return "", nil, NewPublicError("Unknown scope ", v)
+		}
+	}
+
+	if len(scopes) < 1 {
+		return "", nil, NewPublicError("Select at least one scope")
+	}
+
+	var count int
+	err := common.RedisPool.Do(radix.Cmd(&count, "SCARD", keyGuildTokensOfGuild(guildID)))
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	if count >= maxGuildTokensPerGuild {
+		return "", nil, NewPublicError("There can only be ", maxGuildTokensPerGuild, " api tokens, delete one first")
+	}
+
+	plain := guildTokenPrefix + RandBase64(32)
+	hash := hashAPIKey(plain)
+
+	token := &GuildToken{
+		ID:        apiKeyID(hash),
+		GuildID:   guildID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+
+	serialized, err := json.Marshal(token)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	err = common.MultipleCmds(
+		radix.Cmd(nil, "HSET", keyGuildTokens(), hash, string(serialized)),
+		radix.Cmd(nil, "SADD", keyGuildTokensOfGuild(guildID), hash),
+	)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	return plain, token, nil
+}
+
+// GetGuildTokens returns all the tokens of the guild, newest first
+func GetGuildTokens(guildID int64) ([]*GuildToken, error) {
+	var hashes []string
+	err := common.RedisPool.Do(radix.Cmd(&hashes, "SMEMBERS", keyGuildTokensOfGuild(guildID)))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	result := make([]*GuildToken, 0, len(hashes))
+	for _, hash := range hashes {
+		token, err := getGuildTokenByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if token != nil {
+			result = append(result, token)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func getGuildTokenByHash(hash string) (*GuildToken, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGET", keyGuildTokens(), hash))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var token *GuildToken
+	err = json.Unmarshal(raw, &token)
+	return token, errors.WithStackIf(err)
+}
+
+// DeleteGuildToken deletes the token with the id, provided it belongs to the guild
+func DeleteGuildToken(guildID int64, id string) (*GuildToken, error) {
+	var hashes []string
+	err := common.RedisPool.Do(radix.Cmd(&hashes, "SMEMBERS", keyGuildTokensOfGuild(guildID)))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	for _, hash := range hashes {
+		if apiKeyID(hash) != id {
+			continue
+		}
+
+		token, err := getGuildTokenByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		err = common.MultipleCmds(
+			radix.Cmd(nil, "HDEL", keyGuildTokens(), hash),
+			radix.Cmd(nil, "SREM", keyGuildTokensOfGuild(guildID), hash),
+		)
+		return token, err
+	}
+
+	return nil, NewPublicError("Unknown api token")
+}
+
+// ValidateGuildToken returns the token if it's valid, nil otherwise
+func ValidateGuildToken(plain string) (*GuildToken, error) {
+	if !strings.HasPrefix(plain, guildTokenPrefix) {
+		return nil, nil
+	}
+
+	return getGuildTokenByHash(hashAPIKey(plain))
+}
+
+// GuildTokenMiddleware authenticates requests using a guild api token in the Authorization header,
+// only letting through requests to the control panel of the token's guild covered by its scopes
+func GuildTokenMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plain := bearerToken(r)
+		if !strings.HasPrefix(plain, guildTokenPrefix) || r.Context().Value(common.ContextKeyUser) != nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := ValidateGuildToken(plain)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed validating guild api token")
+			http.Error(w, `{"ok":false,"error":"failed validating api token"}`, http.StatusInternalServerError)
+			return
+		}
+
+		if token == nil {
+			EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventAPIKeyInvalid, Details: map[string]string{"kind": "guild_token"}})
+			http.Error(w, `{"ok":false,"error":"invalid api token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		if !guildTokenAllows(token.Scopes, token.GuildID, r.Method, r.URL.Path) {
+			EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventPermissionDenied, GuildID: token.GuildID, Details: map[string]string{"reason": "token_scope", "guild_token": token.ID}})
+			http.Error(w, `{"ok":false,"error":"the api token does not have access to this"}`, http.StatusForbidden)
+			return
+		}
+
+		user, err := apiKeyUser(token.CreatedBy)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed retrieving guild api token user")
+			http.Error(w, `{"ok":false,"error":"failed retrieving user"}`, http.StatusInternalServerError)
+			return
+		}
+
+		// changes made with the token show up in the control panel logs under the token's name
+		tokenUser := *user
+		tokenUser.Username = user.Username + " (api token " + token.Name + ")"
+
+		EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventAPIKeyUsed, UserID: user.ID, GuildID: token.GuildID, Details: map[string]string{"guild_token": token.ID}})
+
+		entry := CtxLogger(r.Context()).WithField("u", user.ID).WithField("guild_token", token.ID)
+		ctx := context.WithValue(r.Context(), common.ContextKeyLogger, entry)
+		ctx = context.WithValue(ctx, common.ContextKeyUser, &tokenUser)
+		ctx = context.WithValue(ctx, common.ContextKeyGuildToken, token)
+		setAccessLogUser(ctx, user.ID)
+		ctx, tmpl := GetCreateTemplateData(ctx)
+		tmpl.SetUser(&tokenUser)
+
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ContextGuildToken returns the guild api token the request was authenticated with, if any
+func ContextGuildToken(ctx context.Context) *GuildToken {
+	if v, ok := ctx.Value(common.ContextKeyGuildToken).(*GuildToken); ok {
+		return v
+	}
+
+	return nil
+}
+
+type CreateGuildTokenForm struct {
+	Name   string `valid:",1,100"`
+	Scopes []string
+}
+
+// HandleGetGuildTokens handles GET /manage/:server/guild_tokens
+func HandleGetGuildTokens(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, tmpl := GetBaseCPContextData(r.Context())
+
+	tokens, err := GetGuildTokens(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["GuildTokens"] = tokens
+	tmpl["GuildTokenScopes"] = GuildTokenScopes()
+	return tmpl, nil
+}
+
+// HandleCreateGuildToken handles POST /manage/:server/guild_tokens/new
+func HandleCreateGuildToken(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/guild_tokens")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*CreateGuildTokenForm)
+
+	plain, token, err := CreateGuildToken(g.ID, ContextUser(ctx).ID, form.Name, form.Scopes)
+	if err != nil {
+		return tmpl, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyGuildTokenCreated,
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: token.Name},
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: strings.Join(token.Scopes, ", ")}))
+
+	tmpl["NewGuildToken"] = plain
+	return tmpl, nil
+}
+
+// HandleDeleteGuildToken handles POST /manage/:server/guild_tokens/:token/delete
+func HandleDeleteGuildToken(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/guild_tokens")
+
+	token, err := DeleteGuildToken(g.ID, pat.Param(r, "token"))
+	if err != nil {
+		return tmpl, err
+	}
+
+	if token != nil {
+		go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyGuildTokenDeleted, &cplogs.Param{Type: cplogs.ParamTypeString, Value: token.Name}))
+	}
+
+	return tmpl, nil
+}
@@ -0,0 +1,161 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+func TestGuildTokenAllows(t *testing.T) {
+	scopes := []string{"automod:read", "customcommands:write"}
+
+	cases := []struct {
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"GET", "/manage/1/automod", true},
+		{"GET", "/manage/1/automod/rulesets/2", true},
+		{"POST", "/manage/1/automod/new_ruleset", false},
+		{"POST", "/manage/1/customcommands/commands/new", true},
+		{"GET", "/manage/1/customcommands", true},
+		{"GET", "/manage/1/scheduled_actions.json", false},
+		{"GET", "/manage/2/automod", false},
+		{"GET", "/manage/1", false},
+		{"GET", "/manage/1/", false},
+		{"GET", "/api_keys", false},
+		{"GET", "/manage/1/automodx", false},
+	}
+
+	for _, c := range cases {
+		if got := guildTokenAllows(scopes, 1, c.method, c.path); got != c.allowed {
+			t.Errorf("%s %s: got %v, expected %v", c.method, c.path, got, c.allowed)
+		}
+	}
+
+	configScopes := []string{"config:read"}
+	configCases := []struct {
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"GET", "/api/v1/guilds/1/config", true},
+		{"GET", "/api/v1/guilds/1/config/logs", true},
+		{"PATCH", "/api/v1/guilds/1/config/logs", false},
+		{"GET", "/api/v1/guilds/2/config", false},
+		{"GET", "/api/v1/guilds/1/automod", false},
+		{"GET", "/api/v1/guilds/1", false},
+	}
+
+	for _, c := range configCases {
+		if got := guildTokenAllows(configScopes, 1, c.method, c.path); got != c.allowed {
+			t.Errorf("%s %s: got %v, expected %v", c.method, c.path, got, c.allowed)
+		}
+	}
+
+	if !guildTokenAllows([]string{"config:write"}, 1, "PATCH", "/api/v1/guilds/1/config") {
+		t.Error("config:write token not allowed to change the settings")
+	}
+
+	// the graphql api checks the scopes per field
+	if !guildTokenAllows(nil, 1, "POST", "/api/graphql") {
+		t.Error("token not allowed to use the graphql api")
+	}
+
+	// tokens can never manage tokens, even if the scope somehow got stored
+	if guildTokenAllows([]string{"guild_tokens:write"}, 1, "POST", "/manage/1/guild_tokens/new") {
+		t.Error("token allowed to create tokens")
+	}
+}
+
+func TestGuildTokenForbiddenAreas(t *testing.T) {
+	defer func(items map[string][]*SidebarItem) { sideBarItems = items }(sideBarItems)
+	sideBarItems = map[string][]*SidebarItem{
+		SidebarCategoryCore: {{Name: "Automod", URL: "automod"}},
+	}
+
+	for _, area := range guildTokenForbiddenAreas {
+		AddSidebarItem(SidebarCategoryCore, &SidebarItem{Name: area, URL: area})
+	}
+
+	for _, v := range GuildTokenScopes() {
+		for _, area := range guildTokenForbiddenAreas {
+			if v.Area == area {
+				t.Errorf("tokens can be given access to %s", area)
+			}
+		}
+	}
+
+	// e.g approving their own changes or moving the panel to a domain of their own
+	for _, area := range []string{"guild_tokens", "share_links", "secrets", "approvals", "custom_domain"} {
+		if validGuildTokenScope(area + ":write") {
+			t.Errorf("%s:write is a valid scope", area)
+		}
+
+		if guildTokenAllows([]string{area + ":write"}, 1, "POST", "/manage/1/"+area+"/x") {
+			t.Errorf("token allowed to make changes in %s", area)
+		}
+	}
+
+	if !validGuildTokenScope("automod:write") {
+		t.Error("automod:write is not a valid scope")
+	}
+}
+
+func TestGuildTokens(t *testing.T) {
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	defer func(items map[string][]*SidebarItem) { sideBarItems = items }(sideBarItems)
+	sideBarItems = map[string][]*SidebarItem{
+		SidebarCategoryCore: {{Name: "Automod", URL: "automod"}},
+	}
+
+	const guildID = 1025
+	existing, err := GetGuildTokens(guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range existing {
+		DeleteGuildToken(guildID, v.ID)
+	}
+
+	plain, token, err := CreateGuildToken(guildID, 1, "test", []string{"automod:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.ID != apiKeyID(hashAPIKey(plain)) {
+		t.Errorf("unexpected token id %q", token.ID)
+	}
+
+	if _, _, err := CreateGuildToken(guildID, 1, "test", []string{"approvals:write"}); err == nil {
+		t.Error("created a token with a unknown scope")
+	}
+
+	validated, err := ValidateGuildToken(plain)
+	if err != nil || validated == nil || validated.ID != token.ID || validated.GuildID != guildID {
+		t.Fatalf("unexpected token %#v, %v", validated, err)
+	}
+
+	// only the exact id deletes a token, not a prefix of it
+	for _, id := range []string{"", token.ID[:4], token.ID + "0"} {
+		if _, err := DeleteGuildToken(guildID, id); err == nil {
+			t.Errorf("deleted a token with the id %q", id)
+		}
+	}
+
+	if _, err := DeleteGuildToken(guildID+1, token.ID); err == nil {
+		t.Error("deleted the token of another guild")
+	}
+
+	if deleted, err := DeleteGuildToken(guildID, token.ID); err != nil || deleted == nil || deleted.ID != token.ID {
+		t.Fatalf("failed deleting the token: %#v, %v", deleted, err)
+	}
+
+	if validated, _ := ValidateGuildToken(plain); validated != nil {
+		t.Error("the deleted token still works")
+	}
+}
@@ -1,17 +1,14 @@
 package web
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/models"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/web/discorddata"
-	"github.com/mediocregopher/radix/v3"
 	"golang.org/x/oauth2"
 )
 
@@ -21,37 +18,23 @@ var (
 )
 
 func InitOauth() {
-	OauthConf = &oauth2.Config{
-		ClientID:     common.ConfClientID.GetString(),
-		ClientSecret: common.ConfClientSecret.GetString(),
-		Scopes:       []string{"identify", "guilds"},
-		Endpoint: oauth2.Endpoint{
-			TokenURL: "https://discordapp.com/api/oauth2/token",
-			AuthURL:  "https://discordapp.com/api/oauth2/authorize",
-		},
-	}
-
-	if https || exthttps {
-		OauthConf.RedirectURL = "https://" + common.ConfHost.GetString() + "/confirm_login"
-	} else {
-		OauthConf.RedirectURL = "http://" + common.ConfHost.GetString() + "/confirm_login"
-	}
+	OauthConf = newApplicationOauthConf(common.ConfClientID.GetString(), common.ConfClientSecret.GetString())
+	loadApplications()
 }
 
 func HandleLogin(w http.ResponseWriter, r *http.Request) {
+	st := &oauthState{}
 
-	csrfToken, err := CreateCSRFToken()
-	if err != nil {
-		CtxLogger(r.Context()).WithError(err).Error("Failed generating csrf token")
-		return
+	if redir := r.FormValue("goto"); isLocalRedirect(redir) {
+		st.Goto = redir
 	}
 
-	redir := r.FormValue("goto")
-	if redir != "" && strings.HasPrefix(redir, "/") {
-		common.RedisPool.Do(radix.Cmd(nil, "SET", "csrf_redir:"+csrfToken, redir, "EX", "500"))
+	url, err := startOAuthFlow(w, GetApplication(r.FormValue("app")), st)
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("Failed starting oauth flow")
+		return
 	}
 
-	url := OauthConf.AuthCodeURL(csrfToken, oauth2.AccessTypeOnline)
 	// disabled prompt to see if the multiple requests are still happening when user expliclity consents to login
 	// url += "&prompt=none"
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
@@ -60,21 +43,39 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 func HandleConfirmLogin(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	state := r.FormValue("state")
-	if ok, err := CheckCSRFToken(state); !ok {
-		if err != nil {
-			CtxLogger(ctx).WithError(err).Error("Failed validating CSRF token")
+	if isAuthLockedOut(r) {
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	st, err := consumeOAuthState(w, r, r.FormValue("state"))
+	if err != nil {
+		if err != ErrInvalidOAuthState {
+			CtxLogger(ctx).WithError(err).Error("Failed validating oauth state")
 		} else {
-			CtxLogger(ctx).Infof("Invalid oauth state %s ", state)
+			CtxLogger(ctx).Info("Invalid oauth state")
+			recordAuthFailure(r, "oauth_state")
 		}
 		http.Redirect(w, r, "/?error=bad-csrf", http.StatusTemporaryRedirect)
 		return
 	}
 
-	code := r.FormValue("code")
-	token, err := OauthConf.Exchange(ctx, code)
+	if st.StepUp != nil {
+		handleStepUpCallback(w, r, st)
+		return
+	}
+
+	if st.LinkedRoles {
+		handleLinkedRolesCallback(w, r, st)
+		return
+	}
+
+	app := GetApplication(st.Application)
+
+	token, err := exchangeOAuthCode(r, st)
 	if err != nil {
 		CtxLogger(ctx).WithError(err).Error("oauthConf.Exchange() failed")
+		recordAuthFailure(r, "oauth_code")
 		http.Redirect(w, r, "/?error=oauth2failure", http.StatusTemporaryRedirect)
 		return
 	}
@@ -89,12 +90,19 @@ func HandleConfirmLogin(w http.ResponseWriter, r *http.Request) {
 
 	http.SetCookie(w, sessionCookie)
 
-	var redirUrl string
-	err = common.RedisPool.Do(radix.Cmd(&redirUrl, "GET", "csrf_redir:"+state))
+	err = recordNewSession(r, sessionCookie.Value)
 	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("Failed recording session metadata")
+	} else if !app.IsDefault() {
+		err = setSessionApplication(sessionCookie.Value, app)
+		if err != nil {
+			CtxLogger(ctx).WithError(err).Error("Failed setting session application")
+		}
+	}
+
+	redirUrl := st.Goto
+	if redirUrl == "" {
 		redirUrl = "/manage"
-	} else {
-		common.RedisPool.Do(radix.Cmd(nil, "DEL", "csrf_redir:"+state))
 	}
 
 	http.Redirect(w, r, redirUrl, http.StatusTemporaryRedirect)
@@ -104,67 +112,38 @@ func HandleConfirmLogin(w http.ResponseWriter, r *http.Request) {
 func HandleLogout(w http.ResponseWriter, r *http.Request) {
 	rawToken := r.Context().Value(common.ContextKeyYagToken)
 	if rawToken != nil {
-		discorddata.EvictSession(rawToken.(string))
+		EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventLogout})
+		if err := DeleteSession(rawToken.(string)); err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("Failed deleting session")
+		}
+		forgetSession(rawToken.(string))
 	}
 
 	defer http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 
-	sessionCookie, err := r.Cookie(SessionCookieName)
-	if err != nil {
+	if _, err := r.Cookie(SessionCookieName); err != nil {
 		return
 	}
 
-	sessionCookie.Value = "none"
-	sessionCookie.Path = "/"
-	http.SetCookie(w, sessionCookie)
-}
-
-// CreateCSRFToken creates a csrf token and adds it the list
-func CreateCSRFToken() (string, error) {
-	str := RandBase64(32)
-	logger.Infof("generated new CSRF Token %s", str)
-	err := common.MultipleCmds(
-		radix.Cmd(nil, "LPUSH", "csrf", str),
-		radix.Cmd(nil, "LTRIM", "csrf", "0", "999"), // Store only 1000 crsf tokens, might need to be increased later
-	)
-
-	return str, err
-}
-
-// CheckCSRFToken returns true if it matched and false if not, an error if something bad happened
-func CheckCSRFToken(token string) (bool, error) {
-	var num int
-	err := common.RedisPool.Do(radix.Cmd(&num, "LREM", "csrf", "1", token))
-	if err != nil {
-		return false, err
-	}
-	logger.Infof("%s in csrf token list removed with count %d", token, num)
-	return num > 0, nil
+	http.SetCookie(w, newSessionCookie("none", 0))
 }
 
 var ErrNotLoggedIn = errors.New("not logged in")
 
-// AuthTokenFromB64 Retrives an oauth2 token from the base64 string
+// discordAuthTokenFromYag retrieves the discord oauth2 token of the session from the session store
 // Returns an error if expired
 func discordAuthTokenFromYag(yagToken string) (t *oauth2.Token, err error) {
 	if yagToken == "none" {
 		return nil, ErrNotLoggedIn
 	}
 
-	// decodedB64, err := base64.URLEncoding.DecodeString(b64)
-	// if err != nil {
-	// 	return nil, common.ErrWithCaller(err)
-	// }
-
-	var b64 string
-	err = common.RedisPool.Do(radix.Cmd(&b64, "HGET", "web_sessions", yagToken))
+	t, err = Sessions.GetSession(yagToken)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal([]byte(b64), &t)
-	if err != nil {
-		return nil, common.ErrWithCaller(err)
+	if t == nil {
+		return nil, ErrNotLoggedIn
 	}
 
 	if !t.Valid() {
@@ -178,42 +157,66 @@ var (
 	ErrDuplicateToken = errors.New("somehow a duplicate token was found")
 )
 
-// CreateCookieSession creates a session cookie where the value is the access token itself,
-// this way we don't have to store it on our end anywhere.
+// SessionTTL returns how long a session lasts without any activity
+func SessionTTL() time.Duration {
+	return time.Hour * time.Duration(common.ConfSessionTTL.GetInt())
+}
+
+// CreateCookieSession creates a session cookie where the value is a random token,
+// the discord oauth2 token it maps to is kept in the session store and expires after SessionTTL unless extended by activity.
 func CreateCookieSession(token *oauth2.Token) (cookie *http.Cookie, err error) {
 	yagToken := RandBase64(64)
 
 	token.RefreshToken = ""
 
-	dataRaw, err := json.Marshal(token)
+	ttl := SessionTTL()
+	err = Sessions.CreateSession(yagToken, token, ttl)
 	if err != nil {
-		return nil, common.ErrWithCaller(err)
+		return nil, err
 	}
 
-	// Either the cookie expires in 30 days, or however long the validity of the token is if that is smaller than 7 days
-	cookieExpirey := time.Hour * 24 * 30
-	expiresFromNow := time.Until(token.Expiry)
-	if expiresFromNow < time.Hour*24*7 {
-		cookieExpirey = expiresFromNow
+	return newSessionCookie(yagToken, ttl), nil
+}
+
+// ExtendSession pushes the expiry of the session forward by SessionTTL, returning false if the session no longer exists
+func ExtendSession(yagToken string) (bool, error) {
+	return Sessions.ExtendSession(yagToken, SessionTTL())
+}
+
+func recordNewSession(r *http.Request, yagToken string) error {
+	session, err := discorddata.GetSession(yagToken, discordAuthTokenFromYag)
+	if err != nil {
+		return err
 	}
 
-	cookie = &http.Cookie{
+	user, err := discorddata.GetUserInfo(session.Token, session)
+	if err != nil {
+		return err
+	}
+
+	err = CreateSessionMeta(yagToken, user.ID, r)
+	if err != nil {
+		return err
+	}
+
+	EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventLogin, UserID: user.ID})
+	return nil
+}
+
+// DeleteSession removes the session from the session store, logging the user out
+func DeleteSession(yagToken string) error {
+	return Sessions.DeleteSession(yagToken)
+}
+
+func newSessionCookie(yagToken string, maxAge time.Duration) *http.Cookie {
+	return applyCookieAttributes(&http.Cookie{
 		// The old cookie name can safely be used after the old format has been phased out (after a day in use)
 		// Name:   "yagpdb-session",
 		Name:   SessionCookieName,
 		Value:  yagToken,
-		MaxAge: int(cookieExpirey.Seconds()),
+		MaxAge: int(maxAge.Seconds()),
 		Path:   "/",
-	}
-
-	// store token in redis
-	didSet := false
-	common.RedisPool.Do(radix.Cmd(&didSet, "HSETNX", "web_sessions", yagToken, string(dataRaw)))
-	if !didSet {
-		return nil, ErrDuplicateToken
-	}
-
-	return cookie, nil
+	})
 }
 
 func GetUserAccessLevel(userID int64, g *common.GuildWithConnected, config *models.CoreConfig, roleProvider func(guildID, userID int64) []int64) (hasRead bool, hasWrite bool) {
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+	"golang.org/x/oauth2"
+)
+
+func TestCookieSessionTTL(t *testing.T) {
+	defer func(old SessionStore) { Sessions = old }(Sessions)
+	Sessions = NewMemorySessionStore()
+
+	defer func(old interface{}) { common.ConfSessionTTL.LoadedValue = old }(common.ConfSessionTTL.LoadedValue)
+	common.ConfSessionTTL.LoadedValue = 2
+
+	cookie, err := CreateCookieSession(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cookie.Name != SessionCookieName || cookie.MaxAge != int((time.Hour*2).Seconds()) {
+		t.Errorf("unexpected cookie %#v", cookie)
+	}
+
+	token, err := discordAuthTokenFromYag(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "access" || token.RefreshToken != "" {
+		t.Errorf("expected the access token without the refresh token, got %#v", token)
+	}
+
+	if ok, err := ExtendSession(cookie.Value); !ok || err != nil {
+		t.Errorf("failed extending the session: %v", err)
+	}
+
+	if err := DeleteSession(cookie.Value); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := ExtendSession(cookie.Value); ok {
+		t.Error("extended a deleted session")
+	}
+
+	if _, err := discordAuthTokenFromYag(cookie.Value); err != ErrNotLoggedIn {
+		t.Errorf("expected ErrNotLoggedIn for a deleted session, got %v", err)
+	}
+}
+
+func TestDiscordAuthTokenFromYagExpired(t *testing.T) {
+	defer func(old SessionStore) { Sessions = old }(Sessions)
+	Sessions = NewMemorySessionStore()
+
+	Sessions.CreateSession("expired", &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(-time.Minute)}, time.Hour)
+	if _, err := discordAuthTokenFromYag("expired"); err != ErrTokenExpired {
+		t.Errorf("expected ErrTokenExpired, got %v", err)
+	}
+
+	if _, err := discordAuthTokenFromYag("none"); err != ErrNotLoggedIn {
+		t.Errorf("expected ErrNotLoggedIn for the logged out cookie, got %v", err)
+	}
+}
+
+func TestHandleLoginGoto(t *testing.T) {
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	defer withTestApplications("")()
+
+	// only paths on this site are kept, the rest fall back to /manage after logging in
+	cases := map[string]string{
+		"/manage/1/core":   "/manage/1/core",
+		"":                 "",
+		"//evil.com":       "",
+		"/\\evil.com":      "",
+		"https://evil.com": "",
+	}
+
+	for target, expected := range cases {
+		w := httptest.NewRecorder()
+		HandleLogin(w, httptest.NewRequest("GET", "/login?goto="+url.QueryEscape(target), nil))
+
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state := loc.Query().Get("state")
+		defer common.RedisPool.Do(radix.Cmd(nil, "DEL", keyOAuthState(state)))
+
+		var raw string
+		err = common.RedisPool.Do(radix.Cmd(&raw, "GET", keyOAuthState(state)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var st oauthState
+		if err := json.Unmarshal([]byte(raw), &st); err != nil {
+			t.Fatalf("%q: failed decoding the stored state: %v", target, err)
+		}
+
+		if st.Goto != expected {
+			t.Errorf("%q: got %q, expected %q", target, st.Goto, expected)
+		}
+	}
+}
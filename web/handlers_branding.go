@@ -0,0 +1,92 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/common/mqueue"
+)
+
+// discord allows bigger avatars, but they're stored in postgres and sent with every webhook edit
+const maxWebhookAvatarSize = 256000
+
+var panelLogKeyWebhookBranding = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+	Key:          "save_webhook_branding",
+	FormatString: "Updated webhook branding",
+})
+
+type WebhookBrandingForm struct {
+	Username     string `valid:",80"`
+	RemoveAvatar bool
+}
+
+func HandleGetCoreSettings(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, templateData := GetBaseCPContextData(r.Context())
+
+	branding, err := mqueue.GetWebhookBranding(g.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	setBrandingTemplateData(templateData, branding)
+
+	scheduled, err := GetScheduledConfigChanges(g.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	templateData["ScheduledConfigChanges"] = scheduled
+	return templateData, nil
+}
+
+// HandlePostWebhookBranding handles POST /manage/:server/core/branding
+func HandlePostWebhookBranding(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, templateData := GetBaseCPContextData(ctx)
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*WebhookBrandingForm)
+
+	current, err := mqueue.GetWebhookBranding(g.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	branding := &mqueue.WebhookBranding{
+		GuildID:  g.ID,
+		Username: form.Username,
+		Avatar:   current.Avatar,
+	}
+
+	if form.RemoveAvatar {
+		branding.Avatar = ""
+	}
+
+	upload, err := ReadImageUpload(r, "Avatar", maxWebhookAvatarSize)
+	if err != nil {
+		return templateData, err
+	}
+
+	if upload != nil {
+		branding.Avatar = upload.DataURI()
+	}
+
+	err = mqueue.SaveWebhookBranding(branding)
+	if err != nil {
+		return templateData, err
+	}
+
+	setBrandingTemplateData(templateData, branding)
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyWebhookBranding))
+
+	return templateData, nil
+}
+
+func setBrandingTemplateData(templateData TemplateData, branding *mqueue.WebhookBranding) {
+	templateData["WebhookBranding"] = branding
+
+	// we validated it ourselves on upload, so it's safe to use as a img src
+	templateData["WebhookBrandingAvatar"] = template.URL(branding.Avatar)
+}
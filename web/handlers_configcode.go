@@ -0,0 +1,287 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/common/models"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/botlabs-gg/yagpdb/v2/web/configcode"
+	"github.com/volatiletech/sqlboiler/boil"
+)
+
+// max size of a config document that can be applied
+const maxConfigCodeSize = 100000
+
+var panelLogKeyConfigCodeApplied = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+	Key:          "config_code_applied",
+	FormatString: "Applied settings from config code: %s",
+})
+
+func configCodePlugins() []PluginWithConfigCode {
+	var result []PluginWithConfigCode
+	for _, v := range common.Plugins {
+		if p, ok := v.(PluginWithConfigCode); ok {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+func findConfigCodePlugin(name string) PluginWithConfigCode {
+	for _, v := range configCodePlugins() {
+		if v.ConfigCodeName() == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// HandleExportConfigCode handles GET /manage/:server/config_code, exporting the settings of all supported plugins
+func HandleExportConfigCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	g := ContextGuild(ctx)
+
+	doc := &configcode.Document{}
+	for _, p := range configCodePlugins() {
+		form, err := p.ExportConfigCode(ctx, g.ID)
+		if err == nil {
+			var attrs map[string]interface{}
+			attrs, err = configcode.Encode(form)
+			if err == nil {
+				doc.Blocks = append(doc.Blocks, &configcode.Block{Name: p.ConfigCodeName(), Attributes: attrs})
+				continue
+			}
+		}
+
+		CtxLogger(ctx).WithError(err).WithField("plugin", p.ConfigCodeName()).Error("failed exporting config code")
+		http.Error(w, "Failed exporting settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"yagpdb-%d.conf\"", g.ID))
+	fmt.Fprintf(w, "# Settings for %s (%d)\n\n", g.Name, g.ID)
+	io.WriteString(w, configcode.Format(doc))
+}
+
+// ConfigCodeApplyResult is the response to applying config code
+type ConfigCodeApplyResult struct {
+	OK      bool     `json:"ok"`
+	Applied bool     `json:"applied"`
+	Changes []string `json:"changes"`
+	Errors  []string `json:"errors,omitempty"`
+
+	// Scheduled is set when the changes were scheduled to be applied at a later time
+	Scheduled *ScheduledConfigChange `json:"scheduled,omitempty"`
+}
+
+type pendingConfigCode struct {
+	plugin PluginWithConfigCode
+	form   interface{}
+}
+
+// HandleApplyConfigCode handles POST /manage/:server/config_code/apply, the body is either a config document or a form with it in the "config" field.
+// Only the plugins and settings present in the document are changed, with dry_run=1 the changes are only computed and validated.
+// All the changes are applied in a single transaction, so either everything or nothing is saved.
+func HandleApplyConfigCode(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	g := ContextGuild(ctx)
+
+	src, err := readConfigCodeBody(r)
+	if err != nil {
+		return err
+	}
+
+	pending, result, err := prepareConfigCode(ctx, g, src)
+	if err != nil {
+		return err
+	}
+
+	err = commitConfigCode(ctx, g.ID, pending, result, r.FormValue("dry_run") == "1")
+	if err != nil {
+		return err
+	}
+
+	return result
+}
+
+// commitConfigCode applies the prepared changes unless they didn't validate or it's a dry run, setting the outcome in
+// the result
+func commitConfigCode(ctx context.Context, guildID int64, pending []*pendingConfigCode, result *ConfigCodeApplyResult, dryRun bool) error {
+	if len(result.Errors) > 0 || dryRun || len(pending) < 1 {
+		result.OK = len(result.Errors) < 1
+		return nil
+	}
+
+	err := applyConfigCode(ctx, guildID, pending)
+	if err != nil {
+		if public, ok := err.(*PublicError); ok {
+			result.Errors = append(result.Errors, public.Error())
+			return nil
+		}
+
+		return err
+	}
+
+	summary := common.CutStringShort(strings.Join(result.Changes, "; "), 1000)
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyConfigCodeApplied, &cplogs.Param{Type: cplogs.ParamTypeString, Value: summary}))
+
+	result.OK = true
+	result.Applied = true
+	return nil
+}
+
+// prepareConfigCode parses and validates the document against the current settings, returning the plugins with changes,
+// the validation errors are returned in the result
+func prepareConfigCode(ctx context.Context, g *dstate.GuildSet, src string) ([]*pendingConfigCode, *ConfigCodeApplyResult, error) {
+	doc, err := configcode.Parse(src)
+	if err != nil {
+		return nil, &ConfigCodeApplyResult{Changes: []string{}, Errors: []string{err.Error()}}, nil
+	}
+
+	return prepareConfigBlocks(ctx, g, doc.Blocks)
+}
+
+// prepareConfigBlocks validates the blocks against the current settings, see prepareConfigCode
+func prepareConfigBlocks(ctx context.Context, g *dstate.GuildSet, blocks []*configcode.Block) ([]*pendingConfigCode, *ConfigCodeApplyResult, error) {
+	result := &ConfigCodeApplyResult{Changes: []string{}}
+
+	var pending []*pendingConfigCode
+	for _, block := range blocks {
+		p := findConfigCodePlugin(block.Name)
+		if p == nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("unknown plugin %q", block.Name))
+			continue
+		}
+
+		form, err := p.ExportConfigCode(ctx, g.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		current, err := configcode.Encode(form)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = configcode.Decode(block.Attributes, form)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("plugin %q: %s", block.Name, err))
+			continue
+		}
+
+		blockAlerts := TemplateData{}
+		if !ValidateForm(g, blockAlerts, form) {
+			for _, alert := range blockAlerts.Alerts() {
+				result.Errors = append(result.Errors, fmt.Sprintf("plugin %q: %s", block.Name, alert.Message))
+			}
+			continue
+		}
+
+		updated, err := configcode.Encode(form)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		changes := configcode.DiffBlock(block.Name, current, updated)
+		if len(changes) < 1 {
+			continue
+		}
+
+		pending = append(pending, &pendingConfigCode{plugin: p, form: form})
+		for _, c := range changes {
+			result.Changes = append(result.Changes, c.String())
+		}
+	}
+
+	return pending, result, nil
+}
+
+func readConfigCodeBody(r *http.Request) (string, error) {
+	if v := r.FormValue("config"); v != "" {
+		return v, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxConfigCodeSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(body) > maxConfigCodeSize {
+		return "", NewPublicError("Config is too big")
+	}
+
+	return string(body), nil
+}
+
+// applyConfigCode saves the changes in a single transaction, evicting the caches of the plugins once committed
+func applyConfigCode(ctx context.Context, guildID int64, pending []*pendingConfigCode) error {
+	tx, err := common.PQ.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range pending {
+		err = v.plugin.ApplyConfigCode(ctx, tx, guildID, v.form)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range pending {
+		v.plugin.ConfigCodeApplied(guildID)
+	}
+
+	return nil
+}
+
+var _ PluginWithConfigCode = (*ControlPanelPlugin)(nil)
+
+func (p *ControlPanelPlugin) ConfigCodeName() string {
+	return "core"
+}
+
+func (p *ControlPanelPlugin) ExportConfigCode(ctx context.Context, guildID int64) (interface{}, error) {
+	conf := common.GetCoreServerConfCached(guildID)
+	return &CoreConfigPostForm{
+		AllowedReadOnlyRoles:    conf.AllowedReadOnlyRoles,
+		AllowedWriteRoles:       conf.AllowedWriteRoles,
+		AllowAllMembersReadOnly: conf.AllowAllMembersReadOnly,
+		AllowNonMembersReadOnly: conf.AllowNonMembersReadOnly,
+	}, nil
+}
+
+func (p *ControlPanelPlugin) ApplyConfigCode(ctx context.Context, tx *sql.Tx, guildID int64, form interface{}) error {
+	f := form.(*CoreConfigPostForm)
+	m := &models.CoreConfig{
+		GuildID:              guildID,
+		AllowedReadOnlyRoles: f.AllowedReadOnlyRoles,
+		AllowedWriteRoles:    f.AllowedWriteRoles,
+
+		AllowAllMembersReadOnly: f.AllowAllMembersReadOnly,
+		AllowNonMembersReadOnly: f.AllowNonMembersReadOnly,
+	}
+
+	return m.Upsert(ctx, tx, true, []string{"guild_id"}, boil.Infer(), boil.Infer())
+}
+
+func (p *ControlPanelPlugin) ConfigCodeApplied(guildID int64) {
+	common.CoreServerConfigCache.Delete(int(guildID))
+	pubsub.Publish("evict_core_config_cache", guildID, nil)
+}
@@ -20,10 +20,13 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
 	"github.com/botlabs-gg/yagpdb/v2/common/models"
 	"github.com/botlabs-gg/yagpdb/v2/common/patreon"
+	"github.com/botlabs-gg/yagpdb/v2/common/pluginhealth"
 	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/common/tracing"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
 	"github.com/botlabs-gg/yagpdb/v2/web/discordblog"
+	"github.com/botlabs-gg/yagpdb/v2/web/discorddata"
 	"github.com/mediocregopher/radix/v3"
 	"github.com/patrickmn/go-cache"
 	"goji.io/pat"
@@ -97,21 +100,68 @@ func HandleServerHome(w http.ResponseWriter, r *http.Request) (TemplateData, err
 
 	templateData["PluginContainers"] = containers
 
+	health, err := pluginhealth.GetStatuses()
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed retrieving plugin health")
+	} else {
+		templateData["UnhealthyPlugins"] = pluginhealth.Unhealthy(health)
+		templateData["PluginHealthChecked"] = true
+	}
+
 	return templateData, nil
 }
 
+// the entries on each page of the control panel logs
+const cpLogsPageSize = 50
+
 func HandleCPLogs(w http.ResponseWriter, r *http.Request) interface{} {
 	activeGuild, templateData := GetBaseCPContextData(r.Context())
 
-	logs, err := cplogs.GetEntries(activeGuild.ID, 100, 0)
+	// the ips of the other admins are only shown to those who can change the settings, not to read only users
+	showRequestInfo := !GetIsReadOnly(r.Context())
+	templateData["ShowRequestInfo"] = showRequestInfo
+
+	pagination := ParsePagination(r, cpLogsPageSize)
+	total, err := cplogs.CountEntries(activeGuild.ID)
 	if err != nil {
 		templateData.AddAlerts(ErrorAlert("Failed retrieving logs", err))
-	} else {
-		templateData["entries"] = logs
+		return templateData
+	}
+	pagination.SetTotal(total)
+
+	logs, err := cplogs.GetEntriesPage(activeGuild.ID, pagination.Limit(), pagination.Offset())
+	if err != nil {
+		templateData.AddAlerts(ErrorAlert("Failed retrieving logs", err))
+		return templateData
 	}
+
+	templateData["entries"] = logs
+	templateData.SetPagination(pagination)
+	templateData.SetExport(cpLogsExport(activeGuild.ID, logs, showRequestInfo))
 	return templateData
 }
 
+func cpLogsExport(guildID int64, logs []*cplogs.LogEntry, requestInfo bool) *ExportTable {
+	table := &ExportTable{
+		Name:    "control-panel-logs-" + discordgo.StrID(guildID),
+		Columns: []string{"id", "created_at", "author_id", "author_username", "action"},
+	}
+
+	if requestInfo {
+		table.Columns = append(table.Columns, "ip", "user_agent", "route")
+	}
+
+	for _, v := range logs {
+		row := []interface{}{v.LocalID, v.CreatedAt, discordgo.StrID(v.AuthorID), v.AuthorUsername, v.Action.String()}
+		if requestInfo {
+			row = append(row, v.Request.IP, v.Request.UserAgent, v.Request.Route)
+		}
+		table.AddRow(row...)
+	}
+
+	return table
+}
+
 func HandleSelectServer(w http.ResponseWriter, r *http.Request) interface{} {
 	_, tmpl := GetCreateTemplateData(r.Context())
 
@@ -341,7 +391,7 @@ func genFakeNodeStatuses(hosts int, nodes int, shards int) []*HostStatus {
 
 func HandleReconnectShard(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
 	ctx, tmpl := GetCreateTemplateData(r.Context())
-	tmpl["VisibleURL"] = "/status"
+	tmpl.SetVisibleURL("/status")
 
 	if user := ctx.Value(common.ContextKeyUser); user != nil {
 		cast := user.(*discordgo.User)
@@ -367,13 +417,18 @@ func HandleReconnectShard(w http.ResponseWriter, r *http.Request) (TemplateData,
 	if err != nil {
 		tmpl.AddAlerts(ErrorAlert(err.Error()))
 	}
+
+	if err := PurgePageCache("status"); err != nil {
+		CtxLogger(ctx).WithError(err).Error("failed purging the cached status page")
+	}
+
 	return HandleStatusHTML(w, r)
 }
 
 func HandleChanenlPermissions(w http.ResponseWriter, r *http.Request) interface{} {
 	g := r.Context().Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet)
 	c, _ := strconv.ParseInt(pat.Param(r, "channel"), 10, 64)
-	perms, err := botrest.GetChannelPermissions(g.ID, c)
+	perms, err := botrest.GetChannelPermissionsContext(r.Context(), g.ID, c)
 	if err != nil {
 		return err
 	}
@@ -383,8 +438,10 @@ func HandleChanenlPermissions(w http.ResponseWriter, r *http.Request) interface{
 
 var commandsRanToday = new(int64)
 
-func pollCommandsRan() {
+func pollCommandsRan(ctx context.Context) {
 	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+
 	for {
 		var result struct {
 			Count int64
@@ -399,7 +456,11 @@ func pollCommandsRan() {
 			atomic.StoreInt64(commandsRanToday, result.Count)
 		}
 
-		<-t.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
 	}
 }
 
@@ -491,7 +552,7 @@ func HandlePostCoreSettings(w http.ResponseWriter, r *http.Request) (TemplateDat
 
 	pubsub.Publish("evict_core_config_cache", g.ID, nil)
 
-	templateData["CoreConfig"] = m
+	templateData.SetCoreConfig(m)
 
 	go cplogs.RetryAddEntry(NewLogEntryFromContext(r.Context(), panelLogKeyCore))
 
@@ -502,13 +563,26 @@ func HandleGetManagedGuilds(w http.ResponseWriter, r *http.Request) (TemplateDat
 	ctx := r.Context()
 	_, templateData := GetBaseCPContextData(ctx)
 
+	accessibleGuilds, err := getManagedGuilds(ctx, false)
+	if err != nil {
+		return templateData, err
+	}
+
+	templateData["ManagedGuilds"] = accessibleGuilds
+
+	return templateData, nil
+}
+
+// getManagedGuilds returns the guilds the user is on and has access to the settings of, with write set only the ones
+// it can change the settings of
+func getManagedGuilds(ctx context.Context, write bool) ([]*common.GuildWithConnected, error) {
 	user := ContextUser(ctx)
 
 	// retrieve guilds this user is part of
 	// i really wish there was a easy to to invalidate this cache, but since there's not it just expires after 10 seconds
 	wrapped, err := GetUserGuilds(ctx)
 	if err != nil {
-		return templateData, err
+		return nil, err
 	}
 
 	nilled := make([]*common.GuildWithConnected, len(wrapped))
@@ -519,7 +593,7 @@ func HandleGetManagedGuilds(w http.ResponseWriter, r *http.Request) (TemplateDat
 	for i, g := range wrapped {
 		go func(j int, gwc *common.GuildWithConnected) {
 			conf := common.GetCoreServerConfCached(gwc.ID)
-			if HasAccesstoGuildSettings(user.ID, gwc, conf, basicRoleProvider, false) {
+			if HasAccesstoGuildSettings(user.ID, gwc, conf, basicRoleProvider, write) {
 				nilled[j] = gwc
 			}
 
@@ -536,9 +610,7 @@ func HandleGetManagedGuilds(w http.ResponseWriter, r *http.Request) (TemplateDat
 		}
 	}
 
-	templateData["ManagedGuilds"] = accessibleGuilds
-
-	return templateData, nil
+	return accessibleGuilds, nil
 }
 
 func basicRoleProvider(guildID, userID int64) []int64 {
@@ -562,17 +634,20 @@ func GetUserGuilds(ctx context.Context) ([]*common.GuildWithConnected, error) {
 	user := ContextUser(ctx)
 
 	// retrieve guilds this user is part of
-	// i really wish there was a easy to to invalidate this cache, but since there's not it just expires after 10 seconds
+	// this expires after 10 seconds, the owner's one is also cleared when the bot joins or leaves a server (see guildmembership.go)
 	var guilds []*discordgo.UserGuild
-	err := common.GetCacheDataJson(discordgo.StrID(user.ID)+":guilds", &guilds)
+	err := common.GetCacheDataJsonContext(ctx, keyUserGuildsCache(user.ID), &guilds)
 	if err != nil {
-		guilds, err = session.UserGuilds(0, 0, 0)
+		_, span := tracing.StartSpan(ctx, "discord GET /users/@me/guilds", tracing.KindClient)
+		guilds, err = discorddata.GetUserGuilds(session.Token, session)
+		span.SetError(err)
+		span.End()
 		if err != nil {
 			CtxLogger(ctx).WithError(err).Error("Failed getting user guilds")
 			return nil, err
 		}
 
-		LogIgnoreErr(common.SetCacheDataJson(discordgo.StrID(user.ID)+":guilds", 10, guilds))
+		LogIgnoreErr(common.SetCacheDataJsonContext(ctx, keyUserGuildsCache(user.ID), 10, guilds))
 	}
 
 	// wrap the guilds with some more info, such as wether the bot is on the server
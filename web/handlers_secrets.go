@@ -0,0 +1,179 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/common/secrets"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"goji.io/pat"
+)
+
+var (
+	panelLogKeySecretCreated = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "secret_created",
+		FormatString: "Created secret %s",
+	})
+	panelLogKeySecretRotated = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "secret_rotated",
+		FormatString: "Rotated secret %s",
+	})
+	panelLogKeySecretDeleted = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "secret_deleted",
+		FormatString: "Deleted secret %s",
+	})
+)
+
+type CreateSecretForm struct {
+	Name  string `valid:",1,32"`
+	Value string `valid:",1,4000"`
+}
+
+type RotateSecretForm struct {
+	Value string `valid:",1,4000"`
+}
+
+type DeleteSecretForm struct {
+	Confirm bool
+}
+
+// secretsPublicError turns the errors caused by the user into public ones
+func secretsPublicError(err error) error {
+	switch err {
+	case secrets.ErrNotFound:
+		return NewPublicError("Unknown secret")
+	case secrets.ErrDisabled, secrets.ErrInvalidName, secrets.ErrTooMany:
+		return NewPublicError(err.Error())
+	}
+
+	return err
+}
+
+// HandleGetSecrets handles GET /manage/:server/secrets, the values are never shown, only when they were set and used
+func HandleGetSecrets(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+
+	tmpl["SecretsEnabled"] = secrets.Enabled()
+
+	list, err := secrets.List(ctx, g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	refs, err := secrets.GetReferences(ctx, g.ID, "")
+	if err != nil {
+		return tmpl, err
+	}
+
+	bySecret := make(map[string][]*secrets.Reference)
+	for _, v := range refs {
+		bySecret[v.Secret] = append(bySecret[v.Secret], v)
+	}
+
+	tmpl["Secrets"] = list
+	tmpl["SecretReferences"] = bySecret
+	tmpl["MaxSecrets"] = secrets.MaxSecretsPerGuild
+	return tmpl, nil
+}
+
+// HandleCreateSecret handles POST /manage/:server/secrets/new
+func HandleCreateSecret(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/secrets")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*CreateSecretForm)
+
+	existing, err := findSecret(r, form.Name)
+	if err != nil {
+		return tmpl, err
+	}
+
+	if existing != nil {
+		return tmpl, NewPublicError("A secret with that name already exists, rotate it instead")
+	}
+
+	_, err = secrets.Set(ctx, g.ID, form.Name, form.Value)
+	if err != nil {
+		return tmpl, secretsPublicError(err)
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeySecretCreated, &cplogs.Param{Type: cplogs.ParamTypeString, Value: form.Name}))
+	return tmpl, nil
+}
+
+// HandleRotateSecret handles POST /manage/:server/secrets/:name/rotate, replacing the value of a existing secret
+func HandleRotateSecret(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/secrets")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*RotateSecretForm)
+	name := pat.Param(r, "name")
+
+	existing, err := findSecret(r, name)
+	if err != nil {
+		return tmpl, err
+	}
+
+	if existing == nil {
+		return tmpl, NewPublicError("Unknown secret")
+	}
+
+	_, err = secrets.Set(ctx, g.ID, name, form.Value)
+	if err != nil {
+		return tmpl, secretsPublicError(err)
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeySecretRotated, &cplogs.Param{Type: cplogs.ParamTypeString, Value: name}))
+	return tmpl, nil
+}
+
+// HandleDeleteSecret handles POST /manage/:server/secrets/:name/delete, if integrations use the secret
+// it has to be confirmed as they will stop working
+func HandleDeleteSecret(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/secrets")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*DeleteSecretForm)
+	name := pat.Param(r, "name")
+
+	if !form.Confirm {
+		refs, err := secrets.GetReferences(ctx, g.ID, name)
+		if err != nil {
+			return tmpl, err
+		}
+
+		if len(refs) > 0 {
+			tmpl["ConfirmDeleteSecret"] = name
+			tmpl["ConfirmDeleteReferences"] = refs
+			return tmpl, NewPublicError("The secret ", name, " is used by ", len(refs), " integration(s) that will stop working if it's deleted, confirm below to delete it anyways")
+		}
+	}
+
+	err := secrets.Delete(ctx, g.ID, name)
+	if err != nil {
+		return tmpl, secretsPublicError(err)
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeySecretDeleted, &cplogs.Param{Type: cplogs.ParamTypeString, Value: name}))
+	return tmpl, nil
+}
+
+func findSecret(r *http.Request, name string) (*secrets.Secret, error) {
+	list, err := secrets.List(r.Context(), ContextGuild(r.Context()).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range list {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/internalapi"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const (
+	// how long a single check may take before it's considered failed
+	healthCheckTimeout = time.Second * 3
+
+	// results are cached this long, so a lot of load balancers checking doesn't turn into a lot of pings (and discord requests)
+	healthCacheDuration = time.Second * 5
+
+	// sent in the Retry-After header while draining, by then another instance should have taken over
+	shutdownRetryAfter = "60"
+)
+
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusDegraded     = "degraded"
+	HealthStatusFail         = "fail"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+// HealthCheck is the result of checking a single dependency
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+
+	// The control panel can't serve anything without critical dependencies, the others only affect some pages
+	Critical bool `json:"critical"`
+}
+
+// HealthReport is the response of /healthz
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks"`
+	Time   time.Time               `json:"time"`
+}
+
+var (
+	cachedHealthReport *HealthReport
+	healthCacheL       sync.Mutex
+)
+
+// runHealthCheck times f, failing it if it takes longer than healthCheckTimeout
+func runHealthCheck(ctx context.Context, critical bool, f func(ctx context.Context) error) *HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = errors.New("timed out")
+	}
+
+	check := &HealthCheck{
+		Status:    HealthStatusOK,
+		LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+		Critical:  critical,
+	}
+
+	if err != nil {
+		check.Status = HealthStatusFail
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+func checkRedisHealth(ctx context.Context) error {
+	return common.RedisPool.Do(radix.Cmd(nil, "PING"))
+}
+
+// checkBotrestHealth pings the bot process running shard 0, which the status page and most guild data depends on
+func checkBotrestHealth(ctx context.Context) error {
+	addr := internalapi.GetServerAddrForShard(0)
+	if addr == "" {
+		return internalapi.ErrCantFindAddress
+	}
+
+	var pong string
+	return internalapi.GetWithAddressContext(ctx, addr, "ping", &pong)
+}
+
+func checkDiscordHealth(ctx context.Context) error {
+	_, err := common.BotSession.Gateway()
+	return err
+}
+
+// summarizeHealth returns the overall status of the checks and the http status code to respond with, load balancers
+// only take the control panel out of rotation if a critical check failed or it's shutting down
+func summarizeHealth(checks map[string]*HealthCheck, acceptingRequests bool) (string, int) {
+	if !acceptingRequests {
+		return HealthStatusShuttingDown, http.StatusServiceUnavailable
+	}
+
+	status := HealthStatusOK
+	for _, v := range checks {
+		if v.Status == HealthStatusOK {
+			continue
+		}
+
+		if v.Critical {
+			return HealthStatusFail, http.StatusServiceUnavailable
+		}
+
+		status = HealthStatusDegraded
+	}
+
+	return status, http.StatusOK
+}
+
+// getHealthReport runs the checks, or returns the cached report. The checks don't use the context of the request as
+// the result is shared with other requests.
+func getHealthReport() *HealthReport {
+	healthCacheL.Lock()
+	defer healthCacheL.Unlock()
+
+	if cachedHealthReport != nil && time.Since(cachedHealthReport.Time) < healthCacheDuration {
+		return cachedHealthReport
+	}
+
+	checkFuncs := map[string]func(ctx context.Context) error{
+		"redis":   checkRedisHealth,
+		"botrest": checkBotrestHealth,
+		"discord": checkDiscordHealth,
+	}
+
+	var wg sync.WaitGroup
+	var resultsL sync.Mutex
+	checks := make(map[string]*HealthCheck, len(checkFuncs))
+	for name, f := range checkFuncs {
+		wg.Add(1)
+		go func(name string, f func(ctx context.Context) error) {
+			defer wg.Done()
+
+			check := runHealthCheck(context.Background(), name == "redis", f)
+			resultsL.Lock()
+			checks[name] = check
+			resultsL.Unlock()
+		}(name, f)
+	}
+	wg.Wait()
+
+	cachedHealthReport = &HealthReport{
+		Checks: checks,
+		Time:   time.Now(),
+	}
+	return cachedHealthReport
+}
+
+// HandleHealthz handles GET /healthz, meant for load balancer checks
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := *getHealthReport()
+
+	// not cached as it changes the moment we start shutting down
+	var code int
+	report.Status, code = summarizeHealth(report.Checks, IsAcceptingRequests())
+
+	writeProbeResponse(w, code, report)
+}
+
+// isProbePath returns true for the health check endpoints of the load balancers
+func isProbePath(path string) bool {
+	return path == "/healthz" || path == "/ready" || path == "/live"
+}
+
+func writeProbeResponse(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if code == http.StatusServiceUnavailable && !IsAcceptingRequests() {
+		w.Header().Set("Retry-After", shutdownRetryAfter)
+	}
+
+	w.WriteHeader(code)
+	LogIgnoreErr(json.NewEncoder(w).Encode(body))
+}
+
+// writeShuttingDown responds to requests made while draining, the 503 makes proxies stop routing traffic here
+func writeShuttingDown(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", shutdownRetryAfter)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"error":"Shutting down, try again in a minute"}`))
+}
+
+// HandleReady handles GET /ready, the readiness probe: if this instance should get traffic. It fails while draining
+// and while redis is unreachable, unlike /healthz it doesn't check the other dependencies.
+func HandleReady(w http.ResponseWriter, r *http.Request) {
+	if !IsAcceptingRequests() {
+		writeProbeResponse(w, http.StatusServiceUnavailable, map[string]string{"status": HealthStatusShuttingDown})
+		return
+	}
+
+	check := runHealthCheck(r.Context(), true, checkRedisHealth)
+	if check.Status != HealthStatusOK {
+		writeProbeResponse(w, http.StatusServiceUnavailable, map[string]interface{}{"status": HealthStatusFail, "checks": map[string]*HealthCheck{"redis": check}})
+		return
+	}
+
+	writeProbeResponse(w, http.StatusOK, map[string]string{"status": HealthStatusOK})
+}
+
+// HandleLive handles GET /live, the liveness probe: the process is up and serving requests, even while draining so
+// it's not restarted before it's done
+func HandleLive(w http.ResponseWriter, r *http.Request) {
+	writeProbeResponse(w, http.StatusOK, map[string]string{"status": HealthStatusOK})
+}
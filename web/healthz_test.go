@@ -0,0 +1,80 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSummarizeHealth(t *testing.T) {
+	ok := &HealthCheck{Status: HealthStatusOK, Critical: true}
+	failed := &HealthCheck{Status: HealthStatusFail}
+	failedCritical := &HealthCheck{Status: HealthStatusFail, Critical: true}
+
+	tests := []struct {
+		checks    map[string]*HealthCheck
+		accepting bool
+		status    string
+		code      int
+	}{
+		{map[string]*HealthCheck{"redis": ok}, true, HealthStatusOK, http.StatusOK},
+		{map[string]*HealthCheck{"redis": ok, "discord": failed}, true, HealthStatusDegraded, http.StatusOK},
+		{map[string]*HealthCheck{"redis": failedCritical, "discord": failed}, true, HealthStatusFail, http.StatusServiceUnavailable},
+		{map[string]*HealthCheck{"redis": ok}, false, HealthStatusShuttingDown, http.StatusServiceUnavailable},
+	}
+
+	for i, test := range tests {
+		status, code := summarizeHealth(test.checks, test.accepting)
+		if status != test.status || code != test.code {
+			t.Errorf("%d: got %s %d, expected %s %d", i, status, code, test.status, test.code)
+		}
+	}
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	check := runHealthCheck(context.Background(), true, func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	if check.Status != HealthStatusFail || check.Error != "connection refused" || !check.Critical {
+		t.Errorf("unexpected result of a failing check: %+v", check)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	check = runHealthCheck(ctx, false, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	if check.Status != HealthStatusFail || check.Error != "timed out" {
+		t.Errorf("expected a check taking too long to fail, got %+v", check)
+	}
+}
+
+func TestWriteShuttingDown(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeShuttingDown(rec)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, expected 503", rec.Code)
+	}
+
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+}
+
+func TestIsProbePath(t *testing.T) {
+	for _, v := range []string{"/healthz", "/ready", "/live"} {
+		if !isProbePath(v) {
+			t.Errorf("expected %s to be a probe", v)
+		}
+	}
+
+	if isProbePath("/readyz/extra") || isProbePath("/manage") {
+		t.Error("expected other paths to not be probes")
+	}
+}
@@ -0,0 +1,385 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/frontend"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+)
+
+var confDefaultLanguage = config.RegisterOption("yagpdb.web.default_language", "Language of the control panel for users whose browser doesn't ask for an available one", SourceLanguage)
+
+// SourceLanguage is the language the messages are written in, in the code and templates. The message catalogs of the
+// other languages map those messages to their translation.
+const SourceLanguage = "en"
+
+const languageCookieName = "lang"
+
+// the message catalog of a language, the embedded ones are in frontend/locales/<language>.json
+type messageCatalog struct {
+	Name     string            `json:"name"`
+	Messages map[string]string `json:"messages"`
+}
+
+var messageCatalogs = map[string]*messageCatalog{
+	SourceLanguage: {Name: "English", Messages: make(map[string]string)},
+}
+
+func init() {
+	err := fs.WalkDir(frontend.Locales, "locales", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".json" {
+			return err
+		}
+
+		raw, err := frontend.Locales.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		var catalog *messageCatalog
+		if err := json.Unmarshal(raw, &catalog); err != nil {
+			return errors.WithMessage(err, p)
+		}
+
+		RegisterMessages(strings.TrimSuffix(path.Base(p), ".json"), catalog.Name, catalog.Messages)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterMessages adds translations of messages to the catalog of the language, e.g for the strings of a plugin's
+// page. The name is what the language is called in the language picker, it's only used if the language is new.
+func RegisterMessages(lang, name string, messages map[string]string) {
+	lang = strings.ToLower(lang)
+
+	catalog, ok := messageCatalogs[lang]
+	if !ok {
+		catalog = &messageCatalog{Name: name, Messages: make(map[string]string)}
+		messageCatalogs[lang] = catalog
+	}
+
+	for k, v := range messages {
+		catalog.Messages[k] = v
+	}
+}
+
+// Language is a language the control panel is available in
+type Language struct {
+	Code string
+	Name string
+}
+
+// Languages returns the available languages, sorted by their code
+func Languages() []*Language {
+	result := make([]*Language, 0, len(messageCatalogs))
+	for k, v := range messageCatalogs {
+		result = append(result, &Language{Code: k, Name: v.Name})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Code < result[j].Code
+	})
+
+	return result
+}
+
+// Translate returns the translation of the message, or the message itself if it isn't translated to the language
+func Translate(lang, msg string) string {
+	if catalog, ok := messageCatalogs[lang]; ok {
+		if translated, ok := catalog.Messages[msg]; ok && translated != "" {
+			return translated
+		}
+	}
+
+	return msg
+}
+
+// Translatef translates the format and formats it with the args, the args are translated too if they're a
+// Localizer or a error. It's the "tr" template func: {{tr $.Language "Saved %d commands" .Count}}
+func Translatef(lang, format string, args ...interface{}) string {
+	translated := Translate(lang, format)
+	if len(args) == 0 {
+		return translated
+	}
+
+	localized := make([]interface{}, len(args))
+	for i, v := range args {
+		switch t := v.(type) {
+		case Localizer:
+			localized[i] = t.Localize(lang)
+		case error:
+			localized[i] = Translate(lang, t.Error())
+		default:
+			localized[i] = v
+		}
+	}
+
+	return fmt.Sprintf(translated, localized...)
+}
+
+// tmplTranslate is Translatef for templates, pages rendered without LanguageMiddleware (e.g error pages) don't have a
+// language in their template data, they're shown in the default language
+func tmplTranslate(lang interface{}, format string, args ...interface{}) string {
+	code, _ := lang.(string)
+	if code == "" {
+		code = defaultLanguage()
+	}
+
+	return Translatef(code, format, args...)
+}
+
+// Localizer is implemented by messages that can be shown in another language
+type Localizer interface {
+	Localize(lang string) string
+}
+
+// Message is a message translated when it's shown to the user, it can be returned as an error or passed to the alert
+// constructors: ErrorAlert(Msg("Too many commands, max %d", max))
+type Message struct {
+	Format string
+	Args   []interface{}
+}
+
+var (
+	_ Localizer = (*Message)(nil)
+	_ error     = (*Message)(nil)
+)
+
+func Msg(format string, args ...interface{}) *Message {
+	return &Message{Format: format, Args: args}
+}
+
+func (m *Message) Localize(lang string) string {
+	return Translatef(lang, m.Format, m.Args...)
+}
+
+func (m *Message) String() string {
+	return m.Localize(SourceLanguage)
+}
+
+func (m *Message) Error() string {
+	return m.String()
+}
+
+// supportedLanguage returns the available language matching the code, falling back to the base language of regional
+// variants, e.g de-AT to de
+func supportedLanguage(code string) (string, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if _, ok := messageCatalogs[code]; ok {
+		return code, true
+	}
+
+	if i := strings.IndexAny(code, "-_"); i > 0 {
+		if _, ok := messageCatalogs[code[:i]]; ok {
+			return code[:i], true
+		}
+	}
+
+	return "", false
+}
+
+// acceptedLanguages returns the languages in the Accept-Language header, most preferred first
+func acceptedLanguages(header string) []string {
+	type accepted struct {
+		code string
+		q    float64
+	}
+
+	var langs []accepted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		code := strings.TrimSpace(fields[0])
+		if code == "" || code == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if q > 0 {
+			langs = append(langs, accepted{code: code, q: q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	result := make([]string, len(langs))
+	for i, v := range langs {
+		result[i] = v.code
+	}
+
+	return result
+}
+
+// detectLanguage returns the language picked with the language cookie, or the most preferred available one of the
+// browser
+func detectLanguage(r *http.Request) string {
+	if cookie, err := r.Cookie(languageCookieName); err == nil {
+		if lang, ok := supportedLanguage(cookie.Value); ok {
+			return lang
+		}
+	}
+
+	for _, v := range acceptedLanguages(r.Header.Get("Accept-Language")) {
+		if lang, ok := supportedLanguage(v); ok {
+			return lang
+		}
+	}
+
+	return defaultLanguage()
+}
+
+func defaultLanguage() string {
+	if lang, ok := supportedLanguage(confDefaultLanguage.GetString()); ok {
+		return lang
+	}
+
+	return SourceLanguage
+}
+
+func keyUserLanguage(userID int64) string {
+	return "user_language:" + discordgo.StrID(userID)
+}
+
+// LanguageMiddleware picks the language of the request: the one the user picked, from the cookie or their account if
+// they're logged in on a new browser, and otherwise the browser's preferred one
+func LanguageMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var lang string
+		if _, err := r.Cookie(languageCookieName); err != nil {
+			lang = userLanguage(r)
+			if lang != "" {
+				http.SetCookie(w, languageCookie(lang))
+			}
+		}
+
+		if lang == "" {
+			lang = detectLanguage(r)
+		}
+
+		w.Header().Add("Vary", "Accept-Language")
+
+		ctx = context.WithValue(ctx, common.ContextKeyLanguage, lang)
+		ctx, tmpl := GetCreateTemplateData(ctx)
+		tmpl.SetLanguage(lang)
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// userLanguage returns the language the logged in user picked, empty if they didn't
+func userLanguage(r *http.Request) string {
+	user, ok := r.Context().Value(common.ContextKeyUser).(*discordgo.User)
+	if !ok || RedisDegraded() {
+		return ""
+	}
+
+	var stored string
+	err := common.RedisPool.Do(radix.Cmd(&stored, "GET", keyUserLanguage(user.ID)))
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed retrieving the language of the user")
+		return ""
+	}
+
+	lang, _ := supportedLanguage(stored)
+	return lang
+}
+
+// RequestLanguage returns the language of the request, also for the requests LanguageMiddleware didn't run for
+func RequestLanguage(r *http.Request) string {
+	if lang, ok := r.Context().Value(common.ContextKeyLanguage).(string); ok {
+		return lang
+	}
+
+	return detectLanguage(r)
+}
+
+// ContextLanguage returns the language set by LanguageMiddleware, the default language if it's not set
+func ContextLanguage(ctx context.Context) string {
+	if lang, ok := ctx.Value(common.ContextKeyLanguage).(string); ok {
+		return lang
+	}
+
+	return defaultLanguage()
+}
+
+// T translates the message to the language of the request
+func T(ctx context.Context, format string, args ...interface{}) string {
+	return Translatef(ContextLanguage(ctx), format, args...)
+}
+
+func languageCookie(lang string) *http.Cookie {
+	return applyCookieAttributes(&http.Cookie{
+		Name:    languageCookieName,
+		Value:   lang,
+		Path:    "/",
+		Expires: time.Now().Add(time.Hour * 24 * 365),
+	})
+}
+
+// HandleSetLanguage changes the language of the control panel, for the account too if the user is logged in
+func HandleSetLanguage(w http.ResponseWriter, r *http.Request) {
+	lang, ok := supportedLanguage(r.FormValue("lang"))
+	if !ok {
+		http.Error(w, "Unknown language", http.StatusBadRequest)
+		return
+	}
+
+	if user, ok := r.Context().Value(common.ContextKeyUser).(*discordgo.User); ok {
+		err := common.RedisPool.Do(radix.Cmd(nil, "SET", keyUserLanguage(user.ID), lang))
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed saving the language of the user")
+		}
+	}
+
+	http.SetCookie(w, languageCookie(lang))
+
+	// back to the page the language was picked on
+	redir := "/"
+	if referer := r.Referer(); isSameOrigin(referer) {
+		if parsed, err := url.Parse(referer); err == nil {
+			redir = parsed.RequestURI()
+		}
+	}
+
+	http.Redirect(w, r, redir, http.StatusSeeOther)
+}
+
+// localizeAlerts translates the alerts of the page to the language of the request
+func localizeAlerts(r *http.Request, data interface{}) {
+	tmplData, ok := data.(TemplateData)
+	if !ok {
+		return
+	}
+
+	lang := RequestLanguage(r)
+	for _, v := range tmplData.Alerts() {
+		v.localize(lang)
+	}
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAcceptedLanguages(t *testing.T) {
+	got := acceptedLanguages("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.95, *;q=0.5, nl;q=0")
+	expected := []string{"fr-CH", "de", "fr", "en"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	defer func(old map[string]*messageCatalog) { messageCatalogs = old }(messageCatalogs)
+	messageCatalogs = map[string]*messageCatalog{
+		SourceLanguage: {Name: "English"},
+		"de":           {Name: "Deutsch"},
+		"fr":           {Name: "Français"},
+	}
+
+	cases := []struct {
+		acceptLanguage string
+		cookie         string
+		expected       string
+	}{
+		{"", "", SourceLanguage},
+		{"de-AT,de;q=0.9", "", "de"},
+		{"nl,fr;q=0.5", "", "fr"},
+		{"nl", "", SourceLanguage},
+		{"de", "fr", "fr"},
+		{"de", "xx", "de"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", c.acceptLanguage)
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: languageCookieName, Value: c.cookie})
+		}
+
+		if got := detectLanguage(r); got != c.expected {
+			t.Errorf("%q with cookie %q: got %s, expected %s", c.acceptLanguage, c.cookie, got, c.expected)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if _, ok := messageCatalogs["de"]; !ok {
+		t.Fatal("expected the embedded catalogs to be loaded")
+	}
+
+	defer func(old map[string]*messageCatalog) { messageCatalogs = old }(messageCatalogs)
+	messageCatalogs = map[string]*messageCatalog{SourceLanguage: {Name: "English", Messages: map[string]string{}}}
+	RegisterMessages("de", "Deutsch", map[string]string{
+		"%s: %s":             "%s – %s",
+		"too long (max %d)":  "zu lang (maximal %d)",
+		"channel not found":  "Kanal nicht gefunden",
+		"Sucessfully saved!": "Erfolgreich gespeichert!",
+	})
+
+	if got := Translate("de", "Untranslated"); got != "Untranslated" {
+		t.Errorf("got %q, expected untranslated messages to be kept", got)
+	}
+
+	msg := Msg("%s: %s", "Name", Msg("too long (max %d)", 100))
+	if got := msg.Localize("de"); got != "Name – zu lang (maximal 100)" {
+		t.Errorf("got %q, expected the message and its args to be translated", got)
+	}
+	if got := msg.Error(); got != "Name: too long (max 100)" {
+		t.Errorf("got %q, expected the source message as the error", got)
+	}
+
+	if got := Translatef("de", "%s: %s", "Channel", ErrChannelNotFound); got != "Channel – Kanal nicht gefunden" {
+		t.Errorf("got %q, expected the error to be translated", got)
+	}
+
+	alerts := TemplateData{}
+	alerts.AddAlerts(SucessAlert("Sucessfully saved!"), ErrorAlert(msg), ErrorAlert("Failed: ", msg))
+	for _, v := range alerts.Alerts() {
+		v.localize("de")
+	}
+
+	expected := []string{"Erfolgreich gespeichert!", "Name – zu lang (maximal 100)", "Failed: Name: too long (max 100)"}
+	for i, v := range alerts.Alerts() {
+		if v.Message != expected[i] {
+			t.Errorf("alert %d: got %q, expected %q", i, v.Message, expected[i])
+		}
+	}
+}
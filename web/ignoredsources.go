@@ -0,0 +1,181 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/bot/botrest"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/common/ignorelist"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+var panelLogKeyIgnoredSourcesUpdated = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+	Key:          "ignored_sources_updated",
+	FormatString: "Updated the ignored bots and webhooks",
+})
+
+// IgnoredSourcesForm holds the edits to the ignored bots and webhooks
+type IgnoredSourcesForm struct {
+	Entries []*IgnoredSourceForm
+}
+
+type IgnoredSourceForm struct {
+	SourceID   int64
+	Logs       bool
+	Reputation bool
+	Automod    bool
+	Remove     bool
+}
+
+// AddIgnoredSourceForm adds a bot or webhook, either picked from the known ones or by id
+type AddIgnoredSourceForm struct {
+	Source int64
+
+	ManualID   int64
+	ManualType string
+}
+
+func setIgnoredSourcesTemplateData(r *http.Request, tmpl TemplateData, guildID int64) error {
+	ctx := r.Context()
+	entries, err := ignorelist.GetEntries(ctx, guildID)
+	if err != nil {
+		return err
+	}
+	tmpl["IgnoredSources"] = entries
+	tmpl["MaxIgnoredSources"] = ignorelist.MaxEntries
+
+	integrations, err := botrest.GetIntegrations(ctx, guildID)
+	if err != nil {
+		// the list can still be edited, just not picked from
+		CtxLogger(ctx).WithError(err).Warn("failed retrieving the integrations of the guild")
+		tmpl.AddAlerts(WarningAlert("Couldn't retrieve the bots and webhooks of this server, add them by id instead"))
+	}
+
+	ignored := make(map[int64]bool, len(entries))
+	for _, e := range entries {
+		ignored[e.SourceID] = true
+	}
+
+	available := make([]*botrest.Integration, 0, len(integrations))
+	for _, v := range integrations {
+		if !ignored[v.ID] {
+			available = append(available, v)
+		}
+	}
+	tmpl["KnownIntegrations"] = available
+
+	return nil
+}
+
+// HandleGetIgnoredSources handles GET /manage/:server/ignored_sources
+func HandleGetIgnoredSources(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, tmpl := GetBaseCPContextData(r.Context())
+	return tmpl, setIgnoredSourcesTemplateData(r, tmpl, g.ID)
+}
+
+// HandlePostIgnoredSources handles POST /manage/:server/ignored_sources, editing and removing entries
+func HandlePostIgnoredSources(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/ignored_sources")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*IgnoredSourcesForm)
+
+	current, err := ignorelist.GetEntries(ctx, g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	edits := make(map[int64]*IgnoredSourceForm, len(form.Entries))
+	for _, v := range form.Entries {
+		if v != nil {
+			edits[v.SourceID] = v
+		}
+	}
+
+	updated := make([]*ignorelist.Entry, 0, len(current))
+	for _, e := range current {
+		edit, ok := edits[e.SourceID]
+		if !ok {
+			// added in the meantime
+			updated = append(updated, e)
+			continue
+		}
+
+		if edit.Remove {
+			continue
+		}
+
+		e.Logs, e.Reputation, e.Automod = edit.Logs, edit.Reputation, edit.Automod
+		updated = append(updated, e)
+	}
+
+	err = ignorelist.SetEntries(ctx, g.ID, updated)
+	if err != nil {
+		return tmpl, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyIgnoredSourcesUpdated))
+	return tmpl, nil
+}
+
+// HandleAddIgnoredSource handles POST /manage/:server/ignored_sources/add, the new entry is ignored by every feature
+func HandleAddIgnoredSource(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/ignored_sources")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*AddIgnoredSourceForm)
+
+	entry := &ignorelist.Entry{Logs: true, Reputation: true, Automod: true}
+	switch {
+	case form.Source != 0:
+		integrations, err := botrest.GetIntegrations(ctx, g.ID)
+		if err != nil {
+			return tmpl, err
+		}
+
+		for _, v := range integrations {
+			if v.ID == form.Source {
+				entry.SourceID, entry.SourceType, entry.Name = v.ID, v.Type, v.Name
+				break
+			}
+		}
+
+		if entry.SourceID == 0 {
+			return tmpl, NewPublicError("Unknown bot or webhook")
+		}
+	case form.ManualID != 0:
+		if form.ManualType != ignorelist.SourceBot && form.ManualType != ignorelist.SourceWebhook {
+			return tmpl, NewPublicError("Unknown type")
+		}
+
+		entry.SourceID, entry.SourceType, entry.Name = form.ManualID, form.ManualType, discordgo.StrID(form.ManualID)
+	default:
+		return tmpl, NewPublicError("Pick a bot or webhook, or enter its id")
+	}
+
+	current, err := ignorelist.GetEntries(ctx, g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	for _, e := range current {
+		if e.SourceID == entry.SourceID {
+			return tmpl, NewPublicError("That one is already ignored")
+		}
+	}
+
+	if len(current) >= ignorelist.MaxEntries {
+		return tmpl, NewPublicError("You can't ignore more than ", ignorelist.MaxEntries, " bots and webhooks")
+	}
+
+	err = ignorelist.SetEntries(ctx, g.ID, append(current, entry))
+	if err != nil {
+		return tmpl, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyIgnoredSourcesUpdated))
+	return tmpl, nil
+}
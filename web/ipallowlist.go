@@ -0,0 +1,158 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+var (
+	confAdminIPAllowlist = config.RegisterOption("yagpdb.web.admin_ip_allowlist", "Comma separated list of ips and CIDR ranges allowed to access the bot admin routes, empty to allow everyone", "")
+	confTrustedProxies   = config.RegisterOption("yagpdb.web.trusted_proxies", "Comma separated list of ips and CIDR ranges of reverse proxies (e.g nginx or Cloudflare) whose X-Forwarded-For, X-Real-IP and client ip headers are trusted", "")
+)
+
+// ipNetList is a parsed comma separated list of ips and CIDR ranges, cached until the raw option changes
+type ipNetList struct {
+	mu     sync.Mutex
+	raw    string
+	parsed []*net.IPNet
+}
+
+func (l *ipNetList) get(raw string) []*net.IPNet {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.parsed != nil && l.raw == raw {
+		return l.parsed
+	}
+
+	l.raw = raw
+	l.parsed = parseIPNets(raw)
+	return l.parsed
+}
+
+var (
+	adminIPAllowlist = &ipNetList{}
+	trustedProxies   = &ipNetList{}
+)
+
+// parseIPNets parses a comma separated list of ips and CIDR ranges, single ips are treated as a range of 1
+func parseIPNets(raw string) []*net.IPNet {
+	result := make([]*net.IPNet, 0)
+	for _, v := range strings.Split(raw, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				logger.Errorf("Invalid ip in ip list: %q", v)
+				continue
+			}
+
+			if ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			logger.WithError(err).Errorf("Invalid CIDR range in ip list: %q", v)
+			continue
+		}
+
+		result = append(result, ipNet)
+	}
+
+	return result
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trustedClientIP returns the ip of the client, only looking at the proxy headers if the request came from a trusted proxy
+func trustedClientIP(r *http.Request, proxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote := net.ParseIP(host)
+	if !ipInNets(remote, proxies) {
+		return remote
+	}
+
+	if headerField := confReverseProxyClientIPHeader.GetString(); headerField != "" && !strings.EqualFold(headerField, "X-Forwarded-For") {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get(headerField))); ip != nil {
+			return ip
+		}
+	}
+
+	forwardedHeaders := r.Header.Values("X-Forwarded-For")
+	if len(forwardedHeaders) < 1 {
+		// nginx's realip style header, a single address set by the proxy
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			return ip
+		}
+
+		return remote
+	}
+
+	// walk the chain from the right, the first address that isn't one of our proxies is the client
+	forwarded := strings.Split(strings.Join(forwardedHeaders, ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+
+		remote = ip
+		if !ipInNets(ip, proxies) {
+			break
+		}
+	}
+
+	return remote
+}
+
+// IPAllowlistMiddleware only lets through requests from the ips in the yagpdb.web.admin_ip_allowlist option,
+// meant for the bot owner and admin route groups
+func IPAllowlistMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := confAdminIPAllowlist.GetString()
+		if strings.TrimSpace(raw) == "" {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		// if none of the entries are valid nobody gets through, rather than everyone
+		allowed := adminIPAllowlist.get(raw)
+
+		ip := trustedClientIP(r, trustedProxies.get(confTrustedProxies.GetString()))
+		if !ipInNets(ip, allowed) {
+			CtxLogger(r.Context()).Warnf("Blocked request to %s from ip %s not in the allowlist", r.URL.Path, ip)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
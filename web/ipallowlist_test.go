@@ -0,0 +1,69 @@
+package web
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseIPNets(t *testing.T) {
+	nets := parseIPNets("10.0.0.0/8, 192.168.1.5,,2001:db8::/32, invalid")
+	if len(nets) != 3 {
+		t.Fatalf("expected 3 ranges, got %d", len(nets))
+	}
+
+	cases := map[string]bool{
+		"10.1.2.3":    true,
+		"11.0.0.1":    false,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"2001:db8::1": true,
+		"2001:db9::1": false,
+	}
+
+	for ip, expected := range cases {
+		if got := ipInNets(net.ParseIP(ip), nets); got != expected {
+			t.Errorf("%s: got %v, expected %v", ip, got, expected)
+		}
+	}
+}
+
+func TestTrustedClientIP(t *testing.T) {
+	proxies := parseIPNets("10.0.0.0/8")
+
+	cases := []struct {
+		Name      string
+		Remote    string
+		Forwarded string
+		RealIP    string
+		Expected  string
+	}{
+		{Name: "direct", Remote: "1.2.3.4:1000", Expected: "1.2.3.4"},
+		{Name: "untrusted remote", Remote: "1.2.3.4:1000", Forwarded: "5.6.7.8", Expected: "1.2.3.4"},
+		{Name: "trusted proxy", Remote: "10.0.0.1:1000", Forwarded: "5.6.7.8", Expected: "5.6.7.8"},
+		{Name: "spoofed chain", Remote: "10.0.0.1:1000", Forwarded: "9.9.9.9, 5.6.7.8, 10.0.0.2", Expected: "5.6.7.8"},
+		{Name: "only proxies", Remote: "10.0.0.1:1000", Forwarded: "10.0.0.3", Expected: "10.0.0.3"},
+		{Name: "garbage header", Remote: "10.0.0.1:1000", Forwarded: "nope", Expected: "10.0.0.1"},
+		{Name: "real ip", Remote: "10.0.0.1:1000", RealIP: "5.6.7.8", Expected: "5.6.7.8"},
+		{Name: "untrusted real ip", Remote: "1.2.3.4:1000", RealIP: "5.6.7.8", Expected: "1.2.3.4"},
+		{Name: "forwarded over real ip", Remote: "10.0.0.1:1000", Forwarded: "5.6.7.8", RealIP: "9.9.9.9", Expected: "5.6.7.8"},
+		{Name: "ipv6", Remote: "[2001:db8::1]:1000", Expected: "2001:db8::1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/admin", nil)
+			r.RemoteAddr = c.Remote
+			if c.Forwarded != "" {
+				r.Header.Set("X-Forwarded-For", c.Forwarded)
+			}
+			if c.RealIP != "" {
+				r.Header.Set("X-Real-IP", c.RealIP)
+			}
+
+			if got := trustedClientIP(r, proxies); got.String() != c.Expected {
+				t.Errorf("got %s, expected %s", got, c.Expected)
+			}
+		})
+	}
+}
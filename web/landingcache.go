@@ -0,0 +1,194 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/lifecycle"
+)
+
+var confLandingPageCacheInterval = config.RegisterOption("yagpdb.web.landing_page_cache_interval", "How often (in seconds) the cached logged out landing page is rendered again, 0 to disable the cache", 60)
+
+// the logged out pages only depend on these cookies
+type landingPageVariant struct {
+	lightTheme       bool
+	sidebarCollapsed bool
+}
+
+type cachedPage struct {
+	raw []byte
+
+	// the nonce the page was rendered with, it's replaced with a new one for every response so visitors can't
+	// learn the nonce of other visitors
+	nonce string
+}
+
+// withNonce returns the page with the nonce of the response in the inline scripts
+func (p *cachedPage) withNonce(nonce string) []byte {
+	return bytes.ReplaceAll(p.raw, []byte(p.nonce), []byte(nonce))
+}
+
+// loggedOutPage is a page that's the same for every logged out visitor, so it can be rendered ahead of time
+type loggedOutPage struct {
+	template string
+	handler  ControllerHandlerFunc
+}
+
+var (
+	// the pages served from the cache by path, the landing page and the ones added with CacheLoggedOutPage
+	loggedOutPages = make(map[string]*loggedOutPage)
+
+	landingPageCache   map[string]map[landingPageVariant]*cachedPage
+	landingPageCacheMU sync.RWMutex
+)
+
+// CacheLoggedOutPage serves the page at path to logged out visitors from memory, rendered by handler with the
+// template along with the landing page. The route still has to be registered for everyone else, call this in InitWeb.
+func CacheLoggedOutPage(path, template string, handler ControllerHandlerFunc) {
+	loggedOutPages[path] = &loggedOutPage{template: template, handler: handler}
+}
+
+// InvalidateLandingPageCache renders the cached logged out pages again, call this after the templates change
+func InvalidateLandingPageCache() {
+	if confLandingPageCacheInterval.GetInt() <= 0 || DevTemplates() {
+		return
+	}
+
+	pages := make(map[string]map[landingPageVariant]*cachedPage)
+	for path, p := range loggedOutPages {
+		pages[path] = make(map[landingPageVariant]*cachedPage)
+		for _, lightTheme := range []bool{false, true} {
+			for _, collapsed := range []bool{false, true} {
+				variant := landingPageVariant{lightTheme: lightTheme, sidebarCollapsed: collapsed}
+
+				page, err := renderLoggedOutPage(path, p, variant)
+				if err != nil {
+					logger.WithError(err).WithField("path", path).Error("failed rendering logged out page for the cache")
+					return
+				}
+
+				pages[path][variant] = page
+			}
+		}
+	}
+
+	landingPageCacheMU.Lock()
+	landingPageCache = pages
+	landingPageCacheMU.Unlock()
+}
+
+func renderLoggedOutPage(path string, p *loggedOutPage, variant landingPageVariant) (*cachedPage, error) {
+	nonce := newCSPNonce()
+	data := baseTemplateData(path, variant.lightTheme, variant.sidebarCollapsed).SetCSPNonce(nonce).SetLanguage(defaultLanguage())
+	ctx := SetContextTemplateData(context.Background(), data)
+	r, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := p.handler(nil, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = Templates.ExecuteTemplate(&buf, p.template, tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachedPage{raw: buf.Bytes(), nonce: nonce}, nil
+}
+
+func runLandingPageCacheLoop(ctx context.Context) {
+	for {
+		InvalidateLandingPageCache()
+
+		interval := confLandingPageCacheInterval.GetInt()
+		if interval <= 0 {
+			interval = 60
+		}
+
+		if !lifecycle.Sleep(ctx, time.Second*time.Duration(interval)) {
+			return
+		}
+	}
+}
+
+func cookieEnabled(r *http.Request, name string) bool {
+	cookie, err := r.Cookie(name)
+	return err == nil && cookie.Value != "false"
+}
+
+// loggedOutPageRequest returns true if the request is for one of the cached pages by a logged out visitor
+func loggedOutPageRequest(r *http.Request) bool {
+	if r.Method != "GET" || r.Header.Get("Authorization") != "" || loggedOutPages[r.URL.Path] == nil {
+		return false
+	}
+
+	// logged in
+	_, err := r.Cookie(SessionCookieName)
+	return err != nil
+}
+
+// cachedLoggedOutPage returns the cached page for the request, nil if it has to be rendered
+func cachedLoggedOutPage(r *http.Request) *cachedPage {
+	if !loggedOutPageRequest(r) || r.URL.RawQuery != "" {
+		return nil
+	}
+
+	if RequestLanguage(r) != defaultLanguage() {
+		// only the default language is cached in memory
+		return nil
+	}
+
+	variant := landingPageVariant{lightTheme: cookieEnabled(r, "light_theme"), sidebarCollapsed: cookieEnabled(r, "sidebar_collapsed")}
+
+	landingPageCacheMU.RLock()
+	page := landingPageCache[r.URL.Path][variant]
+	landingPageCacheMU.RUnlock()
+	return page
+}
+
+// landingPageCacheHandler serves the logged out landing page and the other cached pages straight from memory, as
+// they're by far the most requested pages. It's mounted in front of the root mux so these requests don't go through
+// its middlewares or touch redis, they only get the security headers. During maintenance the logged out visitors
+// get the maintenance page instead, logged in users are passed on to the maintenance middleware of the chain so bot
+// owners, who can still log in through /login, get through. Everything it doesn't have cached, and every request
+// while shutting down, is passed on to inner.
+func landingPageCacheHandler(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAcceptingRequests() {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if m := CurrentMaintenance(); m.Enabled {
+			if !loggedOutPageRequest(r) {
+				inner.ServeHTTP(w, r)
+				return
+			}
+
+			setSecurityHeaders(w.Header(), newCSPNonce())
+			writeMaintenanceResponse(w, r, m)
+			return
+		}
+
+		page := cachedLoggedOutPage(r)
+		if page == nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		nonce := newCSPNonce()
+		setSecurityHeaders(w.Header(), nonce)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Write(page.withNonce(nonce))
+	})
+}
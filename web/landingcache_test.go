@@ -0,0 +1,111 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLandingPageCacheHandler(t *testing.T) {
+	defer func(old map[string]map[landingPageVariant]*cachedPage) { landingPageCache = old }(landingPageCache)
+	landingPageCache = map[string]map[landingPageVariant]*cachedPage{
+		"/":                {{}: {raw: []byte(`<script nonce="rendered">hi()</script>`), nonce: "rendered"}},
+		"/developers/docs": {{lightTheme: true}: {raw: []byte(`<p>docs</p>`), nonce: "rendered"}},
+	}
+
+	defer func(old map[string]*loggedOutPage) { loggedOutPages = old }(loggedOutPages)
+	loggedOutPages = map[string]*loggedOutPage{"/": {template: "index"}, "/developers/docs": {template: "public_api_docs"}}
+
+	defer func(old interface{}) { confCSP.LoadedValue = old }(confCSP.LoadedValue)
+	confCSP.LoadedValue = defaultCSP
+
+	// the root mux and its middlewares
+	handler := landingPageCacheHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("rendered"))
+	}))
+
+	serve := func(r *http.Request) (*httptest.ResponseRecorder, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w, w.Body.String()
+	}
+
+	var nonces []string
+	for i := 0; i < 3; i++ {
+		w, body := serve(httptest.NewRequest("GET", "/", nil))
+
+		var nonce string
+		for _, v := range strings.Split(w.Header().Get(cspHeaderName()), " ") {
+			if strings.HasPrefix(v, "'nonce-") {
+				nonce = strings.TrimRight(strings.TrimPrefix(v, "'nonce-"), "';")
+			}
+		}
+
+		// every response gets the nonce of its request, matching the one in the header
+		if nonce == "" || body != `<script nonce="`+nonce+`">hi()</script>` {
+			t.Errorf("expected the nonce %q of the header in the page, got %q", nonce, body)
+		}
+
+		if w.Header().Get("Strict-Transport-Security") == "" || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("unexpected headers %v", w.Header())
+		}
+
+		for _, v := range nonces {
+			if v == nonce {
+				t.Errorf("the nonce %q was used twice", nonce)
+			}
+		}
+		nonces = append(nonces, nonce)
+	}
+
+	docs := httptest.NewRequest("GET", "/developers/docs", nil)
+	docs.AddCookie(&http.Cookie{Name: "light_theme", Value: "true"})
+	if _, body := serve(docs); body != "<p>docs</p>" {
+		t.Errorf("expected the cached docs page, got %q", body)
+	}
+
+	loggedIn := httptest.NewRequest("GET", "/", nil)
+	loggedIn.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "x"})
+	notCached := []*http.Request{
+		loggedIn,
+		httptest.NewRequest("GET", "/?ref=top", nil),
+		httptest.NewRequest("POST", "/", nil),
+		httptest.NewRequest("GET", "/developers/docs", nil),
+		httptest.NewRequest("GET", "/manage", nil),
+	}
+	for _, r := range notCached {
+		if _, body := serve(r); body != "rendered" {
+			t.Errorf("%s %s: expected the request to be passed on, got %q", r.Method, r.URL, body)
+		}
+	}
+
+	// logged out visitors get the maintenance page from the in-memory flag, the rest is left to the chain
+	defer func(old *Maintenance) { currentMaintenance.Store(old) }(CurrentMaintenance())
+	currentMaintenance.Store(&Maintenance{Enabled: true, Message: "Back soon"})
+	for _, path := range []string{"/", "/?ref=top", "/developers/docs"} {
+		if w, body := serve(httptest.NewRequest("GET", path, nil)); w.Code != http.StatusServiceUnavailable || body == "rendered" || w.Header().Get(cspHeaderName()) == "" {
+			t.Errorf("%s: expected the maintenance page, got %d: %q", path, w.Code, body)
+		}
+	}
+
+	for _, r := range []*http.Request{loggedIn, httptest.NewRequest("GET", "/login", nil), httptest.NewRequest("GET", "/manage", nil)} {
+		if _, body := serve(r); body != "rendered" {
+			t.Errorf("%s %s: expected the request to be passed on during maintenance, got %q", r.Method, r.URL, body)
+		}
+	}
+}
+
+func TestCacheLoggedOutPage(t *testing.T) {
+	defer func(old map[string]*loggedOutPage) { loggedOutPages = old }(loggedOutPages)
+	loggedOutPages = make(map[string]*loggedOutPage)
+
+	handler := func(w http.ResponseWriter, r *http.Request) (TemplateData, error) { return nil, nil }
+	CacheLoggedOutPage("/", "index", handler)
+	CacheLoggedOutPage("/", "index", handler)
+	CacheLoggedOutPage("/developers/docs", "public_api_docs", handler)
+
+	if len(loggedOutPages) != 2 || loggedOutPages["/developers/docs"].template != "public_api_docs" {
+		t.Errorf("unexpected pages %v", loggedOutPages)
+	}
+}
@@ -0,0 +1,327 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+	"golang.org/x/oauth2"
+)
+
+var (
+	confLinkedRoles             = config.RegisterOption("yagpdb.web.linked_roles", "Enables discord's linked roles, set the linked roles verification url of the application to https://<host>/linked_roles", false)
+	confLinkedRolesPlatformName = config.RegisterOption("yagpdb.web.linked_roles_platform_name", "The name shown on the linked roles connection of users", "YAGPDB")
+)
+
+const (
+	// how often the metadata of every linked user is pushed again
+	roleConnectionRefreshInterval = time.Hour * 24
+	roleConnectionPollInterval    = time.Minute
+	roleConnectionBatchSize       = 50
+
+	// the sorted set of all linked users by when their metadata is due to be pushed again
+	keyRoleConnectionsDue = "web_role_connections_due"
+)
+
+// errRoleConnectionRevoked is returned when the user deauthorized us, the connection is removed then
+var errRoleConnectionRevoked = errors.New("linked roles authorization revoked")
+
+func keyRoleConnection(userID int64) string {
+	return "web_role_connection:" + discordgo.StrID(userID)
+}
+
+// roleConnection is the authorization of a user to update their linked roles metadata
+type roleConnection struct {
+	UserID       int64     `json:"user_id,string"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+	LinkedAt     time.Time `json:"linked_at"`
+}
+
+func (c *roleConnection) token() *oauth2.Token {
+	return &oauth2.Token{AccessToken: c.AccessToken, RefreshToken: c.RefreshToken, Expiry: c.Expiry, TokenType: "Bearer"}
+}
+
+// RoleConnectionMetadataFields returns the linked roles metadata of all the plugins
+func RoleConnectionMetadataFields() []*RoleConnectionMetadata {
+	var result []*RoleConnectionMetadata
+	for _, v := range common.Plugins {
+		if p, ok := v.(PluginWithRoleConnectionMetadata); ok {
+			result = append(result, p.RoleConnectionMetadata()...)
+		}
+	}
+
+	return result
+}
+
+// registerRoleConnectionMetadata tells discord about the metadata fields servers can set up linked roles with
+func registerRoleConnectionMetadata() {
+	fields := RoleConnectionMetadataFields()
+	if len(fields) > 5 {
+		logger.Errorf("Discord allows at most 5 linked roles metadata fields, only registering the first 5 of %d", len(fields))
+		fields = fields[:5]
+	}
+
+	endpoint := discordgo.EndpointAPI + "applications/" + GetApplication(DefaultApplicationName).ClientID + "/role-connections/metadata"
+	_, err := common.BotSession.RequestWithBucketID("PUT", endpoint, fields, nil, endpoint)
+	if err != nil {
+		logger.WithError(err).Error("Failed registering the linked roles metadata")
+	}
+}
+
+// formatRoleConnectionValue converts the value to how discord expects it for the type of the field
+func formatRoleConnectionValue(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case int64:
+		return strconv.FormatInt(t, 10), true
+	case int:
+		return strconv.Itoa(t), true
+	case time.Time:
+		if t.IsZero() {
+			return "", false
+		}
+		return t.UTC().Format(time.RFC3339), true
+	case bool:
+		if t {
+			return "1", true
+		}
+		return "0", true
+	}
+
+	return "", false
+}
+
+// roleConnectionMetadataValues collects the values of the user from all the plugins, formatted for discord
+func roleConnectionMetadataValues(ctx context.Context, userID int64) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, v := range common.Plugins {
+		p, ok := v.(PluginWithRoleConnectionMetadata)
+		if !ok {
+			continue
+		}
+
+		values, err := p.RoleConnectionValues(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.PluginInfo().Name, err)
+		}
+
+		for k, value := range values {
+			if formatted, ok := formatRoleConnectionValue(value); ok {
+				result[k] = formatted
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// pushRoleConnection updates the metadata of the user on discord, refreshing the access token if it expired
+func pushRoleConnection(ctx context.Context, conn *roleConnection) error {
+	app := GetApplication(DefaultApplicationName)
+
+	token, err := app.OauthConf.TokenSource(ctx, conn.token()).Token()
+	if err != nil {
+		if retrieveErr, ok := err.(*oauth2.RetrieveError); ok && retrieveErr.Response != nil && retrieveErr.Response.StatusCode < 500 {
+			return errRoleConnectionRevoked
+		}
+
+		return errors.WithStackIf(err)
+	}
+
+	values, err := roleConnectionMetadataValues(ctx, conn.UserID)
+	if err != nil {
+		return err
+	}
+
+	session, err := discordgo.New(token.Type() + " " + token.AccessToken)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	body := map[string]interface{}{
+		"platform_name": confLinkedRolesPlatformName.GetString(),
+		"metadata":      values,
+	}
+
+	endpoint := discordgo.EndpointAPI + "users/@me/applications/" + app.ClientID + "/role-connection"
+	_, err = session.RequestWithBucketID("PUT", endpoint, body, nil, endpoint)
+	if err != nil {
+		if restErr, ok := err.(*discordgo.RESTError); ok && restErr.Response != nil && restErr.Response.StatusCode == http.StatusUnauthorized {
+			return errRoleConnectionRevoked
+		}
+
+		return errors.WithStackIf(err)
+	}
+
+	if token.AccessToken != conn.AccessToken {
+		conn.AccessToken = token.AccessToken
+		conn.RefreshToken = token.RefreshToken
+		conn.Expiry = token.Expiry
+	}
+
+	return saveRoleConnection(conn)
+}
+
+// saveRoleConnection stores the connection and schedules the next push of the metadata
+func saveRoleConnection(conn *roleConnection) error {
+	serialized, err := json.Marshal(conn)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	err = common.MultipleCmds(
+		radix.Cmd(nil, "SET", keyRoleConnection(conn.UserID), string(serialized)),
+		radix.FlatCmd(nil, "ZADD", keyRoleConnectionsDue, time.Now().Add(roleConnectionRefreshInterval).Unix(), conn.UserID),
+	)
+	return errors.WithStackIf(err)
+}
+
+func getRoleConnection(userID int64) (*roleConnection, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "GET", keyRoleConnection(userID)))
+	if err != nil || len(raw) == 0 {
+		return nil, errors.WithStackIf(err)
+	}
+
+	var conn *roleConnection
+	err = json.Unmarshal(raw, &conn)
+	return conn, errors.WithStackIf(err)
+}
+
+func deleteRoleConnection(userID int64) error {
+	return common.MultipleCmds(
+		radix.Cmd(nil, "DEL", keyRoleConnection(userID)),
+		radix.FlatCmd(nil, "ZREM", keyRoleConnectionsDue, userID),
+	)
+}
+
+func runRoleConnectionRefreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(roleConnectionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		refreshDueRoleConnections()
+	}
+}
+
+// refreshDueRoleConnections pushes the metadata of the users that haven't been updated within roleConnectionRefreshInterval
+func refreshDueRoleConnections() {
+	var due []int64
+	err := common.RedisPool.Do(radix.FlatCmd(&due, "ZRANGEBYSCORE", keyRoleConnectionsDue, "-inf", time.Now().Unix(), "LIMIT", 0, roleConnectionBatchSize))
+	if err != nil {
+		logger.WithError(err).Error("failed retrieving due linked roles connections")
+		return
+	}
+
+	for _, userID := range due {
+		// only one of the webservers pushes each user
+		locked, err := common.TryLockRedisKey("web_role_connection_lock:"+discordgo.StrID(userID), 60)
+		if err != nil || !locked {
+			continue
+		}
+
+		err = refreshRoleConnection(userID)
+		if err != nil {
+			logger.WithError(err).WithField("user", userID).Error("failed pushing linked roles metadata")
+		}
+	}
+}
+
+func refreshRoleConnection(userID int64) error {
+	conn, err := getRoleConnection(userID)
+	if err != nil {
+		return err
+	}
+
+	if conn == nil {
+		return common.RedisPool.Do(radix.FlatCmd(nil, "ZREM", keyRoleConnectionsDue, userID))
+	}
+
+	err = pushRoleConnection(context.Background(), conn)
+	if err == errRoleConnectionRevoked {
+		return deleteRoleConnection(userID)
+	}
+
+	if err != nil {
+		// try again next time around instead of right away
+		common.RedisPool.Do(radix.FlatCmd(nil, "ZADD", keyRoleConnectionsDue, time.Now().Add(time.Hour).Unix(), userID))
+	}
+
+	return err
+}
+
+// HandleLinkedRoles handles GET /linked_roles, the verification url of the linked roles where users connect their account
+func HandleLinkedRoles(w http.ResponseWriter, r *http.Request) {
+	if !confLinkedRoles.GetBool() {
+		http.NotFound(w, r)
+		return
+	}
+
+	st := &oauthState{LinkedRoles: true}
+	authURL, err := startOAuthFlow(w, GetApplication(DefaultApplicationName), st,
+		oauth2.SetAuthURLParam("scope", "identify role_connections.write"), oauth2.SetAuthURLParam("prompt", "consent"))
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("Failed starting linked roles oauth flow")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+// handleLinkedRolesCallback finishes connecting the account, pushing the metadata right away
+func handleLinkedRolesCallback(w http.ResponseWriter, r *http.Request, st *oauthState) {
+	ctx := r.Context()
+
+	token, err := exchangeOAuthCode(r, st)
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("oauthConf.Exchange() failed during linked roles")
+		http.Redirect(w, r, "/?error=oauth2failure", http.StatusTemporaryRedirect)
+		return
+	}
+
+	session, err := discordgo.New(token.Type() + " " + token.AccessToken)
+	if err == nil {
+		var user *discordgo.User
+		user, err = session.UserMe()
+		if err == nil {
+			err = pushRoleConnection(ctx, &roleConnection{
+				UserID:       user.ID,
+				AccessToken:  token.AccessToken,
+				RefreshToken: token.RefreshToken,
+				Expiry:       token.Expiry,
+				LinkedAt:     time.Now(),
+			})
+		}
+	}
+
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("Failed connecting linked roles")
+		http.Redirect(w, r, "/?error=linkedrolesfailed", http.StatusTemporaryRedirect)
+		return
+	}
+
+	http.Redirect(w, r, "/linked_roles/done", http.StatusTemporaryRedirect)
+}
+
+// HandleLinkedRolesDone handles GET /linked_roles/done, listing what's shared with discord
+func HandleLinkedRolesDone(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	_, tmpl := GetCreateTemplateData(r.Context())
+	tmpl["RoleConnectionMetadata"] = RoleConnectionMetadataFields()
+	return tmpl, nil
+}
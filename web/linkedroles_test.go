@@ -0,0 +1,32 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatRoleConnectionValue(t *testing.T) {
+	verifiedAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	cases := []struct {
+		value    interface{}
+		expected string
+		ok       bool
+	}{
+		{int64(1500), "1500", true},
+		{7, "7", true},
+		{true, "1", true},
+		{false, "0", true},
+		{verifiedAt, "2024-03-01T11:30:00Z", true},
+		{time.Time{}, "", false},
+		{"text", "", false},
+		{nil, "", false},
+	}
+
+	for _, c := range cases {
+		result, ok := formatRoleConnectionValue(c.value)
+		if result != c.expected || ok != c.ok {
+			t.Errorf("formatRoleConnectionValue(%#v) = (%q, %t), expected (%q, %t)", c.value, result, ok, c.expected, c.ok)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/bot"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	confLiveMaxConnsPerGuild = config.RegisterOption("yagpdb.web.live_max_conns_per_guild", "Max websocket connections for live updates to the control panel of a guild, 0 disables the live updates", 50)
+	confLiveMaxConnsPerUser  = config.RegisterOption("yagpdb.web.live_max_conns_per_user", "Max websocket connections for live updates a user can have open across all guilds, 0 for no limit", 10)
+)
+
+var (
+	errLiveGuildLimit = errors.New("Too many live connections to this server")
+	errLiveUserLimit  = errors.New("Too many live connections, close some of your control panel tabs")
+)
+
+// The types of the live events pushed to the control panel
+const (
+	LiveEventConfigChanged = "config_changed"
+	LiveEventBotJoined     = "bot_joined"
+	LiveEventBotLeft       = "bot_left"
+	LiveEventModlogEntry   = "modlog_entry"
+)
+
+// evtLiveEvent is the pubsub event carrying live events, so they reach the connections of every web instance
+const evtLiveEvent = "web_live_event"
+
+const (
+	liveWriteTimeout = time.Second * 10
+	livePongTimeout  = time.Minute
+	livePingInterval = livePongTimeout / 2
+	liveSendBuffer   = 16
+)
+
+// LiveEvent is pushed to the control panels open on the guild over /manage/:server/ws
+type LiveEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+
+	// the connections of this user don't get the event, it's usually about something they did themselves
+	ExcludeUser int64 `json:"-"`
+}
+
+// liveEventMessage is the pubsub form of LiveEvent, which has to keep ExcludeUser
+type liveEventMessage struct {
+	Event       *LiveEvent `json:"event"`
+	ExcludeUser int64      `json:"exclude_user"`
+}
+
+func init() {
+	pubsub.AddHandler(evtLiveEvent, handleLiveEventPubsub, liveEventMessage{})
+	pubsub.AddHandler(cplogs.EvtEntryAdded, handleLiveCPLogEntry, cplogs.EntryAddedData{})
+	pubsub.AddHandler(bot.EvtGuildMembershipChanged, handleLiveGuildMembershipChanged, bot.GuildMembershipChangedData{})
+}
+
+// PublishLiveEvent pushes the event to everyone with the control panel of the guild open, on all web instances
+func PublishLiveEvent(guildID int64, evt *LiveEvent) {
+	pubsub.PublishLogErr(evtLiveEvent, guildID, &liveEventMessage{Event: evt, ExcludeUser: evt.ExcludeUser})
+}
+
+func handleLiveEventPubsub(evt *pubsub.Event) {
+	msg := evt.Data.(*liveEventMessage)
+	if msg.Event == nil {
+		return
+	}
+
+	msg.Event.ExcludeUser = msg.ExcludeUser
+	liveConns.broadcast(evt.TargetGuildInt, msg.Event)
+}
+
+func handleLiveCPLogEntry(evt *pubsub.Event) {
+	data := evt.Data.(*cplogs.EntryAddedData)
+	liveConns.broadcast(evt.TargetGuildInt, &LiveEvent{
+		Type:        LiveEventConfigChanged,
+		Data:        data,
+		ExcludeUser: data.AuthorID,
+	})
+}
+
+func handleLiveGuildMembershipChanged(evt *pubsub.Event) {
+	data := evt.Data.(*bot.GuildMembershipChangedData)
+
+	t := LiveEventBotLeft
+	if data.Joined {
+		t = LiveEventBotJoined
+	}
+
+	liveConns.broadcast(data.GuildID, &LiveEvent{Type: t})
+}
+
+// liveConn is a websocket connection of a open control panel
+type liveConn struct {
+	userID int64
+	send   chan []byte
+}
+
+// liveHub keeps the live connections by guild, and how many each user has open
+type liveHub struct {
+	mu        sync.Mutex
+	conns     map[int64]map[*liveConn]bool
+	userConns map[int64]int
+}
+
+func newLiveHub() *liveHub {
+	return &liveHub{conns: make(map[int64]map[*liveConn]bool), userConns: make(map[int64]int)}
+}
+
+var liveConns = newLiveHub()
+
+// add returns a error if the guild or the user already has the max amount of connections, maxPerUser <= 0 doesn't
+// limit the connections of the user
+func (h *liveHub) add(guildID int64, c *liveConn, maxPerGuild, maxPerUser int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.conns[guildID]) >= maxPerGuild {
+		return errLiveGuildLimit
+	}
+
+	if maxPerUser > 0 && h.userConns[c.userID] >= maxPerUser {
+		return errLiveUserLimit
+	}
+
+	if h.conns[guildID] == nil {
+		h.conns[guildID] = make(map[*liveConn]bool)
+	}
+	h.conns[guildID][c] = true
+	h.userConns[c.userID]++
+	return nil
+}
+
+func (h *liveHub) remove(guildID int64, c *liveConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(guildID, c)
+}
+
+// removeLocked closes the send channel of the connection if it was still in the hub, h.mu has to be held
+func (h *liveHub) removeLocked(guildID int64, c *liveConn) {
+	if !h.conns[guildID][c] {
+		return
+	}
+
+	delete(h.conns[guildID], c)
+	if len(h.conns[guildID]) == 0 {
+		delete(h.conns, guildID)
+	}
+
+	h.userConns[c.userID]--
+	if h.userConns[c.userID] <= 0 {
+		delete(h.userConns, c.userID)
+	}
+	close(c.send)
+}
+
+// broadcast sends the event to the connections of the guild, connections too slow to keep up are dropped
+func (h *liveHub) broadcast(guildID int64, evt *LiveEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.conns[guildID]) == 0 {
+		return
+	}
+
+	encoded, err := json.Marshal(evt)
+	if err != nil {
+		logger.WithError(err).WithField("type", evt.Type).Error("failed encoding live event")
+		return
+	}
+
+	for c := range h.conns[guildID] {
+		if evt.ExcludeUser != 0 && c.userID == evt.ExcludeUser {
+			continue
+		}
+
+		select {
+		case c.send <- encoded:
+		default:
+			h.removeLocked(guildID, c)
+		}
+	}
+}
+
+// closeAll drops every connection, their write loops close the websockets
+func (h *liveHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for guildID, conns := range h.conns {
+		for c := range conns {
+			h.removeLocked(guildID, c)
+		}
+	}
+}
+
+func runLiveShutdown(ctx context.Context) {
+	<-ctx.Done()
+	liveConns.closeAll()
+}
+
+var liveUpgrader = &websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// the default CheckOrigin only allows the site itself, other sites can't listen in with the cookies of the user
+}
+
+// HandleLiveWS upgrades the request to a websocket pushing the LiveEvents of the guild, messages from the client are
+// ignored
+func HandleLiveWS(w http.ResponseWriter, r *http.Request) {
+	max := confLiveMaxConnsPerGuild.GetInt()
+	if max <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	g, _ := GetBaseCPContextData(r.Context())
+	user := ContextUser(r.Context())
+
+	c := &liveConn{userID: user.ID, send: make(chan []byte, liveSendBuffer)}
+	if err := liveConns.add(g.ID, c, max, confLiveMaxConnsPerUser.GetInt()); err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	ws, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already responded with the error
+		liveConns.remove(g.ID, c)
+		return
+	}
+
+	go c.writeLoop(ws)
+	c.readLoop(ws)
+	liveConns.remove(g.ID, c)
+}
+
+// readLoop reads until the connection is closed, which is needed for the pongs and close messages to be handled
+func (c *liveConn) readLoop(ws *websocket.Conn) {
+	ws.SetReadLimit(512)
+	ws.SetReadDeadline(time.Now().Add(livePongTimeout))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(livePongTimeout))
+	})
+
+	for {
+		if _, _, err := ws.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// writeLoop sends the events and pings until the connection is removed from the hub or a write fails
+func (c *liveConn) writeLoop(ws *websocket.Conn) {
+	ticker := time.NewTicker(livePingInterval)
+	defer func() {
+		ticker.Stop()
+		ws.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if !ok {
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+
+			if err := ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/gorilla/websocket"
+)
+
+func TestLiveHub(t *testing.T) {
+	hub := newLiveHub()
+
+	a := &liveConn{userID: 1, send: make(chan []byte, 1)}
+	b := &liveConn{userID: 2, send: make(chan []byte, 1)}
+	if hub.add(1, a, 2, 0) != nil || hub.add(1, b, 2, 0) != nil {
+		t.Fatal("failed adding the connections")
+	}
+
+	if err := hub.add(1, &liveConn{userID: 3, send: make(chan []byte)}, 2, 0); err != errLiveGuildLimit {
+		t.Errorf("expected the third connection to be over the limit, got %v", err)
+	}
+
+	hub.broadcast(1, &LiveEvent{Type: LiveEventConfigChanged, ExcludeUser: 1})
+	if len(a.send) != 0 || len(b.send) != 1 {
+		t.Fatalf("expected only the other user to get the event, got %d and %d", len(a.send), len(b.send))
+	}
+
+	if msg := string(<-b.send); msg != `{"type":"config_changed"}` {
+		t.Errorf("unexpected message %s", msg)
+	}
+
+	// the buffer of a is full after this, the second event drops it
+	hub.broadcast(1, &LiveEvent{Type: LiveEventBotLeft})
+	hub.broadcast(1, &LiveEvent{Type: LiveEventBotJoined})
+	if hub.conns[1][a] {
+		t.Error("expected the slow connection to be dropped")
+	}
+
+	<-a.send
+	if _, ok := <-a.send; ok {
+		t.Error("expected the send channel of the dropped connection to be closed")
+	}
+
+	// removing it again doesn't close the channel twice
+	hub.remove(1, a)
+	hub.remove(1, b)
+	if len(hub.conns) != 0 || len(hub.userConns) != 0 {
+		t.Errorf("expected the hub to be empty, got %v and %v", hub.conns, hub.userConns)
+	}
+}
+
+func TestLiveHubUserLimit(t *testing.T) {
+	hub := newLiveHub()
+
+	// the limit of the user counts the connections to all guilds
+	a := &liveConn{userID: 1, send: make(chan []byte, 1)}
+	b := &liveConn{userID: 1, send: make(chan []byte, 1)}
+	if hub.add(1, a, 10, 2) != nil || hub.add(2, b, 10, 2) != nil {
+		t.Fatal("failed adding the connections")
+	}
+
+	if err := hub.add(3, &liveConn{userID: 1, send: make(chan []byte)}, 10, 2); err != errLiveUserLimit {
+		t.Errorf("expected the third connection of the user to be over the limit, got %v", err)
+	}
+
+	if err := hub.add(3, &liveConn{userID: 2, send: make(chan []byte)}, 10, 2); err != nil {
+		t.Errorf("expected other users to not be limited, got %v", err)
+	}
+
+	// dropped connections free up their slot
+	hub.remove(1, a)
+	if err := hub.add(3, &liveConn{userID: 1, send: make(chan []byte)}, 10, 2); err != nil {
+		t.Errorf("expected the user to be below the limit again, got %v", err)
+	}
+
+	// 0 doesn't limit the user
+	for i := 0; i < 5; i++ {
+		if err := hub.add(4, &liveConn{userID: 1, send: make(chan []byte)}, 10, 0); err != nil {
+			t.Fatalf("expected no limit for the user, got %v", err)
+		}
+	}
+}
+
+func TestHandleLiveWS(t *testing.T) {
+	defer func(old interface{}) { confLiveMaxConnsPerGuild.LoadedValue = old }(confLiveMaxConnsPerGuild.LoadedValue)
+	confLiveMaxConnsPerGuild.LoadedValue = 1
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), common.ContextKeyCurrentGuild, &dstate.GuildSet{GuildState: dstate.GuildState{ID: 10}})
+		ctx = context.WithValue(ctx, common.ContextKeyTemplateData, TemplateData{})
+		ctx = context.WithValue(ctx, common.ContextKeyUser, &discordgo.User{ID: 1})
+		HandleLiveWS(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected the second connection to be rejected, got %v", err)
+	}
+
+	// the connection is added to the hub before the upgrade, it's there now
+	liveConns.broadcast(10, &LiveEvent{Type: LiveEventModlogEntry, Data: map[string]string{"action": "Banned"}})
+
+	ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, msg, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(msg) != `{"type":"modlog_entry","data":{"action":"Banned"}}` {
+		t.Errorf("unexpected message %s", msg)
+	}
+}
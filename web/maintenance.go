@@ -0,0 +1,168 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const (
+	maintenanceRedisKey = "web_maintenance"
+
+	// how often the flag is reloaded from redis, so toggling it reaches every webserver without a restart
+	maintenanceRefreshInterval = time.Second * 5
+
+	// what clients are told to retry after, maintenance usually takes a while
+	maintenanceRetryAfter = 60
+
+	// MaxMaintenanceMessageLength is the max length of the message shown on the maintenance page
+	MaxMaintenanceMessageLength = 500
+)
+
+// Maintenance is the maintenance mode flag, while enabled only bot owners can use the website
+type Maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+
+	Since     time.Time `json:"since"`
+	EnabledBy int64     `json:"enabled_by,string"`
+}
+
+// the last loaded *Maintenance
+var currentMaintenance atomic.Value
+
+// CurrentMaintenance returns the maintenance mode flag as last loaded from redis
+func CurrentMaintenance() *Maintenance {
+	if v, ok := currentMaintenance.Load().(*Maintenance); ok {
+		return v
+	}
+
+	return &Maintenance{}
+}
+
+// SetMaintenance enables or disables maintenance mode, other webservers pick it up within maintenanceRefreshInterval
+func SetMaintenance(m *Maintenance) error {
+	if len(m.Message) > MaxMaintenanceMessageLength {
+		return NewPublicError("Message too long, max ", MaxMaintenanceMessageLength, " characters")
+	}
+
+	var err error
+	if m.Enabled {
+		err = common.SetRedisJson(maintenanceRedisKey, m)
+	} else {
+		err = common.RedisPool.Do(radix.Cmd(nil, "DEL", maintenanceRedisKey))
+	}
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	currentMaintenance.Store(m)
+	return nil
+}
+
+func loadMaintenance() error {
+	var m Maintenance
+	err := common.GetRedisJson(maintenanceRedisKey, &m)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	prev := CurrentMaintenance()
+	if prev.Enabled != m.Enabled {
+		if m.Enabled {
+			logger.Warn("Maintenance mode enabled, only bot owners can use the website")
+		} else {
+			logger.Info("Maintenance mode disabled")
+		}
+	}
+
+	currentMaintenance.Store(&m)
+	return nil
+}
+
+func runMaintenanceRefreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		// keeps the last known state while redis is down
+		if err := loadMaintenance(); err != nil && !RedisDegraded() {
+			logger.WithError(err).Error("Failed loading maintenance mode flag")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// paths that stay reachable during maintenance, so bot owners can still log in
+var maintenanceExemptPaths = map[string]bool{
+	"/login":         true,
+	"/confirm_login": true,
+	"/logout":        true,
+}
+
+// MaintenanceMiddleware shows the maintenance page to everyone but bot owners while maintenance mode is enabled,
+// bot owners get a banner instead. Requires the user to be set in the context.
+func MaintenanceMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := CurrentMaintenance()
+		if !m.Enabled || maintenanceExemptPaths[r.URL.Path] {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if user, ok := r.Context().Value(common.ContextKeyUser).(*discordgo.User); ok && common.IsOwner(user.ID) {
+			ctx := SetContextTemplateData(r.Context(), map[string]interface{}{"Maintenance": m})
+			inner.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		writeMaintenanceResponse(w, r, m)
+	})
+}
+
+// writeMaintenanceResponse responds with a 503, as json for api routes and otherwise with the maintenance page
+func writeMaintenanceResponse(w http.ResponseWriter, r *http.Request, m *Maintenance) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+
+	if wantsJSONError(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error":       "Down for maintenance, try again later",
+			"code":        "maintenance",
+			"message":     m.Message,
+			"retry_after": maintenanceRetryAfter,
+		})
+		return
+	}
+
+	if Templates == nil || Templates.Lookup("maintenance") == nil {
+		http.Error(w, "Down for maintenance, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	err := Templates.ExecuteTemplate(w, "maintenance", map[string]interface{}{"Message": m.Message, "Since": m.Since})
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("Failed executing maintenance page template")
+		fmt.Fprint(w, "Down for maintenance, try again later")
+	}
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	var served TemplateData
+	handler := MaintenanceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, served = GetCreateTemplateData(r.Context())
+	}))
+
+	serve := func(path string, user *discordgo.User) *httptest.ResponseRecorder {
+		served = nil
+		r := httptest.NewRequest("GET", path, nil)
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), common.ContextKeyUser, user))
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	serve("/manage", nil)
+	if served == nil || served["Maintenance"] != nil {
+		t.Fatal("expected requests to pass through untouched while maintenance mode is off")
+	}
+
+	origMaintenance := CurrentMaintenance()
+	origOwners := common.BotOwners
+	defer func() {
+		currentMaintenance.Store(origMaintenance)
+		common.BotOwners = origOwners
+	}()
+	currentMaintenance.Store(&Maintenance{Enabled: true, Message: "Back soon"})
+	common.BotOwners = []int64{1}
+
+	if w := serve("/manage", &discordgo.User{ID: 2}); served != nil || w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected the maintenance page for regular users, got %d", w.Code)
+	}
+
+	w := serve("/api/1/stats", nil)
+	if served != nil || w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"code":"maintenance"`) {
+		t.Errorf("expected a structured api error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	serve("/manage", &discordgo.User{ID: 1})
+	if served == nil || served["Maintenance"] == nil {
+		t.Error("expected bot owners to get through, with the banner")
+	}
+
+	serve("/login", nil)
+	if served == nil {
+		t.Error("expected logging in to still work")
+	}
+}
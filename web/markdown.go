@@ -0,0 +1,249 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+// the most text HandleMarkdownPreview converts, the most a embed can have
+const markdownPreviewMaxLength = embedTotalLimit
+
+var (
+	markdownCodeRegex = regexp.MustCompile("(?s)```(?:([\\w+-]+)\\n)?(.*?)```|``(.+?)``|`([^`]+)`")
+
+	markdownLinkRegex      = regexp.MustCompile(`\[([^\[\]\n]+)\]\((https?://[^\s()]+)\)|<?(https?://[^\s<>]+[^\s<>.,:;"')\]])>?`)
+	markdownMentionRegex   = regexp.MustCompile(`<(@!?|@&|#)(\d+)>|@everyone|@here`)
+	markdownEmojiRegex     = regexp.MustCompile(`<(a?):(\w+):(\d+)>`)
+	markdownTimestampRegex = regexp.MustCompile(`<t:(-?\d{1,13})(?::([tTdDfFR]))?>`)
+
+	markdownHeaderRegex = regexp.MustCompile(`^(#{1,3}) (.+)$`)
+
+	// applied in order, so bold is matched before italics and underline before the underscore italics
+	markdownInlineRules = []struct {
+		regex *regexp.Regexp
+		repl  string
+	}{
+		{regexp.MustCompile(`\*\*(.+?)\*\*`), "<strong>$1</strong>"},
+		{regexp.MustCompile(`__(.+?)__`), "<u>$1</u>"},
+		{regexp.MustCompile(`\*([^*\s](?:[^*]*?[^*\s])?)\*`), "<em>$1</em>"},
+		{regexp.MustCompile(`\b_([^_]+?)_\b`), "<em>$1</em>"},
+		{regexp.MustCompile(`~~(.+?)~~`), "<s>$1</s>"},
+		{regexp.MustCompile(`\|\|(.+?)\|\|`), `<span class="spoiler">$1</span>`},
+	}
+
+	// the formats of the styles of timestamps, R is relative
+	markdownTimestampFormats = map[string]string{
+		"t": "15:04",
+		"T": "15:04:05",
+		"d": "02/01/2006",
+		"D": "2 January 2006",
+		"f": "2 January 2006 15:04",
+		"F": "Monday, 2 January 2006 15:04",
+	}
+)
+
+// the parts of the markdown that are already html are swapped out for placeholders while the rest is converted, so the
+// formatting rules can't touch them
+type markdownPlaceholders []string
+
+func (p *markdownPlaceholders) add(rendered string) string {
+	*p = append(*p, rendered)
+	return fmt.Sprintf("\x00%d\x00", len(*p)-1)
+}
+
+var markdownPlaceholderRegex = regexp.MustCompile("\x00(\\d+)\x00")
+
+func (p markdownPlaceholders) restore(s string) string {
+	return markdownPlaceholderRegex.ReplaceAllStringFunc(s, func(match string) string {
+		index, _ := strconv.Atoi(match[1 : len(match)-1])
+		return p[index]
+	})
+}
+
+// DiscordMarkdown converts discord flavored markdown to html, the way discord shows messages: formatting, code,
+// quotes, headers, links, custom emojis, timestamps and mentions, with the roles and channels of the guild resolved.
+// The guild can be nil. The html is sanitized so it's safe to show as is.
+func DiscordMarkdown(text string, gs *dstate.GuildSet) template.HTML {
+	var placeholders markdownPlaceholders
+	text = strings.ReplaceAll(text, "\x00", "")
+
+	text = markdownCodeRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownCodeRegex.FindStringSubmatch(match)
+		if strings.HasPrefix(match, "```") {
+			class := ""
+			if parts[1] != "" {
+				class = ` class="language-` + html.EscapeString(parts[1]) + `"`
+			}
+
+			return placeholders.add("<pre><code" + class + ">" + html.EscapeString(strings.Trim(parts[2], "\n")) + "</code></pre>")
+		}
+
+		return placeholders.add("<code>" + html.EscapeString(parts[3]+parts[4]) + "</code>")
+	})
+
+	text = markdownLinkRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownLinkRegex.FindStringSubmatch(match)
+		label, href := parts[1], parts[2]
+		if href == "" {
+			label, href = parts[3], parts[3]
+		}
+
+		return placeholders.add(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(label) + "</a>")
+	})
+
+	text = markdownEmojiRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownEmojiRegex.FindStringSubmatch(match)
+		ext := "png"
+		if parts[1] == "a" {
+			ext = "gif"
+		}
+
+		return placeholders.add(fmt.Sprintf(`<img class="emoji" src="https://cdn.discordapp.com/emojis/%s.%s" alt=":%s:" title=":%s:">`, parts[3], ext, parts[2], parts[2]))
+	})
+
+	text = markdownTimestampRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownTimestampRegex.FindStringSubmatch(match)
+		return placeholders.add(markdownTimestamp(parts[1], parts[2]))
+	})
+
+	text = markdownMentionRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownMentionRegex.FindStringSubmatch(match)
+		return placeholders.add(`<span class="mention">` + html.EscapeString(markdownMention(gs, parts[1], parts[2], match)) + "</span>")
+	})
+
+	rendered := renderMarkdownLines(html.EscapeString(text))
+	return template.HTML(Sanitize(SanitizeInline, placeholders.restore(rendered)))
+}
+
+// renderMarkdownLines converts the quotes and headers of the escaped text, and the formatting within the lines
+func renderMarkdownLines(text string) string {
+	var (
+		buf   strings.Builder
+		quote []string
+
+		// blocks end the line themselves
+		afterBlock = true
+	)
+
+	writeLine := func(rendered string, block bool) {
+		if !afterBlock && !block {
+			buf.WriteString("<br>")
+		}
+
+		buf.WriteString(rendered)
+		afterBlock = block
+	}
+
+	flushQuote := func() {
+		if len(quote) > 0 {
+			writeLine("<blockquote>"+renderMarkdownLines(strings.Join(quote, "\n"))+"</blockquote>", true)
+			quote = nil
+		}
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "&gt;&gt;&gt; ") {
+			// quotes everything after it
+			quote = append(quote, strings.TrimPrefix(line, "&gt;&gt;&gt; "))
+			quote = append(quote, lines[i+1:]...)
+			break
+		}
+
+		if strings.HasPrefix(line, "&gt; ") {
+			quote = append(quote, strings.TrimPrefix(line, "&gt; "))
+			continue
+		}
+
+		flushQuote()
+
+		if parts := markdownHeaderRegex.FindStringSubmatch(line); parts != nil {
+			level := len(parts[1])
+			writeLine(fmt.Sprintf("<h%d>%s</h%d>", level, renderMarkdownInline(parts[2]), level), true)
+			continue
+		}
+
+		writeLine(renderMarkdownInline(line), false)
+	}
+	flushQuote()
+
+	return buf.String()
+}
+
+func renderMarkdownInline(line string) string {
+	for _, rule := range markdownInlineRules {
+		line = rule.regex.ReplaceAllString(line, rule.repl)
+	}
+
+	return line
+}
+
+// markdownMention returns the text discord shows for the mention
+func markdownMention(gs *dstate.GuildSet, kind, rawID, match string) string {
+	if rawID == "" {
+		// @everyone and @here
+		return match
+	}
+
+	id, _ := strconv.ParseInt(rawID, 10, 64)
+	switch kind {
+	case "@&":
+		if gs != nil {
+			if role := gs.GetRole(id); role != nil {
+				return "@" + role.Name
+			}
+		}
+		return "@deleted-role"
+	case "#":
+		if gs != nil {
+			if channel := gs.GetChannelOrThread(id); channel != nil {
+				return "#" + channel.Name
+			}
+		}
+		return "#deleted-channel"
+	}
+
+	// members aren't in the state of the guild, the id is the most we can show without looking them up
+	return "@" + rawID
+}
+
+// markdownTimestamp renders the timestamp in the style, the times are in UTC as the timezone of the viewer is unknown
+func markdownTimestamp(rawUnix, style string) string {
+	unix, _ := strconv.ParseInt(rawUnix, 10, 64)
+	t := time.Unix(unix, 0).UTC()
+
+	var formatted string
+	if style == "R" {
+		formatted = common.HumanizeTime(common.DurationPrecisionMinutes, t)
+	} else {
+		format, ok := markdownTimestampFormats[style]
+		if !ok {
+			format = markdownTimestampFormats["f"]
+		}
+		formatted = t.Format(format)
+	}
+
+	return `<span class="timestamp" title="` + t.Format(time.RFC1123) + `">` + html.EscapeString(formatted) + "</span>"
+}
+
+// HandleMarkdownPreview handles POST /manage/:server/markdown_preview, converting the markdown form value to html for
+// the editors of messages to show, see DiscordMarkdown. Textareas with data-markdown-preview="<selector>" do so on their
+// own.
+func HandleMarkdownPreview(w http.ResponseWriter, r *http.Request) interface{} {
+	text := r.FormValue("markdown")
+	if utf8.RuneCountInString(text) > markdownPreviewMaxLength {
+		return NewPublicError("The text is too long to preview, max ", markdownPreviewMaxLength, " characters")
+	}
+
+	return map[string]interface{}{"ok": true, "html": DiscordMarkdown(text, ContextGuild(r.Context()))}
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+func TestDiscordMarkdown(t *testing.T) {
+	gs := &dstate.GuildSet{
+		Roles:    []discordgo.Role{{ID: 10, Name: "Mods"}},
+		Channels: []dstate.ChannelState{{ID: 20, Name: "general"}},
+	}
+
+	cases := []struct {
+		name, markdown, expected string
+	}{
+		{"formatting", "**bold** *it* __under__ ~~gone~~ ||secret||", `<strong>bold</strong> <em>it</em> <u>under</u> <s>gone</s> <span class="spoiler">secret</span>`},
+		{"escaping", `<script>alert(1)</script> <b onclick="x">`, `&lt;script&gt;alert(1)&lt;/script&gt; &lt;b onclick=&#34;x&#34;&gt;`},
+		{"code", "`**not bold**` and\n```go\nfmt.Println(\"<hi>\")\n```", `<code>**not bold**</code> and<br><pre><code class="language-go">fmt.Println(&#34;&lt;hi&gt;&#34;)</code></pre>`},
+		{"mentions", "<@&10> <#20> <@&11> <#21> <@!30> @everyone", `<span class="mention">@Mods</span> <span class="mention">#general</span> <span class="mention">@deleted-role</span> <span class="mention">#deleted-channel</span> <span class="mention">@30</span> <span class="mention">@everyone</span>`},
+		{"emoji", "<:yag:123> <a:dance:456>", `<img class="emoji" src="https://cdn.discordapp.com/emojis/123.png" alt=":yag:" title=":yag:"> <img class="emoji" src="https://cdn.discordapp.com/emojis/456.gif" alt=":dance:" title=":dance:">`},
+		{"timestamp", "<t:0:D>", `<span class="timestamp" title="Thu, 01 Jan 1970 00:00:00 UTC">1 January 1970</span>`},
+		{"quotes and headers", "# Rules\n> be nice\n> really\nok", `<h1>Rules</h1><blockquote>be nice<br>really</blockquote>ok`},
+		{"multi line quote", "hi\n>>> a\nb", `hi<blockquote>a<br>b</blockquote>`},
+		{"unsafe link", "[click](javascript:alert(1))", `[click](javascript:alert(1))`},
+	}
+
+	for _, c := range cases {
+		if got := string(DiscordMarkdown(c.markdown, gs)); got != c.expected {
+			t.Errorf("%s: got %q, expected %q", c.name, got, c.expected)
+		}
+	}
+
+	links := string(DiscordMarkdown("[docs](https://docs.yagpdb.xyz/a_b_c) https://example.com/x_y_z.", nil))
+	for _, v := range []string{`href="https://docs.yagpdb.xyz/a_b_c"`, `>docs</a>`, `href="https://example.com/x_y_z"`, `</a>.`, `nofollow`} {
+		if !strings.Contains(links, v) {
+			t.Errorf("expected %s in %q", v, links)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -31,20 +32,21 @@ var (
 	confGAID = config.RegisterOption("yagpdb.ga_id", "Google analytics id", "")
 )
 
-// Misc mw that adds some headers, (Strict-Transport-Security)
+// Misc mw that adds the security headers
 // And discards requests when shutting down
 // And a logger
 func MiscMiddleware(inner http.Handler) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		if !IsAcceptingRequests() {
-			w.Write([]byte(`{"error":"Shutting down, try again in a minute"}`))
+			writeShuttingDown(w)
 			return
 		}
 
 		ctx := r.Context()
 
-		// mark the request as partial
-		if r.FormValue("partial") != "" {
+		// mark the request as partial, only looking at the query as parsing the body here would bypass the body
+		// size limits of the routes
+		if r.URL.Query().Get("partial") != "" {
 			var tmplData TemplateData
 			ctx, tmplData = GetCreateTemplateData(ctx)
 			tmplData["PartialRequest"] = true
@@ -54,10 +56,10 @@ func MiscMiddleware(inner http.Handler) http.Handler {
 		entry := logger.WithFields(logrus.Fields{
 			"ip":  GetRequestIP(r),
 			"url": r.URL.Path,
+			"req": RequestID(r),
 		})
 		ctx = context.WithValue(ctx, common.ContextKeyLogger, entry)
-		// force https for a year
-		w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		ctx = securityHeadersContext(w, ctx)
 		inner.ServeHTTP(w, r.WithContext(ctx))
 	}
 
@@ -82,27 +84,32 @@ func BaseTemplateDataMiddleware(inner http.Handler) http.Handler {
 			}
 		}
 
-		// set up the base template data
-		baseData := map[string]interface{}{
-			"RequestURI":       r.RequestURI,
-			"StartedAtUnix":    StartedAt.Unix(),
-			"CurrentAd":        CurrentAd,
-			"LightTheme":       lightTheme,
-			"SidebarCollapsed": collapseSidebar,
-			"SidebarItems":     sideBarItems,
-			"GAID":             confGAID.GetString(),
-		}
+		baseData := baseTemplateData(r.RequestURI, lightTheme, collapseSidebar)
+		inner.ServeHTTP(w, r.WithContext(SetContextTemplateData(r.Context(), baseData)))
+	}
 
-		baseData["BaseURL"] = BaseURL()
+	return http.HandlerFunc(mw)
+}
 
-		for k, v := range globalTemplateData {
-			baseData[k] = v
-		}
+// baseTemplateData returns the template data all pages have
+func baseTemplateData(requestURI string, lightTheme, collapseSidebar bool) TemplateData {
+	baseData := TemplateData{
+		"RequestURI":       requestURI,
+		"StartedAtUnix":    StartedAt.Unix(),
+		"CurrentAd":        CurrentAd,
+		"SidebarCollapsed": collapseSidebar,
+		"SidebarItems":     sideBarItems,
+		"GAID":             confGAID.GetString(),
+	}
 
-		inner.ServeHTTP(w, r.WithContext(SetContextTemplateData(r.Context(), baseData)))
+	baseData["BaseURL"] = BaseURL()
+	baseData.SetLightTheme(lightTheme)
+
+	for k, v := range globalTemplateData {
+		baseData.set(k, v)
 	}
 
-	return http.HandlerFunc(mw)
+	return baseData
 }
 
 // SessionMiddleware retrieves a session from the request using the session cookie
@@ -124,71 +131,59 @@ func SessionMiddleware(inner http.Handler) http.Handler {
 			return
 		}
 
+		if isAuthLockedOut(r) {
+			// too many invalid session cookies from this ip, treat them as logged out
+			return
+		}
+
 		session, err := discorddata.GetSession(cookie.Value, discordAuthTokenFromYag)
 		if err != nil {
 			if errors.Cause(err) != ErrNotLoggedIn {
 				CtxLogger(r.Context()).WithError(err).Error("invalid session")
+			} else if cookie.Value != "none" {
+				// clear it so legit users with a stale cookie don't keep counting towards the lockout
+				recordAuthFailure(r, "session")
+				cleared := newSessionCookie("none", 0)
+				cleared.MaxAge = -1
+				http.SetCookie(w, cleared)
 			}
 
 			return
 		}
 
+		if !touchSession(w, r, cookie.Value) {
+			// expired or revoked
+			discorddata.EvictSession(cookie.Value)
+			return
+		}
+
 		ctx = context.WithValue(ctx, common.ContextKeyDiscordSession, session)
 		ctx = context.WithValue(ctx, common.ContextKeyYagToken, cookie.Value)
+		ctx = applicationContext(ctx, cookie.Value)
 	}
 	return http.HandlerFunc(mw)
 }
 
 // RequireSessionMiddleware ensures that a session is available, and otherwise refuse to continue down the chain of handlers
-// Also validates the origin header if present (on POST requests that is)
+// (CSRF protection is handled by CSRFProtectionMW for all routes)
 func RequireSessionMiddleware(inner http.Handler) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		// Check if a session is present
 		session := DiscordSessionFromContext(r.Context())
 		if session == nil {
-			http.Redirect(w, r, "/login?goto="+url.QueryEscape(r.RequestURI), http.StatusTemporaryRedirect)
-			return
-		}
-
-		// validate the origin header (if present) for protection against CSRF attacks
-		// i don't think putting in more protection against CSRF attacks is needed, considering literally every browser these days support it
-		origin := r.Header.Get("Origin")
-		if origin != "" {
-			split := strings.SplitN(origin, ":", 3)
-			hostSplit := strings.SplitN(common.ConfHost.GetString(), ":", 2)
-
-			if len(split) < 2 || !strings.EqualFold("//"+hostSplit[0], split[1]) {
-				CtxLogger(r.Context()).Error("Mismatched origin: ", hostSplit[0]+" : "+split[1])
-				WriteErrorResponse(w, r, "Bad origin", http.StatusUnauthorized)
+			if RedisDegraded() {
+				// the session can't be loaded, and logging in wouldn't work either
+				writeUnavailableResponse(w, r)
 				return
 			}
-		}
-
-		inner.ServeHTTP(w, r)
-	}
-	return http.HandlerFunc(mw)
-}
 
-func CSRFProtectionMW(inner http.Handler) http.Handler {
-	mw := func(w http.ResponseWriter, r *http.Request) {
-		// validate the origin header (if present) for protection against CSRF attacks
-		// i don't think putting in more protection against CSRF attacks is needed, considering literally every browser these days support it
-		origin := r.Header.Get("Origin")
-		if origin != "" {
-			split := strings.SplitN(origin, ":", 3)
-			hostSplit := strings.SplitN(common.ConfHost.GetString(), ":", 2)
-
-			if len(split) < 2 || !strings.EqualFold("//"+hostSplit[0], split[1]) {
-				CtxLogger(r.Context()).Error("Mismatched origin: ", hostSplit[0]+" : "+split[1])
-				WriteErrorResponse(w, r, "Bad origin", http.StatusUnauthorized)
-				return
-			}
+			http.Redirect(w, r, "/login?goto="+url.QueryEscape(r.RequestURI), http.StatusTemporaryRedirect)
+			return
 		}
 
 		inner.ServeHTTP(w, r)
 	}
-
-	return http.HandlerFunc(mw)
+	return NamedMiddleware("require_session", inner, mw)
 }
 
 // UserInfoMiddleware fills the context with user information and the guilds it's on guilds if possible
@@ -203,38 +198,30 @@ func UserInfoMiddleware(inner http.Handler) http.Handler {
 			return
 		}
 
-		// retrieve user info
+		// retrieve user info, concurrent requests from the same user share a single call to discord
 		user, err := discorddata.GetUserInfo(session.Token, session)
 		if err != nil {
-			// nothing in cache...
-			user, err = session.UserMe()
-			if err != nil {
-				if !common.IsDiscordErr(err, discordgo.ErrCodeUnauthorized) {
-					CtxLogger(r.Context()).WithError(err).Error("Failed getting user info from discord")
-				}
-
-				if r.URL.Path == "/logout" {
-					inner.ServeHTTP(w, r)
-					return
-				}
+			if !common.IsDiscordErr(err, discordgo.ErrCodeUnauthorized) {
+				CtxLogger(r.Context()).WithError(err).Error("Failed getting user info from discord")
+			}
 
-				http.Redirect(w, r, "/logout", http.StatusTemporaryRedirect)
+			if r.URL.Path == "/logout" {
+				inner.ServeHTTP(w, r)
 				return
 			}
 
-			// Give the little rascal to the cache
-			LogIgnoreErr(common.SetCacheDataJson(session.Token+":user", 3600, user))
-		}
-
-		templateData := map[string]interface{}{
-			"User":       user,
-			"IsBotOwner": common.IsOwner(user.ID),
+			http.Redirect(w, r, "/logout", http.StatusTemporaryRedirect)
+			return
 		}
 
 		// update the logger with the user and update the context with all the new info
 		entry := CtxLogger(ctx).WithField("u", user.ID)
 		ctx = context.WithValue(ctx, common.ContextKeyLogger, entry)
-		ctx = context.WithValue(SetContextTemplateData(ctx, templateData), common.ContextKeyUser, user)
+		setAccessLogUser(ctx, user.ID)
+
+		ctx, tmpl := GetCreateTemplateData(ctx)
+		tmpl.SetUser(user).SetIsBotOwner(common.IsOwner(user.ID))
+		ctx = context.WithValue(ctx, common.ContextKeyUser, user)
 
 		inner.ServeHTTP(w, r.WithContext(ctx))
 
@@ -243,7 +230,7 @@ func UserInfoMiddleware(inner http.Handler) http.Handler {
 }
 
 func getGuild(ctx context.Context, guildID int64) (*dstate.GuildSet, error) {
-	guild, err := discorddata.GetFullGuild(guildID)
+	guild, err := discorddata.GetFullGuild(ctx, guildID)
 	if err != nil {
 		CtxLogger(ctx).WithError(err).Warn("failed getting guild from discord fallback, nothing more we can do...")
 		return nil, err
@@ -275,8 +262,10 @@ func ActiveServerMW(inner http.Handler) http.Handler {
 		entry := CtxLogger(ctx).WithField("g", guildID)
 		ctx = context.WithValue(ctx, common.ContextKeyLogger, entry)
 		ctx = context.WithValue(ctx, common.ContextKeyCurrentGuild, guild)
+		setAccessLogGuild(ctx, guildID)
 
-		ctx = SetContextTemplateData(ctx, map[string]interface{}{"ActiveGuild": guild})
+		ctx, tmpl := GetCreateTemplateData(ctx)
+		tmpl.SetActiveGuild(guild)
 
 		r = r.WithContext(ctx)
 	}
@@ -288,7 +277,7 @@ func LoadCoreConfigMiddleware(inner http.Handler) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		v := r.Context().Value(common.ContextKeyCurrentGuild)
 		if v == nil {
-			http.Redirect(w, r, "/?err=no_active_guild", http.StatusTemporaryRedirect)
+			RenderErrorPage(w, r, http.StatusNotFound, Msg("That server doesn't exist, or the bot isn't on it"))
 			return
 		}
 
@@ -296,9 +285,10 @@ func LoadCoreConfigMiddleware(inner http.Handler) http.Handler {
 
 		coreConf := common.GetCoreServerConfCached(g.ID)
 
-		SetContextTemplateData(r.Context(), map[string]interface{}{"CoreConfig": coreConf})
+		ctx, tmpl := GetCreateTemplateData(r.Context())
+		tmpl.SetCoreConfig(coreConf)
 
-		r = r.WithContext(context.WithValue(r.Context(), common.ContextKeyCoreConfig, coreConf))
+		r = r.WithContext(context.WithValue(ctx, common.ContextKeyCoreConfig, coreConf))
 
 		inner.ServeHTTP(w, r)
 	}
@@ -309,7 +299,7 @@ func LoadCoreConfigMiddleware(inner http.Handler) http.Handler {
 func RequireActiveServer(inner http.Handler) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		if v := r.Context().Value(common.ContextKeyCurrentGuild); v == nil {
-			http.Redirect(w, r, "/?err=no_active_guild", http.StatusTemporaryRedirect)
+			RenderErrorPage(w, r, http.StatusNotFound, Msg("That server doesn't exist, or the bot isn't on it"))
 			return
 		}
 
@@ -322,34 +312,42 @@ func RequireActiveServer(inner http.Handler) http.Handler {
 func RequireServerAdminMiddleware(inner http.Handler) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		if !ContextIsAdmin(r.Context()) {
+			if GetIsReadOnly(r.Context()) {
+				// a viewer trying to change something
+				rejectReadOnlyRequest(w, r)
+				return
+			}
+
 			if DiscordSessionFromContext(r.Context()) == nil {
 				// redirect them to log in and return here afterwards
 				http.Redirect(w, r, "/login?goto="+url.QueryEscape(r.RequestURI), http.StatusTemporaryRedirect)
 			} else {
 				// they didn't have access and were logged in
-				http.Redirect(w, r, "/?err=noaccess", http.StatusTemporaryRedirect)
+				EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventPermissionDenied, Details: map[string]string{"reason": "not_admin"}})
+				RenderErrorPage(w, r, http.StatusForbidden, Msg("You don't have access to the control panel of this server"))
 			}
 			return
 		}
 
 		inner.ServeHTTP(w, r)
 	}
-	return http.HandlerFunc(mw)
+	return NamedMiddleware("require_server_admin", inner, mw)
 }
 
 // RequireBotMemberMW ensures that the bot member for the curreng guild is available, mostly used for checking the bot's roles
 func RequireBotMemberMW(inner http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return NamedMiddleware("require_bot_member", inner, func(w http.ResponseWriter, r *http.Request) {
 		parsedGuildID, _ := strconv.ParseInt(pat.Param(r, "server"), 10, 64)
 
-		member, err := discorddata.GetMember(parsedGuildID, common.BotUser.ID)
+		member, err := discorddata.GetMember(r.Context(), parsedGuildID, ContextApplication(r.Context()).BotUserID())
 		if err != nil {
 			CtxLogger(r.Context()).WithError(err).Error("Failed retrieving bot member")
-			http.Redirect(w, r, "/?err=errFailedRetrievingBotMember", http.StatusTemporaryRedirect)
+			RenderErrorPage(w, r, http.StatusInternalServerError, Msg("Failed retrieving the bot's member on the server, try again in a bit"))
 			return
 		}
 
-		ctx := SetContextTemplateData(r.Context(), map[string]interface{}{"BotMember": member})
+		ctx, tmpl := GetCreateTemplateData(r.Context())
+		tmpl.SetBotMember(member)
 		ctx = context.WithValue(ctx, common.ContextKeyBotMember, member)
 
 		defer func() {
@@ -398,7 +396,7 @@ func RequireBotMemberMW(inner http.Handler) http.Handler {
 
 		ctx = context.WithValue(ctx, common.ContextKeyHighestBotRole, &highest)
 		ctx = context.WithValue(ctx, common.ContextKeyBotPermissions, combinedPerms)
-		ctx = SetContextTemplateData(ctx, map[string]interface{}{"HighestRole": &highest, "BotPermissions": combinedPerms})
+		tmpl.SetBotPermissions(&highest, combinedPerms)
 		r = r.WithContext(ctx)
 	})
 }
@@ -410,14 +408,32 @@ func RenderHandler(inner CustomHandlerFunc, tmpl string) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		alertsOnly := r.URL.Query().Get("alertsonly") == "1"
 
+		exportFormat := ExportFormat(r)
+		if exportFormat != "" && !isExportFormat(exportFormat) {
+			RenderErrorPage(w, r, http.StatusBadRequest, Msg("Unknown format, the page can be downloaded as csv or json"))
+			return
+		}
+
+		w.Header().Add("Vary", PartialBlockHeader)
+		execTmpl, ok := requestedPartialTemplate(r, tmpl)
+		if !ok {
+			http.Error(w, "Unknown partial block", http.StatusBadRequest)
+			return
+		}
+
 		respCode := 200
 		if isPArtial := r.Context().Value(common.ContextKeyIsPartial); isPArtial != nil && isPArtial.(bool) {
 			if formOK := r.Context().Value(common.ContextKeyFormOk); formOK != nil && !formOK.(bool) {
-				alertsOnly = true
+				// a requested block is still rendered, with the validation errors in it
+				alertsOnly = execTmpl == ""
 				respCode = 400
 			}
 		}
 
+		if execTmpl == "" {
+			execTmpl = tmpl
+		}
+
 		if alertsOnly {
 			w.Header().Set("Content-Type", "application/json")
 		} else {
@@ -437,23 +453,34 @@ func RenderHandler(inner CustomHandlerFunc, tmpl string) http.Handler {
 			}
 		}
 
-		w.WriteHeader(respCode)
+		localizeAlerts(r, out)
+
+		if exportFormat != "" {
+			writeExport(w, r, exportFormat, out)
+			return
+		}
 
 		if !alertsOnly {
-			err := Templates.ExecuteTemplate(w, tmpl, out)
+			// rendered before the status is written, so a template failing halfway gets the error page instead of half
+			// a page
+			var buf bytes.Buffer
+			err := executeTemplateTraced(r, &buf, execTmpl, out)
 			if err != nil {
 				CtxLogger(r.Context()).WithError(err).Error("Failed executing template")
+				RenderErrorPage(w, r, http.StatusInternalServerError, nil)
 				return
 			}
+
+			w.WriteHeader(respCode)
+			w.Write(buf.Bytes())
+
+			checkRenderedSize(r, execTmpl, int64(buf.Len()))
+			checkTemplateData(r, execTmpl, out)
 		} else {
-			if outCast, ok := out.(TemplateData); ok {
-				alertsInterface, ok := outCast["Alerts"]
-				var alerts []*Alert
-				if ok {
-					alerts = alertsInterface.([]*Alert)
-				}
+			w.WriteHeader(respCode)
 
-				encoded, err := json.Marshal(alerts)
+			if outCast, ok := out.(TemplateData); ok {
+				encoded, err := json.Marshal(outCast.Alerts())
 				if err != nil {
 					CtxLogger(r.Context()).WithError(err).Error("Failed encoding alerts")
 					return
@@ -466,24 +493,41 @@ func RenderHandler(inner CustomHandlerFunc, tmpl string) http.Handler {
 	return http.HandlerFunc(mw)
 }
 
+// JSONStream can be returned from APIHandler handlers to write a large json array incrementally
+// instead of buffering it all in memory, emit writes a single element of the array
+type JSONStream func(emit func(v interface{}) error) error
+
+// how many elements to write before flushing a JSONStream
+const jsonStreamFlushInterval = 100
+
 // A helper wrapper that json encodes the returned value
 func APIHandler(inner CustomHandlerFunc) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		out := inner(w, r)
 
 		w.Header().Set("content-type", "application/json")
+		if stream, ok := out.(JSONStream); ok {
+			writeJSONStream(w, r, stream)
+			return
+		}
+
 		if cast, ok := out.(error); ok {
+			code := http.StatusInternalServerError
 			if cast == nil {
 				out = map[string]interface{}{"ok": true}
+			} else if isBodyTooLarge(r, cast) {
+				// the client's fault, not worth reporting
+				out = map[string]interface{}{"ok": false, "error": bodyTooLargeError(r).Error()}
+				code = http.StatusRequestEntityTooLarge
 			} else {
 				if public, ok := cast.(*PublicError); ok {
 					out = map[string]interface{}{"ok": false, "error": public.msg}
 				} else {
 					out = map[string]interface{}{"ok": false}
 				}
-				CtxLogger(r.Context()).WithError(cast).Error("API Error")
+				reportRequestError(r, cast).Error("API Error")
 			}
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(code)
 		}
 
 		if out != nil {
@@ -493,35 +537,83 @@ func APIHandler(inner CustomHandlerFunc) http.Handler {
 	return http.HandlerFunc(mw)
 }
 
+func writeJSONStream(w http.ResponseWriter, r *http.Request, stream JSONStream) {
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	n := 0
+	err := stream(func(v interface{}) error {
+		sep := ","
+		if n == 0 {
+			sep = "["
+		}
+
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+
+		n++
+		if flusher != nil && n%jsonStreamFlushInterval == 0 {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		// the status has most likely already been sent, so abort the connection to signal a incomplete response
+		CtxLogger(r.Context()).WithError(err).Error("API Error while streaming")
+		panic(http.ErrAbortHandler)
+	}
+
+	if n == 0 {
+		io.WriteString(w, "[")
+	}
+	io.WriteString(w, "]\n")
+}
+
 // Writes the request log into logger, returns a new middleware
 func RequestLogger(logger io.Writer) func(http.Handler) http.Handler {
+	format := accessLogFormatter()
 
 	handler := func(inner http.Handler) http.Handler {
 
 		mw := func(w http.ResponseWriter, r *http.Request) {
-			started := time.Now()
-			counter := datacounter.NewResponseWriterCounter(w)
-
-			defer func() {
-				elapsed := time.Since(started)
-				dataSent := counter.Count()
-
-				addr := strings.SplitN(r.RemoteAddr, ":", 2)[0]
+			entry := &AccessLogEntry{
+				Time:      time.Now(),
+				ClientIP:  ClientIP(r),
+				Method:    r.Method,
+				URI:       r.RequestURI,
+				Proto:     r.Proto,
+				UserAgent: r.UserAgent(),
+				Referer:   r.Referer(),
+				RequestID: RequestID(r),
+			}
 
-				reqLine := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+			if loc := ClientLocation(r); loc != nil {
+				entry.Country = loc.Country
+				entry.ASN = loc.ASN
+			}
 
-				out := fmt.Sprintf("%s %f - [%s] %q 200 %d %q %q\n",
-					addr, elapsed.Seconds(), started.Format("02/Jan/2006:15:04:05 -0700"), reqLine, dataSent, r.UserAgent(), r.Referer())
+			counter := datacounter.NewResponseWriterCounter(w)
+			aw := &accessLogResponseWriter{ResponseWriter: counter}
 
-				// GoAccess Format:
-				// log-format %h %T %^[%d:%t %^] "%r" %s %b "%u" "%R"
-				// date-format %d/%b/%Y
-				// time-format %H:%M:%S
+			defer func() {
+				entry.Duration = time.Since(entry.Time)
+				entry.Bytes = counter.Count()
+				entry.Status = aw.status
+				if entry.Status == 0 {
+					entry.Status = http.StatusOK
+				}
 
-				logger.Write([]byte(out))
+				logger.Write(format(entry))
 			}()
 
-			inner.ServeHTTP(counter, r)
+			inner.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), common.ContextKeyAccessLogEntry, entry)))
 
 		}
 		return http.HandlerFunc(mw)
@@ -530,17 +622,49 @@ func RequestLogger(logger io.Writer) func(http.Handler) http.Handler {
 	return handler
 }
 
+const readOnlyRejectedMsg = "You only have read only access to this control panel, you can not change any settings."
+
+// rejectReadOnlyRequest responds to a request from someone with only read access trying to change something
+func rejectReadOnlyRequest(w http.ResponseWriter, r *http.Request) {
+	EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventPermissionDenied, Details: map[string]string{"reason": "read_only"}})
+
+	if !IsRequestPartial(r.Context()) {
+		http.Error(w, readOnlyRejectedMsg, http.StatusForbidden)
+		return
+	}
+
+	// partial requests are made by the control panel forms, which display the alerts returned on a 400
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	LogIgnoreErr(json.NewEncoder(w).Encode([]*Alert{ErrorAlert(readOnlyRejectedMsg)}))
+}
+
 // Parses a form
 func FormParserMW(inner http.Handler, dst interface{}) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
+		if GetIsReadOnly(r.Context()) {
+			ctx, tmpl := GetCreateTemplateData(r.Context())
+			tmpl.AddAlerts(ErrorAlert(readOnlyRejectedMsg))
+
+			ctx = context.WithValue(ctx, common.ContextKeyParsedForm, reflect.New(reflect.TypeOf(dst)).Interface())
+			ctx = context.WithValue(ctx, common.ContextKeyFormOk, false)
+			inner.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		var err error
 		if strings.Contains(r.Header.Get("content-type"), "multipart/form-data") {
-			err = r.ParseMultipartForm(100000)
+			err = r.ParseMultipartForm(int64(confMultipartMemoryBytes.GetInt()))
 		} else {
 			err = r.ParseForm()
 		}
 
 		if err != nil {
+			if isBodyTooLarge(r, err) {
+				rejectBodyTooLarge(w, r, inner, reflect.New(reflect.TypeOf(dst)).Interface())
+				return
+			}
+
 			panic(err)
 		}
 
@@ -629,7 +753,7 @@ func ControllerHandler(f ControllerHandlerFunc, templateName string) http.Handle
 			ctx, data = GetCreateTemplateData(ctx)
 		}
 
-		checkControllerError(ctx, data, err)
+		checkControllerError(r, data, err)
 
 		return data
 
@@ -654,13 +778,25 @@ func ControllerPostHandler(mainHandler ControllerHandlerFunc, extraHandler http.
 			if !ok {
 				return
 			}
+		} else if GetIsReadOnly(ctx) {
+			templateData.AddAlerts(ErrorAlert(readOnlyRejectedMsg))
+			return
 		}
 
 		data, err := mainHandler(w, r)
+
+		// before the extra handler renders the page with the new config
+		bumpContextGuildConfigVersion(r)
+
 		if data == nil {
 			data = templateData
 		}
-		checkControllerError(ctx, data, err)
+		checkControllerError(r, data, err)
+
+		if err != nil && isBodyTooLarge(r, err) {
+			// handlers parsing uploads themselves
+			w = &statusWriter{ResponseWriter: w, code: http.StatusRequestEntityTooLarge}
+		}
 
 		// Don't display the success alert if there's an error alert displaying, that indicates a problem... :(
 		hasErrorAlert := false
@@ -684,7 +820,7 @@ func ControllerPostHandler(mainHandler ControllerHandlerFunc, extraHandler http.
 	return handler
 }
 
-func checkControllerError(ctx context.Context, data TemplateData, err error) {
+func checkControllerError(r *http.Request, data TemplateData, err error) {
 	if err == nil {
 		return
 	}
@@ -695,12 +831,21 @@ func checkControllerError(ctx context.Context, data TemplateData, err error) {
 		data.AddAlerts(ErrorAlert("An error occurred... Contact support if you're having issues."))
 	}
 
-	CtxLogger(ctx).WithError(err).Error("Web handler reported an error")
+	reportRequestError(r, err).Error("Web handler reported an error")
 }
 
 func RequirePermMW(perms ...int64) func(http.Handler) http.Handler {
+	// the permissions are named in the route policy, see routes_policy_test.go
+	names := make([]string, len(perms))
+	for i, v := range perms {
+		names[i] = strconv.FormatInt(v, 10)
+		if name, ok := common.StringPerms[v]; ok {
+			names[i] = strings.ReplaceAll(name, " ", "")
+		}
+	}
+
 	return func(inner http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		return NamedMiddleware("require_perm", inner, func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
 			permsInterface := ctx.Value(common.ContextKeyBotPermissions)
 			currentPerms := int64(0)
@@ -745,7 +890,7 @@ func RequirePermMW(perms ...int64) func(http.Handler) http.Handler {
 			}
 
 			inner.ServeHTTP(w, r.WithContext(ctx))
-		})
+		}, names...)
 	}
 }
 
@@ -764,7 +909,7 @@ func SetGuildMemberMiddleware(inner http.Handler) http.Handler {
 		if userI != nil {
 			user := userI.(*discordgo.User)
 
-			m, err := discorddata.GetMember(guild.ID, user.ID)
+			m, err := discorddata.GetMember(ctx, guild.ID, user.ID)
 			if err != nil || m == nil {
 				CtxLogger(r.Context()).WithError(err).Warn("failed retrieving member info from discord api")
 			} else if m != nil {
@@ -777,15 +922,18 @@ func SetGuildMemberMiddleware(inner http.Handler) http.Handler {
 		}
 
 		read, write := IsAdminRequest(ctx, r)
-		ctx = SetContextTemplateData(ctx, map[string]interface{}{"IsAdmin": read || write})
+		ctx, tmpl := GetCreateTemplateData(ctx)
+		tmpl.SetIsAdmin(read || write)
 		ctx = context.WithValue(ctx, common.ContextKeyIsAdmin, read || write)
 
 		if read && !write {
 			ctx = context.WithValue(ctx, common.ContextKeyIsReadOnly, true)
-
-			var tmpl TemplateData
-			ctx, tmpl = GetCreateTemplateData(ctx)
 			tmpl.AddAlerts(WarningAlert("In read only mode, you can not change any settings."))
+		} else if !read && !isReadOnlyMethod(r.Method) {
+			// viewers are not admins on requests that could change something, mark them so they get a proper error instead
+			if viewer, _ := GetAccessLevel(ctx); viewer {
+				ctx = context.WithValue(ctx, common.ContextKeyIsReadOnly, true)
+			}
 		}
 
 		r = r.WithContext(ctx)
@@ -794,19 +942,10 @@ func SetGuildMemberMiddleware(inner http.Handler) http.Handler {
 	return http.HandlerFunc(mw)
 }
 
-func isStatic(r *http.Request) bool {
-	if r.URL.Path == "/robots.txt" || len(r.URL.Path) > 8 && r.URL.Path[:8] == "/static/" {
-		return true
-	}
-
-	return false
-}
-
 // SkipStaticMW skips the "maybeSkip" handler if this is a static link
 func SkipStaticMW(maybeSkip func(http.Handler) http.Handler, alwaysRunSuffixes ...string) func(http.Handler) http.Handler {
 	return func(alwaysRun http.Handler) http.Handler {
 		mw := func(w http.ResponseWriter, r *http.Request) {
-			// reliable enough... *cough cough*
 			if isStatic(r) {
 
 				// in some cases (like the gzip handler) we wanna run certain middlewares on certain files
@@ -849,7 +988,7 @@ func addPromCountMW(inner http.Handler) http.Handler {
 
 // RequireBotOwnerMW requires the user to be logged in and that they're a bot owner
 func RequireBotOwnerMW(inner http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return NamedMiddleware("require_bot_owner", inner, func(w http.ResponseWriter, r *http.Request) {
 		if user := r.Context().Value(common.ContextKeyUser); user != nil {
 			cast := user.(*discordgo.User)
 			if common.IsOwner(cast.ID) {
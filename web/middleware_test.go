@@ -0,0 +1,57 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func jsonStreamHandler(n int, err error) http.Handler {
+	return APIHandler(func(w http.ResponseWriter, r *http.Request) interface{} {
+		return JSONStream(func(emit func(v interface{}) error) error {
+			for i := 0; i < n; i++ {
+				if err := emit(map[string]int{"i": i}); err != nil {
+					return err
+				}
+			}
+
+			return err
+		})
+	})
+}
+
+func TestAPIHandlerJSONStream(t *testing.T) {
+	for _, n := range []int{0, 1, jsonStreamFlushInterval*2 + 1} {
+		w := httptest.NewRecorder()
+		jsonStreamHandler(n, nil).ServeHTTP(w, httptest.NewRequest("GET", "/export.json", nil))
+
+		var decoded []map[string]int
+		if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("%d elements: invalid json %q: %v", n, w.Body.String(), err)
+		}
+
+		if len(decoded) != n || (n > 0 && decoded[n-1]["i"] != n-1) {
+			t.Errorf("%d elements: got %v", n, decoded)
+		}
+
+		if w.Code != http.StatusOK || w.Header().Get("content-type") != "application/json" {
+			t.Errorf("%d elements: unexpected status %d or content type %q", n, w.Code, w.Header().Get("content-type"))
+		}
+
+		if n > jsonStreamFlushInterval && !w.Flushed {
+			t.Errorf("%d elements: expected the response to be flushed along the way", n)
+		}
+	}
+}
+
+func TestAPIHandlerJSONStreamError(t *testing.T) {
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("expected a failed stream to abort the response, got %v", v)
+		}
+	}()
+
+	jsonStreamHandler(5, errors.New("db down")).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/export.json", nil))
+}
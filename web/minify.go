@@ -0,0 +1,171 @@
+package web
+
+import (
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+var confMinifyTemplates = config.RegisterOption("yagpdb.web.minify_templates", "Collapse the whitespace of the html templates once when they're parsed, so the indentation isn't rendered and sent with every page. Disabled with -devtemplates", true)
+
+// minifyTemplates returns true if the templates are minified when they're parsed
+func minifyTemplates() bool {
+	return confMinifyTemplates.GetBool() && !DevTemplates()
+}
+
+// the elements whose contents are copied as is, whitespace is significant in them
+var rawTextElements = []string{"pre", "textarea", "script", "style"}
+
+// minifyTemplate collapses the runs of whitespace in the text of a html template into a single newline or space, and
+// the ones between the attributes of tags into a space, which renders the same. The markup is minified before the template is parsed rather than the output of every render, so
+// it costs nothing per request. Template actions, tags and the contents of raw text elements are kept as they are.
+func minifyTemplate(src string) string {
+	var b strings.Builder
+	b.Grow(len(src))
+
+	for i := 0; i < len(src); {
+		switch {
+		case strings.HasPrefix(src[i:], "{{"):
+			end := templateActionEnd(src, i)
+			b.WriteString(src[i:end])
+			i = end
+
+		case strings.HasPrefix(src[i:], "<!--"):
+			end := strings.Index(src[i:], "-->")
+			if end == -1 {
+				end = len(src)
+			} else {
+				end += i + len("-->")
+			}
+			b.WriteString(src[i:end])
+			i = end
+
+		case src[i] == '<' && i+1 < len(src) && (isASCIILetter(src[i+1]) || src[i+1] == '/'):
+			end := tagEnd(src, i)
+			writeMinifiedTag(&b, src[i:end])
+
+			name := tagName(src[i:end])
+			i = end
+			for _, raw := range rawTextElements {
+				if name == raw {
+					contentsEnd := rawTextEnd(src, i, raw)
+					b.WriteString(src[i:contentsEnd])
+					i = contentsEnd
+					break
+				}
+			}
+
+		case isHTMLSpace(src[i]):
+			newline := false
+			for ; i < len(src) && isHTMLSpace(src[i]); i++ {
+				if src[i] == '\n' {
+					newline = true
+				}
+			}
+
+			if newline {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(' ')
+			}
+
+		default:
+			b.WriteByte(src[i])
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// templateActionEnd returns the index after the action starting at i
+func templateActionEnd(src string, i int) int {
+	end := strings.Index(src[i+2:], "}}")
+	if end == -1 {
+		return len(src)
+	}
+
+	return i + 2 + end + 2
+}
+
+// tagEnd returns the index after the tag starting at i, skipping over the quoted attribute values and actions in it
+func tagEnd(src string, i int) int {
+	var quote byte
+	for j := i + 1; j < len(src); {
+		switch {
+		case strings.HasPrefix(src[j:], "{{"):
+			j = templateActionEnd(src, j)
+			continue
+		case quote != 0:
+			if src[j] == quote {
+				quote = 0
+			}
+		case src[j] == '"' || src[j] == '\'':
+			quote = src[j]
+		case src[j] == '>':
+			return j + 1
+		}
+		j++
+	}
+
+	return len(src)
+}
+
+// writeMinifiedTag writes the tag with the whitespace between its attributes collapsed, the quoted values and
+// actions in it are kept as they are
+func writeMinifiedTag(b *strings.Builder, tag string) {
+	var quote byte
+	for i := 0; i < len(tag); {
+		switch {
+		case strings.HasPrefix(tag[i:], "{{"):
+			end := templateActionEnd(tag, i)
+			b.WriteString(tag[i:end])
+			i = end
+			continue
+		case quote != 0:
+			if tag[i] == quote {
+				quote = 0
+			}
+		case tag[i] == '"' || tag[i] == '\'':
+			quote = tag[i]
+		case isHTMLSpace(tag[i]):
+			for i < len(tag) && isHTMLSpace(tag[i]) {
+				i++
+			}
+			b.WriteByte(' ')
+			continue
+		}
+
+		b.WriteByte(tag[i])
+		i++
+	}
+}
+
+// tagName returns the lowercased name of the opening tag, empty for closing tags
+func tagName(tag string) string {
+	end := 1
+	for end < len(tag) && (isASCIILetter(tag[end]) || (end > 1 && tag[end] >= '0' && tag[end] <= '9')) {
+		end++
+	}
+
+	return strings.ToLower(tag[1:end])
+}
+
+// rawTextEnd returns the index of the closing tag of the raw text element whose contents start at i
+func rawTextEnd(src string, i int, name string) int {
+	for j := i; j+2+len(name) <= len(src); j++ {
+		if src[j] == '<' && src[j+1] == '/' && strings.EqualFold(src[j+2:j+2+len(name)], name) {
+			return j
+		}
+	}
+
+	return len(src)
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
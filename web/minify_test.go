@@ -0,0 +1,61 @@
+package web
+
+import (
+	"html/template"
+	"io/fs"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/frontend"
+)
+
+func TestMinifyTemplate(t *testing.T) {
+	cases := []struct {
+		name, src, expected string
+	}{
+		{"indentation", "<div>\n    <p>a  b</p>\n</div>\n", "<div>\n<p>a b</p>\n</div>\n"},
+		{"actions", "{{if .X}}\n\t{{print \"a   b\"}}\n{{end}}", "{{if .X}}\n{{print \"a   b\"}}\n{{end}}"},
+		{"attributes", "<input  value=\"a   b\"\n   title='{{tr .Language \"x > y\"}}'>  c", "<input value=\"a   b\" title='{{tr .Language \"x > y\"}}'> c"},
+		{"raw text", "<pre>a\n    b</pre>  <SCRIPT nonce=\"{{.CSPNonce}}\">\n  var a =  1\n</script>", "<pre>a\n    b</pre> <SCRIPT nonce=\"{{.CSPNonce}}\">\n  var a =  1\n</script>"},
+		{"comments", "<!--  keep\n  this -->  a", "<!--  keep\n  this --> a"},
+		{"less than", "1  <  2", "1 < 2"},
+	}
+
+	for _, c := range cases {
+		if got := minifyTemplate(c.src); got != c.expected {
+			t.Errorf("%s: got %q, expected %q", c.name, got, c.expected)
+		}
+	}
+}
+
+func TestMinifyCoreTemplates(t *testing.T) {
+	err := fs.WalkDir(frontend.CoreTemplates, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		contents, err := frontend.CoreTemplates.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		src, err := template.New(path).Funcs(templateFuncs).Parse(string(contents))
+		if err != nil {
+			return err
+		}
+
+		minified, err := template.New(path).Funcs(templateFuncs).Parse(minifyTemplate(string(contents)))
+		if err != nil {
+			t.Errorf("%s no longer parses after minifying: %v", path, err)
+			return nil
+		}
+
+		if len(minified.Templates()) != len(src.Templates()) {
+			t.Errorf("%s defines %d templates after minifying, expected %d", path, len(minified.Templates()), len(src.Templates()))
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
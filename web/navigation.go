@@ -0,0 +1,120 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"goji.io/middleware"
+)
+
+// Breadcrumb is an entry of the breadcrumbs on top of control panel pages, the url is empty if it isn't a link, e.g
+// for the page being viewed
+type Breadcrumb struct {
+	Name string
+	URL  string
+}
+
+// the names of the sidebar categories in the nav, the items of the top category aren't in one
+var sidebarCategoryNames = map[string]string{
+	SidebarCategoryCore:  "Core",
+	SidebarCategoryFeeds: "Notifications & Feeds",
+	SidebarCategoryTools: "Tools & Utilities",
+	SidebarCategoryFun:   "Fun",
+}
+
+var sidebarCategories = []string{SidebarCategoryTopLevel, SidebarCategoryCore, SidebarCategoryFeeds, SidebarCategoryTools, SidebarCategoryFun}
+
+// NavigationMW sets the breadcrumbs and the active sidebar item of the control panel pages of a server, from the route
+// the request matched in the mux it's used in, so handlers don't have to
+func NavigationMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		guild, ok := r.Context().Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet)
+		if !ok {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		category, item := matchSidebarItem(routePath(r))
+
+		ctx, tmpl := GetCreateTemplateData(r.Context())
+		tmpl.SetNavigation(category, item, guildBreadcrumbs(guild, category, item, r.URL.Path))
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// routePath returns the static part of the route pattern the request matched, e.g "customcommands" for
+// "/customcommands/*" and "secrets" for "/secrets/:name/rotate"
+func routePath(r *http.Request) string {
+	pattern, ok := middleware.Pattern(r.Context()).(fmt.Stringer)
+	if !ok {
+		return ""
+	}
+
+	var parts []string
+	for _, segment := range strings.Split(pattern.String(), "/") {
+		if strings.HasPrefix(segment, ":") || segment == "*" {
+			break
+		}
+
+		if segment != "" {
+			parts = append(parts, segment)
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// matchSidebarItem returns the sidebar item with the longest url the path is under, and its category
+func matchSidebarItem(path string) (string, *SidebarItem) {
+	var (
+		bestCategory string
+		best         *SidebarItem
+		bestLength   int
+	)
+
+	for _, category := range sidebarCategories {
+		for _, item := range sideBarItems[category] {
+			if item.External {
+				continue
+			}
+
+			itemPath := strings.Trim(strings.SplitN(item.URL, "?", 2)[0], "/")
+			if itemPath == "" || len(itemPath) <= bestLength {
+				continue
+			}
+
+			if path == itemPath || strings.HasPrefix(path, itemPath+"/") {
+				bestCategory, best, bestLength = category, item, len(itemPath)
+			}
+		}
+	}
+
+	return bestCategory, best
+}
+
+// guildBreadcrumbs returns the breadcrumbs of a control panel page of the server, the crumb of the page being viewed
+// isn't a link
+func guildBreadcrumbs(guild *dstate.GuildSet, category string, item *SidebarItem, requestPath string) []*Breadcrumb {
+	guildURL := "/manage/" + discordgo.StrID(guild.ID)
+	crumbs := []*Breadcrumb{{Name: guild.Name, URL: guildURL + "/home"}}
+
+	if item != nil {
+		if name, ok := sidebarCategoryNames[category]; ok {
+			crumbs = append(crumbs, &Breadcrumb{Name: name})
+		}
+
+		crumbs = append(crumbs, &Breadcrumb{Name: item.Name, URL: guildURL + "/" + strings.TrimSuffix(item.URL, "/")})
+	}
+
+	for _, v := range crumbs {
+		if strings.TrimSuffix(v.URL, "/") == strings.TrimSuffix(requestPath, "/") {
+			v.URL = ""
+		}
+	}
+
+	return crumbs
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"goji.io"
+	"goji.io/pat"
+)
+
+func TestRoutePath(t *testing.T) {
+	var got string
+	mux := goji.NewMux()
+	mux.Use(func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = routePath(r)
+		})
+	})
+	for _, p := range []string{"/secrets", "/secrets/:name/rotate", "/commands/settings/*"} {
+		mux.Handle(pat.New(p), http.NotFoundHandler())
+	}
+
+	cases := map[string]string{
+		"/secrets":                   "secrets",
+		"/secrets/abc/rotate":        "secrets",
+		"/commands/settings/channel": "commands/settings",
+		"/nope":                      "",
+	}
+
+	for path, expected := range cases {
+		got = "unset"
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		if got != expected {
+			t.Errorf("%s: got %q, expected %q", path, got, expected)
+		}
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	defer func(items map[string][]*SidebarItem) { sideBarItems = items }(sideBarItems)
+
+	commands := &SidebarItem{Name: "Commands", URL: "commands/settings"}
+	customCommands := &SidebarItem{Name: "Custom commands", URL: "customcommands"}
+	sideBarItems = map[string][]*SidebarItem{
+		SidebarCategoryCore:  {commands, {Name: "Docs", URL: "https://docs.yagpdb.xyz", External: true}},
+		SidebarCategoryTools: {customCommands, {Name: "Custom", URL: "custom"}},
+	}
+
+	if category, item := matchSidebarItem("customcommands"); category != SidebarCategoryTools || item != customCommands {
+		t.Errorf("expected the custom commands item, got %v in %q", item, category)
+	}
+
+	if _, item := matchSidebarItem("commands/settings"); item != commands {
+		t.Errorf("expected the commands item, got %v", item)
+	}
+
+	if _, item := matchSidebarItem("commands"); item != nil {
+		t.Errorf("expected no item for a path above an item, got %v", item)
+	}
+
+	guild := &dstate.GuildSet{GuildState: dstate.GuildState{ID: 1, Name: "Server"}}
+	crumbs := guildBreadcrumbs(guild, SidebarCategoryTools, customCommands, "/manage/1/customcommands/commands/5/")
+	want := []*Breadcrumb{
+		{Name: "Server", URL: "/manage/1/home"},
+		{Name: "Tools & Utilities"},
+		{Name: "Custom commands", URL: "/manage/1/customcommands"},
+	}
+	if !reflect.DeepEqual(crumbs, want) {
+		t.Errorf("got %+v, want %+v", crumbs, want)
+	}
+
+	crumbs = guildBreadcrumbs(guild, SidebarCategoryTools, customCommands, "/manage/1/customcommands/")
+	if crumbs[len(crumbs)-1].URL != "" {
+		t.Errorf("expected the crumb of the page being viewed not to be a link, got %+v", crumbs[len(crumbs)-1])
+	}
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+	"golang.org/x/oauth2"
+)
+
+// how long the user has to complete the oauth flow, in seconds
+const oauthStateTTL = 600
+
+// the browser that started the oauth flow gets this cookie, so the state can't be used from anywhere else
+const oauthBindingCookieName = "yagpdb-oauth-binding"
+
+var ErrInvalidOAuthState = errors.New("invalid, expired or already used oauth state")
+
+// oauthState is stored in redis for every oauth flow that's started, and removed when it's used
+type oauthState struct {
+	// Binding is the hash of the binding cookie of the browser that started the flow
+	Binding string
+
+	// CodeVerifier is the PKCE verifier, discord only gets the S256 challenge of it
+	CodeVerifier string
+
+	Goto        string
+	Application string
+
+	// StepUp is set if this is a identity confirmation of a logged in user instead of a login
+	StepUp *stepUpState
+
+	// LinkedRoles is set if the user is connecting their account for discord's linked roles
+	LinkedRoles bool
+}
+
+func keyOAuthState(state string) string {
+	return "web_oauth_state:" + state
+}
+
+func randURLSafe(size int) string {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashOAuthBinding(binding string) string {
+	h := sha256.Sum256([]byte(binding))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// pkceChallenge returns the S256 code challenge of the verifier
+func pkceChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// startOAuthFlow stores the state and binds it to the browser, returning the url to send the user to
+func startOAuthFlow(w http.ResponseWriter, app *Application, st *oauthState, opts ...oauth2.AuthCodeOption) (string, error) {
+	binding := randURLSafe(32)
+	st.Binding = hashOAuthBinding(binding)
+	st.CodeVerifier = randURLSafe(64)
+	st.Application = app.Name
+
+	serialized, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+
+	state := randURLSafe(32)
+	err = common.RedisPool.Do(radix.Cmd(nil, "SET", keyOAuthState(state), string(serialized), "EX", strconv.Itoa(oauthStateTTL), "NX"))
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, applyCookieAttributes(&http.Cookie{
+		Name:   oauthBindingCookieName,
+		Value:  binding,
+		MaxAge: oauthStateTTL,
+		Path:   "/",
+	}))
+
+	opts = append(opts, oauth2.AccessTypeOnline,
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(st.CodeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	return app.OauthConf.AuthCodeURL(state, opts...), nil
+}
+
+// consumeOAuthState returns the stored state if it exists and was started by the same browser,
+// the state is removed in either case so it can only be used once
+func consumeOAuthState(w http.ResponseWriter, r *http.Request, state string) (*oauthState, error) {
+	if state == "" {
+		return nil, ErrInvalidOAuthState
+	}
+
+	var serialized string
+	var deleted int
+	err := common.RedisPool.Do(radix.Cmd(&serialized, "GET", keyOAuthState(state)))
+	if err == nil {
+		err = common.RedisPool.Do(radix.Cmd(&deleted, "DEL", keyOAuthState(state)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// no longer needed
+	http.SetCookie(w, applyCookieAttributes(&http.Cookie{Name: oauthBindingCookieName, Value: "none", MaxAge: -1, Path: "/"}))
+
+	if serialized == "" || deleted < 1 {
+		// expired, already used, or used concurrently by another request
+		return nil, ErrInvalidOAuthState
+	}
+
+	var st oauthState
+	err = json.Unmarshal([]byte(serialized), &st)
+	if err != nil {
+		return nil, err
+	}
+
+	cookie, err := r.Cookie(oauthBindingCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashOAuthBinding(cookie.Value)), []byte(st.Binding)) != 1 {
+		return nil, ErrInvalidOAuthState
+	}
+
+	return &st, nil
+}
+
+// exchangeOAuthCode exchanges the code for a token, proving we started the flow with the PKCE verifier
+func exchangeOAuthCode(r *http.Request, st *oauthState) (*oauth2.Token, error) {
+	return GetApplication(st.Application).OauthConf.Exchange(r.Context(), r.FormValue("code"), oauth2.SetAuthURLParam("code_verifier", st.CodeVerifier))
+}
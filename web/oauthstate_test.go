@@ -0,0 +1,26 @@
+package web
+
+import "testing"
+
+func TestPKCEChallenge(t *testing.T) {
+	// unpadded base64url of the sha256 of the verifier
+	challenge := pkceChallenge("abc")
+	if challenge != "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0" {
+		t.Errorf("unexpected challenge %s", challenge)
+	}
+}
+
+func TestRandURLSafe(t *testing.T) {
+	verifier := randURLSafe(64)
+
+	// PKCE verifiers have to be between 43 and 128 characters of [A-Za-z0-9-._~]
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Fatalf("verifier length %d out of range", len(verifier))
+	}
+
+	for _, r := range verifier {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			t.Fatalf("invalid character %q in verifier", r)
+		}
+	}
+}
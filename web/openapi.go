@@ -0,0 +1,414 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"goji.io"
+	"goji.io/pat"
+)
+
+// APIRoutes registers APIHandler endpoints on a mux and documents them in the OpenAPI document served at
+// /api/openapi.json, so clients can be generated for them:
+//
+//	routes := web.NewAPIRoutes(guildMux, "/public-api/v1/guilds/:server", "Public API")
+//	routes.Handle(pat.Get("/stats"), handleGetStats, &web.APIDoc{Summary: "Stats of the server", Response: &Stats{}})
+type APIRoutes struct {
+	mux *goji.Mux
+
+	// prefix is the path the mux is mounted on
+	prefix string
+	tag    string
+}
+
+// NewAPIRoutes returns the routes of the mux mounted on prefix, the endpoints are grouped under the tag in the document
+func NewAPIRoutes(mux *goji.Mux, prefix, tag string) *APIRoutes {
+	return &APIRoutes{
+		mux:    mux,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		tag:    tag,
+	}
+}
+
+// APIDoc documents a endpoint
+type APIDoc struct {
+	Summary     string
+	Description string
+
+	// Query are the query params the endpoint takes
+	Query []APIParam
+
+	// Request and Response are values of the types of the request and response bodies, the schemas are generated from
+	// their types. Nil for endpoints without a body.
+	Request  interface{}
+	Response interface{}
+
+	// Public endpoints don't need authentication
+	Public bool
+}
+
+// APIParam is a query param of a endpoint
+type APIParam struct {
+	Name        string
+	Description string
+}
+
+type apiRoute struct {
+	method string
+	path   string
+	tag    string
+	doc    *APIDoc
+}
+
+var (
+	apiRoutes   []*apiRoute
+	apiRoutesMu sync.RWMutex
+)
+
+// Handle registers the handler on the mux with APIHandler and documents it, the pattern has to have a method
+func (a *APIRoutes) Handle(pattern *pat.Pattern, handler CustomHandlerFunc, doc *APIDoc) {
+	a.mux.Handle(pattern, APIHandler(handler))
+
+	if doc == nil {
+		doc = &APIDoc{}
+	}
+
+	apiRoutesMu.Lock()
+	defer apiRoutesMu.Unlock()
+
+	for method := range pattern.HTTPMethods() {
+		// pat.Get also matches HEAD
+		if method == http.MethodHead && len(pattern.HTTPMethods()) > 1 {
+			continue
+		}
+
+		apiRoutes = append(apiRoutes, &apiRoute{
+			method: method,
+			path:   a.prefix + pattern.String(),
+			tag:    a.tag,
+			doc:    doc,
+		})
+	}
+}
+
+// OpenAPIDocument is a OpenAPI 3 document, only the parts used by the generated one
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Servers    []map[string]string                     `json:"servers"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIOperation struct {
+	Tags        []string                    `json:"tags,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	OperationID string                      `json:"operationId"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security"`
+}
+
+type OpenAPIParameter struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required"`
+	Schema      OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIBody struct {
+	Required bool                                `json:"required"`
+	Content  map[string]map[string]OpenAPISchema `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                              `json:"description"`
+	Content     map[string]map[string]OpenAPISchema `json:"content,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]OpenAPISchema     `json:"schemas"`
+	SecuritySchemes map[string]map[string]string `json:"securitySchemes"`
+}
+
+// OpenAPISchema is a json schema
+type OpenAPISchema map[string]interface{}
+
+func jsonContent(schema OpenAPISchema) map[string]map[string]OpenAPISchema {
+	return map[string]map[string]OpenAPISchema{"application/json": {"schema": schema}}
+}
+
+// GenerateOpenAPI returns the document of the endpoints registered with APIRoutes
+func GenerateOpenAPI() *OpenAPIDocument {
+	apiRoutesMu.RLock()
+	routes := make([]*apiRoute, len(apiRoutes))
+	copy(routes, apiRoutes)
+	apiRoutesMu.RUnlock()
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].path != routes[j].path {
+			return routes[i].path < routes[j].path
+		}
+		return routes[i].method < routes[j].method
+	})
+
+	schemas := newSchemaGenerator()
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    OpenAPIInfo{Title: "YAGPDB API", Version: common.VERSION},
+		Servers: []map[string]string{{"url": BaseURL()}},
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: schemas.components,
+			SecuritySchemes: map[string]map[string]string{
+				"bearer": {"type": "http", "scheme": "bearer", "description": "A api key or token, depending on the api"},
+			},
+		},
+	}
+
+	errorSchema := schemas.schema(reflect.TypeOf(apiError{}))
+	for _, route := range routes {
+		path, params := openAPIPath(route.path)
+
+		op := &OpenAPIOperation{
+			Summary:     route.doc.Summary,
+			Description: route.doc.Description,
+			OperationID: openAPIOperationID(route.method, route.path),
+			Parameters:  params,
+			Responses: map[string]*OpenAPIResponse{
+				"200":     {Description: "OK"},
+				"default": {Description: "Error", Content: jsonContent(errorSchema)},
+			},
+			Security: []map[string][]string{{"bearer": {}}},
+		}
+
+		if route.tag != "" {
+			op.Tags = []string{route.tag}
+		}
+
+		if route.doc.Public {
+			op.Security = []map[string][]string{}
+		}
+
+		for _, v := range route.doc.Query {
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{Name: v.Name, In: "query", Description: v.Description, Schema: OpenAPISchema{"type": "string"}})
+		}
+
+		if route.doc.Request != nil {
+			op.RequestBody = &OpenAPIBody{Required: true, Content: jsonContent(schemas.schema(reflect.TypeOf(route.doc.Request)))}
+		}
+
+		if route.doc.Response != nil {
+			op.Responses["200"].Content = jsonContent(schemas.schema(reflect.TypeOf(route.doc.Response)))
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.method)] = op
+	}
+
+	return doc
+}
+
+// HandleOpenAPI serves the OpenAPI document at /api/openapi.json
+func HandleOpenAPI(w http.ResponseWriter, r *http.Request) interface{} {
+	// api explorers are usually on other sites, the document is public anyway
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	return GenerateOpenAPI()
+}
+
+// apiError is the body of APIHandler errors, documented as the response of failed requests
+type apiError struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// openAPIPath converts the goji path params to the {param} syntax of OpenAPI, returning them as parameters
+func openAPIPath(path string) (string, []*OpenAPIParameter) {
+	var params []*OpenAPIParameter
+
+	split := strings.Split(path, "/")
+	for i, v := range split {
+		if !strings.HasPrefix(v, ":") {
+			continue
+		}
+
+		name := v[1:]
+		split[i] = "{" + name + "}"
+		params = append(params, &OpenAPIParameter{Name: name, In: "path", Required: true, Schema: OpenAPISchema{"type": "string"}})
+	}
+
+	return strings.Join(split, "/"), params
+}
+
+// openAPIOperationID returns a id unique to the endpoint, e.g getApiV1GuildsServerConfig
+func openAPIOperationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+
+	upper := true
+	for _, c := range path {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			upper = true
+			continue
+		}
+
+		if upper {
+			b.WriteString(strings.ToUpper(string(c)))
+			upper = false
+		} else {
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaGenerator generates the schemas of types following the rules of encoding/json, named structs become components
+// so they're only described once and can refer to themselves
+type schemaGenerator struct {
+	components map[string]OpenAPISchema
+	names      map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		components: make(map[string]OpenAPISchema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+func (s *schemaGenerator) schema(t reflect.Type) OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return OpenAPISchema{"type": "string", "format": "date-time"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		// encoded in a way of its own, e.g the null types
+		return OpenAPISchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return OpenAPISchema{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return OpenAPISchema{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return OpenAPISchema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return OpenAPISchema{"type": "number"}
+	case reflect.String:
+		return OpenAPISchema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json base64 encodes bytes
+			return OpenAPISchema{"type": "string", "format": "byte"}
+		}
+		return OpenAPISchema{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return OpenAPISchema{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		return s.structSchema(t)
+	}
+
+	// interfaces, anything goes
+	return OpenAPISchema{}
+}
+
+func (s *schemaGenerator) structSchema(t reflect.Type) OpenAPISchema {
+	if t.Name() == "" {
+		return s.objectSchema(t)
+	}
+
+	name, ok := s.names[t]
+	if !ok {
+		name = t.Name()
+		// types with the same name in different packages
+		for i := 2; s.components[name] != nil; i++ {
+			name = t.Name() + strconv.Itoa(i)
+		}
+
+		// set before generating the properties, which can refer to the type
+		s.names[t] = name
+		s.components[name] = OpenAPISchema{}
+		s.components[name] = s.objectSchema(t)
+	}
+
+	return OpenAPISchema{"$ref": "#/components/schemas/" + name}
+}
+
+// objectSchema returns the schema of the fields of the struct, fields of embedded structs are included like
+// encoding/json does
+func (s *schemaGenerator) objectSchema(t reflect.Type) OpenAPISchema {
+	properties := make(map[string]interface{})
+	s.addFields(t, properties)
+
+	return OpenAPISchema{"type": "object", "properties": properties}
+}
+
+func (s *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		split := strings.SplitN(tag, ",", 2)
+		name, opts := split[0], ""
+		if len(split) > 1 {
+			opts = split[1]
+		}
+
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if field.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			s.addFields(ft, properties)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := s.schema(field.Type)
+		if strings.Contains(","+opts+",", ",string,") {
+			// numbers and bools encoded as strings, like ids
+			schema = OpenAPISchema{"type": "string"}
+		}
+
+		properties[name] = schema
+	}
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"goji.io"
+	"goji.io/pat"
+)
+
+type openAPITestBase struct {
+	ID int64 `json:"id,string"`
+}
+
+type openAPITestItem struct {
+	*openAPITestBase
+	Name     string             `json:"name"`
+	Created  time.Time          `json:"created"`
+	Children []*openAPITestItem `json:"children,omitempty"`
+	Secret   string             `json:"-"`
+	Untagged bool
+	private  int
+}
+
+func TestOpenAPISchema(t *testing.T) {
+	gen := newSchemaGenerator()
+
+	ref := gen.schema(reflect.TypeOf([]*openAPITestItem{}))
+	if ref["type"] != "array" || !reflect.DeepEqual(ref["items"], OpenAPISchema{"$ref": "#/components/schemas/openAPITestItem"}) {
+		t.Fatalf("expected a array of refs, got %v", ref)
+	}
+
+	properties := gen.components["openAPITestItem"]["properties"].(map[string]interface{})
+
+	expected := map[string]OpenAPISchema{
+		"id":       {"type": "string"},
+		"name":     {"type": "string"},
+		"created":  {"type": "string", "format": "date-time"},
+		"children": {"type": "array", "items": OpenAPISchema{"$ref": "#/components/schemas/openAPITestItem"}},
+		"Untagged": {"type": "boolean"},
+	}
+
+	if len(properties) != len(expected) {
+		t.Errorf("expected the properties %v, got %v", expected, properties)
+	}
+
+	for k, v := range expected {
+		if !reflect.DeepEqual(properties[k], v) {
+			t.Errorf("property %s: expected %v, got %v", k, v, properties[k])
+		}
+	}
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	path, params := openAPIPath("/api/v1/guilds/:server/config/:plugin")
+	if path != "/api/v1/guilds/{server}/config/{plugin}" || len(params) != 2 || params[0].Name != "server" || params[1].Name != "plugin" {
+		t.Errorf("unexpected path %s with params %v", path, params)
+	}
+
+	if id := openAPIOperationID("PATCH", "/api/v1/guilds/:server/config"); id != "patchApiV1GuildsServerConfig" {
+		t.Errorf("unexpected operation id %s", id)
+	}
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	defer func(old []*apiRoute) { apiRoutes = old }(apiRoutes)
+	apiRoutes = nil
+
+	mux := goji.NewMux()
+	routes := NewAPIRoutes(mux, "/test/:server/", "Test")
+	routes.Handle(pat.Get("/items"), func(w http.ResponseWriter, r *http.Request) interface{} {
+		return []*openAPITestItem{{Name: "a"}}
+	}, &APIDoc{Summary: "The items", Response: []*openAPITestItem{}, Query: []APIParam{{Name: "limit"}}, Public: true})
+	routes.Handle(pat.Post("/items"), func(w http.ResponseWriter, r *http.Request) interface{} {
+		return nil
+	}, &APIDoc{Summary: "Add a item", Request: &openAPITestItem{}})
+
+	// the routes are still served
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/items", nil))
+	if !strings.Contains(w.Body.String(), `"name":"a"`) {
+		t.Errorf("expected the items, got %s", w.Body.String())
+	}
+
+	doc := GenerateOpenAPI()
+	ops := doc.Paths["/test/{server}/items"]
+	if len(ops) != 2 || ops["get"] == nil || ops["post"] == nil {
+		t.Fatalf("expected a get and post operation, got %v", ops)
+	}
+
+	get := ops["get"]
+	if get.Summary != "The items" || len(get.Parameters) != 2 || get.Parameters[1].In != "query" || len(get.Security) != 0 || get.Tags[0] != "Test" {
+		t.Errorf("unexpected get operation %+v", get)
+	}
+
+	if ops["post"].RequestBody == nil || len(ops["post"].Security) != 1 {
+		t.Errorf("expected the post operation to have a body and need authentication, got %+v", ops["post"])
+	}
+
+	if _, ok := doc.Components.Schemas["openAPITestItem"]; !ok {
+		t.Errorf("expected the item schema in the components, got %v", doc.Components.Schemas)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Errorf("failed encoding the document: %v", err)
+	}
+}
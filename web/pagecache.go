@@ -0,0 +1,279 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confPageCacheTTL = config.RegisterOption("yagpdb.web.page_cache_ttl", "Default seconds anonymous pages such as the status page are cached in redis for, 0 disables the page cache", 30)
+
+	metricsPageCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_web_page_cache_total",
+		Help: "Anonymous requests to cached pages, by group and whether they were served from the cache",
+	}, []string{"group", "result"})
+)
+
+const (
+	// pages larger than this aren't cached
+	maxCachedPageSize = 1 << 20
+
+	// urls longer than this aren't cached, so random query strings can't fill up redis with huge keys
+	maxCachedPageURLLength = 512
+)
+
+// the groups of the cached pages, for purging all of them
+var pageCacheGroups = make(map[string]bool)
+
+// cachedResponse is a page in the cache, with the nonce the inline scripts were rendered with so it can be replaced
+// with the nonce of the request serving it
+type cachedResponse struct {
+	Header map[string]string `json:"header"`
+	Body   []byte            `json:"body"`
+	Nonce  string            `json:"nonce"`
+}
+
+func cachedPageHeaders() []string {
+	return []string{"Content-Type", "Cache-Control"}
+}
+
+// CachedPage caches the responses of inner to logged out users in redis, so traffic spikes don't render the
+// templates and look up the data of the page on every request. Pages are cached per path, query and theme cookies
+// for ttl, or yagpdb.web.page_cache_ttl if it's 0, use PurgePageCache to purge the group before that.
+func CachedPage(group string, ttl time.Duration, inner http.Handler) http.Handler {
+	pageCacheGroups[group] = true
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ttl := ttl
+		if ttl <= 0 {
+			ttl = time.Duration(confPageCacheTTL.GetInt()) * time.Second
+		}
+
+		key := pageCacheKey(group, r)
+		if ttl <= 0 || key == "" || !anonymousRequest(r) || RedisDegraded() || DevTemplates() {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		page, err := getCachedPage(key)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed retrieving cached page")
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if page != nil {
+			metricsPageCache.With(prometheus.Labels{"group": group, "result": "hit"}).Inc()
+			writeCachedPage(w, r, page)
+			return
+		}
+
+		metricsPageCache.With(prometheus.Labels{"group": group, "result": "miss"}).Inc()
+		w.Header().Set("X-Page-Cache", "MISS")
+		if r.Method == http.MethodHead {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &pageRecorder{ResponseWriter: w}
+		inner.ServeHTTP(rec, r)
+
+		page = rec.cachedResponse()
+		if page == nil {
+			return
+		}
+		page.Nonce = ContextCSPNonce(r.Context())
+
+		err = storeCachedPage(group, key, page, ttl)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed storing cached page")
+		}
+	})
+}
+
+// anonymousRequest returns true if the response to the request is the same for every logged out user
+func anonymousRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if r.Header.Get("Authorization") != "" || r.Context().Value(common.ContextKeyUser) != nil {
+		return false
+	}
+
+	// treated as logged in even if the session turns out to be invalid, like the landing page cache
+	_, err := r.Cookie(SessionCookieName)
+	return err != nil
+}
+
+// pageCacheKey returns the redis key of the page, empty if it shouldn't be cached. The version is part of it so
+// pages rendered by the templates of the previous version aren't served after a deploy.
+func pageCacheKey(group string, r *http.Request) string {
+	if len(r.URL.RequestURI()) > maxCachedPageURLLength {
+		return ""
+	}
+
+	variant := "d"
+	if cookieEnabled(r, "light_theme") {
+		variant = "l"
+	}
+	if cookieEnabled(r, "sidebar_collapsed") {
+		variant += "c"
+	}
+	variant += "-" + RequestLanguage(r)
+
+	// sorted by the encoding so the order of the parameters doesn't matter
+	return "page_cache:" + group + ":" + common.VERSION + ":" + variant + ":" + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+func pageCacheGroupKey(group string) string {
+	return "page_cache_keys:" + group
+}
+
+func getCachedPage(key string) (*cachedResponse, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "GET", key))
+	if err != nil || len(raw) == 0 {
+		return nil, errors.WithStackIf(err)
+	}
+
+	var page *cachedResponse
+	err = json.Unmarshal(raw, &page)
+	return page, errors.WithStackIf(err)
+}
+
+func storeCachedPage(group, key string, page *cachedResponse, ttl time.Duration) error {
+	encoded, err := json.Marshal(page)
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	seconds := int(ttl.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	groupKey := pageCacheGroupKey(group)
+	err = common.RedisPool.Do(radix.Pipeline(
+		radix.Cmd(nil, "SET", key, string(encoded), "EX", strconv.Itoa(seconds)),
+		radix.Cmd(nil, "SADD", groupKey, key),
+		radix.Cmd(nil, "EXPIRE", groupKey, strconv.Itoa(seconds)),
+	))
+	return errors.WithStackIf(err)
+}
+
+func writeCachedPage(w http.ResponseWriter, r *http.Request, page *cachedResponse) {
+	for k, v := range page.Header {
+		w.Header().Set(k, v)
+	}
+
+	// the csp header of this response has its own nonce, visitors can't learn the nonce of other visitors
+	body := page.Body
+	if nonce := ContextCSPNonce(r.Context()); page.Nonce != "" && nonce != "" {
+		body = bytes.ReplaceAll(body, []byte(page.Nonce), []byte(nonce))
+	}
+
+	w.Header().Set("X-Page-Cache", "HIT")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// PurgePageCache removes the cached pages of the groups, e.g after something shown on them changed
+func PurgePageCache(groups ...string) error {
+	for _, group := range groups {
+		groupKey := pageCacheGroupKey(group)
+
+		var keys []string
+		err := common.RedisPool.Do(radix.Cmd(&keys, "SMEMBERS", groupKey))
+		if err != nil {
+			return errors.WithStackIf(err)
+		}
+
+		err = common.RedisPool.Do(radix.Cmd(nil, "DEL", append(keys, groupKey)...))
+		if err != nil {
+			return errors.WithStackIf(err)
+		}
+	}
+
+	return nil
+}
+
+// PurgeAllPageCaches removes every cached page
+func PurgeAllPageCaches() error {
+	groups := make([]string, 0, len(pageCacheGroups))
+	for k := range pageCacheGroups {
+		groups = append(groups, k)
+	}
+	sort.Strings(groups)
+
+	return PurgePageCache(groups...)
+}
+
+// pageRecorder keeps a copy of the response written through it, for the page cache
+type pageRecorder struct {
+	http.ResponseWriter
+
+	status   int
+	buf      bytes.Buffer
+	tooLarge bool
+}
+
+func (p *pageRecorder) WriteHeader(code int) {
+	if p.status == 0 {
+		p.status = code
+	}
+
+	p.ResponseWriter.WriteHeader(code)
+}
+
+func (p *pageRecorder) Write(b []byte) (int, error) {
+	if p.status == 0 {
+		p.status = http.StatusOK
+	}
+
+	if !p.tooLarge {
+		if p.buf.Len()+len(b) > maxCachedPageSize {
+			p.tooLarge = true
+			p.buf = bytes.Buffer{}
+		} else {
+			p.buf.Write(b)
+		}
+	}
+
+	return p.ResponseWriter.Write(b)
+}
+
+// cachedResponse returns the recorded response for the cache, nil if it shouldn't be cached: errors, redirects and
+// responses setting cookies
+func (p *pageRecorder) cachedResponse() *cachedResponse {
+	if p.status != http.StatusOK || p.tooLarge || p.buf.Len() == 0 {
+		return nil
+	}
+
+	header := p.Header()
+	if _, ok := header["Set-Cookie"]; ok {
+		return nil
+	}
+
+	page := &cachedResponse{Header: make(map[string]string), Body: p.buf.Bytes()}
+	for _, k := range cachedPageHeaders() {
+		if v := header.Get(k); v != "" {
+			page.Header[k] = v
+		}
+	}
+
+	return page
+}
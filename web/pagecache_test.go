@@ -0,0 +1,176 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestAnonymousRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/status", nil)
+	if !anonymousRequest(r) {
+		t.Error("expected a logged out request to be anonymous")
+	}
+
+	r = httptest.NewRequest("POST", "/status", nil)
+	if anonymousRequest(r) {
+		t.Error("a post request was anonymous")
+	}
+
+	r = httptest.NewRequest("GET", "/status", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "x"})
+	if anonymousRequest(r) {
+		t.Error("a request with a session cookie was anonymous")
+	}
+
+	r = httptest.NewRequest("GET", "/status", nil)
+	r.Header.Set("Authorization", "Bearer x")
+	if anonymousRequest(r) {
+		t.Error("a request with an api key was anonymous")
+	}
+
+	r = httptest.NewRequest("GET", "/status", nil)
+	r = r.WithContext(context.WithValue(r.Context(), common.ContextKeyUser, &discordgo.User{ID: 1}))
+	if anonymousRequest(r) {
+		t.Error("a logged in request was anonymous")
+	}
+}
+
+func TestPageCacheKey(t *testing.T) {
+	a := pageCacheKey("landing", httptest.NewRequest("GET", "/?ref=top&a=1", nil))
+	b := pageCacheKey("landing", httptest.NewRequest("GET", "/?a=1&ref=top", nil))
+	if a != b {
+		t.Errorf("the order of the query parameters changed the key: %q and %q", a, b)
+	}
+
+	light := httptest.NewRequest("GET", "/?ref=top&a=1", nil)
+	light.AddCookie(&http.Cookie{Name: "light_theme", Value: "true"})
+	if pageCacheKey("landing", light) == a {
+		t.Error("expected the theme to be part of the key")
+	}
+
+	if key := pageCacheKey("landing", httptest.NewRequest("GET", "/?q="+strings.Repeat("a", maxCachedPageURLLength), nil)); key != "" {
+		t.Errorf("expected a long url not to be cached, got key %q", key)
+	}
+}
+
+func TestPageRecorder(t *testing.T) {
+	record := func(handler http.HandlerFunc) *cachedResponse {
+		rec := &pageRecorder{ResponseWriter: httptest.NewRecorder()}
+		handler(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.cachedResponse()
+	}
+
+	page := record(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Request-ID", "abc")
+		w.Write([]byte("<html>"))
+		w.Write([]byte("</html>"))
+	})
+	if page == nil || string(page.Body) != "<html></html>" {
+		t.Fatalf("expected the page to be recorded, got %+v", page)
+	}
+
+	if page.Header["Content-Type"] != "text/html" || page.Header["X-Request-ID"] != "" {
+		t.Errorf("expected only the content type to be kept, got %v", page.Header)
+	}
+
+	uncacheable := map[string]http.HandlerFunc{
+		"error": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("oh no"))
+		},
+		"redirect": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/manage", http.StatusTemporaryRedirect)
+		},
+		"cookie": func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "light_theme", Value: "true"})
+			w.Write([]byte("<html></html>"))
+		},
+		"too large": func(w http.ResponseWriter, r *http.Request) {
+			w.Write(make([]byte, maxCachedPageSize))
+			w.Write([]byte("<html></html>"))
+		},
+	}
+
+	for name, handler := range uncacheable {
+		if page := record(handler); page != nil {
+			t.Errorf("%s: expected the response not to be cached", name)
+		}
+	}
+}
+
+func TestWriteCachedPage(t *testing.T) {
+	page := &cachedResponse{
+		Header: map[string]string{"Content-Type": "text/html"},
+		Body:   []byte(`<script nonce="rendered">a()</script><script nonce="rendered">b()</script>`),
+		Nonce:  "rendered",
+	}
+
+	r := httptest.NewRequest("GET", "/status", nil)
+	r = r.WithContext(context.WithValue(r.Context(), common.ContextKeyCSPNonce, "current"))
+
+	w := httptest.NewRecorder()
+	writeCachedPage(w, r, page)
+	if w.Body.String() != `<script nonce="current">a()</script><script nonce="current">b()</script>` {
+		t.Errorf("expected the nonce of the request in the page, got %q", w.Body.String())
+	}
+
+	if w.Header().Get("X-Page-Cache") != "HIT" || w.Header().Get("Content-Type") != "text/html" {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+
+	// the cached page is shared, so it's left as is
+	if string(page.Body) != `<script nonce="rendered">a()</script><script nonce="rendered">b()</script>` {
+		t.Errorf("the cached page was modified: %q", page.Body)
+	}
+}
+
+func TestCachedPage(t *testing.T) {
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	defer func(old interface{}) { confCSP.LoadedValue = old }(confCSP.LoadedValue)
+	confCSP.LoadedValue = defaultCSP
+
+	rendered := 0
+	handler := CachedPage("test", time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rendered++
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<script nonce="%s">hi()</script>`, ContextCSPNonce(r.Context()))
+	}))
+
+	defer PurgePageCache("test")
+	if err := PurgePageCache("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []string{"MISS", "HIT", "HIT"} {
+		// the security headers and the nonce are set by MiscMiddleware for every request
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/cached_page_test", nil)
+		r = r.WithContext(securityHeadersContext(w, r.Context()))
+		handler.ServeHTTP(w, r)
+
+		nonce := ContextCSPNonce(r.Context())
+		if w.Header().Get("X-Page-Cache") != expected || w.Body.String() != `<script nonce="`+nonce+`">hi()</script>` {
+			t.Errorf("request %d: expected a %s with the nonce %q, got %v %q", i, expected, nonce, w.Header(), w.Body.String())
+		}
+
+		if !strings.Contains(w.Header().Get(cspHeaderName()), "'nonce-"+nonce+"'") {
+			t.Errorf("request %d: expected the nonce of the request in the csp header, got %q", i, w.Header().Get(cspHeaderName()))
+		}
+	}
+
+	if rendered != 1 {
+		t.Errorf("expected the page to be rendered once, got %d", rendered)
+	}
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// DefaultPageSize is the page size of lists that don't have a size of their own
+	DefaultPageSize = 25
+	// MaxPageSize is the most items users can ask for on a page with the size query param
+	MaxPageSize = 100
+
+	// the pages shown on each side of the current page in the page list, the rest is collapsed into a gap
+	paginationWindow = 2
+)
+
+// Pagination splits a list in the control panel into pages, so the pages only load the items shown instead of all of
+// them. Set it as the Pagination of the template data and include {{template "cp_pagination" .Pagination}} to show the
+// page links:
+//
+//	p := web.ParsePagination(r, 50)
+//	total, err := countItems(guildID)
+//	p.SetTotal(total)
+//	items, err := getItems(guildID, p.Limit(), p.Offset())
+//	tmpl.SetPagination(p)
+type Pagination struct {
+	// Page is the current page, starting at 1
+	Page int
+	Size int
+
+	// Total is the amount of items in the list, -1 until SetTotal is called
+	Total int
+
+	defaultSize int
+	url         url.URL
+}
+
+// ParsePagination reads the page and size query params of the request, invalid and out of range values are clamped
+// instead of being an error as they're usually from users editing the url
+func ParsePagination(r *http.Request, defaultSize int) *Pagination {
+	if defaultSize < 1 || defaultSize > MaxPageSize {
+		defaultSize = DefaultPageSize
+	}
+
+	query := r.URL.Query()
+	p := &Pagination{Page: 1, Size: defaultSize, Total: -1, defaultSize: defaultSize, url: *r.URL}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 1 {
+		p.Page = page
+	}
+
+	if size, err := strconv.Atoi(query.Get("size")); err == nil && size > 0 {
+		p.Size = size
+		if size > MaxPageSize {
+			p.Size = MaxPageSize
+		}
+	}
+
+	// exports have the whole list on a single page
+	if isExportFormat(ExportFormat(r)) {
+		p.Page, p.Size = 1, MaxExportRows
+	}
+
+	// keeps the offset from overflowing, SetTotal clamps it further
+	if maxPage := math.MaxInt/p.Size + 1; p.Page > maxPage {
+		p.Page = maxPage
+	}
+
+	return p
+}
+
+// SetTotal sets the amount of items in the list, moving past the end to the last page, so call it before fetching the
+// items of the page
+func (p *Pagination) SetTotal(total int) {
+	if total < 0 {
+		total = 0
+	}
+
+	p.Total = total
+	if pages := p.Pages(); p.Page > pages {
+		p.Page = pages
+	}
+}
+
+// Offset is the amount of items before the current page
+func (p *Pagination) Offset() int {
+	return (p.Page - 1) * p.Size
+}
+
+// Limit is the max amount of items on the current page
+func (p *Pagination) Limit() int {
+	return p.Size
+}
+
+// Pages returns the amount of pages, at least 1 so a empty list still has a page to show it on. It's 0 while the total is
+// unknown.
+func (p *Pagination) Pages() int {
+	if p.Total < 0 {
+		return 0
+	}
+
+	if p.Total == 0 {
+		return 1
+	}
+
+	return (p.Total + p.Size - 1) / p.Size
+}
+
+func (p *Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p *Pagination) HasNext() bool {
+	return p.Page < p.Pages()
+}
+
+// FirstItem and LastItem are the positions of the first and last item of the page in the list, starting at 1, for
+// "showing 26-50 of 120"
+func (p *Pagination) FirstItem() int {
+	if p.Total == 0 {
+		return 0
+	}
+
+	return p.Offset() + 1
+}
+
+func (p *Pagination) LastItem() int {
+	last := p.Offset() + p.Size
+	if p.Total >= 0 && last > p.Total {
+		last = p.Total
+	}
+
+	return last
+}
+
+// PageURL returns the url of the page, keeping the other query params of the current url
+func (p *Pagination) PageURL(page int) string {
+	query := p.url.Query()
+	query.Del("page")
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	}
+
+	query.Del("size")
+	if p.Size != p.defaultSize {
+		query.Set("size", strconv.Itoa(p.Size))
+	}
+
+	u := url.URL{Path: p.url.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+func (p *Pagination) PrevURL() string {
+	return p.PageURL(p.Page - 1)
+}
+
+func (p *Pagination) NextURL() string {
+	return p.PageURL(p.Page + 1)
+}
+
+// PageNumbers returns the pages to link to: the first and last page and the ones around the current page, with a 0
+// where pages are left out
+func (p *Pagination) PageNumbers() []int {
+	pages := p.Pages()
+
+	var result []int
+	for i := 1; i <= pages; i++ {
+		if i == 1 || i == pages || (i >= p.Page-paginationWindow && i <= p.Page+paginationWindow) {
+			result = append(result, i)
+		} else if result[len(result)-1] != 0 {
+			result = append(result, 0)
+		}
+	}
+
+	return result
+}
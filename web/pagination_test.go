@@ -0,0 +1,59 @@
+package web
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	cases := []struct {
+		query        string
+		total        int
+		page, offset int
+		size         int
+	}{
+		{"", 100, 1, 0, 20},
+		{"?page=3", 100, 3, 40, 20},
+		{"?page=3&size=50", 100, 2, 50, 50},
+		{"?page=-1&size=0", 100, 1, 0, 20},
+		{"?page=abc&size=1000", 1000, 1, 0, MaxPageSize},
+		{"?page=99999999999999", 30, 2, 20, 20},
+		{"?page=5", 0, 1, 0, 20},
+	}
+
+	for _, c := range cases {
+		p := ParsePagination(httptest.NewRequest("GET", "/manage/1/cplogs"+c.query, nil), 20)
+		p.SetTotal(c.total)
+
+		if p.Page != c.page || p.Offset() != c.offset || p.Limit() != c.size {
+			t.Errorf("%q: got page %d, offset %d and size %d, expected %d, %d and %d", c.query, p.Page, p.Offset(), p.Limit(), c.page, c.offset, c.size)
+		}
+	}
+}
+
+func TestPaginationLinks(t *testing.T) {
+	p := ParsePagination(httptest.NewRequest("GET", "/manage/1/logging/?page=6&size=10&channel=5", nil), 20)
+	p.SetTotal(195)
+
+	if p.Pages() != 20 || !p.HasPrev() || !p.HasNext() || p.FirstItem() != 51 || p.LastItem() != 60 {
+		t.Errorf("unexpected metadata: pages %d, items %d-%d", p.Pages(), p.FirstItem(), p.LastItem())
+	}
+
+	if got := p.PrevURL(); got != "/manage/1/logging/?channel=5&page=5&size=10" {
+		t.Errorf("unexpected prev url %q", got)
+	}
+
+	if got := p.PageURL(1); got != "/manage/1/logging/?channel=5&size=10" {
+		t.Errorf("unexpected first page url %q", got)
+	}
+
+	if got := fmt.Sprint(p.PageNumbers()); got != "[1 0 4 5 6 7 8 0 20]" {
+		t.Errorf("unexpected page numbers %s", got)
+	}
+
+	p.SetTotal(5)
+	if p.Page != 1 || p.HasNext() || p.LastItem() != 5 || fmt.Sprint(p.PageNumbers()) != "[1]" {
+		t.Errorf("expected a single page, got page %d of %d", p.Page, p.Pages())
+	}
+}
@@ -0,0 +1,42 @@
+package web
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// PartialBlockHeader is the header used to request only a block of the page instead of the whole page, e.g from htmx
+// with hx-headers='{"X-Partial-Block": "table"}'. The block "alerts" renders the alerts area, any other block "x"
+// renders the template "<page template>_x", so pages opt in by defining those.
+const PartialBlockHeader = "X-Partial-Block"
+
+var partialBlockRegex = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+
+// partialTemplateName returns the name of the template rendering the block of the page, or false if the page has no such block
+func partialTemplateName(page, block string) (string, bool) {
+	if !partialBlockRegex.MatchString(block) {
+		return "", false
+	}
+
+	name := page + "_" + block
+	if block == "alerts" {
+		name = "cp_alerts"
+	}
+
+	if Templates == nil || Templates.Lookup(name) == nil {
+		return "", false
+	}
+
+	return name, true
+}
+
+// requestedPartialTemplate returns the template to render instead of the page if the request asked for a single block,
+// or a empty string if it didn't
+func requestedPartialTemplate(r *http.Request, page string) (name string, ok bool) {
+	block := r.Header.Get(PartialBlockHeader)
+	if block == "" {
+		return "", true
+	}
+
+	return partialTemplateName(page, block)
+}
@@ -0,0 +1,32 @@
+package web
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestPartialTemplateName(t *testing.T) {
+	old := Templates
+	defer func() { Templates = old }()
+
+	Templates = template.Must(template.New("").Parse(`{{define "cp_page"}}{{end}}{{define "cp_page_table"}}{{end}}{{define "cp_alerts"}}{{end}}`))
+
+	cases := []struct {
+		block    string
+		expected string
+		ok       bool
+	}{
+		{"table", "cp_page_table", true},
+		{"alerts", "cp_alerts", true},
+		{"missing", "", false},
+		{"../table", "", false},
+		{"TABLE", "", false},
+	}
+
+	for _, c := range cases {
+		name, ok := partialTemplateName("cp_page", c.block)
+		if name != c.expected || ok != c.ok {
+			t.Errorf("%q: got %q, %v, expected %q, %v", c.block, name, ok, c.expected, c.ok)
+		}
+	}
+}
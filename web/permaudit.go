@@ -0,0 +1,404 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+const (
+	// discord rate limits overwrite edits per channel, so a few channels are fixed at once and the rest on the next run
+	maxPermissionFixesPerRun = 50
+	permissionFixConcurrency = 5
+)
+
+// The kinds of problems found by the built in checks
+const (
+	PermissionAuditEveryoneMention = "everyone_mention"
+	PermissionAuditBotAccess       = "bot_access"
+)
+
+const (
+	PermissionAuditWarning = "warning"
+	PermissionAuditDanger  = "danger"
+)
+
+var panelLogKeyPermissionsFixed = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+	Key:          "permissions_fixed",
+	FormatString: "Fixed %d channel permission overwrites from the audit",
+})
+
+// PermissionFix is a change to the permission overwrite of a channel that fixes a problem, the bits are added to
+// the allowed and denied permissions of the existing overwrite
+type PermissionFix struct {
+	ChannelID  int64                             `json:"channel_id,string"`
+	TargetID   int64                             `json:"target_id,string"`
+	TargetType discordgo.PermissionOverwriteType `json:"target_type"`
+	Allow      int64                             `json:"allow,string"`
+	Deny       int64                             `json:"deny,string"`
+}
+
+// Apply returns the allowed and denied permissions of the overwrite after the fix
+func (f *PermissionFix) Apply(allow, deny int64) (int64, int64) {
+	return (allow &^ f.Deny) | f.Allow, (deny &^ f.Allow) | f.Deny
+}
+
+// PermissionAuditIssue is a problem with the permissions of a channel
+type PermissionAuditIssue struct {
+	// Key identifies the problem across audits, e.g for selecting the ones to fix
+	Key      string `json:"key"`
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+
+	ChannelID   int64  `json:"channel_id,string"`
+	ChannelName string `json:"channel_name"`
+	Problem     string `json:"problem"`
+
+	// Fix is nil if it has to be fixed in discord, e.g if the bot isn't allowed to edit the channel
+	Fix *PermissionFix `json:"fix,omitempty"`
+}
+
+// NewPermissionAuditIssue creates a issue for the channel, targetID is the role or member the problem is about
+func NewPermissionAuditIssue(kind, severity string, cs *dstate.ChannelState, targetID int64, problem string) *PermissionAuditIssue {
+	return &PermissionAuditIssue{
+		Key:         fmt.Sprintf("%s:%d:%d", kind, cs.ID, targetID),
+		Kind:        kind,
+		Severity:    severity,
+		ChannelID:   cs.ID,
+		ChannelName: cs.Name,
+		Problem:     problem,
+	}
+}
+
+// PermissionAudit is the server being audited
+type PermissionAudit struct {
+	GS        *dstate.GuildSet
+	BotMember *discordgo.Member
+}
+
+// BotPermissions returns the permissions of the bot in the channel
+func (a *PermissionAudit) BotPermissions(cs *dstate.ChannelState) int64 {
+	return dstate.CalculatePermissions(&a.GS.GuildState, a.GS.Roles, cs.PermissionOverwrites, a.BotMember.User.ID, a.BotMember.Roles)
+}
+
+// CanFix returns true if the bot can edit the permission overwrites of the channel
+func (a *PermissionAudit) CanFix(cs *dstate.ChannelState) bool {
+	const needed = discordgo.PermissionViewChannel | discordgo.PermissionManageRoles
+	return a.BotPermissions(cs)&needed == needed
+}
+
+// Overwrite returns the overwrite of the role or member in the channel, nil if there is none
+func (a *PermissionAudit) Overwrite(cs *dstate.ChannelState, targetID int64) *discordgo.PermissionOverwrite {
+	for i := range cs.PermissionOverwrites {
+		if cs.PermissionOverwrites[i].ID == targetID {
+			return &cs.PermissionOverwrites[i]
+		}
+	}
+
+	return nil
+}
+
+// botRequiredPermissions returns the permissions the bot needs in a channel of the type to work, categories have none
+func botRequiredPermissions(t discordgo.ChannelType) int64 {
+	switch t {
+	case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews, discordgo.ChannelTypeGuildForum:
+		return discordgo.PermissionViewChannel | discordgo.PermissionSendMessages | discordgo.PermissionEmbedLinks
+	case discordgo.ChannelTypeGuildVoice, discordgo.ChannelTypeGuildStageVoice:
+		return discordgo.PermissionViewChannel | discordgo.PermissionVoiceConnect
+	}
+
+	return 0
+}
+
+// auditEveryoneMention flags the channels where everyone can ping @everyone and @here
+func auditEveryoneMention(audit *PermissionAudit) []*PermissionAuditIssue {
+	var issues []*PermissionAuditIssue
+	for i := range audit.GS.Channels {
+		cs := &audit.GS.Channels[i]
+		if cs.Type == discordgo.ChannelTypeGuildCategory {
+			continue
+		}
+
+		// the @everyone role, without any other roles
+		perms := dstate.CalculatePermissions(&audit.GS.GuildState, audit.GS.Roles, cs.PermissionOverwrites, 0, nil)
+		if perms&discordgo.PermissionViewChannel == 0 || perms&discordgo.PermissionMentionEveryone == 0 {
+			continue
+		}
+
+		issue := NewPermissionAuditIssue(PermissionAuditEveryoneMention, PermissionAuditDanger, cs, audit.GS.ID,
+			"Everyone can mention @everyone and @here")
+		issue.Fix = &PermissionFix{
+			ChannelID:  cs.ID,
+			TargetID:   audit.GS.ID,
+			TargetType: discordgo.PermissionOverwriteTypeRole,
+			Deny:       discordgo.PermissionMentionEveryone,
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues
+}
+
+// auditBotAccess flags the channels the bot can't see or send messages in, the bot can't fix these itself
+func auditBotAccess(audit *PermissionAudit) []*PermissionAuditIssue {
+	var issues []*PermissionAuditIssue
+	for i := range audit.GS.Channels {
+		cs := &audit.GS.Channels[i]
+		required := botRequiredPermissions(cs.Type)
+		if required == 0 {
+			continue
+		}
+
+		missing := required &^ audit.BotPermissions(cs)
+		if missing == 0 {
+			continue
+		}
+
+		issues = append(issues, NewPermissionAuditIssue(PermissionAuditBotAccess, PermissionAuditWarning, cs, audit.BotMember.User.ID,
+			"The bot is missing "+strings.Join(common.HumanizePermissions(missing), ", ")+", give it access in discord"))
+	}
+
+	return issues
+}
+
+// RunPermissionAudit checks the permissions of every channel, including the checks of the plugins. Fixes the bot
+// can't make are left out, plugins failing are logged and skipped.
+func RunPermissionAudit(ctx context.Context, audit *PermissionAudit) []*PermissionAuditIssue {
+	issues := auditEveryoneMention(audit)
+	issues = append(issues, auditBotAccess(audit)...)
+
+	for _, v := range common.Plugins {
+		p, ok := v.(PluginWithPermissionAudit)
+		if !ok {
+			continue
+		}
+
+		pluginIssues, err := p.AuditPermissions(ctx, audit)
+		if err != nil {
+			CtxLogger(ctx).WithError(err).WithField("plugin", v.PluginInfo().SysName).Error("failed auditing permissions")
+			continue
+		}
+
+		issues = append(issues, pluginIssues...)
+	}
+
+	for _, v := range issues {
+		if v.Fix == nil {
+			continue
+		}
+
+		if cs := audit.GS.GetChannel(v.Fix.ChannelID); cs == nil || !audit.CanFix(cs) {
+			v.Fix = nil
+		}
+	}
+
+	return issues
+}
+
+// mergePermissionFixes combines the fixes of the same overwrite, so each overwrite is edited once
+func mergePermissionFixes(issues []*PermissionAuditIssue) []*PermissionFix {
+	type overwriteKey struct {
+		channel, target int64
+	}
+
+	var result []*PermissionFix
+	merged := make(map[overwriteKey]*PermissionFix)
+	for _, v := range issues {
+		if v.Fix == nil {
+			continue
+		}
+
+		key := overwriteKey{v.Fix.ChannelID, v.Fix.TargetID}
+		if existing, ok := merged[key]; ok {
+			existing.Allow, existing.Deny = existing.Apply(v.Fix.Allow, v.Fix.Deny)
+			continue
+		}
+
+		fix := *v.Fix
+		merged[key] = &fix
+		result = append(result, &fix)
+	}
+
+	return result
+}
+
+// PermissionFixError is a fix discord rejected
+type PermissionFixError struct {
+	ChannelName string
+	Err         error
+}
+
+func (p *PermissionFixError) Error() string {
+	if _, msg := common.DiscordError(p.Err); msg != "" {
+		return "#" + p.ChannelName + ": " + msg
+	}
+
+	return "#" + p.ChannelName + ": " + p.Err.Error()
+}
+
+// ApplyPermissionFixes edits the overwrites, a few at a time. The overwrites of the guild set are updated as they're
+// edited so a audit run afterwards reflects the fixes. Returns how many were edited and the errors of the ones that failed.
+func ApplyPermissionFixes(audit *PermissionAudit, fixes []*PermissionFix) (int, []error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		applied int
+		errs    []error
+	)
+
+	sem := make(chan struct{}, permissionFixConcurrency)
+	for _, fix := range fixes {
+		cs := audit.GS.GetChannel(fix.ChannelID)
+		if cs == nil {
+			continue
+		}
+
+		var allow, deny int64
+		if existing := audit.Overwrite(cs, fix.TargetID); existing != nil {
+			allow, deny = existing.Allow, existing.Deny
+		}
+		allow, deny = fix.Apply(allow, deny)
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(fix *PermissionFix, cs *dstate.ChannelState, allow, deny int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := common.BotSession.ChannelPermissionSet(fix.ChannelID, fix.TargetID, fix.TargetType, allow, deny)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, &PermissionFixError{ChannelName: cs.Name, Err: err})
+				return
+			}
+
+			if existing := audit.Overwrite(cs, fix.TargetID); existing != nil {
+				existing.Allow, existing.Deny = allow, deny
+			} else {
+				cs.PermissionOverwrites = append(cs.PermissionOverwrites, discordgo.PermissionOverwrite{
+					ID: fix.TargetID, Type: fix.TargetType, Allow: allow, Deny: deny,
+				})
+			}
+			applied++
+		}(fix, cs, allow, deny)
+	}
+	wg.Wait()
+
+	return applied, errs
+}
+
+// FixPermissionIssues fixes the issues with the keys, returns how many overwrites were edited
+func FixPermissionIssues(ctx context.Context, audit *PermissionAudit, keys []string) (int, []error) {
+	selected := make(map[string]bool, len(keys))
+	for _, v := range keys {
+		selected[v] = true
+	}
+
+	var toFix []*PermissionAuditIssue
+	for _, v := range RunPermissionAudit(ctx, audit) {
+		if selected[v.Key] {
+			toFix = append(toFix, v)
+		}
+	}
+
+	fixes := mergePermissionFixes(toFix)
+	if len(fixes) > maxPermissionFixesPerRun {
+		fixes = fixes[:maxPermissionFixesPerRun]
+	}
+
+	applied, errs := ApplyPermissionFixes(audit, fixes)
+	if applied > 0 {
+		go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyPermissionsFixed, &cplogs.Param{Type: cplogs.ParamTypeInt, Value: int64(applied)}))
+	}
+
+	return applied, errs
+}
+
+func permissionAuditFromContext(ctx context.Context) *PermissionAudit {
+	return &PermissionAudit{
+		GS:        ContextGuild(ctx),
+		BotMember: ctx.Value(common.ContextKeyBotMember).(*discordgo.Member),
+	}
+}
+
+// PermissionAuditFixForm holds the keys of the issues to fix
+type PermissionAuditFixForm struct {
+	Fix []string
+}
+
+// HandleGetPermissionAudit handles GET /manage/:server/permission_audit
+func HandleGetPermissionAudit(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	_, tmpl := GetBaseCPContextData(ctx)
+
+	tmpl["PermissionIssues"] = RunPermissionAudit(ctx, permissionAuditFromContext(ctx))
+	tmpl["MaxPermissionFixesPerRun"] = maxPermissionFixesPerRun
+	return tmpl, nil
+}
+
+// HandleGetPermissionAuditJSON handles GET /manage/:server/permission_audit.json
+func HandleGetPermissionAuditJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	issues := RunPermissionAudit(ctx, permissionAuditFromContext(ctx))
+	if issues == nil {
+		issues = []*PermissionAuditIssue{}
+	}
+
+	return issues
+}
+
+// HandlePostPermissionAuditFix handles POST /manage/:server/permission_audit/fix
+func HandlePostPermissionAuditFix(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/permission_audit")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*PermissionAuditFixForm)
+	if len(form.Fix) < 1 {
+		return tmpl, NewPublicError("Select the problems to fix")
+	}
+
+	applied, errs := FixPermissionIssues(ctx, permissionAuditFromContext(ctx), form.Fix)
+	for _, err := range errs {
+		if code, _ := common.DiscordError(err.(*PermissionFixError).Err); code == 0 {
+			CtxLogger(ctx).WithError(err).Error("failed fixing permission overwrite")
+		}
+
+		tmpl.AddAlerts(ErrorAlert("Failed fixing ", err.Error()))
+	}
+
+	if applied > 0 {
+		tmpl.AddAlerts(SucessAlert(fmt.Sprintf("Fixed %d permission overwrites", applied)))
+	}
+
+	return tmpl, nil
+}
+
+// HandlePostPermissionAuditFixJSON handles POST /manage/:server/permission_audit/fix.json
+func HandlePostPermissionAuditFixJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	if GetIsReadOnly(ctx) {
+		return NewPublicError(readOnlyRejectedMsg)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return NewPublicError("Invalid form")
+	}
+
+	applied, errs := FixPermissionIssues(ctx, permissionAuditFromContext(ctx), r.Form["fix"])
+	failed := make([]string, 0, len(errs))
+	for _, err := range errs {
+		failed = append(failed, err.Error())
+	}
+
+	return map[string]interface{}{"fixed": applied, "errors": failed}
+}
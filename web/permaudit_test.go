@@ -0,0 +1,42 @@
+package web
+
+import (
+	"testing"
+)
+
+func TestPermissionFixApply(t *testing.T) {
+	fix := &PermissionFix{Allow: 0b0001, Deny: 0b0010}
+
+	// the fix wins over the existing overwrite, the rest is kept
+	allow, deny := fix.Apply(0b0110, 0b1001)
+	if allow != 0b0101 || deny != 0b1010 {
+		t.Errorf("Apply() = %04b, %04b, want 0101, 1010", allow, deny)
+	}
+}
+
+func TestMergePermissionFixes(t *testing.T) {
+	issues := []*PermissionAuditIssue{
+		{Key: "a", Fix: &PermissionFix{ChannelID: 1, TargetID: 10, Deny: 0b01}},
+		{Key: "b"},
+		{Key: "c", Fix: &PermissionFix{ChannelID: 1, TargetID: 10, Deny: 0b10}},
+		{Key: "d", Fix: &PermissionFix{ChannelID: 2, TargetID: 10, Allow: 0b01}},
+	}
+
+	merged := mergePermissionFixes(issues)
+	if len(merged) != 2 {
+		t.Fatalf("got %d fixes, want 2", len(merged))
+	}
+
+	if merged[0].ChannelID != 1 || merged[0].Deny != 0b11 || merged[0].Allow != 0 {
+		t.Errorf("first fix = %+v, want channel 1 denying 11", merged[0])
+	}
+
+	if merged[1].ChannelID != 2 || merged[1].Allow != 0b01 {
+		t.Errorf("second fix = %+v, want channel 2 allowing 01", merged[1])
+	}
+
+	// the fixes of the issues are left untouched
+	if issues[0].Fix.Deny != 0b01 {
+		t.Errorf("merging changed the fix of the issue")
+	}
+}
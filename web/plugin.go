@@ -1,10 +1,15 @@
 package web
 
 import (
+	"context"
+	"database/sql"
 	"html/template"
 	"net/http"
+	"time"
 
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
 )
 
 // Plugin represents a web plugin
@@ -36,3 +41,163 @@ type PluginWithServerHomeWidgetMiddlewares interface {
 type ServerHomeWidgetWithOrder interface {
 	ServerHomeWidgetOrder() int
 }
+
+// PluginWithConfigCode is implemented by plugins whose settings can be exported and applied declaratively,
+// see the configcode package for the format
+type PluginWithConfigCode interface {
+	// ConfigCodeName returns the name of the plugin block the settings are exported under
+	ConfigCodeName() string
+
+	// ExportConfigCode returns the current settings as a pointer to a form struct,
+	// applied changes are decoded into it and validated with ValidateForm
+	ExportConfigCode(ctx context.Context, guildID int64) (interface{}, error)
+
+	// ApplyConfigCode saves the form returned by ExportConfigCode inside tx
+	ApplyConfigCode(ctx context.Context, tx *sql.Tx, guildID int64, form interface{}) error
+
+	// ConfigCodeApplied is called once the transaction has been committed, evict caches here
+	ConfigCodeApplied(guildID int64)
+}
+
+// ScheduledAction is something a plugin will do at a later time, shown on the scheduled actions page
+type ScheduledAction struct {
+	At          time.Time `json:"at"`
+	Plugin      string    `json:"plugin"`
+	Description string    `json:"description"`
+
+	// Recurring is true if this is one of multiple runs of a repeating action
+	Recurring bool `json:"recurring"`
+
+	// Link is the page in the guild's control panel the action can be changed on, e.g "/customcommands"
+	Link string `json:"link,omitempty"`
+}
+
+// PluginWithScheduledActions is implemented by plugins that perform actions at a later time,
+// recurring actions should be expanded into every run within the range
+type PluginWithScheduledActions interface {
+	ScheduledActions(ctx context.Context, guildID int64, from, to time.Time) ([]*ScheduledAction, error)
+}
+
+// StorageCategory is a kind of data a plugin stores for a guild, shown in the storage usage report
+type StorageCategory struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	Items int64 `json:"items"`
+	Bytes int64 `json:"bytes"`
+
+	// Retention describes how long the data is kept around for, e.g "Until deleted" or "30 days"
+	Retention string `json:"retention,omitempty"`
+
+	// Purgeable is true if admins can delete all the data of this category through the cleanup wizard
+	Purgeable bool `json:"purgeable"`
+}
+
+// PluginWithStorageUsage is implemented by plugins storing data for guilds besides their settings,
+// the size of the settings is computed through PluginWithConfigCode
+type PluginWithStorageUsage interface {
+	common.Plugin
+
+	// StorageUsage returns the categories of data stored for the guild, sizes may be estimates
+	StorageUsage(ctx context.Context, guildID int64) ([]*StorageCategory, error)
+
+	// PurgeStorage deletes all the data of a purgeable category, returning the amount of items deleted
+	PurgeStorage(ctx context.Context, guildID int64, category string) (int64, error)
+}
+
+// DigestSection is a part of the weekly activity digest sent to the admins of a guild
+type DigestSection struct {
+	Title string `json:"title"`
+
+	// Lines are the summarized events, e.g "Spam: triggered 12 times"
+	Lines []string `json:"lines"`
+
+	// Warning is true if something needs the attention of the admins, e.g a feed that stopped posting
+	Warning bool `json:"warning"`
+
+	// Link is the page in the guild's control panel with the details, e.g "/automod"
+	Link string `json:"link,omitempty"`
+}
+
+// PluginWithDigest is implemented by plugins contributing to the weekly activity digest,
+// sections without lines are left out
+type PluginWithDigest interface {
+	Digest(ctx context.Context, guildID int64, from, to time.Time) ([]*DigestSection, error)
+}
+
+// The kinds of events that can be simulated
+const (
+	SimulatedEventMessage = "message"
+	SimulatedEventJoin    = "join"
+)
+
+// SimulatedEvent is a hypothetical event submitted by a admin, nothing about it happened on discord
+type SimulatedEvent struct {
+	Type string
+
+	GS     *dstate.GuildSet
+	Member *dstate.MemberState
+
+	// only set for messages
+	Channel *dstate.ChannelState
+	Message *discordgo.Message
+}
+
+// SimulatedAction is something a plugin would do in response to a simulated event, e.g "Automoderator: delete the message"
+type SimulatedAction struct {
+	Plugin      string `json:"plugin"`
+	Description string `json:"description"`
+
+	// Skipped is set for the things the plugin can't tell without the event actually happening,
+	// e.g rules depending on the messages sent before it
+	Skipped bool `json:"skipped,omitempty"`
+
+	Link string `json:"link,omitempty"`
+}
+
+// PluginWithEventSimulation is implemented by plugins that can tell what they would do in response to a event,
+// without doing any of it
+type PluginWithEventSimulation interface {
+	SimulateEvent(ctx context.Context, evt *SimulatedEvent) ([]*SimulatedAction, error)
+}
+
+// The RoleConnectionMetadata types, servers set the value to compare against when setting up a linked role
+const (
+	RoleConnectionIntegerGreaterOrEqual  = 2
+	RoleConnectionDatetimeGreaterOrEqual = 6
+	RoleConnectionBooleanEqual           = 7
+)
+
+// RoleConnectionMetadata is a field of discord's linked roles, e.g "verified"
+type RoleConnectionMetadata struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        int    `json:"type"`
+}
+
+// PluginWithRoleConnectionMetadata is implemented by plugins providing linked roles metadata, the values
+// are the same in every server as discord only stores a single set per user
+type PluginWithRoleConnectionMetadata interface {
+	RoleConnectionMetadata() []*RoleConnectionMetadata
+
+	// RoleConnectionValues returns the values of the user by metadata key, either int64, time.Time or bool,
+	// keys left out are not set
+	RoleConnectionValues(ctx context.Context, userID int64) (map[string]interface{}, error)
+}
+
+// PluginWithPermissionAudit is implemented by plugins that depend on the channel permissions being set up a certain way,
+// e.g the mute role being denied sending messages
+type PluginWithPermissionAudit interface {
+	AuditPermissions(ctx context.Context, audit *PermissionAudit) ([]*PermissionAuditIssue, error)
+}
+
+// PluginWithToggle is implemented by plugins that can be turned on and off as a whole, used to compare guilds
+// and to enable a plugin in several guilds at once
+type PluginWithToggle interface {
+	common.Plugin
+
+	PluginEnabled(ctx context.Context, guildID int64) (bool, error)
+	SetPluginEnabled(ctx context.Context, guildID int64, enabled bool) error
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// recoveryResponseWriter keeps track of whether the response has been started, after which no error page can be sent
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoveryResponseWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoveryResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recoveryResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+func (w *recoveryResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.wroteHeader = true
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// wantsJSONError returns true if the request is to a api route, which get a json error instead of the error page
+func wantsJSONError(r *http.Request) bool {
+	if RequestClassOf(r) == RequestClassAPI {
+		return true
+	}
+
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// RecoveryMiddleware recovers panics in the handlers below it, logging the stack and responding with the
+// error page, or a json error for api routes. If the response was already started the connection is aborted instead.
+func RecoveryMiddleware(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			if v == http.ErrAbortHandler {
+				// deliberate abort, net/http handles these silently
+				panic(v)
+			}
+
+			reportRequestPanic(r, v).WithField("stack", string(debug.Stack())).WithField("method", r.Method).WithField("path", r.URL.Path).
+				Errorf("Recovered from panic in web handler: %v", v)
+
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			writeInternalErrorResponse(rw, r)
+		}()
+
+		inner.ServeHTTP(rw, r)
+	}
+
+	return http.HandlerFunc(mw)
+}
+
+func writeInternalErrorResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+
+	RenderErrorPage(w, r, http.StatusInternalServerError, nil)
+}
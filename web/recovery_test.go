@@ -0,0 +1,64 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh no")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/manage/1/storage.json", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a json error, got content type %q", ct)
+	}
+
+	if !strings.Contains(w.Body.String(), `"ok":false`) {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestRecoveryMiddlewareStartedResponse(t *testing.T) {
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("oh no")
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("expected the connection to be aborted, got %v", v)
+		}
+	}()
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/manage", nil))
+}
+
+func TestWantsJSONError(t *testing.T) {
+	cases := []struct {
+		path, accept string
+		expected     bool
+	}{
+		{"/manage/1/storage.json", "", true},
+		{"/api/1/stats", "", true},
+		{"/manage/1/storage", "text/html,application/xhtml+xml", false},
+		{"/manage/1/storage", "application/json", true},
+		{"/manage", "", false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.path, nil)
+		r.Header.Set("Accept", c.accept)
+		if got := wantsJSONError(r); got != c.expected {
+			t.Errorf("%s (accept %q): got %v, expected %v", c.path, c.accept, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+// RequestClass is the kind of route a request is for, middlewares branch on it instead of looking at the path
+type RequestClass string
+
+const (
+	// RequestClassStatic are the static files and robots.txt
+	RequestClassStatic RequestClass = "static"
+	// RequestClassProbe are the health checks of the load balancers
+	RequestClassProbe RequestClass = "probe"
+	// RequestClassAPI are the json endpoints, which get json errors
+	RequestClassAPI RequestClass = "api"
+	// RequestClassCP are the control panel pages under /manage/
+	RequestClassCP RequestClass = "cp"
+	// RequestClassPublic is everything else
+	RequestClassPublic RequestClass = "public"
+)
+
+type requestClassifier struct {
+	class RequestClass
+	match func(r *http.Request) bool
+}
+
+// plugin classes, checked before the built in ones
+var requestClassifiers []*requestClassifier
+
+// RegisterRequestClass adds a class of requests, e.g webhooks of a plugin that should skip the session and csrf
+// middlewares. Classes are checked in the order they were registered, before the built in ones.
+func RegisterRequestClass(class RequestClass, match func(r *http.Request) bool) {
+	requestClassifiers = append(requestClassifiers, &requestClassifier{class: class, match: match})
+}
+
+// classifyRequest returns the class of the request based on its path
+func classifyRequest(r *http.Request) RequestClass {
+	for _, v := range requestClassifiers {
+		if v.match(r) {
+			return v.class
+		}
+	}
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/static/") || path == "/robots.txt":
+		return RequestClassStatic
+	case isProbePath(path):
+		return RequestClassProbe
+	case strings.HasSuffix(path, ".json") || strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/public-api/"):
+		return RequestClassAPI
+	case strings.HasPrefix(path, "/manage/"):
+		return RequestClassCP
+	}
+
+	return RequestClassPublic
+}
+
+// ClassifyRequestMiddleware tags the request with its class, see RequestClassOf
+func ClassifyRequestMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), common.ContextKeyRequestClass, classifyRequest(r))
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestClassOf returns the class of the request, classifying it here if it didn't pass through
+// ClassifyRequestMiddleware (e.g in the handlers wrapping the root mux)
+func RequestClassOf(r *http.Request) RequestClass {
+	if class, ok := r.Context().Value(common.ContextKeyRequestClass).(RequestClass); ok {
+		return class
+	}
+
+	return classifyRequest(r)
+}
+
+// isStatic returns true for the requests that skip most of the root middlewares: the static files, and the probes which
+// report the redis and shutdown state themselves instead of being rejected
+func isStatic(r *http.Request) bool {
+	class := RequestClassOf(r)
+	return class == RequestClassStatic || class == RequestClassProbe
+}
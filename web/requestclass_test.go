@@ -0,0 +1,64 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClassifyRequest(t *testing.T) {
+	cases := map[string]RequestClass{
+		"/static/css/app.css":              RequestClassStatic,
+		"/robots.txt":                      RequestClassStatic,
+		"/healthz":                         RequestClassProbe,
+		"/live":                            RequestClassProbe,
+		"/api/1/channelperms/2":            RequestClassAPI,
+		"/public-api/v1/guilds/1":          RequestClassAPI,
+		"/manage/1/storage.json":           RequestClassAPI,
+		"/status.json":                     RequestClassAPI,
+		"/manage/1/core":                   RequestClassCP,
+		"/manage":                          RequestClassPublic,
+		"/":                                RequestClassPublic,
+		"/staticfiles":                     RequestClassPublic,
+		"/public/1/stats":                  RequestClassPublic,
+		"/manage/1/customcommands/webhook": RequestClassCP,
+	}
+
+	for path, expected := range cases {
+		if got := classifyRequest(httptest.NewRequest("GET", path, nil)); got != expected {
+			t.Errorf("%s: got %s, expected %s", path, got, expected)
+		}
+	}
+}
+
+func TestRegisterRequestClass(t *testing.T) {
+	defer func(old []*requestClassifier) { requestClassifiers = old }(requestClassifiers)
+
+	const webhook RequestClass = "webhook"
+	RegisterRequestClass(webhook, func(r *http.Request) bool {
+		return strings.HasSuffix(r.URL.Path, "/webhook")
+	})
+
+	if got := classifyRequest(httptest.NewRequest("POST", "/manage/1/customcommands/webhook", nil)); got != webhook {
+		t.Errorf("got %s, expected the registered class", got)
+	}
+
+	if got := classifyRequest(httptest.NewRequest("GET", "/manage/1/core", nil)); got != RequestClassCP {
+		t.Errorf("got %s, expected the built in classes to still apply", got)
+	}
+}
+
+func TestClassifyRequestMiddleware(t *testing.T) {
+	var class RequestClass
+	handler := ClassifyRequestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// changing the path below the middleware doesn't change the class
+		r.URL.Path = "/static/app.js"
+		class = RequestClassOf(r)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/manage/1/core", nil))
+	if class != RequestClassCP {
+		t.Errorf("got %s, expected the class set by the middleware", class)
+	}
+}
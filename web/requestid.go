@@ -0,0 +1,58 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/internalapi"
+)
+
+const maxRequestIDLength = 128
+
+// validRequestID returns true if the id passed on by the proxy is safe to put into logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func generateRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestIDMiddleware assigns every request an id, or uses the X-Request-ID set by the proxy in front of us.
+// It's sent back in the response, included in the logs and forwarded to botrest so a single user action can be traced across processes.
+func RequestIDMiddleware(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(internalapi.RequestIDHeader)
+		if !validRequestID(id) {
+			id = generateRequestID()
+		}
+
+		w.Header().Set(internalapi.RequestIDHeader, id)
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), common.ContextKeyRequestID, id)))
+	}
+
+	return http.HandlerFunc(mw)
+}
+
+// RequestID returns the id of the request, empty if it didn't pass through RequestIDMiddleware
+func RequestID(r *http.Request) string {
+	return internalapi.RequestIDFromContext(r.Context())
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	cases := map[string]bool{
+		"":                                     false,
+		"abc-123":                              true,
+		"f47ac10b-58cc-4372-a567-0e02b2c3d479": true,
+		"Root=1-5759e988-bd862e3fe1be46a994272793": true,
+		"has space":                             false,
+		"new\nline":                             false,
+		"\"quoted\"":                            false,
+		strings.Repeat("a", maxRequestIDLength): true,
+		strings.Repeat("a", maxRequestIDLength+1): false,
+	}
+
+	for id, expected := range cases {
+		if got := validRequestID(id); got != expected {
+			t.Errorf("validRequestID(%q) = %v, expected %v", id, got, expected)
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r)
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-ID", "from-proxy")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if seen != "from-proxy" || w.Header().Get("X-Request-ID") != "from-proxy" {
+		t.Errorf("expected the proxy's request id to be used, got %q", seen)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-ID", "bad id")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if len(seen) != 32 || w.Header().Get("X-Request-ID") != seen {
+		t.Errorf("expected a generated request id, got %q", seen)
+	}
+}
@@ -0,0 +1,14 @@
+package web
+
+import "goji.io"
+
+// SetupRoutes sets up the routes of the registered plugins like Run does, without connecting to anything. It's for the
+// tests in package web_test, which can import the plugins.
+func SetupRoutes() *goji.Mux {
+	// every route the webserver can have, without the access log writer
+	confGraphQL.LoadedValue = true
+	confDisableRequestLogging.LoadedValue = true
+
+	loadTemplates()
+	return setupRoutes()
+}
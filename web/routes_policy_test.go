@@ -0,0 +1,418 @@
+package web_test
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/botlabs-gg/yagpdb/v2/admin"
+	"github.com/botlabs-gg/yagpdb/v2/automod"
+	"github.com/botlabs-gg/yagpdb/v2/automod_legacy"
+	"github.com/botlabs-gg/yagpdb/v2/autorole"
+	"github.com/botlabs-gg/yagpdb/v2/bot/paginatedmessages"
+	"github.com/botlabs-gg/yagpdb/v2/commands"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/customcommands"
+	"github.com/botlabs-gg/yagpdb/v2/linkedaccounts"
+	"github.com/botlabs-gg/yagpdb/v2/logs"
+	"github.com/botlabs-gg/yagpdb/v2/mobileapp"
+	"github.com/botlabs-gg/yagpdb/v2/moderation"
+	"github.com/botlabs-gg/yagpdb/v2/notifications"
+	"github.com/botlabs-gg/yagpdb/v2/premium"
+	"github.com/botlabs-gg/yagpdb/v2/premium/patreonpremiumsource"
+	"github.com/botlabs-gg/yagpdb/v2/publicapi"
+	"github.com/botlabs-gg/yagpdb/v2/reddit"
+	"github.com/botlabs-gg/yagpdb/v2/reputation"
+	"github.com/botlabs-gg/yagpdb/v2/rolecommands"
+	"github.com/botlabs-gg/yagpdb/v2/serverstats"
+	"github.com/botlabs-gg/yagpdb/v2/soundboard"
+	"github.com/botlabs-gg/yagpdb/v2/streaming"
+	"github.com/botlabs-gg/yagpdb/v2/tickets"
+	"github.com/botlabs-gg/yagpdb/v2/twitter"
+	"github.com/botlabs-gg/yagpdb/v2/verification"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	"github.com/botlabs-gg/yagpdb/v2/youtube"
+	"goji.io"
+	"goji.io/pat"
+)
+
+// The route policy test sets up the routes of the core and all the plugins like the webserver does, and walks the
+// muxes to find the middlewares every route ends up behind. These are checked against testdata/route_policy.txt, so
+// that adding a route without deciding who should be able to access it fails the tests.
+//
+// Run with -update-route-policy to regenerate the policy file after adding routes, and review the diff.
+
+var updateRoutePolicy = flag.Bool("update-route-policy", false, "regenerate testdata/route_policy.txt from the registered routes")
+
+const routePolicyFile = "testdata/route_policy.txt"
+
+// middlewares that restrict access, by the name they're registered under, and the name they have in the policy file
+var routeRequirements = map[string]string{
+	"require_session":      "session",
+	"require_api_user":     "session",
+	"mobileapp_user":       "session",
+	"require_server_admin": "admin",
+	"require_api_admin":    "admin",
+	"require_bot_owner":    "owner",
+	"developer_key":        "developer_key",
+}
+
+type routePolicy struct {
+	policy     string
+	pluginPerm string
+	csrf       string
+
+	// explains the policy, e.g when the handler does the checks itself
+	comment string
+}
+
+func (p *routePolicy) String() string {
+	return p.policy + " " + p.pluginPerm + " " + p.csrf
+}
+
+// registerWebPlugins registers the plugins with web routes, in the order of cmd/yagpdb. Their RegisterPlugin functions
+// set up the databases, so they're registered directly.
+func registerWebPlugins() {
+	plugins := []common.Plugin{
+		&paginatedmessages.Plugin{},
+		&commands.Plugin{},
+		&serverstats.Plugin{},
+		&notifications.Plugin{},
+		&customcommands.Plugin{},
+		&reddit.Plugin{},
+		&moderation.Plugin{},
+		&reputation.Plugin{},
+		&streaming.Plugin{},
+		&automod_legacy.Plugin{},
+		&automod.Plugin{},
+		&logs.Plugin{},
+		&autorole.Plugin{},
+		&soundboard.Plugin{},
+		&youtube.Plugin{},
+		&rolecommands.Plugin{},
+		&tickets.Plugin{},
+		&verification.Plugin{},
+		&premium.Plugin{},
+		&patreonpremiumsource.Plugin{},
+		&twitter.Plugin{},
+		&linkedaccounts.Plugin{},
+		&admin.Plugin{},
+		&mobileapp.Plugin{},
+		&publicapi.Plugin{},
+
+		// registered by web.Run
+		&web.ControlPanelPlugin{},
+	}
+
+	for _, p := range plugins {
+		common.RegisterPlugin(p)
+	}
+}
+
+// exported returns the unexported field v in a way it can be read
+func exported(v reflect.Value) reflect.Value {
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
+
+// muxMiddlewares returns the middlewares added to the mux with Use
+func muxMiddlewares(mux *goji.Mux) []func(http.Handler) http.Handler {
+	v := reflect.ValueOf(mux).Elem().FieldByName("middleware")
+	return exported(v).Interface().([]func(http.Handler) http.Handler)
+}
+
+type muxRoute struct {
+	pattern goji.Pattern
+	handler http.Handler
+}
+
+// muxRoutes returns the routes of the mux in the order they were added, which is the order they're matched in
+func muxRoutes(mux *goji.Mux) []muxRoute {
+	v := exported(reflect.ValueOf(mux).Elem().FieldByName("router").FieldByName("routes"))
+
+	routes := make([]muxRoute, v.Len())
+	for i := range routes {
+		route := v.Index(i)
+		routes[i] = muxRoute{
+			pattern: route.FieldByName("Pattern").Interface().(goji.Pattern),
+			handler: route.FieldByName("Handler").Interface().(http.Handler),
+		}
+	}
+
+	return routes
+}
+
+// namedMiddlewares follows h through the named middlewares it's wrapped in, returning them and the handler they wrap
+func namedMiddlewares(h http.Handler) ([]*web.MiddlewareHandler, http.Handler) {
+	var result []*web.MiddlewareHandler
+	for {
+		mw, ok := h.(*web.MiddlewareHandler)
+		if !ok {
+			return result, h
+		}
+
+		result = append(result, mw)
+		h = mw.Next
+	}
+}
+
+// probeRequest returns a request to the route, with its variables filled in
+func probeRequest(method, path string) *http.Request {
+	parts := strings.Split(path, "/")
+	for i, v := range parts {
+		if strings.HasPrefix(v, ":") {
+			parts[i] = "1"
+		} else if v == "*" {
+			parts[i] = "x"
+		}
+	}
+
+	if method == "ANY" {
+		method = "GET"
+	}
+
+	return httptest.NewRequest(method, strings.Join(parts, "/"), nil)
+}
+
+type routeWalker struct {
+	t        *testing.T
+	computed map[string]*routePolicy
+}
+
+// walk collects the policies of the routes of the mux mounted at prefix behind the chain. If methods isn't nil only
+// those are routed to the mux, and if exact is set it's mounted without a wildcard so only its empty path is reachable.
+func (rw *routeWalker) walk(mux *goji.Mux, prefix string, exact bool, methods map[string]struct{}, chain []*web.MiddlewareHandler) {
+	for _, mw := range muxMiddlewares(mux) {
+		named, _ := namedMiddlewares(mw(http.NotFoundHandler()))
+		chain = append(chain, named...)
+	}
+
+	for _, route := range muxRoutes(mux) {
+		p, ok := route.pattern.(*pat.Pattern)
+		if !ok {
+			rw.t.Fatalf("route under %q has a pattern of unsupported type %T", prefix, route.pattern)
+		}
+
+		if exact && p.String() != "" {
+			continue
+		}
+
+		routeMethods := p.HTTPMethods()
+		if methods != nil {
+			if routeMethods == nil {
+				routeMethods = methods
+			} else {
+				intersection := make(map[string]struct{})
+				for m := range routeMethods {
+					if _, ok := methods[m]; ok {
+						intersection[m] = struct{}{}
+					}
+				}
+				routeMethods = intersection
+			}
+		}
+
+		path := prefix + p.String()
+		named, inner := namedMiddlewares(route.handler)
+		routeChain := append(append([]*web.MiddlewareHandler{}, chain...), named...)
+
+		if sub, ok := inner.(*goji.Mux); ok {
+			if strings.HasSuffix(path, "/*") {
+				rw.walk(sub, strings.TrimSuffix(path, "/*"), false, routeMethods, routeChain)
+			} else {
+				rw.walk(sub, path, true, routeMethods, routeChain)
+			}
+			continue
+		}
+
+		var sortedMethods []string
+		for m := range routeMethods {
+			// pat.Get also matches HEAD, which goes through the same middlewares
+			if m != "HEAD" {
+				sortedMethods = append(sortedMethods, m)
+			}
+		}
+		sort.Strings(sortedMethods)
+		if routeMethods == nil {
+			sortedMethods = []string{"ANY"}
+		}
+
+		for _, m := range sortedMethods {
+			key := m + " " + path
+			if _, ok := rw.computed[key]; ok {
+				// the first route matching a request handles it
+				continue
+			}
+
+			rw.computed[key] = policyOf(routeChain, probeRequest(m, path))
+		}
+	}
+}
+
+// policyOf returns the policy of the route of r behind the chain, leaving out the middlewares skipped for it
+func policyOf(chain []*web.MiddlewareHandler, r *http.Request) *routePolicy {
+	reqs := make(map[string]bool)
+	var perms []string
+	csrf := "-"
+
+	for _, mw := range chain {
+		if mw.Skip != nil && mw.Skip(r) {
+			continue
+		}
+
+		if req, ok := routeRequirements[mw.Name]; ok {
+			reqs[req] = true
+		}
+
+		switch mw.Name {
+		case "require_perm":
+		OUTER:
+			for _, perm := range mw.Args {
+				for _, v := range perms {
+					if v == perm {
+						continue OUTER
+					}
+				}
+				perms = append(perms, perm)
+			}
+		case "csrf":
+			csrf = "csrf"
+		}
+	}
+
+	policy := &routePolicy{policy: "public", pluginPerm: "-", csrf: csrf}
+	if len(reqs) > 0 {
+		sorted := make([]string, 0, len(reqs))
+		for v := range reqs {
+			sorted = append(sorted, v)
+		}
+		sort.Strings(sorted)
+		policy.policy = strings.Join(sorted, ",")
+	}
+
+	if len(perms) > 0 {
+		policy.pluginPerm = strings.Join(perms, ",")
+	}
+
+	return policy
+}
+
+func loadRoutePolicies(t *testing.T) map[string]*routePolicy {
+	registerWebPlugins()
+	root := web.SetupRoutes()
+
+	rw := &routeWalker{t: t, computed: make(map[string]*routePolicy)}
+	rw.walk(root, "", false, nil, nil)
+	return rw.computed
+}
+
+func readRoutePolicyFile(t *testing.T) map[string]*routePolicy {
+	f, err := os.Open(filepath.FromSlash(routePolicyFile))
+	if err != nil {
+		t.Fatal("failed opening route policy file, run with -update-route-policy to generate it: ", err)
+	}
+	defer f.Close()
+
+	declared := make(map[string]*routePolicy)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		var comment string
+		if idx := strings.Index(line, "#"); idx != -1 {
+			comment = strings.TrimSpace(line[idx+1:])
+			line = strings.TrimSpace(line[:idx])
+		}
+
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			t.Fatalf("invalid route policy line: %q", line)
+		}
+
+		declared[fields[0]+" "+fields[1]] = &routePolicy{policy: fields[2], pluginPerm: fields[3], csrf: fields[4], comment: comment}
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return declared
+}
+
+// writeRoutePolicyFile writes the policies, keeping the comments of the routes already in the file
+func writeRoutePolicyFile(t *testing.T, computed map[string]*routePolicy) {
+	var declared map[string]*routePolicy
+	if _, err := os.Stat(filepath.FromSlash(routePolicyFile)); err == nil {
+		declared = readRoutePolicyFile(t)
+	}
+
+	keys := make([]string, 0, len(computed))
+	for k := range computed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("# Authorization policy of the web routes of the core and the plugins, checked by TestRoutePolicies\n")
+	b.WriteString("# METHOD PATH POLICY PLUGIN_PERM CSRF, where:\n")
+	b.WriteString("# POLICY is either public or a comma separated list of: session, admin, owner, developer_key\n")
+	b.WriteString("# PLUGIN_PERM are the permissions RequirePermMW checks the bot has, or - if it doesn't\n")
+	b.WriteString("# CSRF is csrf if the route is behind CSRFProtectionMW, or - if it isn't\n")
+	b.WriteString("# Routes marked public that need authorization do their checks in the handler, note that below.\n\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s %s", k, computed[k])
+		if old, ok := declared[k]; ok && old.comment != "" {
+			fmt.Fprintf(&b, " # %s", old.comment)
+		}
+		b.WriteString("\n")
+	}
+
+	err := os.WriteFile(filepath.FromSlash(routePolicyFile), []byte(b.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoutePolicies(t *testing.T) {
+	computed := loadRoutePolicies(t)
+	if len(computed) < 1 {
+		t.Fatal("found no routes")
+	}
+
+	if *updateRoutePolicy {
+		writeRoutePolicyFile(t, computed)
+		return
+	}
+
+	declared := readRoutePolicyFile(t)
+	for route, policy := range computed {
+		expected, ok := declared[route]
+		if !ok {
+			t.Errorf("route %s has no declared policy (it's currently %s), add it to %s", route, policy, routePolicyFile)
+			continue
+		}
+
+		if expected.String() != policy.String() {
+			t.Errorf("route %s: declared policy %s, but it's behind %s", route, expected, policy)
+		}
+	}
+
+	for route := range declared {
+		if _, ok := computed[route]; !ok {
+			t.Errorf("policy declared for %s, but the route does not exist anymore", route)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// The sanitization policies for showing user provided content, e.g custom command responses, as html in the panel
+const (
+	// SanitizeStrict removes all html, keeping the text
+	SanitizeStrict = "strict"
+	// SanitizeInline keeps the formatting discord messages can have: bold, italics, underline, strikethrough, code,
+	// quotes, headers, spoilers, mentions, timestamps, links and custom emojis
+	SanitizeInline = "inline"
+	// SanitizeUGC keeps the formatting of whole documents, e.g the verification page: headers, lists, tables, images
+	SanitizeUGC = "ugc"
+)
+
+var sanitizePolicies = map[string]*bluemonday.Policy{
+	SanitizeStrict: bluemonday.StrictPolicy(),
+	SanitizeInline: inlinePolicy(),
+	SanitizeUGC:    ugcPolicy(),
+}
+
+func inlinePolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("b", "strong", "i", "em", "u", "s", "del", "code", "pre", "blockquote", "br", "p", "span", "h1", "h2", "h3")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(spoiler|mention|timestamp|emoji|hljs(-[\w-]+)?|language-[\w-]+)$`)).OnElements("span", "code")
+	p.AllowAttrs("title").OnElements("span")
+
+	// custom emojis
+	p.AllowAttrs("src").Matching(regexp.MustCompile(`^https://cdn\.discordapp\.com/emojis/\d+\.(png|gif|webp)(\?[\w=&]*)?$`)).OnElements("img")
+	p.AllowAttrs("alt", "title").OnElements("img")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^emoji$`)).OnElements("img")
+
+	p.AllowAttrs("href").OnElements("a")
+	return restrictLinks(p)
+}
+
+func ugcPolicy() *bluemonday.Policy {
+	return restrictLinks(bluemonday.UGCPolicy())
+}
+
+// restrictLinks makes sure links can't run scripts or be used to boost the ranking of other sites
+func restrictLinks(p *bluemonday.Policy) *bluemonday.Policy {
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnFullyQualifiedLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// RegisterSanitizePolicy adds a sanitization policy for Sanitize and the sanitize template func, for plugins whose
+// content needs other elements than the built in policies allow. It has to be called before the web server is started,
+// and the name can't be taken already: registering the same name twice panics.
+func RegisterSanitizePolicy(name string, policy *bluemonday.Policy) {
+	if _, ok := sanitizePolicies[name]; ok {
+		panic(fmt.Sprintf("sanitize policy %s registered twice", name))
+	}
+
+	sanitizePolicies[name] = policy
+}
+
+// Sanitize removes the html the policy doesn't allow from the user provided content, unknown policies remove all of it
+func Sanitize(policy, unsafe string) string {
+	p, ok := sanitizePolicies[policy]
+	if !ok {
+		logger.Errorf("unknown sanitize policy %q, removing all html", policy)
+		p = sanitizePolicies[SanitizeStrict]
+	}
+
+	return p.Sanitize(unsafe)
+}
+
+// SanitizeHTML is Sanitize, marking the result as safe to include in templates as is. It's the sanitize template func,
+// the policy comes first so it can be used in pipelines: {{.Response | sanitize "inline"}}
+func SanitizeHTML(policy, unsafe string) template.HTML {
+	return template.HTML(Sanitize(policy, unsafe))
+}
+
+// StripHTML returns the text of the user provided content without any html, unlike Sanitize with SanitizeStrict the
+// result isn't escaped, for when it's escaped later on, e.g by the templates. It's the stripHTML template func.
+func StripHTML(unsafe string) string {
+	return html.UnescapeString(Sanitize(SanitizeStrict, unsafe))
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		policy, unsafe, expected string
+	}{
+		{SanitizeStrict, `<b>hi</b> <script>alert(1)</script>& bye`, `hi &amp; bye`},
+		{SanitizeInline, `<b onclick="alert(1)">hi</b> <span class="spoiler">x</span><span class="evil">y</span>`, `<b>hi</b> <span class="spoiler">x</span><span>y</span>`},
+		{SanitizeInline, `<a href="javascript:alert(1)">a</a><iframe src="https://example.com"></iframe>`, `a`},
+		{SanitizeInline, `<img src="https://cdn.discordapp.com/emojis/123.png" alt=":a:"><img src="https://example.com/a.png">`, `<img src="https://cdn.discordapp.com/emojis/123.png" alt=":a:">`},
+		{SanitizeUGC, `<h1 style="color: red">Rules</h1><img src="x" onerror="alert(1)">`, `<h1>Rules</h1><img src="x">`},
+		{"unknown", `<b>hi</b>`, `hi`},
+	}
+
+	for _, c := range cases {
+		if got := Sanitize(c.policy, c.unsafe); got != c.expected {
+			t.Errorf("%s: got %q, expected %q", c.policy, got, c.expected)
+		}
+	}
+
+	link := string(SanitizeHTML(SanitizeInline, `<a href="https://example.com">a</a>`))
+	for _, attr := range []string{`href="https://example.com"`, `nofollow`, `noreferrer`, `target="_blank"`} {
+		if !strings.Contains(link, attr) {
+			t.Errorf("expected %s in the link, got %q", attr, link)
+		}
+	}
+
+	if got := StripHTML(`<i>Tom & Jerry</i>`); got != "Tom & Jerry" {
+		t.Errorf("got %q, expected the text without escaping", got)
+	}
+}
+
+func TestRegisterSanitizePolicyTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a taken name to panic")
+		}
+	}()
+
+	RegisterSanitizePolicy(SanitizeInline, nil)
+}
@@ -0,0 +1,404 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/mediocregopher/radix/v3"
+	"goji.io/pat"
+)
+
+const (
+	maxScheduledConfigChanges = 25
+	maxScheduledConfigAhead   = time.Hour * 24 * 90
+
+	scheduledConfigPollInterval = time.Second * 30
+
+	// the sorted set of all the pending changes by when they're due, members are guildID:changeID
+	keyScheduledConfigDue = "web_scheduled_config_due"
+)
+
+var (
+	panelLogKeyScheduledConfigCreated = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "scheduled_config_created",
+		FormatString: "Scheduled settings to be applied at %s: %s",
+	})
+
+	panelLogKeyScheduledConfigCancelled = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "scheduled_config_cancelled",
+		FormatString: "Cancelled the settings scheduled for %s",
+	})
+
+	panelLogKeyScheduledConfigApplied = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "scheduled_config_applied",
+		FormatString: "Applied scheduled settings: %s",
+	})
+
+	panelLogKeyScheduledConfigFailed = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "scheduled_config_failed",
+		FormatString: "Failed applying scheduled settings: %s",
+	})
+)
+
+func keyScheduledConfigChanges(guildID int64) string {
+	return "web_scheduled_config:" + discordgo.StrID(guildID)
+}
+
+// ScheduledConfigChange is a config code document that's applied at a later time,
+// it's validated again when applied as the settings could have changed in the meantime
+type ScheduledConfigChange struct {
+	ID      string    `json:"id"`
+	GuildID int64     `json:"guild_id,string"`
+	ApplyAt time.Time `json:"apply_at"`
+	Config  string    `json:"config"`
+
+	// Changes is what would have changed when it was scheduled
+	Changes []string `json:"changes"`
+
+	AuthorID       int64     `json:"author_id,string"`
+	AuthorUsername string    `json:"author_username"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// GetScheduledConfigChanges returns the pending changes of the guild, sorted by when they're applied
+func GetScheduledConfigChanges(guildID int64) ([]*ScheduledConfigChange, error) {
+	var raw []string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HVALS", keyScheduledConfigChanges(guildID)))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ScheduledConfigChange, 0, len(raw))
+	for _, v := range raw {
+		var change *ScheduledConfigChange
+		err = json.Unmarshal([]byte(v), &change)
+		if err != nil {
+			return nil, common.ErrWithCaller(err)
+		}
+
+		result = append(result, change)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ApplyAt.Before(result[j].ApplyAt)
+	})
+
+	return result, nil
+}
+
+// ScheduleConfigChange stores the change, it's applied by the webserver once it's due
+func ScheduleConfigChange(change *ScheduledConfigChange) error {
+	var count int
+	err := common.RedisPool.Do(radix.Cmd(&count, "HLEN", keyScheduledConfigChanges(change.GuildID)))
+	if err != nil {
+		return err
+	}
+
+	if count >= maxScheduledConfigChanges {
+		return NewPublicError("A server can have at most ", maxScheduledConfigChanges, " scheduled changes")
+	}
+
+	serialized, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	return common.MultipleCmds(
+		radix.Cmd(nil, "HSET", keyScheduledConfigChanges(change.GuildID), change.ID, string(serialized)),
+		radix.FlatCmd(nil, "ZADD", keyScheduledConfigDue, change.ApplyAt.Unix(), scheduledConfigDueMember(change.GuildID, change.ID)),
+	)
+}
+
+// CancelScheduledConfigChange removes a pending change, returning nil if it doesn't exist
+func CancelScheduledConfigChange(guildID int64, id string) (*ScheduledConfigChange, error) {
+	change, err := takeScheduledConfigChange(guildID, id)
+	if change == nil || err != nil {
+		return nil, err
+	}
+
+	err = common.RedisPool.Do(radix.Cmd(nil, "ZREM", keyScheduledConfigDue, scheduledConfigDueMember(guildID, id)))
+	return change, err
+}
+
+// takeScheduledConfigChange retrieves and deletes the change, returning nil if it doesn't exist
+func takeScheduledConfigChange(guildID int64, id string) (*ScheduledConfigChange, error) {
+	var raw string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGET", keyScheduledConfigChanges(guildID), id))
+	if err != nil || raw == "" {
+		return nil, err
+	}
+
+	var deleted int
+	err = common.RedisPool.Do(radix.Cmd(&deleted, "HDEL", keyScheduledConfigChanges(guildID), id))
+	if err != nil || deleted < 1 {
+		// cancelled or applied concurrently
+		return nil, err
+	}
+
+	var change *ScheduledConfigChange
+	err = json.Unmarshal([]byte(raw), &change)
+	if err != nil {
+		return nil, common.ErrWithCaller(err)
+	}
+
+	return change, nil
+}
+
+func scheduledConfigDueMember(guildID int64, id string) string {
+	return discordgo.StrID(guildID) + ":" + id
+}
+
+// parseScheduledConfigTime parses when to apply a change, either a unix timestamp, a RFC3339 time
+// or a time without timezone from a datetime-local input, which is in UTC
+func parseScheduledConfigTime(v string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse("2006-01-02T15:04", v); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, NewPublicError("Invalid time to apply the settings at, expected a unix timestamp or RFC3339 time")
+}
+
+// scheduleConfigCode validates the document like a dry run and schedules it, the validation errors are returned in the result
+func scheduleConfigCode(ctx context.Context, g *dstate.GuildSet, src string, applyAtStr string) (*ConfigCodeApplyResult, error) {
+	applyAt, err := parseScheduledConfigTime(applyAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !applyAt.After(time.Now()) {
+		return nil, NewPublicError("The time to apply the settings at has to be in the future")
+	}
+
+	if time.Until(applyAt) > maxScheduledConfigAhead {
+		return nil, NewPublicError("Settings can be scheduled at most 90 days ahead")
+	}
+
+	_, result, err := prepareConfigCode(ctx, g, src)
+	if err != nil || len(result.Errors) > 0 {
+		return result, err
+	}
+
+	user := ContextUser(ctx)
+	change := &ScheduledConfigChange{
+		ID:             RandBase64(12),
+		GuildID:        g.ID,
+		ApplyAt:        applyAt.UTC(),
+		Config:         src,
+		Changes:        result.Changes,
+		AuthorID:       user.ID,
+		AuthorUsername: user.Username,
+		CreatedAt:      time.Now(),
+	}
+
+	err = ScheduleConfigChange(change)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := common.CutStringShort(strings.Join(result.Changes, "; "), 1000)
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyScheduledConfigCreated,
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: change.ApplyAt.Format(time.RFC822)},
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: summary}))
+
+	result.OK = true
+	result.Scheduled = change
+	return result, nil
+}
+
+// HandleScheduleConfigCode handles POST /manage/:server/config_code/schedule, the body is the same as for config_code/apply,
+// with apply_at set to when to apply it (a unix timestamp or RFC3339 time)
+func HandleScheduleConfigCode(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+
+	src, err := readConfigCodeBody(r)
+	if err != nil {
+		return err
+	}
+
+	result, err := scheduleConfigCode(ctx, ContextGuild(ctx), src, r.FormValue("apply_at"))
+	if err != nil {
+		return err
+	}
+
+	return result
+}
+
+type ScheduleConfigCodeForm struct {
+	Config  string `valid:",1,100000"`
+	ApplyAt string `valid:",1,50"`
+}
+
+// HandlePostScheduledConfig handles POST /manage/:server/core/scheduled_config
+func HandlePostScheduledConfig(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/core")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*ScheduleConfigCodeForm)
+
+	result, err := scheduleConfigCode(ctx, g, form.Config, form.ApplyAt)
+	if err != nil {
+		return tmpl, err
+	}
+
+	for _, v := range result.Errors {
+		tmpl.AddAlerts(ErrorAlert(v))
+	}
+
+	return tmpl, nil
+}
+
+// HandleCancelScheduledConfig handles POST /manage/:server/core/scheduled_config/:change/cancel
+func HandleCancelScheduledConfig(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/core")
+
+	change, err := CancelScheduledConfigChange(g.ID, pat.Param(r, "change"))
+	if err != nil {
+		return tmpl, err
+	}
+
+	if change == nil {
+		return tmpl.AddAlerts(ErrorAlert("Unknown scheduled change, it might have been applied already")), nil
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyScheduledConfigCancelled,
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: change.ApplyAt.Format(time.RFC822)}))
+
+	return tmpl, nil
+}
+
+// scheduledConfigActions lists the pending changes within the range on the scheduled actions page
+func scheduledConfigActions(guildID int64, from, to time.Time) ([]*ScheduledAction, error) {
+	changes, err := GetScheduledConfigChanges(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*ScheduledAction
+	for _, v := range changes {
+		if v.ApplyAt.Before(from) || !v.ApplyAt.Before(to) {
+			continue
+		}
+
+		result = append(result, &ScheduledAction{
+			At:          v.ApplyAt,
+			Plugin:      "Core",
+			Description: fmt.Sprintf("Apply scheduled settings (%d changes, by %s)", len(v.Changes), v.AuthorUsername),
+			Link:        "/core",
+		})
+	}
+
+	return result, nil
+}
+
+func runScheduledConfigLoop(ctx context.Context) {
+	ticker := time.NewTicker(scheduledConfigPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		applyDueConfigChanges()
+	}
+}
+
+func applyDueConfigChanges() {
+	var due []string
+	err := common.RedisPool.Do(radix.FlatCmd(&due, "ZRANGEBYSCORE", keyScheduledConfigDue, "-inf", time.Now().Unix(), "LIMIT", 0, 100))
+	if err != nil {
+		logger.WithError(err).Error("failed retrieving due scheduled config changes")
+		return
+	}
+
+	for _, member := range due {
+		// removing it claims it, so only one of the webservers applies it
+		var removed int
+		err = common.RedisPool.Do(radix.Cmd(&removed, "ZREM", keyScheduledConfigDue, member))
+		if err != nil || removed < 1 {
+			continue
+		}
+
+		split := strings.SplitN(member, ":", 2)
+		guildID, _ := strconv.ParseInt(split[0], 10, 64)
+		if len(split) < 2 || guildID == 0 {
+			continue
+		}
+
+		change, err := takeScheduledConfigChange(guildID, split[1])
+		if err != nil {
+			logger.WithError(err).WithField("guild", guildID).Error("failed retrieving scheduled config change")
+			continue
+		}
+
+		if change != nil {
+			applyScheduledConfigChange(change)
+		}
+	}
+}
+
+func applyScheduledConfigChange(change *ScheduledConfigChange) {
+	ctx := context.Background()
+
+	summary, err := applyScheduledConfig(ctx, change)
+	if err != nil {
+		logger.WithError(err).WithField("guild", change.GuildID).Error("failed applying scheduled config change")
+		go cplogs.RetryAddEntry(cplogs.NewEntry(change.GuildID, change.AuthorID, change.AuthorUsername, panelLogKeyScheduledConfigFailed,
+			&cplogs.Param{Type: cplogs.ParamTypeString, Value: common.CutStringShort(err.Error(), 1000)}))
+		return
+	}
+
+	go cplogs.RetryAddEntry(cplogs.NewEntry(change.GuildID, change.AuthorID, change.AuthorUsername, panelLogKeyScheduledConfigApplied,
+		&cplogs.Param{Type: cplogs.ParamTypeString, Value: summary}))
+}
+
+func applyScheduledConfig(ctx context.Context, change *ScheduledConfigChange) (string, error) {
+	g, err := getGuild(ctx, change.GuildID)
+	if err != nil {
+		return "", err
+	}
+
+	pending, result, err := prepareConfigCode(ctx, g, change.Config)
+	if err != nil {
+		return "", err
+	}
+
+	if len(result.Errors) > 0 {
+		return "", errors.New(strings.Join(result.Errors, "; "))
+	}
+
+	if len(pending) < 1 {
+		return "nothing changed", nil
+	}
+
+	err = applyConfigCode(ctx, g.ID, pending)
+	if err != nil {
+		return "", err
+	}
+
+	return common.CutStringShort(strings.Join(result.Changes, "; "), 1000), nil
+}
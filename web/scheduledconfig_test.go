@@ -0,0 +1,33 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduledConfigTime(t *testing.T) {
+	want := time.Date(2024, 6, 1, 18, 30, 0, 0, time.UTC)
+
+	cases := []string{
+		"1717266600",
+		"2024-06-01T18:30:00Z",
+		"2024-06-01T20:30:00+02:00",
+		"2024-06-01T18:30",
+	}
+
+	for _, v := range cases {
+		parsed, err := parseScheduledConfigTime(v)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", v, err)
+			continue
+		}
+
+		if !parsed.Equal(want) {
+			t.Errorf("%q: got %s, expected %s", v, parsed.UTC(), want)
+		}
+	}
+
+	if _, err := parseScheduledConfigTime("next saturday"); err == nil {
+		t.Error("expected an error for an invalid time")
+	}
+}
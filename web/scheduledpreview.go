@@ -0,0 +1,256 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/scheduledevents2/models"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+)
+
+const (
+	scheduledPreviewDefaultRange = time.Hour * 24 * 7
+	scheduledPreviewMaxRange     = time.Hour * 24 * 31
+
+	// max amount of actions returned, the earliest ones are kept
+	scheduledPreviewMaxActions = 1000
+)
+
+type scheduledEventPreview struct {
+	Plugin      string
+	Description string
+	Link        string
+}
+
+// scheduledEventPreviews describes the generic scheduled events, events missing from here are shown with their raw name.
+// Events with a empty description are left out as the plugin lists them itself through PluginWithScheduledActions
+var scheduledEventPreviews = map[string]*scheduledEventPreview{
+	"moderation_unmute":             {"Moderation", "Unmute member", "/moderation"},
+	"moderation_unban":              {"Moderation", "Unban user", "/moderation"},
+	"std_remove_member_role":        {"Core", "Remove role from member", ""},
+	"std_add_member_role":           {"Core", "Give role to member", ""},
+	"remove_member_role":            {"Role commands", "Remove temporary role from member", "/rolecommands"},
+	"rolemenu_update_message":       {"Role commands", "Update role menu message", "/rolecommands"},
+	"autorole_assign_role":          {"Autorole", "Assign autorole to member", "/autorole"},
+	"verification_user_verified":    {"Verification", "Give verified role to member", "/verification"},
+	"verification_user_warn":        {"Verification", "Warn unverified member", "/verification"},
+	"verification_user_kick":        {"Verification", "Kick unverified member", "/verification"},
+	"delete_messages":               {"Core", "Delete messages", ""},
+	"cc_delayed_run":                {"Custom commands", "Run custom command (execCC/scheduleUniqueCC)", "/customcommands"},
+	"rsvp_update_session":           {"RSVP", "Update event message", ""},
+	"amod2_reset_channel_ratelimit": {"Automoderator", "Reset channel slowmode", "/automod"},
+	"cc_next_run":                   {"", "", ""},
+	"reminders_check_user":          {"", "", ""},
+	"premium_guild_added":           {"", "", ""},
+	"premium_guild_removed":         {"", "", ""},
+}
+
+// parseScheduledPreviewRange reads the range from the from and to parameters, either unix timestamps or RFC3339
+func parseScheduledPreviewRange(r *http.Request) (from, to time.Time, err error) {
+	from = time.Now()
+	to = from.Add(scheduledPreviewDefaultRange)
+
+	parse := func(field string, dst *time.Time) error {
+		v := r.FormValue(field)
+		if v == "" {
+			return nil
+		}
+
+		if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+			*dst = time.Unix(unix, 0)
+			return nil
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return NewPublicError("Invalid " + field + ", expected a unix timestamp or RFC3339 time")
+		}
+
+		*dst = t
+		return nil
+	}
+
+	if err = parse("from", &from); err != nil {
+		return
+	}
+
+	if r.FormValue("to") == "" {
+		to = from.Add(scheduledPreviewDefaultRange)
+	} else if err = parse("to", &to); err != nil {
+		return
+	}
+
+	if !to.After(from) {
+		return from, to, NewPublicError("to has to be after from")
+	}
+
+	if to.Sub(from) > scheduledPreviewMaxRange {
+		return from, to, NewPublicError("The range can be at most 31 days")
+	}
+
+	return from, to, nil
+}
+
+// GetScheduledActions returns everything that's scheduled to happen in the guild within the range, sorted by time
+func GetScheduledActions(ctx context.Context, guildID int64, from, to time.Time) ([]*ScheduledAction, error) {
+	result, err := scheduledConfigActions(guildID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("core: %w", err)
+	}
+
+	for _, v := range common.Plugins {
+		p, ok := v.(PluginWithScheduledActions)
+		if !ok {
+			continue
+		}
+
+		actions, err := p.ScheduledActions(ctx, guildID, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.PluginInfo().Name, err)
+		}
+
+		result = append(result, actions...)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].At.Before(result[j].At)
+	})
+
+	if len(result) > scheduledPreviewMaxActions {
+		result = result[:scheduledPreviewMaxActions]
+	}
+
+	return result, nil
+}
+
+// HandleGetScheduledActionsJSON handles GET /manage/:server/scheduled_actions.json
+func HandleGetScheduledActionsJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	g := ContextGuild(r.Context())
+
+	from, to, err := parseScheduledPreviewRange(r)
+	if err != nil {
+		return err
+	}
+
+	actions, err := GetScheduledActions(r.Context(), g.ID, from, to)
+	if err != nil {
+		return err
+	}
+
+	return map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"actions": actions,
+	}
+}
+
+type scheduledActionsDay struct {
+	Day     time.Time
+	Actions []*ScheduledAction
+}
+
+// HandleGetScheduledActions handles GET /manage/:server/scheduled_actions, listing the upcoming actions grouped by day
+func HandleGetScheduledActions(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, tmpl := GetBaseCPContextData(r.Context())
+
+	from, to, err := parseScheduledPreviewRange(r)
+	if err != nil {
+		return tmpl.AddAlerts(ErrorAlert(err.Error())), nil
+	}
+
+	actions, err := GetScheduledActions(r.Context(), g.ID, from, to)
+	if err != nil {
+		return tmpl, err
+	}
+
+	var days []*scheduledActionsDay
+	for _, v := range actions {
+		day := v.At.UTC().Truncate(time.Hour * 24)
+		if len(days) < 1 || !days[len(days)-1].Day.Equal(day) {
+			days = append(days, &scheduledActionsDay{Day: day})
+		}
+
+		days[len(days)-1].Actions = append(days[len(days)-1].Actions, v)
+	}
+
+	tmpl["ScheduledFrom"] = from
+	tmpl["ScheduledTo"] = to
+	tmpl["ScheduledDays"] = days
+	tmpl["ScheduledTotal"] = len(actions)
+	tmpl["ScheduledPrev"] = from.Add(-to.Sub(from)).Unix()
+	tmpl["ScheduledNext"] = to.Unix()
+	tmpl["ScheduledNextTo"] = to.Add(to.Sub(from)).Unix()
+
+	return tmpl, nil
+}
+
+var _ PluginWithScheduledActions = (*ControlPanelPlugin)(nil)
+
+// ScheduledActions lists the pending generic scheduled events of the guild
+func (p *ControlPanelPlugin) ScheduledActions(ctx context.Context, guildID int64, from, to time.Time) ([]*ScheduledAction, error) {
+	events, err := models.ScheduledEvents(
+		qm.Where("guild_id = ? AND processed = false AND triggers_at >= ? AND triggers_at < ?", guildID, from, to),
+		qm.OrderBy("triggers_at asc"),
+		qm.Limit(scheduledPreviewMaxActions)).AllG(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ScheduledAction, 0, len(events))
+	for _, v := range events {
+		preview, ok := scheduledEventPreviews[v.EventName]
+		if !ok {
+			preview = &scheduledEventPreview{Plugin: "Other", Description: v.EventName}
+		}
+
+		if preview.Description == "" {
+			continue
+		}
+
+		description := preview.Description
+		if target := scheduledEventTarget(v.Data); target != "" {
+			description += " " + target
+		}
+
+		result = append(result, &ScheduledAction{
+			At:          v.TriggersAt,
+			Plugin:      preview.Plugin,
+			Description: description,
+			Link:        preview.Link,
+		})
+	}
+
+	return result, nil
+}
+
+// scheduledEventTarget returns the user and role the event is for, if the data has them
+func scheduledEventTarget(data []byte) string {
+	var target struct {
+		UserID int64 `json:"user_id"`
+		RoleID int64 `json:"role_id"`
+	}
+
+	if len(data) < 1 || json.Unmarshal(data, &target) != nil {
+		return ""
+	}
+
+	s := ""
+	if target.UserID != 0 {
+		s += fmt.Sprintf("(user %d)", target.UserID)
+	}
+
+	if target.RoleID != 0 {
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("(role %d)", target.RoleID)
+	}
+
+	return s
+}
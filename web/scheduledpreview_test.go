@@ -0,0 +1,58 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseScheduledPreviewRange(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	from, to, err := parseScheduledPreviewRange(httptest.NewRequest("GET", "/?from=2023-01-01T00:00:00Z", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !from.Equal(base) || !to.Equal(base.Add(scheduledPreviewDefaultRange)) {
+		t.Errorf("unexpected default range: %s - %s", from, to)
+	}
+
+	from, to, err = parseScheduledPreviewRange(httptest.NewRequest("GET", "/?from=1672531200&to=1672617600", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !from.Equal(base) || !to.Equal(base.Add(time.Hour*24)) {
+		t.Errorf("unexpected unix range: %s - %s", from, to)
+	}
+
+	invalid := []string{
+		"/?from=yesterday",
+		"/?from=1672617600&to=1672531200",
+		"/?from=1672531200&to=1772531200",
+	}
+
+	for _, v := range invalid {
+		_, _, err := parseScheduledPreviewRange(httptest.NewRequest("GET", v, nil))
+		if _, ok := err.(*PublicError); !ok {
+			t.Errorf("%s: expected a public error, got %v", v, err)
+		}
+	}
+}
+
+func TestScheduledEventTarget(t *testing.T) {
+	cases := map[string]string{
+		`{"user_id":1}`:             "(user 1)",
+		`{"user_id":1,"role_id":2}`: "(user 1) (role 2)",
+		`{"GuildID":1}`:             "",
+		`123`:                       "",
+		``:                          "",
+	}
+
+	for data, expected := range cases {
+		if got := scheduledEventTarget([]byte(data)); got != expected {
+			t.Errorf("%q: got %q, expected %q", data, got, expected)
+		}
+	}
+}
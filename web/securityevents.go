@@ -0,0 +1,288 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confSecurityEventSink = config.RegisterOption("yagpdb.web.security_event_sink", "Where security relevant events (logins, permission denials, bot owner actions, api key usage) are forwarded to as json, empty to disable. "+
+		"Either a http(s):// url events are POSTed to in batches, syslog://host:port (udp), syslog+tcp://host:port, syslog:// for the local syslog, or kafka-rest(s)://host:port/topics/<topic> for a kafka REST proxy", "")
+	confSecurityEventSinkAuth = config.RegisterOption("yagpdb.web.security_event_sink_auth", "Authorization header sent with the events to http and kafka-rest sinks", "")
+
+	metricsSecurityEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_web_security_events_total",
+		Help: "Security events forwarded to the configured sink, result is either sent, dropped (the queue was full) or failed",
+	}, []string{"result"})
+)
+
+// Security event types
+const (
+	SecurityEventLogin            = "login"
+	SecurityEventLogout           = "logout"
+	SecurityEventAuthFailure      = "auth_failure"
+	SecurityEventAuthLockout      = "auth_lockout"
+	SecurityEventPermissionDenied = "permission_denied"
+	SecurityEventOwnerAction      = "owner_action"
+	SecurityEventAPIKeyUsed       = "api_key_used"
+	SecurityEventAPIKeyInvalid    = "api_key_invalid"
+)
+
+// SecurityEvent is a security relevant event forwarded to the external sink, for deployments that need to keep track of them
+type SecurityEvent struct {
+	Time    time.Time         `json:"time"`
+	Type    string            `json:"type"`
+	UserID  int64             `json:"user_id,omitempty,string"`
+	GuildID int64             `json:"guild_id,omitempty,string"`
+	IP      string            `json:"ip,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+const (
+	securityEventQueueSize  = 1000
+	securityEventMaxBatch   = 100
+	securityEventBatchDelay = time.Second
+)
+
+var securityEventQueue = make(chan *SecurityEvent, securityEventQueueSize)
+
+// EmitSecurityEvent queues the event to be forwarded, the time, ip, path, user and guild are filled in from the request
+// unless already set. Events are dropped if no sink is configured or the sink can't keep up.
+func EmitSecurityEvent(r *http.Request, evt *SecurityEvent) {
+	if confSecurityEventSink.GetString() == "" {
+		return
+	}
+
+	ctx := r.Context()
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+
+	if evt.UserID == 0 {
+		if user, ok := ctx.Value(common.ContextKeyUser).(*discordgo.User); ok {
+			evt.UserID = user.ID
+		}
+	}
+
+	if evt.GuildID == 0 {
+		if guild, ok := ctx.Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet); ok {
+			evt.GuildID = guild.ID
+		}
+	}
+
+	evt.IP = GetRequestIP(r)
+	evt.Method = r.Method
+	evt.Path = r.URL.Path
+
+	select {
+	case securityEventQueue <- evt:
+	default:
+		metricsSecurityEvents.WithLabelValues("dropped").Inc()
+	}
+}
+
+// securityEventSink is somewhere security events are forwarded to
+type securityEventSink interface {
+	Send(events []*SecurityEvent) error
+}
+
+// newSecurityEventSink creates the sink from the url configured in yagpdb.web.security_event_sink
+func newSecurityEventSink(rawURL, auth string) (securityEventSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return &httpSecurityEventSink{url: rawURL, auth: auth}, nil
+	case "kafka-rest", "kafka-rests":
+		scheme := "http"
+		if u.Scheme == "kafka-rests" {
+			scheme = "https"
+		}
+
+		if !strings.HasPrefix(u.Path, "/topics/") {
+			return nil, errors.New("kafka-rest sink url has to point to a topic: kafka-rest://host:port/topics/<topic>")
+		}
+
+		u.Scheme = scheme
+		return &httpSecurityEventSink{url: u.String(), auth: auth, kafka: true}, nil
+	case "syslog", "syslog+tcp":
+		network := "udp"
+		if u.Scheme == "syslog+tcp" {
+			network = "tcp"
+		}
+
+		if u.Host == "" {
+			// the local syslog daemon
+			network = ""
+		}
+
+		w, err := syslog.Dial(network, u.Host, syslog.LOG_INFO|syslog.LOG_AUTH, "yagpdb")
+		if err != nil {
+			return nil, err
+		}
+
+		return &syslogSecurityEventSink{w: w}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported security event sink %q", u.Scheme)
+}
+
+// httpSecurityEventSink POSTs the events as a json array, or in the format of the kafka REST proxy
+type httpSecurityEventSink struct {
+	url   string
+	auth  string
+	kafka bool
+}
+
+var securityEventHTTPClient = &http.Client{Timeout: time.Second * 10}
+
+type kafkaRESTRecord struct {
+	Value *SecurityEvent `json:"value"`
+}
+
+func (s *httpSecurityEventSink) body(events []*SecurityEvent) (contentType string, body []byte, err error) {
+	if !s.kafka {
+		body, err = json.Marshal(events)
+		return "application/json", body, err
+	}
+
+	records := make([]*kafkaRESTRecord, 0, len(events))
+	for _, v := range events {
+		records = append(records, &kafkaRESTRecord{Value: v})
+	}
+
+	body, err = json.Marshal(map[string]interface{}{"records": records})
+	return "application/vnd.kafka.json.v2+json", body, err
+}
+
+func (s *httpSecurityEventSink) Send(events []*SecurityEvent) error {
+	contentType, body, err := s.body(events)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if s.auth != "" {
+		req.Header.Set("Authorization", s.auth)
+	}
+
+	resp, err := securityEventHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("security event sink responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// syslogSecurityEventSink writes every event as a json message to syslog
+type syslogSecurityEventSink struct {
+	w *syslog.Writer
+}
+
+func (s *syslogSecurityEventSink) Send(events []*SecurityEvent) error {
+	for _, v := range events {
+		serialized, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if err = s.w.Info(string(serialized)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runSecurityEventExporter forwards the queued events to the configured sink in batches
+func runSecurityEventExporter(ctx context.Context) {
+	raw := confSecurityEventSink.GetString()
+	if raw == "" {
+		return
+	}
+
+	sink, err := newSecurityEventSink(raw, confSecurityEventSinkAuth.GetString())
+	if err != nil {
+		logger.WithError(err).Error("Invalid yagpdb.web.security_event_sink, security events will not be forwarded")
+		return
+	}
+
+	ticker := time.NewTicker(securityEventBatchDelay)
+	defer ticker.Stop()
+
+	var batch []*SecurityEvent
+	for {
+		stopping := false
+		select {
+		case evt := <-securityEventQueue:
+			batch = append(batch, evt)
+			if len(batch) < securityEventMaxBatch {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) < 1 {
+				continue
+			}
+		case <-ctx.Done():
+			// forward the queued events before shutting down
+			stopping = true
+		DRAIN:
+			for {
+				select {
+				case evt := <-securityEventQueue:
+					batch = append(batch, evt)
+				default:
+					break DRAIN
+				}
+			}
+
+			if len(batch) < 1 {
+				return
+			}
+		}
+
+		err := sink.Send(batch)
+		if err != nil {
+			logger.WithError(err).Errorf("Failed forwarding %d security events", len(batch))
+			metricsSecurityEvents.WithLabelValues("failed").Add(float64(len(batch)))
+		} else {
+			metricsSecurityEvents.WithLabelValues("sent").Add(float64(len(batch)))
+		}
+
+		if stopping {
+			return
+		}
+
+		batch = nil
+	}
+}
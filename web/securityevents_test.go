@@ -0,0 +1,54 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewSecurityEventSink(t *testing.T) {
+	sink, err := newSecurityEventSink("kafka-rests://proxy:8082/topics/yagpdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, ok := sink.(*httpSecurityEventSink); !ok || !s.kafka || s.url != "https://proxy:8082/topics/yagpdb" {
+		t.Errorf("unexpected kafka sink %#v", sink)
+	}
+
+	for _, v := range []string{"kafka-rest://proxy:8082/", "ftp://example.com", "%zz"} {
+		if _, err := newSecurityEventSink(v, ""); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestHTTPSecurityEventSink(t *testing.T) {
+	var received map[string][]*kafkaRESTRecord
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer srv.Close()
+
+	sink := &httpSecurityEventSink{url: srv.URL, auth: "Bearer abc", kafka: true}
+	err := sink.Send([]*SecurityEvent{{Type: SecurityEventLogin, UserID: 1}, {Type: SecurityEventLogout, UserID: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := received["records"]
+	if len(records) != 2 || records[0].Value.Type != SecurityEventLogin || records[0].Value.UserID != 1 {
+		t.Errorf("unexpected records %#v", received)
+	}
+
+	sink.auth = ""
+	if err := sink.Send([]*SecurityEvent{{Type: SecurityEventLogin}}); err == nil {
+		t.Error("expected an error on a non 2xx status")
+	}
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+)
+
+// the third party hosts scripts are loaded from, jquery and parallax on the landing page, google analytics and the captcha providers
+const cspScriptHosts = "https://code.jquery.com https://cdnjs.cloudflare.com https://www.google-analytics.com https://www.google.com https://www.gstatic.com https://hcaptcha.com https://*.hcaptcha.com"
+
+const defaultCSP = "default-src 'self'; script-src 'self' 'nonce-{nonce}' " + cspScriptHosts + "; style-src 'self' 'unsafe-inline' https:; img-src 'self' data: https:; font-src 'self' data: https:; connect-src 'self' https:; frame-src 'self' https://www.google.com https://hcaptcha.com https://*.hcaptcha.com; object-src 'none'; base-uri 'self'; frame-ancestors 'none'"
+
+var (
+	confCSP            = config.RegisterOption("yagpdb.web.csp", "Content-Security-Policy of the pages, {nonce} is replaced with the nonce of the request. Empty to disable", defaultCSP)
+	confCSPReportOnly  = config.RegisterOption("yagpdb.web.csp_report_only", "Only report CSP violations instead of enforcing the policy", false)
+	confFrameOptions   = config.RegisterOption("yagpdb.web.frame_options", "X-Frame-Options header, empty to leave it out", "DENY")
+	confReferrerPolicy = config.RegisterOption("yagpdb.web.referrer_policy", "Referrer-Policy header, empty to leave it out", "strict-origin-when-cross-origin")
+	confContentNoSniff = config.RegisterOption("yagpdb.web.content_type_nosniff", "Send X-Content-Type-Options: nosniff", true)
+)
+
+// newCSPNonce returns a new random nonce, url safe so templates write it into the nonce attributes as is
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func cspHeaderName() string {
+	if confCSPReportOnly.GetBool() {
+		return "Content-Security-Policy-Report-Only"
+	}
+
+	return "Content-Security-Policy"
+}
+
+// setSecurityHeaders writes the configured security headers, with nonce being the script nonce of the request
+func setSecurityHeaders(header http.Header, nonce string) {
+	// force https for a year
+	header.Set("Strict-Transport-Security", "max-age=31536000")
+
+	if csp := confCSP.GetString(); csp != "" {
+		header.Set(cspHeaderName(), strings.ReplaceAll(csp, "{nonce}", nonce))
+	}
+
+	if v := confFrameOptions.GetString(); v != "" {
+		header.Set("X-Frame-Options", v)
+	}
+
+	if v := confReferrerPolicy.GetString(); v != "" {
+		header.Set("Referrer-Policy", v)
+	}
+
+	if confContentNoSniff.GetBool() {
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+}
+
+// securityHeadersContext creates the script nonce for the request, writes the security headers and makes the nonce
+// available to templates as CSPNonce, inline scripts need nonce="{{$.CSPNonce}}" to run
+func securityHeadersContext(w http.ResponseWriter, ctx context.Context) context.Context {
+	nonce := newCSPNonce()
+	setSecurityHeaders(w.Header(), nonce)
+
+	ctx = context.WithValue(ctx, common.ContextKeyCSPNonce, nonce)
+	ctx, tmpl := GetCreateTemplateData(ctx)
+	tmpl.SetCSPNonce(nonce)
+	return ctx
+}
+
+// ContextCSPNonce returns the script nonce of the request
+func ContextCSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(common.ContextKeyCSPNonce).(string)
+	return nonce
+}
+
+// SecurityHeadersOverrideMW overrides the security headers for the routes it's applied to,
+// e.g to allow a page to be embedded in an iframe. Empty values remove the header, and {nonce} is replaced
+// with the nonce of the request in a Content-Security-Policy override.
+func SecurityHeadersOverrideMW(overrides map[string]string) func(http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range overrides {
+				if k == "Content-Security-Policy" {
+					// keep it in report only mode if that's what's configured
+					w.Header().Del("Content-Security-Policy")
+					w.Header().Del("Content-Security-Policy-Report-Only")
+					k = cspHeaderName()
+				}
+
+				if v == "" {
+					w.Header().Del(k)
+					continue
+				}
+
+				w.Header().Set(k, strings.ReplaceAll(v, "{nonce}", ContextCSPNonce(r.Context())))
+			}
+
+			inner.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package web
+
+import (
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/frontend"
+)
+
+// cspDirective returns the sources of the directive in the policy
+func cspDirective(policy, name string) []string {
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 && fields[0] == name {
+			return fields[1:]
+		}
+	}
+
+	return nil
+}
+
+func TestSetSecurityHeaders(t *testing.T) {
+	defer func(csp, reportOnly interface{}) {
+		confCSP.LoadedValue = csp
+		confCSPReportOnly.LoadedValue = reportOnly
+	}(confCSP.LoadedValue, confCSPReportOnly.LoadedValue)
+	confCSP.LoadedValue = defaultCSP
+	confCSPReportOnly.LoadedValue = confCSPReportOnly.DefaultValue
+
+	header := make(http.Header)
+	setSecurityHeaders(header, "abc")
+
+	// enforced by default
+	policy := header.Get("Content-Security-Policy")
+	if policy == "" || header.Get("Content-Security-Policy-Report-Only") != "" {
+		t.Fatalf("expected the policy to be enforced, got %v", header)
+	}
+
+	scriptSrc := cspDirective(policy, "script-src")
+	hasNonce := false
+	for _, v := range scriptSrc {
+		if v == "'nonce-abc'" {
+			hasNonce = true
+		}
+
+		// any https host would allow scripts from anywhere
+		if v == "https:" || v == "*" || v == "'unsafe-inline'" || !strings.HasPrefix(v, "'") && !strings.HasPrefix(v, "https://") {
+			t.Errorf("script-src allows too much with %q", v)
+		}
+	}
+
+	if !hasNonce {
+		t.Errorf("expected the nonce of the request in script-src, got %v", scriptSrc)
+	}
+
+	confCSPReportOnly.LoadedValue = true
+	header = make(http.Header)
+	setSecurityHeaders(header, "abc")
+	if header.Get("Content-Security-Policy") != "" || !strings.Contains(header.Get("Content-Security-Policy-Report-Only"), "'nonce-abc'") {
+		t.Errorf("expected the policy to only be reported, got %v", header)
+	}
+
+	confCSP.LoadedValue = ""
+	header = make(http.Header)
+	setSecurityHeaders(header, "abc")
+	if header.Get("Content-Security-Policy-Report-Only") != "" {
+		t.Errorf("expected no policy when disabled, got %v", header)
+	}
+}
+
+func TestNewCSPNonce(t *testing.T) {
+	a, b := newCSPNonce(), newCSPNonce()
+	if a == b || len(a) < 16 {
+		t.Fatalf("expected unique random nonces, got %q and %q", a, b)
+	}
+
+	// the nonce in the page has to match the one in the header
+	for i := 0; i < 100; i++ {
+		nonce := newCSPNonce()
+		if escaped := template.HTMLEscapeString(nonce); escaped != nonce {
+			t.Fatalf("the nonce %q is written as %q into templates", nonce, escaped)
+		}
+	}
+}
+
+func TestSecurityHeadersOverrideMW(t *testing.T) {
+	defer func(old interface{}) { confCSPReportOnly.LoadedValue = old }(confCSPReportOnly.LoadedValue)
+
+	for _, reportOnly := range []bool{false, true} {
+		confCSPReportOnly.LoadedValue = reportOnly
+
+		handler := SecurityHeadersOverrideMW(map[string]string{
+			"Content-Security-Policy": "script-src 'nonce-{nonce}'",
+			"X-Frame-Options":         "",
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/embed", nil)
+		r = r.WithContext(securityHeadersContext(w, r.Context()))
+		handler.ServeHTTP(w, r)
+
+		other := "Content-Security-Policy-Report-Only"
+		if reportOnly {
+			other = "Content-Security-Policy"
+		}
+
+		expected := "script-src 'nonce-" + ContextCSPNonce(r.Context()) + "'"
+		if w.Header().Get(cspHeaderName()) != expected || w.Header().Get(other) != "" {
+			t.Errorf("report only %t: expected %q, got %v", reportOnly, expected, w.Header())
+		}
+
+		if _, ok := w.Header()["X-Frame-Options"]; ok {
+			t.Errorf("expected the frame options to be removed, got %v", w.Header())
+		}
+	}
+}
+
+var (
+	inlineScriptRegex  = regexp.MustCompile(`(?i)<script\b[^>]*>`)
+	inlineHandlerRegex = regexp.MustCompile(`(?i)<[a-z][^>]*\son[a-z]+\s*=`)
+)
+
+// the policy is enforced, so inline scripts without the nonce and inline event handlers don't run
+func TestTemplatesInlineScripts(t *testing.T) {
+	check := func(path string, contents []byte) {
+		for _, tag := range inlineScriptRegex.FindAllString(string(contents), -1) {
+			if !strings.Contains(tag, " src=") && !strings.Contains(tag, "nonce=") {
+				t.Errorf("%s: inline script without the nonce: %s", path, tag)
+			}
+		}
+
+		for _, handler := range inlineHandlerRegex.FindAllString(string(contents), -1) {
+			t.Errorf("%s: inline event handler: %s", path, handler)
+		}
+	}
+
+	err := fs.WalkDir(frontend.CoreTemplates, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		contents, err := frontend.CoreTemplates.ReadFile(path)
+		if err == nil {
+			check(path, contents)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the plugin templates
+	paths, err := filepath.Glob("../*/assets/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(path, contents)
+	}
+}
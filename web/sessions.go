@@ -0,0 +1,230 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"github.com/botlabs-gg/yagpdb/v2/web/discorddata"
+	"github.com/patrickmn/go-cache"
+	"goji.io/pat"
+)
+
+// SessionMeta is the metadata we keep about a session, shown on the /sessions page
+type SessionMeta struct {
+	// ID is a hash of the session token, safe to show to the user
+	ID string `json:"id"`
+
+	UserID    int64     `json:"user_id,string"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+
+	Current bool `json:"current"`
+
+	// Application is the name of the application selected in the session
+	Application string `json:"-"`
+
+	token string
+}
+
+// SessionID returns the public id of a session, we don't want to expose the tokens themselves
+func SessionID(yagToken string) string {
+	h := sha256.Sum256([]byte(yagToken))
+	return hex.EncodeToString(h[:16])
+}
+
+// CreateSessionMeta records the metadata for a newly created session
+func CreateSessionMeta(yagToken string, userID int64, r *http.Request) error {
+	now := time.Now()
+	return Sessions.SaveMeta(&SessionMeta{
+		ID:        SessionID(yagToken),
+		UserID:    userID,
+		CreatedAt: now,
+		LastSeen:  now,
+		IP:        GetRequestIP(r),
+		UserAgent: r.UserAgent(),
+		token:     yagToken,
+	}, SessionTTL())
+}
+
+// sessions are only touched once a minute to keep the load on the session store down, by SessionID so revocations
+// can be sent to the other web instances without the token
+var sessionTouchCache = cache.New(time.Minute, time.Minute*5)
+
+// evtSessionRevoked tells every web instance to stop accepting a deleted session, instead of until its entry in
+// sessionTouchCache expires
+const evtSessionRevoked = "web_session_revoked"
+
+type sessionRevokedData struct {
+	SessionID string `json:"session_id"`
+}
+
+func init() {
+	pubsub.AddHandler(evtSessionRevoked, handleSessionRevoked, sessionRevokedData{})
+}
+
+func handleSessionRevoked(evt *pubsub.Event) {
+	sessionTouchCache.Delete(evt.Data.(*sessionRevokedData).SessionID)
+}
+
+// forgetSession drops a deleted session from the caches of every web instance
+func forgetSession(yagToken string) {
+	discorddata.EvictSession(yagToken)
+
+	id := SessionID(yagToken)
+	sessionTouchCache.Delete(id)
+
+	if _, ok := Sessions.(*MemorySessionStore); ok {
+		// not shared with other processes
+		return
+	}
+
+	pubsub.PublishLogErr(evtSessionRevoked, -1, &sessionRevokedData{SessionID: id})
+}
+
+// touchSession extends the session and updates its metadata,
+// returns false if the session no longer exists (expired or revoked)
+func touchSession(w http.ResponseWriter, r *http.Request, yagToken string) bool {
+	id := SessionID(yagToken)
+	if _, ok := sessionTouchCache.Get(id); ok {
+		return true
+	}
+
+	// sliding expiration, keep the session alive as long as it's being used
+	extended, err := ExtendSession(yagToken)
+	if err != nil {
+		// don't log people out because the session store had a hiccup
+		CtxLogger(r.Context()).WithError(err).Error("failed extending session")
+		return true
+	}
+
+	if !extended {
+		return false
+	}
+
+	sessionTouchCache.SetDefault(id, true)
+	http.SetCookie(w, newSessionCookie(yagToken, SessionTTL()))
+
+	meta, err := Sessions.GetMeta(id)
+	if err != nil || meta == nil || meta.UserID == 0 {
+		// sessions created before metadata was tracked
+		return true
+	}
+
+	meta.LastSeen = time.Now()
+	meta.IP = GetRequestIP(r)
+	meta.UserAgent = r.UserAgent()
+	err = Sessions.SaveMeta(meta, SessionTTL())
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed updating session metadata")
+	}
+
+	return true
+}
+
+// GetUserSessions returns all the active sessions of the user, most recently used first
+func GetUserSessions(userID int64) ([]*SessionMeta, error) {
+	ids, err := Sessions.UserSessionIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*SessionMeta, 0, len(ids))
+	for _, id := range ids {
+		meta, err := Sessions.GetMeta(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if meta == nil {
+			// expired, clean up the index
+			Sessions.DeleteMeta(userID, id)
+			continue
+		}
+
+		result = append(result, meta)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+
+	return result, nil
+}
+
+// RevokeUserSession logs out the session with the id, provided it belongs to the user
+func RevokeUserSession(userID int64, sessionID string) error {
+	meta, err := Sessions.GetMeta(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if meta == nil || meta.UserID != userID {
+		return NewPublicError("Unknown session")
+	}
+
+	err = DeleteSession(meta.token)
+	if err != nil {
+		return err
+	}
+
+	forgetSession(meta.token)
+	return Sessions.DeleteMeta(userID, sessionID)
+}
+
+func currentUserSessions(r *http.Request) ([]*SessionMeta, error) {
+	user := ContextUser(r.Context())
+
+	sessions, err := GetUserSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if token, ok := r.Context().Value(common.ContextKeyYagToken).(string); ok {
+		current := SessionID(token)
+		for _, v := range sessions {
+			v.Current = v.ID == current
+		}
+	}
+
+	return sessions, nil
+}
+
+// HandleGetSessions handles GET /sessions
+func HandleGetSessions(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	_, tmpl := GetCreateTemplateData(r.Context())
+
+	sessions, err := currentUserSessions(r)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["Sessions"] = sessions
+	return tmpl, nil
+}
+
+// HandleGetSessionsJSON handles GET /sessions.json
+func HandleGetSessionsJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	sessions, err := currentUserSessions(r)
+	if err != nil {
+		return err
+	}
+
+	return sessions
+}
+
+// HandleRevokeSession handles POST /sessions/:session/revoke
+func HandleRevokeSession(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	_, tmpl := GetCreateTemplateData(r.Context())
+	tmpl.SetVisibleURL("/sessions")
+
+	user := ContextUser(r.Context())
+	err := RevokeUserSession(user.ID, pat.Param(r, "session"))
+	return tmpl, err
+}
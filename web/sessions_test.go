@@ -0,0 +1,108 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/pubsub"
+	"golang.org/x/oauth2"
+)
+
+func TestSessionID(t *testing.T) {
+	id := SessionID("token")
+	if id == "token" || len(id) != 32 || SessionID("token") != id || SessionID("other") == id {
+		t.Errorf("unexpected session id %q", id)
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	defer func(old SessionStore) { Sessions = old }(Sessions)
+	Sessions = NewMemorySessionStore()
+
+	now := time.Now()
+	Sessions.SaveMeta(&SessionMeta{ID: SessionID("a"), UserID: 1, LastSeen: now.Add(-time.Hour), token: "a"}, time.Hour)
+	Sessions.SaveMeta(&SessionMeta{ID: SessionID("b"), UserID: 1, LastSeen: now, token: "b"}, time.Hour)
+	Sessions.SaveMeta(&SessionMeta{ID: SessionID("c"), UserID: 2, LastSeen: now, token: "c"}, time.Hour)
+	Sessions.CreateSession("a", &oauth2.Token{AccessToken: "a"}, time.Hour)
+
+	sessions, err := GetUserSessions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 2 || sessions[0].token != "b" || sessions[1].token != "a" {
+		t.Fatalf("expected the 2 sessions of the user, most recently used first, got %v", sessions)
+	}
+
+	if err := RevokeUserSession(2, SessionID("a")); err == nil {
+		t.Error("revoked the session of another user")
+	}
+
+	if err := RevokeUserSession(1, SessionID("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, _ := Sessions.GetSession("a"); token != nil {
+		t.Error("the revoked session still exists")
+	}
+
+	if sessions, _ := GetUserSessions(1); len(sessions) != 1 {
+		t.Errorf("expected 1 session left, got %v", sessions)
+	}
+}
+
+func TestTouchSession(t *testing.T) {
+	defer func(old SessionStore) { Sessions = old }(Sessions)
+	Sessions = NewMemorySessionStore()
+
+	defer func(old interface{}) { common.ConfSessionTTL.LoadedValue = old }(common.ConfSessionTTL.LoadedValue)
+	common.ConfSessionTTL.LoadedValue = 1
+
+	Sessions.CreateSession("touched", &oauth2.Token{AccessToken: "a"}, time.Minute)
+	Sessions.SaveMeta(&SessionMeta{ID: SessionID("touched"), UserID: 1, token: "touched"}, time.Minute)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	w := httptest.NewRecorder()
+	if !touchSession(w, r, "touched") {
+		t.Fatal("session reported as gone")
+	}
+
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != "touched" || cookies[0].MaxAge != int(SessionTTL().Seconds()) {
+		t.Errorf("expected the cookie to be extended, got %v", cookies)
+	}
+
+	meta, _ := Sessions.GetMeta(SessionID("touched"))
+	if meta == nil || meta.UserAgent != "test-agent" || meta.LastSeen.IsZero() {
+		t.Errorf("expected the metadata to be updated, got %#v", meta)
+	}
+
+	if touchSession(httptest.NewRecorder(), r, "revoked") {
+		t.Error("a session that doesn't exist was touched")
+	}
+}
+
+func TestSessionRevokedEvent(t *testing.T) {
+	defer func(old SessionStore) { Sessions = old }(Sessions)
+	Sessions = NewMemorySessionStore()
+
+	Sessions.CreateSession("elsewhere", &oauth2.Token{AccessToken: "a"}, time.Minute)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if !touchSession(httptest.NewRecorder(), r, "elsewhere") {
+		t.Fatal("session reported as gone")
+	}
+
+	// revoked by another instance, only the event reaches this one
+	Sessions.DeleteSession("elsewhere")
+	if !touchSession(httptest.NewRecorder(), r, "elsewhere") {
+		t.Fatal("expected the touch to be cached")
+	}
+
+	handleSessionRevoked(&pubsub.Event{EventName: evtSessionRevoked, Data: &sessionRevokedData{SessionID: SessionID("elsewhere")}})
+	if touchSession(httptest.NewRecorder(), r, "elsewhere") {
+		t.Error("the revoked session was still accepted")
+	}
+}
@@ -0,0 +1,223 @@
+package web
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"golang.org/x/oauth2"
+)
+
+var confSessionStore = config.RegisterOption("yagpdb.web.session_store", "Where web sessions are stored: redis, postgres or memory (sessions are lost on restart and not shared between processes, meant for tests and single process setups)", "redis")
+
+// SessionStore stores the sessions of the control panel, along with the metadata shown on the /sessions page.
+// Sessions are identified by their token (the cookie value), the metadata by the SessionID of the token.
+type SessionStore interface {
+	// CreateSession stores a new session that expires after ttl, returning ErrDuplicateToken if the token is already in use
+	CreateSession(yagToken string, token *oauth2.Token, ttl time.Duration) error
+
+	// GetSession returns the discord oauth2 token of the session, or nil if it doesn't exist or expired
+	GetSession(yagToken string) (*oauth2.Token, error)
+
+	// ExtendSession pushes the expiry of the session to ttl from now, returning false if it doesn't exist anymore
+	ExtendSession(yagToken string, ttl time.Duration) (bool, error)
+
+	DeleteSession(yagToken string) error
+
+	// SaveMeta creates or replaces the metadata of a session, which expires after ttl
+	SaveMeta(meta *SessionMeta, ttl time.Duration) error
+
+	// GetMeta returns the metadata of the session, or nil if there is none
+	GetMeta(sessionID string) (*SessionMeta, error)
+
+	// UserSessionIDs returns the ids of the sessions of the user, some of them may have expired already
+	UserSessionIDs(userID int64) ([]string, error)
+
+	DeleteMeta(userID int64, sessionID string) error
+}
+
+// Sessions is the session store in use, selected by yagpdb.web.session_store
+var Sessions SessionStore = &RedisSessionStore{}
+
+func initSessionStore() {
+	switch strings.ToLower(confSessionStore.GetString()) {
+	case "postgres":
+		Sessions = NewPostgresSessionStore()
+	case "memory":
+		Sessions = NewMemorySessionStore()
+	case "redis", "":
+		Sessions = &RedisSessionStore{}
+	default:
+		logger.Errorf("Unknown session store %q, using redis", confSessionStore.GetString())
+		Sessions = &RedisSessionStore{}
+	}
+}
+
+// MemorySessionStore keeps the sessions in memory
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*memorySession
+	meta     map[string]*memorySessionMeta
+}
+
+type memorySession struct {
+	token   oauth2.Token
+	expires time.Time
+}
+
+type memorySessionMeta struct {
+	meta    SessionMeta
+	expires time.Time
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*memorySession),
+		meta:     make(map[string]*memorySessionMeta),
+	}
+}
+
+// getLocked returns the session if it hasn't expired, removing it if it has
+func (m *MemorySessionStore) getLocked(yagToken string) *memorySession {
+	s, ok := m.sessions[yagToken]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(s.expires) {
+		delete(m.sessions, yagToken)
+		return nil
+	}
+
+	return s
+}
+
+func (m *MemorySessionStore) CreateSession(yagToken string, token *oauth2.Token, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.getLocked(yagToken) != nil {
+		return ErrDuplicateToken
+	}
+
+	m.sessions[yagToken] = &memorySession{token: *token, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *MemorySessionStore) GetSession(yagToken string) (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.getLocked(yagToken)
+	if s == nil {
+		return nil, nil
+	}
+
+	t := s.token
+	return &t, nil
+}
+
+func (m *MemorySessionStore) ExtendSession(yagToken string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.getLocked(yagToken)
+	if s == nil {
+		return false, nil
+	}
+
+	s.expires = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (m *MemorySessionStore) DeleteSession(yagToken string) error {
+	m.mu.Lock()
+	delete(m.sessions, yagToken)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemorySessionStore) SaveMeta(meta *SessionMeta, ttl time.Duration) error {
+	m.mu.Lock()
+	m.meta[meta.ID] = &memorySessionMeta{meta: *meta, expires: time.Now().Add(ttl)}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemorySessionStore) GetMeta(sessionID string) (*SessionMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v, ok := m.meta[sessionID]
+	if !ok {
+		return nil, nil
+	}
+
+	if time.Now().After(v.expires) {
+		delete(m.meta, sessionID)
+		return nil, nil
+	}
+
+	meta := v.meta
+	return &meta, nil
+}
+
+func (m *MemorySessionStore) UserSessionIDs(userID int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []string
+	for k, v := range m.meta {
+		if v.meta.UserID == userID {
+			result = append(result, k)
+		}
+	}
+
+	return result, nil
+}
+
+func (m *MemorySessionStore) DeleteMeta(userID int64, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v, ok := m.meta[sessionID]; ok && v.meta.UserID == userID {
+		delete(m.meta, sessionID)
+	}
+
+	return nil
+}
+
+var _ SessionSweeper = (*MemorySessionStore)(nil)
+
+func (m *MemorySessionStore) SweepSessions() (*SessionSweepResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := &SessionSweepResult{}
+	now := time.Now()
+	for k, v := range m.sessions {
+		if now.After(v.expires) {
+			delete(m.sessions, k)
+			result.Sessions++
+			result.removedTokens = append(result.removedTokens, k)
+		}
+	}
+
+	var totalAge time.Duration
+	for k, v := range m.meta {
+		if now.After(v.expires) || m.getLocked(v.meta.token) == nil {
+			delete(m.meta, k)
+			result.Meta++
+			continue
+		}
+
+		result.ActiveSessions++
+		totalAge += now.Sub(v.meta.CreatedAt)
+	}
+
+	result.AverageAge = averageSessionAge(totalAge, result.ActiveSessions)
+	return result, nil
+}
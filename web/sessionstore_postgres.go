@@ -0,0 +1,179 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/lib/pq"
+	"golang.org/x/oauth2"
+)
+
+var sessionStoreSchemas = []string{`
+CREATE TABLE IF NOT EXISTS web_sessions (
+	token TEXT PRIMARY KEY,
+	oauth_token TEXT NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+`, `
+CREATE INDEX IF NOT EXISTS web_sessions_expires_at_idx ON web_sessions(expires_at);
+`, `
+CREATE TABLE IF NOT EXISTS web_session_meta (
+	session_id TEXT PRIMARY KEY,
+	token TEXT NOT NULL,
+	user_id BIGINT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	last_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	application TEXT NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+`, `
+CREATE INDEX IF NOT EXISTS web_session_meta_user_id_idx ON web_session_meta(user_id);
+`}
+
+// PostgresSessionStore keeps the sessions in postgres, for setups where the sessions should survive a redis flush
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+var _ SessionStore = (*PostgresSessionStore)(nil)
+
+func NewPostgresSessionStore() *PostgresSessionStore {
+	common.InitSchemas("web_sessions", sessionStoreSchemas...)
+	return &PostgresSessionStore{db: common.PQ}
+}
+
+func (s *PostgresSessionStore) CreateSession(yagToken string, token *oauth2.Token, ttl time.Duration) error {
+	dataRaw, err := json.Marshal(token)
+	if err != nil {
+		return common.ErrWithCaller(err)
+	}
+
+	// an expired session with the same token can be taken over
+	res, err := s.db.Exec(`INSERT INTO web_sessions (token, oauth_token, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (token) DO UPDATE SET oauth_token = EXCLUDED.oauth_token, expires_at = EXCLUDED.expires_at WHERE web_sessions.expires_at < now()`,
+		yagToken, string(dataRaw), time.Now().Add(ttl))
+	if err != nil {
+		return common.ErrWithCaller(err)
+	}
+
+	if n, _ := res.RowsAffected(); n < 1 {
+		return ErrDuplicateToken
+	}
+
+	return nil
+}
+
+func (s *PostgresSessionStore) GetSession(yagToken string) (*oauth2.Token, error) {
+	var raw string
+	err := s.db.QueryRow("SELECT oauth_token FROM web_sessions WHERE token = $1 AND expires_at > now()", yagToken).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var t *oauth2.Token
+	err = json.Unmarshal([]byte(raw), &t)
+	if err != nil {
+		return nil, common.ErrWithCaller(err)
+	}
+
+	return t, nil
+}
+
+func (s *PostgresSessionStore) ExtendSession(yagToken string, ttl time.Duration) (bool, error) {
+	res, err := s.db.Exec("UPDATE web_sessions SET expires_at = $2 WHERE token = $1 AND expires_at > now()", yagToken, time.Now().Add(ttl))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *PostgresSessionStore) DeleteSession(yagToken string) error {
+	_, err := s.db.Exec("DELETE FROM web_sessions WHERE token = $1", yagToken)
+	return err
+}
+
+func (s *PostgresSessionStore) SaveMeta(meta *SessionMeta, ttl time.Duration) error {
+	_, err := s.db.Exec(`INSERT INTO web_session_meta (session_id, token, user_id, created_at, last_seen, ip, user_agent, application, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (session_id) DO UPDATE SET token = EXCLUDED.token, user_id = EXCLUDED.user_id, created_at = EXCLUDED.created_at, last_seen = EXCLUDED.last_seen,
+ip = EXCLUDED.ip, user_agent = EXCLUDED.user_agent, application = EXCLUDED.application, expires_at = EXCLUDED.expires_at`,
+		meta.ID, meta.token, meta.UserID, meta.CreatedAt, meta.LastSeen, meta.IP, meta.UserAgent, meta.Application, time.Now().Add(ttl))
+	return err
+}
+
+func (s *PostgresSessionStore) GetMeta(sessionID string) (*SessionMeta, error) {
+	meta := &SessionMeta{ID: sessionID}
+	err := s.db.QueryRow(`SELECT token, user_id, created_at, last_seen, ip, user_agent, application FROM web_session_meta WHERE session_id = $1 AND expires_at > now()`, sessionID).
+		Scan(&meta.token, &meta.UserID, &meta.CreatedAt, &meta.LastSeen, &meta.IP, &meta.UserAgent, &meta.Application)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+func (s *PostgresSessionStore) UserSessionIDs(userID int64) ([]string, error) {
+	var ids []string
+	err := s.db.QueryRow("SELECT array_agg(session_id) FROM web_session_meta WHERE user_id = $1", userID).Scan(pq.Array(&ids))
+	return ids, err
+}
+
+func (s *PostgresSessionStore) DeleteMeta(userID int64, sessionID string) error {
+	_, err := s.db.Exec("DELETE FROM web_session_meta WHERE session_id = $1 AND user_id = $2", sessionID, userID)
+	return err
+}
+
+var _ SessionSweeper = (*PostgresSessionStore)(nil)
+
+func (s *PostgresSessionStore) SweepSessions() (*SessionSweepResult, error) {
+	result := &SessionSweepResult{}
+
+	rows, err := s.db.Query("DELETE FROM web_sessions WHERE expires_at < now() RETURNING token")
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		result.Sessions++
+		result.removedTokens = append(result.removedTokens, token)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.Exec(`DELETE FROM web_session_meta WHERE expires_at < now()
+OR NOT EXISTS (SELECT 1 FROM web_sessions WHERE web_sessions.token = web_session_meta.token)`)
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := res.RowsAffected()
+	result.Meta = int(n)
+
+	var avgSeconds float64
+	err = s.db.QueryRow("SELECT count(*), COALESCE(avg(extract(epoch FROM now() - created_at)), 0) FROM web_session_meta").Scan(&result.ActiveSessions, &avgSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	result.AverageAge = time.Duration(avgSeconds * float64(time.Second))
+	return result, nil
+}
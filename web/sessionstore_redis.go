@@ -0,0 +1,303 @@
+package web
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/mediocregopher/radix/v3"
+	"golang.org/x/oauth2"
+)
+
+// RedisSessionStore is the default session store, keeping the sessions in redis with their ttl as the key expiry
+type RedisSessionStore struct{}
+
+var _ SessionStore = (*RedisSessionStore)(nil)
+
+func keyWebSession(yagToken string) string {
+	return "web_session:" + yagToken
+}
+
+func keySessionMeta(sessionID string) string {
+	return "web_session_meta:" + sessionID
+}
+
+func keyUserSessions(userID int64) string {
+	return "web_user_sessions:" + strconv.FormatInt(userID, 10)
+}
+
+func ttlSeconds(ttl time.Duration) string {
+	return strconv.Itoa(int(ttl.Seconds()))
+}
+
+func (s *RedisSessionStore) CreateSession(yagToken string, token *oauth2.Token, ttl time.Duration) error {
+	dataRaw, err := json.Marshal(token)
+	if err != nil {
+		return common.ErrWithCaller(err)
+	}
+
+	var didSet string
+	err = common.RedisPool.Do(radix.Cmd(&didSet, "SET", keyWebSession(yagToken), string(dataRaw), "EX", ttlSeconds(ttl), "NX"))
+	if err != nil {
+		return common.ErrWithCaller(err)
+	}
+
+	if didSet != "OK" {
+		return ErrDuplicateToken
+	}
+
+	return nil
+}
+
+func (s *RedisSessionStore) GetSession(yagToken string) (*oauth2.Token, error) {
+	var raw string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "GET", keyWebSession(yagToken)))
+	if err != nil {
+		return nil, err
+	}
+
+	if raw == "" {
+		// sessions created before session ttl's were introduced still live in the old hash
+		err = common.RedisPool.Do(radix.Cmd(&raw, "HGET", "web_sessions", yagToken))
+		if err != nil {
+			return nil, err
+		}
+
+		if raw == "" {
+			return nil, nil
+		}
+	}
+
+	var t *oauth2.Token
+	err = json.Unmarshal([]byte(raw), &t)
+	if err != nil {
+		return nil, common.ErrWithCaller(err)
+	}
+
+	return t, nil
+}
+
+func (s *RedisSessionStore) ExtendSession(yagToken string, ttl time.Duration) (bool, error) {
+	var extended bool
+	err := common.RedisPool.Do(radix.Cmd(&extended, "EXPIRE", keyWebSession(yagToken), ttlSeconds(ttl)))
+	if err != nil || extended {
+		return extended, err
+	}
+
+	// move sessions from the old hash over so they can expire
+	var raw string
+	err = common.RedisPool.Do(radix.Cmd(&raw, "HGET", "web_sessions", yagToken))
+	if err != nil || raw == "" {
+		return false, err
+	}
+
+	err = common.MultipleCmds(
+		radix.Cmd(nil, "SET", keyWebSession(yagToken), raw, "EX", ttlSeconds(ttl)),
+		radix.Cmd(nil, "HDEL", "web_sessions", yagToken),
+	)
+	return err == nil, err
+}
+
+func (s *RedisSessionStore) DeleteSession(yagToken string) error {
+	return common.MultipleCmds(
+		radix.Cmd(nil, "DEL", keyWebSession(yagToken)),
+		radix.Cmd(nil, "HDEL", "web_sessions", yagToken),
+	)
+}
+
+func (s *RedisSessionStore) SaveMeta(meta *SessionMeta, ttl time.Duration) error {
+	cmds := []radix.CmdAction{
+		radix.FlatCmd(nil, "HSET", keySessionMeta(meta.ID),
+			"token", meta.token,
+			"user_id", meta.UserID,
+			"created_at", meta.CreatedAt.Unix(),
+			"last_seen", meta.LastSeen.Unix(),
+			"ip", meta.IP,
+			"ua", meta.UserAgent,
+			"app", meta.Application),
+		radix.Cmd(nil, "EXPIRE", keySessionMeta(meta.ID), ttlSeconds(ttl)),
+	}
+
+	if meta.UserID != 0 {
+		cmds = append(cmds,
+			radix.FlatCmd(nil, "ZADD", keyUserSessions(meta.UserID), meta.LastSeen.Unix(), meta.ID),
+			radix.Cmd(nil, "EXPIRE", keyUserSessions(meta.UserID), ttlSeconds(ttl)))
+	}
+
+	return common.MultipleCmds(cmds...)
+}
+
+func (s *RedisSessionStore) GetMeta(sessionID string) (*SessionMeta, error) {
+	var raw map[string]string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGETALL", keySessionMeta(sessionID)))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	userID, _ := strconv.ParseInt(raw["user_id"], 10, 64)
+	createdAt, _ := strconv.ParseInt(raw["created_at"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(raw["last_seen"], 10, 64)
+
+	return &SessionMeta{
+		ID:          sessionID,
+		UserID:      userID,
+		CreatedAt:   time.Unix(createdAt, 0),
+		LastSeen:    time.Unix(lastSeen, 0),
+		IP:          raw["ip"],
+		UserAgent:   raw["ua"],
+		Application: raw["app"],
+		token:       raw["token"],
+	}, nil
+}
+
+func (s *RedisSessionStore) UserSessionIDs(userID int64) ([]string, error) {
+	var ids []string
+	err := common.RedisPool.Do(radix.Cmd(&ids, "ZRANGE", keyUserSessions(userID), "0", "-1"))
+	return ids, errors.WithStackIf(err)
+}
+
+func (s *RedisSessionStore) DeleteMeta(userID int64, sessionID string) error {
+	return common.MultipleCmds(
+		radix.Cmd(nil, "DEL", keySessionMeta(sessionID)),
+		radix.Cmd(nil, "ZREM", keyUserSessions(userID), sessionID),
+	)
+}
+
+var _ SessionSweeper = (*RedisSessionStore)(nil)
+
+// SweepSessions removes the sessions in the old hash whose discord token expired long ago, metadata of sessions that
+// are gone and user session index entries pointing to metadata that's gone
+func (s *RedisSessionStore) SweepSessions() (*SessionSweepResult, error) {
+	result := &SessionSweepResult{}
+
+	err := s.sweepLegacySessions(result)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sweepMeta(result)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sweepUserIndexes(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// sweepLegacySessions cleans up the hash sessions were kept in before they had a ttl, those never expire on their own
+// and are only moved out when used again
+func (s *RedisSessionStore) sweepLegacySessions(result *SessionSweepResult) error {
+	deadline := time.Now().Add(-SessionTTL())
+
+	scanner := radix.NewScanner(common.RedisPool, radix.ScanOpts{Command: "HSCAN", Key: "web_sessions", Count: 1000})
+
+	// HSCAN returns the field followed by the value
+	var field, value string
+	for scanner.Next(&field) {
+		if !scanner.Next(&value) {
+			break
+		}
+
+		var t *oauth2.Token
+		if err := json.Unmarshal([]byte(value), &t); err == nil && (t.Expiry.IsZero() || t.Expiry.After(deadline)) {
+			continue
+		}
+
+		err := common.RedisPool.Do(radix.Cmd(nil, "HDEL", "web_sessions", field))
+		if err != nil {
+			scanner.Close()
+			return errors.WithStackIf(err)
+		}
+
+		result.Sessions++
+		result.removedTokens = append(result.removedTokens, field)
+	}
+
+	return errors.WithStackIf(scanner.Close())
+}
+
+func (s *RedisSessionStore) sweepMeta(result *SessionSweepResult) error {
+	now := time.Now()
+	var totalAge time.Duration
+
+	scanner := radix.NewScanner(common.RedisPool, radix.ScanOpts{Command: "SCAN", Pattern: keySessionMeta("*"), Count: 1000})
+
+	var key string
+	for scanner.Next(&key) {
+		sessionID := strings.TrimPrefix(key, keySessionMeta(""))
+		meta, err := s.GetMeta(sessionID)
+		if err != nil {
+			scanner.Close()
+			return err
+		}
+
+		if meta == nil {
+			// expired in the meantime
+			continue
+		}
+
+		token, err := s.GetSession(meta.token)
+		if err != nil {
+			scanner.Close()
+			return err
+		}
+
+		if token != nil {
+			result.ActiveSessions++
+			totalAge += now.Sub(meta.CreatedAt)
+			continue
+		}
+
+		err = s.DeleteMeta(meta.UserID, sessionID)
+		if err != nil {
+			scanner.Close()
+			return err
+		}
+
+		result.Meta++
+	}
+
+	result.AverageAge = averageSessionAge(totalAge, result.ActiveSessions)
+	return errors.WithStackIf(scanner.Close())
+}
+
+func (s *RedisSessionStore) sweepUserIndexes(result *SessionSweepResult) error {
+	scanner := radix.NewScanner(common.RedisPool, radix.ScanOpts{Command: "SCAN", Pattern: "web_user_sessions:*", Count: 1000})
+
+	var key string
+	for scanner.Next(&key) {
+		var ids []string
+		err := common.RedisPool.Do(radix.Cmd(&ids, "ZRANGE", key, "0", "-1"))
+		if err != nil {
+			scanner.Close()
+			return errors.WithStackIf(err)
+		}
+
+		for _, id := range ids {
+			var exists bool
+			err = common.RedisPool.Do(radix.Cmd(&exists, "EXISTS", keySessionMeta(id)))
+			if err == nil && !exists {
+				err = common.RedisPool.Do(radix.Cmd(nil, "ZREM", key, id))
+				result.IndexEntries++
+			}
+
+			if err != nil {
+				scanner.Close()
+				return errors.WithStackIf(err)
+			}
+		}
+	}
+
+	return errors.WithStackIf(scanner.Close())
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore()
+
+	err := store.CreateSession("a", &oauth2.Token{AccessToken: "token-a"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CreateSession("a", &oauth2.Token{AccessToken: "other"}, time.Hour); err != ErrDuplicateToken {
+		t.Errorf("expected ErrDuplicateToken, got %v", err)
+	}
+
+	token, err := store.GetSession("a")
+	if err != nil || token == nil || token.AccessToken != "token-a" {
+		t.Fatalf("unexpected session %#v, %v", token, err)
+	}
+
+	if token, _ := store.GetSession("b"); token != nil {
+		t.Errorf("got a session for an unknown token")
+	}
+
+	// expired sessions are gone and can't be extended
+	store.CreateSession("expired", &oauth2.Token{AccessToken: "x"}, -time.Second)
+	if token, _ := store.GetSession("expired"); token != nil {
+		t.Errorf("got an expired session")
+	}
+
+	if ok, _ := store.ExtendSession("expired", time.Hour); ok {
+		t.Errorf("extended an expired session")
+	}
+
+	if ok, _ := store.ExtendSession("a", time.Hour); !ok {
+		t.Errorf("failed extending session")
+	}
+
+	store.DeleteSession("a")
+	if token, _ := store.GetSession("a"); token != nil {
+		t.Errorf("session still exists after deleting it")
+	}
+}
+
+func TestMemorySessionStoreMeta(t *testing.T) {
+	store := NewMemorySessionStore()
+
+	store.SaveMeta(&SessionMeta{ID: "1", UserID: 10, IP: "127.0.0.1", token: "a"}, time.Hour)
+	store.SaveMeta(&SessionMeta{ID: "2", UserID: 10}, time.Hour)
+	store.SaveMeta(&SessionMeta{ID: "3", UserID: 20}, time.Hour)
+
+	meta, err := store.GetMeta("1")
+	if err != nil || meta == nil || meta.IP != "127.0.0.1" || meta.token != "a" {
+		t.Fatalf("unexpected meta %#v, %v", meta, err)
+	}
+
+	ids, _ := store.UserSessionIDs(10)
+	if len(ids) != 2 {
+		t.Errorf("expected 2 sessions for the user, got %v", ids)
+	}
+
+	// someone else's session is left alone
+	store.DeleteMeta(20, "1")
+	if meta, _ := store.GetMeta("1"); meta == nil {
+		t.Errorf("meta deleted by another user")
+	}
+
+	store.DeleteMeta(10, "1")
+	if meta, _ := store.GetMeta("1"); meta != nil {
+		t.Errorf("meta still exists after deleting it")
+	}
+}
+
+func TestMemorySessionStoreSweep(t *testing.T) {
+	store := NewMemorySessionStore()
+
+	store.CreateSession("a", &oauth2.Token{AccessToken: "a"}, time.Hour)
+	store.CreateSession("expired", &oauth2.Token{AccessToken: "x"}, -time.Second)
+	store.SaveMeta(&SessionMeta{ID: "1", UserID: 10, CreatedAt: time.Now().Add(-time.Hour), token: "a"}, time.Hour)
+	store.SaveMeta(&SessionMeta{ID: "2", UserID: 10, token: "expired"}, time.Hour)
+	store.SaveMeta(&SessionMeta{ID: "3", UserID: 20, token: "logged-out"}, time.Hour)
+
+	result, err := store.SweepSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Sessions != 1 || len(result.removedTokens) != 1 || result.removedTokens[0] != "expired" {
+		t.Errorf("expected the expired session to be removed, got %#v", result)
+	}
+
+	if result.Meta != 2 || result.ActiveSessions != 1 {
+		t.Errorf("expected 2 orphaned metadata and 1 active session, got %#v", result)
+	}
+
+	if result.AverageAge < time.Hour || result.AverageAge > time.Hour+time.Minute {
+		t.Errorf("unexpected average age %s", result.AverageAge)
+	}
+
+	if ids, _ := store.UserSessionIDs(10); len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("unexpected remaining sessions %v", ids)
+	}
+}
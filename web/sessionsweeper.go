@@ -0,0 +1,108 @@
+package web
+
+import (
+	"context"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/lifecycle"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confSessionSweepInterval = config.RegisterOption("yagpdb.web.session_sweep_interval", "Minutes between sweeps removing orphaned sessions and session metadata, 0 to disable", 60)
+
+	metricsSessionsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "yagpdb_web_sessions_active",
+		Help: "Active control panel sessions as of the last session sweep",
+	})
+
+	metricsSessionsAverageAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "yagpdb_web_sessions_average_age_seconds",
+		Help: "Average age of the active control panel sessions as of the last session sweep",
+	})
+
+	metricsSessionsSwept = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_web_sessions_swept_total",
+		Help: "Orphaned or expired session data removed by the session sweeper",
+	}, []string{"kind"})
+)
+
+// SessionSweepResult is what a session sweep removed, along with stats about the sessions left
+type SessionSweepResult struct {
+	// Sessions are auth tokens without a ttl or past their expiry
+	Sessions int
+	// Meta is session metadata whose session is gone
+	Meta int
+	// IndexEntries are entries in the per user session indexes pointing to metadata that's gone
+	IndexEntries int
+
+	ActiveSessions int
+	AverageAge     time.Duration
+
+	// removedTokens are the tokens of removed sessions, their locally cached discord sessions are evicted
+	removedTokens []string
+}
+
+// SessionSweeper is implemented by session stores that leave data behind that the ttl's don't take care of
+type SessionSweeper interface {
+	SweepSessions() (*SessionSweepResult, error)
+}
+
+// averageSessionAge returns the average of the ages, 0 if there are none
+func averageSessionAge(total time.Duration, count int) time.Duration {
+	if count < 1 {
+		return 0
+	}
+
+	return total / time.Duration(count)
+}
+
+func runSessionSweeper(ctx context.Context) {
+	for {
+		interval := time.Minute * time.Duration(confSessionSweepInterval.GetInt())
+		if interval <= 0 {
+			return
+		}
+
+		if !lifecycle.Sleep(ctx, interval) {
+			return
+		}
+		sweepSessions(interval)
+	}
+}
+
+func sweepSessions(interval time.Duration) {
+	sweeper, ok := Sessions.(SessionSweeper)
+	if !ok {
+		return
+	}
+
+	// only one of the webservers needs to do it
+	locked, err := common.TryLockRedisKey("web_session_sweeper_lock", int(interval.Seconds()))
+	if err != nil || !locked {
+		return
+	}
+
+	started := time.Now()
+	result, err := sweeper.SweepSessions()
+	if err != nil {
+		logger.WithError(err).Error("failed sweeping sessions")
+		return
+	}
+
+	for _, v := range result.removedTokens {
+		forgetSession(v)
+	}
+
+	metricsSessionsSwept.WithLabelValues("session").Add(float64(result.Sessions))
+	metricsSessionsSwept.WithLabelValues("meta").Add(float64(result.Meta))
+	metricsSessionsSwept.WithLabelValues("index").Add(float64(result.IndexEntries))
+	metricsSessionsActive.Set(float64(result.ActiveSessions))
+	metricsSessionsAverageAge.Set(result.AverageAge.Seconds())
+
+	logger.WithField("elapsed", time.Since(started)).Infof("Swept sessions: removed %d sessions, %d metadata and %d index entries, %d sessions active",
+		result.Sessions, result.Meta, result.IndexEntries, result.ActiveSessions)
+}
@@ -0,0 +1,389 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/web/configcode"
+	"github.com/mediocregopher/radix/v3"
+	"goji.io/pat"
+)
+
+const (
+	shareLinkKeyRedisKey  = "web_share_link_key"
+	maxShareLinkHours     = 24 * 7
+	maxShareLinksPerGuild = 25
+)
+
+var (
+	panelLogKeyShareLinkCreated = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "share_link_created",
+		FormatString: "Created a share link to the %s settings",
+	})
+	panelLogKeyShareLinkRevoked = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+		Key:          "share_link_revoked",
+		FormatString: "Revoked a share link to the %s settings",
+	})
+)
+
+// ShareLink is a time limited link to a read only snapshot of the settings of a plugin on a server,
+// to get help without sharing screenshots
+type ShareLink struct {
+	ID        string    `json:"id"`
+	GuildID   int64     `json:"guild_id,string"`
+	Plugin    string    `json:"plugin"`
+	CreatedBy int64     `json:"created_by,string"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func keyShareLink(id string) string {
+	return "web_share_link:" + id
+}
+
+func keyGuildShareLinks(guildID int64) string {
+	return "web_guild_share_links:" + discordgo.StrID(guildID)
+}
+
+var (
+	shareLinkKey   []byte
+	shareLinkKeyMU sync.Mutex
+)
+
+// getShareLinkKey returns the key used to sign share links, it's shared between all web nodes through redis
+func getShareLinkKey() ([]byte, error) {
+	shareLinkKeyMU.Lock()
+	defer shareLinkKeyMU.Unlock()
+
+	if shareLinkKey != nil {
+		return shareLinkKey, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	err := common.RedisPool.Do(radix.Cmd(nil, "SET", shareLinkKeyRedisKey, hex.EncodeToString(b), "NX"))
+	if err != nil {
+		return nil, err
+	}
+
+	var stored string
+	err = common.RedisPool.Do(radix.Cmd(&stored, "GET", shareLinkKeyRedisKey))
+	if err != nil {
+		return nil, err
+	}
+
+	shareLinkKey, err = hex.DecodeString(stored)
+	return shareLinkKey, err
+}
+
+// signShareLink creates the token of the link in the format of "<guild>.<plugin>.<expires unix>.<id>.<signature>",
+// the scope is part of the signed payload so it can't be changed to another server or plugin
+func signShareLink(key []byte, link *ShareLink) string {
+	payload := fmt.Sprintf("%d.%s.%d.%s", link.GuildID, link.Plugin, link.ExpiresAt.Unix(), link.ID)
+	return payload + "." + signChallenge(key, payload)
+}
+
+// parseShareLinkToken verifies the signature and expiry of the token, returning nil if it's invalid
+func parseShareLinkToken(key []byte, token string, now time.Time) *ShareLink {
+	split := strings.Split(token, ".")
+	if len(split) != 5 {
+		return nil
+	}
+
+	payload := strings.Join(split[:4], ".")
+	if !hmac.Equal([]byte(signChallenge(key, payload)), []byte(split[4])) {
+		return nil
+	}
+
+	guildID, err := strconv.ParseInt(split[0], 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	expires, err := strconv.ParseInt(split[2], 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return nil
+	}
+
+	return &ShareLink{
+		GuildID:   guildID,
+		Plugin:    split[1],
+		ExpiresAt: time.Unix(expires, 0),
+		ID:        split[3],
+	}
+}
+
+// ShareLinkURL returns the url of the link, only available right after creating it as the token is not stored
+func ShareLinkURL(token string) string {
+	return BaseURL() + "/share/" + token
+}
+
+// CreateShareLink creates a link to the settings of the plugin valid for the duration, returning the token of it
+func CreateShareLink(guildID, userID int64, plugin string, validFor time.Duration) (string, *ShareLink, error) {
+	if findConfigCodePlugin(plugin) == nil {
+		return "", nil, NewPublicError("Unknown plugin")
+	}
+
+	key, err := getShareLinkKey()
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	links, err := GetGuildShareLinks(guildID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(links) >= maxShareLinksPerGuild {
+		return "", nil, NewPublicError("There can only be ", maxShareLinksPerGuild, " active share links, revoke one first")
+	}
+
+	link := &ShareLink{
+		ID:        RandBase64(12), // url safe and without dots, 12 bytes leave no padding
+		GuildID:   guildID,
+		Plugin:    plugin,
+		CreatedBy: userID,
+		ExpiresAt: time.Now().Add(validFor).Truncate(time.Second),
+	}
+
+	serialized, err := json.Marshal(link)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	err = common.MultipleCmds(
+		radix.FlatCmd(nil, "SET", keyShareLink(link.ID), serialized, "EX", int(validFor.Seconds())+1),
+		radix.FlatCmd(nil, "ZADD", keyGuildShareLinks(guildID), link.ExpiresAt.Unix(), link.ID),
+	)
+	if err != nil {
+		return "", nil, errors.WithStackIf(err)
+	}
+
+	return signShareLink(key, link), link, nil
+}
+
+// GetGuildShareLinks returns the active share links of the guild, expiring first
+func GetGuildShareLinks(guildID int64) ([]*ShareLink, error) {
+	var ids []string
+	err := common.MultipleCmds(
+		radix.FlatCmd(nil, "ZREMRANGEBYSCORE", keyGuildShareLinks(guildID), "-inf", time.Now().Unix()),
+		radix.Cmd(&ids, "ZRANGE", keyGuildShareLinks(guildID), "0", "-1"),
+	)
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	result := make([]*ShareLink, 0, len(ids))
+	for _, id := range ids {
+		link, err := getShareLink(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if link != nil {
+			result = append(result, link)
+		}
+	}
+
+	return result, nil
+}
+
+func getShareLink(id string) (*ShareLink, error) {
+	var raw []byte
+	err := common.RedisPool.Do(radix.Cmd(&raw, "GET", keyShareLink(id)))
+	if err != nil || len(raw) == 0 {
+		return nil, errors.WithStackIf(err)
+	}
+
+	var link *ShareLink
+	err = json.Unmarshal(raw, &link)
+	return link, errors.WithStackIf(err)
+}
+
+// RevokeShareLink revokes the link before it expires, returning nil if it didn't exist
+func RevokeShareLink(guildID int64, id string) (*ShareLink, error) {
+	link, err := getShareLink(id)
+	if err != nil || link == nil || link.GuildID != guildID {
+		return nil, err
+	}
+
+	err = common.MultipleCmds(
+		radix.Cmd(nil, "DEL", keyShareLink(id)),
+		radix.Cmd(nil, "ZREM", keyGuildShareLinks(guildID), id),
+	)
+	return link, errors.WithStackIf(err)
+}
+
+// ShareLinkMW validates the signature, expiry and scope of the share link token in the url,
+// and that it hasn't been revoked, rejecting the request otherwise
+func ShareLinkMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := getShareLinkKey()
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed retrieving share link key")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		parsed := parseShareLinkToken(key, pat.Param(r, "token"), time.Now())
+		if parsed == nil {
+			http.Error(w, "This link is invalid or has expired", http.StatusNotFound)
+			return
+		}
+
+		stored, err := getShareLink(parsed.ID)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed retrieving share link")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if stored == nil || stored.GuildID != parsed.GuildID || stored.Plugin != parsed.Plugin {
+			http.Error(w, "This link has been revoked", http.StatusNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), common.ContextKeyShareLink, stored)
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// HandleShareLink handles GET /share/:token, showing the snapshot of the settings the link is for
+func HandleShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	link := ctx.Value(common.ContextKeyShareLink).(*ShareLink)
+
+	p := findConfigCodePlugin(link.Plugin)
+	if p == nil {
+		http.Error(w, "This plugin is no longer available", http.StatusNotFound)
+		return
+	}
+
+	form, err := p.ExportConfigCode(ctx, link.GuildID)
+	var attrs map[string]interface{}
+	if err == nil {
+		attrs, err = configcode.Encode(form)
+	}
+
+	if err != nil {
+		CtxLogger(ctx).WithError(err).WithField("guild", link.GuildID).Error("failed exporting shared settings")
+		http.Error(w, "Failed retrieving the settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	fmt.Fprintf(w, "# Read only snapshot of the %s settings of server %d, this link expires at %s\n\n",
+		link.Plugin, link.GuildID, link.ExpiresAt.UTC().Format(time.RFC1123))
+	io.WriteString(w, configcode.Format(&configcode.Document{Blocks: []*configcode.Block{{Name: link.Plugin, Attributes: attrs}}}))
+}
+
+type CreateShareLinkForm struct {
+	Plugin string `valid:",1,100"`
+	Hours  int    `valid:"1,168"`
+}
+
+// HandleGetShareLinks handles GET /manage/:server/share_links
+func HandleGetShareLinks(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	g, tmpl := GetBaseCPContextData(r.Context())
+
+	links, err := GetGuildShareLinks(g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	var plugins []string
+	for _, v := range configCodePlugins() {
+		plugins = append(plugins, v.ConfigCodeName())
+	}
+
+	tmpl["ShareLinks"] = links
+	tmpl["ShareLinkPlugins"] = plugins
+	tmpl["MaxShareLinkHours"] = maxShareLinkHours
+	return tmpl, nil
+}
+
+func createShareLinkFromForm(ctx context.Context, form *CreateShareLinkForm) (string, *ShareLink, error) {
+	g := ContextGuild(ctx)
+	token, link, err := CreateShareLink(g.ID, ContextUser(ctx).ID, form.Plugin, time.Hour*time.Duration(form.Hours))
+	if err != nil {
+		return "", nil, err
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyShareLinkCreated, &cplogs.Param{Type: cplogs.ParamTypeString, Value: link.Plugin}))
+	return ShareLinkURL(token), link, nil
+}
+
+// HandleCreateShareLink handles POST /manage/:server/share_links/new
+func HandleCreateShareLink(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/share_links")
+
+	url, _, err := createShareLinkFromForm(ctx, ctx.Value(common.ContextKeyParsedForm).(*CreateShareLinkForm))
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["NewShareLinkURL"] = url
+	return tmpl, nil
+}
+
+// ShareLinkResponse is the response of the share link issuance api
+type ShareLinkResponse struct {
+	URL       string     `json:"url"`
+	ShareLink *ShareLink `json:"share_link"`
+}
+
+// HandleCreateShareLinkJSON handles POST /manage/:server/share_links.json, taking the same fields as the form
+func HandleCreateShareLinkJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+
+	hours, _ := strconv.Atoi(r.FormValue("hours"))
+	if hours < 1 || hours > maxShareLinkHours {
+		return NewPublicError("hours has to be between 1 and ", maxShareLinkHours)
+	}
+
+	url, link, err := createShareLinkFromForm(ctx, &CreateShareLinkForm{Plugin: r.FormValue("plugin"), Hours: hours})
+	if err != nil {
+		return err
+	}
+
+	return &ShareLinkResponse{URL: url, ShareLink: link}
+}
+
+// HandleRevokeShareLink handles POST /manage/:server/share_links/:link/revoke
+func HandleRevokeShareLink(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/share_links")
+
+	link, err := RevokeShareLink(g.ID, pat.Param(r, "link"))
+	if err != nil {
+		return tmpl, err
+	}
+
+	if link == nil {
+		return tmpl, NewPublicError("Unknown share link")
+	}
+
+	go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyShareLinkRevoked, &cplogs.Param{Type: cplogs.ParamTypeString, Value: link.Plugin}))
+	return tmpl, nil
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLinkToken(t *testing.T) {
+	key := []byte("test key")
+	now := time.Unix(1600000000, 0)
+	link := &ShareLink{ID: "abc", GuildID: 123, Plugin: "core", ExpiresAt: now.Add(time.Hour)}
+
+	token := signShareLink(key, link)
+	parsed := parseShareLinkToken(key, token, now)
+	if parsed == nil {
+		t.Fatal("valid token rejected")
+	}
+
+	if parsed.ID != link.ID || parsed.GuildID != link.GuildID || parsed.Plugin != link.Plugin || !parsed.ExpiresAt.Equal(link.ExpiresAt) {
+		t.Errorf("parsed %#v, expected %#v", parsed, link)
+	}
+
+	if parseShareLinkToken(key, token, now.Add(time.Hour)) != nil {
+		t.Error("expired token accepted")
+	}
+
+	if parseShareLinkToken([]byte("other key"), token, now) != nil {
+		t.Error("token signed with another key accepted")
+	}
+
+	// changing the scope invalidates the signature
+	tampered := strings.Replace(token, "123.core.", "456.core.", 1)
+	if parseShareLinkToken(key, tampered, now) != nil {
+		t.Error("token with a changed guild accepted")
+	}
+
+	tampered = strings.Replace(token, ".core.", ".logs.", 1)
+	if parseShareLinkToken(key, tampered, now) != nil {
+		t.Error("token with a changed plugin accepted")
+	}
+
+	if parseShareLinkToken(key, "garbage", now) != nil {
+		t.Error("garbage accepted")
+	}
+}
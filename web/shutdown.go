@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/natefinch/lumberjack"
+)
+
+var confShutdownTimeout = config.RegisterOption("yagpdb.web.shutdown_timeout", "Seconds to wait for the requests being handled to finish when shutting down", 25)
+
+var (
+	// requests currently being handled, including hijacked connections until their handler returns
+	inFlightRequests int64
+
+	activeServers   []*http.Server
+	activeServersMu sync.Mutex
+
+	// set if request logging is enabled, flushed on shutdown
+	accessLogWriter *lumberjack.Logger
+)
+
+// InFlightMiddleware counts the requests being handled, so shutting down can wait for them
+func InFlightMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&inFlightRequests, 1)
+		defer atomic.AddInt64(&inFlightRequests, -1)
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// InFlightRequests returns the amount of requests currently being handled
+func InFlightRequests() int64 {
+	return atomic.LoadInt64(&inFlightRequests)
+}
+
+func trackServer(srv *http.Server) {
+	activeServersMu.Lock()
+	activeServers = append(activeServers, srv)
+	activeServersMu.Unlock()
+}
+
+// waitForInFlight waits until there are no requests being handled or the deadline passes, returns how many were left
+func waitForInFlight(deadline time.Time, pollInterval time.Duration) int64 {
+	for {
+		n := InFlightRequests()
+		if n <= 0 || !time.Now().Before(deadline) {
+			return n
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Shutdown drains the webserver: new requests are rejected with a 503 so load balancers move traffic elsewhere, the
+// requests already being handled get until yagpdb.web.shutdown_timeout to finish, then the servers are closed and
+// the access log is flushed
+func Shutdown(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	Stop()
+	deadline := time.Now().Add(time.Duration(confShutdownTimeout.GetInt()) * time.Second)
+
+	logger.Infof("Waiting for %d in flight requests", InFlightRequests())
+	if left := waitForInFlight(deadline, time.Millisecond*100); left > 0 {
+		logger.Warnf("Gave up waiting for %d in flight requests", left)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	activeServersMu.Lock()
+	servers := activeServers
+	activeServersMu.Unlock()
+
+	for _, srv := range servers {
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			logger.WithError(err).Warn("Failed shutting down the webserver gracefully, closing it")
+			srv.Close()
+		}
+	}
+
+	if accessLogWriter != nil {
+		if err := accessLogWriter.Close(); err != nil {
+			logger.WithError(err).Error("Failed flushing the access log")
+		}
+	}
+
+	logger.Info("Webserver shut down")
+}
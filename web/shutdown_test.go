@@ -0,0 +1,47 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInFlightMiddleware(t *testing.T) {
+	var during int64
+	handler := InFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = InFlightRequests()
+	}))
+
+	before := InFlightRequests()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if during != before+1 {
+		t.Errorf("expected %d requests in flight while handling, got %d", before+1, during)
+	}
+
+	if after := InFlightRequests(); after != before {
+		t.Errorf("expected %d requests in flight after handling, got %d", before, after)
+	}
+}
+
+func TestWaitForInFlight(t *testing.T) {
+	release := make(chan bool)
+	handler := InFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	for InFlightRequests() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if left := waitForInFlight(time.Now().Add(time.Millisecond*20), time.Millisecond); left != 1 {
+		t.Errorf("expected 1 request left after the deadline, got %d", left)
+	}
+
+	close(release)
+	if left := waitForInFlight(time.Now().Add(time.Second), time.Millisecond); left != 0 {
+		t.Errorf("expected no requests left, got %d", left)
+	}
+}
@@ -0,0 +1,209 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+// discord's epoch, the time snowflakes are counted from
+const discordEpochMS = 1420070400000
+
+var (
+	simulatedUserMentionRegex = regexp.MustCompile(`<@!?(\d+)>`)
+	simulatedRoleMentionRegex = regexp.MustCompile(`<@&(\d+)>`)
+)
+
+// SimulateEventForm describes the hypothetical event and the member it's from
+type SimulateEventForm struct {
+	Type    string
+	Channel int64   `valid:"channel,true"`
+	Content string  `valid:",2000"`
+	Roles   []int64 `valid:"role,true"`
+
+	// Username overrides the name of the member, defaults to the admin's own
+	Username       string `valid:",32"`
+	AccountAgeDays int    `valid:"0,"`
+	MemberAgeDays  int    `valid:"0,"`
+}
+
+// snowflakeAt returns the smallest snowflake created at t, e.g for a member with a account of a certain age
+func snowflakeAt(t time.Time) int64 {
+	ms := t.UnixNano()/int64(time.Millisecond) - discordEpochMS
+	if ms < 0 {
+		ms = 0
+	}
+
+	return ms << 22
+}
+
+// parseSimulatedMentions returns the users and roles mentioned in the content
+func parseSimulatedMentions(content string) (users []*discordgo.User, roles []int64) {
+	for _, m := range simulatedUserMentionRegex.FindAllStringSubmatch(content, -1) {
+		id, _ := strconv.ParseInt(m[1], 10, 64)
+		users = append(users, &discordgo.User{ID: id})
+	}
+
+	for _, m := range simulatedRoleMentionRegex.FindAllStringSubmatch(content, -1) {
+		id, _ := strconv.ParseInt(m[1], 10, 64)
+		roles = append(roles, id)
+	}
+
+	return users, roles
+}
+
+// buildSimulatedEvent creates the hypothetical event from the form, the member is the admin unless overridden
+func buildSimulatedEvent(gs *dstate.GuildSet, user *discordgo.User, form *SimulateEventForm) (*SimulatedEvent, error) {
+	now := time.Now()
+
+	u := *user
+	u.ID = snowflakeAt(now.AddDate(0, 0, -form.AccountAgeDays))
+	u.Bot = false
+	if form.Username != "" {
+		u.Username = form.Username
+	}
+
+	joinedAt := now
+	if form.Type == SimulatedEventMessage {
+		joinedAt = now.AddDate(0, 0, -form.MemberAgeDays)
+	}
+
+	member := &discordgo.Member{
+		GuildID:  gs.ID,
+		User:     &u,
+		JoinedAt: discordgo.Timestamp(joinedAt.Format(time.RFC3339)),
+		Roles:    form.Roles,
+	}
+
+	evt := &SimulatedEvent{
+		Type:   form.Type,
+		GS:     gs,
+		Member: dstate.MemberStateFromMember(member),
+	}
+
+	switch form.Type {
+	case SimulatedEventJoin:
+	case SimulatedEventMessage:
+		evt.Channel = gs.GetChannelOrThread(form.Channel)
+		if evt.Channel == nil {
+			return nil, NewPublicError("Select the channel the message is sent in")
+		}
+
+		if strings.TrimSpace(form.Content) == "" {
+			return nil, NewPublicError("The message can't be empty")
+		}
+
+		mentions, mentionRoles := parseSimulatedMentions(form.Content)
+		evt.Message = &discordgo.Message{
+			ID:              snowflakeAt(now),
+			ChannelID:       evt.Channel.ID,
+			GuildID:         gs.ID,
+			Content:         form.Content,
+			Timestamp:       discordgo.Timestamp(now.Format(time.RFC3339)),
+			Author:          &u,
+			Member:          member,
+			Mentions:        mentions,
+			MentionRoles:    mentionRoles,
+			MentionEveryone: strings.Contains(form.Content, "@everyone") || strings.Contains(form.Content, "@here"),
+		}
+	default:
+		return nil, NewPublicError("Unknown event type")
+	}
+
+	return evt, nil
+}
+
+// SimulateEvent asks every plugin what they would do in response to the event, plugins failing are listed as skipped
+func SimulateEvent(ctx context.Context, evt *SimulatedEvent) []*SimulatedAction {
+	var result []*SimulatedAction
+	for _, v := range common.Plugins {
+		p, ok := v.(PluginWithEventSimulation)
+		if !ok {
+			continue
+		}
+
+		actions, err := p.SimulateEvent(ctx, evt)
+		if err != nil {
+			CtxLogger(ctx).WithError(err).WithField("plugin", v.PluginInfo().SysName).Error("failed simulating event")
+			result = append(result, &SimulatedAction{Plugin: v.PluginInfo().Name, Description: "Failed simulating this plugin", Skipped: true})
+			continue
+		}
+
+		result = append(result, actions...)
+	}
+
+	return result
+}
+
+// HandleGetSimulate handles GET /manage/:server/simulate
+func HandleGetSimulate(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	_, tmpl := GetBaseCPContextData(r.Context())
+	if _, ok := tmpl["SimulatedEvent"]; !ok {
+		tmpl["SimulatedEvent"] = &SimulateEventForm{Type: SimulatedEventMessage}
+	}
+
+	return tmpl, nil
+}
+
+// HandlePostSimulate handles POST /manage/:server/simulate
+func HandlePostSimulate(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*SimulateEventForm)
+	tmpl["SimulatedEvent"] = form
+
+	evt, err := buildSimulatedEvent(g, ContextUser(ctx), form)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["SimulatedActions"] = SimulateEvent(ctx, evt)
+	tmpl["Simulated"] = true
+	return tmpl, nil
+}
+
+// HandleSimulateJSON handles POST /manage/:server/simulate.json, the api version of the simulator
+func HandleSimulateJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	ctx := r.Context()
+	g := ContextGuild(ctx)
+
+	form := &SimulateEventForm{
+		Type:     r.FormValue("type"),
+		Content:  r.FormValue("content"),
+		Username: r.FormValue("username"),
+	}
+	form.Channel, _ = strconv.ParseInt(r.FormValue("channel"), 10, 64)
+	form.AccountAgeDays, _ = strconv.Atoi(r.FormValue("account_age_days"))
+	form.MemberAgeDays, _ = strconv.Atoi(r.FormValue("member_age_days"))
+	for _, v := range r.Form["roles"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return NewPublicError("Invalid role ", v)
+		}
+		form.Roles = append(form.Roles, id)
+	}
+
+	if len(form.Content) > 2000 || len(form.Username) > 32 || form.AccountAgeDays < 0 || form.MemberAgeDays < 0 {
+		return NewPublicError("Invalid event")
+	}
+
+	evt, err := buildSimulatedEvent(g, ContextUser(ctx), form)
+	if err != nil {
+		return err
+	}
+
+	actions := SimulateEvent(ctx, evt)
+	if actions == nil {
+		actions = []*SimulatedAction{}
+	}
+
+	return actions
+}
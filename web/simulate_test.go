@@ -0,0 +1,33 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnowflakeAt(t *testing.T) {
+	at := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	id := snowflakeAt(at)
+
+	// the timestamp is stored in the top 42 bits, in ms since the discord epoch
+	got := time.Unix(0, ((id>>22)+discordEpochMS)*int64(time.Millisecond)).UTC()
+	if !got.Equal(at) {
+		t.Errorf("snowflakeAt(%s) = %d, which is created at %s", at, id, got)
+	}
+
+	if id := snowflakeAt(time.Unix(0, 0)); id != 0 {
+		t.Errorf("snowflakeAt before the discord epoch = %d, expected 0", id)
+	}
+}
+
+func TestParseSimulatedMentions(t *testing.T) {
+	users, roles := parseSimulatedMentions("thanks <@105487308693757952> and <@!204255221017214977>, ping <@&330000000000000000> @everyone")
+
+	if len(users) != 2 || users[0].ID != 105487308693757952 || users[1].ID != 204255221017214977 {
+		t.Errorf("unexpected user mentions: %v", users)
+	}
+
+	if len(roles) != 1 || roles[0] != 330000000000000000 {
+		t.Errorf("unexpected role mentions: %v", roles)
+	}
+}
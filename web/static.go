@@ -0,0 +1,132 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long versioned asset urls (see assetURL) are cached for, they never change
+const assetCacheControl = "public, max-age=31536000, immutable"
+
+type staticFileHash struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// staticFileHashes caches the content hashes by file name, they're recomputed if the size or modification time changes
+var staticFileHashes sync.Map
+
+// staticFileHandler serves the static files with strong etags and a last modified time, conditional
+// requests (If-None-Match, If-Modified-Since) and ranges are handled by http.ServeContent
+func staticFileHandler(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+
+		stat, err := f.Stat()
+		if err != nil || stat.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			CtxLogger(r.Context()).Errorf("static file %s is not seekable", name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		hash, err := contentHash(name, stat, content)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed hashing static file")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// embedded files don't have a modification time, they only change with a new build
+		modTime := stat.ModTime()
+		if modTime.IsZero() {
+			modTime = StartedAt
+		}
+
+		if v := r.URL.Query().Get("v"); v != "" && v == assetVersion(hash) {
+			w.Header().Set("Cache-Control", assetCacheControl)
+		}
+
+		w.Header().Set("ETag", `"`+hash+`"`)
+		http.ServeContent(w, r, stat.Name(), modTime, content)
+	})
+}
+
+// contentHash returns the hash of the file, content is rewound after reading it
+func contentHash(name string, stat fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if v, ok := staticFileHashes.Load(name); ok {
+		cached := v.(*staticFileHash)
+		if cached.size == stat.Size() && cached.modTime.Equal(stat.ModTime()) {
+			return cached.hash, nil
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil)[:16])
+	staticFileHashes.Store(name, &staticFileHash{size: stat.Size(), modTime: stat.ModTime(), hash: hash})
+	return hash, nil
+}
+
+func assetVersion(hash string) string {
+	return hash[:12]
+}
+
+// assetURL is the "asset" template func, it adds the content hash of a static file to its url, e.g
+// {{asset "/static/css/custom.css"}} -> /static/css/custom.css?v=3f2a9c01b7d4, so it can be cached
+// until it changes. Files that can't be read are returned as is.
+func assetURL(p string) string {
+	name := strings.TrimPrefix(path.Clean(p), "/")
+
+	f, err := StaticFilesFS.Open(name)
+	if err != nil {
+		logger.WithError(err).Errorf("unknown asset %s", p)
+		return p
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return p
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return p
+	}
+
+	hash, err := contentHash(name, stat, content)
+	if err != nil {
+		logger.WithError(err).Errorf("failed hashing asset %s", p)
+		return p
+	}
+
+	return p + "?v=" + assetVersion(hash)
+}
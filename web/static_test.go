@@ -0,0 +1,88 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticFileHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static/css/style.css": &fstest.MapFile{Data: []byte("body{}")},
+	}
+	handler := staticFileHandler(fsys)
+
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := serve("/static/css/style.css", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != 200 || first.Body.String() != "body{}" || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("unexpected response: %d %q %v", first.Code, first.Body.String(), first.Header())
+	}
+
+	if w := serve("/static/css/style.css", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("expected a matching etag to return 304, got %d", w.Code)
+	}
+
+	if w := serve("/static/css/style.css", map[string]string{"If-None-Match": `"other"`}); w.Code != 200 || w.Header().Get("ETag") != etag {
+		t.Errorf("expected a different etag to return the file with the same etag, got %d", w.Code)
+	}
+
+	since := StartedAt.Add(time.Second).UTC().Format(http.TimeFormat)
+	if w := serve("/static/css/style.css", map[string]string{"If-Modified-Since": since}); w.Code != http.StatusNotModified {
+		t.Errorf("expected an unmodified file to return 304, got %d", w.Code)
+	}
+
+	for _, v := range []string{"/static/missing.css", "/static/css", "/static/../static/css/"} {
+		if w := serve(v, nil); w.Code != http.StatusNotFound {
+			t.Errorf("expected %s to return 404, got %d", v, w.Code)
+		}
+	}
+}
+
+func TestAssetURL(t *testing.T) {
+	orig := StaticFilesFS
+	defer func() {
+		StaticFilesFS = orig
+	}()
+
+	fsys := fstest.MapFS{
+		"static/js/custom.js": &fstest.MapFile{Data: []byte("console.log(1)")},
+	}
+	StaticFilesFS = fsys
+
+	url := assetURL("/static/js/custom.js")
+	if !strings.HasPrefix(url, "/static/js/custom.js?v=") {
+		t.Fatalf("expected a versioned url, got %q", url)
+	}
+
+	if missing := assetURL("/static/js/missing.js"); missing != "/static/js/missing.js" {
+		t.Errorf("expected unknown assets to be returned as is, got %q", missing)
+	}
+
+	handler := staticFileHandler(fsys)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Header().Get("Cache-Control") != assetCacheControl {
+		t.Errorf("expected versioned urls to be cached, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/static/js/custom.js?v=outdated", nil))
+	if w.Header().Get("Cache-Control") != "" {
+		t.Errorf("expected outdated versions not to be cached, got %q", w.Header().Get("Cache-Control"))
+	}
+}
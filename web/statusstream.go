@@ -0,0 +1,134 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+var confStreamRequestTimeout = config.RegisterOption("yagpdb.web.stream_request_timeout", "Seconds a event stream like /status/stream stays open before the browser has to reconnect, 0 disables it", 600)
+
+const (
+	// the full status is cached for 5 seconds, checking more often doesn't find anything new
+	statusStreamInterval = time.Second * 5
+	// a comment is sent this often when nothing changed so proxies don't close the stream as idle
+	statusStreamKeepalive = time.Second * 30
+)
+
+// statusStreamsClosed is closed on shutdown, ending the streams so they don't hold it up
+var statusStreamsClosed = make(chan struct{})
+
+func runStatusStreamShutdown(ctx context.Context) {
+	<-ctx.Done()
+	close(statusStreamsClosed)
+}
+
+// BotLiveStatus is the summary of the bot status sent by /status/stream
+type BotLiveStatus struct {
+	Running         bool    `json:"running"`
+	TotalShards     int     `json:"total_shards"`
+	OfflineShards   []int   `json:"offline_shards"`
+	LatencyMS       int64   `json:"latency_ms"`
+	EventsPerSecond float64 `json:"events_per_second"`
+}
+
+// botLiveStatus summarizes the status, it's not running if the status couldn't be retrieved or all shards are offline
+func botLiveStatus(status *BotStatus) *BotLiveStatus {
+	if status == nil {
+		return &BotLiveStatus{OfflineShards: []int{}}
+	}
+
+	live := &BotLiveStatus{
+		Running:         status.NumNodes > 0 && len(status.OfflineShards) < status.TotalShards,
+		TotalShards:     status.TotalShards,
+		OfflineShards:   status.OfflineShards,
+		EventsPerSecond: status.EventsPerSecondAverage,
+	}
+
+	if live.OfflineShards == nil {
+		live.OfflineShards = []int{}
+	}
+
+	// the latency is the average time between a heartbeat and its ack, of the shards that are connected
+	var total time.Duration
+	n := 0
+	for _, host := range status.HostStatuses {
+		for _, node := range host.Nodes {
+			for _, shard := range node.Shards {
+				if shard.ConnStatus != discordgo.GatewayStatusReady || shard.LastHeartbeatAck.Before(shard.LastHeartbeatSend) {
+					continue
+				}
+
+				total += shard.LastHeartbeatAck.Sub(shard.LastHeartbeatSend)
+				n++
+			}
+		}
+	}
+
+	if n > 0 {
+		live.LatencyMS = (total / time.Duration(n)).Milliseconds()
+	}
+
+	return live
+}
+
+// HandleStatusStream handles GET /status/stream, a server-sent event stream with a status event whenever the status
+// of the bot changes
+func HandleStatusStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses by default, which would hold the events back
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// the browser reconnects by itself when the stream ends, this is how long it waits
+	fmt.Fprintf(w, "retry: %d\n\n", statusStreamInterval.Milliseconds())
+
+	ticker := time.NewTicker(statusStreamInterval)
+	defer ticker.Stop()
+
+	var last []byte
+	lastWrite := time.Now()
+	for {
+		status, statusErr := getFullBotStatus()
+		encoded, err := json.Marshal(botLiveStatus(status))
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed encoding bot status")
+			return
+		}
+
+		if !bytes.Equal(encoded, last) {
+			// only logged when it changes what's shown, the stream checks every couple seconds
+			if statusErr != nil {
+				CtxLogger(r.Context()).WithError(statusErr).Error("failed retrieving bot status for the status stream")
+			}
+
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", encoded)
+			last = encoded
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= statusStreamKeepalive {
+			fmt.Fprint(w, ": keepalive\n\n")
+			lastWrite = time.Now()
+		}
+		flusher.Flush()
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		case <-statusStreamsClosed:
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/bot/botrest"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestBotLiveStatus(t *testing.T) {
+	now := time.Now()
+	status := &BotStatus{
+		NumNodes:      1,
+		TotalShards:   3,
+		OfflineShards: []int{2},
+		HostStatuses: []*HostStatus{{Nodes: []*botrest.NodeStatus{{Shards: []*botrest.ShardStatus{
+			{ShardID: 0, ConnStatus: discordgo.GatewayStatusReady, LastHeartbeatSend: now, LastHeartbeatAck: now.Add(time.Millisecond * 100)},
+			{ShardID: 1, ConnStatus: discordgo.GatewayStatusReady, LastHeartbeatSend: now, LastHeartbeatAck: now.Add(time.Millisecond * 50)},
+			// waiting for the ack of the last heartbeat
+			{ShardID: 2, ConnStatus: discordgo.GatewayStatusReady, LastHeartbeatSend: now, LastHeartbeatAck: now.Add(-time.Second)},
+		}}}}},
+	}
+
+	live := botLiveStatus(status)
+	if !live.Running || live.LatencyMS != 75 || len(live.OfflineShards) != 1 {
+		t.Errorf("unexpected status %+v", live)
+	}
+
+	status.OfflineShards = []int{0, 1, 2}
+	if botLiveStatus(status).Running {
+		t.Error("expected the bot to not be running with all shards offline")
+	}
+
+	if live := botLiveStatus(nil); live.Running || live.OfflineShards == nil {
+		t.Errorf("unexpected status without a bot status %+v", live)
+	}
+}
+
+func TestHandleStatusStream(t *testing.T) {
+	botStatusCacheL.Lock()
+	cachedBotStatus = &BotStatus{NumNodes: 1, TotalShards: 1}
+	botStatusCacheT = time.Now()
+	botStatusCacheL.Unlock()
+	defer func() {
+		botStatusCacheL.Lock()
+		cachedBotStatus, botStatusCacheT = nil, time.Time{}
+		botStatusCacheL.Unlock()
+	}()
+
+	// the stream ends once the first status is sent, as the request is already cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	HandleStatusStream(w, httptest.NewRequest("GET", "/status/stream", nil).WithContext(ctx))
+
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+
+	expected := "retry: 5000\n\nevent: status\ndata: {\"running\":true,\"total_shards\":1,\"offline_shards\":[],\"latency_ms\":0,\"events_per_second\":0}\n\n"
+	if body := w.Body.String(); !strings.HasPrefix(body, expected) {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,169 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+	"golang.org/x/oauth2"
+)
+
+var confStepUpTTL = config.RegisterOption("yagpdb.web.step_up_ttl", "Minutes an identity confirmation through discord is valid for, before destructive actions require it again", 10)
+
+func keyStepUp(sessionID string) string {
+	return "web_stepup:" + sessionID
+}
+
+type stepUpState struct {
+	SessionID string
+	UserID    int64
+}
+
+func stepUpTTL() time.Duration {
+	return time.Minute * time.Duration(confStepUpTTL.GetInt())
+}
+
+// HasRecentStepUp returns true if the current session confirmed their identity recently
+func HasRecentStepUp(r *http.Request) (bool, error) {
+	yagToken, ok := r.Context().Value(common.ContextKeyYagToken).(string)
+	if !ok || yagToken == "" {
+		return false, nil
+	}
+
+	var exists bool
+	err := common.RedisPool.Do(radix.Cmd(&exists, "EXISTS", keyStepUp(SessionID(yagToken))))
+	return exists, err
+}
+
+var stepUpRequiredHandler = RenderHandler(nil, "cp_step_up")
+
+// RequireStepUp requires the user to have recently confirmed their identity through discord,
+// destructive actions that can't be undone should use this
+func RequireStepUp(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, err := HasRecentStepUp(r)
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed checking step up")
+		}
+
+		if ok {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if ContextAPIKey(r.Context()) != nil || ContextGuildToken(r.Context()) != nil {
+			http.Error(w, "This action can't be performed using an API key", http.StatusForbidden)
+			return
+		}
+
+		stepUpURL := "/stepup?goto=" + url.QueryEscape(stepUpReturnURL(r))
+		if r.URL.Query().Get("alertsonly") == "1" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			LogIgnoreErr(json.NewEncoder(w).Encode([]*Alert{ErrorAlert("This action requires you to confirm your identity first at ", BaseURL()+stepUpURL)}))
+			return
+		}
+
+		ctx, tmpl := GetCreateTemplateData(r.Context())
+		tmpl["StepUpURL"] = stepUpURL
+		tmpl["StepUpTTL"] = confStepUpTTL.GetInt()
+		stepUpRequiredHandler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// stepUpReturnURL returns the page the user should be sent back to after confirming their identity
+func stepUpReturnURL(r *http.Request) string {
+	if r.Method == "GET" {
+		return r.URL.Path
+	}
+
+	// we can't replay a post, so send them back to the page they made it from
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Path != "" && (ref.Host == "" || ref.Host == r.Host) {
+		return ref.Path
+	}
+
+	return "/manage"
+}
+
+// HandleStepUp sends the user through discord's oauth flow again to confirm their identity
+func HandleStepUp(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	yagToken, _ := ctx.Value(common.ContextKeyYagToken).(string)
+	user, _ := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	if yagToken == "" || user == nil {
+		http.Redirect(w, r, "/login?goto="+url.QueryEscape(r.RequestURI), http.StatusTemporaryRedirect)
+		return
+	}
+
+	redir := r.FormValue("goto")
+	if !isLocalRedirect(redir) {
+		redir = "/manage"
+	}
+
+	st := &oauthState{
+		Goto: redir,
+		StepUp: &stepUpState{
+			SessionID: SessionID(yagToken),
+			UserID:    user.ID,
+		},
+	}
+
+	// prompt=consent makes discord show the authorization screen even though they already authorized us before
+	authURL, err := startOAuthFlow(w, ContextApplication(ctx), st, oauth2.SetAuthURLParam("prompt", "consent"))
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("Failed starting step up oauth flow")
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+// handleStepUpCallback finishes a step up, the session that started it has to be the one finishing it
+func handleStepUpCallback(w http.ResponseWriter, r *http.Request, st *oauthState) {
+	ctx := r.Context()
+
+	yagToken, _ := ctx.Value(common.ContextKeyYagToken).(string)
+	if yagToken == "" || SessionID(yagToken) != st.StepUp.SessionID {
+		CtxLogger(ctx).Warn("Step up finished from a different session than it was started from")
+		http.Redirect(w, r, "/?error=stepupfailed", http.StatusTemporaryRedirect)
+		return
+	}
+
+	token, err := exchangeOAuthCode(r, st)
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("oauthConf.Exchange() failed during step up")
+		http.Redirect(w, r, "/?error=oauth2failure", http.StatusTemporaryRedirect)
+		return
+	}
+
+	session, err := discordgo.New(token.Type() + " " + token.AccessToken)
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("Failed creating session during step up")
+		http.Redirect(w, r, "/?error=stepupfailed", http.StatusTemporaryRedirect)
+		return
+	}
+
+	user, err := session.UserMe()
+	if err != nil || user.ID != st.StepUp.UserID {
+		// they logged in to a different discord account
+		CtxLogger(ctx).WithError(err).Warn("Step up failed, different user or unable to fetch it")
+		http.Redirect(w, r, "/?error=stepupfailed", http.StatusTemporaryRedirect)
+		return
+	}
+
+	err = common.RedisPool.Do(radix.Cmd(nil, "SET", keyStepUp(st.StepUp.SessionID), "1", "EX", strconv.Itoa(int(stepUpTTL().Seconds()))))
+	if err != nil {
+		CtxLogger(ctx).WithError(err).Error("Failed storing step up")
+		http.Redirect(w, r, "/?error=stepupfailed", http.StatusTemporaryRedirect)
+		return
+	}
+
+	http.Redirect(w, r, st.Goto, http.StatusTemporaryRedirect)
+}
@@ -0,0 +1,101 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+func TestIsLocalRedirect(t *testing.T) {
+	cases := map[string]bool{
+		"/manage":              true,
+		"/manage/1/core?a=b":   true,
+		"/":                    true,
+		"":                     false,
+		"manage":               false,
+		"//evil.com":           false,
+		"/\\evil.com":          false,
+		"/\\/evil.com":         false,
+		"/manage\\..\\x":       false,
+		"https://evil.com":     false,
+		"/\t/evil.com":         false,
+		"/%0a/evil.com":        true, // stays encoded in the path
+		"javascript:alert(1)":  false,
+		"/javascript:alert(1)": true,
+	}
+
+	for target, expected := range cases {
+		if got := isLocalRedirect(target); got != expected {
+			t.Errorf("%q: got %t, expected %t", target, got, expected)
+		}
+	}
+}
+
+func TestStepUpReturnURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/manage/1/core?x=1", nil)
+	if got := stepUpReturnURL(r); got != "/manage/1/core" {
+		t.Errorf("got %q for a get request", got)
+	}
+
+	cases := map[string]string{
+		"":                                  "/manage",
+		"https://example.com/manage/1/core": "/manage/1/core",
+		"https://evil.com/manage/1/core":    "/manage",
+		"/manage/1/logs":                    "/manage/1/logs",
+	}
+
+	for referer, expected := range cases {
+		r := httptest.NewRequest("POST", "https://example.com/manage/1/core/delete", nil)
+		r.Header.Set("Referer", referer)
+		if got := stepUpReturnURL(r); got != expected {
+			t.Errorf("referer %q: got %q, expected %q", referer, got, expected)
+		}
+	}
+}
+
+func TestRequireStepUp(t *testing.T) {
+	called := false
+	handler := RequireStepUp(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	// keys can't confirm anything through discord
+	for _, key := range []interface{}{common.ContextKeyAPIKey, common.ContextKeyGuildToken} {
+		var value interface{} = &APIKey{ID: "abc"}
+		if key == common.ContextKeyGuildToken {
+			value = &GuildToken{ID: "abc"}
+		}
+
+		r := httptest.NewRequest("POST", "/manage/1/core/delete", nil)
+		r = r.WithContext(context.WithValue(r.Context(), key, value))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if called || w.Code != http.StatusForbidden {
+			t.Errorf("%v: expected 403 without calling the handler, got %d", key, w.Code)
+		}
+	}
+
+	// sessions without a recent step up are sent through it, back to the page they came from
+	r := httptest.NewRequest("POST", "/manage/1/core/delete?alertsonly=1", nil)
+	r.Header.Set("Referer", "/manage/1/core")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if called || w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "/stepup?goto=%2Fmanage%2F1%2Fcore") {
+		t.Errorf("expected a alert linking to the step up, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleStepUpLoggedOut(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleStepUp(w, httptest.NewRequest("GET", "/stepup?goto=/manage", nil))
+
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/login?goto=%2Fstepup%3Fgoto%3D%2Fmanage" {
+		t.Errorf("expected a redirect to the login, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,349 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/common/mqueue"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/web/configcode"
+)
+
+var confStorageQuota = config.RegisterOption("yagpdb.web.storage_quota", "Soft limit of the storage (in bytes) a server should use, shown in the storage usage report. 0 to disable", 0)
+
+var panelLogKeyStoragePurged = cplogs.RegisterActionFormat(&cplogs.ActionFormat{
+	Key:          "storage_purged",
+	FormatString: "Purged stored data: %s",
+})
+
+// PluginStorageUsage is the storage used by a single plugin
+type PluginStorageUsage struct {
+	Plugin  string `json:"plugin"`
+	SysName string `json:"sys_name"`
+
+	// ConfigBytes is the size of the settings of the plugin, as exported through config code
+	ConfigBytes int64              `json:"config_bytes"`
+	Categories  []*StorageCategory `json:"categories"`
+}
+
+// TotalBytes returns the size of the settings and all the categories combined
+func (p *PluginStorageUsage) TotalBytes() int64 {
+	total := p.ConfigBytes
+	for _, v := range p.Categories {
+		total += v.Bytes
+	}
+
+	return total
+}
+
+// StorageReport is the storage used by a guild across all plugins
+type StorageReport struct {
+	Plugins []*PluginStorageUsage `json:"plugins"`
+
+	TotalBytes     int64 `json:"total_bytes"`
+	PurgeableBytes int64 `json:"purgeable_bytes"`
+
+	// QuotaBytes is 0 if there is no quota configured
+	QuotaBytes   int64 `json:"quota_bytes"`
+	QuotaPercent int   `json:"quota_percent"`
+	OverQuota    bool  `json:"over_quota"`
+}
+
+// storageQuotaUsage returns how much of the quota is used in percent, capped at 999
+func storageQuotaUsage(used, quota int64) (percent int, over bool) {
+	if quota <= 0 {
+		return 0, false
+	}
+
+	p := used * 100 / quota
+	if p > 999 {
+		p = 999
+	}
+
+	return int(p), used > quota
+}
+
+// storageCategoryID is how a category is referred to in the cleanup wizard
+func storageCategoryID(sysName, key string) string {
+	return sysName + ":" + key
+}
+
+// parseStorageCategoryID is the reverse of storageCategoryID
+func parseStorageCategoryID(id string) (sysName, key string, ok bool) {
+	i := strings.Index(id, ":")
+	if i < 1 || i == len(id)-1 {
+		return "", "", false
+	}
+
+	return id[:i], id[i+1:], true
+}
+
+func configCodeSize(ctx context.Context, p PluginWithConfigCode, guildID int64) (int64, error) {
+	form, err := p.ExportConfigCode(ctx, guildID)
+	if err != nil {
+		return 0, err
+	}
+
+	attrs, err := configcode.Encode(form)
+	if err != nil {
+		return 0, err
+	}
+
+	formatted := configcode.Format(&configcode.Document{Blocks: []*configcode.Block{{Name: p.ConfigCodeName(), Attributes: attrs}}})
+	return int64(len(formatted)), nil
+}
+
+// GetStorageReport computes the storage used by the guild, plugins without settings or stored data are left out
+func GetStorageReport(ctx context.Context, guildID int64) (*StorageReport, error) {
+	report := &StorageReport{
+		QuotaBytes: int64(confStorageQuota.GetInt()),
+	}
+
+	for _, v := range common.Plugins {
+		usage := &PluginStorageUsage{
+			Plugin:     v.PluginInfo().Name,
+			SysName:    v.PluginInfo().SysName,
+			Categories: make([]*StorageCategory, 0),
+		}
+
+		if p, ok := v.(PluginWithConfigCode); ok {
+			size, err := configCodeSize(ctx, p, guildID)
+			if err != nil {
+				return nil, err
+			}
+			usage.ConfigBytes = size
+		}
+
+		if p, ok := v.(PluginWithStorageUsage); ok {
+			categories, err := p.StorageUsage(ctx, guildID)
+			if err != nil {
+				return nil, err
+			}
+			usage.Categories = append(usage.Categories, categories...)
+		}
+
+		if usage.ConfigBytes == 0 && len(usage.Categories) < 1 {
+			continue
+		}
+
+		for _, c := range usage.Categories {
+			if c.Purgeable {
+				report.PurgeableBytes += c.Bytes
+			}
+		}
+
+		report.TotalBytes += usage.TotalBytes()
+		report.Plugins = append(report.Plugins, usage)
+	}
+
+	sort.SliceStable(report.Plugins, func(i, j int) bool {
+		return report.Plugins[i].TotalBytes() > report.Plugins[j].TotalBytes()
+	})
+
+	report.QuotaPercent, report.OverQuota = storageQuotaUsage(report.TotalBytes, report.QuotaBytes)
+	return report, nil
+}
+
+// findStorageCategory returns the category with the id from the report, or nil if there's none
+func (s *StorageReport) findStorageCategory(id string) (*PluginStorageUsage, *StorageCategory) {
+	sysName, key, ok := parseStorageCategoryID(id)
+	if !ok {
+		return nil, nil
+	}
+
+	for _, p := range s.Plugins {
+		if p.SysName != sysName {
+			continue
+		}
+
+		for _, c := range p.Categories {
+			if c.Key == key {
+				return p, c
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func findStoragePlugin(sysName string) PluginWithStorageUsage {
+	for _, v := range common.Plugins {
+		if p, ok := v.(PluginWithStorageUsage); ok && v.PluginInfo().SysName == sysName {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// StoragePurgeSelection is a category selected in the cleanup wizard
+type StoragePurgeSelection struct {
+	ID       string
+	Plugin   string
+	Category *StorageCategory
+}
+
+// selectedStorageCategories returns the purgeable categories among ids, unknown ones are skipped
+func selectedStorageCategories(report *StorageReport, ids []string) []*StoragePurgeSelection {
+	var result []*StoragePurgeSelection
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		p, c := report.findStorageCategory(id)
+		if c == nil || !c.Purgeable {
+			continue
+		}
+
+		result = append(result, &StoragePurgeSelection{ID: id, Plugin: p.Plugin, Category: c})
+	}
+
+	return result
+}
+
+// HandleGetStorage handles GET /manage/:server/storage, the categories selected in the first step of the
+// cleanup wizard are passed in the purge parameter and shown for confirmation
+func HandleGetStorage(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+
+	report, err := GetStorageReport(ctx, g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	tmpl["StorageReport"] = report
+
+	if ids := r.URL.Query()["purge"]; len(ids) > 0 {
+		selected := selectedStorageCategories(report, ids)
+		if len(selected) < 1 {
+			tmpl.AddAlerts(WarningAlert("Select at least one category to clean up"))
+			return tmpl, nil
+		}
+
+		var freed int64
+		for _, v := range selected {
+			freed += v.Category.Bytes
+		}
+
+		tmpl["ConfirmPurge"] = selected
+		tmpl["ConfirmPurgeBytes"] = freed
+		tmpl["ConfirmPurgeQuotaPercent"], _ = storageQuotaUsage(report.TotalBytes-freed, report.QuotaBytes)
+	}
+
+	return tmpl, nil
+}
+
+// HandleGetStorageJSON handles GET /manage/:server/storage.json
+func HandleGetStorageJSON(w http.ResponseWriter, r *http.Request) interface{} {
+	report, err := GetStorageReport(r.Context(), ContextGuild(r.Context()).ID)
+	if err != nil {
+		return err
+	}
+
+	return report
+}
+
+type PurgeStorageForm struct {
+	Categories []string
+}
+
+// HandlePurgeStorage handles POST /manage/:server/storage/purge, the last step of the cleanup wizard
+func HandlePurgeStorage(w http.ResponseWriter, r *http.Request) (TemplateData, error) {
+	ctx := r.Context()
+	g, tmpl := GetBaseCPContextData(ctx)
+	tmpl.SetVisibleURL("/manage/" + discordgo.StrID(g.ID) + "/storage")
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*PurgeStorageForm)
+
+	report, err := GetStorageReport(ctx, g.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	selected := selectedStorageCategories(report, form.Categories)
+	if len(selected) < 1 {
+		return tmpl, NewPublicError("Nothing to clean up, the selected categories are gone or can't be purged")
+	}
+
+	var purged []string
+	for _, v := range selected {
+		sysName, key, _ := parseStorageCategoryID(v.ID)
+		p := findStoragePlugin(sysName)
+		if p == nil {
+			continue
+		}
+
+		count, err := p.PurgeStorage(ctx, g.ID, key)
+		if err != nil {
+			return tmpl, err
+		}
+
+		purged = append(purged, v.Plugin+" "+v.Category.Name)
+		tmpl.AddAlerts(SucessAlert("Deleted ", count, " item(s) from ", v.Plugin, ": ", v.Category.Name))
+	}
+
+	if len(purged) > 0 {
+		go cplogs.RetryAddEntry(NewLogEntryFromContext(ctx, panelLogKeyStoragePurged, &cplogs.Param{Type: cplogs.ParamTypeString, Value: strings.Join(purged, ", ")}))
+	}
+
+	return tmpl, nil
+}
+
+var _ PluginWithStorageUsage = (*ControlPanelPlugin)(nil)
+
+func (p *ControlPanelPlugin) StorageUsage(ctx context.Context, guildID int64) ([]*StorageCategory, error) {
+	logs := &StorageCategory{
+		Key:         "panel_logs",
+		Name:        "Control panel logs",
+		Description: "Changes made through the control panel, kept for auditing",
+		Retention:   "Until the server is removed",
+	}
+
+	const query = `SELECT count(*), COALESCE(sum(pg_column_size(panel_logs.*)), 0) FROM panel_logs WHERE guild_id=$1`
+	err := common.PQ.QueryRowContext(ctx, query, guildID).Scan(&logs.Items, &logs.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	branding, err := mqueue.GetWebhookBranding(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	avatar := &StorageCategory{
+		Key:         "webhook_avatar",
+		Name:        "Webhook avatar",
+		Description: "The uploaded avatar of the webhooks the bot posts through",
+		Bytes:       int64(len(branding.Avatar)),
+		Retention:   "Until removed",
+		Purgeable:   true,
+	}
+	if branding.Avatar != "" {
+		avatar.Items = 1
+	}
+
+	return []*StorageCategory{logs, avatar}, nil
+}
+
+func (p *ControlPanelPlugin) PurgeStorage(ctx context.Context, guildID int64, category string) (int64, error) {
+	if category != "webhook_avatar" {
+		return 0, NewPublicError("This data can't be purged")
+	}
+
+	branding, err := mqueue.GetWebhookBranding(guildID)
+	if err != nil || branding.Avatar == "" {
+		return 0, err
+	}
+
+	branding.Avatar = ""
+	return 1, mqueue.SaveWebhookBranding(branding)
+}
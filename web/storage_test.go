@@ -0,0 +1,53 @@
+package web
+
+import "testing"
+
+func TestStorageQuotaUsage(t *testing.T) {
+	cases := []struct {
+		used, quota int64
+		percent     int
+		over        bool
+	}{
+		{100, 0, 0, false},
+		{50, 200, 25, false},
+		{200, 200, 100, false},
+		{300, 200, 150, true},
+		{1 << 40, 1, 999, true},
+	}
+
+	for _, c := range cases {
+		percent, over := storageQuotaUsage(c.used, c.quota)
+		if percent != c.percent || over != c.over {
+			t.Errorf("storageQuotaUsage(%d, %d) = %d, %v, expected %d, %v", c.used, c.quota, percent, over, c.percent, c.over)
+		}
+	}
+}
+
+func TestParseStorageCategoryID(t *testing.T) {
+	sysName, key, ok := parseStorageCategoryID(storageCategoryID("logs", "message_logs"))
+	if !ok || sysName != "logs" || key != "message_logs" {
+		t.Errorf("unexpected result: %q %q %v", sysName, key, ok)
+	}
+
+	for _, id := range []string{"", "logs", ":message_logs", "logs:"} {
+		if _, _, ok := parseStorageCategoryID(id); ok {
+			t.Errorf("%q: expected it to be invalid", id)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:       "0 B",
+		1023:    "1023 B",
+		1536:    "1.5 KiB",
+		5 << 20: "5.0 MiB",
+		3 << 50: "3072.0 TiB",
+	}
+
+	for n, expected := range cases {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("formatBytes(%d) = %q, expected %q", n, got, expected)
+		}
+	}
+}
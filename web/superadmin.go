@@ -0,0 +1,119 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/natefinch/lumberjack"
+)
+
+var confSuperadminAuditLog = config.RegisterOption("yagpdb.web.superadmin_audit_log", "File the requests of bot owners using their superadmin access to control panels are logged to", "superadmin_audit.log")
+
+var (
+	superadminAuditLogger   *lumberjack.Logger
+	superadminAuditLoggerMU sync.Mutex
+)
+
+type superadminAuditEntry struct {
+	Time      time.Time `json:"time"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	GuildID   int64     `json:"guild_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	IP        string    `json:"ip"`
+	Status    int       `json:"status"`
+	UserAgent string    `json:"user_agent"`
+
+	// SupportView is set for support staff viewing a server in read only mode instead of bot owners
+	SupportView bool `json:"support_view,omitempty"`
+}
+
+func writeSuperadminAuditEntry(entry *superadminAuditEntry) {
+	serialized, err := json.Marshal(entry)
+	if err != nil {
+		logger.WithError(err).Error("failed serializing superadmin audit entry")
+		return
+	}
+
+	superadminAuditLoggerMU.Lock()
+	defer superadminAuditLoggerMU.Unlock()
+
+	if superadminAuditLogger == nil {
+		superadminAuditLogger = &lumberjack.Logger{
+			Filename: confSuperadminAuditLog.GetString(),
+			MaxSize:  10,
+		}
+	}
+
+	_, err = superadminAuditLogger.Write(append(serialized, '\n'))
+	if err != nil {
+		logger.WithError(err).Error("failed writing superadmin audit entry")
+	}
+}
+
+// SuperadminMW handles bot owners accessing control panels they would not have write access to otherwise,
+// they get a banner telling them so and everything they do is written to a separate audit log
+func SuperadminMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		user, _ := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+		if user == nil || !common.IsOwner(user.ID) || ctx.Value(common.ContextKeyCurrentGuild) == nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if _, write := guildAccessLevel(ctx); write {
+			// they have access through the guild anyways
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		guild := ContextGuild(ctx)
+		ctx = context.WithValue(ctx, common.ContextKeyIsSuperadmin, true)
+		ctx = SetContextTemplateData(ctx, map[string]interface{}{"SuperadminView": true})
+
+		entry := CtxLogger(ctx).WithField("superadmin", true)
+		ctx = context.WithValue(ctx, common.ContextKeyLogger, entry)
+		if !isReadOnlyMethod(r.Method) {
+			entry.Warnf("Bot owner %s (%d) made changes as superadmin: %s %s", user.Username, user.ID, r.Method, r.URL.Path)
+			EmitSecurityEvent(r, &SecurityEvent{Type: SecurityEventOwnerAction})
+		}
+
+		recorder := NewStatusRecorder(w)
+		started := time.Now()
+		defer func() {
+			go writeSuperadminAuditEntry(&superadminAuditEntry{
+				Time:      started,
+				UserID:    user.ID,
+				Username:  user.Username,
+				GuildID:   guild.ID,
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Query:     r.URL.RawQuery,
+				IP:        GetRequestIP(r),
+				Status:    recorder.Status,
+				UserAgent: r.UserAgent(),
+			})
+		}()
+
+		inner.ServeHTTP(recorder, r.WithContext(ctx))
+	})
+}
+
+// IsSuperadminRequest returns true if the request is made by a bot owner using their superadmin access
+func IsSuperadminRequest(ctx context.Context) bool {
+	if v := ctx.Value(common.ContextKeyIsSuperadmin); v != nil {
+		return v.(bool)
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/models"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/gorilla/websocket"
+)
+
+func superadminTestContext(userID int64, member *discordgo.Member, perms int64) context.Context {
+	ctx := context.WithValue(context.Background(), common.ContextKeyUser, &discordgo.User{ID: userID, Username: "owner"})
+	ctx = context.WithValue(ctx, common.ContextKeyCurrentGuild, &dstate.GuildSet{GuildState: dstate.GuildState{ID: 10, OwnerID: 20}})
+	ctx = context.WithValue(ctx, common.ContextKeyCoreConfig, &models.CoreConfig{GuildID: 10})
+	if member != nil {
+		ctx = context.WithValue(ctx, common.ContextKeyUserMember, member)
+		ctx = context.WithValue(ctx, common.ContextKeyMemberPermissions, perms)
+	}
+
+	return ctx
+}
+
+// withTestAuditLog writes the superadmin audit log to a temporary file, returning it and a func restoring the previous one
+func withTestAuditLog(t *testing.T) (string, func()) {
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	old := confSuperadminAuditLog.LoadedValue
+	confSuperadminAuditLog.LoadedValue = auditLog
+
+	superadminAuditLoggerMU.Lock()
+	superadminAuditLogger = nil
+	superadminAuditLoggerMU.Unlock()
+
+	return auditLog, func() {
+		superadminAuditLoggerMU.Lock()
+		if superadminAuditLogger != nil {
+			superadminAuditLogger.Close()
+			superadminAuditLogger = nil
+		}
+		superadminAuditLoggerMU.Unlock()
+
+		confSuperadminAuditLog.LoadedValue = old
+	}
+}
+
+// readTestAuditLog waits for the expected amount of entries to be written in the background and returns them
+func readTestAuditLog(t *testing.T, auditLog string, expected int) []*superadminAuditEntry {
+	var lines [][]byte
+	for i := 0; i < 100; i++ {
+		raw, _ := ioutil.ReadFile(auditLog)
+		if lines = bytes.Split(bytes.TrimSpace(raw), []byte("\n")); len(raw) > 0 && len(lines) >= expected {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if len(lines) != expected {
+		t.Fatalf("expected %d audit entries, got %d", expected, len(lines))
+	}
+
+	entries := make([]*superadminAuditEntry, 0, len(lines))
+	for _, line := range lines {
+		var entry *superadminAuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestSuperadminMW(t *testing.T) {
+	defer func(old []int64) { common.BotOwners = old }(common.BotOwners)
+	common.BotOwners = []int64{1}
+
+	auditLog, restore := withTestAuditLog(t)
+	defer restore()
+
+	cases := []struct {
+		name       string
+		ctx        context.Context
+		superadmin bool
+	}{
+		{"not a owner", superadminTestContext(2, nil, 0), false},
+		{"owner with manage server", superadminTestContext(1, &discordgo.Member{User: &discordgo.User{ID: 1}}, discordgo.PermissionManageServer), false},
+		{"owner without access", superadminTestContext(1, nil, 0), true},
+		{"owner without access through the member", superadminTestContext(1, &discordgo.Member{User: &discordgo.User{ID: 1}}, 0), true},
+	}
+
+	for _, c := range cases {
+		var superadmin, banner bool
+		handler := SuperadminMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			superadmin = IsSuperadminRequest(r.Context())
+			_, tmpl := GetCreateTemplateData(r.Context())
+			banner = tmpl["SuperadminView"] == true
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+		r := httptest.NewRequest("POST", "/manage/10/core?x=1", nil).WithContext(c.ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if superadmin != c.superadmin || banner != c.superadmin {
+			t.Errorf("%s: got superadmin %t and banner %t, expected %t", c.name, superadmin, banner, c.superadmin)
+		}
+	}
+
+	// 2 of the requests were made as superadmin
+	entries := readTestAuditLog(t, auditLog, 2)
+	if entry := entries[0]; entry.UserID != 1 || entry.GuildID != 10 || entry.Method != "POST" || entry.Path != "/manage/10/core" || entry.Query != "x=1" || entry.Status != http.StatusTeapot || entry.SupportView {
+		t.Errorf("unexpected audit entry %#v", entry)
+	}
+}
+
+func TestSuperadminMWWebsocket(t *testing.T) {
+	defer func(old []int64) { common.BotOwners = old }(common.BotOwners)
+	common.BotOwners = []int64{1}
+
+	defer func(old interface{}) { confLiveMaxConnsPerGuild.LoadedValue = old }(confLiveMaxConnsPerGuild.LoadedValue)
+	confLiveMaxConnsPerGuild.LoadedValue = 10
+
+	auditLog, restore := withTestAuditLog(t)
+	defer restore()
+
+	handler := SuperadminMW(http.HandlerFunc(HandleLiveWS))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(superadminTestContext(1, nil, 0)))
+	}))
+	defer srv.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("upgrade through the superadmin middleware failed: %v", err)
+	}
+	ws.Close()
+
+	entries := readTestAuditLog(t, auditLog, 1)
+	if entries[0].Status != http.StatusSwitchingProtocols {
+		t.Errorf("expected the upgrade in the audit log, got %#v", entries[0])
+	}
+}
+
+func TestIsSuperadminRequest(t *testing.T) {
+	if IsSuperadminRequest(context.Background()) {
+		t.Error("expected false without the context key")
+	}
+
+	if !IsSuperadminRequest(context.WithValue(context.Background(), common.ContextKeyIsSuperadmin, true)) {
+		t.Error("expected true with the context key")
+	}
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/bot"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+var confSupportUsers = config.RegisterOption("yagpdb.web.support_users", "Comma separated ids of support staff that can view the control panel of any server in read only mode, to debug reported problems without joining it", "")
+
+// IsSupportUser returns true if the user is support staff, either configured through yagpdb.web.support_users
+// or having the read only access role on the main server
+func IsSupportUser(userID int64) bool {
+	for _, v := range strings.Split(confSupportUsers.GetString(), ",") {
+		if parsed, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64); parsed != 0 && parsed == userID {
+			return true
+		}
+	}
+
+	hasAccess, err := bot.HasReadOnlyAccess(userID)
+	if err != nil {
+		logger.WithError(err).Error("failed checking read only access")
+	}
+
+	return hasAccess
+}
+
+// SupportViewMW handles support staff viewing control panels they have no access to through the server itself,
+// everything that isn't a plain view is rejected regardless of what the handler would do, they get a banner telling
+// them they're in support view and the requests are written to the superadmin audit log
+func SupportViewMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		user, _ := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+		if user == nil || common.IsOwner(user.ID) || ctx.Value(common.ContextKeyCurrentGuild) == nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if read, _ := guildAccessLevel(ctx); read || !IsSupportUser(user.ID) {
+			// either they have access through the guild or they're not support staff
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		guild := ContextGuild(ctx)
+		recorder := NewStatusRecorder(w)
+		started := time.Now()
+		defer func() {
+			go writeSuperadminAuditEntry(&superadminAuditEntry{
+				Time:        started,
+				UserID:      user.ID,
+				Username:    user.Username,
+				GuildID:     guild.ID,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Query:       r.URL.RawQuery,
+				IP:          GetRequestIP(r),
+				Status:      recorder.Status,
+				UserAgent:   r.UserAgent(),
+				SupportView: true,
+			})
+		}()
+
+		ctx = context.WithValue(ctx, common.ContextKeyIsSupportView, true)
+		ctx = context.WithValue(ctx, common.ContextKeyIsReadOnly, true)
+		ctx = SetContextTemplateData(ctx, map[string]interface{}{"SupportView": true})
+		r = r.WithContext(ctx)
+
+		if !isReadOnlyMethod(r.Method) {
+			CtxLogger(ctx).Warnf("Support user %s (%d) tried making changes in support view: %s %s", user.Username, user.ID, r.Method, r.URL.Path)
+			rejectReadOnlyRequest(recorder, r)
+			return
+		}
+
+		inner.ServeHTTP(recorder, r)
+	})
+}
+
+// IsSupportViewRequest returns true if the request is made by support staff viewing a server in read only support view
+func IsSupportViewRequest(ctx context.Context) bool {
+	if v := ctx.Value(common.ContextKeyIsSupportView); v != nil {
+		return v.(bool)
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestIsSupportUser(t *testing.T) {
+	defer func(old interface{}) { confSupportUsers.LoadedValue = old }(confSupportUsers.LoadedValue)
+	confSupportUsers.LoadedValue = " 3, x,4 "
+
+	for _, id := range []int64{3, 4} {
+		if !IsSupportUser(id) {
+			t.Errorf("expected %d to be support staff", id)
+		}
+	}
+
+	if err := common.InitTestRedis(); err != nil {
+		t.Skip("no redis:", err)
+	}
+
+	// checked against the read only access role on the main server next
+	if IsSupportUser(5) {
+		t.Error("expected 5 to not be support staff")
+	}
+}
+
+func TestSupportViewMW(t *testing.T) {
+	defer func(old []int64) { common.BotOwners = old }(common.BotOwners)
+	common.BotOwners = []int64{1}
+
+	defer func(old interface{}) { confSupportUsers.LoadedValue = old }(confSupportUsers.LoadedValue)
+	confSupportUsers.LoadedValue = "1,3"
+
+	auditLog, restore := withTestAuditLog(t)
+	defer restore()
+
+	cases := []struct {
+		name        string
+		userID      int64
+		member      *discordgo.Member
+		perms       int64
+		method      string
+		supportView bool
+		status      int
+	}{
+		{"support user viewing", 3, nil, 0, "GET", true, http.StatusTeapot},
+		{"support user making changes", 3, nil, 0, "POST", true, http.StatusForbidden},
+		{"support user with access through the server", 3, &discordgo.Member{User: &discordgo.User{ID: 3}}, discordgo.PermissionManageServer, "POST", false, http.StatusTeapot},
+		{"owner", 1, nil, 0, "POST", false, http.StatusTeapot},
+	}
+
+	for _, c := range cases {
+		var supportView, readOnly, banner bool
+		handler := SupportViewMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			supportView, readOnly = IsSupportViewRequest(r.Context()), GetIsReadOnly(r.Context())
+			_, tmpl := GetCreateTemplateData(r.Context())
+			banner = tmpl["SupportView"] == true
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(c.method, "/manage/10/core", nil).WithContext(superadminTestContext(c.userID, c.member, c.perms))
+		handler.ServeHTTP(w, r)
+
+		if w.Code != c.status {
+			t.Errorf("%s: got status %d, expected %d", c.name, w.Code, c.status)
+		}
+
+		// the rejected request never reaches the handler
+		if c.status == http.StatusTeapot && (supportView != c.supportView || readOnly != c.supportView || banner != c.supportView) {
+			t.Errorf("%s: got support view %t, read only %t and banner %t, expected %t", c.name, supportView, readOnly, banner, c.supportView)
+		}
+	}
+
+	// both of the support view requests are audited, including the rejected one
+	statuses := make(map[string]int)
+	for _, entry := range readTestAuditLog(t, auditLog, 2) {
+		if !entry.SupportView || entry.UserID != 3 || entry.GuildID != 10 {
+			t.Errorf("unexpected audit entry %#v", entry)
+		}
+		statuses[entry.Method] = entry.Status
+	}
+
+	if statuses["GET"] != http.StatusTeapot || statuses["POST"] != http.StatusForbidden {
+		t.Errorf("unexpected audited statuses %v", statuses)
+	}
+}
@@ -18,6 +18,24 @@ func prettyTime(t time.Time) string {
 	return t.Format(time.RFC822)
 }
 
+// formatBytes formats a size in bytes with a binary unit, e.g 1.5 KiB
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	f := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	for i, unit := range units {
+		f /= 1024
+		if f < 1024 || i == len(units)-1 {
+			return fmt.Sprintf("%.1f %s", f, unit)
+		}
+	}
+
+	return ""
+}
+
 // mTemplate combines "template" with dictionary. so you can specify multiple variables
 // and call templates almost as if they were functions with arguments
 // makes certain templates a lot simpler
@@ -88,6 +106,8 @@ func tmplRoleDropdown(roles []discordgo.Role, highestBotRole *discordgo.Role, ar
 	}
 
 	found := false
+	limit := templateOptionLimit()
+	rendered, remaining, moreOffset := 0, 0, -1
 	for k, role := range roles {
 		// Skip the everyone role
 		if k == len(roles)-1 {
@@ -97,6 +117,16 @@ func tmplRoleDropdown(roles []discordgo.Role, highestBotRole *discordgo.Role, ar
 			continue
 		}
 
+		// huge guilds have the rest of the roles loaded through ajax, the selected one is always rendered
+		if limit > 0 && rendered >= limit && role.ID != currentSelected {
+			if moreOffset == -1 {
+				moreOffset = k
+			}
+			remaining++
+			continue
+		}
+		rendered++
+
 		output += `<option value="` + discordgo.StrID(role.ID) + `"`
 		if role.ID == currentSelected {
 			output += " selected"
@@ -122,6 +152,10 @@ func tmplRoleDropdown(roles []discordgo.Role, highestBotRole *discordgo.Role, ar
 		output += `<option value="` + discordgo.StrID(currentSelected) + `" selected>` + unknownName + "</option>\n"
 	}
 
+	if remaining > 0 {
+		output += loadMoreRolesOption(moreOffset, remaining, highestBotRole != nil)
+	}
+
 	return template.HTML(output)
 }
 
@@ -142,6 +176,8 @@ OUTER:
 		builder.WriteString(fmt.Sprintf(`<option value="%[1]d" selected>Deleted role: %[1]d</option>\n`, sr))
 	}
 
+	limit := templateOptionLimit()
+	rendered, remaining, moreOffset := 0, 0, -1
 	for k, role := range roles {
 		// Skip the everyone role
 		if k == len(roles)-1 {
@@ -153,13 +189,21 @@ OUTER:
 			continue
 		}
 
-		optIsSelected := false
-		builder.WriteString(`<option value="` + discordgo.StrID(role.ID) + `"`)
-		for _, selected := range selections {
-			if selected == role.ID {
-				builder.WriteString(" selected")
-				optIsSelected = true
+		optIsSelected := common.ContainsInt64Slice(selections, role.ID)
+
+		// huge guilds have the rest of the roles loaded through ajax, selected ones are always rendered
+		if limit > 0 && rendered >= limit && !optIsSelected {
+			if moreOffset == -1 {
+				moreOffset = k
 			}
+			remaining++
+			continue
+		}
+		rendered++
+
+		builder.WriteString(`<option value="` + discordgo.StrID(role.ID) + `"`)
+		if optIsSelected {
+			builder.WriteString(" selected")
 		}
 
 		if role.Color != 0 {
@@ -180,6 +224,10 @@ OUTER:
 		builder.WriteString(">" + optName + "</option>\n")
 	}
 
+	if remaining > 0 {
+		builder.WriteString(loadMoreRolesOption(moreOffset, remaining, highestBotRole != nil))
+	}
+
 	return template.HTML(builder.String())
 }
 
@@ -0,0 +1,686 @@
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"text/template/parse"
+
+	"github.com/botlabs-gg/yagpdb/v2/bot/botrest"
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/ignorelist"
+	"github.com/botlabs-gg/yagpdb/v2/common/models"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+// TemplateDataField documents a key of the template data, the keys not documented for a page can still be set
+// but templates accessing them while they're missing get reported in dev mode (YAGPDB_TESTING)
+type TemplateDataField struct {
+	Name        string
+	Description string
+
+	// Type is the type of the value, values of another type are reported in dev mode, nil to skip the check
+	Type reflect.Type
+
+	// Deprecated is what to use instead, set for keys that are only kept around for old templates
+	Deprecated string
+}
+
+// NewTemplateDataField returns a field with the type of example, which can be a typed nil pointer
+func NewTemplateDataField(name string, example interface{}, description string) *TemplateDataField {
+	f := &TemplateDataField{
+		Name:        name,
+		Description: description,
+	}
+
+	if example != nil {
+		f.Type = reflect.TypeOf(example)
+	}
+
+	return f
+}
+
+// TemplateDataAllPages is the page the fields available on all pages are registered under
+const TemplateDataAllPages = ""
+
+var templateDataFields = make(map[string]map[string]*TemplateDataField)
+
+// RegisterTemplateData documents the template data of a page (the name of the template rendered by the handler),
+// it should be called during init so the fields show up in the docs generated with -gentemplatedocs
+func RegisterTemplateData(page string, fields ...*TemplateDataField) {
+	if templateDataFields[page] == nil {
+		templateDataFields[page] = make(map[string]*TemplateDataField)
+	}
+
+	for _, v := range fields {
+		templateDataFields[page][v.Name] = v
+	}
+}
+
+// DocumentedTemplateData returns the documented fields by page, sorted by name
+func DocumentedTemplateData() map[string][]*TemplateDataField {
+	result := make(map[string][]*TemplateDataField)
+	for page, fields := range templateDataFields {
+		for _, v := range fields {
+			result[page] = append(result[page], v)
+		}
+
+		sort.Slice(result[page], func(i, j int) bool {
+			return result[page][i].Name < result[page][j].Name
+		})
+	}
+
+	return result
+}
+
+func findTemplateDataField(page, key string) *TemplateDataField {
+	if f, ok := templateDataFields[page][key]; ok {
+		return f
+	}
+
+	return templateDataFields[TemplateDataAllPages][key]
+}
+
+func init() {
+	RegisterTemplateData(TemplateDataAllPages,
+		NewTemplateDataField("RequestURI", "", "The uri of the request"),
+		NewTemplateDataField("StartedAtUnix", int64(0), "When the webserver was started"),
+		NewTemplateDataField("CurrentAd", (*Advertisement)(nil), "The ad to show, if any"),
+		NewTemplateDataField("LightTheme", false, "Whether the user picked the light theme"),
+		NewTemplateDataField("SidebarCollapsed", false, "Whether the user collapsed the sidebar"),
+		NewTemplateDataField("SidebarItems", map[string][]*SidebarItem(nil), "The sidebar items by category"),
+		NewTemplateDataField("GAID", "", "The google analytics id"),
+		NewTemplateDataField("BaseURL", "", "The url of the control panel, e.g https://yagpdb.xyz"),
+		NewTemplateDataField("ClientID", "", "The client id of the bot application used in the session"),
+		NewTemplateDataField("Host", "", "The host of the control panel"),
+		NewTemplateDataField("Version", "", "The version of the bot"),
+		NewTemplateDataField("Testing", false, "Whether this is a development instance"),
+		NewTemplateDataField("CSPNonce", "", "The nonce inline scripts need to be allowed by the content security policy"),
+		NewTemplateDataField("CSRFToken", "", "The csrf token forms have to include"),
+		NewTemplateDataField("Alerts", []*Alert(nil), "The alerts to show on top of the page"),
+		NewTemplateDataField("VisibleURL", "", "The url to show in the address bar after a form was posted"),
+		NewTemplateDataField("Degraded", false, "Whether the control panel is read-only because redis is down"),
+		NewTemplateDataField("Maintenance", (*Maintenance)(nil), "Set while maintenance mode is enabled, only bot owners see the pages then"),
+		NewTemplateDataField("ExtraHead", nil, "Extra html to include in the head"),
+		NewTemplateDataField("CurrentApplication", (*Application)(nil), "The bot application used in the session"),
+		NewTemplateDataField("Applications", []*Application(nil), "The bot applications served from this control panel"),
+		NewTemplateDataField("Language", "", "The language of the page, for the tr template func"),
+		NewTemplateDataField("Languages", []*Language(nil), "The languages the control panel is available in"),
+
+		NewTemplateDataField("User", (*discordgo.User)(nil), "The logged in user"),
+		NewTemplateDataField("IsBotOwner", false, "Whether the logged in user is a bot owner"),
+		NewTemplateDataField("ManagedGuilds", []*common.GuildWithConnected(nil), "The servers the user can access the control panel of"),
+
+		NewTemplateDataField("ActiveGuild", (*dstate.GuildSet)(nil), "The server of the control panel page"),
+		NewTemplateDataField("CoreConfig", (*models.CoreConfig)(nil), "The core config of the active server"),
+		NewTemplateDataField("BotMember", (*discordgo.Member)(nil), "The bot's member on the active server"),
+		NewTemplateDataField("HighestRole", (*discordgo.Role)(nil), "The bot's highest role on the active server"),
+		NewTemplateDataField("BotPermissions", int64(0), "The bot's permissions on the active server"),
+		NewTemplateDataField("IsAdmin", false, "Whether the user can edit the settings of the active server"),
+		NewTemplateDataField("SuperadminView", false, "Whether a bot owner is viewing the server as superadmin"),
+		NewTemplateDataField("SupportView", false, "Whether support staff is viewing the server"),
+		NewTemplateDataField("Breadcrumbs", []*Breadcrumb(nil), "The breadcrumbs of the page, set by NavigationMW on the pages of a server"),
+		NewTemplateDataField("ActiveNavCategory", "", "The sidebar category of the page"),
+		NewTemplateDataField("ActiveNavURL", "", "The url of the sidebar item of the page"),
+		NewTemplateDataField("Pagination", (*Pagination)(nil), "The current page of paginated lists, for the cp_pagination template"),
+		NewTemplateDataField("Export", (*ExportTable)(nil), "The data of list pages that can be downloaded as csv or json with the format query param"),
+	)
+
+	RegisterTemplateData("cp_custom_domain",
+		NewTemplateDataField("CustomDomain", (*CustomDomain)(nil), "The custom domain of the server, nil if none is set up"),
+		NewTemplateDataField("CustomDomainTarget", "", "The host the custom domain has to point to"),
+		NewTemplateDataField("CustomDomainPages", []*CustomDomainPage(nil), "The pages that can be used as the landing page"),
+		NewTemplateDataField("CustomDomainChallenge", "", "The name of the TXT record holding the verification token"),
+	)
+
+	RegisterTemplateData("cp_secrets",
+		NewTemplateDataField("SecretsEnabled", false, "Whether secrets can be stored, an encryption key has to be configured"),
+		NewTemplateDataField("Secrets", nil, "The secrets of the server, without their values"),
+		NewTemplateDataField("SecretReferences", nil, "The integrations using each secret"),
+		NewTemplateDataField("MaxSecrets", 0, "The max amount of secrets per server"),
+		NewTemplateDataField("ConfirmDeleteSecret", "", "The secret to confirm the deletion of, set when it's still in use"),
+		NewTemplateDataField("ConfirmDeleteReferences", nil, "The integrations still using the secret to delete"),
+	)
+
+	RegisterTemplateData("cp_storage",
+		NewTemplateDataField("StorageReport", nil, "The storage used by the server by category"),
+		NewTemplateDataField("ConfirmPurge", nil, "The categories selected to be cleaned up"),
+		NewTemplateDataField("ConfirmPurgeBytes", int64(0), "The bytes freed by cleaning up the selected categories"),
+		NewTemplateDataField("ConfirmPurgeQuotaPercent", nil, "The quota usage after cleaning up the selected categories"),
+	)
+
+	RegisterTemplateData("cp_share_links",
+		NewTemplateDataField("ShareLinks", nil, "The active share links of the server"),
+		NewTemplateDataField("ShareLinkPlugins", []string(nil), "The plugins that can be shared"),
+		NewTemplateDataField("MaxShareLinkHours", nil, "How long share links can be valid for at most"),
+		NewTemplateDataField("NewShareLinkURL", "", "The url of the share link that was just created"),
+	)
+
+	RegisterTemplateData("cp_guild_tokens",
+		NewTemplateDataField("GuildTokens", nil, "The api tokens of the server"),
+		NewTemplateDataField("GuildTokenScopes", nil, "The scopes tokens can be given"),
+		NewTemplateDataField("NewGuildToken", "", "The token that was just created, only shown once"),
+	)
+
+	RegisterTemplateData("cp_api_keys",
+		NewTemplateDataField("APIKeys", nil, "The api keys of the user"),
+		NewTemplateDataField("NewAPIKey", "", "The key that was just created, only shown once"),
+	)
+
+	RegisterTemplateData("cp_sessions",
+		NewTemplateDataField("Sessions", nil, "The active sessions of the user"),
+	)
+
+	RegisterTemplateData("cp_digests",
+		NewTemplateDataField("Digests", []*Digest(nil), "The digests delivered within the retention, newest first"),
+		NewTemplateDataField("Digest", (*Digest)(nil), "The digest being viewed, nil on the overview"),
+		NewTemplateDataField("DigestChannel", int64(0), "The channel the digests are posted in, 0 if none"),
+		NewTemplateDataField("DigestSubscription", "", "How the user gets the digest in their DMs, empty if they don't"),
+		NewTemplateDataField("DigestSubscriberCount", 0, "The amount of admins getting the digest in their DMs"),
+	)
+
+	RegisterTemplateData("cp_emojis",
+		NewTemplateDataField("Emojis", []*discordgo.Emoji(nil), "The custom emojis of the server"),
+		NewTemplateDataField("EmojiUsage", (*EmojiUsage)(nil), "How many of the static and animated emoji slots are used"),
+		NewTemplateDataField("MaxEmojisPerUpload", 0, "The max amount of emojis created per upload"),
+	)
+
+	RegisterTemplateData("cp_simulate",
+		NewTemplateDataField("SimulatedEvent", (*SimulateEventForm)(nil), "The event being simulated"),
+		NewTemplateDataField("SimulatedActions", []*SimulatedAction(nil), "What the plugins would do in response to the event"),
+		NewTemplateDataField("Simulated", false, "Set once the event has been simulated"),
+	)
+
+	RegisterTemplateData("cp_approvals",
+		NewTemplateDataField("ApprovalSettings", (*ApprovalSettings)(nil), "Whether changes have to be approved by another admin"),
+		NewTemplateDataField("PendingChanges", []*ConfigChange(nil), "The changes waiting for approval"),
+		NewTemplateDataField("DecidedChanges", []*ConfigChange(nil), "The most recently approved, rejected or expired changes"),
+		NewTemplateDataField("IsGuildOwner", false, "Whether the user is the owner of the server, whose changes don't need approval"),
+	)
+
+	RegisterTemplateData("cp_permission_audit",
+		NewTemplateDataField("PermissionIssues", []*PermissionAuditIssue(nil), "The problems found with the channel permissions"),
+		NewTemplateDataField("MaxPermissionFixesPerRun", 0, "The max amount of permission overwrites edited per fix"),
+	)
+
+	RegisterTemplateData("cp_ignored_sources",
+		NewTemplateDataField("IgnoredSources", []*ignorelist.Entry(nil), "The bots and webhooks ignored by logging, reputation and automod"),
+		NewTemplateDataField("KnownIntegrations", []*botrest.Integration(nil), "The bots and webhooks of the server that aren't ignored yet"),
+		NewTemplateDataField("MaxIgnoredSources", 0, "The max amount of bots and webhooks that can be ignored"),
+	)
+
+	RegisterTemplateData("cp_linked_roles",
+		NewTemplateDataField("RoleConnectionMetadata", []*RoleConnectionMetadata(nil), "The linked roles metadata fields shared with discord"),
+	)
+
+	RegisterTemplateData("cp_guild_comparison",
+		NewTemplateDataField("ComparableGuilds", []*common.GuildWithConnected(nil), "The servers the user can change the settings of"),
+		NewTemplateDataField("SelectedGuilds", []int64(nil), "The ids of the servers being compared"),
+		NewTemplateDataField("Comparison", (*GuildComparison)(nil), "The plugins, settings and stats of the selected servers side by side"),
+		NewTemplateDataField("TogglePlugins", []PluginWithToggle(nil), "The plugins that can be enabled in several servers at once"),
+		NewTemplateDataField("BulkOperations", []*BulkOperation(nil), "The last changes the user made to several servers at once"),
+		NewTemplateDataField("MaxComparedGuilds", 0, "The max amount of servers compared at once"),
+	)
+
+	RegisterTemplateData("cp_core_settings",
+		NewTemplateDataField("ScheduledConfigChanges", []*ScheduledConfigChange(nil), "The settings changes waiting to be applied, sorted by when they're applied"),
+	)
+
+	RegisterTemplateData("cp_error",
+		NewTemplateDataField("ErrorStatus", 0, "The http status of the error"),
+		NewTemplateDataField("ErrorTitle", "", "The name of the status, in the language of the page"),
+		NewTemplateDataField("ErrorMessage", "", "What went wrong, in the language of the page"),
+		NewTemplateDataField("RequestID", "", "The id of the request, for users to include when contacting support"),
+	)
+}
+
+// templateDataCore holds the core fields of the template data, set and read through the typed accessors below so a
+// typo in a key or a value of the wrong type is a compile error. Templates call the getters, as methods take
+// precedence over map keys, so {{.User}} works the same as before. The keys of plugin pages stay in the map, and are
+// documented with RegisterTemplateData instead.
+type templateDataCore struct {
+	User           *discordgo.User
+	IsBotOwner     bool
+	ActiveGuild    *dstate.GuildSet
+	CoreConfig     *models.CoreConfig
+	BotMember      *discordgo.Member
+	HighestRole    *discordgo.Role
+	BotPermissions int64
+	IsAdmin        bool
+
+	CSRFToken  string
+	CSPNonce   string
+	VisibleURL string
+	Alerts     []*Alert
+
+	Language   string
+	Languages  []*Language
+	LightTheme bool
+
+	Breadcrumbs       []*Breadcrumb
+	ActiveNavCategory string
+	ActiveNavURL      string
+
+	Pagination *Pagination
+	Export     *ExportTable
+}
+
+// templateDataCoreKey is the key the core is stored under in the map, so copies of the map share it
+const templateDataCoreKey = "_core"
+
+var templateDataCoreType = reflect.TypeOf(templateDataCore{})
+
+var emptyTemplateDataCore = &templateDataCore{}
+
+// core returns the core fields for reading, without creating them so the getters work on a nil TemplateData
+func (t TemplateData) core() *templateDataCore {
+	if c, ok := t[templateDataCoreKey].(*templateDataCore); ok {
+		return c
+	}
+
+	return emptyTemplateDataCore
+}
+
+// mutableCore returns the core fields for setting them
+func (t TemplateData) mutableCore() *templateDataCore {
+	c, ok := t[templateDataCoreKey].(*templateDataCore)
+	if !ok {
+		c = &templateDataCore{}
+		t[templateDataCoreKey] = c
+	}
+
+	return c
+}
+
+// set sets the key, storing the core fields in the core. This is how maps are merged into the template data, see
+// SetContextTemplateData.
+func (t TemplateData) set(key string, value interface{}) {
+	if key == templateDataCoreKey {
+		// the fields set in the core of the other template data
+		if src, ok := value.(*templateDataCore); ok {
+			t.mergeCore(src)
+		}
+		return
+	}
+
+	field, ok := templateDataCoreType.FieldByName(key)
+	if !ok {
+		t[key] = value
+		return
+	}
+
+	dst := reflect.ValueOf(t.mutableCore()).Elem().FieldByIndex(field.Index)
+	if value == nil {
+		dst.Set(reflect.Zero(field.Type))
+		return
+	}
+
+	v := reflect.ValueOf(value)
+	if !v.Type().AssignableTo(field.Type) {
+		logger.Errorf("Template data key %s is a %T, expected %s", key, value, field.Type)
+		return
+	}
+
+	dst.Set(v)
+}
+
+func (t TemplateData) mergeCore(src *templateDataCore) {
+	srcV := reflect.ValueOf(src).Elem()
+	dstV := reflect.ValueOf(t.mutableCore()).Elem()
+	for i := 0; i < srcV.NumField(); i++ {
+		if f := srcV.Field(i); !f.IsZero() {
+			dstV.Field(i).Set(f)
+		}
+	}
+}
+
+func (t TemplateData) User() *discordgo.User {
+	return t.core().User
+}
+
+func (t TemplateData) SetUser(user *discordgo.User) TemplateData {
+	t.mutableCore().User = user
+	return t
+}
+
+func (t TemplateData) IsBotOwner() bool {
+	return t.core().IsBotOwner
+}
+
+func (t TemplateData) SetIsBotOwner(owner bool) TemplateData {
+	t.mutableCore().IsBotOwner = owner
+	return t
+}
+
+func (t TemplateData) ActiveGuild() *dstate.GuildSet {
+	return t.core().ActiveGuild
+}
+
+func (t TemplateData) SetActiveGuild(guild *dstate.GuildSet) TemplateData {
+	t.mutableCore().ActiveGuild = guild
+	return t
+}
+
+func (t TemplateData) CoreConfig() *models.CoreConfig {
+	return t.core().CoreConfig
+}
+
+func (t TemplateData) SetCoreConfig(conf *models.CoreConfig) TemplateData {
+	t.mutableCore().CoreConfig = conf
+	return t
+}
+
+func (t TemplateData) BotMember() *discordgo.Member {
+	return t.core().BotMember
+}
+
+func (t TemplateData) SetBotMember(member *discordgo.Member) TemplateData {
+	t.mutableCore().BotMember = member
+	return t
+}
+
+func (t TemplateData) HighestRole() *discordgo.Role {
+	return t.core().HighestRole
+}
+
+func (t TemplateData) BotPermissions() int64 {
+	return t.core().BotPermissions
+}
+
+// SetBotPermissions sets the bot's highest role and permissions on the active server
+func (t TemplateData) SetBotPermissions(highestRole *discordgo.Role, perms int64) TemplateData {
+	c := t.mutableCore()
+	c.HighestRole = highestRole
+	c.BotPermissions = perms
+	return t
+}
+
+func (t TemplateData) IsAdmin() bool {
+	return t.core().IsAdmin
+}
+
+func (t TemplateData) SetIsAdmin(admin bool) TemplateData {
+	t.mutableCore().IsAdmin = admin
+	return t
+}
+
+func (t TemplateData) CSRFToken() string {
+	return t.core().CSRFToken
+}
+
+func (t TemplateData) SetCSRFToken(token string) TemplateData {
+	t.mutableCore().CSRFToken = token
+	return t
+}
+
+func (t TemplateData) CSPNonce() string {
+	return t.core().CSPNonce
+}
+
+func (t TemplateData) SetCSPNonce(nonce string) TemplateData {
+	t.mutableCore().CSPNonce = nonce
+	return t
+}
+
+func (t TemplateData) VisibleURL() string {
+	return t.core().VisibleURL
+}
+
+// SetVisibleURL sets the url shown in the address bar after a form was posted, usually the page the form is on
+func (t TemplateData) SetVisibleURL(url string) TemplateData {
+	t.mutableCore().VisibleURL = url
+	return t
+}
+
+func (t TemplateData) AddAlerts(alerts ...*Alert) TemplateData {
+	c := t.mutableCore()
+	c.Alerts = append(c.Alerts, alerts...)
+	return t
+}
+
+func (t TemplateData) Alerts() []*Alert {
+	return t.core().Alerts
+}
+
+func (t TemplateData) Language() string {
+	return t.core().Language
+}
+
+func (t TemplateData) Languages() []*Language {
+	return t.core().Languages
+}
+
+func (t TemplateData) SetLanguage(lang string) TemplateData {
+	c := t.mutableCore()
+	c.Language = lang
+	c.Languages = Languages()
+	return t
+}
+
+func (t TemplateData) LightTheme() bool {
+	return t.core().LightTheme
+}
+
+func (t TemplateData) SetLightTheme(light bool) TemplateData {
+	t.mutableCore().LightTheme = light
+	return t
+}
+
+func (t TemplateData) Breadcrumbs() []*Breadcrumb {
+	return t.core().Breadcrumbs
+}
+
+func (t TemplateData) ActiveNavCategory() string {
+	return t.core().ActiveNavCategory
+}
+
+func (t TemplateData) ActiveNavURL() string {
+	return t.core().ActiveNavURL
+}
+
+// SetNavigation sets the breadcrumbs and the active sidebar item, see NavigationMW
+func (t TemplateData) SetNavigation(category string, item *SidebarItem, breadcrumbs []*Breadcrumb) TemplateData {
+	c := t.mutableCore()
+	c.ActiveNavCategory = category
+	c.ActiveNavURL = ""
+	if item != nil {
+		c.ActiveNavURL = item.URL
+	}
+	c.Breadcrumbs = breadcrumbs
+	return t
+}
+
+func (t TemplateData) Pagination() *Pagination {
+	return t.core().Pagination
+}
+
+// SetPagination sets the page of the list shown on the page, see ParsePagination
+func (t TemplateData) SetPagination(p *Pagination) TemplateData {
+	t.mutableCore().Pagination = p
+	return t
+}
+
+func (t TemplateData) Export() *ExportTable {
+	return t.core().Export
+}
+
+// SetExport sets the data the page is downloaded as with ?format=csv or ?format=json, see ExportTable
+func (t TemplateData) SetExport(table *ExportTable) TemplateData {
+	t.mutableCore().Export = table
+	return t
+}
+
+// templateDataKeys caches the root template data keys accessed by each page, including the templates it
+// passes the root data to
+var templateDataKeys sync.Map
+
+// templateDataReported keeps track of the reported keys so they're only logged once per page
+var templateDataReported sync.Map
+
+// checkTemplateData reports the template data keys the page accesses that are deprecated, or missing without being
+// documented, and the values not matching their documented type. It's only done in dev mode, after the template was
+// executed so the escaping html/template does on the first execution has already modified the tree
+func checkTemplateData(r *http.Request, page string, data interface{}) {
+	if !common.Testing {
+		return
+	}
+
+	var tmplData map[string]interface{}
+	switch t := data.(type) {
+	case TemplateData:
+		tmplData = t
+	case map[string]interface{}:
+		tmplData = t
+	default:
+		return
+	}
+
+	var keys []string
+	if v, ok := templateDataKeys.Load(page); ok {
+		keys = v.([]string)
+	} else {
+		keys = templateDataAccessedKeys(page)
+		templateDataKeys.Store(page, keys)
+	}
+
+	logger := CtxLogger(r.Context()).WithField("page", page)
+	for _, k := range keys {
+		f := findTemplateDataField(page, k)
+		if f != nil && f.Deprecated != "" {
+			if reportTemplateData(page, k) {
+				logger.Warnf("Template accesses the deprecated template data key %s, use %s instead", k, f.Deprecated)
+			}
+			continue
+		}
+
+		if _, ok := tmplData[k]; !ok && f == nil && reportTemplateData(page, k) {
+			logger.Warnf("Template accesses the unknown template data key %s, document it with web.RegisterTemplateData if it's only set sometimes", k)
+		}
+	}
+
+	for k, v := range tmplData {
+		f := findTemplateDataField(page, k)
+		if f == nil || f.Type == nil || v == nil {
+			continue
+		}
+
+		if !reflect.TypeOf(v).AssignableTo(f.Type) && reportTemplateData(page, k) {
+			logger.Warnf("Template data key %s is a %T, documented as %s", k, v, f.Type)
+		}
+	}
+}
+
+func reportTemplateData(page, key string) bool {
+	_, reported := templateDataReported.LoadOrStore(page+"."+key, true)
+	return !reported
+}
+
+// templateDataAccessedKeys returns the sorted root template data keys accessed by the template
+func templateDataAccessedKeys(name string) []string {
+	w := &templateDataWalker{
+		keys:    make(map[string]bool),
+		visited: make(map[string]bool),
+	}
+	w.walkTemplate(name)
+
+	result := make([]string, 0, len(w.keys))
+	for k := range w.keys {
+		result = append(result, k)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+type templateDataWalker struct {
+	keys    map[string]bool
+	visited map[string]bool
+}
+
+func (w *templateDataWalker) walkTemplate(name string) {
+	if w.visited[name] {
+		return
+	}
+	w.visited[name] = true
+
+	t := Templates.Lookup(name)
+	if t == nil || t.Tree == nil {
+		return
+	}
+
+	w.walk(t.Tree.Root, true)
+}
+
+// walk collects the keys accessed on the root data, dotIsRoot is false inside range and with blocks
+func (w *templateDataWalker) walk(node parse.Node, dotIsRoot bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, v := range n.Nodes {
+			w.walk(v, dotIsRoot)
+		}
+	case *parse.ActionNode:
+		w.walk(n.Pipe, dotIsRoot)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+
+		for _, v := range n.Cmds {
+			w.walk(v, dotIsRoot)
+		}
+	case *parse.CommandNode:
+		for _, v := range n.Args {
+			w.walk(v, dotIsRoot)
+		}
+	case *parse.ChainNode:
+		w.walk(n.Node, dotIsRoot)
+	case *parse.FieldNode:
+		if dotIsRoot {
+			w.keys[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		// only templates executed with the root data are walked, so $ is always the root data
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			w.keys[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		w.walk(n.Pipe, dotIsRoot)
+		w.walk(n.List, dotIsRoot)
+		w.walk(n.ElseList, dotIsRoot)
+	case *parse.RangeNode:
+		w.walk(n.Pipe, dotIsRoot)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, dotIsRoot)
+	case *parse.WithNode:
+		w.walk(n.Pipe, dotIsRoot)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, dotIsRoot)
+	case *parse.TemplateNode:
+		w.walk(n.Pipe, dotIsRoot)
+		if isRootDataPipe(n.Pipe, dotIsRoot) {
+			w.walkTemplate(n.Name)
+		}
+	}
+}
+
+// isRootDataPipe returns true if the pipe is just the root data, e.g {{template "cp_head" .}}
+func isRootDataPipe(pipe *parse.PipeNode, dotIsRoot bool) bool {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+
+	switch t := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return dotIsRoot
+	case *parse.VariableNode:
+		return len(t.Ident) == 1 && t.Ident[0] == "$"
+	}
+
+	return false
+}
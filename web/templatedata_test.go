@@ -0,0 +1,94 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"reflect"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+func TestTemplateDataAccessedKeys(t *testing.T) {
+	orig := Templates
+	defer func() {
+		Templates = orig
+	}()
+
+	Templates = template.Must(template.New("").Parse(`
+{{define "head"}}{{.User.Username}}{{template "item" .ActiveGuild}}{{end}}
+{{define "item"}}{{.Name}}{{end}}
+{{define "page"}}
+{{template "head" .}}
+{{if .Alerts}}{{len .Alerts}}{{end}}
+{{range .Entries}}{{.Message}}{{$.Typo}}{{else}}{{.Empty}}{{end}}
+{{with .Config}}{{.Enabled}}{{end}}
+{{$x := .Declared}}{{(.Chained).Field}}
+{{end}}`))
+
+	expected := []string{"ActiveGuild", "Alerts", "Chained", "Config", "Declared", "Empty", "Entries", "Typo", "User"}
+	if got := templateDataAccessedKeys("page"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestTemplateDataAccessors(t *testing.T) {
+	tmpl := TemplateData{}
+	if tmpl.User() != nil || tmpl.IsAdmin() || tmpl.ActiveGuild() != nil || tmpl.VisibleURL() != "" {
+		t.Error("expected the zero values for missing keys")
+	}
+
+	// the core fields are stored in the core, not under their keys in the map
+	tmpl["IsAdmin"] = true
+	if tmpl.IsAdmin() {
+		t.Error("expected the key in the map to not be the core field")
+	}
+	delete(tmpl, "IsAdmin")
+
+	tmpl.SetUser(&discordgo.User{Username: "jonas"}).SetIsAdmin(true).SetVisibleURL("/manage")
+	if tmpl.User().Username != "jonas" || !tmpl.IsAdmin() || tmpl.VisibleURL() != "/manage" {
+		t.Errorf("the getters didn't return what was set: %v", tmpl)
+	}
+
+	// templates call the getters, which return what accessing the key would
+	page := template.Must(template.New("").Parse(`{{.User.Username}} {{if .IsAdmin}}admin{{end}} {{if .ActiveGuild}}guild{{end}}`))
+
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, tmpl); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "jonas admin " {
+		t.Errorf("got %q", buf.String())
+	}
+}
+
+func TestSetContextTemplateData(t *testing.T) {
+	ctx := SetContextTemplateData(context.Background(), map[string]interface{}{"CSPNonce": "abc", "Page": 1})
+	_, tmpl := GetCreateTemplateData(ctx)
+	if tmpl.CSPNonce() != "abc" || tmpl["Page"] != 1 {
+		t.Fatalf("expected the nonce in the core and the page key in the map, got %v", tmpl)
+	}
+
+	if _, ok := tmpl["CSPNonce"]; ok {
+		t.Error("expected the core field to not be in the map")
+	}
+
+	// merged into the existing template data, keeping the core fields that aren't set again
+	base := TemplateData{"SidebarCollapsed": true}.SetLightTheme(true).AddAlerts(SucessAlert("saved"))
+	SetContextTemplateData(ctx, base)
+	SetContextTemplateData(ctx, map[string]interface{}{"IsAdmin": true, "VisibleURL": 1})
+	if tmpl.CSPNonce() != "abc" || !tmpl.LightTheme() || len(tmpl.Alerts()) != 1 || !tmpl.IsAdmin() || tmpl["SidebarCollapsed"] != true {
+		t.Errorf("unexpected merged template data %v", tmpl)
+	}
+
+	// values of the wrong type are left out
+	if tmpl.VisibleURL() != "" {
+		t.Errorf("expected the visible url of the wrong type to be left out, got %q", tmpl.VisibleURL())
+	}
+
+	var empty TemplateData
+	if empty.User() != nil || empty.Alerts() != nil || empty.CSPNonce() != "" {
+		t.Error("expected the zero values from a nil template data")
+	}
+}
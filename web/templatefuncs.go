@@ -0,0 +1,31 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+)
+
+// every template func, for parsing the templates again in dev mode
+var templateFuncs = make(template.FuncMap)
+
+// RegisterTemplateFuncs makes the funcs available to the control panel templates, so plugins can keep the helpers
+// their pages need to themselves. Funcs have to be registered before the templates using them are added, e.g at the
+// top of InitWeb, and their names can't be taken already: registering the same name twice panics.
+func RegisterTemplateFuncs(funcs template.FuncMap) {
+	for k := range funcs {
+		if _, ok := templateFuncs[k]; ok {
+			panic(fmt.Sprintf("template func %s registered twice", k))
+		}
+	}
+
+	addTemplateFuncs(funcs)
+}
+
+// addTemplateFuncs adds the funcs to the templates, overriding the ones with the same name
+func addTemplateFuncs(funcs template.FuncMap) {
+	for k, v := range funcs {
+		templateFuncs[k] = v
+	}
+
+	Templates = Templates.Funcs(funcs)
+}
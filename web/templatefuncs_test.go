@@ -0,0 +1,35 @@
+package web
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestRegisterTemplateFuncs(t *testing.T) {
+	defer func(tmpl *template.Template, funcs template.FuncMap, sources []*templateSource) {
+		Templates, templateFuncs, templateSources = tmpl, funcs, sources
+	}(Templates, templateFuncs, templateSources)
+
+	Templates = template.New("")
+	templateFuncs = make(template.FuncMap)
+
+	RegisterTemplateFuncs(template.FuncMap{"shout": strings.ToUpper})
+	AddHTMLTemplate("plugin/assets/page.html", `{{define "page"}}{{shout "hi"}}{{end}}`)
+
+	var buf bytes.Buffer
+	if err := Templates.ExecuteTemplate(&buf, "page", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "HI" {
+		t.Errorf("got %q, expected the registered func to be called", buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a func twice to panic")
+		}
+	}()
+	RegisterTemplateFuncs(template.FuncMap{"shout": strings.ToLower})
+}
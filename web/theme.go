@@ -0,0 +1,109 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/mediocregopher/radix/v3"
+)
+
+const (
+	lightThemeCookieName = "light_theme"
+
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+func keyUserTheme(userID int64) string {
+	return "user_theme:" + discordgo.StrID(userID)
+}
+
+// ThemeMiddleware makes the theme a logged in user picked follow them across devices, overriding the cookie of the
+// browser, which is only used for logged out users and users who never picked one
+func ThemeMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		light, ok := userLightTheme(r)
+		if !ok {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		// kept in sync so the scripts toggling it and the pages cached by the cookie agree with the account
+		if _, err := r.Cookie(lightThemeCookieName); err != nil || cookieEnabled(r, lightThemeCookieName) != light {
+			http.SetCookie(w, themeCookie(light))
+		}
+
+		ctx, tmpl := GetCreateTemplateData(r.Context())
+		tmpl.SetLightTheme(light)
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// userLightTheme returns whether the logged in user picked the light theme, ok is false if they didn't pick one
+func userLightTheme(r *http.Request) (light bool, ok bool) {
+	user, isUser := r.Context().Value(common.ContextKeyUser).(*discordgo.User)
+	if !isUser || RequestClassOf(r) == RequestClassAPI || RedisDegraded() {
+		return false, false
+	}
+
+	var stored string
+	err := common.RedisPool.Do(radix.Cmd(&stored, "GET", keyUserTheme(user.ID)))
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("failed retrieving the theme of the user")
+		return false, false
+	}
+
+	switch stored {
+	case ThemeLight:
+		return true, true
+	case ThemeDark:
+		return false, true
+	}
+
+	return false, false
+}
+
+func themeCookie(light bool) *http.Cookie {
+	value := "false"
+	if light {
+		value = "true"
+	}
+
+	cookie := applyCookieAttributes(&http.Cookie{
+		Name:    lightThemeCookieName,
+		Value:   value,
+		Path:    "/",
+		Expires: time.Now().Add(time.Hour * 24 * 365),
+	})
+
+	// toggleTheme in spongebob.js sets it too
+	cookie.HttpOnly = false
+	return cookie
+}
+
+// HandleSetTheme changes the theme of the control panel, for the account too if the user is logged in. It's called
+// by the theme toggle in the nav with the theme form value, "light" or "dark".
+func HandleSetTheme(w http.ResponseWriter, r *http.Request) {
+	theme := r.FormValue("theme")
+	if theme != ThemeLight && theme != ThemeDark {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		LogIgnoreErr(json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "Unknown theme, should be light or dark"}))
+		return
+	}
+
+	if user, ok := r.Context().Value(common.ContextKeyUser).(*discordgo.User); ok {
+		err := common.RedisPool.Do(radix.Cmd(nil, "SET", keyUserTheme(user.ID), theme))
+		if err != nil {
+			CtxLogger(r.Context()).WithError(err).Error("failed saving the theme of the user")
+		}
+	}
+
+	http.SetCookie(w, themeCookie(theme == ThemeLight))
+
+	w.Header().Set("Content-Type", "application/json")
+	LogIgnoreErr(json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "theme": theme}))
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleSetTheme(t *testing.T) {
+	post := func(theme string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/theme", strings.NewReader(url.Values{"theme": {theme}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		HandleSetTheme(w, r)
+		return w
+	}
+
+	w := post("purple")
+	if w.Code != http.StatusBadRequest || len(w.Result().Cookies()) != 0 {
+		t.Errorf("expected an unknown theme to be rejected, got %d with cookies %v", w.Code, w.Result().Cookies())
+	}
+
+	for theme, cookie := range map[string]string{ThemeLight: "true", ThemeDark: "false"} {
+		w = post(theme)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ok":true`) {
+			t.Errorf("%s: unexpected response %d: %s", theme, w.Code, w.Body.String())
+		}
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != lightThemeCookieName || cookies[0].Value != cookie {
+			t.Errorf("%s: expected the %s cookie to be %s, got %v", theme, lightThemeCookieName, cookie, cookies)
+		}
+	}
+}
+
+func TestThemeMiddlewareLoggedOut(t *testing.T) {
+	var served bool
+	handler := ThemeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+
+	r := httptest.NewRequest("GET", "/manage", nil)
+	r.AddCookie(&http.Cookie{Name: lightThemeCookieName, Value: "true"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if !served || len(w.Result().Cookies()) != 0 {
+		t.Errorf("expected logged out requests to keep the cookie of the browser, got cookies %v", w.Result().Cookies())
+	}
+}
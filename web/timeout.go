@@ -0,0 +1,272 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	confRequestTimeout      = config.RegisterOption("yagpdb.web.request_timeout", "Seconds a request can take before it's answered with a timeout page, 0 disables it", 30)
+	confCPRequestTimeout    = config.RegisterOption("yagpdb.web.cp_request_timeout", "Request timeout in seconds for the control panel under /manage/, 0 disables it", 60)
+	confAPIRequestTimeout   = config.RegisterOption("yagpdb.web.api_request_timeout", "Request timeout in seconds for the public api under /api/, 0 disables it", 15)
+	confDebugRequestTimeout = config.RegisterOption("yagpdb.web.debug_request_timeout", "Request timeout in seconds for the profiling routes under /debug/, 0 disables it as cpu profiles and traces take as long as asked for", 0)
+
+	metricsRequestTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "yagpdb_web_request_timeouts_total",
+		Help: "Requests answered with a timeout page, by route group",
+	}, []string{"group"})
+)
+
+// routeTimeout is the timeout of the routes under a path prefix
+type routeTimeout struct {
+	group   string
+	prefix  string
+	seconds *config.ConfigOption
+}
+
+// the most specific prefix wins, routes not under any of these use yagpdb.web.request_timeout
+var routeTimeouts = []*routeTimeout{
+	{group: "cp", prefix: "/manage/", seconds: confCPRequestTimeout},
+	{group: "api", prefix: "/api/", seconds: confAPIRequestTimeout},
+	{group: "api", prefix: "/public-api/", seconds: confAPIRequestTimeout},
+	{group: "debug", prefix: "/debug/", seconds: confDebugRequestTimeout},
+	{group: "stream", prefix: "/status/stream", seconds: confStreamRequestTimeout},
+}
+
+// timeoutForPath returns the route group of the path and its timeout, 0 if it has none
+func timeoutForPath(path string) (string, time.Duration) {
+	group, seconds := "default", confRequestTimeout
+	matched := 0
+	for _, v := range routeTimeouts {
+		if len(v.prefix) > matched && strings.HasPrefix(path, v.prefix) {
+			group, seconds, matched = v.group, v.seconds, len(v.prefix)
+		}
+	}
+
+	return group, time.Duration(seconds.GetInt()) * time.Second
+}
+
+// TimeoutMiddleware bounds how long the handlers below it can take before the request is answered with a timeout
+// page, or a json error for api routes. The timeout depends on the route group, see routeTimeouts.
+func TimeoutMiddleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group, timeout := timeoutForPath(r.URL.Path)
+		if timeout <= 0 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		timeoutHandler(inner, timeout, group).ServeHTTP(w, r)
+	})
+}
+
+// timeoutWriter passes the response through, the timeout only applies until the handler starts writing so streamed
+// responses and hijacked connections aren't cut off. Headers are kept separately until then, as the timeout response
+// is written while the handler may still be setting them.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+// writeHeaderLocked sends the headers if they haven't been sent yet, tw.mu has to be held
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.wroteHeader {
+		return
+	}
+
+	tw.wroteHeader = true
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.timedOut {
+		tw.writeHeaderLocked(code)
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+
+	if f, ok := tw.w.(http.Flusher); ok {
+		tw.writeHeaderLocked(http.StatusOK)
+		f.Flush()
+	}
+}
+
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+
+	if h, ok := tw.w.(http.Hijacker); ok {
+		tw.wroteHeader = true
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+func timeoutHandler(inner http.Handler, timeout time.Duration, group string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		tw := &timeoutWriter{w: w, h: make(http.Header)}
+		done := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
+
+		go func() {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				if !tw.timedOut {
+					// re-panicked below, so the recovery middleware handles it
+					panicChan <- p
+				} else if p != http.ErrAbortHandler {
+					reportRequestPanic(r, p).WithField("method", r.Method).WithField("path", r.URL.Path).
+						Errorf("Recovered from panic in web handler after it timed out: %v", p)
+				}
+			}()
+
+			inner.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+
+		tw.mu.Lock()
+		// it may have finished while the lock was waited for
+		select {
+		case p := <-panicChan:
+			tw.mu.Unlock()
+			panic(p)
+		case <-done:
+			tw.mu.Unlock()
+			return
+		default:
+		}
+
+		if tw.wroteHeader {
+			// the response has already been started, all that can be done is cancelling the context
+			tw.mu.Unlock()
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+			}
+			return
+		}
+
+		tw.timedOut = true
+		tw.mu.Unlock()
+
+		// the handler keeps running in the background until it notices the cancelled context, its writes are dropped
+		metricsRequestTimeouts.WithLabelValues(group).Inc()
+		CtxLogger(ctx).WithField("method", r.Method).WithField("path", r.URL.Path).WithField("timeout", timeout.String()).
+			Warn("Request timed out")
+		writeTimeoutResponse(w, r)
+	})
+}
+
+// writeTimeoutResponse responds with a 503, as json for api routes and otherwise with a page that has a retry button
+func writeTimeoutResponse(w http.ResponseWriter, r *http.Request) {
+	const retryAfter = 5
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	if wantsJSONError(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error":       "The request took too long, try again in a bit",
+			"code":        "timeout",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	if Templates == nil || Templates.Lookup("error_timeout") == nil {
+		http.Error(w, "The request took too long, try again in a bit", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	// changes may or may not have been saved, so they're not retried automatically
+	retryURL := r.URL.RequestURI()
+	if !isReadOnlyMethod(r.Method) {
+		retryURL = r.Referer()
+		if retryURL == "" {
+			retryURL = "/manage"
+		}
+	}
+
+	err := Templates.ExecuteTemplate(w, "error_timeout", map[string]interface{}{"RetryURL": retryURL, "Changed": !isReadOnlyMethod(r.Method)})
+	if err != nil {
+		CtxLogger(r.Context()).WithError(err).Error("Failed executing timeout page template")
+		fmt.Fprint(w, "The request took too long, try again in a bit")
+	}
+}
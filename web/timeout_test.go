@@ -0,0 +1,97 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	release := make(chan struct{})
+	slow := timeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Slow", "1")
+		<-release
+		w.Write([]byte("too late"))
+	}), time.Millisecond*10, "test")
+
+	w := httptest.NewRecorder()
+	slow.ServeHTTP(w, httptest.NewRequest("GET", "/api/1/stats", nil))
+	close(release)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"code":"timeout"`) {
+		t.Errorf("expected a timeout error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w.Header().Get("X-Slow") != "" || w.Header().Get("Retry-After") == "" {
+		t.Errorf("unexpected headers: %v", w.Header())
+	}
+
+	fast := timeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}), time.Second, "test")
+
+	w = httptest.NewRecorder()
+	fast.ServeHTTP(w, httptest.NewRequest("GET", "/manage", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "ok" || w.Header().Get("X-Fast") != "1" {
+		t.Errorf("expected the response to pass through, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTimeoutHandlerStartedResponse(t *testing.T) {
+	// streamed responses aren't cut off once started
+	handler := timeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("["))
+		time.Sleep(time.Millisecond * 30)
+		w.Write([]byte("]"))
+	}), time.Millisecond*10, "test")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/manage/1/export.json", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("expected the full response, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTimeoutHandlerPanic(t *testing.T) {
+	handler := RecoveryMiddleware(timeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh no")
+	}), time.Second, "test"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/manage/1/storage.json", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected the panic to reach the recovery middleware, got %d", w.Code)
+	}
+}
+
+func TestTimeoutForPath(t *testing.T) {
+	confRequestTimeout.LoadedValue = 30
+	confCPRequestTimeout.LoadedValue = 60
+	confAPIRequestTimeout.LoadedValue = 15
+	confDebugRequestTimeout.LoadedValue = 0
+
+	cases := []struct {
+		path    string
+		group   string
+		timeout time.Duration
+	}{
+		{"/", "default", time.Second * 30},
+		{"/manage", "default", time.Second * 30},
+		{"/manage/1/core", "cp", time.Second * 60},
+		{"/api/1/channelperms/2", "api", time.Second * 15},
+		{"/public-api/v1/guilds/1/stats", "api", time.Second * 15},
+		{"/debug/pprof/profile", "debug", 0},
+		{"/status/stream", "stream", time.Second * 600},
+		{"/status.json", "default", time.Second * 30},
+	}
+
+	for _, c := range cases {
+		group, timeout := timeoutForPath(c.path)
+		if group != c.group || timeout != c.timeout {
+			t.Errorf("timeoutForPath(%q) = %s, %s, want %s, %s", c.path, group, timeout, c.group, c.timeout)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common/tracing"
+)
+
+// tracingResponseWriter keeps track of the status code of the response for the request span
+type tracingResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *tracingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *tracingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *tracingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// TracingMiddleware records a span for every non static request, continuing the trace of the proxy in front of us if it sent one.
+// The spans of the middlewares, redis, botrest, the discord api and template rendering below it are part of its trace.
+func TracingMiddleware(inner http.Handler) http.Handler {
+	mw := func(w http.ResponseWriter, r *http.Request) {
+		if !tracing.Enabled() || isStatic(r) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, span := tracing.StartSpan(tracing.Extract(r.Context(), r.Header), "HTTP "+r.Method, tracing.KindServer)
+		if span == nil {
+			// not sampled
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		span.SetAttribute("request_id", RequestID(r))
+
+		tw := &tracingResponseWriter{ResponseWriter: w}
+		defer func() {
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+
+			span.SetAttribute("http.status_code", tw.status)
+			if tw.status >= 500 {
+				span.SetError(errors.New(http.StatusText(tw.status)))
+			}
+
+			span.End()
+		}()
+
+		inner.ServeHTTP(tw, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(mw)
+}
+
+// traceMW wraps the middleware with a span covering the time until it passes the request on,
+// so the time spent in each of them shows up in the trace of the request
+func traceMW(name string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		untraced := mw(inner)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tracing.SpanFromContext(r.Context()) == nil {
+				untraced.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, span := tracing.StartSpan(r.Context(), "middleware "+name, tracing.KindInternal)
+			defer span.End()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				span.End()
+				inner.ServeHTTP(w, r.WithContext(tracing.ContextWithSpan(r.Context(), span.Parent())))
+			})
+
+			mw(next).ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// executeTemplateTraced executes the template with a span in the trace of the request
+func executeTemplateTraced(r *http.Request, w io.Writer, name string, data interface{}) error {
+	_, span := tracing.StartSpan(r.Context(), "render "+name, tracing.KindInternal)
+	defer span.End()
+
+	err := Templates.ExecuteTemplate(w, name, data)
+	span.SetError(err)
+	return err
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"io"
+	"net/http"
+
+	// register the decoders for the image formats discord accepts
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+var (
+	ErrUploadTooBig     = NewPublicError("The uploaded file is too big")
+	ErrUploadNotAnImage = NewPublicError("The uploaded file is not a valid png, jpeg or gif image")
+)
+
+// ImageUpload is a validated image uploaded through a form
+type ImageUpload struct {
+	Data   []byte
+	Format string
+	Width  int
+	Height int
+}
+
+// DataURI returns the image as a data uri, the format discord expects for avatars, emojis and so on
+func (u *ImageUpload) DataURI() string {
+	return "data:image/" + u.Format + ";base64," + base64.StdEncoding.EncodeToString(u.Data)
+}
+
+// ReadImageUpload reads and validates the image in the multipart form field, returning nil if no file was uploaded
+func ReadImageUpload(r *http.Request, field string, maxSize int64) (*ImageUpload, error) {
+	f, _, err := r.FormFile(field)
+	if err != nil {
+		if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	return DecodeImageUpload(f, maxSize)
+}
+
+// DecodeImageUpload reads atmost maxSize bytes from r and makes sure it's a image in a format discord accepts
+func DecodeImageUpload(r io.Reader, maxSize int64) (*ImageUpload, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, ErrUploadTooBig
+	}
+
+	conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUploadNotAnImage
+	}
+
+	return &ImageUpload{
+		Data:   data,
+		Format: format,
+		Width:  conf.Width,
+		Height: conf.Height,
+	}, nil
+}
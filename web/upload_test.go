@@ -0,0 +1,73 @@
+package web
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeImageUpload(t *testing.T) {
+	data := testPNG(t)
+
+	upload, err := DecodeImageUpload(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upload.Format != "png" || upload.Width != 4 || upload.Height != 2 {
+		t.Errorf("unexpected upload %s %dx%d", upload.Format, upload.Width, upload.Height)
+	}
+
+	if !strings.HasPrefix(upload.DataURI(), "data:image/png;base64,iVBOR") {
+		t.Errorf("unexpected data uri %s", upload.DataURI())
+	}
+
+	if _, err := DecodeImageUpload(bytes.NewReader(data), int64(len(data)-1)); err != ErrUploadTooBig {
+		t.Errorf("expected ErrUploadTooBig, got %v", err)
+	}
+
+	if _, err := DecodeImageUpload(strings.NewReader("<svg></svg>"), 1000); err != ErrUploadNotAnImage {
+		t.Errorf("expected ErrUploadNotAnImage, got %v", err)
+	}
+}
+
+func TestReadImageUpload(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("Avatar", "avatar.png")
+	fw.Write(testPNG(t))
+	mw.WriteField("Username", "bot")
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	upload, err := ReadImageUpload(r, "Avatar", 10000)
+	if err != nil || upload == nil || upload.Format != "png" {
+		t.Fatalf("unexpected upload %v, %v", upload, err)
+	}
+
+	// no file in the field, or not a multipart form at all
+	if upload, err := ReadImageUpload(r, "Other", 10000); upload != nil || err != nil {
+		t.Errorf("expected no upload for a missing field, got %v, %v", upload, err)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("Username=bot"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if upload, err := ReadImageUpload(r, "Avatar", 10000); upload != nil || err != nil {
+		t.Errorf("expected no upload for a urlencoded form, got %v, %v", upload, err)
+	}
+}
@@ -1,16 +1,17 @@
 package web
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 
-	"github.com/botlabs-gg/yagpdb/v2/bot"
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
@@ -31,13 +32,17 @@ func SetContextTemplateData(ctx context.Context, data map[string]interface{}) co
 	if val := ctx.Value(common.ContextKeyTemplateData); val != nil {
 		cast := val.(TemplateData)
 		for k, v := range data {
-			cast[k] = v
+			cast.set(k, v)
 		}
 		return ctx
 	}
 
 	// Fallback
-	return context.WithValue(ctx, common.ContextKeyTemplateData, TemplateData(data))
+	tmpl := make(TemplateData, len(data))
+	for k, v := range data {
+		tmpl.set(k, v)
+	}
+	return context.WithValue(ctx, common.ContextKeyTemplateData, tmpl)
 }
 
 func DiscordSessionFromContext(ctx context.Context) *discordgo.Session {
@@ -68,7 +73,7 @@ func GenSessionCookie() *http.Cookie {
 		MaxAge: 86400,
 		Path:   "/",
 	}
-	return cookie
+	return applyCookieAttributes(cookie)
 }
 
 func LogIgnoreErr(err error) {
@@ -77,25 +82,10 @@ func LogIgnoreErr(err error) {
 	}
 }
 
+// TemplateData is the data pages are rendered with, the core fields all pages have are typed, see templateDataCore,
+// and the map holds the keys of the pages themselves
 type TemplateData map[string]interface{}
 
-func (t TemplateData) AddAlerts(alerts ...*Alert) TemplateData {
-	if t["Alerts"] == nil {
-		t["Alerts"] = make([]*Alert, 0)
-	}
-
-	t["Alerts"] = append(t["Alerts"].([]*Alert), alerts...)
-	return t
-}
-
-func (t TemplateData) Alerts() []*Alert {
-	if v, ok := t["Alerts"]; ok {
-		return v.([]*Alert)
-	}
-
-	return nil
-}
-
 func GetCreateTemplateData(ctx context.Context) (context.Context, TemplateData) {
 	if v := ctx.Value(common.ContextKeyTemplateData); v != nil {
 		return ctx, v.(TemplateData)
@@ -108,6 +98,9 @@ func GetCreateTemplateData(ctx context.Context) (context.Context, TemplateData)
 type Alert struct {
 	Style   string
 	Message string
+
+	// set if the alert was created from a single Localizer, e.g a Message
+	msg Localizer
 }
 
 const (
@@ -117,25 +110,39 @@ const (
 	AlertWarning = "warning"
 )
 
-func ErrorAlert(args ...interface{}) *Alert {
-	return &Alert{
-		Style:   AlertDanger,
+func newAlert(style string, args []interface{}) *Alert {
+	alert := &Alert{
+		Style:   style,
 		Message: fmt.Sprint(args...),
 	}
+
+	if len(args) == 1 {
+		alert.msg, _ = args[0].(Localizer)
+	}
+
+	return alert
+}
+
+func ErrorAlert(args ...interface{}) *Alert {
+	return newAlert(AlertDanger, args)
 }
 
 func WarningAlert(args ...interface{}) *Alert {
-	return &Alert{
-		Style:   AlertWarning,
-		Message: fmt.Sprint(args...),
-	}
+	return newAlert(AlertWarning, args)
 }
 
 func SucessAlert(args ...interface{}) *Alert {
-	return &Alert{
-		Style:   AlertSuccess,
-		Message: fmt.Sprint(args...),
+	return newAlert(AlertSuccess, args)
+}
+
+// localize translates the message of the alert, messages without a translation are kept as is
+func (a *Alert) localize(lang string) {
+	if a.msg != nil {
+		a.Message = a.msg.Localize(lang)
+		return
 	}
+
+	a.Message = Translate(lang, a.Message)
 }
 
 func ContextGuild(ctx context.Context) *dstate.GuildSet {
@@ -184,43 +191,25 @@ func CheckErr(t TemplateData, err error, errMsg string, logger func(...interface
 }
 
 // Checks the context if there is a logged in user and if so if he's and admin or not
+// users with only read access are not treated as admins on requests that could change something
 func IsAdminRequest(ctx context.Context, r *http.Request) (read bool, write bool) {
+	read, write = GetAccessLevel(ctx)
+	if write {
+		return true, true
+	}
 
-	isReadOnlyReq := strings.EqualFold(r.Method, "GET") || strings.EqualFold(r.Method, "OPTIONS")
-
-	if v := ctx.Value(common.ContextKeyCurrentGuild); v != nil {
-		// accessing a server page
-		g := v.(*dstate.GuildSet)
-
-		gWithConnected := &common.GuildWithConnected{
-			UserGuild: &discordgo.UserGuild{
-				ID: g.ID,
-			},
-			Connected: true,
-		}
-
-		coreConf := common.ContextCoreConf(ctx)
-		member := ContextMember(ctx)
-
-		userID := int64(0)
-		var roles []int64
-
-		if member != nil {
-			userID = member.User.ID
-			roles = member.Roles
-
-			gWithConnected.Permissions = ContextMemberPerms(ctx)
-			gWithConnected.Owner = userID == g.OwnerID
-		}
+	if read && isReadOnlyMethod(r.Method) {
+		return true, false
+	}
 
-		hasRead, hasWrite := GetUserAccessLevel(userID, gWithConnected, coreConf, StaticRoleProvider(roles))
-		if hasWrite {
-			return true, true
-		}
+	return false, false
+}
 
-		if hasRead && isReadOnlyReq {
-			return true, false
-		}
+// GetAccessLevel returns the access level the user has to the current guild (if any), regardless of the request method
+func GetAccessLevel(ctx context.Context) (read bool, write bool) {
+	read, write = guildAccessLevel(ctx)
+	if write {
+		return true, true
 	}
 
 	if user := ctx.Value(common.ContextKeyUser); user != nil {
@@ -231,15 +220,62 @@ func IsAdminRequest(ctx context.Context, r *http.Request) (read bool, write bool
 			return true, true
 		}
 
-		if isReadOnlyReq {
-			// allow special read only acces for GET and OPTIONS requests, simple and works well
-			if hasAcces, err := bot.HasReadOnlyAccess(cast.ID); hasAcces && err == nil {
-				return true, false
-			}
+		if !read {
+			// special read only access for support staff, see SupportViewMW
+			read = IsSupportUser(cast.ID)
 		}
 	}
 
-	return false, false
+	return read, false
+}
+
+// guildAccessLevel returns the access level the user has through the current guild's settings and their permissions on it
+func guildAccessLevel(ctx context.Context) (read bool, write bool) {
+	v := ctx.Value(common.ContextKeyCurrentGuild)
+	if v == nil {
+		return false, false
+	}
+
+	// accessing a server page
+	g := v.(*dstate.GuildSet)
+
+	gWithConnected := &common.GuildWithConnected{
+		UserGuild: &discordgo.UserGuild{
+			ID: g.ID,
+		},
+		Connected: true,
+	}
+
+	coreConf := common.ContextCoreConf(ctx)
+	member := ContextMember(ctx)
+
+	userID := int64(0)
+	var roles []int64
+
+	if member != nil {
+		userID = member.User.ID
+		roles = member.Roles
+
+		gWithConnected.Permissions = ContextMemberPerms(ctx)
+		gWithConnected.Owner = userID == g.OwnerID
+	}
+
+	return GetUserAccessLevel(userID, gWithConnected, coreConf, StaticRoleProvider(roles))
+}
+
+func isReadOnlyMethod(method string) bool {
+	return strings.EqualFold(method, "GET") || strings.EqualFold(method, "OPTIONS") || strings.EqualFold(method, "HEAD")
+}
+
+// isLocalRedirect returns true if target is a path on this site, and safe to redirect to after logging in and such.
+// Browsers treat backslashes like forward slashes, so "/\evil.com" would take the user off site too.
+func isLocalRedirect(target string) bool {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.Contains(target, "\\") {
+		return false
+	}
+
+	parsed, err := url.Parse(target)
+	return err == nil && parsed.Scheme == "" && parsed.Host == ""
 }
 
 func NewLogEntryFromContext(ctx context.Context, action string, params ...*cplogs.Param) *cplogs.LogEntry {
@@ -250,7 +286,30 @@ func NewLogEntryFromContext(ctx context.Context, action string, params ...*cplog
 
 	g := ctx.Value(common.ContextKeyCurrentGuild).(*dstate.GuildSet)
 
-	return cplogs.NewEntry(g.ID, user.ID, user.Username, action, params...)
+	entry := cplogs.NewEntry(g.ID, user.ID, user.Username, action, params...)
+	if info, ok := ctx.Value(common.ContextKeyCPLogRequest).(cplogs.RequestInfo); ok {
+		entry.Request = info
+	}
+
+	return entry
+}
+
+// max length of the user agent stored with control panel log entries
+const maxCPLogUserAgentLength = 256
+
+// CPLogRequestMW records where the request came from, so the control panel log entries created during it
+// can show the ip, user agent and route the change was made through
+func CPLogRequestMW(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := cplogs.RequestInfo{
+			IP:        GetRequestIP(r),
+			UserAgent: common.CutStringShort(r.UserAgent(), maxCPLogUserAgentLength),
+			Route:     r.Method + " " + r.URL.Path,
+		}
+
+		ctx := context.WithValue(r.Context(), common.ContextKeyCPLogRequest, info)
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 func StaticRoleProvider(roles []int64) func(guildID, userID int64) []int64 {
@@ -284,7 +343,7 @@ func CtxLogger(ctx context.Context) *logrus.Entry {
 }
 
 func WriteErrorResponse(w http.ResponseWriter, r *http.Request, err string, statusCode int) {
-	if r.FormValue("partial") != "" {
+	if r.URL.Query().Get("partial") != "" {
 		w.WriteHeader(statusCode)
 		w.Write([]byte(`{"error": "` + err + `"}`))
 		return
@@ -356,18 +415,9 @@ func EnabledDisabledSpanStatus(enabled bool) (str string) {
 	return fmt.Sprintf("<span class=\"text-%s\">%s</span>%s", enabledClass, enabledStr, indicator)
 }
 
+// GetRequestIP returns the ip of the client, see ClientIP
 func GetRequestIP(r *http.Request) string {
-	headerField := confReverseProxyClientIPHeader.GetString()
-	if headerField == "" {
-		li := strings.LastIndex(r.RemoteAddr, ":")
-		if li < 0 {
-			return r.RemoteAddr
-		}
-
-		return r.RemoteAddr[:li]
-	}
-
-	return r.Header.Get(headerField)
+	return ClientIP(r)
 }
 
 func GetIsReadOnly(ctx context.Context) bool {
@@ -378,3 +428,34 @@ func GetIsReadOnly(ctx context.Context) bool {
 
 	return readOnly.(bool)
 }
+
+// StatusRecorder wraps a ResponseWriter and remembers the status code written
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (s *StatusRecorder) WriteHeader(statusCode int) {
+	s.Status = statusCode
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *StatusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := s.ResponseWriter.(http.Hijacker); ok {
+		// the connection is handed over, e.g to a websocket
+		s.Status = http.StatusSwitchingProtocols
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("hijacking not supported")
+}
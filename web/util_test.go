@@ -0,0 +1,47 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/cplogs"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+func TestCPLogRequestMW(t *testing.T) {
+	var entry *cplogs.LogEntry
+	handler := CPLogRequestMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry = NewLogEntryFromContext(r.Context(), "test_action")
+	}))
+
+	newRequest := func(userAgent string) *http.Request {
+		r := httptest.NewRequest("POST", "/manage/1/core?x=1", nil)
+		r.Header.Set("User-Agent", userAgent)
+
+		ctx := context.WithValue(r.Context(), common.ContextKeyClientIP, "192.0.2.1")
+		ctx = context.WithValue(ctx, common.ContextKeyUser, &discordgo.User{ID: 2, Username: "user"})
+		ctx = context.WithValue(ctx, common.ContextKeyCurrentGuild, &dstate.GuildSet{GuildState: dstate.GuildState{ID: 1}})
+		return r.WithContext(ctx)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("agent"))
+	expected := cplogs.RequestInfo{IP: "192.0.2.1", UserAgent: "agent", Route: "POST /manage/1/core"}
+	if entry == nil || entry.GuildID != 1 || entry.AuthorID != 2 || entry.Request != expected {
+		t.Fatalf("unexpected entry %#v", entry)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(strings.Repeat("a", 1000)))
+	if len(entry.Request.UserAgent) > maxCPLogUserAgentLength+3 {
+		t.Errorf("expected the user agent to be cut, got %d characters", len(entry.Request.UserAgent))
+	}
+
+	// entries created outside of a request behind it have no request info
+	if entry = NewLogEntryFromContext(newRequest("agent").Context(), "test_action"); entry.Request != (cplogs.RequestInfo{}) {
+		t.Errorf("expected no request info, got %#v", entry.Request)
+	}
+}
@@ -27,7 +27,6 @@ package web
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -204,7 +203,7 @@ func ValidateForm(guild *dstate.GuildSet, tmpl TemplateData, form interface{}) b
 			}
 			prettyField = strings.TrimSpace(prettyField)
 
-			tmpl.AddAlerts(ErrorAlert(prettyField, ": ", err.Error()))
+			tmpl.AddAlerts(ErrorAlert(Msg("%s: %s", prettyField, err)))
 			ok = false
 		}
 	}
@@ -288,13 +287,13 @@ func ValidateIntMinMaxField(i int64, min, max int64, onlyMin bool) error {
 
 	if onlyMin {
 		if i < min {
-			return fmt.Errorf("should be at least %d", min)
+			return Msg("should be at least %d", min)
 		}
 		return nil
 	}
 
 	if min != max && (i < min || i > max) {
-		return fmt.Errorf("out of range (%d - %d)", min, max)
+		return Msg("out of range (%d - %d)", min, max)
 	}
 
 	return nil
@@ -304,13 +303,13 @@ func ValidateFloatField(f float64, min, max float64, onlyMin bool) error {
 
 	if onlyMin {
 		if f < min {
-			return fmt.Errorf("should be at least %f", min)
+			return Msg("should be at least %f", min)
 		}
 		return nil
 	}
 
 	if min != max && (f < min || f > max) {
-		return fmt.Errorf("out of range (%f - %f)", min, max)
+		return Msg("out of range (%f - %f)", min, max)
 	}
 
 	return nil
@@ -318,7 +317,7 @@ func ValidateFloatField(f float64, min, max float64, onlyMin bool) error {
 
 func ValidateRegexField(s string, max int) error {
 	if utf8.RuneCountInString(s) > max {
-		return fmt.Errorf("too long (max %d)", max)
+		return Msg("too long (max %d)", max)
 	}
 
 	_, err := regexp.Compile(s)
@@ -402,11 +401,11 @@ func ValidateStringField(s string, tags *ValidationTag, guild *dstate.GuildSet)
 func ValidateNormalStringField(s string, min, max int) error {
 	rCount := utf8.RuneCountInString(s)
 	if rCount > max {
-		return fmt.Errorf("too long (max %d)", max)
+		return Msg("too long (max %d)", max)
 	}
 
 	if rCount < min {
-		return fmt.Errorf("too short (min %d)", min)
+		return Msg("too short (min %d)", min)
 	}
 
 	return nil
@@ -414,7 +413,7 @@ func ValidateNormalStringField(s string, min, max int) error {
 
 func ValidateTemplateField(s string, max int) error {
 	if utf8.RuneCountInString(s) > max {
-		return fmt.Errorf("too long (max %d)", max)
+		return Msg("too long (max %d)", max)
 	}
 
 	_, err := templates.NewContext(nil, nil, nil).Parse(s)
@@ -426,7 +425,7 @@ func ValidateChannelField(s int64, channels []dstate.ChannelState, allowEmpty bo
 		if allowEmpty {
 			return nil
 		} else {
-			return errors.New("no channel specified")
+			return Msg("no channel specified")
 		}
 	}
 
@@ -444,7 +443,7 @@ func ValidateRoleField(s int64, roles []discordgo.Role, allowEmpty bool) error {
 		if allowEmpty {
 			return nil
 		} else {
-			return errors.New("no role specified (or role is above bot)")
+			return Msg("no role specified (or role is above bot)")
 		}
 	}
 
@@ -1,11 +1,12 @@
 package web
 
 import (
-	"crypto/tls"
 	"flag"
 	"html/template"
 	"io/fs"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -13,15 +14,14 @@ import (
 	"github.com/NYTimes/gziphandler"
 	"github.com/botlabs-gg/yagpdb/v2/common"
 	"github.com/botlabs-gg/yagpdb/v2/common/config"
+	"github.com/botlabs-gg/yagpdb/v2/common/lifecycle"
 	"github.com/botlabs-gg/yagpdb/v2/common/patreon"
 	yagtmpl "github.com/botlabs-gg/yagpdb/v2/common/templates"
 	"github.com/botlabs-gg/yagpdb/v2/frontend"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/web/discordblog"
-	"github.com/natefinch/lumberjack"
 	"goji.io"
 	"goji.io/pat"
-	"golang.org/x/crypto/acme/autocert"
 )
 
 var (
@@ -86,10 +86,18 @@ func init() {
 	acceptingRequests = &b
 
 	Templates = template.New("")
-	Templates = Templates.Funcs(template.FuncMap{
+	addTemplateFuncs(template.FuncMap{
 		"mTemplate":        mTemplate,
+		"cachedTemplate":   tmplCachedTemplate,
 		"hasPerm":          hasPerm,
 		"formatTime":       prettyTime,
+		"formatBytes":      formatBytes,
+		"tr":               tmplTranslate,
+		"sanitize":         SanitizeHTML,
+		"stripHTML":        StripHTML,
+		"embedPreview":     tmplEmbedPreview,
+		"discordMarkdown":  DiscordMarkdown,
+		"asset":            assetURL,
 		"checkbox":         tmplCheckbox,
 		"roleOptions":      tmplRoleDropdown,
 		"roleOptionsMulti": tmplRoleDropdownMutli,
@@ -104,11 +112,12 @@ func init() {
 		"catChannelOptionsMulti": tmplChannelOptsMulti([]discordgo.ChannelType{discordgo.ChannelTypeGuildCategory}),
 	})
 
-	Templates = Templates.Funcs(yagtmpl.StandardFuncMap)
+	addTemplateFuncs(yagtmpl.StandardFuncMap)
 
 	flag.BoolVar(&properAddresses, "pa", false, "Sets the listen addresses to 80 and 443")
-	flag.BoolVar(&https, "https", true, "Serve web on HTTPS. Only disable when using an HTTPS reverse proxy.")
+	flag.BoolVar(&https, "https", true, "Serve web on HTTPS, with certificates from Let's Encrypt unless yagpdb.web.autocert is disabled. Only disable when using an HTTPS reverse proxy.")
 	flag.BoolVar(&exthttps, "exthttps", false, "Set if the website uses external https (through reverse proxy) but should only listen on http.")
+	flag.StringVar(&devTemplatesDir, "devtemplates", "", "Path to a checkout of the repo to serve the templates and static files from, templates are parsed again when they change and nothing is minified or cached. For development only.")
 }
 
 func loadTemplates() {
@@ -117,6 +126,27 @@ func loadTemplates() {
 		"templates/index.html", "templates/cp_main.html",
 		"templates/cp_nav.html", "templates/cp_selectserver.html", "templates/cp_logs.html",
 		"templates/status.html", "templates/cp_server_home.html", "templates/cp_core_settings.html",
+		"templates/cp_sessions.html", "templates/cp_api_usage.html",
+		"templates/cp_api_keys.html",
+		"templates/cp_step_up.html",
+		"templates/cp_captcha.html",
+		"templates/cp_scheduled_actions.html",
+		"templates/cp_secrets.html",
+		"templates/cp_share_links.html",
+		"templates/cp_guild_tokens.html",
+		"templates/cp_storage.html",
+		"templates/cp_embed_preview.html",
+		"templates/cp_custom_domain.html",
+		"templates/cp_digests.html",
+		"templates/cp_emojis.html",
+		"templates/cp_simulate.html",
+		"templates/cp_approvals.html",
+		"templates/cp_permission_audit.html",
+		"templates/cp_ignored_sources.html",
+		"templates/cp_linked_roles.html",
+		"templates/cp_guild_comparison.html",
+		"templates/cp_error.html",
+		"templates/error.html",
 	}
 
 	for _, v := range coreTemplates {
@@ -139,6 +169,11 @@ func Run() {
 
 	loadTemplates()
 
+	if DevTemplates() {
+		logger.Warn("Serving templates and static files from ", devTemplatesDir, ", this is slow and only meant for development")
+		StaticFilesFS = os.DirFS(filepath.Join(devTemplatesDir, "frontend", "static"))
+	}
+
 	AddGlobalTemplateData("ClientID", common.ConfClientID.GetString())
 	AddGlobalTemplateData("Host", common.ConfHost.GetString())
 	AddGlobalTemplateData("Version", common.VERSION)
@@ -151,11 +186,28 @@ func Run() {
 
 	patreon.Run()
 
+	initSessionStore()
+	lifecycle.Go("web.session_sweeper", runSessionSweeper)
+	lifecycle.Go("web.security_event_exporter", runSecurityEventExporter)
+	lifecycle.Go("web.redis_monitor", monitorRedis)
+	lifecycle.Go("web.maintenance_refresh", runMaintenanceRefreshLoop)
+	lifecycle.Go("web.scheduled_config", runScheduledConfigLoop)
+	lifecycle.Go("web.bulk_operations", runBulkOperationsLoop)
+	lifecycle.Go("web.live_shutdown", runLiveShutdown)
+	lifecycle.Go("web.status_stream_shutdown", runStatusStreamShutdown)
+	common.InitSchemas("web_config_changes", configApprovalSchemas...)
+	lifecycle.Go("web.config_change_expiry", runConfigChangeExpiryLoop)
+	lifecycle.Go("web.digests", runDigestLoop)
 	InitOauth()
+	if confLinkedRoles.GetBool() {
+		go registerRoleConnectionMetadata()
+		lifecycle.Go("web.role_connection_refresh", runRoleConnectionRefreshLoop)
+	}
+
 	mux := setupRoutes()
 
 	// Start monitoring the bot
-	go pollCommandsRan()
+	lifecycle.Go("web.commands_ran_poller", pollCommandsRan)
 
 	blogChannel := confAnnouncementsChannel.GetInt()
 	if blogChannel != 0 {
@@ -164,8 +216,12 @@ func Run() {
 
 	loadAd()
 
+	// needs to be started after the plugins had the chance to add their templates and global data
+	lifecycle.Go("web.landing_page_cache", runLandingPageCacheLoop)
+
 	logger.Info("Running webservers")
-	runServers(mux)
+	// the cached logged out pages are served in front of the middlewares of the root mux
+	runServers(customDomainHandler(landingPageCacheHandler(mux)))
 }
 
 func loadAd() {
@@ -196,6 +252,7 @@ func loadAd() {
 	}
 }
 
+// Stop makes the webserver reject new requests, see Shutdown for draining it
 func Stop() {
 	atomic.StoreInt32(acceptingRequests, 0)
 }
@@ -204,7 +261,7 @@ func IsAcceptingRequests() bool {
 	return atomic.LoadInt32(acceptingRequests) != 0
 }
 
-func runServers(mainMuxer *goji.Mux) {
+func runServers(mainMuxer http.Handler) {
 	if !https {
 		logger.Info("Starting yagpdb web server http:", ListenAddressHTTP)
 
@@ -213,33 +270,32 @@ func runServers(mainMuxer *goji.Mux) {
 			Handler:     mainMuxer,
 			IdleTimeout: time.Minute,
 		}
+		trackServer(server)
 
 		err := server.ListenAndServe()
-		if err != nil {
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("Failed http ListenAndServe:", err)
 		}
 	} else {
-		logger.Info("Starting yagpdb web server http:", ListenAddressHTTP, ", and https:", ListenAddressHTTPS)
-
-		cache := autocert.DirCache("cert")
-
-		certManager := autocert.Manager{
-			Prompt:     autocert.AcceptTOS,
-			HostPolicy: autocert.HostWhitelist(common.ConfHost.GetString(), "www."+common.ConfHost.GetString()),
-			Email:      common.ConfEmail.GetString(),
-			Cache:      cache,
+		tlsConfig, httpHandler, err := setupTLS()
+		if err != nil {
+			logger.WithError(err).Error("Failed setting up https")
+			return
 		}
 
-		// launch the redir server
+		logger.Info("Starting yagpdb web server http:", ListenAddressHTTP, ", and https:", ListenAddressHTTPS)
+
+		// launch the redir server, which also answers the http-01 challenges when using autocert
 		go func() {
 			unsafeHandler := &http.Server{
 				Addr:        ListenAddressHTTP,
-				Handler:     certManager.HTTPHandler(http.HandlerFunc(httpsRedirHandler)),
+				Handler:     httpHandler,
 				IdleTimeout: time.Minute,
 			}
+			trackServer(unsafeHandler)
 
 			err := unsafeHandler.ListenAndServe()
-			if err != nil {
+			if err != nil && err != http.ErrServerClosed {
 				logger.Error("Failed http ListenAndServe:", err)
 			}
 		}()
@@ -248,13 +304,12 @@ func runServers(mainMuxer *goji.Mux) {
 			Addr:        ListenAddressHTTPS,
 			Handler:     mainMuxer,
 			IdleTimeout: time.Minute,
-			TLSConfig: &tls.Config{
-				GetCertificate: certManager.GetCertificate,
-			},
+			TLSConfig:   tlsConfig,
 		}
+		trackServer(tlsServer)
 
-		err := tlsServer.ListenAndServeTLS("", "")
-		if err != nil {
+		err = tlsServer.ListenAndServeTLS("", "")
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("Failed https ListenAndServeTLS:", err)
 		}
 	}
@@ -271,6 +326,8 @@ func setupRoutes() *goji.Mux {
 	serverPublicMux.Use(RequireActiveServer)
 	serverPublicMux.Use(LoadCoreConfigMiddleware)
 	serverPublicMux.Use(SetGuildMemberMiddleware)
+	serverPublicMux.Use(BotFilterMW)
+	serverPublicMux.Use(NotFoundMiddleware)
 
 	RootMux.Handle(pat.New("/public/:server"), serverPublicMux)
 	RootMux.Handle(pat.New("/public/:server/*"), serverPublicMux)
@@ -282,31 +339,80 @@ func setupRoutes() *goji.Mux {
 	ServerPublicAPIMux.Use(RequireActiveServer)
 	ServerPublicAPIMux.Use(LoadCoreConfigMiddleware)
 	ServerPublicAPIMux.Use(SetGuildMemberMiddleware)
+	ServerPublicAPIMux.Use(APIUsageMW)
+	ServerPublicAPIMux.Use(NotFoundMiddleware)
+
+	// these have to come before /api/:server, which would take them as the server
+	RootMux.Handle(pat.Get("/api/openapi.json"), APIHandler(HandleOpenAPI))
+	setupAPIV1Routes()
+	if confGraphQL.GetBool() {
+		RootMux.Handle(pat.Get("/api/graphql"), requireAPIUserMW(APIHandler(HandleGraphQL)))
+		RootMux.Handle(pat.Post("/api/graphql"), requireAPIUserMW(APIHandler(HandleGraphQL)))
+		RootMux.Handle(pat.Get("/api/graphql/schema.graphql"), http.HandlerFunc(HandleGraphQLSchema))
+	}
 
 	RootMux.Handle(pat.Get("/api/:server"), ServerPublicAPIMux)
 	RootMux.Handle(pat.Get("/api/:server/*"), ServerPublicAPIMux)
 
-	ServerPublicAPIMux.Handle(pat.Get("/channelperms/:channel"), RequireActiveServer(APIHandler(HandleChanenlPermissions)))
+	publicAPIRoutes := NewAPIRoutes(ServerPublicAPIMux, "/api/:server", "Servers")
+	publicAPIRoutes.Handle(pat.Get("/channelperms/:channel"), HandleChanenlPermissions, &APIDoc{
+		Summary:  "The permissions the bot has in a channel",
+		Response: int64(0),
+		Public:   true,
+	})
 
 	// Server selection has its own handler
 	RootMux.Handle(pat.Get("/manage"), SelectServerHomePageHandler)
 	RootMux.Handle(pat.Get("/manage/"), SelectServerHomePageHandler)
-	RootMux.Handle(pat.Get("/status"), ControllerHandler(HandleStatusHTML, "cp_status"))
-	RootMux.Handle(pat.Get("/status/"), ControllerHandler(HandleStatusHTML, "cp_status"))
-	RootMux.Handle(pat.Get("/status.json"), APIHandler(HandleStatusJSON))
+
+	// the status asks every bot process for theirs, cached briefly for the visitors that aren't bot owners
+	statusHandler := CachedPage("status", time.Second*10, ControllerHandler(HandleStatusHTML, "cp_status"))
+	RootMux.Handle(pat.Get("/status"), statusHandler)
+	RootMux.Handle(pat.Get("/status/"), statusHandler)
+	RootMux.Handle(pat.Get("/status.json"), CachedPage("status", time.Second*10, APIHandler(HandleStatusJSON)))
+	RootMux.Handle(pat.Get("/status/stream"), http.HandlerFunc(HandleStatusStream))
 	RootMux.Handle(pat.Post("/shard/:shard/reconnect"), ControllerHandler(HandleReconnectShard, "cp_status"))
 	RootMux.Handle(pat.Post("/shard/:shard/reconnect/"), ControllerHandler(HandleReconnectShard, "cp_status"))
 
+	sessionsHandler := ControllerHandler(HandleGetSessions, "cp_sessions")
+	RootMux.Handle(pat.Get("/sessions"), RequireSessionMiddleware(sessionsHandler))
+	RootMux.Handle(pat.Get("/sessions/"), RequireSessionMiddleware(sessionsHandler))
+	RootMux.Handle(pat.Get("/sessions.json"), RequireSessionMiddleware(APIHandler(HandleGetSessionsJSON)))
+	RootMux.Handle(pat.Post("/sessions/:session/revoke"), RequireSessionMiddleware(ControllerPostHandler(HandleRevokeSession, sessionsHandler, nil)))
+
+	apiKeysHandler := ControllerHandler(HandleGetAPIKeys, "cp_api_keys")
+	RootMux.Handle(pat.Get("/api_keys"), RequireSessionMiddleware(apiKeysHandler))
+	RootMux.Handle(pat.Get("/api_keys/"), RequireSessionMiddleware(apiKeysHandler))
+	RootMux.Handle(pat.Post("/api_keys/new"), RequireSessionMiddleware(ControllerPostHandler(HandleCreateAPIKey, apiKeysHandler, CreateAPIKeyForm{})))
+	RootMux.Handle(pat.Post("/api_keys/:key/delete"), RequireSessionMiddleware(ControllerPostHandler(HandleDeleteAPIKey, apiKeysHandler, nil)))
+
+	comparisonHandler := ControllerHandler(HandleGetGuildComparison, "cp_guild_comparison")
+	RootMux.Handle(pat.Get("/compare"), RequireSessionMiddleware(comparisonHandler))
+	RootMux.Handle(pat.Get("/compare/"), RequireSessionMiddleware(comparisonHandler))
+	RootMux.Handle(pat.Get("/compare.json"), RequireSessionMiddleware(APIHandler(HandleGetGuildComparisonJSON)))
+	RootMux.Handle(pat.Get("/compare/operations.json"), RequireSessionMiddleware(APIHandler(HandleGetBulkOperationsJSON)))
+	RootMux.Handle(pat.Post("/compare/bulk"), RequireSessionMiddleware(ControllerPostHandler(HandleBulkPluginToggle, comparisonHandler, BulkPluginToggleForm{})))
+
+	RootMux.Handle(pat.Get("/share/:token"), ShareLinkMW(http.HandlerFunc(HandleShareLink)))
+
 	RootMux.HandleFunc(pat.Get("/cp"), legacyCPRedirHandler)
 	RootMux.HandleFunc(pat.Get("/cp/*"), legacyCPRedirHandler)
 
+	setupDebugRoutes()
+
 	// Server control panel, requires you to be an admin for the server (owner or have server management role)
 	CPMux = goji.SubMux()
-	CPMux.Use(ActiveServerMW)
+	CPMux.Use(traceMW("active_server", ActiveServerMW))
 	CPMux.Use(RequireActiveServer)
-	CPMux.Use(LoadCoreConfigMiddleware)
-	CPMux.Use(SetGuildMemberMiddleware)
+	CPMux.Use(traceMW("core_config", LoadCoreConfigMiddleware))
+	CPMux.Use(traceMW("guild_member", SetGuildMemberMiddleware))
+	CPMux.Use(SuperadminMW)
+	CPMux.Use(SupportViewMW)
 	CPMux.Use(RequireServerAdminMiddleware)
+	CPMux.Use(NotFoundMiddleware)
+	CPMux.Use(NavigationMW)
+	CPMux.Use(CPLogRequestMW)
+	CPMux.Use(ConfigApprovalMW)
 
 	RootMux.Handle(pat.New("/manage/:server"), CPMux)
 	RootMux.Handle(pat.New("/manage/:server/*"), CPMux)
@@ -315,12 +421,115 @@ func setupRoutes() *goji.Mux {
 	CPMux.Handle(pat.Get("/cplogs/"), RenderHandler(HandleCPLogs, "cp_action_logs"))
 	CPMux.Handle(pat.Get("/home"), ControllerHandler(HandleServerHome, "cp_server_home"))
 	CPMux.Handle(pat.Get("/home/"), ControllerHandler(HandleServerHome, "cp_server_home"))
-
-	coreSettingsHandler := RenderHandler(nil, "cp_core_settings")
+	CPMux.Handle(pat.Get("/api_usage"), ControllerHandler(HandleAPIUsage, "cp_api_usage"))
+	CPMux.Handle(pat.Get("/api_usage/"), ControllerHandler(HandleAPIUsage, "cp_api_usage"))
+	CPMux.Handle(pat.Get("/scheduled_actions"), ControllerHandler(HandleGetScheduledActions, "cp_scheduled_actions"))
+	CPMux.Handle(pat.Get("/scheduled_actions/"), ControllerHandler(HandleGetScheduledActions, "cp_scheduled_actions"))
+	CPMux.Handle(pat.Get("/scheduled_actions.json"), APIHandler(HandleGetScheduledActionsJSON))
+
+	secretsHandler := ControllerHandler(HandleGetSecrets, "cp_secrets")
+	CPMux.Handle(pat.Get("/secrets"), secretsHandler)
+	CPMux.Handle(pat.Get("/secrets/"), secretsHandler)
+	CPMux.Handle(pat.Post("/secrets/new"), ControllerPostHandler(HandleCreateSecret, secretsHandler, CreateSecretForm{}))
+	CPMux.Handle(pat.Post("/secrets/:name/rotate"), ControllerPostHandler(HandleRotateSecret, secretsHandler, RotateSecretForm{}))
+	CPMux.Handle(pat.Post("/secrets/:name/delete"), RequireStepUp(ControllerPostHandler(HandleDeleteSecret, secretsHandler, DeleteSecretForm{})))
+
+	shareLinksHandler := ControllerHandler(HandleGetShareLinks, "cp_share_links")
+	CPMux.Handle(pat.Get("/share_links"), shareLinksHandler)
+	CPMux.Handle(pat.Get("/share_links/"), shareLinksHandler)
+	CPMux.Handle(pat.Post("/share_links/new"), ControllerPostHandler(HandleCreateShareLink, shareLinksHandler, CreateShareLinkForm{}))
+	CPMux.Handle(pat.Post("/share_links.json"), APIHandler(HandleCreateShareLinkJSON))
+	CPMux.Handle(pat.Post("/share_links/:link/revoke"), ControllerPostHandler(HandleRevokeShareLink, shareLinksHandler, nil))
+
+	guildTokensHandler := ControllerHandler(HandleGetGuildTokens, "cp_guild_tokens")
+	CPMux.Handle(pat.Get("/guild_tokens"), guildTokensHandler)
+	CPMux.Handle(pat.Get("/guild_tokens/"), guildTokensHandler)
+	CPMux.Handle(pat.Post("/guild_tokens/new"), ControllerPostHandler(HandleCreateGuildToken, guildTokensHandler, CreateGuildTokenForm{}))
+	CPMux.Handle(pat.Post("/guild_tokens/:token/delete"), ControllerPostHandler(HandleDeleteGuildToken, guildTokensHandler, nil))
+
+	storageHandler := ControllerHandler(HandleGetStorage, "cp_storage")
+	CPMux.Handle(pat.Get("/storage"), storageHandler)
+	CPMux.Handle(pat.Get("/storage/"), storageHandler)
+	CPMux.Handle(pat.Get("/storage.json"), APIHandler(HandleGetStorageJSON))
+	CPMux.Handle(pat.Post("/storage/purge"), RequireStepUp(ControllerPostHandler(HandlePurgeStorage, storageHandler, PurgeStorageForm{})))
+
+	digestsHandler := ControllerHandler(HandleGetDigests, "cp_digests")
+	CPMux.Handle(pat.Get("/digests"), digestsHandler)
+	CPMux.Handle(pat.Get("/digests/"), digestsHandler)
+	CPMux.Handle(pat.Get("/digests/:digest"), ControllerHandler(HandleGetDigest, "cp_digests"))
+	CPMux.Handle(pat.Post("/digests/subscription"), ControllerPostHandler(HandlePostDigestSubscription, digestsHandler, DigestSubscriptionForm{}))
+	CPMux.Handle(pat.Post("/digests/channel"), ControllerPostHandler(HandlePostDigestChannel, digestsHandler, DigestChannelForm{}))
+
+	approvalsHandler := ControllerHandler(HandleGetApprovals, "cp_approvals")
+	CPMux.Handle(pat.Get("/approvals"), approvalsHandler)
+	CPMux.Handle(pat.Get("/approvals/"), approvalsHandler)
+	CPMux.Handle(pat.Get("/approvals.json"), APIHandler(HandleGetApprovalsJSON))
+	CPMux.Handle(pat.Post("/approvals/settings"), ControllerPostHandler(HandlePostApprovalSettings, approvalsHandler, ApprovalSettingsForm{}))
+	CPMux.Handle(pat.Post("/approvals/:change/approve"), ControllerPostHandler(HandleApproveChange, approvalsHandler, nil))
+	CPMux.Handle(pat.Post("/approvals/:change/reject"), ControllerPostHandler(HandleRejectChange, approvalsHandler, nil))
+	CPMux.Handle(pat.Post("/approvals/:change/approve.json"), APIHandler(HandleApproveChangeJSON))
+	CPMux.Handle(pat.Post("/approvals/:change/reject.json"), APIHandler(HandleRejectChangeJSON))
+
+	// live updates of the control panel, see live.go
+	CPMux.Handle(pat.Get("/ws"), http.HandlerFunc(HandleLiveWS))
+
+	// these don't change the settings of the server
+	ExemptFromApprovals("/simulate", "/simulate.json", "/digests/subscription", "/embed_preview", "/markdown_preview", "/core/config_import/preview")
+
+	CPMux.Handle(pat.Post("/embed_preview"), http.HandlerFunc(HandleEmbedPreview))
+	CPMux.Handle(pat.Post("/markdown_preview"), APIHandler(HandleMarkdownPreview))
+
+	simulateHandler := ControllerHandler(HandleGetSimulate, "cp_simulate")
+	CPMux.Handle(pat.Get("/simulate"), simulateHandler)
+	CPMux.Handle(pat.Get("/simulate/"), simulateHandler)
+	CPMux.Handle(pat.Post("/simulate"), ControllerPostHandler(HandlePostSimulate, simulateHandler, SimulateEventForm{}))
+	CPMux.Handle(pat.Post("/simulate.json"), APIHandler(HandleSimulateJSON))
+
+	permissionAuditHandler := RequireBotMemberMW(ControllerHandler(HandleGetPermissionAudit, "cp_permission_audit"))
+	CPMux.Handle(pat.Get("/permission_audit"), permissionAuditHandler)
+	CPMux.Handle(pat.Get("/permission_audit/"), permissionAuditHandler)
+	CPMux.Handle(pat.Get("/permission_audit.json"), RequireBotMemberMW(APIHandler(HandleGetPermissionAuditJSON)))
+	CPMux.Handle(pat.Post("/permission_audit/fix"), RequireBotMemberMW(ControllerPostHandler(HandlePostPermissionAuditFix, permissionAuditHandler, PermissionAuditFixForm{})))
+	CPMux.Handle(pat.Post("/permission_audit/fix.json"), RequireBotMemberMW(APIHandler(HandlePostPermissionAuditFixJSON)))
+
+	ignoredSourcesHandler := ControllerHandler(HandleGetIgnoredSources, "cp_ignored_sources")
+	CPMux.Handle(pat.Get("/ignored_sources"), ignoredSourcesHandler)
+	CPMux.Handle(pat.Get("/ignored_sources/"), ignoredSourcesHandler)
+	CPMux.Handle(pat.Post("/ignored_sources"), ControllerPostHandler(HandlePostIgnoredSources, ignoredSourcesHandler, IgnoredSourcesForm{}))
+	CPMux.Handle(pat.Post("/ignored_sources/add"), ControllerPostHandler(HandleAddIgnoredSource, ignoredSourcesHandler, AddIgnoredSourceForm{}))
+
+	// RequireBotMemberMW provides the permissions of the bot checked by RequirePermMW
+	emojisHandler := RequireBotMemberMW(RequirePermMW(discordgo.PermissionManageEmojisAndStickers)(ControllerHandler(HandleGetEmojis, "cp_emojis")))
+	CPMux.Handle(pat.Get("/emojis"), emojisHandler)
+	CPMux.Handle(pat.Get("/emojis/"), emojisHandler)
+	CPMux.Handle(pat.Get("/emojis/export"), RequireBotMemberMW(RequirePermMW(discordgo.PermissionManageEmojisAndStickers)(http.HandlerFunc(HandleExportEmojis))))
+	CPMux.Handle(pat.Post("/emojis/upload"), MaxBodyBytes(maxEmojiUploadSize)(RequireBotMemberMW(RequirePermMW(discordgo.PermissionManageEmojisAndStickers)(ControllerPostHandler(HandlePostEmojiUpload, emojisHandler, nil)))))
+	CPMux.Handle(pat.Post("/emojis/edit"), RequireBotMemberMW(RequirePermMW(discordgo.PermissionManageEmojisAndStickers)(ControllerPostHandler(HandlePostEmojiBulkEdit, emojisHandler, EmojiBulkEditForm{}))))
+
+	customDomainPageHandler := ControllerHandler(HandleGetCustomDomain, "cp_custom_domain")
+	CPMux.Handle(pat.Get("/custom_domain"), customDomainPageHandler)
+	CPMux.Handle(pat.Get("/custom_domain/"), customDomainPageHandler)
+	CPMux.Handle(pat.Post("/custom_domain"), ControllerPostHandler(HandlePostCustomDomain, customDomainPageHandler, CustomDomainForm{}))
+	CPMux.Handle(pat.Post("/custom_domain/verify"), ControllerPostHandler(HandleVerifyCustomDomain, customDomainPageHandler, nil))
+	CPMux.Handle(pat.Post("/custom_domain/remove"), ControllerPostHandler(HandleRemoveCustomDomain, customDomainPageHandler, nil))
+
+	CPMux.Handle(pat.Get("/options/roles"), RequireBotMemberMW(APIHandler(HandleGetRoleOptions)))
+
+	coreSettingsHandler := ControllerHandler(HandleGetCoreSettings, "cp_core_settings")
 
 	CPMux.Handle(pat.Get("/core/"), coreSettingsHandler)
 	CPMux.Handle(pat.Get("/core"), coreSettingsHandler)
 	CPMux.Handle(pat.Post("/core"), ControllerPostHandler(HandlePostCoreSettings, coreSettingsHandler, CoreConfigPostForm{}))
+	CPMux.Handle(pat.Post("/core/branding"), ControllerPostHandler(HandlePostWebhookBranding, coreSettingsHandler, WebhookBrandingForm{}))
+	CPMux.Handle(pat.Get("/config_code"), http.HandlerFunc(HandleExportConfigCode))
+	CPMux.Handle(pat.Post("/config_code/apply"), APIHandler(HandleApplyConfigCode))
+	CPMux.Handle(pat.Post("/config_code/schedule"), APIHandler(HandleScheduleConfigCode))
+	CPMux.Handle(pat.Post("/core/scheduled_config"), ControllerPostHandler(HandlePostScheduledConfig, coreSettingsHandler, ScheduleConfigCodeForm{}))
+	CPMux.Handle(pat.Post("/core/scheduled_config/:change/cancel"), ControllerPostHandler(HandleCancelScheduledConfig, coreSettingsHandler, nil))
+	CPMux.Handle(pat.Get("/config_export"), http.HandlerFunc(HandleExportConfigDocument))
+	CPMux.Handle(pat.Post("/config_import"), APIHandler(HandleImportConfigDocument))
+	CPMux.Handle(pat.Post("/core/config_import"), ControllerPostHandler(HandlePostConfigImport, coreSettingsHandler, ImportConfigForm{}))
+	CPMux.Handle(pat.Post("/core/config_import/preview"), ControllerPostHandler(HandlePreviewConfigImport, coreSettingsHandler, ImportConfigForm{}))
 
 	RootMux.Handle(pat.Get("/guild_selection"), RequireSessionMiddleware(ControllerHandler(HandleGetManagedGuilds, "cp_guild_selection")))
 	CPMux.Handle(pat.Get("/guild_selection"), RequireSessionMiddleware(ControllerHandler(HandleGetManagedGuilds, "cp_guild_selection")))
@@ -350,6 +559,84 @@ func setupRoutes() *goji.Mux {
 		Icon: "fas fa-database",
 	})
 
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Scheduled actions",
+		URL:  "scheduled_actions",
+		Icon: "fas fa-calendar-alt",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Secrets",
+		URL:  "secrets",
+		Icon: "fas fa-key",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Share settings",
+		URL:  "share_links",
+		Icon: "fas fa-share-alt",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "API tokens",
+		URL:  "guild_tokens",
+		Icon: "fas fa-plug",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Storage usage",
+		URL:  "storage",
+		Icon: "fas fa-hdd",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Weekly digest",
+		URL:  "digests",
+		Icon: "fas fa-newspaper",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Change approvals",
+		URL:  "approvals",
+		Icon: "fas fa-user-check",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Event simulator",
+		URL:  "simulate",
+		Icon: "fas fa-flask",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Emojis",
+		URL:  "emojis",
+		Icon: "fas fa-smile",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Permission audit",
+		URL:  "permission_audit",
+		Icon: "fas fa-user-shield",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Ignored bots",
+		URL:  "ignored_sources",
+		Icon: "fas fa-robot",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "Custom domain",
+		URL:  "custom_domain",
+		Icon: "fas fa-globe",
+	})
+
+	AddSidebarItem(SidebarCategoryCore, &SidebarItem{
+		Name: "API usage",
+		URL:  "api_usage",
+		Icon: "fas fa-chart-line",
+	})
+
 	for _, plugin := range common.Plugins {
 		if webPlugin, ok := plugin.(Plugin); ok {
 			webPlugin.InitWeb()
@@ -366,34 +653,92 @@ func setupRootMux() {
 	mux := goji.NewMux()
 	RootMux = mux
 
-	if !confDisableRequestLogging.GetBool() {
-		requestLogger := &lumberjack.Logger{
-			Filename: "access.log",
-			MaxSize:  10,
-		}
-
-		mux.Use(RequestLogger(requestLogger))
-	}
+	rootMiddlewareChain().Apply(mux)
 
 	// Setup fileserver
-	mux.Handle(pat.Get("/static/*"), http.FileServer(http.FS(StaticFilesFS)))
+	mux.Handle(pat.Get("/static/*"), staticFileHandler(StaticFilesFS))
 	mux.Handle(pat.Get("/robots.txt"), http.HandlerFunc(handleRobotsTXT))
 	mux.Handle(pat.Get("/ads.txt"), http.HandlerFunc(handleAdsTXT))
-
-	// General middleware
-	mux.Use(SkipStaticMW(gziphandler.GzipHandler, ".css", ".js", ".map"))
-	mux.Use(SkipStaticMW(MiscMiddleware))
-	mux.Use(SkipStaticMW(BaseTemplateDataMiddleware))
-	mux.Use(SkipStaticMW(SessionMiddleware))
-	mux.Use(SkipStaticMW(UserInfoMiddleware))
-	mux.Use(SkipStaticMW(CSRFProtectionMW))
-	mux.Use(addPromCountMW)
+	mux.Handle(pat.Get("/healthz"), http.HandlerFunc(HandleHealthz))
+	mux.Handle(pat.Get("/ready"), http.HandlerFunc(HandleReady))
+	mux.Handle(pat.Get("/live"), http.HandlerFunc(HandleLive))
 
 	// General handlers
 	mux.Handle(pat.Get("/"), ControllerHandler(HandleLandingPage, "index"))
+	CacheLoggedOutPage("/", "index", HandleLandingPage)
 	mux.HandleFunc(pat.Get("/login"), HandleLogin)
 	mux.HandleFunc(pat.Get("/confirm_login"), HandleConfirmLogin)
 	mux.HandleFunc(pat.Get("/logout"), HandleLogout)
+	mux.Handle(pat.Get("/stepup"), RequireSessionMiddleware(http.HandlerFunc(HandleStepUp)))
+	mux.HandleFunc(pat.Get("/linked_roles"), HandleLinkedRoles)
+	mux.Handle(pat.Get("/linked_roles/done"), ControllerHandler(HandleLinkedRolesDone, "cp_linked_roles"))
+	mux.Handle(pat.Post("/application"), RequireSessionMiddleware(http.HandlerFunc(HandleSelectApplication)))
+	mux.HandleFunc(pat.Post("/language"), HandleSetLanguage)
+	mux.HandleFunc(pat.Post("/theme"), HandleSetTheme)
+}
+
+// rootMiddlewareChain returns the middlewares every request goes through, the static files and probes skip most of
+// them
+func rootMiddlewareChain() *MiddlewareChain {
+	chain := NewMiddlewareChain("root")
+
+	// counted before anything else, shutting down waits for these
+	chain.Add("in_flight", InFlightMiddleware)
+
+	// the middlewares below branch on the class of the request rather than its path
+	chain.Add("classify", ClassifyRequestMiddleware, After("in_flight"))
+
+	// first so the request id is available to everything below, including the request log
+	chain.Add("request_id", RequestIDMiddleware, After("in_flight"))
+	chain.Add("client_ip", ClientIPMiddleware, After("request_id"))
+	chain.Add("tracing", TracingMiddleware, Requires("request_id"))
+
+	if !confDisableRequestLogging.GetBool() {
+		accessLogWriter = newAccessLogWriter()
+		go runAccessLogRotation(accessLogWriter)
+
+		chain.Add("request_logger", RequestLogger(accessLogWriter), Requires("request_id", "client_ip"))
+	}
+
+	// below the request logger so recovered panics are logged as 500's
+	chain.Add("recovery", RecoveryMiddleware, After("request_logger", "tracing"))
+	if DevTemplates() {
+		chain.Add("dev_templates", DevTemplatesMiddleware, Requires("recovery"), SkipFor(StaticRoutes))
+	}
+
+	chain.Add("degraded_mode", DegradedModeMiddleware, Requires("recovery"), SkipFor(StaticRoutes))
+
+	// above user_info, the discord api calls there can hang for a long time
+	chain.Add("timeout", TimeoutMiddleware, Requires("recovery"), SkipFor(StaticRoutes))
+	chain.Add("max_body_bytes", MaxBodyBytesMiddleware, SkipFor(StaticRoutes))
+
+	// the static css and js are gzipped too
+	chain.Add("gzip", SkipStaticMW(gziphandler.GzipHandler, ".css", ".js", ".map"), After("timeout"))
+	chain.Add("misc", MiscMiddleware, Traced(), Requires("request_id", "client_ip"), After("gzip"), SkipFor(StaticRoutes))
+	chain.Add("base_template_data", BaseTemplateDataMiddleware, Traced(), Requires("misc"), SkipFor(StaticRoutes))
+
+	// sessions live in redis, so degraded mode has to turn requests away before they get here
+	chain.Add("session", SessionMiddleware, Traced(), Requires("degraded_mode", "base_template_data"), SkipFor(StaticRoutes))
+	chain.Add("user_info", UserInfoMiddleware, Traced(), Requires("session", "timeout"), SkipFor(StaticRoutes))
+	chain.Add("api_key", APIKeyMiddleware, Traced(), Requires("user_info"), SkipFor(StaticRoutes))
+	chain.Add("guild_token", GuildTokenMiddleware, Traced(), Requires("user_info"), After("api_key"), SkipFor(StaticRoutes))
+
+	// the language the user picked is looked up for their account on browsers without the cookie
+	chain.Add("language", LanguageMiddleware, Requires("base_template_data"), After("user_info", "api_key", "guild_token"), SkipFor(StaticRoutes))
+	chain.Add("theme", ThemeMiddleware, Requires("base_template_data"), After("user_info", "api_key", "guild_token"), SkipFor(StaticRoutes))
+
+	// the alerts of the handlers that redirected, for the page the user lands on
+	chain.Add("flash", FlashMiddleware, Requires("session", "base_template_data"), After("api_key", "guild_token"), SkipFor(StaticRoutes))
+
+	// bot owners get through maintenance, however they're logged in
+	chain.Add("maintenance", MaintenanceMiddleware, Requires("user_info"), After("api_key", "guild_token"), SkipFor(StaticRoutes))
+	chain.Add("csrf", CSRFProtectionMW, Requires("session"), After("api_key", "guild_token"), SkipFor(StaticRoutes))
+	chain.Add("prom_count", addPromCountMW, After("csrf"))
+
+	// last so requests to pages that don't exist still get the nav of the user, in their language
+	chain.Add("not_found", NotFoundMiddleware, Requires("base_template_data"), After("language", "prom_count"), SkipFor(StaticRoutes))
+
+	return chain
 }
 
 func httpsRedirHandler(w http.ResponseWriter, r *http.Request) {
@@ -411,8 +756,7 @@ func legacyCPRedirHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func AddHTMLTemplate(name, contents string) {
-	Templates = Templates.New(name)
-	Templates = template.Must(Templates.Parse(contents))
+	parseTemplate(name, name, contents)
 }
 
 func loadCoreHTMLTemplate(path string) {
@@ -420,8 +764,7 @@ func loadCoreHTMLTemplate(path string) {
 	if err != nil {
 		panic(err)
 	}
-	Templates = Templates.New(path)
-	Templates = template.Must(Templates.Parse(string(contents)))
+	parseTemplate(path, filepath.Join("frontend", path), string(contents))
 }
 
 const (
@@ -111,7 +111,7 @@ func (p *Plugin) HandleYoutube(w http.ResponseWriter, r *http.Request) (web.Temp
 	}
 
 	templateData["Subs"] = subs
-	templateData["VisibleURL"] = "/manage/" + discordgo.StrID(ag.ID) + "/youtube"
+	templateData.SetVisibleURL("/manage/" + discordgo.StrID(ag.ID) + "/youtube")
 
 	return templateData, nil
 }